@@ -0,0 +1,478 @@
+// Package admin serve optional embedded web dashboard of easyrsa PKI: cert list and search, issuance,
+// revocation, CRL and bundle downloads and expiry heatmap. Operators authenticate with TLS client certs
+// issued by the PKI itself and are authorized by AuthorizationRules, mount the dashboard on TLS server
+// configured with TLSConfig
+package admin
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	_ "embed"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/productsupcom/go-easyrsa"
+)
+
+// AuthOpView is authorization operation of viewing inventory and downloading CRL and certs, it`s checked
+// with empty cn, e.g. rule CNs "*"
+const AuthOpView = "view"
+
+// MaxRows is a number of certs listed on the page, narrow the search to see the rest
+const MaxRows = 500
+
+// HeatmapWeeks is a number of weeks covered by expiry heatmap
+const HeatmapWeeks = 52
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+}).Parse(dashboardHTML))
+
+// revocationReason is a reason code offered by revoke form
+type revocationReason struct {
+	Code int
+	Name string
+}
+
+var revocationReasons = []revocationReason{
+	{easyrsa.CRLReasonUnspecified, "unspecified"},
+	{easyrsa.CRLReasonKeyCompromise, "keyCompromise"},
+	{easyrsa.CRLReasonAffiliationChanged, "affiliationChanged"},
+	{easyrsa.CRLReasonSuperseded, "superseded"},
+	{easyrsa.CRLReasonCessationOfOperation, "cessationOfOperation"},
+	{easyrsa.CRLReasonPrivilegeWithdrawn, "privilegeWithdrawn"},
+}
+
+// Dashboard is a http.Handler of admin web UI. Mount it with mount prefix stripped, e.g.
+// http.StripPrefix("/admin", dashboard). Every request need client cert accepted by
+// easyrsa.NewClientCertAuthenticator, viewing is authorized as AuthOpView,
+// issuance and revocation as easyrsa.AuthOpIssue and easyrsa.AuthOpRevoke of their cn
+type Dashboard struct {
+	Rules   easyrsa.AuthorizationRules // permitted operations of operators, everything is denied with no rules
+	Profile string                     // registered profile of issued certs, built-in templates if empty
+
+	pki     *easyrsa.PKI
+	auth    easyrsa.Authenticator
+	csrfKey []byte
+}
+
+// NewDashboard create dashboard of pki for operators permitted by rules
+func NewDashboard(pki *easyrsa.PKI, rules easyrsa.AuthorizationRules) (*Dashboard, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrap(err, "can`t generate csrf key")
+	}
+	return &Dashboard{Rules: rules, pki: pki, auth: easyrsa.NewClientCertAuthenticator(pki), csrfKey: key}, nil
+}
+
+// TLSConfig return server config of dashboard with cert, client certs are requested from every client
+// and verified per request against current CA certs and CRL, so CA rotation and revocation apply
+// without restart
+func TLSConfig(cert tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// httpError is an error shown with status
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func httpErrorf(status int, format string, args ...interface{}) error {
+	return &httpError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// ServeHTTP implement http.Handler for dashboard requests
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	id, err := d.authenticate(req)
+	if err != nil {
+		d.writeError(w, err)
+		return
+	}
+	if req.URL.Path == "" {
+		// mount point without trailing slash, relative links of the page need it
+		uri := strings.SplitN(req.RequestURI, "?", 2)[0]
+		redirect(w, path.Base(uri)+"/", http.StatusMovedPermanently)
+		return
+	}
+	route := strings.Trim(req.URL.Path, "/")
+	switch {
+	case route == "" && (req.Method == http.MethodGet || req.Method == http.MethodHead):
+		err = d.serveIndex(w, req, id)
+	case route == "crl.pem" && req.Method == http.MethodGet:
+		err = d.serveCRL(w, id)
+	case route == "ca.pem" && req.Method == http.MethodGet:
+		err = d.serveBundle(w, id)
+	case strings.HasPrefix(route, "cert/") && req.Method == http.MethodGet:
+		err = d.serveCert(w, id, strings.TrimSuffix(strings.TrimPrefix(route, "cert/"), ".pem"))
+	case route == "issue" && req.Method == http.MethodPost:
+		err = d.issue(w, req, id)
+	case route == "revoke" && req.Method == http.MethodPost:
+		err = d.revoke(w, req, id)
+	case route == "" || route == "crl.pem" || route == "ca.pem" || route == "issue" || route == "revoke" || strings.HasPrefix(route, "cert/"):
+		err = httpErrorf(http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		err = httpErrorf(http.StatusNotFound, "not found")
+	}
+	if err != nil {
+		d.writeError(w, err)
+	}
+}
+
+// authenticate return operator identity of request client cert
+func (d *Dashboard) authenticate(req *http.Request) (*easyrsa.Identity, error) {
+	creds := easyrsa.HTTPCredentials(req)
+	if len(creds.PeerCertificates) == 0 {
+		return nil, httpErrorf(http.StatusUnauthorized, "client certificate issued by the pki is required")
+	}
+	id, err := d.auth.Authenticate(req.Context(), &easyrsa.Credentials{PeerCertificates: creds.PeerCertificates})
+	if _, ok := errors.Cause(err).(*easyrsa.Unauthenticated); ok {
+		return nil, httpErrorf(http.StatusUnauthorized, "%s", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// authorize check operation of id, PolicyViolation is shown as forbidden
+func (d *Dashboard) authorize(id *easyrsa.Identity, req *easyrsa.AuthorizationRequest) error {
+	if err := d.Rules.Authorize(id, req); err != nil {
+		return httpErrorf(http.StatusForbidden, "%s", errors.Cause(err))
+	}
+	return nil
+}
+
+// csrfToken return form token of identity, forms are accepted only with it, so other sites can`t post
+// them with client cert of operator browser
+func (d *Dashboard) csrfToken(id *easyrsa.Identity) string {
+	mac := hmac.New(sha256.New, d.csrfKey)
+	mac.Write([]byte(id.Name))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dashboard) checkForm(w http.ResponseWriter, req *http.Request, id *easyrsa.Identity) error {
+	req.Body = http.MaxBytesReader(w, req.Body, 64*1024)
+	if err := req.ParseForm(); err != nil {
+		return httpErrorf(http.StatusBadRequest, "can`t parse form: %s", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(req.PostForm.Get("token")), []byte(d.csrfToken(id))) != 1 {
+		return httpErrorf(http.StatusForbidden, "wrong form token, reload the page")
+	}
+	return nil
+}
+
+// heatCell is a week of expiry heatmap
+type heatCell struct {
+	Start time.Time // first day of the week
+	Count int       // active certs expiring this week
+	Level int       // 0 for none to 4 for the busiest week
+}
+
+// dashboardPage is a data of dashboard template
+type dashboardPage struct {
+	Identity  *easyrsa.Identity
+	Token     string
+	Query     string
+	Status    string
+	Statuses  []string
+	Reasons   []revocationReason
+	Entries   []*easyrsa.InventoryEntry
+	Matched   int
+	Truncated bool
+	Heatmap   []heatCell
+	Expired   int    // expired certs not revoked
+	Later     int    // active certs expiring after the heatmap
+	Revoked   string // serial revoked by previous request
+	CanIssue  bool   // pki retain keys, so issued key can be downloaded
+}
+
+func (d *Dashboard) serveIndex(w http.ResponseWriter, req *http.Request, id *easyrsa.Identity) error {
+	if err := d.authorize(id, &easyrsa.AuthorizationRequest{Operation: AuthOpView}); err != nil {
+		return err
+	}
+	entries, err := d.pki.Inventory()
+	if err != nil {
+		return err
+	}
+	query := req.URL.Query()
+	page := &dashboardPage{
+		Identity: id,
+		Token:    d.csrfToken(id),
+		Query:    strings.TrimSpace(query.Get("q")),
+		Status:   query.Get("status"),
+		Statuses: []string{easyrsa.InventoryActive, easyrsa.InventoryExpired, easyrsa.InventoryRevoked},
+		Reasons:  revocationReasons,
+		Revoked:  query.Get("revoked"),
+		CanIssue: d.pki.KeyRetention(),
+	}
+	page.Heatmap, page.Expired, page.Later = heatmap(entries, d.pki.Now())
+	for _, entry := range entries {
+		if !matchEntry(entry, page.Query, page.Status) {
+			continue
+		}
+		page.Matched++
+		if len(page.Entries) < MaxRows {
+			page.Entries = append(page.Entries, entry)
+		}
+	}
+	page.Truncated = page.Matched > len(page.Entries)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return dashboardTemplate.Execute(w, page)
+}
+
+// matchEntry check that entry has status, if set, and contain query in cn, serial, subject or SANs
+func matchEntry(entry *easyrsa.InventoryEntry, query, status string) bool {
+	if status != "" && entry.Status != status {
+		return false
+	}
+	if query == "" {
+		return true
+	}
+	query = strings.ToLower(query)
+	fields := append([]string{entry.CN, entry.Serial, entry.Subject, entry.SHA256}, entry.SANs...)
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// heatmap count active certs expiring in every of HeatmapWeeks weeks since now, certs already expired
+// but not revoked and certs expiring later are counted separately
+func heatmap(entries []*easyrsa.InventoryEntry, now time.Time) ([]heatCell, int, int) {
+	start := now.UTC().Truncate(24 * time.Hour)
+	cells := make([]heatCell, HeatmapWeeks)
+	for i := range cells {
+		cells[i].Start = start.AddDate(0, 0, 7*i)
+	}
+	expired, later := 0, 0
+	for _, entry := range entries {
+		switch {
+		case entry.Status == easyrsa.InventoryExpired:
+			expired++
+		case entry.Status == easyrsa.InventoryActive:
+			week := int(entry.NotAfter.Sub(start) / (7 * 24 * time.Hour))
+			if week >= HeatmapWeeks {
+				later++
+				continue
+			}
+			cells[week].Count++
+		}
+	}
+	max := 0
+	for _, cell := range cells {
+		if cell.Count > max {
+			max = cell.Count
+		}
+	}
+	for i := range cells {
+		if cells[i].Count > 0 {
+			cells[i].Level = (4*cells[i].Count + max - 1) / max
+		}
+	}
+	return cells, expired, later
+}
+
+func (d *Dashboard) serveCRL(w http.ResponseWriter, id *easyrsa.Identity) error {
+	if err := d.authorize(id, &easyrsa.AuthorizationRequest{Operation: AuthOpView}); err != nil {
+		return err
+	}
+	list, err := d.pki.GetCRL()
+	if err != nil {
+		return err
+	}
+	if len(list.SignatureValue.Bytes) == 0 {
+		return httpErrorf(http.StatusNotFound, "no crl")
+	}
+	der, err := asn1.Marshal(*list)
+	if err != nil {
+		return errors.Wrap(err, "can`t marshal crl")
+	}
+	download(w, "crl.pem", "application/x-pem-file", pem.EncodeToMemory(&pem.Block{Type: easyrsa.PEMx509CRLBlock, Bytes: der}))
+	return nil
+}
+
+func (d *Dashboard) serveBundle(w http.ResponseWriter, id *easyrsa.Identity) error {
+	if err := d.authorize(id, &easyrsa.AuthorizationRequest{Operation: AuthOpView}); err != nil {
+		return err
+	}
+	bundle, err := d.pki.ExportTrustBundle()
+	if err != nil {
+		return err
+	}
+	download(w, "ca.pem", "application/pem-certificate-chain", bundle.PEM)
+	return nil
+}
+
+// serveCert serve cert with chain of serial, keys are never served
+func (d *Dashboard) serveCert(w http.ResponseWriter, id *easyrsa.Identity, serial string) error {
+	if err := d.authorize(id, &easyrsa.AuthorizationRequest{Operation: AuthOpView}); err != nil {
+		return err
+	}
+	pair, err := d.pair(serial)
+	if err != nil {
+		return err
+	}
+	download(w, pair.CN+".crt.pem", "application/pem-certificate-chain", pair.FullChainPEM())
+	return nil
+}
+
+func (d *Dashboard) pair(serial string) (*easyrsa.X509Pair, error) {
+	value, err := easyrsa.ParseSerial(serial)
+	if err != nil {
+		return nil, httpErrorf(http.StatusBadRequest, "invalid serial %q", serial)
+	}
+	pair, err := d.pki.Storage.GetBySerial(value)
+	if _, ok := errors.Cause(err).(*easyrsa.NotExist); ok {
+		return nil, httpErrorf(http.StatusNotFound, "certificate %s not found", serial)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// issue issue cert with generated key and serve it with chain and key as one pem download,
+// the key is not shown again
+func (d *Dashboard) issue(w http.ResponseWriter, req *http.Request, id *easyrsa.Identity) error {
+	if err := d.checkForm(w, req, id); err != nil {
+		return err
+	}
+	if !d.pki.KeyRetention() {
+		// pair would be stored before its key is found missing
+		return httpErrorf(http.StatusNotImplemented, "keys are not retained, certs can`t be issued with generated keys")
+	}
+	cn := strings.TrimSpace(req.PostForm.Get("cn"))
+	if err := easyrsa.CheckCN(cn); err != nil {
+		return httpErrorf(http.StatusBadRequest, "%s", errors.Cause(err))
+	}
+	if reservedCN(cn) {
+		return httpErrorf(http.StatusBadRequest, "cn %s is reserved", cn)
+	}
+	var dnsNames []string
+	for _, name := range strings.Split(req.PostForm.Get("dns_names"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			dnsNames = append(dnsNames, name)
+		}
+	}
+	if err := d.authorize(id, &easyrsa.AuthorizationRequest{
+		Operation: easyrsa.AuthOpIssue, CN: cn, SANs: dnsNames, Profile: d.Profile,
+	}); err != nil {
+		return err
+	}
+	pair, err := d.pki.Issue(easyrsa.CertRequest{
+		CN:        cn,
+		Server:    req.PostForm.Get("server") != "",
+		DNSNames:  dnsNames,
+		Profile:   d.Profile,
+		Requester: easyrsa.RequesterFromIdentity(id),
+	})
+	if err != nil {
+		return err
+	}
+	if !pair.HasKey() {
+		return errors.New("issued pair has no key")
+	}
+	download(w, cn+".pem", "application/x-pem-file", append(pair.FullChainPEM(), pair.KeyPemBytes...))
+	return nil
+}
+
+func (d *Dashboard) revoke(w http.ResponseWriter, req *http.Request, id *easyrsa.Identity) error {
+	if err := d.checkForm(w, req, id); err != nil {
+		return err
+	}
+	pair, err := d.pair(req.PostForm.Get("serial"))
+	if err != nil {
+		return err
+	}
+	code, err := strconv.Atoi(req.PostForm.Get("reason"))
+	if err != nil || !offeredReason(code) {
+		return httpErrorf(http.StatusBadRequest, "invalid reason %q", req.PostForm.Get("reason"))
+	}
+	if err := d.authorize(id, &easyrsa.AuthorizationRequest{Operation: easyrsa.AuthOpRevoke, CN: pair.CN}); err != nil {
+		return err
+	}
+	if reservedCN(pair.CN) {
+		return httpErrorf(http.StatusBadRequest, "cert of reserved cn %s can`t be revoked", pair.CN)
+	}
+	if !d.pki.IsRevoked(pair.Serial) {
+		actor := easyrsa.RequesterFromIdentity(id).String()
+		if err := d.pki.RevokeWithReasonCode(pair.Serial, code, actor, "revoked in admin dashboard"); err != nil {
+			return err
+		}
+	}
+	redirect(w, "./?"+url.Values{"revoked": {pair.Serial.Text(16)}}.Encode(), http.StatusSeeOther)
+	return nil
+}
+
+// reservedCN return true for cn of ca, trust anchor and crl signer, they are managed by rotation only
+func reservedCN(cn string) bool {
+	return cn == "ca" || cn == easyrsa.TrustAnchorCN || cn == easyrsa.CRLSignerCN
+}
+
+// redirect to location relative to the page, http.Redirect would resolve it against path with mount prefix stripped
+func redirect(w http.ResponseWriter, location string, code int) {
+	w.Header().Set("Location", location)
+	w.WriteHeader(code)
+}
+
+func offeredReason(code int) bool {
+	for _, reason := range revocationReasons {
+		if reason.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func download(w http.ResponseWriter, name, contentType string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	_, _ = w.Write(data)
+}
+
+func (d *Dashboard) writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch e := errors.Cause(err).(type) {
+	case *httpError:
+		status = e.status
+	case *easyrsa.PolicyViolation, *easyrsa.QuotaExceeded, *easyrsa.NotFIPSApproved:
+		status = http.StatusBadRequest
+	case *easyrsa.NotLeader:
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,261 @@
+package admin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/productsupcom/go-easyrsa"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPKI(t *testing.T, opts ...easyrsa.Option) *easyrsa.PKI {
+	dir := t.TempDir()
+	opts = append([]easyrsa.Option{easyrsa.WithKeySize(1024)}, opts...)
+	pki := easyrsa.NewPKI(easyrsa.NewDirKeyStorage(dir), easyrsa.NewFileSerialProvider(filepath.Join(dir, "serial")),
+		easyrsa.NewFileCRLHolder(filepath.Join(dir, "crl.pem")), pkix.Name{}, opts...)
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	return pki
+}
+
+func clientCert(t *testing.T, pki *easyrsa.PKI, cn string) (*easyrsa.X509Pair, *x509.Certificate) {
+	pair, err := pki.NewCert(cn, false, nil)
+	assert.NoError(t, err)
+	_, cert, err := pair.Decode()
+	assert.NoError(t, err)
+	return pair, cert
+}
+
+func TestDashboard(t *testing.T) {
+	pki := newTestPKI(t)
+	_, alice := clientCert(t, pki, "alice")
+	_, bob := clientCert(t, pki, "bob")
+	web, err := pki.Issue(easyrsa.CertRequest{CN: "web", Server: true, DNSNames: []string{"web.example.com"}})
+	assert.NoError(t, err)
+	dashboard, err := NewDashboard(pki, easyrsa.AuthorizationRules{
+		{Identities: []string{"alice"}, Operations: []string{AuthOpView, easyrsa.AuthOpRevoke}, CNs: []string{"*"}},
+		{Identities: []string{"alice"}, Operations: []string{easyrsa.AuthOpIssue}, CNs: []string{"*.pki.local"}},
+	})
+	assert.NoError(t, err)
+
+	call := func(cert *x509.Certificate, method, target string, form url.Values) *httptest.ResponseRecorder {
+		var req *http.Request
+		if form != nil {
+			req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest(method, target, nil)
+		}
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		}
+		rec := httptest.NewRecorder()
+		dashboard.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("authentication", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, call(nil, http.MethodGet, "/", nil).Code)
+		_, other := clientCert(t, newTestPKI(t), "alice")
+		assert.Equal(t, http.StatusUnauthorized, call(other, http.MethodGet, "/", nil).Code)
+		assert.Equal(t, http.StatusForbidden, call(bob, http.MethodGet, "/", nil).Code)
+		assert.Equal(t, http.StatusForbidden, call(bob, http.MethodGet, "/crl.pem", nil).Code)
+	})
+
+	t.Run("index", func(t *testing.T) {
+		rec := call(alice, http.MethodGet, "/", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Header().Get("Content-Security-Policy"), "frame-ancestors 'none'")
+		body := rec.Body.String()
+		assert.Contains(t, body, "Signed in as <b>alice</b>")
+		assert.Contains(t, body, "web.example.com")
+		assert.Contains(t, body, `action="issue"`)
+		assert.Contains(t, body, "4 found")
+		assert.Equal(t, HeatmapWeeks, strings.Count(body, `<span class="l`))
+
+		body = call(alice, http.MethodGet, "/?q=EXAMPLE", nil).Body.String()
+		assert.Contains(t, body, "1 found")
+		assert.Contains(t, call(alice, http.MethodGet, "/?status=revoked", nil).Body.String(), "0 found")
+		assert.Equal(t, http.StatusNotFound, call(alice, http.MethodGet, "/missing", nil).Code)
+		assert.Equal(t, http.StatusMethodNotAllowed, call(alice, http.MethodGet, "/issue", nil).Code)
+	})
+
+	t.Run("downloads", func(t *testing.T) {
+		rec := call(alice, http.MethodGet, "/ca.pem", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		ca, err := pki.GetLastCA()
+		assert.NoError(t, err)
+		assert.Equal(t, ca.CertPemBytes, rec.Body.Bytes())
+
+		rec = call(alice, http.MethodGet, "/cert/"+web.Serial.Text(16)+".pem", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `attachment; filename=web.crt.pem`, rec.Header().Get("Content-Disposition"))
+		assert.NotContains(t, rec.Body.String(), "PRIVATE KEY")
+		assert.Equal(t, http.StatusNotFound, call(alice, http.MethodGet, "/cert/ffff.pem", nil).Code)
+		assert.Equal(t, http.StatusBadRequest, call(alice, http.MethodGet, "/cert/xyz.pem", nil).Code)
+	})
+
+	token := dashboard.csrfToken(&easyrsa.Identity{Name: "alice"})
+
+	t.Run("issue", func(t *testing.T) {
+		form := url.Values{"cn": {"api.pki.local"}, "dns_names": {"api.pki.local, api2.pki.local"}, "server": {"1"}}
+		assert.Equal(t, http.StatusForbidden, call(alice, http.MethodPost, "/issue", form).Code)
+		form.Set("token", token)
+		rec := call(alice, http.MethodPost, "/issue", form)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `attachment; filename=api.pki.local.pem`, rec.Header().Get("Content-Disposition"))
+		block, rest := pem.Decode(rec.Body.Bytes())
+		cert, err := x509.ParseCertificate(block.Bytes)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"api.pki.local", "api2.pki.local"}, cert.DNSNames)
+		assert.Contains(t, string(rest), "PRIVATE KEY")
+		stored, err := pki.Storage.GetBySerial(cert.SerialNumber)
+		assert.NoError(t, err)
+		assert.Equal(t, "mtls:alice", stored.Metadata[easyrsa.MetadataRequester])
+
+		form.Set("cn", "db.example.com")
+		assert.Equal(t, http.StatusForbidden, call(alice, http.MethodPost, "/issue", form).Code)
+		form.Set("cn", "ca")
+		assert.Equal(t, http.StatusBadRequest, call(alice, http.MethodPost, "/issue", form).Code)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		form := url.Values{"serial": {web.Serial.Text(16)}, "reason": {"1"}}
+		assert.Equal(t, http.StatusForbidden, call(alice, http.MethodPost, "/revoke", form).Code)
+		assert.False(t, pki.IsRevoked(web.Serial))
+		form.Set("token", token)
+		form.Set("reason", "8")
+		assert.Equal(t, http.StatusBadRequest, call(alice, http.MethodPost, "/revoke", form).Code)
+		form.Set("reason", "1")
+		signer, err := pki.NewCRLSigner()
+		assert.NoError(t, err)
+		form.Set("serial", signer.Serial.Text(16))
+		assert.Equal(t, http.StatusBadRequest, call(alice, http.MethodPost, "/revoke", form).Code)
+		assert.False(t, pki.IsRevoked(signer.Serial))
+		form.Set("serial", web.Serial.Text(16))
+		rec := call(alice, http.MethodPost, "/revoke", form)
+		assert.Equal(t, http.StatusSeeOther, rec.Code)
+		assert.Equal(t, "./?revoked="+web.Serial.Text(16), rec.Header().Get("Location"))
+		assert.True(t, pki.IsRevoked(web.Serial))
+		assert.Contains(t, call(alice, http.MethodGet, "/?status=revoked", nil).Body.String(), "keyCompromise")
+
+		rec = call(alice, http.MethodGet, "/crl.pem", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		block, _ := pem.Decode(rec.Body.Bytes())
+		list, err := x509.ParseRevocationList(block.Bytes)
+		assert.NoError(t, err)
+		assert.Len(t, list.RevokedCertificates, 1) //nolint:staticcheck // RevokedCertificateEntries need go 1.21
+
+		// revoked operator cert is refused
+		form.Set("serial", alice.SerialNumber.Text(16))
+		assert.Equal(t, http.StatusSeeOther, call(alice, http.MethodPost, "/revoke", form).Code)
+		assert.Equal(t, http.StatusUnauthorized, call(alice, http.MethodGet, "/", nil).Code)
+	})
+}
+
+func TestDashboard_WithoutKeyRetention(t *testing.T) {
+	pki := newTestPKI(t, easyrsa.WithoutKeyRetention())
+	_, alice := clientCert(t, pki, "alice")
+	dashboard, err := NewDashboard(pki, easyrsa.AuthorizationRules{{Identities: []string{"alice"}, CNs: []string{"*"}}})
+	assert.NoError(t, err)
+	call := func(req *http.Request) *httptest.ResponseRecorder {
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{alice}}
+		rec := httptest.NewRecorder()
+		dashboard.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), `action="issue"`)
+
+	form := url.Values{"cn": {"api.pki.local"}, "token": {dashboard.csrfToken(&easyrsa.Identity{Name: "alice"})}}
+	req := httptest.NewRequest(http.MethodPost, "/issue", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(t, http.StatusNotImplemented, call(req).Code)
+	// nothing is left in storage
+	_, err = pki.Storage.GetLastByCn("api.pki.local")
+	assert.Error(t, err)
+}
+
+func TestDashboard_TLS(t *testing.T) {
+	pki := newTestPKI(t)
+	operator, _ := clientCert(t, pki, "alice")
+	serverPair, err := pki.Issue(easyrsa.CertRequest{CN: "admin", Server: true, IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}})
+	assert.NoError(t, err)
+	dashboard, err := NewDashboard(pki, easyrsa.AuthorizationRules{
+		{Identities: []string{"alice"}, Operations: []string{AuthOpView}, CNs: []string{"*"}},
+	})
+	assert.NoError(t, err)
+	serverCert, err := tls.X509KeyPair(serverPair.CertPemBytes, serverPair.KeyPemBytes)
+	assert.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", http.StripPrefix("/admin", dashboard))
+	server := httptest.NewUnstartedServer(mux)
+	server.TLS = TLSConfig(serverCert)
+	server.StartTLS()
+	defer server.Close()
+
+	roots, err := pki.CACertPool()
+	assert.NoError(t, err)
+	get := func(certs []tls.Certificate, target string) (*http.Response, error) {
+		client := &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs, MinVersion: tls.VersionTLS12},
+			},
+		}
+		return client.Get(server.URL + target)
+	}
+	clientCert, err := tls.X509KeyPair(operator.CertPemBytes, operator.KeyPemBytes)
+	assert.NoError(t, err)
+	res, err := get([]tls.Certificate{clientCert}, "/admin/crl.pem")
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		// nothing is revoked yet, CRL is not signed
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, string(body))
+	}
+	res, err = get([]tls.Certificate{clientCert}, "/admin")
+	if assert.NoError(t, err) {
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "/admin/", res.Request.URL.Path)
+	}
+	_, err = get(nil, "/admin/")
+	assert.Error(t, err)
+}
+
+func TestHeatmap(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	entries := []*easyrsa.InventoryEntry{
+		{Status: easyrsa.InventoryActive, NotAfter: now.Add(24 * time.Hour)},
+		{Status: easyrsa.InventoryActive, NotAfter: now.Add(48 * time.Hour)},
+		{Status: easyrsa.InventoryActive, NotAfter: now.Add(8 * 24 * time.Hour)},
+		{Status: easyrsa.InventoryActive, NotAfter: now.AddDate(2, 0, 0)},
+		{Status: easyrsa.InventoryExpired, NotAfter: now.Add(-time.Hour)},
+		{Status: easyrsa.InventoryRevoked, NotAfter: now.Add(24 * time.Hour)},
+	}
+	cells, expired, later := heatmap(entries, now)
+	assert.Len(t, cells, HeatmapWeeks)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), cells[0].Start)
+	assert.Equal(t, 2, cells[0].Count)
+	assert.Equal(t, 4, cells[0].Level)
+	assert.Equal(t, 1, cells[1].Count)
+	assert.Equal(t, 2, cells[1].Level)
+	assert.Equal(t, 0, cells[2].Level)
+	assert.Equal(t, 1, expired)
+	assert.Equal(t, 1, later)
+}
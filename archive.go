@@ -0,0 +1,190 @@
+package easyrsa
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+)
+
+// ArchiveRecord is an archived issued certificate
+type ArchiveRecord struct {
+	Serial    *big.Int          `json:"serial"`             // cert serial
+	CN        string            `json:"cn"`                 // cn of the pair
+	Subject   string            `json:"subject"`            // cert subject
+	Issuer    string            `json:"issuer"`             // cert issuer
+	NotBefore time.Time         `json:"not_before"`         // validity start
+	NotAfter  time.Time         `json:"not_after"`          // expiry
+	IssuedAt  time.Time         `json:"issued_at"`          // time cert was stored
+	SHA256    string            `json:"sha256"`             // hex sha256 fingerprint of DER cert
+	Metadata  map[string]string `json:"metadata,omitempty"` // pair metadata tags
+	DER       []byte            `json:"der"`                // DER cert, base64 in json
+}
+
+// CertArchive keep record of every issued cert for compliance retention, separately from KeyStorage,
+// so certs deleted or pruned from storage stay on record. Records are never changed or removed
+type CertArchive interface {
+	Append(record *ArchiveRecord) error                 // Append record to the archive.
+	ForEach(fn func(record *ArchiveRecord) error) error // ForEach call fn for records in append order, StopIteration stop it.
+}
+
+// WithCertArchive append every issued cert to archive as commit hook, issuance is rolled back if record
+// can`t be written. Commit hooks added after it can still roll back already archived cert, so add it last
+func WithCertArchive(archive CertArchive) Option {
+	return func(p *PKI) {
+		p.commitHooks = append(p.commitHooks, func(pair *X509Pair) error {
+			return p.archivePair(archive, pair)
+		})
+	}
+}
+
+func (p *PKI) archivePair(archive CertArchive, pair *X509Pair) error {
+	cert, err := decodeCert(pair.CertPemBytes)
+	if err != nil {
+		return err
+	}
+	fingerprint := sha256.Sum256(cert.Raw)
+	record := &ArchiveRecord{
+		Serial:    pair.Serial,
+		CN:        pair.CN,
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		IssuedAt:  p.now().UTC(),
+		SHA256:    hex.EncodeToString(fingerprint[:]),
+		DER:       cert.Raw,
+	}
+	if len(pair.Metadata) > 0 {
+		record.Metadata = make(map[string]string, len(pair.Metadata))
+		for key, value := range pair.Metadata {
+			record.Metadata[key] = value
+		}
+	}
+	return errors.Wrap(archive.Append(record), "can`t archive cert")
+}
+
+// ExportArchiveJSONL write every record as json line, DER included
+func ExportArchiveJSONL(archive CertArchive, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	return archive.ForEach(func(record *ArchiveRecord) error {
+		return errors.Wrap(enc.Encode(record), "can`t write record")
+	})
+}
+
+// ExportArchiveCSV write records as csv report with header, without DER
+func ExportArchiveCSV(archive CertArchive, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"serial", "cn", "subject", "issuer", "not_before", "not_after", "issued_at", "sha256", "metadata"})
+	if err != nil {
+		return errors.Wrap(err, "can`t write csv header")
+	}
+	err = archive.ForEach(func(record *ArchiveRecord) error {
+		metadata := ""
+		if len(record.Metadata) > 0 {
+			b, err := json.Marshal(record.Metadata)
+			if err != nil {
+				return errors.Wrap(err, "can`t encode metadata")
+			}
+			metadata = string(b)
+		}
+		return cw.Write([]string{
+			FormatSerial(record.Serial),
+			record.CN,
+			record.Subject,
+			record.Issuer,
+			record.NotBefore.UTC().Format(time.RFC3339),
+			record.NotAfter.UTC().Format(time.RFC3339),
+			record.IssuedAt.UTC().Format(time.RFC3339),
+			record.SHA256,
+			metadata,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return errors.Wrap(cw.Error(), "can`t write csv")
+}
+
+// FileCertArchive implement CertArchive interface with json lines file opened for append only, so it suits
+// WORM mounts and files with append-only attribute (chattr +a). Every record is synced before issuance completes
+type FileCertArchive struct {
+	locker *flock.Flock
+	path   string
+}
+
+func NewFileCertArchive(path string) *FileCertArchive {
+	return &FileCertArchive{locker: flock.New(path + ".lock"), path: path}
+}
+
+func (a *FileCertArchive) Append(record *ArchiveRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "can`t encode archive record")
+	}
+	if err := a.locker.Lock(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = a.locker.Unlock()
+	}()
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "can`t open cert archive")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "can`t write cert archive")
+	}
+	return errors.Wrap(file.Sync(), "can`t sync cert archive")
+}
+
+func (a *FileCertArchive) ForEach(fn func(record *ArchiveRecord) error) error {
+	if err := a.locker.RLock(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = a.locker.Unlock()
+	}()
+	file, err := os.Open(a.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "can`t open cert archive")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		record := &ArchiveRecord{}
+		if err := json.Unmarshal(line, record); err != nil {
+			return errors.Wrap(err, "can`t parse cert archive")
+		}
+		if err := fn(record); err != nil {
+			if err == StopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return errors.Wrap(scanner.Err(), "can`t read cert archive")
+}
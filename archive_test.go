@@ -0,0 +1,73 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingArchive struct{}
+
+func (failingArchive) Append(*ArchiveRecord) error { return errors.New("archive is down") }
+
+func (failingArchive) ForEach(func(*ArchiveRecord) error) error { return nil }
+
+func TestWithCertArchive(t *testing.T) {
+	archive := NewFileCertArchive(filepath.Join(t.TempDir(), "archive.jsonl"))
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithCertArchive(archive))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	issued, err := pki.Issue(CertRequest{CN: "alice", Metadata: map[string]string{"team": "infra"}})
+	assert.NoError(t, err)
+	assert.NoError(t, pki.Storage.DeleteBySerial(issued.Serial))
+
+	jsonl := bytes.NewBuffer(nil)
+	assert.NoError(t, ExportArchiveJSONL(archive, jsonl))
+	lines := bytes.Split(bytes.TrimSpace(jsonl.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 2)
+	record := &ArchiveRecord{}
+	assert.NoError(t, json.Unmarshal(lines[1], record))
+	assert.Equal(t, "alice", record.CN)
+	assert.Equal(t, 0, record.Serial.Cmp(issued.Serial))
+	assert.Equal(t, "infra", record.Metadata["team"])
+	cert, err := x509.ParseCertificate(record.DER)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", cert.Subject.CommonName)
+
+	report := bytes.NewBuffer(nil)
+	assert.NoError(t, ExportArchiveCSV(archive, report))
+	rows, err := csv.NewReader(report).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, "serial", rows[0][0])
+	assert.Equal(t, "ca", rows[1][1])
+	assert.Equal(t, FormatSerial(issued.Serial), rows[2][0])
+	assert.Equal(t, record.SHA256, rows[2][7])
+	assert.Equal(t, `{"team":"infra"}`, rows[2][8])
+
+	count := 0
+	assert.NoError(t, archive.ForEach(func(*ArchiveRecord) error {
+		count++
+		return StopIteration
+	}))
+	assert.Equal(t, 1, count)
+}
+
+func TestWithCertArchive_Rollback(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	WithCertArchive(failingArchive{})(pki)
+	_, err = pki.NewCert("alice", false, nil)
+	assert.Error(t, err)
+	_, err = pki.Storage.GetByCN("alice")
+	assert.Error(t, err)
+}
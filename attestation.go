@@ -0,0 +1,172 @@
+package easyrsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MetadataAttestation is a metadata tag with type of verified attestation, it can`t be set by callers
+const MetadataAttestation = "attestation"
+
+// Attestation is an evidence supplied with issuance request, e.g. TPM quote,
+// cloud instance identity document or Kubernetes service account token
+type Attestation struct {
+	Type     string // evidence format, selects registered Attestor
+	Evidence []byte // raw evidence
+}
+
+// AttestationRequest is an issuance request checked by Attestor before signing
+type AttestationRequest struct {
+	CN          string            // requested cn
+	Template    *x509.Certificate // cert template, attestor may restrict it
+	PublicKey   crypto.PublicKey  // key to be certified, nil if key is generated by PKI
+	Attestation *Attestation      // supplied evidence
+}
+
+// Attestor verify evidence, e.g. that quote is signed by known TPM and bound to PublicKey.
+// Returned claims are stored as pair metadata, error reject issuance
+type Attestor func(ctx context.Context, req *AttestationRequest) (map[string]string, error)
+
+// AttestationPolicy configure attestation gated issuance
+type AttestationPolicy struct {
+	Attestors map[string]Attestor // attestors by evidence type
+	Required  bool                // NewCert, SignCSR and other unattested leaf issuance is refused
+}
+
+// WithAttestation enable NewCertWithAttestation and SignCSRWithAttestation
+func WithAttestation(policy *AttestationPolicy) Option {
+	return func(p *PKI) {
+		p.attestation = policy
+	}
+}
+
+// NewCertWithAttestation generate new pair as NewCert after attestation is verified
+func (p *PKI) NewCertWithAttestation(ctx context.Context, cn string, server bool, groups []string, att *Attestation) (*X509Pair, error) {
+	tml, err := p.certTemplate(cn, CertRequest{Server: server, Groups: groups})
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := p.attest(ctx, &AttestationRequest{CN: cn, Template: tml, Attestation: att})
+	if err != nil {
+		return nil, err
+	}
+	return p.issue(CertRequest{CN: cn, Server: server, Groups: groups, Metadata: metadata}, tml, nil)
+}
+
+// SignCSRWithAttestation issue cert for CSR as SignCSR after attestation is verified,
+// attestor should check that evidence is bound to CSR public key for proof of possession
+func (p *PKI) SignCSRWithAttestation(ctx context.Context, csrPem []byte, cn string, server bool, groups []string, att *Attestation) (*X509Pair, error) {
+	csr, err := decodeCSR(csrPem)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkCSR(csr, cn, ""); err != nil {
+		return nil, err
+	}
+	tml, err := p.certTemplate(cn, CertRequest{Server: server, Groups: groups, CSR: csr})
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := p.attest(ctx, &AttestationRequest{CN: cn, Template: tml, PublicKey: csr.PublicKey, Attestation: att})
+	if err != nil {
+		return nil, err
+	}
+	return p.issue(CertRequest{CN: cn, Server: server, Groups: groups, CSR: csr, Metadata: metadata}, tml, csr.PublicKey)
+}
+
+// attest run attestor of evidence type and return metadata for the pair
+func (p *PKI) attest(ctx context.Context, req *AttestationRequest) (map[string]string, error) {
+	if p.attestation == nil {
+		return nil, errors.New("attestation is not configured")
+	}
+	if req.Attestation == nil {
+		return nil, errors.WithStack(NewPolicyViolation("attestation is required"))
+	}
+	attestor, ok := p.attestation.Attestors[req.Attestation.Type]
+	if !ok {
+		return nil, errors.WithStack(NewPolicyViolation(fmt.Sprintf("unknown attestation type %q", req.Attestation.Type)))
+	}
+	claims, err := attestor(ctx, req)
+	if err != nil {
+		return nil, errors.WithStack(NewPolicyViolation(fmt.Sprintf("attestation failed: %s", err)))
+	}
+	metadata := make(map[string]string, len(claims)+1)
+	for key, value := range claims {
+		metadata[key] = value
+	}
+	metadata[MetadataAttestation] = req.Attestation.Type
+	return metadata, nil
+}
+
+// requireAttestation return PolicyViolation for unattested leaf issuance if attestation is required
+func (p *PKI) requireAttestation() error {
+	if p.attestation != nil && p.attestation.Required {
+		return errors.WithStack(NewPolicyViolation("attestation is required"))
+	}
+	return nil
+}
+
+// TokenReviewAttestor verify Kubernetes service account token supplied as evidence with TokenReview API.
+// match check that reviewed user may get cert for cn, cn must be equal to user name if nil.
+// User name is stored as k8s_user metadata
+func (k *KubernetesClient) TokenReviewAttestor(audiences []string, match func(cn, username string) bool) Attestor {
+	return func(ctx context.Context, req *AttestationRequest) (map[string]string, error) {
+		body, err := json.Marshal(map[string]interface{}{
+			"apiVersion": "authentication.k8s.io/v1",
+			"kind":       "TokenReview",
+			"spec":       map[string]interface{}{"token": string(req.Attestation.Evidence), "audiences": audiences},
+		})
+		if err != nil {
+			return nil, err
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			strings.TrimSuffix(k.APIServer, "/")+"/apis/authentication.k8s.io/v1/tokenreviews", bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t create request")
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		if k.Token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+k.Token)
+		}
+		client := k.Client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		resp, err := client.Do(httpReq)
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t review token")
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return nil, errors.Errorf("token review respond with %s", resp.Status)
+		}
+		var review struct {
+			Status struct {
+				Authenticated bool   `json:"authenticated"`
+				Error         string `json:"error"`
+				User          struct {
+					Username string `json:"username"`
+				} `json:"user"`
+			} `json:"status"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&review); err != nil {
+			return nil, errors.Wrap(err, "can`t parse token review")
+		}
+		if !review.Status.Authenticated {
+			return nil, errors.Errorf("token is not authenticated: %s", review.Status.Error)
+		}
+		username := review.Status.User.Username
+		if (match == nil && username != req.CN) || (match != nil && !match(req.CN, username)) {
+			return nil, errors.Errorf("%s can`t get cert for %s", username, req.CN)
+		}
+		return map[string]string{"k8s_user": username}, nil
+	}
+}
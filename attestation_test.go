@@ -0,0 +1,100 @@
+package easyrsa
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_IssueWithAttestation(t *testing.T) {
+	var checked *AttestationRequest
+	policy := &AttestationPolicy{
+		Attestors: map[string]Attestor{
+			"test": func(ctx context.Context, req *AttestationRequest) (map[string]string, error) {
+				checked = req
+				if !bytes.Equal(req.Attestation.Evidence, []byte("quote")) {
+					return nil, errors.New("bad quote")
+				}
+				return map[string]string{"device": "d1"}, nil
+			},
+		},
+		Required: true,
+	}
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithAttestation(policy))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	_, err = pki.NewCert("dev", false, nil)
+	_, ok := errors.Cause(err).(*PolicyViolation)
+	assert.True(t, ok)
+	_, err = pki.NewCertWithMetadata("dev", false, nil, map[string]string{MetadataAttestation: "test"})
+	assert.Error(t, err)
+
+	ctx := context.Background()
+	pair, err := pki.NewCertWithAttestation(ctx, "dev", false, nil, &Attestation{Type: "test", Evidence: []byte("quote")})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"device": "d1", MetadataAttestation: "test"}, pair.Metadata)
+	assert.Nil(t, checked.PublicKey)
+
+	_, err = pki.NewCertWithAttestation(ctx, "dev", false, nil, &Attestation{Type: "test", Evidence: []byte("forged")})
+	_, ok = errors.Cause(err).(*PolicyViolation)
+	assert.True(t, ok)
+	_, err = pki.NewCertWithAttestation(ctx, "dev", false, nil, &Attestation{Type: "unknown"})
+	assert.Error(t, err)
+	_, err = pki.NewCertWithAttestation(ctx, "dev", false, nil, nil)
+	assert.Error(t, err)
+
+	csrPem := newTestCSR(t, "dev")
+	signed, err := pki.SignCSRWithAttestation(ctx, csrPem, "dev", false, nil, &Attestation{Type: "test", Evidence: []byte("quote")})
+	assert.NoError(t, err)
+	assert.False(t, signed.HasKey())
+	csr, err := decodeCSR(csrPem)
+	assert.NoError(t, err)
+	assert.True(t, publicKeyEqual(csr.PublicKey, checked.PublicKey))
+}
+
+func TestKubernetesClient_TokenReviewAttestor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/apis/authentication.k8s.io/v1/tokenreviews", r.URL.Path)
+		var review struct {
+			Spec struct {
+				Token     string   `json:"token"`
+				Audiences []string `json:"audiences"`
+			} `json:"spec"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&review))
+		assert.Equal(t, []string{"pki"}, review.Spec.Audiences)
+		status := map[string]interface{}{"authenticated": false, "error": "invalid token"}
+		if review.Spec.Token == "good" {
+			status = map[string]interface{}{"authenticated": true, "user": map[string]string{"username": "system:serviceaccount:prod:web"}}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": status})
+	}))
+	defer server.Close()
+	k := &KubernetesClient{APIServer: server.URL}
+	attestor := k.TokenReviewAttestor([]string{"pki"}, func(cn, username string) bool {
+		return username == "system:serviceaccount:prod:"+cn
+	})
+	ctx := context.Background()
+	request := func(cn, token string) *AttestationRequest {
+		return &AttestationRequest{CN: cn, Template: &x509.Certificate{}, Attestation: &Attestation{Type: "k8s", Evidence: []byte(token)}}
+	}
+
+	claims, err := attestor(ctx, request("web", "good"))
+	assert.NoError(t, err)
+	assert.Equal(t, "system:serviceaccount:prod:web", claims["k8s_user"])
+	_, err = attestor(ctx, request("db", "good"))
+	assert.Error(t, err)
+	_, err = attestor(ctx, request("web", "bad"))
+	assert.Error(t, err)
+	_, err = k.TokenReviewAttestor([]string{"pki"}, nil)(ctx, request("web", "good"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/x509"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AuditIssueKind describe type of problem found by Audit
+type AuditIssueKind string
+
+const (
+	AuditUndecodable     AuditIssueKind = "undecodable"      // pair can`t be decoded
+	AuditSerialMismatch  AuditIssueKind = "serial_mismatch"  // stored serial differs from certificate serial
+	AuditExpired         AuditIssueKind = "expired"          // certificate is expired
+	AuditOrphaned        AuditIssueKind = "orphaned"         // no stored CA signed the certificate
+	AuditDuplicateSerial AuditIssueKind = "duplicate_serial" // serial is used by more than one stored pair
+	AuditBadCRL          AuditIssueKind = "bad_crl"          // CRL can`t be loaded or verified
+)
+
+// AuditIssue is a single problem found by Audit
+type AuditIssue struct {
+	Kind    AuditIssueKind
+	CN      string   // common name of the pair, empty for CRL issues
+	Serial  *big.Int // serial of the pair, nil for CRL issues
+	Message string
+}
+
+// AuditReport is a result of Audit
+type AuditReport struct {
+	Checked int // number of checked pairs
+	Issues  []AuditIssue
+}
+
+// OK return true if report has no issues
+func (r *AuditReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *AuditReport) add(kind AuditIssueKind, pair *X509Pair, msg string) {
+	issue := AuditIssue{Kind: kind, Message: msg}
+	if pair != nil {
+		issue.CN = pair.CN
+		issue.Serial = pair.Serial
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// Audit re-validate every stored pair against it`s issuer and verify CRL signature
+func (p *PKI) Audit() (*AuditReport, error) {
+	pairs, err := p.Storage.GetAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get pairs for audit")
+	}
+	report := &AuditReport{Checked: len(pairs)}
+	now := p.now()
+
+	cas := make([]*x509.Certificate, 0)
+	certs := make(map[*X509Pair]*x509.Certificate, len(pairs))
+	serials := make(map[string][]*X509Pair)
+	for _, pair := range pairs {
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil {
+			report.add(AuditUndecodable, pair, err.Error())
+			continue
+		}
+		certs[pair] = cert
+		if cert.IsCA {
+			cas = append(cas, cert)
+		}
+		if pair.Serial != nil {
+			serials[pair.Serial.Text(16)] = append(serials[pair.Serial.Text(16)], pair)
+			if pair.Serial.Cmp(cert.SerialNumber) != 0 {
+				report.add(AuditSerialMismatch, pair,
+					"certificate serial is "+cert.SerialNumber.Text(16))
+			}
+		}
+	}
+
+	for _, pair := range pairs {
+		cert, ok := certs[pair]
+		if !ok {
+			continue
+		}
+		if now.After(cert.NotAfter) {
+			report.add(AuditExpired, pair, "expired at "+cert.NotAfter.Format(time.RFC3339))
+		}
+		if findIssuer(cert, cas) == nil {
+			report.add(AuditOrphaned, pair, "no stored ca signed this certificate")
+		}
+	}
+
+	for serial, dups := range serials {
+		if len(dups) > 1 {
+			for _, pair := range dups {
+				report.add(AuditDuplicateSerial, pair, "serial "+serial+" is used more than once")
+			}
+		}
+	}
+
+	if _, err := p.GetCRL(); err != nil {
+		report.add(AuditBadCRL, nil, err.Error())
+	}
+	return report, nil
+}
+
+// findIssuer return CA which signed cert, CAs with subject key id equal to cert authority key id are tried first
+func findIssuer(cert *x509.Certificate, cas []*x509.Certificate) *x509.Certificate {
+	return resolveIssuer(cert.AuthorityKeyId, cas, func(ca *x509.Certificate) bool {
+		return cert.CheckSignatureFrom(ca) == nil
+	})
+}
+
+// resolveIssuer return first CA passing signed check, CAs with subject key id equal to aki go first
+// so the right one is found among several generations sharing the subject
+func resolveIssuer(aki []byte, cas []*x509.Certificate, signed func(ca *x509.Certificate) bool) *x509.Certificate {
+	if len(aki) > 0 {
+		for _, ca := range cas {
+			if bytes.Equal(ca.SubjectKeyId, aki) && signed(ca) {
+				return ca
+			}
+		}
+	}
+	for _, ca := range cas {
+		if (len(aki) == 0 || !bytes.Equal(ca.SubjectKeyId, aki)) && signed(ca) {
+			return ca
+		}
+	}
+	return nil
+}
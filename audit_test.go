@@ -0,0 +1,39 @@
+package easyrsa
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_Audit(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	_, _ = pki.NewCa()
+	server, _ := pki.NewCert("server", true, []string{""})
+	_, _ = pki.NewCert("client", false, []string{""})
+	_ = pki.RevokeOne(big.NewInt(3))
+	t.Run("clean", func(t *testing.T) {
+		report, err := pki.Audit()
+		assert.NoError(t, err)
+		assert.Equal(t, 3, report.Checked)
+		assert.True(t, report.OK())
+	})
+	t.Run("broken", func(t *testing.T) {
+		putRawPair(testData, NewX509Pair([]byte("keybytes"), []byte("certbytes"), "broken", big.NewInt(42)))
+		putRawPair(testData, NewX509Pair(server.KeyPemBytes, server.CertPemBytes, "copy", big.NewInt(2)))
+		putRawPair(testData, NewX509Pair(server.KeyPemBytes, server.CertPemBytes, "wrong", big.NewInt(43)))
+		report, err := pki.Audit()
+		assert.NoError(t, err)
+		assert.False(t, report.OK())
+		kinds := map[AuditIssueKind]int{}
+		for _, issue := range report.Issues {
+			kinds[issue.Kind]++
+		}
+		assert.Equal(t, 1, kinds[AuditUndecodable])
+		assert.Equal(t, 2, kinds[AuditDuplicateSerial])
+		assert.Equal(t, 1, kinds[AuditSerialMismatch])
+		assert.Equal(t, 0, kinds[AuditOrphaned])
+	})
+}
@@ -0,0 +1,269 @@
+package easyrsa
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Authentication methods of Identity
+const (
+	AuthMethodClientCert = "mtls"   // TLS client cert issued by the PKI
+	AuthMethodBearer     = "bearer" // bearer token
+	AuthMethodAPIKey     = "apikey" // static api key
+)
+
+// Operations checked by AuthorizationRules
+const (
+	AuthOpIssue  = "issue"  // issue cert with key generated by PKI
+	AuthOpSign   = "sign"   // sign CSR
+	AuthOpRevoke = "revoke" // revoke cert
+)
+
+// Credentials are caller credentials of API request
+type Credentials struct {
+	PeerCertificates []*x509.Certificate // TLS client chain, leaf first
+	BearerToken      string              // Authorization: Bearer token, or X-Vault-Token
+	APIKey           string              // X-API-Key header
+}
+
+// Identity is an authenticated API caller
+type Identity struct {
+	Name   string   // client cert cn, token subject or api key owner
+	Method string   // one of AuthMethod values
+	Groups []string // groups of identity, matched by "group:<name>" rules
+}
+
+// Authenticator map credentials to identity. nil identity and nil error mean that credentials of
+// this authenticator are absent and next one should be tried, error reject the request
+type Authenticator interface {
+	Authenticate(ctx context.Context, creds *Credentials) (*Identity, error)
+}
+
+// AuthenticatorFunc is a function implementing Authenticator
+type AuthenticatorFunc func(ctx context.Context, creds *Credentials) (*Identity, error)
+
+// Authenticate call f
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, creds *Credentials) (*Identity, error) {
+	return f(ctx, creds)
+}
+
+// Authenticators try authenticators in order, identity of the first one with credentials is returned
+type Authenticators []Authenticator
+
+// Authenticate return first found identity
+func (a Authenticators) Authenticate(ctx context.Context, creds *Credentials) (*Identity, error) {
+	for _, authenticator := range a {
+		id, err := authenticator.Authenticate(ctx, creds)
+		if err != nil || id != nil {
+			return id, err
+		}
+	}
+	return nil, nil
+}
+
+// NewClientCertAuthenticator authenticate TLS client certs issued by valid CA of pki for client auth
+// and not revoked. Identity name is cert cn and groups are groups as in NewCert
+func NewClientCertAuthenticator(pki *PKI) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, creds *Credentials) (*Identity, error) {
+		if len(creds.PeerCertificates) == 0 {
+			return nil, nil
+		}
+		roots, err := pki.CACertPool()
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t get ca pool")
+		}
+		leaf := creds.PeerCertificates[0]
+		intermediates := x509.NewCertPool()
+		for _, cert := range creds.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err = leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   pki.now(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			return nil, errors.WithStack(NewUnauthenticated(fmt.Sprintf("invalid client cert: %s", err)))
+		}
+		if pki.IsRevoked(leaf.SerialNumber) {
+			return nil, errors.WithStack(NewUnauthenticated("client cert is revoked"))
+		}
+		id := &Identity{Name: leaf.Subject.CommonName, Method: AuthMethodClientCert}
+		if groups, err := pki.ExtractGroups(leaf); err == nil {
+			id.Groups = append(id.Groups, *groups...)
+		}
+		return id, nil
+	})
+}
+
+// NewBearerAuthenticator authenticate bearer tokens with verify, e.g. JWT validation or TokenReview.
+// verify return identity name and groups
+func NewBearerAuthenticator(verify func(ctx context.Context, token string) (string, []string, error)) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, creds *Credentials) (*Identity, error) {
+		if creds.BearerToken == "" {
+			return nil, nil
+		}
+		name, groups, err := verify(ctx, creds.BearerToken)
+		if err != nil {
+			return nil, errors.WithStack(NewUnauthenticated(fmt.Sprintf("invalid token: %s", err)))
+		}
+		return &Identity{Name: name, Method: AuthMethodBearer, Groups: groups}, nil
+	})
+}
+
+// NewAPIKeyAuthenticator authenticate static api keys, keys map api key to identity name.
+// Only key hashes are kept
+func NewAPIKeyAuthenticator(keys map[string]string) Authenticator {
+	hashes := make(map[[sha256.Size]byte]string, len(keys))
+	for key, name := range keys {
+		hashes[sha256.Sum256([]byte(key))] = name
+	}
+	return AuthenticatorFunc(func(ctx context.Context, creds *Credentials) (*Identity, error) {
+		if creds.APIKey == "" {
+			return nil, nil
+		}
+		sum := sha256.Sum256([]byte(creds.APIKey))
+		for hash, name := range hashes {
+			if subtle.ConstantTimeCompare(hash[:], sum[:]) == 1 {
+				return &Identity{Name: name, Method: AuthMethodAPIKey}, nil
+			}
+		}
+		return nil, errors.WithStack(NewUnauthenticated("invalid api key"))
+	})
+}
+
+// HTTPCredentials return credentials of http request
+func HTTPCredentials(req *http.Request) *Credentials {
+	creds := &Credentials{APIKey: req.Header.Get("X-API-Key")}
+	if req.TLS != nil {
+		creds.PeerCertificates = req.TLS.PeerCertificates
+	}
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		creds.BearerToken = strings.TrimPrefix(auth, "Bearer ")
+	} else {
+		creds.BearerToken = req.Header.Get("X-Vault-Token")
+	}
+	return creds
+}
+
+// AuthorizationRequest is an operation checked by AuthorizationRules
+type AuthorizationRequest struct {
+	Operation string   // one of AuthOp values
+	CN        string   // requested cn
+	SANs      []string // requested dns names, ips, emails and uris
+	Profile   string   // requested profile or role, empty for built-in templates
+}
+
+// AuthorizationRule permit identities to request names and profiles. Patterns are path.Match patterns,
+// {identity} in CN and SAN patterns is replaced with identity name, e.g. "{identity}.svc.example.com".
+// Empty Operations, SANs and Profiles permit any, empty CNs permit only cn equal to identity name
+type AuthorizationRule struct {
+	Identities []string // identity name patterns or "group:<name>"
+	Operations []string // permitted operations
+	CNs        []string // permitted cn patterns
+	SANs       []string // permitted san patterns
+	Profiles   []string // permitted profile patterns, "" permit built-in templates
+}
+
+// AuthorizationRules allow request if any rule permit it, everything is denied with no rules
+type AuthorizationRules []*AuthorizationRule
+
+// Authorize return PolicyViolation if id is not permitted to perform req
+func (r AuthorizationRules) Authorize(id *Identity, req *AuthorizationRequest) error {
+	for _, rule := range r {
+		if rule.permit(id, req) {
+			return nil
+		}
+	}
+	return errors.WithStack(NewPolicyViolation(fmt.Sprintf("%s is not permitted to %s %s", id.Name, req.Operation, req.CN)))
+}
+
+func (rule *AuthorizationRule) permit(id *Identity, req *AuthorizationRequest) bool {
+	matchIdentity := false
+	for _, pattern := range rule.Identities {
+		if group := strings.TrimPrefix(pattern, "group:"); group != pattern {
+			for _, g := range id.Groups {
+				matchIdentity = matchIdentity || g == group
+			}
+		} else {
+			matchIdentity = matchIdentity || matchAuthPattern(pattern, id.Name, id)
+		}
+	}
+	if !matchIdentity {
+		return false
+	}
+	if len(rule.Operations) > 0 && !matchAuthPatterns(rule.Operations, req.Operation, id) {
+		return false
+	}
+	if len(rule.Profiles) > 0 && !matchAuthPatterns(rule.Profiles, req.Profile, id) {
+		return false
+	}
+	cns := rule.CNs
+	if len(cns) == 0 {
+		cns = []string{"{identity}"}
+	}
+	if !matchAuthPatterns(cns, req.CN, id) {
+		return false
+	}
+	if len(rule.SANs) > 0 {
+		for _, san := range req.SANs {
+			if !matchAuthPatterns(rule.SANs, san, id) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchAuthPatterns(patterns []string, name string, id *Identity) bool {
+	for _, pattern := range patterns {
+		if matchAuthPattern(pattern, name, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// identityEscaper escape identity name, so it`s matched literally
+var identityEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+
+func matchAuthPattern(pattern, name string, id *Identity) bool {
+	pattern = strings.ReplaceAll(pattern, "{identity}", identityEscaper.Replace(id.Name))
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+// APIAuth authenticate and authorize issuance API requests
+type APIAuth struct {
+	Authenticator Authenticator      // Authenticators to accept several credential kinds
+	Rules         AuthorizationRules // permitted operations of identities
+}
+
+// Authenticate return identity of creds, Unauthenticated if there is none
+func (a *APIAuth) Authenticate(ctx context.Context, creds *Credentials) (*Identity, error) {
+	if a.Authenticator == nil {
+		return nil, errors.WithStack(NewUnauthenticated("no authenticator is configured"))
+	}
+	id, err := a.Authenticator.Authenticate(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+	if id == nil {
+		return nil, errors.WithStack(NewUnauthenticated("credentials are required"))
+	}
+	return id, nil
+}
+
+// Authorize check req against Rules
+func (a *APIAuth) Authorize(id *Identity, req *AuthorizationRequest) error {
+	return a.Rules.Authorize(id, req)
+}
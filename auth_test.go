@@ -0,0 +1,143 @@
+package easyrsa
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func isUnauthenticated(err error) bool {
+	_, ok := errors.Cause(err).(*Unauthenticated)
+	return ok
+}
+
+func TestAuthenticators(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("client cert", func(t *testing.T) {
+		auth := NewClientCertAuthenticator(pki)
+		id, err := auth.Authenticate(ctx, &Credentials{})
+		assert.NoError(t, err)
+		assert.Nil(t, id)
+
+		client, err := pki.NewCert("deployer", false, []string{"ops"})
+		assert.NoError(t, err)
+		cert, err := decodeCert(client.CertPemBytes)
+		assert.NoError(t, err)
+		id, err = auth.Authenticate(ctx, &Credentials{PeerCertificates: []*x509.Certificate{cert}})
+		assert.NoError(t, err)
+		assert.Equal(t, &Identity{Name: "deployer", Method: AuthMethodClientCert, Groups: []string{"ops"}}, id)
+
+		assert.NoError(t, pki.Revoke(cert.SerialNumber, "test", ""))
+		_, err = auth.Authenticate(ctx, &Credentials{PeerCertificates: []*x509.Certificate{cert}})
+		assert.True(t, isUnauthenticated(err))
+	})
+
+	t.Run("chain", func(t *testing.T) {
+		auth := Authenticators{
+			NewAPIKeyAuthenticator(map[string]string{"k-1": "ci"}),
+			NewBearerAuthenticator(func(ctx context.Context, token string) (string, []string, error) {
+				if token != "t-1" {
+					return "", nil, errors.New("unknown token")
+				}
+				return "robot", []string{"bots"}, nil
+			}),
+		}
+		id, err := auth.Authenticate(ctx, &Credentials{APIKey: "k-1"})
+		assert.NoError(t, err)
+		assert.Equal(t, &Identity{Name: "ci", Method: AuthMethodAPIKey}, id)
+		_, err = auth.Authenticate(ctx, &Credentials{APIKey: "k-2", BearerToken: "t-1"})
+		assert.True(t, isUnauthenticated(err))
+		id, err = auth.Authenticate(ctx, &Credentials{BearerToken: "t-1"})
+		assert.NoError(t, err)
+		assert.Equal(t, "robot", id.Name)
+		_, err = auth.Authenticate(ctx, &Credentials{BearerToken: "t-2"})
+		assert.True(t, isUnauthenticated(err))
+
+		api := &APIAuth{Authenticator: auth}
+		_, err = api.Authenticate(ctx, &Credentials{})
+		assert.True(t, isUnauthenticated(err))
+	})
+
+	t.Run("http credentials", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("X-Vault-Token", "s.token")
+		req.Header.Set("X-API-Key", "k-1")
+		req.TLS = &tls.ConnectionState{}
+		assert.Equal(t, &Credentials{BearerToken: "s.token", APIKey: "k-1"}, HTTPCredentials(req))
+		req.Header.Set("Authorization", "Bearer t-1")
+		assert.Equal(t, "t-1", HTTPCredentials(req).BearerToken)
+	})
+}
+
+func TestAuthorizationRules(t *testing.T) {
+	rules := AuthorizationRules{
+		{Identities: []string{"web-*"}, Operations: []string{AuthOpIssue}, CNs: []string{"{identity}.svc"}, SANs: []string{"*.example.com"}},
+		{Identities: []string{"group:ops"}, CNs: []string{"*"}, Profiles: []string{"", "server"}},
+		{Identities: []string{"self"}},
+	}
+	tests := []struct {
+		name string
+		id   *Identity
+		req  *AuthorizationRequest
+		ok   bool
+	}{
+		{"own svc cn", &Identity{Name: "web-1"}, &AuthorizationRequest{Operation: AuthOpIssue, CN: "web-1.svc", SANs: []string{"a.example.com"}}, true},
+		{"other svc cn", &Identity{Name: "web-1"}, &AuthorizationRequest{Operation: AuthOpIssue, CN: "web-2.svc"}, false},
+		{"operation", &Identity{Name: "web-1"}, &AuthorizationRequest{Operation: AuthOpSign, CN: "web-1.svc"}, false},
+		{"san", &Identity{Name: "web-1"}, &AuthorizationRequest{Operation: AuthOpIssue, CN: "web-1.svc", SANs: []string{"evil.com"}}, false},
+		{"wildcard identity is literal", &Identity{Name: "web-*"}, &AuthorizationRequest{Operation: AuthOpIssue, CN: "web-1.svc"}, false},
+		{"group", &Identity{Name: "alice", Groups: []string{"ops"}}, &AuthorizationRequest{Operation: AuthOpRevoke, CN: "db"}, true},
+		{"group profile", &Identity{Name: "alice", Groups: []string{"ops"}}, &AuthorizationRequest{Operation: AuthOpIssue, CN: "db", Profile: "client"}, false},
+		{"default cn", &Identity{Name: "self"}, &AuthorizationRequest{Operation: AuthOpSign, CN: "self"}, true},
+		{"default cn other", &Identity{Name: "self"}, &AuthorizationRequest{Operation: AuthOpSign, CN: "other"}, false},
+		{"no rule", &Identity{Name: "bob"}, &AuthorizationRequest{Operation: AuthOpIssue, CN: "bob"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rules.Authorize(tt.id, tt.req)
+			if tt.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, isPolicyViolation(err), err)
+			}
+		})
+	}
+}
+
+func TestAPIAuth_Enforced(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	auth := &APIAuth{
+		Authenticator: NewAPIKeyAuthenticator(map[string]string{"k-web": "web"}),
+		Rules:         AuthorizationRules{{Identities: []string{"web"}, CNs: []string{"{identity}.pki.local"}}},
+	}
+
+	t.Run("vault", func(t *testing.T) {
+		facade := NewVaultFacade(pki, &VaultRole{Name: "web", Server: true})
+		facade.Auth = auth
+		call := func(key, cn string) int {
+			req := httptest.NewRequest(http.MethodPost, "/issue/web", bytes.NewReader([]byte(`{"common_name":"`+cn+`"}`)))
+			req.Header.Set("X-API-Key", key)
+			rec := httptest.NewRecorder()
+			facade.ServeHTTP(rec, req)
+			return rec.Code
+		}
+		assert.Equal(t, http.StatusOK, call("k-web", "web.pki.local"))
+		assert.Equal(t, http.StatusForbidden, call("k-web", "db.pki.local"))
+		assert.Equal(t, http.StatusForbidden, call("", "web.pki.local"))
+	})
+}
@@ -0,0 +1,138 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+)
+
+// BatchError collect errors of failed batch items by item index
+type BatchError struct {
+	Errors map[int]error
+}
+
+func (e *BatchError) Error() string {
+	idx := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	msgs := make([]string, 0, len(idx))
+	for _, i := range idx {
+		msgs = append(msgs, fmt.Sprintf("item %d: %v", i, e.Errors[i]))
+	}
+	return fmt.Sprintf("%d of batch items failed: %s", len(idx), strings.Join(msgs, "; "))
+}
+
+// batch call fn for every item index with at most parallelism concurrent calls, runtime.NumCPU if parallelism <= 0.
+// All items are processed, failed ones are collected into BatchError
+func batch(items, parallelism int, fn func(i int) error) error {
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+	errs := make([]error, items)
+	var g errgroup.Group
+	g.SetLimit(parallelism)
+	for i := 0; i < items; i++ {
+		i := i
+		g.Go(func() error {
+			errs[i] = fn(i)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	failed := &BatchError{Errors: make(map[int]error)}
+	for i, err := range errs {
+		if err != nil {
+			failed.Errors[i] = err
+		}
+	}
+	if len(failed.Errors) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// NewCertBatch issue cert for every request concurrently, requests with CSR are signed as SignCSR do, others as NewCert.
+// Returned pairs are in order of requests, failed items are nil and reported in *BatchError
+func (p *PKI) NewCertBatch(reqs []SigningRequest, parallelism int) ([]*X509Pair, error) {
+	certReqs := make([]CertRequest, len(reqs))
+	for i, req := range reqs {
+		certReqs[i] = req.CertRequest()
+	}
+	return p.IssueBatch(certReqs, parallelism)
+}
+
+// RenewBatch reissue pairs with serials concurrently for the same CN, server flag and groups.
+// Pairs with key get new key, cert only pairs keep their public key. Old pairs are not revoked
+func (p *PKI) RenewBatch(serials []*big.Int, parallelism int) ([]*X509Pair, error) {
+	if err := p.requireLeader(); err != nil {
+		return nil, err
+	}
+	res := make([]*X509Pair, len(serials))
+	err := batch(len(serials), parallelism, func(i int) error {
+		var err error
+		res[i], err = p.renew(serials[i])
+		return err
+	})
+	return res, err
+}
+
+func (p *PKI) renew(serial *big.Int) (*X509Pair, error) {
+	pair, err := p.Storage.GetBySerial(serial)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can`t get pair %s", serial.Text(16))
+	}
+	cert, err := decodeCert(pair.CertPemBytes)
+	if err != nil {
+		return nil, err
+	}
+	if cert.IsCA {
+		return nil, errors.New("ca pair can`t be renewed in batch")
+	}
+	req := CertRequest{
+		CN:       pair.CN,
+		Server:   hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth),
+		Groups:   cert.ExcludedDNSDomains,
+		Metadata: pair.Metadata,
+	}
+	tml, err := p.certTemplate(pair.CN, req)
+	if err != nil {
+		return nil, err
+	}
+	if pair.HasKey() {
+		return p.issue(req, tml, nil)
+	}
+	return p.issue(req, tml, cert.PublicKey)
+}
+
+// RevokeBatch revoke all serials with single CRL signature, actor and reason are recorded to revocation log
+func (p *PKI) RevokeBatch(serials []*big.Int, actor, reason string) (err error) {
+	span := p.startSpan(AuthOpRevoke, attribute.Int("easyrsa.serials", len(serials)))
+	defer func() {
+		endSpan(span, err)
+	}()
+	p.crlMu.Lock()
+	defer p.crlMu.Unlock()
+	oldList, err := p.GetCRL()
+	if err != nil {
+		return errors.Wrap(err, "can`t get current crl")
+	}
+	now := p.now()
+	list := oldList.TBSCertList.RevokedCertificates
+	for _, serial := range serials {
+		list = append(list, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: now})
+	}
+	if _, err := p.signCRL(list); err != nil {
+		return err
+	}
+	return p.logRevocations(serials, now, actor, reason)
+}
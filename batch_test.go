@@ -0,0 +1,58 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"math/big"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_NewCertBatch(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	_, _ = pki.NewCa()
+
+	reqs := []SigningRequest{
+		{CN: "dev1"}, {CN: "dev2", Server: true}, {CN: "dev3", CSR: newTestCSR(t, "dev3")},
+		{CN: "dev4", CSR: []byte("broken")}, {CN: "dev5"},
+	}
+	pairs, err := pki.NewCertBatch(reqs, 3)
+	assert.Error(t, err)
+	batchErr, ok := errors.Cause(err).(*BatchError)
+	assert.True(t, ok)
+	assert.Len(t, batchErr.Errors, 1)
+	assert.Error(t, batchErr.Errors[3])
+	assert.Nil(t, pairs[3])
+
+	serials := make(map[string]bool)
+	var issued []*big.Int
+	for i, pair := range pairs {
+		if i == 3 {
+			continue
+		}
+		assert.Equal(t, reqs[i].CN, pair.CN)
+		serials[pair.Serial.Text(16)] = true
+		issued = append(issued, pair.Serial)
+	}
+	assert.Len(t, serials, 4)
+	assert.False(t, pairs[2].HasKey())
+
+	renewed, err := pki.RenewBatch(issued, 0)
+	assert.NoError(t, err)
+	for i, pair := range renewed {
+		assert.NotEqual(t, issued[i], pair.Serial)
+	}
+	_, cert, _ := renewed[1].Decode()
+	assert.True(t, hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth))
+	assert.False(t, renewed[2].HasKey())
+
+	_, err = pki.RenewBatch([]*big.Int{big.NewInt(1)}, 1)
+	assert.Error(t, err)
+
+	assert.NoError(t, pki.RevokeBatch(issued, "admin", "offboarding"))
+	list, err := pki.GetCRL()
+	assert.NoError(t, err)
+	assert.Len(t, list.TBSCertList.RevokedCertificates, len(issued))
+}
@@ -0,0 +1,397 @@
+package easyrsa
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PairCodec encode pair to single blob and decode it back, metadata included
+type PairCodec interface {
+	Encode(pair *X509Pair) ([]byte, error) // Encode pair to blob.
+	Decode(data []byte) (*X509Pair, error) // Decode blob made by Encode.
+}
+
+// Compressor compress blobs of CompressedPairCodec, it must be recognisable by Magic prefix of compressed data
+type Compressor interface {
+	Magic() []byte                          // Magic return prefix of every compressed blob, e.g. 28 b5 2f fd for zstd.
+	Compress(data []byte) ([]byte, error)   // Compress data.
+	Decompress(data []byte) ([]byte, error) // Decompress data made by Compress.
+}
+
+// pairEnvelope is a json form of pair encoded by EnvelopePairCodec
+type pairEnvelope struct {
+	Version  int               `json:"v"`                  // envelope version
+	CN       string            `json:"cn"`                 // cn of the pair
+	Serial   string            `json:"serial"`             // hex serial
+	Metadata map[string]string `json:"metadata,omitempty"` // pair metadata tags
+	Cert     string            `json:"cert"`               // pem cert
+	Chain    string            `json:"chain,omitempty"`    // pem issuing chain
+	Key      string            `json:"key,omitempty"`      // pem key, empty for cert only pair
+}
+
+const pairEnvelopeVersion = 1
+
+// EnvelopePairCodec encode pair as json envelope with cn, serial, metadata and pem blocks
+type EnvelopePairCodec struct{}
+
+func (EnvelopePairCodec) Encode(pair *X509Pair) ([]byte, error) {
+	if err := pair.Validate(); err != nil {
+		return nil, errors.Wrap(err, "can`t encode invalid pair")
+	}
+	data, err := json.Marshal(&pairEnvelope{
+		Version:  pairEnvelopeVersion,
+		CN:       pair.CN,
+		Serial:   pair.Serial.Text(16),
+		Metadata: pair.Metadata,
+		Cert:     string(pair.CertPemBytes),
+		Chain:    string(pair.ChainPemBytes),
+		Key:      string(pair.KeyPemBytes),
+	})
+	return data, errors.Wrap(err, "can`t encode pair envelope")
+}
+
+func (EnvelopePairCodec) Decode(data []byte) (*X509Pair, error) {
+	envelope := &pairEnvelope{}
+	if err := json.Unmarshal(data, envelope); err != nil {
+		return nil, errors.Wrap(err, "can`t parse pair envelope")
+	}
+	if envelope.Version != pairEnvelopeVersion {
+		return nil, errors.Errorf("unsupported pair envelope version %d", envelope.Version)
+	}
+	serial, ok := new(big.Int).SetString(envelope.Serial, 16)
+	if !ok {
+		return nil, errors.Errorf("wrong serial %q in pair envelope", envelope.Serial)
+	}
+	pair := NewX509Pair([]byte(envelope.Key), []byte(envelope.Cert), envelope.CN, serial)
+	if envelope.Key == "" {
+		pair.KeyPemBytes = nil
+	}
+	if envelope.Chain != "" {
+		pair.ChainPemBytes = []byte(envelope.Chain)
+	}
+	pair.Metadata = envelope.Metadata
+	return pair, nil
+}
+
+// CompressedPairCodec compress blobs of Codec with Compressor. Decode is transparent: blobs are decompressed
+// by Compressor or any of Decompressors with matching magic, others are passed to Codec as is,
+// so compression can be enabled or changed on storage holding old blobs
+type CompressedPairCodec struct {
+	Codec         PairCodec    // codec of pair, EnvelopePairCodec if nil
+	Compressor    Compressor   // compressor of new blobs, blobs are stored uncompressed if nil
+	Decompressors []Compressor // extra compressors of old blobs
+}
+
+func (c *CompressedPairCodec) codec() PairCodec {
+	if c.Codec == nil {
+		return EnvelopePairCodec{}
+	}
+	return c.Codec
+}
+
+func (c *CompressedPairCodec) Encode(pair *X509Pair) ([]byte, error) {
+	data, err := c.codec().Encode(pair)
+	if err != nil || c.Compressor == nil {
+		return data, err
+	}
+	data, err = c.Compressor.Compress(data)
+	return data, errors.Wrap(err, "can`t compress pair")
+}
+
+func (c *CompressedPairCodec) Decode(data []byte) (*X509Pair, error) {
+	for _, compressor := range append([]Compressor{c.Compressor}, c.Decompressors...) {
+		if compressor == nil || len(compressor.Magic()) == 0 || !bytes.HasPrefix(data, compressor.Magic()) {
+			continue
+		}
+		plain, err := compressor.Decompress(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t decompress pair")
+		}
+		return c.codec().Decode(plain)
+	}
+	return c.codec().Decode(data)
+}
+
+// GzipCompressor implement Compressor with gzip of Level, gzip.DefaultCompression if zero
+type GzipCompressor struct {
+	Level int
+}
+
+func (GzipCompressor) Magic() []byte {
+	return []byte{0x1f, 0x8b}
+}
+
+func (c GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	buf := bytes.NewBuffer(nil)
+	w, err := gzip.NewWriterLevel(buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	return ioutil.ReadAll(r)
+}
+
+// BlobStore is a flat key value store of blobs, e.g. object store bucket
+type BlobStore interface {
+	Put(key string, data []byte) error                   // Put blob, overwrite if already exist.
+	Get(key string) ([]byte, error)                      // Get blob, NotExist if there is no key.
+	Delete(key string) error                             // Delete blob, NotExist if there is no key.
+	List(prefix string, fn func(key string) error) error // List call fn for every key with prefix, StopIteration stop it.
+}
+
+// BlobKeyStorage implement KeyStorage interface keeping every pair as one blob encoded by Codec
+// under key cn/serial, so remote stores need one request per pair
+type BlobKeyStorage struct {
+	store BlobStore
+	codec PairCodec
+}
+
+// NewBlobKeyStorage return storage of pairs in store encoded by codec, EnvelopePairCodec if nil
+func NewBlobKeyStorage(store BlobStore, codec PairCodec) *BlobKeyStorage {
+	if codec == nil {
+		codec = EnvelopePairCodec{}
+	}
+	return &BlobKeyStorage{store: store, codec: codec}
+}
+
+func blobKey(cn string, serial *big.Int) string {
+	return cn + "/" + serial.Text(16)
+}
+
+func (s *BlobKeyStorage) Put(pair *X509Pair) error {
+	if err := CheckCN(pair.CN); err != nil {
+		return err
+	}
+	data, err := s.codec.Encode(pair)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(s.store.Put(blobKey(pair.CN, pair.Serial), data), "can`t put pair")
+}
+
+func (s *BlobKeyStorage) get(key string) (*X509Pair, error) {
+	data, err := s.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := s.codec.Decode(data)
+	return pair, errors.Wrapf(err, "can`t decode pair %s", key)
+}
+
+func (s *BlobKeyStorage) GetByCN(cn string) ([]*X509Pair, error) {
+	res := make([]*X509Pair, 0)
+	err := s.ForEachByCN(cn, func(pair *X509Pair) error {
+		res = append(res, pair)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, errors.WithStack(NewNotExist("not found"))
+	}
+	return res, nil
+}
+
+func (s *BlobKeyStorage) GetLastByCn(cn string) (*X509Pair, error) {
+	pairs, err := s.GetByCN(cn)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get cert")
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Serial.Cmp(pairs[j].Serial) == 1
+	})
+	return pairs[0], nil
+}
+
+func (s *BlobKeyStorage) GetBySerial(serial *big.Int) (*X509Pair, error) {
+	suffix := "/" + serial.Text(16)
+	var res *X509Pair
+	err := s.store.List("", func(key string) error {
+		if !strings.HasSuffix(key, suffix) {
+			return nil
+		}
+		pair, err := s.get(key)
+		if err != nil {
+			return err
+		}
+		res = pair
+		return StopIteration
+	})
+	if err != nil && err != StopIteration {
+		return nil, err
+	}
+	if res == nil {
+		return nil, errors.WithStack(NewNotExist("not found"))
+	}
+	return res, nil
+}
+
+func (s *BlobKeyStorage) DeleteByCn(cn string) error {
+	if err := CheckCN(cn); err != nil {
+		return err
+	}
+	keys := make([]string, 0)
+	err := s.store.List(cn+"/", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "can`t delete by cn")
+	}
+	for _, key := range keys {
+		if err := s.store.Delete(key); err != nil {
+			return errors.Wrap(err, "can`t delete by cn")
+		}
+	}
+	return nil
+}
+
+func (s *BlobKeyStorage) DeleteBySerial(serial *big.Int) error {
+	pair, err := s.GetBySerial(serial)
+	if err != nil {
+		return errors.Wrap(err, "can`t find pair by serial")
+	}
+	return errors.Wrap(s.store.Delete(blobKey(pair.CN, pair.Serial)), "can`t delete pair")
+}
+
+func (s *BlobKeyStorage) GetAll() ([]*X509Pair, error) {
+	res := make([]*X509Pair, 0)
+	err := s.ForEach(func(pair *X509Pair) error {
+		res = append(res, pair)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get all pairs")
+	}
+	return res, nil
+}
+
+// ForEachByCN call fn for every pair with cn, pairs are fetched one by one
+func (s *BlobKeyStorage) ForEachByCN(cn string, fn func(pair *X509Pair) error) error {
+	if err := CheckCN(cn); err != nil {
+		return err
+	}
+	return s.walk(cn+"/", fn)
+}
+
+// ForEach call fn for every pair in store, pairs are fetched one by one
+func (s *BlobKeyStorage) ForEach(fn func(pair *X509Pair) error) error {
+	return s.walk("", fn)
+}
+
+func (s *BlobKeyStorage) walk(prefix string, fn func(pair *X509Pair) error) error {
+	err := s.store.List(prefix, func(key string) error {
+		pair, err := s.get(key)
+		if err != nil {
+			return err
+		}
+		return fn(pair)
+	})
+	if err == StopIteration {
+		return nil
+	}
+	return err
+}
+
+// DirBlobStore implement BlobStore interface with files in dir, key is a relative path
+type DirBlobStore struct {
+	dir string
+}
+
+func NewDirBlobStore(dir string) *DirBlobStore {
+	return &DirBlobStore{dir: dir}
+}
+
+func (s *DirBlobStore) path(key string) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if key == "" || !strings.HasPrefix(path, filepath.Clean(s.dir)+string(filepath.Separator)) {
+		return "", errors.Errorf("wrong blob key %q", key)
+	}
+	return path, nil
+}
+
+func (s *DirBlobStore) Put(key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrap(err, "can`t create blob dir")
+	}
+	return errors.Wrap(writeFileAtomic(path, data, 0600), "can`t write blob")
+}
+
+func (s *DirBlobStore) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errors.WithStack(NewNotExist("blob " + key + " not found"))
+	}
+	return data, errors.Wrap(err, "can`t read blob")
+}
+
+func (s *DirBlobStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return errors.WithStack(NewNotExist("blob " + key + " not found"))
+	}
+	return errors.Wrap(err, "can`t delete blob")
+}
+
+func (s *DirBlobStore) List(prefix string, fn func(key string) error) error {
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return nil
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		return fn(key)
+	})
+	if err == StopIteration {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlobKeyStorage(t *testing.T) {
+	dir := t.TempDir()
+	blobs := NewDirBlobStore(filepath.Join(dir, "blobs"))
+	plain := NewBlobKeyStorage(blobs, nil)
+	storage := NewBlobKeyStorage(blobs, &CompressedPairCodec{Compressor: GzipCompressor{}})
+	pki := NewPKI(storage, NewFileSerialProvider(filepath.Join(dir, "serial")),
+		NewFileCRLHolder(filepath.Join(dir, "crl.pem")), pkix.Name{}, WithKeySize(1024))
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	old, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	// blob written before compression was enabled
+	assert.NoError(t, plain.Put(old))
+	data, err := blobs.Get(blobKey(old.CN, old.Serial))
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte("{")))
+
+	pair, err := pki.NewCertWithMetadata("alice", false, nil, map[string]string{"team": "iot"})
+	assert.NoError(t, err)
+	data, err = blobs.Get(blobKey(pair.CN, pair.Serial))
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, GzipCompressor{}.Magic()))
+	_, err = plain.GetBySerial(pair.Serial)
+	assert.Error(t, err)
+
+	last, err := storage.GetLastByCn("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, last.Serial.Cmp(pair.Serial))
+	assert.Equal(t, pair.KeyPemBytes, last.KeyPemBytes)
+	assert.Equal(t, pair.CertPemBytes, last.CertPemBytes)
+	assert.Equal(t, "iot", last.Metadata["team"])
+	pairs, err := storage.GetByCN("alice")
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 2)
+	got, err := storage.GetBySerial(old.Serial)
+	assert.NoError(t, err)
+	assert.Equal(t, old.CertPemBytes, got.CertPemBytes)
+	all, err := storage.GetAll()
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	assert.NoError(t, storage.DeleteBySerial(old.Serial))
+	_, err = storage.GetBySerial(old.Serial)
+	_, ok := errors.Cause(err).(*NotExist)
+	assert.True(t, ok)
+	assert.NoError(t, storage.DeleteByCn("alice"))
+	_, err = storage.GetLastByCn("alice")
+	assert.Error(t, err)
+	_, err = storage.GetLastByCn("ca")
+	assert.NoError(t, err)
+}
+
+func TestDirBlobStore_WrongKey(t *testing.T) {
+	store := NewDirBlobStore(t.TempDir())
+	assert.Error(t, store.Put("../escape", []byte("x")))
+	assert.Error(t, store.Put("", []byte("x")))
+}
@@ -0,0 +1,215 @@
+package easyrsa
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+)
+
+// BlockedCN is a deny list entry, issuance for CN is rejected while it`s blocked
+type BlockedCN struct {
+	CN     string    `json:"cn"`               // blocked common name
+	Time   time.Time `json:"time"`             // when blocked
+	Actor  string    `json:"actor,omitempty"`  // who blocked
+	Reason string    `json:"reason,omitempty"` // why blocked, e.g. offboarding ticket
+}
+
+// BlockList persist blocked CNs
+type BlockList interface {
+	Block(entry *BlockedCN) error      // Block add or replace entry of entry.CN.
+	Unblock(cn string) error           // Unblock remove entry of cn, NotExist if cn is not blocked.
+	Get(cn string) (*BlockedCN, error) // Get return entry of cn, NotExist if cn is not blocked.
+	List() ([]*BlockedCN, error)       // List return all entries sorted by CN.
+}
+
+// WithBlockList reject issuance for CNs blocked in list
+func WithBlockList(list BlockList) Option {
+	return func(p *PKI) {
+		p.blockList = list
+	}
+}
+
+// BlockCN add cn to block list, so all future issuance for it is rejected with PolicyViolation.
+// Existing not revoked certs of cn are revoked too if revoke, actor and reason are recorded to revocation log.
+// Serials of revoked certs are returned
+func (p *PKI) BlockCN(cn, actor, reason string, revoke bool) ([]*big.Int, error) {
+	if p.blockList == nil {
+		return nil, errors.New("block list is not configured")
+	}
+	if cn == "" || cn == "ca" {
+		return nil, errors.Errorf("cn %q can`t be blocked", cn)
+	}
+	err := p.blockList.Block(&BlockedCN{CN: cn, Time: p.now(), Actor: actor, Reason: reason})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t block cn")
+	}
+	revoked := make([]*big.Int, 0)
+	if !revoke {
+		return revoked, nil
+	}
+	serials := make([]*big.Int, 0)
+	err = ForEachByCN(p.Storage, cn, func(pair *X509Pair) error {
+		serials = append(serials, pair.Serial)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cn is blocked but can`t get pairs for revoke")
+	}
+	for _, serial := range serials {
+		if p.IsRevoked(serial) {
+			continue
+		}
+		if err := p.Revoke(serial, actor, reason); err != nil {
+			return revoked, errors.Wrap(err, "cn is blocked but can`t revoke")
+		}
+		revoked = append(revoked, serial)
+	}
+	return revoked, nil
+}
+
+// UnblockCN remove cn from block list, revoked certs stay revoked
+func (p *PKI) UnblockCN(cn string) error {
+	if p.blockList == nil {
+		return errors.New("block list is not configured")
+	}
+	return p.blockList.Unblock(cn)
+}
+
+// BlockedCNs return all block list entries
+func (p *PKI) BlockedCNs() ([]*BlockedCN, error) {
+	if p.blockList == nil {
+		return nil, errors.New("block list is not configured")
+	}
+	return p.blockList.List()
+}
+
+// checkBlocked return PolicyViolation if cn is blocked
+func (p *PKI) checkBlocked(cn string) error {
+	if p.blockList == nil {
+		return nil
+	}
+	entry, err := p.blockList.Get(cn)
+	if _, ok := errors.Cause(err).(*NotExist); ok {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "can`t check block list")
+	}
+	msg := "cn " + cn + " is blocked"
+	if entry.Reason != "" {
+		msg += ": " + entry.Reason
+	}
+	return errors.WithStack(NewPolicyViolation(msg))
+}
+
+// FileBlockList implement BlockList interface with json file, shared by processes with file lock
+type FileBlockList struct {
+	locker *flock.Flock
+	path   string
+}
+
+func NewFileBlockList(path string) *FileBlockList {
+	return &FileBlockList{locker: flock.New(path + ".lock"), path: path}
+}
+
+func (l *FileBlockList) Block(entry *BlockedCN) error {
+	return l.update(func(entries map[string]*BlockedCN) error {
+		entries[entry.CN] = entry
+		return nil
+	})
+}
+
+func (l *FileBlockList) Unblock(cn string) error {
+	return l.update(func(entries map[string]*BlockedCN) error {
+		if _, ok := entries[cn]; !ok {
+			return errors.WithStack(NewNotExist("cn " + cn + " is not blocked"))
+		}
+		delete(entries, cn)
+		return nil
+	})
+}
+
+func (l *FileBlockList) Get(cn string) (*BlockedCN, error) {
+	entries, err := l.readLocked()
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := entries[cn]
+	if !ok {
+		return nil, errors.WithStack(NewNotExist("cn " + cn + " is not blocked"))
+	}
+	return entry, nil
+}
+
+func (l *FileBlockList) List() ([]*BlockedCN, error) {
+	entries, err := l.readLocked()
+	if err != nil {
+		return nil, err
+	}
+	return sortedBlocked(entries), nil
+}
+
+func (l *FileBlockList) readLocked() (map[string]*BlockedCN, error) {
+	if err := l.locker.RLock(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = l.locker.Unlock()
+	}()
+	return l.read()
+}
+
+func (l *FileBlockList) update(fn func(entries map[string]*BlockedCN) error) error {
+	if err := l.locker.Lock(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = l.locker.Unlock()
+	}()
+	entries, err := l.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(entries); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(sortedBlocked(entries), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "can`t encode block list")
+	}
+	return errors.Wrap(writeFileAtomic(l.path, append(data, '\n'), 0644), "can`t write block list")
+}
+
+func (l *FileBlockList) read() (map[string]*BlockedCN, error) {
+	entries := make(map[string]*BlockedCN)
+	data, err := ioutil.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t read block list")
+	}
+	list := make([]*BlockedCN, 0)
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, errors.Wrap(err, "can`t parse block list")
+	}
+	for _, entry := range list {
+		entries[entry.CN] = entry
+	}
+	return entries, nil
+}
+
+func sortedBlocked(entries map[string]*BlockedCN) []*BlockedCN {
+	res := make([]*BlockedCN, 0, len(entries))
+	for _, entry := range entries {
+		res = append(res, entry)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CN < res[j].CN })
+	return res
+}
@@ -0,0 +1,50 @@
+package easyrsa
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_BlockCN(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithBlockList(NewFileBlockList(path)))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	first, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	second, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pki.RevokeOne(first.Serial))
+	other, err := pki.NewCert("bob", false, nil)
+	assert.NoError(t, err)
+
+	_, err = pki.BlockCN("ca", "admin", "", true)
+	assert.Error(t, err)
+	revoked, err := pki.BlockCN("alice", "admin", "offboarded", true)
+	assert.NoError(t, err)
+	assert.Len(t, revoked, 1)
+	assert.Equal(t, 0, revoked[0].Cmp(second.Serial))
+	assert.True(t, pki.IsRevoked(second.Serial))
+	assert.False(t, pki.IsRevoked(other.Serial))
+
+	_, err = pki.NewCert("alice", false, nil)
+	assert.True(t, isPolicyViolation(err))
+	assert.Contains(t, err.Error(), "offboarded")
+	_, err = pki.SignCSR(newTestCSR(t, "alice"), "alice", false, nil)
+	assert.True(t, isPolicyViolation(err))
+
+	// block list is persisted
+	blocked, err := NewFileBlockList(path).List()
+	assert.NoError(t, err)
+	assert.Len(t, blocked, 1)
+	assert.Equal(t, "admin", blocked[0].Actor)
+
+	assert.NoError(t, pki.UnblockCN("alice"))
+	assert.Error(t, pki.UnblockCN("alice"))
+	_, err = pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	assert.True(t, pki.IsRevoked(second.Serial))
+}
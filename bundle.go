@@ -0,0 +1,166 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SigningRequest is a pending leaf issuance for the air-gapped CA
+type SigningRequest struct {
+	CSR    []byte   `json:"csr"`              // pem encoded CSR
+	CN     string   `json:"cn"`               // common name of the cert
+	Server bool     `json:"server,omitempty"` // issue server cert instead of client
+	Groups []string `json:"groups,omitempty"` // groups as in NewCert
+}
+
+// SigningBundle carry pending signing operations to the air-gapped CA and signed results back.
+// Online side fill Requests, Revoke and ResignCRL, PKI.SignBundle fill the rest
+type SigningBundle struct {
+	Requests  []SigningRequest `json:"requests,omitempty"`   // leaf CSRs to sign
+	Revoke    []*big.Int       `json:"revoke,omitempty"`     // serials to add to CRL
+	ResignCRL bool             `json:"resign_crl,omitempty"` // re-sign CRL without new revocations
+	Certs     [][]byte         `json:"certs,omitempty"`      // pem encoded certs in order of Requests
+	CRL       []byte           `json:"crl,omitempty"`        // pem encoded re-signed CRL
+}
+
+// ParseSigningBundle decode bundle produced by SigningBundle.Marshal
+func ParseSigningBundle(data []byte) (*SigningBundle, error) {
+	bundle := &SigningBundle{}
+	if err := json.Unmarshal(data, bundle); err != nil {
+		return nil, errors.Wrap(err, "can`t parse signing bundle")
+	}
+	return bundle, nil
+}
+
+// Marshal encode bundle to portable json
+func (b *SigningBundle) Marshal() ([]byte, error) {
+	return json.MarshalIndent(b, "", "  ")
+}
+
+// AddCSR add CSR to sign as NewCert would do, CSR signature is checked
+func (b *SigningBundle) AddCSR(csrPem []byte, cn string, server bool, groups []string) error {
+	if _, err := decodeCSR(csrPem); err != nil {
+		return err
+	}
+	b.Requests = append(b.Requests, SigningRequest{CSR: csrPem, CN: cn, Server: server, Groups: groups})
+	return nil
+}
+
+// AddRevoke add serial to revoke
+func (b *SigningBundle) AddRevoke(serial *big.Int) {
+	b.Revoke = append(b.Revoke, serial)
+}
+
+// Signed return true if bundle carry signing results
+func (b *SigningBundle) Signed() bool {
+	return len(b.Certs) > 0 || len(b.CRL) > 0
+}
+
+// SignBundle sign all requests of bundle with last CA key and re-sign CRL with requested revocations at once.
+// Returned bundle keep requests and carry results for ApplySignedBundle
+func (p *PKI) SignBundle(bundle *SigningBundle) (*SigningBundle, error) {
+	if bundle.Signed() {
+		return nil, errors.New("bundle is already signed")
+	}
+	res := *bundle
+	res.Certs = make([][]byte, 0, len(bundle.Requests))
+	for i, req := range bundle.Requests {
+		pair, err := p.SignCSR(req.CSR, req.CN, req.Server, req.Groups)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can`t sign request %d for %s", i, req.CN)
+		}
+		res.Certs = append(res.Certs, pair.CertPemBytes)
+	}
+	if len(bundle.Revoke) > 0 || bundle.ResignCRL {
+		p.crlMu.Lock()
+		defer p.crlMu.Unlock()
+		oldList, err := p.GetCRL()
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t get current crl")
+		}
+		list := oldList.TBSCertList.RevokedCertificates
+		now := p.now()
+		for _, serial := range bundle.Revoke {
+			list = append(list, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: now})
+		}
+		crl, err := p.signCRL(list)
+		if err != nil {
+			return nil, err
+		}
+		res.CRL = crl
+		if err := p.logRevocations(bundle.Revoke, now, "", "signing bundle"); err != nil {
+			return nil, err
+		}
+	}
+	return &res, nil
+}
+
+// ApplySignedBundle import certs and CRL signed by the air-gapped CA.
+// CA cert must be already stored, imported pairs have no key. CRL must be newer than current one,
+// so replayed older bundle can`t roll revocations back
+func (p *PKI) ApplySignedBundle(bundle *SigningBundle) ([]*X509Pair, error) {
+	if !bundle.Signed() {
+		return nil, errors.New("bundle is not signed")
+	}
+	var list *pkix.CertificateList
+	if len(bundle.CRL) > 0 {
+		var err error
+		if list, err = x509.ParseCRL(bundle.CRL); err != nil {
+			return nil, errors.Wrap(err, "can`t parse bundle crl")
+		}
+		if err := p.verifyCRL(list); err != nil {
+			return nil, errors.Wrap(err, "can`t verify bundle crl")
+		}
+		if err := p.checkCRLNewer(list); err != nil {
+			return nil, err
+		}
+	}
+	res := make([]*X509Pair, 0, len(bundle.Certs))
+	for i, certPem := range bundle.Certs {
+		pair, err := p.ImportCert(certPem)
+		if err != nil {
+			return res, errors.Wrapf(err, "can`t import cert %d", i)
+		}
+		res = append(res, pair)
+	}
+	if list != nil {
+		p.crlMu.Lock()
+		defer p.crlMu.Unlock()
+		if err := p.checkCRLNewer(list); err != nil {
+			return res, err
+		}
+		if err := p.crlHolder.Put(bundle.CRL); err != nil {
+			return res, errors.Wrap(err, "can`t put bundle crl")
+		}
+		p.invalidateCache()
+		p.publishCRL(bundle.CRL)
+	}
+	return res, nil
+}
+
+// checkCRLNewer return error if list is not newer than current CRL: ThisUpdate must be later and
+// CRL number greater if current CRL has one
+func (p *PKI) checkCRLNewer(list *pkix.CertificateList) error {
+	current, err := p.GetCRL()
+	if err != nil {
+		return errors.Wrap(err, "can`t get current crl")
+	}
+	if len(current.SignatureValue.Bytes) == 0 {
+		return nil
+	}
+	if !list.TBSCertList.ThisUpdate.After(current.TBSCertList.ThisUpdate) {
+		return errors.Errorf("bundle crl of %s is not newer than current crl of %s",
+			list.TBSCertList.ThisUpdate.Format(time.RFC3339), current.TBSCertList.ThisUpdate.Format(time.RFC3339))
+	}
+	if number := crlNumber(current); number != nil {
+		if bundleNumber := crlNumber(list); bundleNumber == nil || bundleNumber.Cmp(number) <= 0 {
+			return errors.Errorf("bundle crl number is not greater than current crl number %s", number)
+		}
+	}
+	return nil
+}
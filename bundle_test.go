@@ -0,0 +1,103 @@
+package easyrsa
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCSR(t *testing.T, cn string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}}, key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: PEMCertificateRequestBlock, Bytes: der})
+}
+
+func TestSigningBundle(t *testing.T) {
+	offlineDir := filepath.Join(getTestDir(), "air_gapped")
+	_ = os.MkdirAll(offlineDir, 0777)
+	defer os.RemoveAll(offlineDir)
+	offline := NewPKI(NewDirKeyStorage(offlineDir), NewFileSerialProvider(filepath.Join(offlineDir, "serial")),
+		NewFileCRLHolder(filepath.Join(offlineDir, "crl.pem")), pkix.Name{})
+	ca, err := offline.NewCa()
+	assert.NoError(t, err)
+
+	online, cleanup := getTmpPki()
+	defer cleanup()
+	assert.NoError(t, online.Storage.Put(NewX509Pair(nil, ca.CertPemBytes, ca.CN, ca.Serial)))
+
+	bundle := &SigningBundle{}
+	assert.Error(t, bundle.AddCSR([]byte("csr"), "broken", false, nil))
+	assert.NoError(t, bundle.AddCSR(newTestCSR(t, "ignored"), "client", false, []string{"group"}))
+	assert.NoError(t, bundle.AddCSR(newTestCSR(t, "server"), "server", true, nil))
+	bundle.AddRevoke(big.NewInt(42))
+	_, err = online.ApplySignedBundle(bundle)
+	assert.Error(t, err)
+	_, err = online.SignBundle(bundle)
+	assert.Error(t, err)
+
+	data, err := bundle.Marshal()
+	assert.NoError(t, err)
+	pending, err := ParseSigningBundle(data)
+	assert.NoError(t, err)
+	assert.Equal(t, bundle, pending)
+
+	signed, err := offline.SignBundle(pending)
+	assert.NoError(t, err)
+	assert.Len(t, signed.Certs, 2)
+	assert.NotEmpty(t, signed.CRL)
+	_, err = offline.SignBundle(signed)
+	assert.Error(t, err)
+	assert.True(t, offline.IsRevoked(big.NewInt(42)))
+
+	data, err = signed.Marshal()
+	assert.NoError(t, err)
+	signed, err = ParseSigningBundle(data)
+	assert.NoError(t, err)
+	pairs, err := online.ApplySignedBundle(signed)
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 2)
+	assert.Equal(t, "client", pairs[0].CN)
+	assert.False(t, pairs[0].HasKey())
+	assert.Equal(t, "server", pairs[1].CN)
+	assert.True(t, online.IsRevoked(big.NewInt(42)))
+	_, err = online.Storage.GetBySerial(pairs[1].Serial)
+	assert.NoError(t, err)
+
+	// older crl can`t roll revocations back, the same one can`t be replayed
+	offline.clock = func() time.Time { return time.Now().Add(-time.Minute) }
+	stale, err := offline.SignBundle(&SigningBundle{ResignCRL: true})
+	assert.NoError(t, err)
+	_, err = online.ApplySignedBundle(stale)
+	assert.Error(t, err)
+	_, err = online.ApplySignedBundle(&SigningBundle{CRL: signed.CRL})
+	assert.Error(t, err)
+	offline.clock = func() time.Time { return time.Now().Add(time.Minute) }
+	fresh, err := offline.SignBundle(&SigningBundle{Revoke: []*big.Int{big.NewInt(43)}})
+	assert.NoError(t, err)
+	_, err = online.ApplySignedBundle(fresh)
+	assert.NoError(t, err)
+	assert.True(t, online.IsRevoked(big.NewInt(43)))
+
+	otherDir := filepath.Join(getTestDir(), "other_ca")
+	_ = os.MkdirAll(otherDir, 0777)
+	defer os.RemoveAll(otherDir)
+	other := NewPKI(NewDirKeyStorage(otherDir), NewFileSerialProvider(filepath.Join(otherDir, "serial")),
+		NewFileCRLHolder(filepath.Join(otherDir, "crl.pem")), pkix.Name{})
+	_, _ = other.NewCa()
+	forged, err := other.SignBundle(&SigningBundle{ResignCRL: true})
+	assert.NoError(t, err)
+	_, err = online.ApplySignedBundle(forged)
+	assert.Error(t, err)
+}
@@ -0,0 +1,295 @@
+package easyrsa
+
+import (
+	"container/list"
+	"crypto/x509/pkix"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStats is counters of cache lookups
+type CacheStats struct {
+	Hits      uint64 // lookups served from cache
+	Misses    uint64 // lookups passed to the wrapped backend, expired entries included
+	Evictions uint64 // entries dropped to keep cache size
+	Entries   int    // entries in cache now
+}
+
+type cacheCounters struct {
+	hits, misses, evictions uint64
+}
+
+func (c *cacheCounters) stats(entries int) CacheStats {
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+		Entries:   entries,
+	}
+}
+
+// CachingKeyStorage implement KeyStorage interface, caching GetByCN, GetLastByCn and GetBySerial results of
+// the wrapped storage, e.g. remote backend, in LRU with TTL. Writes and deletes go to the wrapped storage and
+// invalidate affected entries, so cache never outlive writes made through it. Writes made around it,
+// e.g. by other process, are seen after TTL or Invalidate
+type CachingKeyStorage struct {
+	KeyStorage
+	size     int                      // max entries, unlimited if not positive
+	ttl      time.Duration            // entry lifetime, unlimited if not positive
+	now      func() time.Time         // clock of entry expiration
+	mu       sync.Mutex               // guard lru and entries
+	lru      *list.List               // cacheEntry elements, most recently used first
+	entries  map[string]*list.Element // lru elements by key
+	gen      uint64                   // invalidation generation, results fetched before invalidation aren`t cached
+	counters cacheCounters
+}
+
+type cacheEntry struct {
+	key     string
+	pairs   []*X509Pair
+	expires time.Time
+}
+
+// NewCachingKeyStorage wrap storage with cache of size entries living ttl
+func NewCachingKeyStorage(storage KeyStorage, size int, ttl time.Duration) *CachingKeyStorage {
+	return &CachingKeyStorage{
+		KeyStorage: storage,
+		size:       size,
+		ttl:        ttl,
+		now:        time.Now,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func cnCacheKey(cn string) string           { return "cn:" + cn }
+func lastCacheKey(cn string) string         { return "last:" + cn }
+func serialCacheKey(serial *big.Int) string { return "serial:" + serial.Text(16) }
+
+// clonePairs return deep copies, so callers can wipe returned pairs without touching cached ones
+func clonePairs(pairs []*X509Pair) []*X509Pair {
+	res := make([]*X509Pair, 0, len(pairs))
+	for _, pair := range pairs {
+		cp := copyPair(pair)
+		cp.ChainPemBytes = append([]byte(nil), pair.ChainPemBytes...)
+		if pair.Serial != nil {
+			cp.Serial = new(big.Int).Set(pair.Serial)
+		}
+		if pair.Metadata != nil {
+			cp.Metadata = make(map[string]string, len(pair.Metadata))
+			for key, value := range pair.Metadata {
+				cp.Metadata[key] = value
+			}
+		}
+		res = append(res, cp)
+	}
+	return res
+}
+
+// get return cached pairs of key, or generation to pass to set on miss
+func (s *CachingKeyStorage) get(key string) ([]*X509Pair, uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.entries[key]
+	if ok && s.ttl > 0 && !s.now().Before(el.Value.(*cacheEntry).expires) {
+		s.remove(el)
+		ok = false
+	}
+	if !ok {
+		atomic.AddUint64(&s.counters.misses, 1)
+		return nil, s.gen, false
+	}
+	atomic.AddUint64(&s.counters.hits, 1)
+	s.lru.MoveToFront(el)
+	return clonePairs(el.Value.(*cacheEntry).pairs), 0, true
+}
+
+// set cache pairs of key unless cache was invalidated since gen was got
+func (s *CachingKeyStorage) set(key string, gen uint64, pairs []*X509Pair) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if gen != s.gen {
+		return
+	}
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+	s.entries[key] = s.lru.PushFront(&cacheEntry{key: key, pairs: clonePairs(pairs), expires: s.now().Add(s.ttl)})
+	for s.size > 0 && s.lru.Len() > s.size {
+		s.remove(s.lru.Back())
+		atomic.AddUint64(&s.counters.evictions, 1)
+	}
+}
+
+// remove drop entry and wipe it`s keys, mu must be held
+func (s *CachingKeyStorage) remove(el *list.Element) {
+	entry := s.lru.Remove(el).(*cacheEntry)
+	delete(s.entries, entry.key)
+	for _, pair := range entry.pairs {
+		pair.Wipe()
+	}
+}
+
+// invalidate drop entries of keys and entries holding any pair matching fn
+func (s *CachingKeyStorage) invalidate(fn func(pair *X509Pair) bool, keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen++
+	for _, key := range keys {
+		if el, ok := s.entries[key]; ok {
+			s.remove(el)
+		}
+	}
+	if fn == nil {
+		return
+	}
+	for el := s.lru.Front(); el != nil; {
+		next := el.Next()
+		for _, pair := range el.Value.(*cacheEntry).pairs {
+			if fn(pair) {
+				s.remove(el)
+				break
+			}
+		}
+		el = next
+	}
+}
+
+// Invalidate drop all cached entries
+func (s *CachingKeyStorage) Invalidate() {
+	s.invalidate(func(*X509Pair) bool { return true })
+}
+
+// InvalidateCN drop cached entries of cn
+func (s *CachingKeyStorage) InvalidateCN(cn string) {
+	s.invalidate(func(pair *X509Pair) bool { return pair.CN == cn }, cnCacheKey(cn), lastCacheKey(cn))
+}
+
+// Stats return counters of cache lookups
+func (s *CachingKeyStorage) Stats() CacheStats {
+	s.mu.Lock()
+	entries := s.lru.Len()
+	s.mu.Unlock()
+	return s.counters.stats(entries)
+}
+
+func (s *CachingKeyStorage) Put(pair *X509Pair) error {
+	defer s.invalidate(nil, cnCacheKey(pair.CN), lastCacheKey(pair.CN), serialCacheKey(pair.Serial))
+	return s.KeyStorage.Put(pair)
+}
+
+func (s *CachingKeyStorage) GetByCN(cn string) ([]*X509Pair, error) {
+	pairs, gen, ok := s.get(cnCacheKey(cn))
+	if ok {
+		return pairs, nil
+	}
+	pairs, err := s.KeyStorage.GetByCN(cn)
+	if err != nil {
+		return nil, err
+	}
+	s.set(cnCacheKey(cn), gen, pairs)
+	return pairs, nil
+}
+
+func (s *CachingKeyStorage) GetLastByCn(cn string) (*X509Pair, error) {
+	pairs, gen, ok := s.get(lastCacheKey(cn))
+	if ok {
+		return pairs[0], nil
+	}
+	pair, err := s.KeyStorage.GetLastByCn(cn)
+	if err != nil {
+		return nil, err
+	}
+	s.set(lastCacheKey(cn), gen, []*X509Pair{pair})
+	return pair, nil
+}
+
+func (s *CachingKeyStorage) GetBySerial(serial *big.Int) (*X509Pair, error) {
+	pairs, gen, ok := s.get(serialCacheKey(serial))
+	if ok {
+		return pairs[0], nil
+	}
+	pair, err := s.KeyStorage.GetBySerial(serial)
+	if err != nil {
+		return nil, err
+	}
+	s.set(serialCacheKey(serial), gen, []*X509Pair{pair})
+	return pair, nil
+}
+
+func (s *CachingKeyStorage) DeleteByCn(cn string) error {
+	defer s.InvalidateCN(cn)
+	return s.KeyStorage.DeleteByCn(cn)
+}
+
+func (s *CachingKeyStorage) DeleteBySerial(serial *big.Int) error {
+	defer s.invalidate(func(pair *X509Pair) bool { return pair.Serial.Cmp(serial) == 0 }, serialCacheKey(serial))
+	return s.KeyStorage.DeleteBySerial(serial)
+}
+
+// CachingCRLHolder implement CRLHolder interface, caching CRL of the wrapped holder for TTL.
+// Put invalidate the cache. Returned list is shared and must not be modified
+type CachingCRLHolder struct {
+	CRLHolder
+	ttl      time.Duration    // CRL lifetime in cache, until Put or Invalidate if not positive
+	now      func() time.Time // clock of expiration
+	mu       sync.Mutex       // guard list and expires
+	list     *pkix.CertificateList
+	expires  time.Time
+	gen      uint64 // invalidation generation as in CachingKeyStorage
+	counters cacheCounters
+}
+
+// NewCachingCRLHolder wrap holder with CRL cache living ttl
+func NewCachingCRLHolder(holder CRLHolder, ttl time.Duration) *CachingCRLHolder {
+	return &CachingCRLHolder{CRLHolder: holder, ttl: ttl, now: time.Now}
+}
+
+func (h *CachingCRLHolder) Put(content []byte) error {
+	defer h.Invalidate()
+	return h.CRLHolder.Put(content)
+}
+
+func (h *CachingCRLHolder) Get() (*pkix.CertificateList, error) {
+	h.mu.Lock()
+	if h.list != nil && (h.ttl <= 0 || h.now().Before(h.expires)) {
+		list := h.list
+		h.mu.Unlock()
+		atomic.AddUint64(&h.counters.hits, 1)
+		return list, nil
+	}
+	gen := h.gen
+	h.mu.Unlock()
+	atomic.AddUint64(&h.counters.misses, 1)
+	list, err := h.CRLHolder.Get()
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	if gen == h.gen {
+		h.list, h.expires = list, h.now().Add(h.ttl)
+	}
+	h.mu.Unlock()
+	return list, nil
+}
+
+// Invalidate drop cached CRL
+func (h *CachingCRLHolder) Invalidate() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.gen++
+	h.list = nil
+}
+
+// Stats return counters of CRL lookups
+func (h *CachingCRLHolder) Stats() CacheStats {
+	h.mu.Lock()
+	entries := 0
+	if h.list != nil {
+		entries = 1
+	}
+	h.mu.Unlock()
+	return h.counters.stats(entries)
+}
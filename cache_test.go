@@ -0,0 +1,127 @@
+package easyrsa
+
+import (
+	"crypto/x509/pkix"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingKeyStorage struct {
+	KeyStorage
+	reads int64
+}
+
+func (s *countingKeyStorage) GetLastByCn(cn string) (*X509Pair, error) {
+	atomic.AddInt64(&s.reads, 1)
+	return s.KeyStorage.GetLastByCn(cn)
+}
+
+func (s *countingKeyStorage) GetBySerial(serial *big.Int) (*X509Pair, error) {
+	atomic.AddInt64(&s.reads, 1)
+	return s.KeyStorage.GetBySerial(serial)
+}
+
+type countingCRLHolder struct {
+	CRLHolder
+	reads int64
+}
+
+func (h *countingCRLHolder) Get() (*pkix.CertificateList, error) {
+	atomic.AddInt64(&h.reads, 1)
+	return h.CRLHolder.Get()
+}
+
+func TestCachingKeyStorage(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	backend := &countingKeyStorage{KeyStorage: pki.Storage}
+	cache := NewCachingKeyStorage(backend, 2, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	pki.Storage = cache
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	first, err := pki.NewCert("client", false, nil)
+	assert.NoError(t, err)
+
+	t.Run("hit", func(t *testing.T) {
+		reads := atomic.LoadInt64(&backend.reads)
+		pair, err := cache.GetBySerial(first.Serial)
+		assert.NoError(t, err)
+		pair.Wipe()
+		pair, err = cache.GetBySerial(first.Serial)
+		assert.NoError(t, err)
+		assert.Equal(t, first.CertPemBytes, pair.CertPemBytes, "cached pair is not wiped by caller")
+		assert.Equal(t, reads+1, atomic.LoadInt64(&backend.reads))
+	})
+
+	t.Run("put invalidate", func(t *testing.T) {
+		last, err := cache.GetLastByCn("client")
+		assert.NoError(t, err)
+		assert.Equal(t, first.Serial, last.Serial)
+		second, err := pki.NewCert("client", false, nil)
+		assert.NoError(t, err)
+		last, err = cache.GetLastByCn("client")
+		assert.NoError(t, err)
+		assert.Equal(t, second.Serial, last.Serial)
+	})
+
+	t.Run("delete invalidate", func(t *testing.T) {
+		_, err := cache.GetBySerial(first.Serial)
+		assert.NoError(t, err)
+		assert.NoError(t, cache.DeleteBySerial(first.Serial))
+		_, err = cache.GetBySerial(first.Serial)
+		assert.Error(t, err)
+	})
+
+	t.Run("ttl and lru", func(t *testing.T) {
+		cache.Invalidate()
+		before := cache.Stats()
+		for _, cn := range []string{"ca", "client", "ca"} {
+			_, err := cache.GetLastByCn(cn)
+			assert.NoError(t, err)
+		}
+		stats := cache.Stats()
+		assert.Equal(t, before.Misses+2, stats.Misses)
+		assert.Equal(t, before.Hits+1, stats.Hits)
+		assert.Equal(t, 2, stats.Entries)
+
+		_, err := cache.GetBySerial(big.NewInt(1))
+		assert.NoError(t, err)
+		assert.Equal(t, before.Evictions+1, cache.Stats().Evictions)
+
+		now = now.Add(time.Minute)
+		_, err = cache.GetLastByCn("ca")
+		assert.NoError(t, err)
+		assert.Equal(t, stats.Misses+2, cache.Stats().Misses)
+	})
+}
+
+func TestCachingCRLHolder(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	backend := &countingCRLHolder{CRLHolder: pki.crlHolder}
+	cache := NewCachingCRLHolder(backend, time.Minute)
+	pki.crlHolder = cache
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	pair, err := pki.NewCert("client", false, nil)
+	assert.NoError(t, err)
+
+	assert.False(t, pki.IsRevoked(pair.Serial))
+	assert.False(t, pki.IsRevoked(pair.Serial))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&backend.reads))
+
+	assert.NoError(t, pki.Revoke(pair.Serial, "test", ""))
+	assert.True(t, pki.IsRevoked(pair.Serial))
+	stats := cache.Stats()
+	assert.Equal(t, 1, stats.Entries)
+
+	cache.Invalidate()
+	assert.True(t, pki.IsRevoked(pair.Serial))
+	assert.Equal(t, stats.Misses+1, cache.Stats().Misses)
+}
@@ -0,0 +1,77 @@
+package easyrsa
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CARenewal configure automatic minting of the next CA generation before the last CA expire
+type CARenewal struct {
+	Before    time.Duration                                                          // renew when the last CA expire sooner than this
+	AlertOnly bool                                                                   // only call OnDue, next CA is minted by operator
+	OnDue     func(ca *x509.Certificate, left time.Duration)                         // called when renewal is due, optional
+	OnRenewed func(ca *X509Pair, status *RotationStatus, previous *x509.Certificate) // called after new CA is minted, optional
+}
+
+// WithCARenewal enable CA renewal by RenewCAIfDue and RunCARenewal
+func WithCARenewal(renewal *CARenewal) Option {
+	return func(p *PKI) {
+		p.caRenewal = renewal
+	}
+}
+
+// RenewCAIfDue mint next CA generation if the last CA expire within CARenewal.Before.
+// Nil pair is returned if renewal is not due or CARenewal.AlertOnly is set
+func (p *PKI) RenewCAIfDue() (*X509Pair, error) {
+	if p.caRenewal == nil {
+		return nil, errors.New("ca renewal is not configured")
+	}
+	caPair, err := p.GetLastCA()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get ca pair")
+	}
+	caCert, err := decodeCert(caPair.CertPemBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t parse ca cert")
+	}
+	left := caCert.NotAfter.Sub(p.now())
+	if left > p.caRenewal.Before {
+		return nil, nil
+	}
+	if p.caRenewal.OnDue != nil {
+		p.caRenewal.OnDue(caCert, left)
+	}
+	if p.caRenewal.AlertOnly {
+		return nil, nil
+	}
+	ca, status, err := p.RotateCA()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t renew ca")
+	}
+	if p.caRenewal.OnRenewed != nil {
+		p.caRenewal.OnRenewed(ca, status, caCert)
+	}
+	return ca, nil
+}
+
+// RunCARenewal call RenewCAIfDue every interval until ctx is done, errors are passed to onError if it`s not nil.
+// Instances which are not the leader skip renewal silently
+func (p *PKI) RunCARenewal(ctx context.Context, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := p.RenewCAIfDue(); err != nil && onError != nil {
+			if _, ok := errors.Cause(err).(*NotLeader); !ok {
+				onError(err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package easyrsa
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_RenewCAIfDue(t *testing.T) {
+	var due []time.Duration
+	var renewed []*X509Pair
+	renewal := &CARenewal{
+		Before: 30 * 24 * time.Hour,
+		OnDue:  func(ca *x509.Certificate, left time.Duration) { due = append(due, left) },
+		OnRenewed: func(ca *X509Pair, status *RotationStatus, previous *x509.Certificate) {
+			renewed = append(renewed, ca)
+		},
+	}
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithValidity(365*24*time.Hour, 0), WithCARenewal(renewal))
+	defer cleanup()
+	oldCa, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	t.Run("not due", func(t *testing.T) {
+		ca, err := pki.RenewCAIfDue()
+		assert.NoError(t, err)
+		assert.Nil(t, ca)
+		assert.Empty(t, due)
+	})
+
+	later := time.Now().Add(350 * 24 * time.Hour)
+	pki.clock = func() time.Time { return later }
+
+	t.Run("alert only", func(t *testing.T) {
+		renewal.AlertOnly = true
+		defer func() { renewal.AlertOnly = false }()
+		ca, err := pki.RenewCAIfDue()
+		assert.NoError(t, err)
+		assert.Nil(t, ca)
+		assert.Len(t, due, 1)
+		last, _ := pki.GetLastCA()
+		assert.Equal(t, oldCa.Serial, last.Serial)
+	})
+
+	t.Run("renew", func(t *testing.T) {
+		ca, err := pki.RenewCAIfDue()
+		assert.NoError(t, err)
+		if assert.NotNil(t, ca) {
+			assert.Equal(t, []*X509Pair{ca}, renewed)
+			last, _ := pki.GetLastCA()
+			assert.Equal(t, ca.Serial, last.Serial)
+		}
+		ca, err = pki.RenewCAIfDue()
+		assert.NoError(t, err)
+		assert.Nil(t, ca, "new ca is not due")
+	})
+
+	t.Run("run", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Equal(t, context.Canceled, pki.RunCARenewal(ctx, time.Hour, func(err error) { t.Error(err) }))
+	})
+}
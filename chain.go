@@ -0,0 +1,86 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// CAChainPEM return pem encoded issuing chain including the root
+func (pair *X509Pair) CAChainPEM() []byte {
+	return pair.ChainPemBytes
+}
+
+// FullChainPEM return pem encoded cert followed by intermediates, self signed root is omitted
+func (pair *X509Pair) FullChainPEM() []byte {
+	res := bytes.NewBuffer(nil)
+	res.Write(pair.CertPemBytes)
+	rest := pair.ChainPemBytes
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != PEMCertificateBlock {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil && isSelfSigned(cert) {
+			continue
+		}
+		_ = pem.Encode(res, block)
+	}
+	return res.Bytes()
+}
+
+// ResolveChain fill ChainPemBytes of the pair from CA certs in storage
+func (p *PKI) ResolveChain(pair *X509Pair) error {
+	cert, err := decodeCert(pair.CertPemBytes)
+	if err != nil {
+		return err
+	}
+	cas, caPems, err := p.caCerts()
+	if err != nil {
+		return err
+	}
+
+	chain := bytes.NewBuffer(nil)
+	for depth := 0; !isSelfSigned(cert); depth++ {
+		issuer := findIssuer(cert, cas)
+		if issuer == nil {
+			return errors.New("can`t find issuer in storage")
+		}
+		if depth > len(cas) {
+			return errors.New("issuer loop in storage")
+		}
+		chain.Write(caPems[issuer])
+		cert = issuer
+	}
+	pair.ChainPemBytes = chain.Bytes()
+	return nil
+}
+
+// caCerts decode stored CA and trust anchor certs, undecodable ones are skipped
+func (p *PKI) caCerts() ([]*x509.Certificate, map[*x509.Certificate][]byte, error) {
+	cas := make([]*x509.Certificate, 0)
+	caPems := make(map[*x509.Certificate][]byte)
+	for _, cn := range []string{"ca", TrustAnchorCN} {
+		err := ForEachByCN(p.Storage, cn, func(pair *X509Pair) error {
+			if caCert, err := decodeCert(pair.CertPemBytes); err == nil {
+				cas = append(cas, caCert)
+				caPems[caCert] = pair.CertPemBytes
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "can`t get ca certs")
+		}
+	}
+	return cas, caPems, nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
@@ -0,0 +1,45 @@
+package easyrsa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestX509Pair_FullChainPEM(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	ca, _ := pki.NewCa()
+	pair, err := pki.NewCert("server", true, []string{""})
+	assert.NoError(t, err)
+	assert.Equal(t, ca.CertPemBytes, pair.CAChainPEM())
+	assert.Equal(t, pair.CertPemBytes, pair.FullChainPEM())
+}
+
+func TestPKI_ResolveChain(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	oldCa, _ := pki.NewCa()
+	oldIssued, _ := pki.NewCert("server", true, []string{""})
+	ca, _ := pki.NewCa()
+	issued, _ := pki.NewCert("server", true, []string{""})
+	t.Run("last ca", func(t *testing.T) {
+		stored, _ := pki.Storage.GetBySerial(issued.Serial)
+		assert.Empty(t, stored.ChainPemBytes)
+		assert.NoError(t, pki.ResolveChain(stored))
+		assert.Equal(t, ca.CertPemBytes, stored.ChainPemBytes)
+	})
+	t.Run("old ca", func(t *testing.T) {
+		stored, _ := pki.Storage.GetBySerial(oldIssued.Serial)
+		assert.NoError(t, pki.ResolveChain(stored))
+		assert.Equal(t, oldCa.CertPemBytes, stored.ChainPemBytes)
+	})
+	t.Run("root", func(t *testing.T) {
+		stored, _ := pki.Storage.GetBySerial(ca.Serial)
+		assert.NoError(t, pki.ResolveChain(stored))
+		assert.Empty(t, stored.ChainPemBytes)
+	})
+	t.Run("broken", func(t *testing.T) {
+		assert.Error(t, pki.ResolveChain(NewX509Pair(nil, []byte("certbytes"), "broken", nil)))
+	})
+}
@@ -0,0 +1,358 @@
+// Package client is a lightweight subset of easyrsa for enrollment clients: key and CSR generation,
+// pair decode, bundle verification and PKCS #12 packaging. It has no storage and server dependencies
+// and use gomobile compatible types only, so it can be bound for Android and iOS with
+// "gomobile bind github.com/productsupcom/go-easyrsa/client".
+// Lists are passed as comma separated strings, times as unix seconds
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const (
+	pemCertificateBlock        = "CERTIFICATE"
+	pemCertificateRequestBlock = "CERTIFICATE REQUEST"
+	pemPrivateKeyBlock         = "PRIVATE KEY"
+)
+
+// Key types accepted by GenerateKey
+const (
+	KeyTypeRSA2048   = "rsa2048"
+	KeyTypeRSA3072   = "rsa3072"
+	KeyTypeRSA4096   = "rsa4096"
+	KeyTypeECDSAP256 = "ecdsa-p256"
+	KeyTypeECDSAP384 = "ecdsa-p384"
+	KeyTypeEd25519   = "ed25519"
+)
+
+var oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+
+// GenerateKey return new PKCS #8 pem encoded private key of keyType, KeyTypeECDSAP256 if empty
+func GenerateKey(keyType string) ([]byte, error) {
+	var key crypto.Signer
+	var err error
+	switch strings.ToLower(keyType) {
+	case KeyTypeRSA2048:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case KeyTypeRSA3072:
+		key, err = rsa.GenerateKey(rand.Reader, 3072)
+	case KeyTypeRSA4096:
+		key, err = rsa.GenerateKey(rand.Reader, 4096)
+	case KeyTypeECDSAP256, "":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeECDSAP384:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyTypeEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, errors.Errorf("unsupported key type %q", keyType)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t generate key")
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal key")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemPrivateKeyBlock, Bytes: der}), nil
+}
+
+// NewCSR return pem encoded CSR for cn signed by keyPem.
+// altNames are comma separated DNS names and IP addresses, challenge is put to challengePassword
+// attribute if not empty, e.g. nonce of server side NewCSRChallenge
+func NewCSR(keyPem []byte, cn, altNames, challenge string) ([]byte, error) {
+	key, err := parseKey(keyPem)
+	if err != nil {
+		return nil, err
+	}
+	tml := &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}}
+	for _, name := range splitList(altNames) {
+		if ip := net.ParseIP(name); ip != nil {
+			tml.IPAddresses = append(tml.IPAddresses, ip)
+		} else {
+			tml.DNSNames = append(tml.DNSNames, name)
+		}
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, tml, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t create csr")
+	}
+	if challenge != "" {
+		// x509.CertificateRequest.Attributes can`t hold string attributes, so CSR is re-signed with it
+		if der, err = withChallenge(der, key, challenge); err != nil {
+			return nil, err
+		}
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemCertificateRequestBlock, Bytes: der}), nil
+}
+
+// Pair is a decoded certificate with optional key
+type Pair struct {
+	CN        string // subject common name
+	Serial    string // serial as colon separated hex octets
+	Issuer    string // issuer common name
+	AltNames  string // comma separated DNS names and IP addresses
+	NotBefore int64  // unix seconds
+	NotAfter  int64  // unix seconds
+	IsCA      bool
+	HasKey    bool // key was given and match the certificate
+}
+
+// DecodePair decode first certificate of certPem, keyPem is optional and must match the certificate if given
+func DecodePair(certPem, keyPem []byte) (*Pair, error) {
+	cert, err := parseCert(certPem)
+	if err != nil {
+		return nil, err
+	}
+	res := &Pair{
+		CN:        cert.Subject.CommonName,
+		Serial:    formatSerial(cert.SerialNumber.Bytes()),
+		Issuer:    cert.Issuer.CommonName,
+		NotBefore: cert.NotBefore.Unix(),
+		NotAfter:  cert.NotAfter.Unix(),
+		IsCA:      cert.IsCA,
+	}
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	res.AltNames = strings.Join(names, ",")
+	if len(keyPem) == 0 {
+		return res, nil
+	}
+	key, err := parseKey(keyPem)
+	if err != nil {
+		return nil, err
+	}
+	if !publicKeyEqual(key.Public(), cert.PublicKey) {
+		return nil, errors.New("key doesn`t match certificate")
+	}
+	res.HasKey = true
+	return res, nil
+}
+
+// VerifyBundle verify first certificate of certPem is valid for client auth now.
+// Self signed certificates of bundlePem are trusted roots, other certificates of bundlePem and chainPem
+// are intermediates
+func VerifyBundle(certPem, chainPem, bundlePem []byte) error {
+	cert, err := parseCert(certPem)
+	if err != nil {
+		return err
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	bundle, err := parseCerts(bundlePem)
+	if err != nil {
+		return err
+	}
+	for _, c := range bundle {
+		if c.CheckSignatureFrom(c) == nil {
+			roots.AddCert(c)
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+	if len(roots.Subjects()) == 0 { //nolint:staticcheck // pool is built from pem, not system roots
+		return errors.New("bundle has no root certificates")
+	}
+	chain, err := parseCerts(chainPem)
+	if err != nil {
+		return err
+	}
+	for _, c := range chain {
+		intermediates.AddCert(c)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return errors.Wrap(err, "can`t verify certificate")
+}
+
+// PKCS12 return PKCS #12 archive of certificate, key and chain encrypted with password,
+// as imported by Android KeyChain and iOS keychain
+func PKCS12(certPem, keyPem, chainPem []byte, password string) ([]byte, error) {
+	cert, err := parseCert(certPem)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseKey(keyPem)
+	if err != nil {
+		return nil, err
+	}
+	if !publicKeyEqual(key.Public(), cert.PublicKey) {
+		return nil, errors.New("key doesn`t match certificate")
+	}
+	chain, err := parseCerts(chainPem)
+	if err != nil {
+		return nil, err
+	}
+	res, err := pkcs12.Modern.Encode(key, cert, chain, password)
+	return res, errors.Wrap(err, "can`t encode pkcs12")
+}
+
+func parseKey(keyPem []byte) (crypto.Signer, error) {
+	for block, rest := pem.Decode(keyPem); block != nil; block, rest = pem.Decode(rest) {
+		var key interface{}
+		var err error
+		switch block.Type {
+		case pemPrivateKeyBlock:
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t parse key")
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported key type")
+		}
+		return signer, nil
+	}
+	return nil, errors.New("can`t find key in pem")
+}
+
+func parseCert(certPem []byte) (*x509.Certificate, error) {
+	certs, err := parseCerts(certPem)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("can`t find certificate in pem")
+	}
+	return certs[0], nil
+}
+
+func parseCerts(pemBytes []byte) ([]*x509.Certificate, error) {
+	var res []*x509.Certificate
+	for block, rest := pem.Decode(pemBytes); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != pemCertificateBlock {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t parse certificate")
+		}
+		res = append(res, cert)
+	}
+	return res, nil
+}
+
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// withChallenge re-sign CSR der with challengePassword attribute added
+func withChallenge(der []byte, key crypto.Signer, challenge string) ([]byte, error) {
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t parse csr")
+	}
+	var tbs struct {
+		Version       int
+		Subject       asn1.RawValue
+		PublicKey     asn1.RawValue
+		RawAttributes []asn1.RawValue `asn1:"tag:0"`
+	}
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		return nil, errors.Wrap(err, "can`t parse csr")
+	}
+	attr, err := asn1.Marshal(struct {
+		Type   asn1.ObjectIdentifier
+		Values []asn1.RawValue `asn1:"set"`
+	}{oidChallengePassword, []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(challenge)}}})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal challenge")
+	}
+	tbs.RawAttributes = append(tbs.RawAttributes, asn1.RawValue{FullBytes: attr})
+	tbsDer, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal csr")
+	}
+	alg, hash, err := signatureAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	digest, opts := tbsDer, crypto.SignerOpts(crypto.Hash(0))
+	if hash != 0 {
+		h := hash.New()
+		h.Write(tbsDer)
+		digest, opts = h.Sum(nil), hash
+	}
+	sig, err := key.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t sign csr")
+	}
+	res, err := asn1.Marshal(struct {
+		TBS       asn1.RawValue
+		Algorithm pkix.AlgorithmIdentifier
+		Signature asn1.BitString
+	}{asn1.RawValue{FullBytes: tbsDer}, alg, asn1.BitString{Bytes: sig, BitLength: len(sig) * 8}})
+	return res, errors.Wrap(err, "can`t marshal csr")
+}
+
+// signatureAlgorithm return CSR signature algorithm and digest for key, as x509 choose it
+func signatureAlgorithm(key crypto.Signer) (pkix.AlgorithmIdentifier, crypto.Hash, error) {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11},
+			Parameters: asn1.NullRawValue,
+		}, crypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P384():
+			return pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}}, crypto.SHA384, nil
+		case elliptic.P521():
+			return pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}}, crypto.SHA512, nil
+		}
+		return pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}}, crypto.SHA256, nil
+	case ed25519.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 101, 112}}, 0, nil
+	}
+	return pkix.AlgorithmIdentifier{}, 0, errors.New("unsupported key type")
+}
+
+func splitList(s string) []string {
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func formatSerial(b []byte) string {
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	octets := make([]string, len(b))
+	for i, o := range b {
+		octets[i] = hex.EncodeToString([]byte{o})
+	}
+	return strings.Join(octets, ":")
+}
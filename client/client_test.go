@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	easyrsa "github.com/productsupcom/go-easyrsa"
+	"github.com/stretchr/testify/assert"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func newTestPKI(t *testing.T, opts ...easyrsa.Option) *easyrsa.PKI {
+	dir := t.TempDir()
+	opts = append([]easyrsa.Option{easyrsa.WithKeySize(1024)}, opts...)
+	pki := easyrsa.NewPKI(easyrsa.NewDirKeyStorage(dir), easyrsa.NewFileSerialProvider(filepath.Join(dir, "serial")),
+		easyrsa.NewFileCRLHolder(filepath.Join(dir, "crl.pem")), pkix.Name{}, opts...)
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	return pki
+}
+
+func TestNewCSR(t *testing.T) {
+	for _, keyType := range []string{"", KeyTypeRSA2048, KeyTypeECDSAP384, KeyTypeEd25519} {
+		t.Run(keyType, func(t *testing.T) {
+			keyPem, err := GenerateKey(keyType)
+			assert.NoError(t, err)
+			csr, err := NewCSR(keyPem, "phone", "phone.example.com, 10.0.0.1", "nonce")
+			assert.NoError(t, err)
+			assert.Contains(t, string(csr), "CERTIFICATE REQUEST")
+		})
+	}
+	_, err := GenerateKey("dsa")
+	assert.Error(t, err)
+}
+
+func TestEnroller(t *testing.T) {
+	policy := &easyrsa.CSRPolicy{RequireChallenge: true, MinRSABits: 1024}
+	pki := newTestPKI(t, easyrsa.WithCSRPolicy(policy))
+	facade := easyrsa.NewVaultFacade(pki, &easyrsa.VaultRole{Name: "mobile"})
+	// devices have no credentials but CSR challenge
+	facade.Auth = &easyrsa.APIAuth{
+		Authenticator: easyrsa.AuthenticatorFunc(func(ctx context.Context, creds *easyrsa.Credentials) (*easyrsa.Identity, error) {
+			return &easyrsa.Identity{Name: "device"}, nil
+		}),
+		Rules: easyrsa.AuthorizationRules{{Identities: []string{"device"}, CNs: []string{"*"}}},
+	}
+	server := httptest.NewServer(facade)
+	defer server.Close()
+	enroller := NewEnroller(server.URL, "token", 0)
+
+	keyPem, err := GenerateKey("")
+	assert.NoError(t, err)
+	csr, err := NewCSR(keyPem, "phone", "phone.example.com", "wrong")
+	assert.NoError(t, err)
+	_, err = enroller.Sign("mobile", csr, "phone", "", "")
+	assert.Error(t, err)
+
+	nonce, err := pki.NewCSRChallenge("phone")
+	assert.NoError(t, err)
+	csr, err = NewCSR(keyPem, "phone", "phone.example.com", nonce)
+	assert.NoError(t, err)
+	cert, err := enroller.Sign("mobile", csr, "phone", "phone.example.com", "24h")
+	assert.NoError(t, err)
+
+	pair, err := DecodePair(cert.CertPEM, keyPem)
+	assert.NoError(t, err)
+	assert.Equal(t, "phone", pair.CN)
+	assert.Equal(t, cert.Serial, pair.Serial)
+	assert.Contains(t, pair.AltNames, "phone.example.com")
+	assert.True(t, pair.HasKey)
+	assert.False(t, pair.IsCA)
+
+	otherKey, err := GenerateKey("")
+	assert.NoError(t, err)
+	_, err = DecodePair(cert.CertPEM, otherKey)
+	assert.Error(t, err)
+
+	bundle, err := enroller.CAChain()
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyBundle(cert.CertPEM, cert.ChainPEM, bundle))
+	assert.Error(t, VerifyBundle(cert.CertPEM, nil, newTestPKIBundle(t)))
+
+	p12, err := PKCS12(cert.CertPEM, keyPem, cert.ChainPEM, "secret")
+	assert.NoError(t, err)
+	key, leaf, chain, err := pkcs12.DecodeChain(p12, "secret")
+	assert.NoError(t, err)
+	assert.NotNil(t, key)
+	assert.Equal(t, "phone", leaf.Subject.CommonName)
+	assert.Len(t, chain, strings.Count(string(cert.ChainPEM), "BEGIN CERTIFICATE"))
+	_, err = PKCS12(cert.CertPEM, otherKey, nil, "secret")
+	assert.Error(t, err)
+}
+
+func newTestPKIBundle(t *testing.T) []byte {
+	ca, err := newTestPKI(t).GetLastCA()
+	assert.NoError(t, err)
+	return ca.CertPemBytes
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Enroller request certificates from Vault compatible http API of easyrsa VaultFacade
+type Enroller struct {
+	URL    string // facade mount url, e.g. https://ca.example.com/v1/pki
+	Token  string // sent as X-Vault-Token if not empty
+	APIKey string // sent as X-API-Key if not empty
+
+	http *http.Client
+}
+
+// NewEnroller create enroller for facade url with timeoutSec http timeout, 30 seconds if zero
+func NewEnroller(url, token string, timeoutSec int) *Enroller {
+	timeout := time.Duration(timeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &Enroller{URL: strings.TrimRight(url, "/"), Token: token, http: &http.Client{Timeout: timeout}}
+}
+
+// Certificate is a signed certificate returned by Sign
+type Certificate struct {
+	CertPEM    []byte // issued certificate
+	ChainPEM   []byte // issuing CA followed by it`s chain
+	Serial     string // serial as colon separated hex octets
+	Expiration int64  // unix seconds
+}
+
+// Sign send csrPem to sign/<role>, altNames are comma separated, ttl is a duration string or empty for role default
+func (e *Enroller) Sign(role string, csrPem []byte, cn, altNames, ttl string) (*Certificate, error) {
+	body, err := json.Marshal(map[string]string{
+		"common_name": cn,
+		"alt_names":   altNames,
+		"ttl":         ttl,
+		"csr":         string(csrPem),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal request")
+	}
+	data, err := e.do(http.MethodPost, "sign/"+role, body)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data struct {
+			Certificate  string   `json:"certificate"`
+			CAChain      []string `json:"ca_chain"`
+			SerialNumber string   `json:"serial_number"`
+			Expiration   int64    `json:"expiration"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, errors.Wrap(err, "can`t parse response")
+	}
+	res := &Certificate{
+		CertPEM:    []byte(resp.Data.Certificate + "\n"),
+		Serial:     resp.Data.SerialNumber,
+		Expiration: resp.Data.Expiration,
+	}
+	for _, c := range resp.Data.CAChain {
+		res.ChainPEM = append(res.ChainPEM, strings.TrimSpace(c)+"\n"...)
+	}
+	return res, nil
+}
+
+// CAChain return pem of current CA followed by it`s chain
+func (e *Enroller) CAChain() ([]byte, error) {
+	return e.do(http.MethodGet, "ca_chain", nil)
+}
+
+func (e *Enroller) do(method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, e.URL+"/"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t create request")
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if e.Token != "" {
+		req.Header.Set("X-Vault-Token", e.Token)
+	}
+	if e.APIKey != "" {
+		req.Header.Set("X-API-Key", e.APIKey)
+	}
+	httpClient := e.http
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can`t request %s", path)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, errors.Wrapf(err, "can`t read %s response", path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(data, &vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return nil, errors.Errorf("%s: %s", path, strings.Join(vaultErr.Errors, "; "))
+		}
+		return nil, errors.Errorf("%s: unexpected status %s", path, resp.Status)
+	}
+	return data, nil
+}
@@ -0,0 +1,361 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/productsupcom/go-easyrsa"
+)
+
+// path resolve p against config dir
+func (c *Config) path(p string) string {
+	if p == "" || filepath.IsAbs(p) || c.dir == "" {
+		return p
+	}
+	return filepath.Join(c.dir, p)
+}
+
+// KeyStorage return storage backend, key dir is created if missing. It`s wrapped with cache if cache is configured
+func (c *Config) KeyStorage() (easyrsa.KeyStorage, error) {
+	var storage easyrsa.KeyStorage
+	switch c.Storage.Type {
+	case "", "dir":
+		if c.Storage.Path == "" {
+			return nil, errors.New("storage path is not set")
+		}
+		var opts []easyrsa.DirKeyStorageOption
+		if c.Storage.Umask != "" {
+			mask, err := strconv.ParseUint(c.Storage.Umask, 8, 32)
+			if err != nil {
+				return nil, errors.Errorf("wrong storage umask %q", c.Storage.Umask)
+			}
+			opts = append(opts, easyrsa.WithUmask(os.FileMode(mask)))
+		}
+		// serial and crl files are kept in key dir by default, so it must exist before first issuance
+		if err := os.MkdirAll(c.path(c.Storage.Path), 0700); err != nil {
+			return nil, errors.Wrap(err, "can`t create storage dir")
+		}
+		storage = easyrsa.NewDirKeyStorage(c.path(c.Storage.Path), opts...)
+	default:
+		return nil, errors.Errorf("unknown storage type %q", c.Storage.Type)
+	}
+	if c.Storage.CacheSize > 0 || c.Storage.CacheTTL > 0 {
+		storage = easyrsa.NewCachingKeyStorage(storage, c.Storage.CacheSize, time.Duration(c.Storage.CacheTTL))
+	}
+	return storage, nil
+}
+
+// SerialProvider return serial provider, wrapped with ReservingSerialProvider if reserve is set
+func (c *Config) SerialProvider() (easyrsa.SerialProvider, error) {
+	path := c.path(c.Serial.Path)
+	if path == "" && c.Storage.Path != "" {
+		path = filepath.Join(c.path(c.Storage.Path), "serial")
+	}
+	var sp easyrsa.SerialProvider
+	switch c.Serial.Type {
+	case "", "file":
+		sp = easyrsa.NewFileSerialProvider(path)
+	case "journal":
+		sp = easyrsa.NewJournalSerialProvider(path)
+	case "uuid":
+		sp = easyrsa.NewUUIDSerialProvider()
+	case "uuid7":
+		sp = easyrsa.NewTimeOrderedSerialProvider()
+	default:
+		return nil, errors.Errorf("unknown serial type %q", c.Serial.Type)
+	}
+	if path == "" && (c.Serial.Type == "" || c.Serial.Type == "file" || c.Serial.Type == "journal") {
+		return nil, errors.New("serial path is not set")
+	}
+	if c.Serial.Reserve > 0 {
+		sp = easyrsa.NewReservingSerialProvider(sp, c.Serial.Reserve)
+	}
+	return sp, nil
+}
+
+// CRLHolder return CRL holder, wrapped with cache if cache ttl is set
+func (c *Config) CRLHolder() (easyrsa.CRLHolder, error) {
+	path := c.path(c.CRL.Path)
+	if path == "" && c.Storage.Path != "" {
+		path = filepath.Join(c.path(c.Storage.Path), "crl.pem")
+	}
+	if path == "" {
+		return nil, errors.New("crl path is not set")
+	}
+	var holder easyrsa.CRLHolder = easyrsa.NewFileCRLHolder(path)
+	if c.CRL.CacheTTL > 0 {
+		holder = easyrsa.NewCachingCRLHolder(holder, time.Duration(c.CRL.CacheTTL))
+	}
+	return holder, nil
+}
+
+func field(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+// subject return subject template, set fields override ones of vars
+func (c *Config) subject(vars *easyrsa.Vars) pkix.Name {
+	var name pkix.Name
+	if vars != nil {
+		name = vars.Subject
+	}
+	for _, f := range []struct {
+		dst   *[]string
+		value string
+	}{
+		{&name.Country, c.Subject.Country},
+		{&name.Province, c.Subject.Province},
+		{&name.Locality, c.Subject.Locality},
+		{&name.Organization, c.Subject.Organization},
+		{&name.OrganizationalUnit, c.Subject.OrganizationalUnit},
+	} {
+		if f.value != "" {
+			*f.dst = field(f.value)
+		}
+	}
+	return name
+}
+
+// Options return PKI options of config
+func (c *Config) Options() ([]easyrsa.Option, error) {
+	opts, _, err := c.options()
+	return opts, err
+}
+
+func (c *Config) options() ([]easyrsa.Option, *easyrsa.Vars, error) {
+	var opts []easyrsa.Option
+	var vars *easyrsa.Vars
+	if c.Vars != "" {
+		data, err := ioutil.ReadFile(c.path(c.Vars))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "can`t read vars")
+		}
+		if vars, err = easyrsa.ParseVars(data); err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, vars.Options()...)
+	}
+	if c.KeySize > 0 {
+		opts = append(opts, easyrsa.WithKeySize(c.KeySize))
+	}
+	if c.CAValidity > 0 || c.CertValidity > 0 {
+		ca, cert := time.Duration(c.CAValidity), time.Duration(c.CertValidity)
+		if vars != nil && ca == 0 {
+			ca = vars.CAValidity
+		}
+		if vars != nil && cert == 0 {
+			cert = vars.CertValidity
+		}
+		opts = append(opts, easyrsa.WithValidity(ca, cert))
+	}
+	if c.StrictValidity {
+		opts = append(opts, easyrsa.WithStrictValidity())
+	}
+	if c.WithoutKeyRetention {
+		opts = append(opts, easyrsa.WithoutKeyRetention())
+	}
+	if c.FIPS {
+		opts = append(opts, easyrsa.WithFIPSMode())
+	}
+	if c.RSAPSS {
+		opts = append(opts, easyrsa.WithRSAPSS())
+	}
+	if c.DuplicateCN != "" {
+		policies := map[string]easyrsa.DuplicateCNPolicy{
+			"allow": easyrsa.DuplicateCNAllow, "supersede": easyrsa.DuplicateCNSupersede, "reject": easyrsa.DuplicateCNReject,
+		}
+		policy, ok := policies[c.DuplicateCN]
+		if !ok {
+			return nil, nil, errors.Errorf("unknown duplicate cn policy %q", c.DuplicateCN)
+		}
+		opts = append(opts, easyrsa.WithDuplicateCNPolicy(policy))
+	}
+	if c.RotationOverlap > 0 {
+		opts = append(opts, easyrsa.WithRotationOverlap(time.Duration(c.RotationOverlap)))
+	}
+	if c.IdempotencyWindow > 0 {
+		opts = append(opts, easyrsa.WithIdempotencyWindow(time.Duration(c.IdempotencyWindow)))
+	}
+	profiles, err := c.profiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(profiles) > 0 {
+		opts = append(opts, easyrsa.WithProfiles(profiles...))
+	}
+	if c.CSRPolicy != nil {
+		policy, err := c.csrPolicy()
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, easyrsa.WithCSRPolicy(policy))
+	}
+	if c.CRLFailure != nil {
+		modes := map[string]easyrsa.CRLFailureMode{
+			"open": easyrsa.CRLFailOpen, "closed": easyrsa.CRLFailClosed, "cached": easyrsa.CRLUseCached,
+		}
+		mode, ok := modes[c.CRLFailure.Mode]
+		if !ok {
+			return nil, nil, errors.Errorf("unknown crl failure mode %q", c.CRLFailure.Mode)
+		}
+		opts = append(opts, easyrsa.WithCRLFailurePolicy(&easyrsa.CRLFailurePolicy{
+			Mode: mode, MaxStaleness: time.Duration(c.CRLFailure.MaxStaleness),
+		}))
+	}
+	if c.TrustedTime != nil {
+		policy, err := c.trustedTime()
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, easyrsa.WithTrustedTime(policy))
+	}
+	return opts, vars, nil
+}
+
+func (c *Config) profiles() ([]*easyrsa.Profile, error) {
+	var res []*easyrsa.Profile
+	for _, imp := range c.OpenSSLProfiles {
+		data, err := ioutil.ReadFile(c.path(imp.File))
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t read openssl config")
+		}
+		profiles, err := easyrsa.ImportOpenSSLProfiles(data, imp.Sections...)
+		if err != nil {
+			return nil, errors.Wrap(err, imp.File)
+		}
+		res = append(res, profiles...)
+	}
+	for _, p := range c.Profiles {
+		if p.Name == "" {
+			return nil, errors.New("profile without name")
+		}
+		profile := &easyrsa.Profile{
+			Name:                  p.Name,
+			Validity:              time.Duration(p.Validity),
+			IsCA:                  p.IsCA,
+			DNSNames:              p.DNSNames,
+			CRLDistributionPoints: p.CRLDistributionPoints,
+			OCSPServer:            p.OCSPServer,
+			IssuingCertificateURL: p.IssuingCertificateURL,
+		}
+		if p.MaxPathLen != nil {
+			profile.MaxPathLen = *p.MaxPathLen
+			profile.MaxPathLenZero = *p.MaxPathLen == 0
+		}
+		for _, name := range p.KeyUsage {
+			usage, ok := easyrsa.KeyUsageByName(name)
+			if !ok {
+				return nil, errors.Errorf("profile %s: unknown key usage %q", p.Name, name)
+			}
+			profile.KeyUsage |= usage
+		}
+		for _, name := range p.ExtKeyUsage {
+			usage, ok := easyrsa.ExtKeyUsageByName(name)
+			if !ok {
+				return nil, errors.Errorf("profile %s: unknown extended key usage %q", p.Name, name)
+			}
+			profile.ExtKeyUsage = append(profile.ExtKeyUsage, usage)
+		}
+		if profile.IsCA && profile.KeyUsage == 0 {
+			profile.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		}
+		res = append(res, profile)
+	}
+	return res, nil
+}
+
+func findingAction(name string) (easyrsa.KeyFindingAction, error) {
+	switch name {
+	case "", "allow":
+		return easyrsa.KeyFindingAllow, nil
+	case "warn":
+		return easyrsa.KeyFindingWarn, nil
+	case "reject":
+		return easyrsa.KeyFindingReject, nil
+	}
+	return 0, errors.Errorf("unknown key finding action %q", name)
+}
+
+func (c *Config) csrPolicy() (*easyrsa.CSRPolicy, error) {
+	cp := c.CSRPolicy
+	policy := &easyrsa.CSRPolicy{
+		MinRSABits:       cp.MinRSABits,
+		MinECBits:        cp.MinECBits,
+		RejectReusedKeys: cp.RejectReusedKeys,
+		RequireChallenge: cp.RequireChallenge,
+		ChallengeTTL:     time.Duration(cp.ChallengeTTL),
+	}
+	var err error
+	if policy.ReusedKeys, err = findingAction(cp.ReusedKeys); err != nil {
+		return nil, err
+	}
+	if policy.ROCAKeys, err = findingAction(cp.ROCAKeys); err != nil {
+		return nil, err
+	}
+	for _, path := range cp.WeakKeys {
+		file, err := os.Open(c.path(path))
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t open weak keys")
+		}
+		policy.WeakKeys, err = easyrsa.LoadWeakKeys(file, policy.WeakKeys)
+		_ = file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+func (c *Config) trustedTime() (*easyrsa.TrustedTimePolicy, error) {
+	tt := c.TrustedTime
+	policy := &easyrsa.TrustedTimePolicy{
+		Quorum:   tt.Quorum,
+		MaxSkew:  time.Duration(tt.MaxSkew),
+		Interval: time.Duration(tt.Interval),
+		Timeout:  time.Duration(tt.Timeout),
+	}
+	for _, addr := range tt.NTP {
+		policy.Sources = append(policy.Sources, easyrsa.NewNTPTimeSource(addr))
+	}
+	for _, server := range tt.Roughtime {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(server.PublicKey))
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, errors.Errorf("wrong roughtime public key of %s", server.Addr)
+		}
+		policy.Sources = append(policy.Sources, easyrsa.NewRoughtimeSource(server.Addr, key))
+	}
+	return policy, nil
+}
+
+// Build return PKI wired as configured
+func (c *Config) Build() (*easyrsa.PKI, error) {
+	storage, err := c.KeyStorage()
+	if err != nil {
+		return nil, err
+	}
+	sp, err := c.SerialProvider()
+	if err != nil {
+		return nil, err
+	}
+	holder, err := c.CRLHolder()
+	if err != nil {
+		return nil, err
+	}
+	opts, vars, err := c.options()
+	if err != nil {
+		return nil, err
+	}
+	return easyrsa.NewPKI(storage, sp, holder, c.subject(vars), opts...), nil
+}
@@ -0,0 +1,327 @@
+// Package config build wired easyrsa PKI from YAML, TOML or JSON file and env vars,
+// so applications don`t duplicate storage, serial, CRL and policy wiring
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix is a prefix of env vars read by Load
+const DefaultEnvPrefix = "EASYRSA"
+
+// Config describe PKI of one environment. Relative paths are resolved against config file dir
+type Config struct {
+	Storage             Storage          `yaml:"storage" toml:"storage" json:"storage"`
+	Serial              Serial           `yaml:"serial" toml:"serial" json:"serial"`
+	CRL                 CRL              `yaml:"crl" toml:"crl" json:"crl"`
+	Subject             Subject          `yaml:"subject" toml:"subject" json:"subject"`
+	Vars                string           `yaml:"vars" toml:"vars" json:"vars"`                                                    // easy-rsa vars file, applied before other settings
+	KeySize             int              `yaml:"key_size" toml:"key_size" json:"key_size"`                                        // RSA key size of generated keys
+	CAValidity          Duration         `yaml:"ca_validity" toml:"ca_validity" json:"ca_validity"`                               // CA lifetime
+	CertValidity        Duration         `yaml:"cert_validity" toml:"cert_validity" json:"cert_validity"`                         // leaf lifetime
+	StrictValidity      bool             `yaml:"strict_validity" toml:"strict_validity" json:"strict_validity"`                   // refuse certs outliving CA
+	WithoutKeyRetention bool             `yaml:"without_key_retention" toml:"without_key_retention" json:"without_key_retention"` // don`t store generated leaf keys
+	FIPS                bool             `yaml:"fips" toml:"fips" json:"fips"`                                                    // FIPS mode
+	RSAPSS              bool             `yaml:"rsa_pss" toml:"rsa_pss" json:"rsa_pss"`                                           // sign certs and CRLs with RSASSA-PSS
+	DuplicateCN         string           `yaml:"duplicate_cn" toml:"duplicate_cn" json:"duplicate_cn"`                            // allow (default), supersede or reject certs for CN with active cert
+	RotationOverlap     Duration         `yaml:"rotation_overlap" toml:"rotation_overlap" json:"rotation_overlap"`                // CA rotation overlap
+	IdempotencyWindow   Duration         `yaml:"idempotency_window" toml:"idempotency_window" json:"idempotency_window"`          // replay window of idempotency keys
+	OpenSSLProfiles     []OpenSSLProfile `yaml:"openssl_profiles" toml:"openssl_profiles" json:"openssl_profiles"`                // profiles imported from openssl.cnf
+	Profiles            []Profile        `yaml:"profiles" toml:"profiles" json:"profiles"`
+	CSRPolicy           *CSRPolicy       `yaml:"csr_policy" toml:"csr_policy" json:"csr_policy"`
+	CRLFailure          *CRLFailure      `yaml:"crl_failure" toml:"crl_failure" json:"crl_failure"`
+	TrustedTime         *TrustedTime     `yaml:"trusted_time" toml:"trusted_time" json:"trusted_time"`
+
+	dir string // dir of config file
+}
+
+// Storage select KeyStorage backend
+type Storage struct {
+	Type      string   `yaml:"type" toml:"type" json:"type"`                   // dir, the only backend now, default
+	Path      string   `yaml:"path" toml:"path" json:"path"`                   // key dir
+	Umask     string   `yaml:"umask" toml:"umask" json:"umask"`                // octal umask of written files, e.g. 0077
+	CacheSize int      `yaml:"cache_size" toml:"cache_size" json:"cache_size"` // entries of CachingKeyStorage, no cache if zero and no ttl
+	CacheTTL  Duration `yaml:"cache_ttl" toml:"cache_ttl" json:"cache_ttl"`    // entry lifetime of CachingKeyStorage
+}
+
+// Serial select SerialProvider
+type Serial struct {
+	Type    string `yaml:"type" toml:"type" json:"type"`          // file (default), journal, uuid or uuid7
+	Path    string `yaml:"path" toml:"path" json:"path"`          // serial file, <storage path>/serial if empty
+	Reserve int    `yaml:"reserve" toml:"reserve" json:"reserve"` // serials per reservation of ReservingSerialProvider, not used if zero
+}
+
+// CRL configure FileCRLHolder
+type CRL struct {
+	Path     string   `yaml:"path" toml:"path" json:"path"`                // crl file, <storage path>/crl.pem if empty
+	CacheTTL Duration `yaml:"cache_ttl" toml:"cache_ttl" json:"cache_ttl"` // lifetime of CachingCRLHolder, no cache if zero
+}
+
+// Subject is a subject template of issued certs
+type Subject struct {
+	Country            string `yaml:"country" toml:"country" json:"country"`
+	Province           string `yaml:"province" toml:"province" json:"province"`
+	Locality           string `yaml:"locality" toml:"locality" json:"locality"`
+	Organization       string `yaml:"organization" toml:"organization" json:"organization"`
+	OrganizationalUnit string `yaml:"organizational_unit" toml:"organizational_unit" json:"organizational_unit"`
+}
+
+// OpenSSLProfile import extension sections of openssl.cnf as profiles
+type OpenSSLProfile struct {
+	File     string   `yaml:"file" toml:"file" json:"file"`
+	Sections []string `yaml:"sections" toml:"sections" json:"sections"` // all extension sections if empty
+}
+
+// Profile describe easyrsa.Profile, usages are openssl names, e.g. digitalSignature or serverAuth
+type Profile struct {
+	Name                  string   `yaml:"name" toml:"name" json:"name"`
+	Validity              Duration `yaml:"validity" toml:"validity" json:"validity"`
+	IsCA                  bool     `yaml:"is_ca" toml:"is_ca" json:"is_ca"`
+	MaxPathLen            *int     `yaml:"max_path_len" toml:"max_path_len" json:"max_path_len"`
+	KeyUsage              []string `yaml:"key_usage" toml:"key_usage" json:"key_usage"`
+	ExtKeyUsage           []string `yaml:"ext_key_usage" toml:"ext_key_usage" json:"ext_key_usage"`
+	DNSNames              []string `yaml:"dns_names" toml:"dns_names" json:"dns_names"`
+	CRLDistributionPoints []string `yaml:"crl_distribution_points" toml:"crl_distribution_points" json:"crl_distribution_points"`
+	OCSPServer            []string `yaml:"ocsp_server" toml:"ocsp_server" json:"ocsp_server"`
+	IssuingCertificateURL []string `yaml:"issuing_certificate_url" toml:"issuing_certificate_url" json:"issuing_certificate_url"`
+}
+
+// CSRPolicy describe easyrsa.CSRPolicy, actions are allow, warn or reject
+type CSRPolicy struct {
+	MinRSABits       int      `yaml:"min_rsa_bits" toml:"min_rsa_bits" json:"min_rsa_bits"`
+	MinECBits        int      `yaml:"min_ec_bits" toml:"min_ec_bits" json:"min_ec_bits"`
+	WeakKeys         []string `yaml:"weak_keys" toml:"weak_keys" json:"weak_keys"` // openssl-blacklist files
+	RejectReusedKeys bool     `yaml:"reject_reused_keys" toml:"reject_reused_keys" json:"reject_reused_keys"`
+	ReusedKeys       string   `yaml:"reused_keys" toml:"reused_keys" json:"reused_keys"`
+	ROCAKeys         string   `yaml:"roca_keys" toml:"roca_keys" json:"roca_keys"`
+	RequireChallenge bool     `yaml:"require_challenge" toml:"require_challenge" json:"require_challenge"`
+	ChallengeTTL     Duration `yaml:"challenge_ttl" toml:"challenge_ttl" json:"challenge_ttl"`
+}
+
+// CRLFailure describe easyrsa.CRLFailurePolicy
+type CRLFailure struct {
+	Mode         string   `yaml:"mode" toml:"mode" json:"mode"` // open, closed or cached
+	MaxStaleness Duration `yaml:"max_staleness" toml:"max_staleness" json:"max_staleness"`
+}
+
+// TrustedTime describe easyrsa.TrustedTimePolicy
+type TrustedTime struct {
+	NTP       []string          `yaml:"ntp" toml:"ntp" json:"ntp"` // NTP server addresses
+	Roughtime []RoughtimeServer `yaml:"roughtime" toml:"roughtime" json:"roughtime"`
+	Quorum    int               `yaml:"quorum" toml:"quorum" json:"quorum"`
+	MaxSkew   Duration          `yaml:"max_skew" toml:"max_skew" json:"max_skew"`
+	Interval  Duration          `yaml:"interval" toml:"interval" json:"interval"`
+	Timeout   Duration          `yaml:"timeout" toml:"timeout" json:"timeout"`
+}
+
+// RoughtimeServer is a roughtime server with base64 encoded ed25519 long term key
+type RoughtimeServer struct {
+	Addr      string `yaml:"addr" toml:"addr" json:"addr"`
+	PublicKey string `yaml:"public_key" toml:"public_key" json:"public_key"`
+}
+
+// Duration is time.Duration parsed from Go duration string, d suffix is accepted for days, e.g. 3650d
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return errors.Errorf("wrong duration %q", s)
+		}
+		*d = Duration(time.Duration(days) * 24 * time.Hour)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.Errorf("wrong duration %q", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Parse decode config in format yaml, toml or json
+func Parse(data []byte, format string) (*Config, error) {
+	cfg := &Config{}
+	var err error
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(cfg); err == io.EOF {
+			err = nil
+		}
+	case "toml":
+		var meta toml.MetaData
+		meta, err = toml.Decode(string(data), cfg)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = errors.Errorf("unknown key %s", meta.Undecoded()[0])
+		}
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	default:
+		return nil, errors.Errorf("unknown config format %q", format)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "can`t parse %s config", format)
+	}
+	return cfg, nil
+}
+
+// LoadFile read config file, format is selected by extension
+func LoadFile(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t read config")
+	}
+	cfg, err := Parse(data, strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	abs, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t resolve config dir")
+	}
+	cfg.dir = abs
+	return cfg, nil
+}
+
+// Load read config file, if path is not empty, and apply env vars with DefaultEnvPrefix over it
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	if path != "" {
+		var err error
+		if cfg, err = LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.ApplyEnv(DefaultEnvPrefix, os.Environ()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ApplyEnv override scalar settings with env vars named by prefix and upper cased keys joined by underscore,
+// e.g. EASYRSA_STORAGE_PATH or EASYRSA_CSR_POLICY_MIN_RSA_BITS. Lists are comma separated,
+// lists of tables, e.g. profiles, can be set in file only
+func (c *Config) ApplyEnv(prefix string, environ []string) error {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if idx := strings.IndexByte(kv, '='); idx > 0 {
+			env[kv[:idx]] = kv[idx+1:]
+		}
+	}
+	return applyEnv(reflect.ValueOf(c).Elem(), prefix, env)
+}
+
+var textUnmarshaler = reflect.TypeOf((*interface{ UnmarshalText([]byte) error })(nil)).Elem()
+
+func applyEnv(v reflect.Value, prefix string, env map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if field.PkgPath != "" || key == "" || key == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+		fv := v.Field(i)
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+			// allocate section only if any of it`s vars is set
+			if fv.IsNil() {
+				if !hasPrefix(env, name+"_") {
+					continue
+				}
+				fv.Set(reflect.New(ft.Elem()))
+			}
+			fv = fv.Elem()
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && !reflect.PtrTo(ft).Implements(textUnmarshaler) {
+			if err := applyEnv(fv, name, env); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := env[name]
+		if !ok {
+			continue
+		}
+		if err := setValue(fv, value); err != nil {
+			return errors.Wrapf(err, "wrong %s", name)
+		}
+	}
+	return nil
+}
+
+func hasPrefix(env map[string]string, prefix string) bool {
+	for key := range env {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func setValue(v reflect.Value, value string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshaler) {
+		return v.Addr().Interface().(interface{ UnmarshalText([]byte) error }).UnmarshalText([]byte(value))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return errors.New("can be set in config file only")
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return errors.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
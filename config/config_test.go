@@ -0,0 +1,153 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/productsupcom/go-easyrsa"
+	"github.com/stretchr/testify/assert"
+)
+
+const testYAML = `
+storage:
+  path: keys
+  cache_size: 16
+  cache_ttl: 1m
+serial:
+  reserve: 4
+subject:
+  organization: Example
+key_size: 1024
+cert_validity: 30d
+profiles:
+  - name: web
+    validity: 24h
+    key_usage: [digitalSignature, keyEncipherment]
+    ext_key_usage: [serverAuth]
+csr_policy:
+  min_rsa_bits: 1024
+  reused_keys: reject
+crl_failure:
+  mode: cached
+  max_staleness: 1h
+`
+
+const testTOML = `
+key_size = 1024
+cert_validity = "30d"
+
+[storage]
+path = "keys"
+cache_size = 16
+cache_ttl = "1m"
+
+[serial]
+reserve = 4
+
+[subject]
+organization = "Example"
+
+[[profiles]]
+name = "web"
+validity = "24h"
+key_usage = ["digitalSignature", "keyEncipherment"]
+ext_key_usage = ["serverAuth"]
+
+[csr_policy]
+min_rsa_bits = 1024
+reused_keys = "reject"
+
+[crl_failure]
+mode = "cached"
+max_staleness = "1h"
+`
+
+const testJSON = `{
+  "storage": {"path": "keys", "cache_size": 16, "cache_ttl": "1m"},
+  "serial": {"reserve": 4},
+  "subject": {"organization": "Example"},
+  "key_size": 1024,
+  "cert_validity": "30d",
+  "profiles": [{"name": "web", "validity": "24h", "key_usage": ["digitalSignature", "keyEncipherment"], "ext_key_usage": ["serverAuth"]}],
+  "csr_policy": {"min_rsa_bits": 1024, "reused_keys": "reject"},
+  "crl_failure": {"mode": "cached", "max_staleness": "1h"}
+}`
+
+func TestParse(t *testing.T) {
+	var want *Config
+	for _, tt := range []struct{ format, data string }{{"yaml", testYAML}, {"toml", testTOML}, {"json", testJSON}} {
+		t.Run(tt.format, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.data), tt.format)
+			assert.NoError(t, err)
+			assert.Equal(t, Duration(30*24*time.Hour), cfg.CertValidity)
+			assert.Equal(t, "web", cfg.Profiles[0].Name)
+			assert.Equal(t, "cached", cfg.CRLFailure.Mode)
+			if want == nil {
+				want = cfg
+			}
+			assert.Equal(t, want, cfg)
+		})
+	}
+	_, err := Parse([]byte("key_sise: 1024"), "yaml")
+	assert.Error(t, err)
+	_, err = Parse(nil, "ini")
+	assert.Error(t, err)
+}
+
+func TestConfig_ApplyEnv(t *testing.T) {
+	cfg, err := Parse([]byte(testYAML), "yaml")
+	assert.NoError(t, err)
+	err = cfg.ApplyEnv("EASYRSA", []string{
+		"EASYRSA_STORAGE_PATH=/var/lib/pki",
+		"EASYRSA_KEY_SIZE=2048",
+		"EASYRSA_CA_VALIDITY=3650d",
+		"EASYRSA_CSR_POLICY_REQUIRE_CHALLENGE=true",
+		"EASYRSA_TRUSTED_TIME_NTP=pool.ntp.org, time.example.com",
+		"OTHER_KEY_SIZE=4096",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/lib/pki", cfg.Storage.Path)
+	assert.Equal(t, 2048, cfg.KeySize)
+	assert.Equal(t, Duration(3650*24*time.Hour), cfg.CAValidity)
+	assert.True(t, cfg.CSRPolicy.RequireChallenge)
+	assert.Equal(t, []string{"pool.ntp.org", "time.example.com"}, cfg.TrustedTime.NTP)
+	assert.Nil(t, (&Config{}).CRLFailure)
+
+	assert.Error(t, cfg.ApplyEnv("EASYRSA", []string{"EASYRSA_KEY_SIZE=big"}))
+	assert.Error(t, cfg.ApplyEnv("EASYRSA", []string{"EASYRSA_PROFILES=web"}))
+}
+
+func TestConfig_Build(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pki.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(testYAML), 0600))
+	t.Setenv("EASYRSA_SERIAL_TYPE", "journal")
+	cfg, err := Load(path)
+	assert.NoError(t, err)
+	pki, err := cfg.Build()
+	assert.NoError(t, err)
+
+	_, err = pki.NewCa()
+	assert.NoError(t, err)
+	pair, err := pki.NewCertWithProfile("www.example.com", "web")
+	assert.NoError(t, err)
+	_, cert, err := pair.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Example"}, cert.Subject.Organization)
+	assert.True(t, cert.NotAfter.Sub(cert.NotBefore) <= 25*time.Hour)
+
+	_, ok := pki.Storage.(*easyrsa.CachingKeyStorage)
+	assert.True(t, ok)
+	stored, err := easyrsa.NewDirKeyStorage(filepath.Join(dir, "keys")).GetLastByCn("www.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, pair.Serial, stored.Serial)
+
+	_, err = (&Config{}).Build()
+	assert.Error(t, err)
+	_, err = (&Config{Storage: Storage{Path: dir}, Profiles: []Profile{{Name: "x", KeyUsage: []string{"signAll"}}}}).Build()
+	assert.Error(t, err)
+	_, err = (&Config{Storage: Storage{Path: dir}, DuplicateCN: "replace"}).Build()
+	assert.Error(t, err)
+}
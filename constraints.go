@@ -0,0 +1,142 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NameConstraints is a nameConstraints extension of CA certs. DNS and URI domain "example.com" match
+// the domain and its subdomains, ".example.com" match subdomains only. Email constraint is a mailbox,
+// domain or ".domain"
+type NameConstraints struct {
+	Critical                bool         // extension is critical, as RFC 5280 require
+	PermittedDNSDomains     []string     // permitted dns names
+	ExcludedDNSDomains      []string     // excluded dns names
+	PermittedIPRanges       []*net.IPNet // permitted ip ranges
+	ExcludedIPRanges        []*net.IPNet // excluded ip ranges
+	PermittedEmailAddresses []string     // permitted emails
+	ExcludedEmailAddresses  []string     // excluded emails
+	PermittedURIDomains     []string     // permitted uri hosts
+	ExcludedURIDomains      []string     // excluded uri hosts
+}
+
+// WithCAConstraints set basicConstraints pathlen and nameConstraints of CAs created by NewCa and NewSealedCa.
+// Negative maxPathLen is unlimited, 0 forbid sub CAs. names may be nil
+func WithCAConstraints(maxPathLen int, names *NameConstraints) Option {
+	return func(p *PKI) {
+		p.caMaxPathLen = &maxPathLen
+		p.caNameConstraints = names
+	}
+}
+
+// apply set constraints to CA template
+func (c *NameConstraints) apply(tml *x509.Certificate) {
+	if c == nil {
+		return
+	}
+	tml.PermittedDNSDomainsCritical = c.Critical
+	tml.PermittedDNSDomains = append([]string{}, c.PermittedDNSDomains...)
+	tml.ExcludedDNSDomains = append([]string{}, c.ExcludedDNSDomains...)
+	tml.PermittedIPRanges = append([]*net.IPNet{}, c.PermittedIPRanges...)
+	tml.ExcludedIPRanges = append([]*net.IPNet{}, c.ExcludedIPRanges...)
+	tml.PermittedEmailAddresses = append([]string{}, c.PermittedEmailAddresses...)
+	tml.ExcludedEmailAddresses = append([]string{}, c.ExcludedEmailAddresses...)
+	tml.PermittedURIDomains = append([]string{}, c.PermittedURIDomains...)
+	tml.ExcludedURIDomains = append([]string{}, c.ExcludedURIDomains...)
+}
+
+// applyPathLen set basicConstraints pathlen to CA template, negative is unlimited
+func applyPathLen(tml *x509.Certificate, maxPathLen int) {
+	if maxPathLen < 0 {
+		tml.MaxPathLen, tml.MaxPathLenZero = -1, false
+		return
+	}
+	tml.MaxPathLen, tml.MaxPathLenZero = maxPathLen, maxPathLen == 0
+}
+
+// checkCAConstraints return PolicyViolation if template is sub CA of pathlen:0 issuer or it`s names are
+// out of issuer nameConstraints, so constrained CA never issue certs that fail verification
+func checkCAConstraints(tml *x509.Certificate, issuer *x509.Certificate) error {
+	if tml.IsCA && issuer.MaxPathLen == 0 && issuer.MaxPathLenZero {
+		return errors.WithStack(NewPolicyViolation("ca pathlen:0 does not permit sub ca"))
+	}
+	violation := func(kind, name string) error {
+		return errors.WithStack(NewPolicyViolation(fmt.Sprintf("%s %s is not permitted by ca name constraints", kind, name)))
+	}
+	for _, name := range tml.DNSNames {
+		if !constraintsAllow(name, issuer.PermittedDNSDomains, issuer.ExcludedDNSDomains, matchDomainConstraint) {
+			return violation("dns name", name)
+		}
+	}
+	for _, email := range tml.EmailAddresses {
+		if !constraintsAllow(email, issuer.PermittedEmailAddresses, issuer.ExcludedEmailAddresses, matchEmailConstraint) {
+			return violation("email", email)
+		}
+	}
+	for _, uri := range tml.URIs {
+		if !constraintsAllow(uri.Hostname(), issuer.PermittedURIDomains, issuer.ExcludedURIDomains, matchDomainConstraint) {
+			return violation("uri", uri.String())
+		}
+	}
+	for _, ip := range tml.IPAddresses {
+		permitted := len(issuer.PermittedIPRanges) == 0
+		for _, ipRange := range issuer.PermittedIPRanges {
+			permitted = permitted || ipRange.Contains(ip)
+		}
+		for _, ipRange := range issuer.ExcludedIPRanges {
+			permitted = permitted && !ipRange.Contains(ip)
+		}
+		if !permitted {
+			return violation("ip", ip.String())
+		}
+	}
+	return nil
+}
+
+func constraintsAllow(name string, permitted, excluded []string, match func(name, constraint string) bool) bool {
+	for _, constraint := range excluded {
+		if match(name, constraint) {
+			return false
+		}
+	}
+	if len(permitted) == 0 {
+		return true
+	}
+	for _, constraint := range permitted {
+		if match(name, constraint) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchDomainConstraint(name, constraint string) bool {
+	name, constraint = strings.ToLower(strings.TrimSuffix(name, ".")), strings.ToLower(constraint)
+	if constraint == "" {
+		return true
+	}
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(name, constraint)
+	}
+	return name == constraint || strings.HasSuffix(name, "."+constraint)
+}
+
+func matchEmailConstraint(email, constraint string) bool {
+	if strings.Contains(constraint, "@") {
+		return strings.EqualFold(email, constraint)
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	constraint = strings.ToLower(constraint)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(domain, constraint)
+	}
+	return domain == constraint
+}
@@ -0,0 +1,75 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_CAConstraints(t *testing.T) {
+	names := &NameConstraints{Critical: true, PermittedDNSDomains: []string{"pki.local"}, ExcludedDNSDomains: []string{"secret.pki.local"}}
+	sub := &Profile{
+		Name:            "sub",
+		IsCA:            true,
+		MaxPathLenZero:  true,
+		KeyUsage:        x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		NameConstraints: &NameConstraints{PermittedDNSDomains: []string{"web.pki.local"}},
+	}
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithCAConstraints(1, names), WithProfiles(sub))
+	defer cleanup()
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+	_, caCert, err := ca.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, caCert.MaxPathLen)
+	assert.True(t, caCert.PermittedDNSDomainsCritical)
+	assert.Equal(t, []string{"pki.local"}, caCert.PermittedDNSDomains)
+	assert.Equal(t, []string{"secret.pki.local"}, caCert.ExcludedDNSDomains)
+
+	leaf, err := pki.NewCert("api.pki.local", true, nil)
+	assert.NoError(t, err)
+	cert, err := decodeCert(leaf.CertPemBytes)
+	assert.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, CurrentTime: pki.now()})
+	assert.NoError(t, err)
+
+	_, err = pki.NewCert("evil.com", true, nil)
+	assert.True(t, isPolicyViolation(err))
+	_, err = pki.NewCert("db.secret.pki.local", true, nil)
+	assert.True(t, isPolicyViolation(err))
+
+	subPair, err := pki.NewCertWithProfile("sub.pki.local", "sub")
+	assert.NoError(t, err)
+	subCert, err := decodeCert(subPair.CertPemBytes)
+	assert.NoError(t, err)
+	assert.True(t, subCert.MaxPathLenZero)
+	assert.Equal(t, []string{"web.pki.local"}, subCert.PermittedDNSDomains)
+}
+
+func TestPKI_CAPathLenZero(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithCAConstraints(0, nil),
+		WithProfiles(&Profile{Name: "sub", IsCA: true, KeyUsage: x509.KeyUsageCertSign}))
+	defer cleanup()
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+	_, caCert, err := ca.Decode()
+	assert.NoError(t, err)
+	assert.True(t, caCert.MaxPathLenZero)
+	_, err = pki.NewCertWithProfile("sub.pki.local", "sub")
+	assert.True(t, isPolicyViolation(err))
+	_, err = pki.NewCert("anything", true, nil)
+	assert.NoError(t, err)
+}
+
+func TestMatchConstraints(t *testing.T) {
+	assert.True(t, matchDomainConstraint("pki.local", "pki.local"))
+	assert.True(t, matchDomainConstraint("a.pki.local.", "PKI.local"))
+	assert.False(t, matchDomainConstraint("pki.local", ".pki.local"))
+	assert.False(t, matchDomainConstraint("evilpki.local", "pki.local"))
+	assert.True(t, matchEmailConstraint("alice@pki.local", "pki.local"))
+	assert.True(t, matchEmailConstraint("alice@mail.pki.local", ".pki.local"))
+	assert.False(t, matchEmailConstraint("bob@pki.local", "alice@pki.local"))
+}
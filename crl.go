@@ -0,0 +1,105 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// VerifyCRL check that crl is issued and signed by ca
+func VerifyCRL(crl *pkix.CertificateList, ca *x509.Certificate) error {
+	issuer, err := asn1.Marshal(crl.TBSCertList.Issuer)
+	if err != nil {
+		return errors.Wrap(err, "can`t encode crl issuer")
+	}
+	if !bytes.Equal(issuer, ca.RawSubject) {
+		return errors.New("crl issuer does not match ca subject")
+	}
+	if ca.KeyUsage != 0 && ca.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return errors.New("ca is not allowed to sign crl")
+	}
+	//nolint:staticcheck // pkix.CertificateList is still returned by CRLHolder
+	if err := ca.CheckCRLSignature(crl); err != nil {
+		return errors.Wrap(err, "wrong crl signature")
+	}
+	return nil
+}
+
+// verifyCRL check that crl is signed by one of stored CAs or their CRL signers, resolved by authority key id
+func (p *PKI) verifyCRL(crl *pkix.CertificateList) error {
+	cas, _, err := p.caCerts()
+	if err != nil {
+		return err
+	}
+	signers, err := p.crlSignerCerts(cas, crl)
+	if err != nil {
+		return err
+	}
+	signer := resolveIssuer(crlAuthorityKeyID(crl), append(cas, signers...), func(ca *x509.Certificate) bool {
+		return VerifyCRL(crl, ca) == nil
+	})
+	if signer == nil {
+		return errors.New("crl is not signed by stored ca")
+	}
+	return nil
+}
+
+var (
+	oidAuthorityKeyIdentifier = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidCRLNumber              = asn1.ObjectIdentifier{2, 5, 29, 20}
+)
+
+// crlNumber return value of CRL number extension, nil if absent
+func crlNumber(crl *pkix.CertificateList) *big.Int {
+	for _, ext := range crl.TBSCertList.Extensions {
+		if !ext.Id.Equal(oidCRLNumber) {
+			continue
+		}
+		number := new(big.Int)
+		if _, err := asn1.Unmarshal(ext.Value, &number); err == nil {
+			return number
+		}
+	}
+	return nil
+}
+
+// crlAuthorityKeyID return key id of authority key identifier extension, nil if absent
+func crlAuthorityKeyID(crl *pkix.CertificateList) []byte {
+	for _, ext := range crl.TBSCertList.Extensions {
+		if !ext.Id.Equal(oidAuthorityKeyIdentifier) {
+			continue
+		}
+		var aki struct {
+			ID []byte `asn1:"optional,tag:0"`
+		}
+		if _, err := asn1.Unmarshal(ext.Value, &aki); err == nil {
+			return aki.ID
+		}
+	}
+	return nil
+}
+
+// GetRevocationList return current CRL verified against the stored CA that signed it.
+// NotExist is returned if no CRL signed yet
+func (p *PKI) GetRevocationList() (*x509.RevocationList, error) {
+	list, err := p.GetCRL()
+	if err != nil {
+		return nil, err
+	}
+	if len(list.SignatureValue.Bytes) == 0 {
+		return nil, errors.WithStack(NewNotExist("crl not exist"))
+	}
+	der, err := asn1.Marshal(*list)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t encode crl")
+	}
+	res, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t parse crl")
+	}
+	return res, nil
+}
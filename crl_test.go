@@ -0,0 +1,88 @@
+package easyrsa
+
+import (
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_GetRevocationList(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	ca, _ := pki.NewCa()
+
+	_, err := pki.GetRevocationList()
+	_, ok := errors.Cause(err).(*NotExist)
+	assert.True(t, ok)
+
+	assert.NoError(t, pki.RevokeOne(big.NewInt(42)))
+	assert.NoError(t, pki.RevokeOne(big.NewInt(43)))
+	list, err := pki.GetRevocationList()
+	assert.NoError(t, err)
+	// RevokedCertificateEntries need go 1.21
+	assert.Len(t, list.RevokedCertificates, 2)                                //nolint:staticcheck
+	assert.Equal(t, big.NewInt(42), list.RevokedCertificates[0].SerialNumber) //nolint:staticcheck
+	_, caCert, _ := ca.Decode()
+	assert.Equal(t, caCert.RawSubject, list.RawIssuer)
+
+	assert.NoError(t, pki.Storage.DeleteBySerial(ca.Serial))
+	_, _ = pki.NewCa()
+	_, err = pki.GetRevocationList()
+	assert.Error(t, err)
+}
+
+func TestVerifyCRL(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	ca, _ := pki.NewCa()
+	_, caCert, _ := ca.Decode()
+	assert.NoError(t, pki.RevokeOne(big.NewInt(42)))
+	list, err := pki.GetCRL()
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyCRL(list, caCert))
+
+	other := getTestPair("ca", 7)
+	_, otherCert, _ := other.Decode()
+	assert.Error(t, VerifyCRL(list, otherCert))
+
+	tampered := *list
+	tampered.TBSCertList.Raw = append([]byte{}, list.TBSCertList.Raw...)
+	tampered.TBSCertList.Raw[len(tampered.TBSCertList.Raw)-1] ^= 0xff
+	assert.Error(t, VerifyCRL(&tampered, caCert))
+
+	t.Run("tampered holder", func(t *testing.T) {
+		crlPem, _ := ioutil.ReadFile(filepath.Join(testData, "crl.pem"))
+		defer func() { _ = pki.crlHolder.Put(crlPem) }()
+		foreign, cleanupForeign := getForeignCRL(t)
+		defer cleanupForeign()
+		assert.NoError(t, pki.crlHolder.Put(foreign))
+		_, err := pki.GetCRL()
+		assert.Error(t, err)
+		assert.Error(t, pki.RevokeOne(big.NewInt(43)))
+		report, err := pki.Audit()
+		assert.NoError(t, err)
+		assert.False(t, report.OK())
+	})
+	assert.True(t, pki.IsRevoked(big.NewInt(42)))
+}
+
+// getForeignCRL return pem CRL signed by unrelated CA
+func getForeignCRL(t *testing.T) ([]byte, func()) {
+	dir := filepath.Join(getTestDir(), "foreign_ca")
+	_ = os.MkdirAll(dir, 0777)
+	other := NewPKI(NewDirKeyStorage(dir), NewFileSerialProvider(filepath.Join(dir, "serial")),
+		NewFileCRLHolder(filepath.Join(dir, "crl.pem")), pkix.Name{})
+	_, err := other.NewCa()
+	assert.NoError(t, err)
+	assert.NoError(t, other.RevokeOne(big.NewInt(1)))
+	crlPem, _ := ioutil.ReadFile(filepath.Join(dir, "crl.pem"))
+	return crlPem, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
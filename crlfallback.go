@@ -0,0 +1,87 @@
+package easyrsa
+
+import (
+	"crypto/x509/pkix"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CRLFailureMode select IsRevoked and Verify behavior when CRL can`t be fetched or verified
+type CRLFailureMode int
+
+const (
+	CRLFailOpen   CRLFailureMode = iota // nothing is revoked, OnFailure get warning
+	CRLFailClosed                       // everything is revoked, Verify fail
+	CRLUseCached                        // last fetched CRL is used while it`s fresh, fail closed otherwise
+)
+
+// CRLFailurePolicy configure degradation on unavailable CRL holder. Without policy IsRevoked fail open
+// silently and Verify fail
+type CRLFailurePolicy struct {
+	Mode         CRLFailureMode
+	MaxStaleness time.Duration   // CRLUseCached age limit of last fetched CRL, it`s NextUpdate is used if zero
+	OnFailure    func(err error) // called on every failure with error describing the applied fallback
+}
+
+// WithCRLFailurePolicy set behavior of IsRevoked and Verify when CRL is unavailable, OCSP responses
+// are never signed without CRL
+func WithCRLFailurePolicy(policy *CRLFailurePolicy) Option {
+	return func(p *PKI) {
+		p.crlFailure = policy
+	}
+}
+
+// lastCRL keep last successfully fetched CRL for CRLUseCached
+type lastCRL struct {
+	mu      sync.Mutex
+	list    *pkix.CertificateList
+	fetched time.Time
+}
+
+func (p *PKI) rememberCRL(list *pkix.CertificateList) {
+	p.lastCRL.mu.Lock()
+	defer p.lastCRL.mu.Unlock()
+	p.lastCRL.list, p.lastCRL.fetched = list, p.now()
+}
+
+// revocationList return CRL for revocation checks or fallback of CRLFailurePolicy. Error mean fail closed
+func (p *PKI) revocationList() (*pkix.CertificateList, error) {
+	list, err := p.GetCRL()
+	if err == nil {
+		return list, nil
+	}
+	policy := p.crlFailure
+	if policy == nil {
+		return nil, err
+	}
+	warn := func(err error) {
+		if policy.OnFailure != nil {
+			policy.OnFailure(err)
+		}
+	}
+	switch policy.Mode {
+	case CRLFailOpen:
+		warn(errors.Wrap(err, "crl is unavailable, revocation is not checked"))
+		return &pkix.CertificateList{}, nil
+	case CRLUseCached:
+		p.lastCRL.mu.Lock()
+		cached, fetched := p.lastCRL.list, p.lastCRL.fetched
+		p.lastCRL.mu.Unlock()
+		now := p.now()
+		fresh := cached != nil
+		if fresh && policy.MaxStaleness > 0 {
+			fresh = now.Sub(fetched) <= policy.MaxStaleness
+		} else if fresh {
+			fresh = !cached.TBSCertList.NextUpdate.IsZero() && now.Before(cached.TBSCertList.NextUpdate)
+		}
+		if fresh {
+			warn(errors.Wrapf(err, "crl is unavailable, using crl fetched at %s", fetched.Format(time.RFC3339)))
+			return cached, nil
+		}
+	}
+	err = errors.Wrap(err, "crl is unavailable")
+	warn(err)
+	return nil, err
+}
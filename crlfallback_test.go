@@ -0,0 +1,84 @@
+package easyrsa
+
+import (
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyCRLHolder fail Get while down
+type flakyCRLHolder struct {
+	CRLHolder
+	down bool
+}
+
+func (h *flakyCRLHolder) Get() (*pkix.CertificateList, error) {
+	if h.down {
+		return nil, errors.New("crl holder is down")
+	}
+	return h.CRLHolder.Get()
+}
+
+func TestPKI_CRLFailurePolicy(t *testing.T) {
+	setup := func(policy *CRLFailurePolicy) (*PKI, *flakyCRLHolder, *X509Pair, *X509Pair, func()) {
+		pki, cleanup := getTmpPki(WithKeySize(1024), WithCRLFailurePolicy(policy))
+		holder := &flakyCRLHolder{CRLHolder: pki.crlHolder}
+		pki.crlHolder = holder
+		_, err := pki.NewCa()
+		assert.NoError(t, err)
+		good, err := pki.NewCert("good", true, nil)
+		assert.NoError(t, err)
+		bad, err := pki.NewCert("bad", true, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, pki.Revoke(bad.Serial, "test", ""))
+		return pki, holder, good, bad, cleanup
+	}
+
+	t.Run("no policy", func(t *testing.T) {
+		pki, holder, good, bad, cleanup := setup(nil)
+		defer cleanup()
+		holder.down = true
+		assert.False(t, pki.IsRevoked(bad.Serial))
+		_, err := pki.Verify(good.CertPemBytes)
+		assert.Error(t, err)
+	})
+
+	t.Run("fail open", func(t *testing.T) {
+		warnings := 0
+		pki, holder, good, bad, cleanup := setup(&CRLFailurePolicy{Mode: CRLFailOpen, OnFailure: func(err error) { warnings++ }})
+		defer cleanup()
+		holder.down = true
+		assert.False(t, pki.IsRevoked(bad.Serial))
+		_, err := pki.Verify(good.CertPemBytes)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, warnings)
+	})
+
+	t.Run("fail closed", func(t *testing.T) {
+		pki, holder, good, _, cleanup := setup(&CRLFailurePolicy{Mode: CRLFailClosed})
+		defer cleanup()
+		assert.False(t, pki.IsRevoked(good.Serial))
+		holder.down = true
+		assert.True(t, pki.IsRevoked(good.Serial))
+		_, err := pki.Verify(good.CertPemBytes)
+		assert.Error(t, err)
+	})
+
+	t.Run("use cached", func(t *testing.T) {
+		pki, holder, good, bad, cleanup := setup(&CRLFailurePolicy{Mode: CRLUseCached, MaxStaleness: time.Hour})
+		defer cleanup()
+		assert.True(t, pki.IsRevoked(bad.Serial))
+		holder.down = true
+		assert.True(t, pki.IsRevoked(bad.Serial))
+		assert.False(t, pki.IsRevoked(good.Serial))
+		_, err := pki.Verify(good.CertPemBytes)
+		assert.NoError(t, err)
+
+		pki.clock = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		defer func() { pki.clock = nil }()
+		assert.True(t, pki.IsRevoked(good.Serial))
+	})
+}
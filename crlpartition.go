@@ -0,0 +1,114 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var oidIssuingDistributionPoint = asn1.ObjectIdentifier{2, 5, 29, 28}
+
+// CRLPartition is one shard of partitioned CRL
+type CRLPartition struct {
+	Index int    // partition index, serial mod number of partitions
+	URL   string // distribution point embedded in certs of this partition
+	PEM   []byte // pem encoded CRL with issuing distribution point extension
+}
+
+// WithCRLPartitions split revocations into partitions by serial mod partitions.
+// urlTemplate is formatted with partition index, e.g. "http://pki.local/crl-%d.crl",
+// and the url is embedded as CRL distribution point in every issued leaf
+func WithCRLPartitions(partitions int, urlTemplate string) Option {
+	return func(p *PKI) {
+		p.crlPartitions = partitions
+		p.crlURLTemplate = urlTemplate
+	}
+}
+
+// crlPartition return partition index of serial
+func (p *PKI) crlPartition(serial *big.Int) int {
+	return int(new(big.Int).Mod(serial, big.NewInt(int64(p.crlPartitions))).Int64())
+}
+
+func (p *PKI) crlPartitionURL(index int) string {
+	return fmt.Sprintf(p.crlURLTemplate, index)
+}
+
+// PartitionedCRLs sign every partition of the current CRL with the newest CA key.
+// Full CRL in the holder stay the source of revocations, partitions should be published to their urls
+func (p *PKI) PartitionedCRLs() ([]*CRLPartition, error) {
+	if p.crlPartitions <= 0 {
+		return nil, errors.New("crl partitions are not configured")
+	}
+	list, err := p.GetCRL()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get current crl")
+	}
+	shards := make([][]pkix.RevokedCertificate, p.crlPartitions)
+	for _, revoked := range removeDups(list.TBSCertList.RevokedCertificates) {
+		idx := p.crlPartition(revoked.SerialNumber)
+		shards[idx] = append(shards[idx], revoked)
+	}
+
+	caKey, caCert, err := p.crlSigner(list.TBSCertList.RevokedCertificates)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroKey(caKey)
+	now := p.now()
+	res := make([]*CRLPartition, 0, p.crlPartitions)
+	for idx, shard := range shards {
+		url := p.crlPartitionURL(idx)
+		idp, err := marshalIssuingDistributionPoint(url)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.CreateRevocationList(p.rand(), &x509.RevocationList{
+			RevokedCertificates: shard,
+			Number:              big.NewInt(now.Unix()),
+			ThisUpdate:          now,
+			NextUpdate:          now.Add(99 * 365 * 24 * time.Hour),
+			ExtraExtensions:     []pkix.Extension{{Id: oidIssuingDistributionPoint, Critical: true, Value: idp}},
+			SignatureAlgorithm:  p.signatureAlgorithm(&caKey.PublicKey),
+		}, caCert, caKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can`t create crl partition %d", idx)
+		}
+		res = append(res, &CRLPartition{
+			Index: idx,
+			URL:   url,
+			PEM:   pem.EncodeToMemory(&pem.Block{Type: PEMx509CRLBlock, Bytes: der}),
+		})
+	}
+	return res, nil
+}
+
+// marshalIssuingDistributionPoint encode IssuingDistributionPoint with single uri full name, RFC 5280 5.2.5
+func marshalIssuingDistributionPoint(url string) ([]byte, error) {
+	dp, err := distributionPointName(url)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(struct {
+		DistributionPoint asn1.RawValue
+	}{dp})
+}
+
+// distributionPointName return [0] DistributionPointName with single uri full name
+func distributionPointName(url string) (asn1.RawValue, error) {
+	uri, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte(url)})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	fullName, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: uri})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: fullName}, nil
+}
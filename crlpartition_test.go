@@ -0,0 +1,59 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_PartitionedCRLs(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	_, _ = pki.NewCa()
+	_, err := pki.PartitionedCRLs()
+	assert.Error(t, err)
+
+	pki.crlPartitions = 3
+	pki.crlURLTemplate = "http://pki.local/crl-%d.crl"
+	var pairs []*X509Pair
+	for i := 0; i < 4; i++ {
+		pair, err := pki.NewCert("client", false, []string{""})
+		assert.NoError(t, err)
+		pairs = append(pairs, pair)
+	}
+	_, cert, _ := pairs[0].Decode()
+	assert.Equal(t, []string{"http://pki.local/crl-2.crl"}, cert.CRLDistributionPoints)
+	assert.NoError(t, pki.RevokeOne(pairs[0].Serial))
+	assert.NoError(t, pki.RevokeOne(pairs[2].Serial))
+	assert.NoError(t, pki.RevokeOne(pairs[3].Serial))
+
+	partitions, err := pki.PartitionedCRLs()
+	assert.NoError(t, err)
+	assert.Len(t, partitions, 3)
+	caPair, _ := pki.GetLastCA()
+	_, caCert, _ := caPair.Decode()
+	for idx, partition := range partitions {
+		assert.Equal(t, idx, partition.Index)
+		block, _ := pem.Decode(partition.PEM)
+		list, err := x509.ParseRevocationList(block.Bytes)
+		assert.NoError(t, err)
+		assert.NoError(t, list.CheckSignatureFrom(caCert))
+		idp, _ := marshalIssuingDistributionPoint(partition.URL)
+		found := false
+		for _, ext := range list.Extensions {
+			if ext.Id.Equal(oidIssuingDistributionPoint) {
+				found = ext.Critical && string(ext.Value) == string(idp)
+			}
+		}
+		assert.True(t, found)
+		for _, revoked := range list.RevokedCertificates {
+			assert.Equal(t, idx, int(new(big.Int).Mod(revoked.SerialNumber, big.NewInt(3)).Int64()))
+		}
+	}
+	block, _ := pem.Decode(partitions[2].PEM)
+	list, _ := x509.ParseRevocationList(block.Bytes)
+	assert.Len(t, list.RevokedCertificates, 2)
+}
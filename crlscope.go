@@ -0,0 +1,172 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var oidCRLReason = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// CRL entry reason codes, RFC 5280 5.3.1
+const (
+	CRLReasonUnspecified          = 0
+	CRLReasonKeyCompromise        = 1
+	CRLReasonCACompromise         = 2
+	CRLReasonAffiliationChanged   = 3
+	CRLReasonSuperseded           = 4
+	CRLReasonCessationOfOperation = 5
+	CRLReasonCertificateHold      = 6
+	CRLReasonRemoveFromCRL        = 8
+	CRLReasonPrivilegeWithdrawn   = 9
+	CRLReasonAACompromise         = 10
+)
+
+// CRLScope select entries of scoped CRL, zero value select all of them
+type CRLScope struct {
+	Reasons []int     // only entries with one of reason codes, entries without reason code are CRLReasonUnspecified
+	Since   time.Time // only entries revoked after Since
+	URL     string    // distribution point of scoped CRL put to issuing distribution point extension, optional
+}
+
+// GetCRLScope sign pem encoded CRL with entries of the current CRL selected by scope, for consumers
+// can`t handle the full list. Reasons other than CRLReasonUnspecified are put as onlySomeReasons to critical
+// issuing distribution point extension, Since is not expressed in CRL. Full CRL stay the source of revocations
+func (p *PKI) GetCRLScope(scope CRLScope) ([]byte, error) {
+	for _, code := range scope.Reasons {
+		if !validCRLReason(code) {
+			return nil, errors.Errorf("wrong crl reason code %d", code)
+		}
+	}
+	list, err := p.GetCRL()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get current crl")
+	}
+	entries := make([]pkix.RevokedCertificate, 0)
+	for _, revoked := range removeDups(list.TBSCertList.RevokedCertificates) {
+		if scope.match(revoked) {
+			entries = append(entries, revoked)
+		}
+	}
+	var extensions []pkix.Extension
+	idp, err := scope.issuingDistributionPoint()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t encode issuing distribution point")
+	}
+	if idp != nil {
+		extensions = append(extensions, pkix.Extension{Id: oidIssuingDistributionPoint, Critical: true, Value: idp})
+	}
+
+	caKey, caCert, err := p.crlSigner(list.TBSCertList.RevokedCertificates)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroKey(caKey)
+	now := p.now()
+	der, err := x509.CreateRevocationList(p.rand(), &x509.RevocationList{
+		RevokedCertificates: entries,
+		Number:              big.NewInt(now.Unix()),
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(99 * 365 * 24 * time.Hour),
+		ExtraExtensions:     extensions,
+		SignatureAlgorithm:  p.signatureAlgorithm(&caKey.PublicKey),
+	}, caCert, caKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t create scoped crl")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMx509CRLBlock, Bytes: der}), nil
+}
+
+func (s CRLScope) match(revoked pkix.RevokedCertificate) bool {
+	if !s.Since.IsZero() && !revoked.RevocationTime.After(s.Since) {
+		return false
+	}
+	if len(s.Reasons) == 0 {
+		return true
+	}
+	code := crlReason(revoked)
+	for _, reason := range s.Reasons {
+		if reason == code {
+			return true
+		}
+	}
+	return false
+}
+
+// issuingDistributionPoint return encoded extension value, nil if scope has neither url nor expressible reasons
+func (s CRLScope) issuingDistributionPoint() ([]byte, error) {
+	idp := struct {
+		DistributionPoint asn1.RawValue  `asn1:"optional"`
+		OnlySomeReasons   asn1.BitString `asn1:"optional,tag:3"`
+	}{}
+	if s.URL != "" {
+		dp, err := distributionPointName(s.URL)
+		if err != nil {
+			return nil, err
+		}
+		idp.DistributionPoint = dp
+	}
+	if flags, ok := reasonFlags(s.Reasons); ok {
+		idp.OnlySomeReasons = flags
+	}
+	if s.URL == "" && idp.OnlySomeReasons.BitLength == 0 {
+		return nil, nil
+	}
+	return asn1.Marshal(idp)
+}
+
+// reasonFlags return ReasonFlags bit string of codes, false if codes are empty or include unspecified,
+// which has no flag
+func reasonFlags(codes []int) (asn1.BitString, bool) {
+	max := -1
+	for _, code := range codes {
+		if code == CRLReasonUnspecified {
+			return asn1.BitString{}, false
+		}
+		if code > max {
+			max = code
+		}
+	}
+	if max < 0 {
+		return asn1.BitString{}, false
+	}
+	flags := asn1.BitString{Bytes: make([]byte, max/8+1), BitLength: max + 1}
+	for _, code := range codes {
+		flags.Bytes[code/8] |= 0x80 >> uint(code%8)
+	}
+	return flags, true
+}
+
+// crlReason return reason code of CRL entry, CRLReasonUnspecified if it has none
+func crlReason(revoked pkix.RevokedCertificate) int {
+	for _, ext := range revoked.Extensions {
+		if !ext.Id.Equal(oidCRLReason) {
+			continue
+		}
+		var reason asn1.Enumerated
+		if _, err := asn1.Unmarshal(ext.Value, &reason); err == nil {
+			return int(reason)
+		}
+	}
+	return CRLReasonUnspecified
+}
+
+func crlReasonExtension(code int) (pkix.Extension, error) {
+	if !validCRLReason(code) {
+		return pkix.Extension{}, errors.Errorf("wrong crl reason code %d", code)
+	}
+	value, err := asn1.Marshal(asn1.Enumerated(code))
+	if err != nil {
+		return pkix.Extension{}, errors.Wrap(err, "can`t encode crl reason")
+	}
+	return pkix.Extension{Id: oidCRLReason, Value: value}, nil
+}
+
+func validCRLReason(code int) bool {
+	return code >= CRLReasonUnspecified && code <= CRLReasonAACompromise && code != 7
+}
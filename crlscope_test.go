@@ -0,0 +1,86 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_GetCRLScope(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	var pairs []*X509Pair
+	for i := 0; i < 3; i++ {
+		pair, err := pki.NewCert("client", false, nil)
+		assert.NoError(t, err)
+		pairs = append(pairs, pair)
+	}
+	start := time.Now().Truncate(time.Second)
+	pki.clock = func() time.Time { return start }
+	assert.NoError(t, pki.RevokeWithReasonCode(pairs[0].Serial, CRLReasonKeyCompromise, "admin", "leaked"))
+	pki.clock = func() time.Time { return start.Add(time.Hour) }
+	assert.NoError(t, pki.RevokeWithReasonCode(pairs[1].Serial, CRLReasonSuperseded, "admin", ""))
+	assert.NoError(t, pki.RevokeOne(pairs[2].Serial))
+	assert.Error(t, pki.RevokeWithReasonCode(pairs[2].Serial, 7, "", ""))
+	caPair, _ := pki.GetLastCA()
+	_, caCert, _ := caPair.Decode()
+
+	parse := func(crlPem []byte) *x509.RevocationList {
+		block, _ := pem.Decode(crlPem)
+		list, err := x509.ParseRevocationList(block.Bytes)
+		assert.NoError(t, err)
+		assert.NoError(t, list.CheckSignatureFrom(caCert))
+		return list
+	}
+
+	crlPem, err := pki.GetCRLScope(CRLScope{Reasons: []int{CRLReasonKeyCompromise}, URL: "http://pki.local/compromised.crl"})
+	assert.NoError(t, err)
+	list := parse(crlPem)
+	assert.Len(t, list.RevokedCertificates, 1)
+	assert.Equal(t, 0, list.RevokedCertificates[0].SerialNumber.Cmp(pairs[0].Serial))
+	var idp struct {
+		DistributionPoint asn1.RawValue  `asn1:"optional"`
+		OnlySomeReasons   asn1.BitString `asn1:"optional,tag:3"`
+	}
+	found := false
+	for _, ext := range list.Extensions {
+		if ext.Id.Equal(oidIssuingDistributionPoint) {
+			found = ext.Critical
+			_, err := asn1.Unmarshal(ext.Value, &idp)
+			assert.NoError(t, err)
+		}
+	}
+	assert.True(t, found)
+	assert.Equal(t, 1, idp.OnlySomeReasons.At(CRLReasonKeyCompromise))
+	assert.Equal(t, 0, idp.OnlySomeReasons.At(CRLReasonSuperseded))
+
+	crlPem, err = pki.GetCRLScope(CRLScope{Reasons: []int{CRLReasonUnspecified, CRLReasonSuperseded}})
+	assert.NoError(t, err)
+	list = parse(crlPem)
+	assert.Len(t, list.RevokedCertificates, 2)
+	for _, ext := range list.Extensions {
+		assert.False(t, ext.Id.Equal(oidIssuingDistributionPoint))
+	}
+
+	crlPem, err = pki.GetCRLScope(CRLScope{Since: start})
+	assert.NoError(t, err)
+	assert.Len(t, parse(crlPem).RevokedCertificates, 2)
+
+	crlPem, err = pki.GetCRLScope(CRLScope{})
+	assert.NoError(t, err)
+	list = parse(crlPem)
+	assert.Len(t, list.RevokedCertificates, 3)
+	full, err := pki.GetCRL()
+	assert.NoError(t, err)
+	assert.Equal(t, CRLReasonKeyCompromise, crlReason(full.TBSCertList.RevokedCertificates[0]))
+	assert.Equal(t, CRLReasonUnspecified, crlReason(full.TBSCertList.RevokedCertificates[2]))
+
+	_, err = pki.GetCRLScope(CRLScope{Reasons: []int{11}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package easyrsa
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CRLSignerCN is a storage cn of delegated CRL signing pairs
+const CRLSignerCN = "crl-signer"
+
+// NewCRLSigner issue delegated CRL signing pair by the last CA. The signer has the CA subject and cRLSign
+// key usage only, so CRLs signed by it are direct CRLs of the CA. While a valid signer of the last CA exist
+// CRLs are signed with it and the CA key may stay offline or sealed until next rotation.
+// Relying parties must get the signer cert along with the CA cert to verify CRLs
+func (p *PKI) NewCRLSigner() (*X509Pair, error) {
+	if err := p.requireLeader(); err != nil {
+		return nil, err
+	}
+	caPair, err := p.GetLastCA()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get ca pair")
+	}
+	caCert, err := decodeCert(caPair.CertPemBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t parse ca cert")
+	}
+	now := p.now()
+	tml := &x509.Certificate{
+		NotBefore:             now.Add(-NotBeforeBackdate).UTC(),
+		NotAfter:              now.Add(validityOrDefault(p.certValidity)).UTC(),
+		Subject:               caCert.Subject,
+		RawSubject:            caCert.RawSubject,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	return p.issue(CertRequest{CN: CRLSignerCN}, tml, nil)
+}
+
+// delegatedCRLSigner return key and cert of the newest valid CRL signer issued by the last CA and not listed
+// in revoked, nil if there is none
+func (p *PKI) delegatedCRLSigner(revoked []pkix.RevokedCertificate) (*rsa.PrivateKey, *x509.Certificate, error) {
+	caPair, err := p.GetLastCA()
+	if err != nil {
+		return nil, nil, nil
+	}
+	caCert, err := decodeCert(caPair.CertPemBytes)
+	if err != nil {
+		return nil, nil, nil
+	}
+	now := p.now()
+	var signer *X509Pair
+	err = ForEachByCN(p.Storage, CRLSignerCN, func(pair *X509Pair) error {
+		if !pair.HasKey() || (signer != nil && signer.Serial.Cmp(pair.Serial) > 0) {
+			return nil
+		}
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil || !usableCRLSigner(cert, caCert, now, revoked) {
+			return nil
+		}
+		signer = pair
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can`t get crl signers")
+	}
+	if signer == nil {
+		return nil, nil, nil
+	}
+	key, cert, err := signer.Decode()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can`t decode crl signer")
+	}
+	if err := p.checkFIPS(cert); err != nil {
+		ZeroKey(key)
+		return nil, nil, err
+	}
+	return key, cert, nil
+}
+
+// crlSignerCerts decode stored CRL signer certs issued by one of cas, valid now and not revoked by crl.
+// Signer revoked by crl can`t vouch for it, such crl must be signed by CA or another signer
+func (p *PKI) crlSignerCerts(cas []*x509.Certificate, crl *pkix.CertificateList) ([]*x509.Certificate, error) {
+	now := p.now()
+	res := make([]*x509.Certificate, 0)
+	err := ForEachByCN(p.Storage, CRLSignerCN, func(pair *X509Pair) error {
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil {
+			return nil
+		}
+		for _, ca := range cas {
+			if usableCRLSigner(cert, ca, now, crl.TBSCertList.RevokedCertificates) {
+				res = append(res, cert)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get crl signers")
+	}
+	return res, nil
+}
+
+// subjectKeyID compute key id as sha1 of subjectPublicKey bits, method 1 of RFC 5280 4.2.1.2
+func subjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t encode public key")
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil, errors.Wrap(err, "can`t decode public key")
+	}
+	sum := sha1.Sum(spki.PublicKey.Bytes)
+	return sum[:], nil
+}
+
+// isCRLSigner check that cert is a delegated CRL signer of ca
+func isCRLSigner(cert, ca *x509.Certificate) bool {
+	return !cert.IsCA && cert.KeyUsage&x509.KeyUsageCRLSign != 0 &&
+		string(cert.RawSubject) == string(ca.RawSubject) && cert.CheckSignatureFrom(ca) == nil
+}
+
+// usableCRLSigner check that cert is a delegated CRL signer of ca, valid at now and not listed in revoked
+func usableCRLSigner(cert, ca *x509.Certificate, now time.Time, revoked []pkix.RevokedCertificate) bool {
+	if !isCRLSigner(cert, ca) || now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return false
+	}
+	for _, entry := range revoked {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_NewCRLSigner(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	ca, shares, err := pki.NewSealedCa(3, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, pki.Unseal(shares[:2]))
+
+	signer, err := pki.NewCRLSigner()
+	assert.NoError(t, err)
+	assert.Equal(t, CRLSignerCN, signer.CN)
+	_, caCert, _ := ca.Decode()
+	_, signerCert, err := signer.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, caCert.RawSubject, signerCert.RawSubject)
+	assert.False(t, signerCert.IsCA)
+	assert.Equal(t, x509.KeyUsageCRLSign|x509.KeyUsageDigitalSignature, signerCert.KeyUsage)
+	assert.NotEmpty(t, signerCert.SubjectKeyId)
+	assert.NoError(t, signerCert.CheckSignatureFrom(caCert))
+
+	pair, err := pki.NewCert("client", false, nil)
+	assert.NoError(t, err)
+	pki.Seal()
+
+	t.Run("revoke with ca key offline", func(t *testing.T) {
+		assert.NoError(t, pki.RevokeOne(pair.Serial))
+		assert.True(t, pki.IsRevoked(pair.Serial))
+		list, err := pki.GetRevocationList()
+		assert.NoError(t, err)
+		assert.Equal(t, signerCert.SubjectKeyId, list.AuthorityKeyId)
+		// RevocationList.CheckSignatureFrom accept CA parents only
+		assert.NoError(t, signerCert.CheckSignature(list.SignatureAlgorithm, list.RawTBSRevocationList, list.Signature))
+		assert.Error(t, caCert.CheckSignature(list.SignatureAlgorithm, list.RawTBSRevocationList, list.Signature))
+	})
+
+	t.Run("no signer", func(t *testing.T) {
+		assert.NoError(t, pki.Storage.DeleteBySerial(signer.Serial))
+		assert.Error(t, pki.RevokeOne(pair.Serial))
+	})
+}
+
+func TestPKI_CRLSigner_revokedOrExpired(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithValidity(24*time.Hour, time.Hour))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	signer, err := pki.NewCRLSigner()
+	assert.NoError(t, err)
+	signerKey, signerCert, err := signer.Decode()
+	assert.NoError(t, err)
+	cas, _, err := pki.caCerts()
+	assert.NoError(t, err)
+
+	t.Run("revoked", func(t *testing.T) {
+		// CA sign the CRL revoking signer
+		assert.NoError(t, pki.RevokeOne(signer.Serial))
+		list, err := pki.GetRevocationList()
+		assert.NoError(t, err)
+		assert.NotEqual(t, signerCert.SubjectKeyId, list.AuthorityKeyId)
+		crl, err := pki.GetCRL()
+		assert.NoError(t, err)
+		signers, err := pki.crlSignerCerts(cas, crl)
+		assert.NoError(t, err)
+		assert.Empty(t, signers)
+
+		// revoked signer can`t vouch for crl revoking it
+		der, err := pki.createCRL(signerKey, signerCert, crl.TBSCertList.RevokedCertificates)
+		assert.NoError(t, err)
+		forged, err := x509.ParseCRL(der)
+		assert.NoError(t, err)
+		assert.Error(t, pki.verifyCRL(forged))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		signers, err := pki.crlSignerCerts(cas, &pkix.CertificateList{})
+		assert.NoError(t, err)
+		assert.Len(t, signers, 1)
+		pki.clock = func() time.Time { return signerCert.NotAfter.Add(time.Minute) }
+		signers, err = pki.crlSignerCerts(cas, &pkix.CertificateList{})
+		assert.NoError(t, err)
+		assert.Empty(t, signers)
+	})
+}
@@ -0,0 +1,104 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CrossCertCN is a storage cn of cross certificates issued by CrossSign
+const CrossCertCN = "cross"
+
+// Metadata tags stored with cross certificates
+const (
+	MetadataCrossSubject     = "cross_subject"     // subject of cross signed CA
+	MetadataCrossFingerprint = "cross_fingerprint" // sha256 hex of cross signed CA cert
+)
+
+// CrossSignOption configure cross certificate issued by CrossSign
+type CrossSignOption func(*crossSignOptions)
+
+type crossSignOptions struct {
+	validity   time.Duration    // cross cert lifetime, NotAfter of external CA if zero
+	maxPathLen *int             // basicConstraints pathlen, external CA one if nil
+	names      *NameConstraints // nameConstraints limiting trust in external CA
+}
+
+// WithCrossValidity set lifetime of cross certificate
+func WithCrossValidity(validity time.Duration) CrossSignOption {
+	return func(o *crossSignOptions) {
+		o.validity = validity
+	}
+}
+
+// WithCrossPathLen set basicConstraints pathlen of cross certificate, negative is unlimited
+func WithCrossPathLen(maxPathLen int) CrossSignOption {
+	return func(o *crossSignOptions) {
+		o.maxPathLen = &maxPathLen
+	}
+}
+
+// WithCrossNameConstraints limit names our relying parties accept from external CA
+func WithCrossNameConstraints(names *NameConstraints) CrossSignOption {
+	return func(o *crossSignOptions) {
+		o.names = names
+	}
+}
+
+// CrossSign issue cross certificate for external CA cert with last CA key: subject, key and key id of external CA
+// signed by us, so chains of external PKI verify against our root. Cross certificate is stored cert only under
+// CrossCertCN and can be revoked as any other cert
+func (p *PKI) CrossSign(certPem []byte, opts ...CrossSignOption) (*X509Pair, error) {
+	external, err := decodeCert(certPem)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t parse external ca")
+	}
+	if !external.IsCA || external.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, errors.New("external cert is not a ca")
+	}
+	if bytes.Equal(external.RawIssuer, external.RawSubject) && !isSelfSigned(external) {
+		return nil, errors.New("external ca has broken self signature")
+	}
+	o := &crossSignOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	now := p.now()
+	tml := &x509.Certificate{
+		RawSubject:            external.RawSubject,
+		Subject:               external.Subject,
+		SubjectKeyId:          external.SubjectKeyId,
+		NotBefore:             now.Add(-NotBeforeBackdate).UTC(),
+		NotAfter:              external.NotAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		ExtKeyUsage:           external.ExtKeyUsage,
+		MaxPathLen:            external.MaxPathLen,
+		MaxPathLenZero:        external.MaxPathLenZero,
+	}
+	if o.validity > 0 {
+		tml.NotAfter = now.Add(o.validity).UTC()
+	}
+	if o.maxPathLen != nil {
+		applyPathLen(tml, *o.maxPathLen)
+	}
+	o.names.apply(tml)
+	if len(tml.SubjectKeyId) == 0 {
+		if tml.SubjectKeyId, err = subjectKeyID(external.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	fingerprint := sha256.Sum256(external.Raw)
+	metadata := map[string]string{
+		MetadataCrossSubject:     external.Subject.String(),
+		MetadataCrossFingerprint: hex.EncodeToString(fingerprint[:]),
+	}
+	return p.issue(CertRequest{CN: CrossCertCN, CA: true, Metadata: metadata}, tml, external.PublicKey)
+}
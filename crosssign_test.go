@@ -0,0 +1,87 @@
+package easyrsa
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_CrossSign(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	ours, err := pki.NewCa()
+	assert.NoError(t, err)
+	_, ourCert, err := ours.Decode()
+	assert.NoError(t, err)
+
+	// other organization CA and leaf
+	extKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	now := time.Now()
+	extTml := &x509.Certificate{
+		SerialNumber:          big.NewInt(100),
+		Subject:               pkix.Name{CommonName: "other ca", Organization: []string{"other"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	extDer, err := x509.CreateCertificate(rand.Reader, extTml, extTml, &extKey.PublicKey, extKey)
+	assert.NoError(t, err)
+	extCert, err := x509.ParseCertificate(extDer)
+	assert.NoError(t, err)
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	leafDer, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(101),
+		Subject:      pkix.Name{CommonName: "partner.other.local"},
+		DNSNames:     []string{"partner.other.local"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, extCert, &leafKey.PublicKey, extKey)
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(leafDer)
+	assert.NoError(t, err)
+
+	cross, err := pki.CrossSign(pem.EncodeToMemory(&pem.Block{Type: PEMCertificateBlock, Bytes: extDer}),
+		WithCrossPathLen(0), WithCrossNameConstraints(&NameConstraints{PermittedDNSDomains: []string{"other.local"}}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, CrossCertCN, cross.CN)
+	assert.False(t, cross.HasKey())
+	assert.Equal(t, "CN=other ca,O=other", cross.Metadata[MetadataCrossSubject])
+	crossCert, err := decodeCert(cross.CertPemBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, extCert.RawSubject, crossCert.RawSubject)
+	assert.Equal(t, extCert.SubjectKeyId, crossCert.SubjectKeyId)
+	assert.True(t, crossCert.MaxPathLenZero)
+	assert.True(t, publicKeyEqual(crossCert.PublicKey, &extKey.PublicKey))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ourCert)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(crossCert)
+	chains, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	assert.NoError(t, err)
+	assert.Len(t, chains, 1)
+
+	stored, err := pki.Storage.GetBySerial(cross.Serial)
+	assert.NoError(t, err)
+	assert.Equal(t, cross.CertPemBytes, stored.CertPemBytes)
+
+	_, err = pki.CrossSign([]byte("garbage"))
+	assert.Error(t, err)
+	_, err = pki.CrossSign(pem.EncodeToMemory(&pem.Block{Type: PEMCertificateBlock, Bytes: leafDer}))
+	assert.Error(t, err)
+}
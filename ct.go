@@ -0,0 +1,159 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	oidCTPoison  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+	oidCTSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+)
+
+// SCT is a signed certificate timestamp returned by CT log, RFC 6962 3.2
+type SCT struct {
+	Version    uint8
+	LogID      []byte // sha256 of log public key
+	Timestamp  uint64 // ms since epoch
+	Extensions []byte
+	Signature  []byte // tls encoded DigitallySigned struct
+}
+
+// CTLog accept precertificate chains
+type CTLog interface {
+	AddPreChain(chain [][]byte) (*SCT, error) // AddPreChain submit der precert followed by issuer chain.
+}
+
+// HTTPCTLog implement CTLog interface with RFC 6962 http api
+type HTTPCTLog struct {
+	URL    string       // log base url, e.g. https://ct.example.com/log
+	Client *http.Client // http.DefaultClient if nil
+}
+
+func (l *HTTPCTLog) AddPreChain(chain [][]byte) (*SCT, error) {
+	req := struct {
+		Chain []string `json:"chain"`
+	}{}
+	for _, der := range chain {
+		req.Chain = append(req.Chain, base64.StdEncoding.EncodeToString(der))
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(strings.TrimRight(l.URL, "/")+"/ct/v1/add-pre-chain", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t submit precert")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("ct log respond with %s", resp.Status)
+	}
+	var res struct {
+		Version    uint8  `json:"sct_version"`
+		ID         []byte `json:"id"`
+		Timestamp  uint64 `json:"timestamp"`
+		Extensions []byte `json:"extensions"`
+		Signature  []byte `json:"signature"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errors.Wrap(err, "can`t parse ct log response")
+	}
+	if len(res.ID) != 32 || len(res.Signature) == 0 {
+		return nil, errors.New("wrong sct in ct log response")
+	}
+	return &SCT{Version: res.Version, LogID: res.ID, Timestamp: res.Timestamp, Extensions: res.Extensions, Signature: res.Signature}, nil
+}
+
+// WithCTLogs submit precertificate of every issued leaf to logs and embed returned SCTs.
+// Issuance fail if less than minSCTs logs answered, SCT signatures are not verified
+func WithCTLogs(minSCTs int, logs ...CTLog) Option {
+	return func(p *PKI) {
+		p.ctLogs = logs
+		p.ctMinSCTs = minSCTs
+	}
+}
+
+// embedSCTs issue precert for template, submit it to CT logs and add SCT list extension to template
+func (p *PKI) embedSCTs(tml *x509.Certificate, caPair *X509Pair, caCert *x509.Certificate, pub crypto.PublicKey, caKey crypto.Signer) error {
+	pre := *tml
+	pre.ExtraExtensions = append(append([]pkix.Extension{}, tml.ExtraExtensions...),
+		pkix.Extension{Id: oidCTPoison, Critical: true, Value: asn1.NullBytes})
+	preDer, err := x509.CreateCertificate(p.rand(), &pre, caCert, pub, caKey)
+	if err != nil {
+		return errors.Wrap(err, "can`t create precertificate")
+	}
+	chain := [][]byte{preDer, caCert.Raw}
+	rest := caPair.ChainPemBytes
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		chain = append(chain, block.Bytes)
+	}
+
+	scts := make([]*SCT, 0, len(p.ctLogs))
+	var failed []string
+	for _, log := range p.ctLogs {
+		sct, err := log.AddPreChain(chain)
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		scts = append(scts, sct)
+	}
+	if len(scts) < p.ctMinSCTs || len(scts) == 0 {
+		return errors.Errorf("got %d of %d required scts: %s", len(scts), p.ctMinSCTs, strings.Join(failed, "; "))
+	}
+	value, err := marshalSCTList(scts)
+	if err != nil {
+		return err
+	}
+	tml.ExtraExtensions = append(append([]pkix.Extension{}, tml.ExtraExtensions...),
+		pkix.Extension{Id: oidCTSCTList, Value: value})
+	return nil
+}
+
+// marshalSCTList encode SignedCertificateTimestampList as x509 extension value, RFC 6962 3.3
+func marshalSCTList(scts []*SCT) ([]byte, error) {
+	list := bytes.NewBuffer(nil)
+	for _, sct := range scts {
+		item := bytes.NewBuffer(nil)
+		item.WriteByte(sct.Version)
+		item.Write(sct.LogID)
+		_ = binary.Write(item, binary.BigEndian, sct.Timestamp)
+		_ = binary.Write(item, binary.BigEndian, uint16(len(sct.Extensions)))
+		item.Write(sct.Extensions)
+		item.Write(sct.Signature)
+		if item.Len() > 0xffff {
+			return nil, errors.New("sct is too long")
+		}
+		_ = binary.Write(list, binary.BigEndian, uint16(item.Len()))
+		list.Write(item.Bytes())
+	}
+	if list.Len() > 0xffff {
+		return nil, errors.New("sct list is too long")
+	}
+	res := make([]byte, 2, 2+list.Len())
+	binary.BigEndian.PutUint16(res, uint16(list.Len()))
+	return asn1.Marshal(append(res, list.Bytes()...))
+}
@@ -0,0 +1,93 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCTLog struct {
+	chains [][][]byte
+	err    error
+}
+
+func (l *fakeCTLog) AddPreChain(chain [][]byte) (*SCT, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	l.chains = append(l.chains, chain)
+	return &SCT{LogID: bytes.Repeat([]byte{1}, 32), Timestamp: 1000, Signature: []byte{4, 3, 0, 1, 0xff}}, nil
+}
+
+func TestPKI_embedSCTs(t *testing.T) {
+	log := &fakeCTLog{}
+	down := &fakeCTLog{err: errors.New("down")}
+	pki, cleanup := getTmpPki(WithCTLogs(1, log, down))
+	defer cleanup()
+	_, _ = pki.NewCa()
+	pair, err := pki.NewCert("server", true, []string{""})
+	assert.NoError(t, err)
+
+	assert.Len(t, log.chains, 1)
+	assert.Len(t, log.chains[0], 2)
+	pre, err := x509.ParseCertificate(log.chains[0][0])
+	assert.NoError(t, err)
+	_, cert, _ := pair.Decode()
+	assert.Equal(t, cert.SerialNumber, pre.SerialNumber)
+	hasExt := func(cert *x509.Certificate, ext string) bool {
+		for _, e := range cert.Extensions {
+			if e.Id.String() == ext {
+				return true
+			}
+		}
+		return false
+	}
+	assert.True(t, hasExt(pre, oidCTPoison.String()))
+	assert.False(t, hasExt(pre, oidCTSCTList.String()))
+	assert.False(t, hasExt(cert, oidCTPoison.String()))
+	assert.True(t, hasExt(cert, oidCTSCTList.String()))
+
+	pki.ctMinSCTs = 2
+	_, err = pki.NewCert("server", true, []string{""})
+	assert.Error(t, err)
+}
+
+func TestMarshalSCTList(t *testing.T) {
+	value, err := marshalSCTList([]*SCT{{LogID: make([]byte, 32), Timestamp: 1, Signature: []byte{4, 3, 0, 0}}})
+	assert.NoError(t, err)
+	// octet string, list length, sct length, version, log id, timestamp, no extensions, signature
+	expected := append([]byte{0x04, 51, 0, 49, 0, 47, 0}, make([]byte, 32)...)
+	expected = append(expected, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 4, 3, 0, 0)
+	assert.Equal(t, expected, value)
+}
+
+func TestHTTPCTLog_AddPreChain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/log/ct/v1/add-pre-chain", r.URL.Path)
+		var req struct {
+			Chain []string `json:"chain"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Chain) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"sct_version":0,"id":"` + base64.StdEncoding.EncodeToString(make([]byte, 32)) +
+			`","timestamp":42,"extensions":"","signature":"BAMAAQE="}`))
+	}))
+	defer server.Close()
+	log := &HTTPCTLog{URL: server.URL + "/log/"}
+	sct, err := log.AddPreChain([][]byte{{1}, {2}})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), sct.Timestamp)
+	assert.Equal(t, []byte{4, 3, 0, 1, 1}, sct.Signature)
+	_, err = log.AddPreChain([][]byte{{1}})
+	assert.Error(t, err)
+}
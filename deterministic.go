@@ -0,0 +1,237 @@
+package easyrsa
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithDeterministicMode make PKI output reproducible for golden file tests:
+// clock is fixed to now, keys and signatures use reader seeded by seed and serials are sequential from 1.
+// TEST ONLY, keys generated in this mode are predictable by anyone who know the seed
+func WithDeterministicMode(seed string, now time.Time) Option {
+	return func(p *PKI) {
+		p.random = NewInsecureDeterministicReader(seed)
+		p.clock = func() time.Time { return now }
+		p.serialProvider = &sequentialSerialProvider{}
+	}
+}
+
+// NewInsecureDeterministicReader return endless stream of sha256(seed || counter) blocks.
+// TEST ONLY, it`s not a cryptographically secure random source
+func NewInsecureDeterministicReader(seed string) io.Reader {
+	return &deterministicReader{seed: sha256.Sum256([]byte(seed))}
+}
+
+type deterministicReader struct {
+	mu      sync.Mutex
+	seed    [sha256.Size]byte
+	counter uint64
+	buf     []byte
+}
+
+func (r *deterministicReader) Read(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for n < len(b) {
+		if len(r.buf) == 0 {
+			block := make([]byte, sha256.Size+8)
+			copy(block, r.seed[:])
+			binary.BigEndian.PutUint64(block[sha256.Size:], r.counter)
+			r.counter++
+			sum := sha256.Sum256(block)
+			r.buf = sum[:]
+		}
+		c := copy(b[n:], r.buf)
+		r.buf = r.buf[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// sequentialSerialProvider is in memory SerialProvider counting from 1
+type sequentialSerialProvider struct {
+	mu   sync.Mutex
+	last int64
+}
+
+func (s *sequentialSerialProvider) Next() (*big.Int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last++
+	return big.NewInt(s.last), nil
+}
+
+func (s *sequentialSerialProvider) Release(serial *big.Int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if serial.IsInt64() && serial.Int64() == s.last {
+		s.last--
+	}
+	return nil
+}
+
+func (s *sequentialSerialProvider) Advance(serial *big.Int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if serial.IsInt64() && serial.Int64() > s.last {
+		s.last = serial.Int64()
+	}
+	return nil
+}
+
+// WithClock set source of current time used for issuance, validity and revocation checks
+func WithClock(clock func() time.Time) Option {
+	return func(p *PKI) {
+		p.clock = clock
+	}
+}
+
+// Now return current time of PKI clock, so renewal decisions of callers match validity checks
+func (p *PKI) Now() time.Time {
+	return p.now()
+}
+
+// now return current time, fixed in deterministic mode
+func (p *PKI) now() time.Time {
+	if p.clock != nil {
+		return p.clock()
+	}
+	return time.Now()
+}
+
+// rand return random source for signing
+func (p *PKI) rand() io.Reader {
+	if p.random != nil {
+		return p.random
+	}
+	return rand.Reader
+}
+
+// generateKey generate RSA key of configured size, NotFIPSApproved in FIPS mode if it`s too small.
+// rsa.GenerateKey deliberately randomize reads from custom readers, so deterministic mode generate primes itself
+func (p *PKI) generateKey() (*rsa.PrivateKey, error) {
+	bits := p.keySize
+	if bits <= 0 {
+		bits = DefaultKeySizeBytes
+	}
+	if p.FIPSMode() && bits < FIPSMinRSAKeySize {
+		return nil, errors.WithStack(NewNotFIPSApproved(fmt.Sprintf("rsa key size %d is too small", bits)))
+	}
+	if p.random == nil {
+		return rsa.GenerateKey(rand.Reader, bits)
+	}
+	return deterministicRSAKey(p.random, bits)
+}
+
+var oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+
+// generateECDSAKey generate P-256 key. ecdsa.GenerateKey may ignore custom readers, so deterministic mode
+// derive the scalar itself as in FIPS 186-4 B.4.1
+func (p *PKI) generateECDSAKey() (*ecdsa.PrivateKey, error) {
+	if p.random == nil {
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	return deterministicECDSAKey(p.random)
+}
+
+func deterministicECDSAKey(random io.Reader) (*ecdsa.PrivateKey, error) {
+	n := elliptic.P256().Params().N
+	b := make([]byte, (n.BitLen()+64+7)/8)
+	defer zeroBytes(b)
+	if _, err := io.ReadFull(random, b); err != nil {
+		return nil, errors.Wrap(err, "can`t read random")
+	}
+	d := new(big.Int).SetBytes(b)
+	d.Mod(d, new(big.Int).Sub(n, big.NewInt(1)))
+	d.Add(d, big.NewInt(1))
+	// SEC 1 key without public point, x509 derive it from the scalar
+	scalar := d.FillBytes(make([]byte, (n.BitLen()+7)/8))
+	defer zeroBytes(scalar)
+	zeroInt(d)
+	der, err := asn1.Marshal(struct {
+		Version    int
+		PrivateKey []byte
+		Curve      asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	}{1, scalar, oidNamedCurveP256})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal ec key")
+	}
+	defer zeroBytes(der)
+	return x509.ParseECPrivateKey(der)
+}
+
+func deterministicRSAKey(random io.Reader, bits int) (*rsa.PrivateKey, error) {
+	e := big.NewInt(65537)
+	one := big.NewInt(1)
+	for {
+		p, err := deterministicPrime(random, bits/2)
+		if err != nil {
+			return nil, err
+		}
+		q, err := deterministicPrime(random, bits-bits/2)
+		if err != nil {
+			return nil, err
+		}
+		if p.Cmp(q) == 0 {
+			continue
+		}
+		phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		d := new(big.Int).ModInverse(e, phi)
+		if d == nil {
+			continue
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: new(big.Int).Mul(p, q), E: int(e.Int64())},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		key.Precompute()
+		if err := key.Validate(); err != nil {
+			return nil, errors.Wrap(err, "can`t generate deterministic key")
+		}
+		return key, nil
+	}
+}
+
+// deterministicPrime read candidates with two top bits set, so product of two primes has full length
+func deterministicPrime(random io.Reader, bits int) (*big.Int, error) {
+	if bits < 16 {
+		return nil, errors.New("prime size is too small")
+	}
+	b := make([]byte, (bits+7)/8)
+	top := uint(bits % 8)
+	if top == 0 {
+		top = 8
+	}
+	for {
+		if _, err := io.ReadFull(random, b); err != nil {
+			return nil, err
+		}
+		b[0] &= uint8(int(1<<top) - 1)
+		if top >= 2 {
+			b[0] |= 3 << (top - 2)
+		} else {
+			b[0] |= 1
+			b[1] |= 0x80
+		}
+		b[len(b)-1] |= 1
+		candidate := new(big.Int).SetBytes(b)
+		if candidate.ProbablyPrime(20) {
+			return candidate, nil
+		}
+	}
+}
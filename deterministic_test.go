@@ -0,0 +1,55 @@
+package easyrsa
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithDeterministicMode(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	issue := func(seed string) (ca, leaf *X509Pair, crl []byte) {
+		pki, cleanup := getTmpPki(WithDeterministicMode(seed, now))
+		defer cleanup()
+		ca, err := pki.NewCa()
+		assert.NoError(t, err)
+		leaf, err = pki.NewCert("server", true, []string{""})
+		assert.NoError(t, err)
+		assert.NoError(t, pki.RevokeOne(leaf.Serial))
+		crl, err = ioutil.ReadFile(filepath.Join(testData, "crl.pem"))
+		assert.NoError(t, err)
+		return ca, leaf, crl
+	}
+	ca1, leaf1, crl1 := issue("golden")
+	ca2, leaf2, crl2 := issue("golden")
+	assert.Equal(t, ca1.KeyPemBytes, ca2.KeyPemBytes)
+	assert.Equal(t, ca1.CertPemBytes, ca2.CertPemBytes)
+	assert.Equal(t, leaf1.KeyPemBytes, leaf2.KeyPemBytes)
+	assert.Equal(t, leaf1.CertPemBytes, leaf2.CertPemBytes)
+	assert.Equal(t, crl1, crl2)
+	assert.Equal(t, big.NewInt(1), ca1.Serial)
+	assert.Equal(t, big.NewInt(2), leaf1.Serial)
+	_, cert, err := leaf1.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-NotBeforeBackdate), cert.NotBefore)
+
+	ca3, _, _ := issue("other")
+	assert.NotEqual(t, ca1.KeyPemBytes, ca3.KeyPemBytes)
+}
+
+func TestNewInsecureDeterministicReader(t *testing.T) {
+	a := make([]byte, 100)
+	b := make([]byte, 100)
+	_, _ = io.ReadFull(NewInsecureDeterministicReader("seed"), a)
+	r := NewInsecureDeterministicReader("seed")
+	_, _ = io.ReadFull(r, b[:7])
+	_, _ = io.ReadFull(r, b[7:])
+	assert.Equal(t, a, b)
+	assert.False(t, bytes.Equal(a, make([]byte, 100)))
+}
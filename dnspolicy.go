@@ -0,0 +1,87 @@
+package easyrsa
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DNSPolicy restrict DNS SANs of issued leafs
+type DNSPolicy struct {
+	Zones         []string                                        // allowed zones, name must be zone itself or it`s subdomain, any zone if empty
+	AllowWildcard bool                                            // allow single leading "*." label
+	PublicSuffix  func(domain string) (suffix string, icann bool) // e.g. publicsuffix.PublicSuffix from golang.org/x/net, last label is suffix if nil
+}
+
+// WithDNSPolicy reject issuance of leafs with DNS SANs violating policy
+func WithDNSPolicy(policy DNSPolicy) Option {
+	return func(p *PKI) {
+		p.dnsPolicy = &policy
+	}
+}
+
+// Check return PolicyViolation if name is not valid hostname, is public suffix only or is out of zones
+func (d *DNSPolicy) Check(name string) error {
+	host := strings.ToLower(strings.TrimSuffix(name, "."))
+	if strings.HasPrefix(host, "*.") {
+		if !d.AllowWildcard {
+			return NewPolicyViolation(fmt.Sprintf("wildcard dns name %q is not allowed", name))
+		}
+		host = host[2:]
+	}
+	if err := checkHostname(host); err != nil {
+		return NewPolicyViolation(fmt.Sprintf("dns name %q is not valid: %s", name, err))
+	}
+	suffix := host[strings.LastIndex(host, ".")+1:]
+	if d.PublicSuffix != nil {
+		suffix, _ = d.PublicSuffix(host)
+	}
+	if suffix == host {
+		return NewPolicyViolation(fmt.Sprintf("dns name %q is public suffix", name))
+	}
+	if len(d.Zones) == 0 {
+		return nil
+	}
+	for _, zone := range d.Zones {
+		zone = strings.ToLower(strings.Trim(zone, "."))
+		if host == zone || strings.HasSuffix(host, "."+zone) {
+			return nil
+		}
+	}
+	return NewPolicyViolation(fmt.Sprintf("dns name %q is out of allowed zones", name))
+}
+
+// checkHostname check RFC 1123 hostname syntax
+func checkHostname(host string) error {
+	if len(host) == 0 || len(host) > 253 {
+		return errors.New("wrong length")
+	}
+	for _, label := range strings.Split(host, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return errors.New("wrong label length")
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return errors.New("label start or end with hyphen")
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return errors.Errorf("wrong character %q", c)
+			}
+		}
+	}
+	return nil
+}
+
+// checkDNSPolicy check all names against configured policy
+func (p *PKI) checkDNSPolicy(names []string) error {
+	if p.dnsPolicy == nil {
+		return nil
+	}
+	for _, name := range names {
+		if err := p.dnsPolicy.Check(name); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package easyrsa
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSPolicy_Check(t *testing.T) {
+	policy := &DNSPolicy{
+		Zones:         []string{"corp.internal", ".example.co.uk."},
+		AllowWildcard: true,
+		PublicSuffix: func(domain string) (string, bool) {
+			if strings.HasSuffix(domain, "co.uk") {
+				return "co.uk", true
+			}
+			return domain[strings.LastIndex(domain, ".")+1:], false
+		},
+	}
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"corp.internal", false},
+		{"web.corp.internal", false},
+		{"WEB.Corp.Internal.", false},
+		{"*.corp.internal", false},
+		{"api.example.co.uk", false},
+		{"co.uk", true},
+		{"internal", true},
+		{"evilcorp.internal", true},
+		{"web.corp.internal.evil.com", true},
+		{"-web.corp.internal", true},
+		{"web_1.corp.internal", true},
+		{"web..corp.internal", true},
+		{"*.*.corp.internal", true},
+		{strings.Repeat("a", 64) + ".corp.internal", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.name)
+			assert.Equal(t, tt.wantErr, err != nil, "%v", err)
+		})
+	}
+	assert.Error(t, (&DNSPolicy{}).Check("*.corp.internal"))
+	assert.NoError(t, (&DNSPolicy{}).Check("host.anything"))
+}
+
+func TestPKI_checkDNSPolicy(t *testing.T) {
+	pki, cleanup := getTmpPki(WithDNSPolicy(DNSPolicy{Zones: []string{"corp.internal"}}))
+	defer cleanup()
+	_, _ = pki.NewCa()
+	_, err := pki.NewCert("web.corp.internal", true, []string{""})
+	assert.NoError(t, err)
+	_, err = pki.NewCert("web.example.com", true, []string{""})
+	assert.Error(t, err)
+	_, ok := errors.Cause(err).(*PolicyViolation)
+	assert.True(t, ok)
+	_, err = pki.SignCSR(newTestCSR(t, "csr"), "web", false, []string{""})
+	assert.Error(t, err)
+}
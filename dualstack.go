@@ -0,0 +1,80 @@
+package easyrsa
+
+import (
+	"crypto/tls"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// MetadataDualStackPeer is a metadata key of ECDSA pair with serial of RSA pair issued with it by IssueDualStack
+const MetadataDualStackPeer = "dual_stack_peer"
+
+// DualStackPair is RSA and ECDSA pairs of the same CN and SANs issued by IssueDualStack
+type DualStackPair struct {
+	RSA   *X509Pair
+	ECDSA *X509Pair
+}
+
+// IssueDualStack issue RSA and ECDSA pairs for request in one call, so TLS servers can serve ECDSA cert to clients
+// supporting it and RSA one to the others. Keys are generated, request can`t have CSR or key algorithm.
+// Pairs are peers, they don`t supersede each other under duplicate CN policy or WithSupersedeOnRenew.
+// RSA pair is revoked if ECDSA one can`t be issued
+func (p *PKI) IssueDualStack(req CertRequest) (*DualStackPair, error) {
+	if req.CSR != nil || len(req.CSRPem) > 0 {
+		return nil, errors.New("dual stack request can`t have csr")
+	}
+	if req.KeyAlgorithm != "" {
+		return nil, errors.New("dual stack request can`t have key algorithm")
+	}
+	rsaReq := req
+	rsaReq.KeyAlgorithm = KeyAlgorithmRSA
+	rsaPair, err := p.Issue(rsaReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t issue rsa pair")
+	}
+
+	ecReq := req
+	ecReq.KeyAlgorithm = KeyAlgorithmECDSA
+	ecReq.Metadata = make(map[string]string, len(req.Metadata)+1)
+	for key, value := range req.Metadata {
+		ecReq.Metadata[key] = value
+	}
+	ecReq.Metadata[MetadataDualStackPeer] = FormatSerial(rsaPair.Serial)
+	ecPair, err := p.issueRequest(ecReq)
+	if err != nil {
+		if rerr := p.RevokeWithReasonCode(rsaPair.Serial, CRLReasonCessationOfOperation, "", "dual stack issuance failed"); rerr != nil {
+			return nil, errors.Wrapf(err, "can`t issue ecdsa pair, rsa pair %s is not revoked: %s",
+				FormatSerial(rsaPair.Serial), rerr)
+		}
+		return nil, errors.Wrap(err, "can`t issue ecdsa pair")
+	}
+	return &DualStackPair{RSA: rsaPair, ECDSA: ecPair}, nil
+}
+
+// Certificates return ECDSA and RSA certs with intermediates for tls.Config.Certificates,
+// crypto/tls pick the first one supported by client
+func (d *DualStackPair) Certificates(passphrase PassphraseFunc) ([]tls.Certificate, error) {
+	res := make([]tls.Certificate, 0, 2)
+	for _, pair := range []*X509Pair{d.ECDSA, d.RSA} {
+		cert, err := tlsCertificate(pair, passphrase)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can`t load %s", FormatSerial(pair.Serial))
+		}
+		res = append(res, *cert)
+	}
+	return res, nil
+}
+
+// dualStackPeer return serial of dual stack peer from metadata, nil if there is none
+func dualStackPeer(metadata map[string]string) *big.Int {
+	value, ok := metadata[MetadataDualStackPeer]
+	if !ok {
+		return nil
+	}
+	serial, err := ParseSerial(value)
+	if err != nil {
+		return nil
+	}
+	return serial
+}
@@ -0,0 +1,90 @@
+package easyrsa
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_IssueDualStack(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithDuplicateCNPolicy(DuplicateCNReject))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	res, err := pki.IssueDualStack(CertRequest{CN: "web", Server: true, DNSNames: []string{"web.example.com"}})
+	assert.NoError(t, err)
+
+	_, rsaCert, err := res.RSA.DecodeSigner(nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &rsa.PublicKey{}, rsaCert.PublicKey)
+	signer, ecCert, err := res.ECDSA.DecodeSigner(nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &ecdsa.PrivateKey{}, signer)
+	assert.Equal(t, rsaCert.DNSNames, ecCert.DNSNames)
+	assert.Zero(t, ecCert.KeyUsage&x509.KeyUsageKeyEncipherment)
+	assert.Equal(t, FormatSerial(res.RSA.Serial), res.ECDSA.Metadata[MetadataDualStackPeer])
+	assert.False(t, pki.IsRevoked(res.RSA.Serial))
+
+	certs, err := res.Certificates(nil)
+	assert.NoError(t, err)
+	assert.Len(t, certs, 2)
+	assert.Equal(t, ecCert, certs[0].Leaf)
+	// rsa only client get rsa cert
+	hello := &tls.ClientHelloInfo{
+		ServerName:        "web.example.com",
+		SignatureSchemes:  []tls.SignatureScheme{tls.PKCS1WithSHA256},
+		SupportedVersions: []uint16{tls.VersionTLS12},
+		SupportedCurves:   []tls.CurveID{tls.CurveP256},
+		SupportedPoints:   []uint8{0},
+		CipherSuites:      []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+	}
+	assert.Error(t, hello.SupportsCertificate(&certs[0]))
+	assert.NoError(t, hello.SupportsCertificate(&certs[1]))
+
+	// peers are not duplicates, another issuance is
+	_, err = pki.IssueDualStack(CertRequest{CN: "web", Server: true})
+	assert.True(t, isPolicyViolation(err))
+	_, err = pki.IssueDualStack(CertRequest{CN: "csr", CSRPem: newTestCSR(t, "csr")})
+	assert.Error(t, err)
+	_, err = pki.Issue(CertRequest{CN: "meta", Metadata: map[string]string{MetadataDualStackPeer: "01"}})
+	assert.Error(t, err)
+}
+
+func TestPKI_IssueDualStack_supersede(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithSupersedeOnRenew(time.Hour))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	start := time.Now()
+	pki.clock = func() time.Time { return start }
+	first, err := pki.IssueDualStack(CertRequest{CN: "web", Server: true})
+	assert.NoError(t, err)
+	pki.clock = func() time.Time { return start.Add(2 * time.Hour) }
+	revoked, err := pki.RevokeSuperseded()
+	assert.NoError(t, err)
+	assert.Empty(t, revoked)
+
+	second, err := pki.IssueDualStack(CertRequest{CN: "web", Server: true})
+	assert.NoError(t, err)
+	pki.clock = func() time.Time { return start.Add(4 * time.Hour) }
+	revoked, err = pki.RevokeSuperseded()
+	assert.NoError(t, err)
+	assert.Len(t, revoked, 2)
+	assert.True(t, pki.IsRevoked(first.RSA.Serial))
+	assert.True(t, pki.IsRevoked(first.ECDSA.Serial))
+	assert.False(t, pki.IsRevoked(second.RSA.Serial))
+	assert.False(t, pki.IsRevoked(second.ECDSA.Serial))
+}
+
+func TestDeterministicECDSAKey(t *testing.T) {
+	a, err := deterministicECDSAKey(NewInsecureDeterministicReader("seed"))
+	assert.NoError(t, err)
+	b, _ := deterministicECDSAKey(NewInsecureDeterministicReader("seed"))
+	assert.True(t, a.Equal(b))
+	assert.True(t, a.Curve.IsOnCurve(a.X, a.Y)) //nolint:staticcheck
+}
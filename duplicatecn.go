@@ -0,0 +1,101 @@
+package easyrsa
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// DuplicateCNPolicy decide what happens when cert is issued for CN which already has active cert
+type DuplicateCNPolicy int
+
+const (
+	DuplicateCNAllow     DuplicateCNPolicy = iota // keep existing certs active, default
+	DuplicateCNSupersede                          // revoke active certs of CN as superseded once new cert is committed
+	DuplicateCNReject                             // reject issuance with PolicyViolation while CN has active cert
+)
+
+// WithDuplicateCNPolicy apply policy to leaf issuance of NewCert, SignCSR and all variants, so at most one cert
+// per CN is active. CA, CRL signer and cross certs are exempt. With DuplicateCNReject renewal needs the old cert
+// revoked first, DuplicateCNSupersede suits renewal, Reenroll and Reconcile. Active certs are counted from storage,
+// concurrent issuers for the same CN may still overshoot
+func WithDuplicateCNPolicy(policy DuplicateCNPolicy) Option {
+	return func(p *PKI) {
+		p.duplicateCN = policy
+	}
+}
+
+// checkDuplicateCN return PolicyViolation if policy reject new cert for cn, except certs are not counted
+func (p *PKI) checkDuplicateCN(cn string, except ...*big.Int) error {
+	if p.duplicateCN != DuplicateCNReject || duplicateCNExempt(cn) {
+		return nil
+	}
+	active, err := p.activeSerials(cn, except...)
+	if err != nil {
+		return err
+	}
+	if len(active) > 0 {
+		return errors.WithStack(NewPolicyViolation(
+			fmt.Sprintf("%s already has active cert %s", cn, FormatSerial(active[0]))))
+	}
+	return nil
+}
+
+// supersede revoke active certs of committed pair CN other than pair if policy require it, or due ones of
+// WithSupersedeOnRenew. It`s best effort, issuance is done already: failures, e.g. NotLeader on follower,
+// are reported to audit sinks as revocation events with Error and the certs stay active
+func (p *PKI) supersede(pair *X509Pair) {
+	if duplicateCNExempt(pair.CN) {
+		return
+	}
+	failed := func(serial *big.Int, reason string, err error) {
+		p.emitAudit(&AuditEvent{Operation: AuthOpRevoke, CN: pair.CN, Serial: serial, Time: p.now(), Reason: reason, Error: err.Error()})
+	}
+	if p.duplicateCN != DuplicateCNSupersede {
+		if p.supersedeOnRenew {
+			if _, err := p.revokeSuperseded(pair.CN); err != nil {
+				failed(nil, "superseded", err)
+			}
+		}
+		return
+	}
+	reason := "superseded by " + FormatSerial(pair.Serial)
+	active, err := p.activeSerials(pair.CN, pair.Serial, dualStackPeer(pair.Metadata))
+	if err != nil {
+		failed(nil, reason, err)
+		return
+	}
+	for _, serial := range active {
+		if err := p.RevokeWithReasonCode(serial, CRLReasonSuperseded, "", reason); err != nil {
+			failed(serial, reason, err)
+		}
+	}
+}
+
+// activeSerials return serials of not revoked and not expired certs of cn, except serials, nil ones are ignored
+func (p *PKI) activeSerials(cn string, except ...*big.Int) ([]*big.Int, error) {
+	now := p.now()
+	res := make([]*big.Int, 0)
+	err := ForEachByCN(p.Storage, cn, func(pair *X509Pair) error {
+		for _, serial := range except {
+			if serial != nil && pair.Serial.Cmp(serial) == 0 {
+				return nil
+			}
+		}
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil || !now.Before(cert.NotAfter) || p.IsRevoked(pair.Serial) {
+			return nil
+		}
+		res = append(res, pair.Serial)
+		return nil
+	})
+	if _, ok := errors.Cause(err).(*NotExist); ok {
+		return res, nil
+	}
+	return res, errors.Wrap(err, "can`t get active certs")
+}
+
+func duplicateCNExempt(cn string) bool {
+	return cn == "ca" || cn == CRLSignerCN || cn == CrossCertCN
+}
@@ -0,0 +1,87 @@
+package easyrsa
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithDuplicateCNPolicy(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithDuplicateCNPolicy(DuplicateCNReject))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	first, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	_, err = pki.NewCert("alice", false, nil)
+	assert.True(t, isPolicyViolation(err))
+	_, err = pki.SignCSR(newTestCSR(t, "alice"), "alice", false, nil)
+	assert.True(t, isPolicyViolation(err))
+	_, err = pki.NewCert("bob", false, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pki.RevokeOne(first.Serial))
+	second, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	// ca is exempt
+	_, err = pki.NewCa()
+	assert.NoError(t, err)
+
+	pki.duplicateCN = DuplicateCNSupersede
+	third, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	assert.True(t, pki.IsRevoked(second.Serial))
+	assert.False(t, pki.IsRevoked(third.Serial))
+	list, err := pki.GetCRL()
+	assert.NoError(t, err)
+	for _, revoked := range list.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(second.Serial) == 0 {
+			assert.Equal(t, CRLReasonSuperseded, crlReason(revoked))
+		}
+	}
+
+	pki.duplicateCN = DuplicateCNAllow
+	_, err = pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	assert.False(t, pki.IsRevoked(third.Serial))
+}
+
+func TestWithDuplicateCNPolicy_supersedeAfterCommit(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithDuplicateCNPolicy(DuplicateCNSupersede))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	old, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+
+	pki.commitHooks = []CommitHook{func(pair *X509Pair) error { return errors.New("inventory is down") }}
+	_, err = pki.NewCert("alice", false, nil)
+	assert.Error(t, err)
+	assert.False(t, pki.IsRevoked(old.Serial))
+	pairs, err := pki.Storage.GetByCN("alice")
+	assert.NoError(t, err)
+	assert.Len(t, pairs, 1)
+	pki.commitHooks = nil
+
+	// follower can`t revoke, issuance still succeed and failure is audited
+	follower := NewPKI(pki.Storage, pki.serialProvider, pki.crlHolder, pki.subjTemplate, WithKeySize(1024),
+		WithDuplicateCNPolicy(DuplicateCNSupersede),
+		WithLeaderElection(NewElector(NewFileLeaderLock(filepath.Join(testData, "leader")), "b", time.Minute)))
+	acquired, err := NewFileLeaderLock(filepath.Join(testData, "leader")).Acquire("a", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	var events []*AuditEvent
+	follower.auditSinks = []AuditSink{func(event *AuditEvent) { events = append(events, event) }}
+	renewed, err := follower.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	assert.False(t, follower.IsRevoked(old.Serial))
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, AuthOpIssue, events[0].Operation)
+		assert.Equal(t, AuthOpRevoke, events[1].Operation)
+		assert.Equal(t, old.Serial, events[1].Serial)
+		assert.Equal(t, "superseded by "+FormatSerial(renewed.Serial), events[1].Reason)
+		assert.Contains(t, events[1].Error, "leader")
+	}
+}
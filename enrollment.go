@@ -0,0 +1,250 @@
+package easyrsa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+)
+
+// DefaultEnrollmentTokenTTL is a lifetime of tokens returned by NewEnrollmentToken
+const DefaultEnrollmentTokenTTL = 7 * 24 * time.Hour
+
+// EnrollmentToken is a pending one time enrollment token, secret itself is not stored
+type EnrollmentToken struct {
+	Hash    string    `json:"hash"`              // hex sha256 of token secret
+	CN      string    `json:"cn"`                // token is valid only for cn
+	Profile string    `json:"profile,omitempty"` // token is valid only for profile, for built-in templates if empty
+	Expires time.Time `json:"expires"`           // token is rejected after
+	Created time.Time `json:"created"`           // when token was generated
+	Actor   string    `json:"actor,omitempty"`   // who generated token
+}
+
+// EnrollmentTokenStore persist pending enrollment tokens
+type EnrollmentTokenStore interface {
+	Put(token *EnrollmentToken) error           // Put add token.
+	Take(hash string) (*EnrollmentToken, error) // Take remove token with hash and return it, NotExist if it`s absent.
+	List() ([]*EnrollmentToken, error)          // List return pending tokens sorted by CN and creation time.
+	Prune(now time.Time) (int, error)           // Prune remove tokens expired before now and return their count.
+}
+
+// WithEnrollmentTokens require one time token from NewEnrollmentToken in challengePassword of every signed CSR,
+// for SignCSR and all variants including http enrollment. Token is consumed by the first request using it,
+// even rejected one. CSRPolicy.RequireChallenge is ignored, both use challengePassword
+func WithEnrollmentTokens(store EnrollmentTokenStore) Option {
+	return func(p *PKI) {
+		p.enrollmentTokens = store
+	}
+}
+
+// NewEnrollmentToken generate one time token for enrollment of cn with profile, valid for ttl,
+// DefaultEnrollmentTokenTTL if zero. Returned secret is not stored and should be handed to the device,
+// e.g. in bootstrap image, to prove it`s allowed to enroll without prior identity
+func (p *PKI) NewEnrollmentToken(cn, profile string, ttl time.Duration, actor string) (string, error) {
+	if p.enrollmentTokens == nil {
+		return "", errors.New("enrollment tokens are not configured")
+	}
+	if cn == "" || cn == "ca" {
+		return "", errors.Errorf("cn %q can`t be enrolled", cn)
+	}
+	if profile != "" {
+		if _, err := p.Profile(profile); err != nil {
+			return "", err
+		}
+	}
+	if ttl <= 0 {
+		ttl = DefaultEnrollmentTokenTTL
+	}
+	b := make([]byte, 20)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", errors.Wrap(err, "can`t generate enrollment token")
+	}
+	secret := base32.StdEncoding.EncodeToString(b)
+	now := p.now()
+	err := p.enrollmentTokens.Put(&EnrollmentToken{
+		Hash:    enrollmentTokenHash(secret),
+		CN:      cn,
+		Profile: profile,
+		Expires: now.Add(ttl),
+		Created: now,
+		Actor:   actor,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "can`t store enrollment token")
+	}
+	return secret, nil
+}
+
+// EnrollmentTokens return pending enrollment tokens, expired ones are pruned first
+func (p *PKI) EnrollmentTokens() ([]*EnrollmentToken, error) {
+	if p.enrollmentTokens == nil {
+		return nil, errors.New("enrollment tokens are not configured")
+	}
+	if _, err := p.enrollmentTokens.Prune(p.now()); err != nil {
+		return nil, errors.Wrap(err, "can`t prune enrollment tokens")
+	}
+	return p.enrollmentTokens.List()
+}
+
+// RevokeEnrollmentToken remove pending token with hash, NotExist if it`s already used or removed
+func (p *PKI) RevokeEnrollmentToken(hash string) error {
+	if p.enrollmentTokens == nil {
+		return errors.New("enrollment tokens are not configured")
+	}
+	_, err := p.enrollmentTokens.Take(hash)
+	return err
+}
+
+// consumeEnrollmentToken take token from challengePassword of csr, PolicyViolation is returned if it`s missing,
+// expired or bound to other cn or profile
+func (p *PKI) consumeEnrollmentToken(csr *x509.CertificateRequest, cn, profile string) error {
+	secret, err := challengePassword(csr)
+	if err != nil {
+		return err
+	}
+	token, err := p.enrollmentTokens.Take(enrollmentTokenHash(secret))
+	if _, ok := errors.Cause(err).(*NotExist); ok {
+		return errors.WithStack(NewPolicyViolation("enrollment token is unknown or already used"))
+	}
+	if err != nil {
+		return errors.Wrap(err, "can`t consume enrollment token")
+	}
+	if p.now().After(token.Expires) {
+		return errors.WithStack(NewPolicyViolation("enrollment token is expired"))
+	}
+	if token.CN != cn || token.Profile != profile {
+		return errors.WithStack(NewPolicyViolation("enrollment token is issued for other cn or profile"))
+	}
+	return nil
+}
+
+// enrollmentTokenHash return hex sha256 of secret, case and spaces are ignored for typed tokens
+func enrollmentTokenHash(secret string) string {
+	secret = strings.ToUpper(strings.Join(strings.Fields(secret), ""))
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// FileEnrollmentTokenStore implement EnrollmentTokenStore interface with json file, shared by processes with file lock
+type FileEnrollmentTokenStore struct {
+	locker *flock.Flock
+	path   string
+}
+
+func NewFileEnrollmentTokenStore(path string) *FileEnrollmentTokenStore {
+	return &FileEnrollmentTokenStore{locker: flock.New(path + ".lock"), path: path}
+}
+
+func (s *FileEnrollmentTokenStore) Put(token *EnrollmentToken) error {
+	return s.update(func(tokens map[string]*EnrollmentToken) error {
+		tokens[token.Hash] = token
+		return nil
+	})
+}
+
+func (s *FileEnrollmentTokenStore) Take(hash string) (*EnrollmentToken, error) {
+	var res *EnrollmentToken
+	err := s.update(func(tokens map[string]*EnrollmentToken) error {
+		token, ok := tokens[hash]
+		if !ok {
+			return errors.WithStack(NewNotExist("enrollment token is not pending"))
+		}
+		delete(tokens, hash)
+		res = token
+		return nil
+	})
+	return res, err
+}
+
+func (s *FileEnrollmentTokenStore) List() ([]*EnrollmentToken, error) {
+	if err := s.locker.RLock(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = s.locker.Unlock()
+	}()
+	tokens, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return sortedEnrollmentTokens(tokens), nil
+}
+
+func (s *FileEnrollmentTokenStore) Prune(now time.Time) (int, error) {
+	pruned := 0
+	err := s.update(func(tokens map[string]*EnrollmentToken) error {
+		for hash, token := range tokens {
+			if now.After(token.Expires) {
+				delete(tokens, hash)
+				pruned++
+			}
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+func (s *FileEnrollmentTokenStore) update(fn func(tokens map[string]*EnrollmentToken) error) error {
+	if err := s.locker.Lock(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = s.locker.Unlock()
+	}()
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(tokens); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(sortedEnrollmentTokens(tokens), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "can`t encode enrollment tokens")
+	}
+	return errors.Wrap(writeFileAtomic(s.path, append(data, '\n'), 0600), "can`t write enrollment tokens")
+}
+
+func (s *FileEnrollmentTokenStore) read() (map[string]*EnrollmentToken, error) {
+	tokens := make(map[string]*EnrollmentToken)
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t read enrollment tokens")
+	}
+	list := make([]*EnrollmentToken, 0)
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, errors.Wrap(err, "can`t parse enrollment tokens")
+	}
+	for _, token := range list {
+		tokens[token.Hash] = token
+	}
+	return tokens, nil
+}
+
+func sortedEnrollmentTokens(tokens map[string]*EnrollmentToken) []*EnrollmentToken {
+	res := make([]*EnrollmentToken, 0, len(tokens))
+	for _, token := range tokens {
+		res = append(res, token)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].CN != res[j].CN {
+			return res[i].CN < res[j].CN
+		}
+		return res[i].Created.Before(res[j].Created)
+	})
+	return res
+}
@@ -0,0 +1,101 @@
+package easyrsa
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_NewEnrollmentToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithEnrollmentTokens(NewFileEnrollmentTokenStore(path)),
+		WithProfiles(&Profile{Name: "device", ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	_, err = pki.NewEnrollmentToken("dev", "missing", 0, "admin")
+	assert.Error(t, err)
+
+	_, err = pki.SignCSR(newTestCSR(t, "dev"), "dev", false, nil)
+	assert.True(t, isPolicyViolation(err))
+
+	token, err := pki.NewEnrollmentToken("dev", "", 0, "admin")
+	assert.NoError(t, err)
+	tokens, err := pki.EnrollmentTokens()
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 1)
+	assert.Equal(t, "admin", tokens[0].Actor)
+	assert.Equal(t, enrollmentTokenHash(token), tokens[0].Hash)
+	_, err = pki.SignCSR(newChallengeCSR(t, "dev", token), "dev", false, nil)
+	assert.NoError(t, err)
+	// one time
+	_, err = pki.SignCSR(newChallengeCSR(t, "dev", token), "dev", false, nil)
+	assert.True(t, isPolicyViolation(err))
+
+	// bound to cn and profile, consumed by rejected request too
+	token, err = pki.NewEnrollmentToken("dev", "device", time.Hour, "admin")
+	assert.NoError(t, err)
+	_, err = pki.SignCSR(newChallengeCSR(t, "dev", token), "dev", false, nil)
+	assert.True(t, isPolicyViolation(err))
+	_, err = pki.SignCSRWithProfile(newChallengeCSR(t, "dev", token), "dev", "device")
+	assert.True(t, isPolicyViolation(err))
+	token, err = pki.NewEnrollmentToken("dev", "device", time.Hour, "admin")
+	assert.NoError(t, err)
+	_, err = pki.SignCSRWithProfile(newChallengeCSR(t, "dev", strings.ToLower(token)), "dev", "device")
+	assert.NoError(t, err)
+
+	token, err = pki.NewEnrollmentToken("dev", "", time.Hour, "admin")
+	assert.NoError(t, err)
+	pki.clock = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = pki.SignCSR(newChallengeCSR(t, "dev", token), "dev", false, nil)
+	assert.True(t, isPolicyViolation(err))
+	pki.clock = nil
+
+	_, err = pki.NewEnrollmentToken("other", "", time.Hour, "admin")
+	assert.NoError(t, err)
+	tokens, err = NewFileEnrollmentTokenStore(path).List()
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 1)
+	assert.NoError(t, pki.RevokeEnrollmentToken(tokens[0].Hash))
+	assert.Error(t, pki.RevokeEnrollmentToken(tokens[0].Hash))
+}
+
+func TestVaultFacade_EnrollmentToken(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024),
+		WithEnrollmentTokens(NewFileEnrollmentTokenStore(filepath.Join(t.TempDir(), "tokens.json"))))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	facade := NewVaultFacade(pki, &VaultRole{Name: "device"})
+	// devices have no credentials but enrollment token in CSR
+	facade.Auth = &APIAuth{
+		Authenticator: AuthenticatorFunc(func(ctx context.Context, creds *Credentials) (*Identity, error) {
+			return &Identity{Name: "device"}, nil
+		}),
+		Rules: AuthorizationRules{{Identities: []string{"device"}, CNs: []string{"*"}}},
+	}
+	server := httptest.NewServer(facade)
+	defer server.Close()
+	sign := func(csr []byte) int {
+		body, _ := json.Marshal(map[string]interface{}{"csr": string(csr)})
+		res, err := http.Post(server.URL+"/sign/device", "application/json", bytes.NewReader(body))
+		assert.NoError(t, err)
+		_ = res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.NotEqual(t, http.StatusOK, sign(newTestCSR(t, "dev.pki.local")))
+	token, err := pki.NewEnrollmentToken("dev.pki.local", "", 0, "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, sign(newChallengeCSR(t, "dev.pki.local", token)))
+	assert.NotEqual(t, http.StatusOK, sign(newChallengeCSR(t, "dev.pki.local", token)))
+}
@@ -11,3 +11,87 @@ func (e *NotExist) Error() string {
 func NewNotExist(err string) *NotExist {
 	return &NotExist{err: err}
 }
+
+type NotFIPSApproved struct {
+	err string
+}
+
+func (e *NotFIPSApproved) Error() string {
+	return e.err
+}
+
+func NewNotFIPSApproved(err string) *NotFIPSApproved {
+	return &NotFIPSApproved{err: err}
+}
+
+type QuotaExceeded struct {
+	err string
+}
+
+func (e *QuotaExceeded) Error() string {
+	return e.err
+}
+
+func NewQuotaExceeded(err string) *QuotaExceeded {
+	return &QuotaExceeded{err: err}
+}
+
+type PolicyViolation struct {
+	err string
+}
+
+func (e *PolicyViolation) Error() string {
+	return e.err
+}
+
+func NewPolicyViolation(err string) *PolicyViolation {
+	return &PolicyViolation{err: err}
+}
+
+type NotLeader struct {
+	err string
+}
+
+func (e *NotLeader) Error() string {
+	return e.err
+}
+
+func NewNotLeader(err string) *NotLeader {
+	return &NotLeader{err: err}
+}
+
+type Unauthenticated struct {
+	err string
+}
+
+func (e *Unauthenticated) Error() string {
+	return e.err
+}
+
+func NewUnauthenticated(err string) *Unauthenticated {
+	return &Unauthenticated{err: err}
+}
+
+type UntrustedTime struct {
+	err string
+}
+
+func (e *UntrustedTime) Error() string {
+	return e.err
+}
+
+func NewUntrustedTime(err string) *UntrustedTime {
+	return &UntrustedTime{err: err}
+}
+
+type InvalidRequest struct {
+	err string
+}
+
+func (e *InvalidRequest) Error() string {
+	return e.err
+}
+
+func NewInvalidRequest(err string) *InvalidRequest {
+	return &InvalidRequest{err: err}
+}
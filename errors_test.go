@@ -59,3 +59,183 @@ func TestNotExist_Error(t *testing.T) {
 		})
 	}
 }
+
+func TestNewNotFIPSApproved(t *testing.T) {
+	type args struct {
+		err string
+	}
+	tests := []struct {
+		name string
+		args args
+		want *NotFIPSApproved
+	}{
+		{
+			name: "just create",
+			args: args{
+				err: "msg",
+			},
+			want: &NotFIPSApproved{"msg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewNotFIPSApproved(tt.args.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewNotFIPSApproved() = %v, want %v", got, tt.want)
+			}
+			if got.Error() != tt.args.err {
+				t.Errorf("NotFIPSApproved.Error() = %v, want %v", got.Error(), tt.args.err)
+			}
+		})
+	}
+}
+
+func TestNewQuotaExceeded(t *testing.T) {
+	type args struct {
+		err string
+	}
+	tests := []struct {
+		name string
+		args args
+		want *QuotaExceeded
+	}{
+		{
+			name: "just create",
+			args: args{
+				err: "msg",
+			},
+			want: &QuotaExceeded{"msg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewQuotaExceeded(tt.args.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewQuotaExceeded() = %v, want %v", got, tt.want)
+			}
+			if got.Error() != tt.args.err {
+				t.Errorf("QuotaExceeded.Error() = %v, want %v", got.Error(), tt.args.err)
+			}
+		})
+	}
+}
+
+func TestNewPolicyViolation(t *testing.T) {
+	type args struct {
+		err string
+	}
+	tests := []struct {
+		name string
+		args args
+		want *PolicyViolation
+	}{
+		{
+			name: "just create",
+			args: args{
+				err: "msg",
+			},
+			want: &PolicyViolation{"msg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewPolicyViolation(tt.args.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewPolicyViolation() = %v, want %v", got, tt.want)
+			}
+			if got.Error() != tt.args.err {
+				t.Errorf("PolicyViolation.Error() = %v, want %v", got.Error(), tt.args.err)
+			}
+		})
+	}
+}
+
+func TestNewNotLeader(t *testing.T) {
+	type args struct {
+		err string
+	}
+	tests := []struct {
+		name string
+		args args
+		want *NotLeader
+	}{
+		{
+			name: "just create",
+			args: args{
+				err: "msg",
+			},
+			want: &NotLeader{"msg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewNotLeader(tt.args.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewNotLeader() = %v, want %v", got, tt.want)
+			}
+			if got.Error() != tt.args.err {
+				t.Errorf("NotLeader.Error() = %v, want %v", got.Error(), tt.args.err)
+			}
+		})
+	}
+}
+
+func TestNewUnauthenticated(t *testing.T) {
+	type args struct {
+		err string
+	}
+	tests := []struct {
+		name string
+		args args
+		want *Unauthenticated
+	}{
+		{
+			name: "just create",
+			args: args{
+				err: "msg",
+			},
+			want: &Unauthenticated{"msg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewUnauthenticated(tt.args.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewUnauthenticated() = %v, want %v", got, tt.want)
+			}
+			if got.Error() != tt.args.err {
+				t.Errorf("Unauthenticated.Error() = %v, want %v", got.Error(), tt.args.err)
+			}
+		})
+	}
+}
+
+func TestNewUntrustedTime(t *testing.T) {
+	type args struct {
+		err string
+	}
+	tests := []struct {
+		name string
+		args args
+		want *UntrustedTime
+	}{
+		{
+			name: "just create",
+			args: args{
+				err: "msg",
+			},
+			want: &UntrustedTime{"msg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewUntrustedTime(tt.args.err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewUntrustedTime() = %v, want %v", got, tt.want)
+			}
+			if got.Error() != tt.args.err {
+				t.Errorf("UntrustedTime.Error() = %v, want %v", got.Error(), tt.args.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PEMCMSBlock is a pem block type of CMS enveloped data, as read by openssl cms -inform PEM
+const PEMCMSBlock = "CMS"
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidRSAESOAEP     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidMGF1          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+)
+
+type cmsKeyTransRecipientInfo struct {
+	Version                int
+	RID                    cmsIssuerAndSerial
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type cmsEncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type cmsEnvelopedData struct {
+	Version              int
+	RecipientInfos       []cmsKeyTransRecipientInfo `asn1:"set"`
+	EncryptedContentInfo cmsEncryptedContentInfo
+}
+
+type rsaesOAEPParams struct {
+	Hash pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MGF  pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+}
+
+// EscrowEnvelope is a CMS enveloped data of escrowed key or key share
+type EscrowEnvelope struct {
+	Recipients []string `json:"recipients"` // subjects of officers able to open the envelope
+	CMS        []byte   `json:"cms"`        // pem encoded CMS enveloped data
+}
+
+// EscrowRecord is an escrowed private key of issued pair
+type EscrowRecord struct {
+	Serial    *big.Int          `json:"serial"`    // cert serial
+	CN        string            `json:"cn"`        // cn of the pair
+	Time      time.Time         `json:"time"`      // when escrowed
+	Threshold int               `json:"threshold"` // envelopes needed to recover the key
+	Envelopes []*EscrowEnvelope `json:"envelopes"` // one envelope for all officers, or one envelope with key share per officer
+}
+
+// KeyEscrowStore persist escrow records
+type KeyEscrowStore interface {
+	Put(record *EscrowRecord) error             // Put record, overwrite if already exist.
+	Get(serial *big.Int) (*EscrowRecord, error) // Get record of serial, NotExist if key is not escrowed.
+}
+
+// KeyEscrow configure escrow of issued private keys to escrow officers
+type KeyEscrow struct {
+	Officers  []*x509.Certificate       // RSA certs of escrow officers, at least two
+	Threshold int                       // officers needed to recover a key, any single officer if less than 2
+	Store     KeyEscrowStore            // store of escrow records
+	Filter    func(pair *X509Pair) bool // escrow only pairs it accept, e.g. S/MIME profile, all pairs if nil
+}
+
+// WithKeyEscrow encrypt private key of every issued pair to escrow officers and keep it in escrow store,
+// issuance is rolled back if the key can`t be escrowed. Pairs without key (signed CSRs) and CA pairs are skipped.
+// Escrow is done as commit hook, see WithCertArchive about hooks order
+func WithKeyEscrow(escrow *KeyEscrow) Option {
+	return func(p *PKI) {
+		p.commitHooks = append(p.commitHooks, func(pair *X509Pair) error {
+			return p.escrowPair(escrow, pair)
+		})
+	}
+}
+
+func (p *PKI) escrowPair(escrow *KeyEscrow, pair *X509Pair) error {
+	if !pair.HasKey() || pair.CN == "ca" || (escrow.Filter != nil && !escrow.Filter(pair)) {
+		return nil
+	}
+	envelopes, err := EscrowKey(pair.KeyPemBytes, escrow.Officers, escrow.Threshold)
+	if err != nil {
+		return err
+	}
+	threshold := escrow.Threshold
+	if threshold < 2 {
+		threshold = 1
+	}
+	record := &EscrowRecord{Serial: pair.Serial, CN: pair.CN, Time: p.now().UTC(), Threshold: threshold, Envelopes: envelopes}
+	return errors.Wrap(escrow.Store.Put(record), "can`t escrow key")
+}
+
+// EscrowKey encrypt keyPem to officers. Below threshold 2 the key is enveloped once to all officers,
+// otherwise it`s split with SplitSecret to share per officer and threshold officers must open their envelopes
+func EscrowKey(keyPem []byte, officers []*x509.Certificate, threshold int) ([]*EscrowEnvelope, error) {
+	if len(officers) < 2 {
+		return nil, errors.New("at least two escrow officers are required")
+	}
+	if threshold > len(officers) {
+		return nil, errors.Errorf("threshold %d is greater than %d officers", threshold, len(officers))
+	}
+	if threshold < 2 {
+		cms, err := encryptCMS(keyPem, officers)
+		if err != nil {
+			return nil, err
+		}
+		recipients := make([]string, 0, len(officers))
+		for _, officer := range officers {
+			recipients = append(recipients, officer.Subject.String())
+		}
+		return []*EscrowEnvelope{{Recipients: recipients, CMS: cms}}, nil
+	}
+	shares, err := SplitSecret(keyPem, len(officers), threshold)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, share := range shares {
+			zeroBytes(share)
+		}
+	}()
+	res := make([]*EscrowEnvelope, 0, len(officers))
+	for i, officer := range officers {
+		cms, err := encryptCMS(shares[i], officers[i:i+1])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &EscrowEnvelope{Recipients: []string{officer.Subject.String()}, CMS: cms})
+	}
+	return res, nil
+}
+
+// OpenEscrowEnvelope decrypt pem CMS envelope with officer cert and key, key may be in HSM.
+// Opened content is the key or key share of RecoverEscrowedKey
+func OpenEscrowEnvelope(cmsPem []byte, officer *x509.Certificate, key crypto.Decrypter) ([]byte, error) {
+	block, _ := pem.Decode(cmsPem)
+	if block == nil || block.Type != PEMCMSBlock {
+		return nil, errors.New("can`t find cms pem block")
+	}
+	var info cmsContentInfo
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		return nil, errors.Wrap(err, "can`t parse cms")
+	}
+	if !info.ContentType.Equal(oidEnvelopedData) {
+		return nil, errors.New("cms is not enveloped data")
+	}
+	var envelope cmsEnvelopedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &envelope); err != nil {
+		return nil, errors.Wrap(err, "can`t parse enveloped data")
+	}
+	var encryptedKey []byte
+	for _, recipient := range envelope.RecipientInfos {
+		if bytes.Equal(recipient.RID.Issuer.FullBytes, officer.RawIssuer) && recipient.RID.Serial.Cmp(officer.SerialNumber) == 0 {
+			encryptedKey = recipient.EncryptedKey
+		}
+	}
+	if encryptedKey == nil {
+		return nil, errors.New("officer is not a recipient of envelope")
+	}
+	cek, err := key.Decrypt(rand.Reader, encryptedKey, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t decrypt content key")
+	}
+	defer zeroBytes(cek)
+	content := envelope.EncryptedContentInfo
+	if !content.ContentEncryptionAlgorithm.Algorithm.Equal(oidAES256CBC) {
+		return nil, errors.New("unsupported content encryption algorithm")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(content.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("wrong content encryption iv")
+	}
+	if len(content.EncryptedContent) == 0 || len(content.EncryptedContent)%aes.BlockSize != 0 {
+		return nil, errors.New("wrong encrypted content length")
+	}
+	c, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, errors.Wrap(err, "wrong content key")
+	}
+	plain := make([]byte, len(content.EncryptedContent))
+	cipher.NewCBCDecrypter(c, iv).CryptBlocks(plain, content.EncryptedContent)
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		zeroBytes(plain)
+		return nil, errors.New("wrong content padding")
+	}
+	return plain[:len(plain)-pad], nil
+}
+
+// RecoverEscrowedKey return pem key of record from contents of opened envelopes,
+// at least record threshold of them for split key
+func RecoverEscrowedKey(record *EscrowRecord, opened [][]byte) ([]byte, error) {
+	if len(opened) == 0 || len(opened) < record.Threshold {
+		return nil, errors.Errorf("%d of %d opened envelopes", len(opened), record.Threshold)
+	}
+	if record.Threshold < 2 {
+		return opened[0], nil
+	}
+	return CombineShares(opened)
+}
+
+// encryptCMS return pem CMS enveloped data of content for RSA recipients,
+// content key is encrypted with RSAES-OAEP SHA-256 and content with AES-256-CBC
+func encryptCMS(content []byte, recipients []*x509.Certificate) ([]byte, error) {
+	cek := make([]byte, 32)
+	if _, err := rand.Read(cek); err != nil {
+		return nil, errors.Wrap(err, "can`t generate content key")
+	}
+	defer zeroBytes(cek)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, errors.Wrap(err, "can`t generate iv")
+	}
+	c, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	pad := aes.BlockSize - len(content)%aes.BlockSize
+	plain := append(append([]byte{}, content...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	defer zeroBytes(plain)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(c, iv).CryptBlocks(encrypted, plain)
+
+	oaep, err := oaepAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]cmsKeyTransRecipientInfo, 0, len(recipients))
+	for _, recipient := range recipients {
+		pub, ok := recipient.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.Errorf("escrow officer %s has no rsa key", recipient.Subject)
+		}
+		key, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, cek, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can`t encrypt content key to %s", recipient.Subject)
+		}
+		infos = append(infos, cmsKeyTransRecipientInfo{
+			RID:                    cmsIssuerAndSerial{Issuer: asn1.RawValue{FullBytes: recipient.RawIssuer}, Serial: recipient.SerialNumber},
+			KeyEncryptionAlgorithm: oaep,
+			EncryptedKey:           key,
+		})
+	}
+	ivBytes, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := asn1.Marshal(cmsEnvelopedData{
+		RecipientInfos: infos,
+		EncryptedContentInfo: cmsEncryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivBytes}},
+			EncryptedContent:           encrypted,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t encode enveloped data")
+	}
+	der, err := asn1.Marshal(cmsContentInfo{
+		ContentType: oidEnvelopedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: envelope},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t encode cms")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMCMSBlock, Bytes: der}), nil
+}
+
+func oaepAlgorithm() (pkix.AlgorithmIdentifier, error) {
+	sha := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	shaBytes, err := asn1.Marshal(sha)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	params, err := asn1.Marshal(rsaesOAEPParams{
+		Hash: sha,
+		MGF:  pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: shaBytes}},
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, errors.Wrap(err, "can`t encode oaep params")
+	}
+	return pkix.AlgorithmIdentifier{Algorithm: oidRSAESOAEP, Parameters: asn1.RawValue{FullBytes: params}}, nil
+}
+
+// DirKeyEscrowStore implement KeyEscrowStore interface with json file per serial in dir
+type DirKeyEscrowStore struct {
+	dir string
+}
+
+func NewDirKeyEscrowStore(dir string) *DirKeyEscrowStore {
+	return &DirKeyEscrowStore{dir: dir}
+}
+
+func (s *DirKeyEscrowStore) path(serial *big.Int) string {
+	return filepath.Join(s.dir, serial.Text(16)+".json")
+}
+
+func (s *DirKeyEscrowStore) Put(record *EscrowRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "can`t encode escrow record")
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return errors.Wrap(err, "can`t create escrow dir")
+	}
+	return errors.Wrap(writeFileAtomic(s.path(record.Serial), append(data, '\n'), 0600), "can`t write escrow record")
+}
+
+func (s *DirKeyEscrowStore) Get(serial *big.Int) (*EscrowRecord, error) {
+	data, err := ioutil.ReadFile(s.path(serial))
+	if os.IsNotExist(err) {
+		return nil, errors.WithStack(NewNotExist("key of " + serial.Text(16) + " is not escrowed"))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t read escrow record")
+	}
+	record := &EscrowRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, errors.Wrap(err, "can`t parse escrow record")
+	}
+	return record, nil
+}
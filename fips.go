@@ -0,0 +1,93 @@
+package easyrsa
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// FIPSMinRSAKeySize is a minimal rsa key size allowed in FIPS mode
+const FIPSMinRSAKeySize = 2048
+
+// WithFIPSMode restrict PKI to FIPS 140 approved algorithms and key sizes
+func WithFIPSMode() Option {
+	return func(p *PKI) {
+		p.fips = true
+	}
+}
+
+// FIPSMode return true if PKI restricted to FIPS approved algorithms by option or by go runtime (GODEBUG=fips140=on)
+func (p *PKI) FIPSMode() bool {
+	return p.fips || fipsRuntimeEnabled()
+}
+
+// VerifyFIPS check the last CA against FIPS restrictions.
+// Intended to be called once at startup, does nothing if FIPS mode is off
+func (p *PKI) VerifyFIPS() error {
+	if !p.FIPSMode() {
+		return nil
+	}
+	caPair, err := p.GetLastCA()
+	if err != nil {
+		if _, ok := errors.Cause(err).(*NotExist); ok {
+			return nil
+		}
+		return errors.Wrap(err, "can`t get ca pair")
+	}
+	caCert, err := decodeCert(caPair.CertPemBytes)
+	if err != nil {
+		return errors.Wrap(err, "can`t parse ca cert")
+	}
+	return checkFIPSCert(caCert)
+}
+
+// checkFIPS return error if PKI in FIPS mode and cert is not compliant
+func (p *PKI) checkFIPS(cert *x509.Certificate) error {
+	if !p.FIPSMode() {
+		return nil
+	}
+	return checkFIPSCert(cert)
+}
+
+func checkFIPSCert(cert *x509.Certificate) error {
+	if err := checkFIPSPublicKey(cert.PublicKey); err != nil {
+		return err
+	}
+	return checkFIPSSignatureAlgorithm(cert.SignatureAlgorithm)
+}
+
+func checkFIPSPublicKey(pub crypto.PublicKey) error {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < FIPSMinRSAKeySize {
+			return NewNotFIPSApproved(fmt.Sprintf("rsa key size %d is too small", key.N.BitLen()))
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return NewNotFIPSApproved("ecdsa curve is not approved")
+		}
+	case ed25519.PublicKey:
+	default:
+		return NewNotFIPSApproved(fmt.Sprintf("key type %T is not approved", pub))
+	}
+	return nil
+}
+
+func checkFIPSSignatureAlgorithm(alg x509.SignatureAlgorithm) error {
+	switch alg {
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS,
+		x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512,
+		x509.PureEd25519:
+		return nil
+	}
+	return NewNotFIPSApproved(fmt.Sprintf("signature algorithm %s is not approved", alg))
+}
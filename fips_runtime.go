@@ -0,0 +1,10 @@
+//go:build go1.24
+// +build go1.24
+
+package easyrsa
+
+import "crypto/fips140"
+
+func fipsRuntimeEnabled() bool {
+	return fips140.Enabled()
+}
@@ -0,0 +1,8 @@
+//go:build !go1.24
+// +build !go1.24
+
+package easyrsa
+
+func fipsRuntimeEnabled() bool {
+	return false
+}
@@ -0,0 +1,73 @@
+package easyrsa
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFIPSPublicKey(t *testing.T) {
+	small, _ := rsa.GenerateKey(rand.Reader, 1024)
+	good, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p224, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.IsType(t, &NotFIPSApproved{}, checkFIPSPublicKey(&small.PublicKey))
+	assert.NoError(t, checkFIPSPublicKey(&good.PublicKey))
+	assert.IsType(t, &NotFIPSApproved{}, checkFIPSPublicKey(&p224.PublicKey))
+	assert.NoError(t, checkFIPSPublicKey(&p256.PublicKey))
+	assert.Error(t, checkFIPSSignatureAlgorithm(x509.SHA1WithRSA))
+	assert.NoError(t, checkFIPSSignatureAlgorithm(x509.SHA256WithRSA))
+}
+
+func TestPKI_VerifyFIPS(t *testing.T) {
+	pki, cleanup := getTmpPki(WithFIPSMode())
+	defer cleanup()
+	assert.True(t, pki.FIPSMode())
+	t.Run("without ca", func(t *testing.T) {
+		assert.NoError(t, pki.VerifyFIPS())
+	})
+	t.Run("good ca", func(t *testing.T) {
+		_, _ = pki.NewCa()
+		assert.NoError(t, pki.VerifyFIPS())
+		_, err := pki.NewCert("client", false, []string{""})
+		assert.NoError(t, err)
+	})
+	t.Run("weak ca", func(t *testing.T) {
+		key, _ := rsa.GenerateKey(rand.Reader, 1024)
+		tml := &x509.Certificate{
+			SerialNumber:          big.NewInt(100),
+			Subject:               pkix.Name{CommonName: "ca"},
+			NotBefore:             time.Now(),
+			NotAfter:              time.Now().Add(time.Hour),
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		}
+		der, _ := x509.CreateCertificate(rand.Reader, tml, tml, &key.PublicKey, key)
+		_ = pki.Storage.Put(NewX509Pair(encodeKey(key),
+			pem.EncodeToMemory(&pem.Block{Type: PEMCertificateBlock, Bytes: der}), "ca", big.NewInt(100)))
+		assert.IsType(t, &NotFIPSApproved{}, pki.VerifyFIPS())
+		_, err := pki.NewCert("client", false, []string{""})
+		assert.Error(t, err)
+		assert.Error(t, pki.RevokeOne(big.NewInt(2)))
+	})
+}
+
+func TestPKI_FIPSKeySize(t *testing.T) {
+	pki, cleanup := getTmpPki(WithFIPSMode(), WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.IsType(t, &NotFIPSApproved{}, errors.Cause(err))
+	_, _, err = pki.NewIntermediateCSR()
+	assert.IsType(t, &NotFIPSApproved{}, errors.Cause(err))
+}
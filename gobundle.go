@@ -0,0 +1,206 @@
+package easyrsa
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"go/format"
+	"go/token"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GoBundleOptions configure Go source generated by GoSource and GoEmbedTar
+type GoBundleOptions struct {
+	Package string // package name, "trust" if empty
+	Name    string // prefix of generated identifiers, "CA" if empty
+	Pins    bool   // generate <Name>Pins with hex sha256 of subject public key info and <Name>VerifyPins
+	LeafPEM []byte // leaf certs embedded as <Name>LeafPEM and pinned too, e.g. server certs of clients. Keys are ignored
+}
+
+// goBundle is a data of goBundleTemplate
+type goBundle struct {
+	Package string
+	Name    string
+	Embed   bool
+	CAPEM   string
+	LeafPEM string
+	Pins    []string
+}
+
+var goBundleTemplate = template.Must(template.New("bundle").Parse(`// Code generated by go-easyrsa; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"crypto/x509"
+	{{- if .Pins}}
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	{{- end}}
+	{{- if .Embed}}
+	_ "embed"
+	{{- end}}
+)
+
+// {{.Name}}PEM is an embedded CA bundle
+{{- if .Embed}}
+//
+//go:embed ca.pem
+var {{.Name}}PEM []byte
+{{- else}}
+var {{.Name}}PEM = []byte(` + "`{{.CAPEM}}`" + `)
+{{- end}}
+{{if .LeafPEM}}
+// {{.Name}}LeafPEM is an embedded leaf certs
+{{- if .Embed}}
+//
+//go:embed leaf.pem
+var {{.Name}}LeafPEM []byte
+{{- else}}
+var {{.Name}}LeafPEM = []byte(` + "`{{.LeafPEM}}`" + `)
+{{- end}}
+{{end}}
+// {{.Name}}Pool return cert pool of embedded CA bundle
+func {{.Name}}Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM({{.Name}}PEM)
+	return pool
+}
+{{if .Pins}}
+// {{.Name}}Pins are hex sha256 fingerprints of subject public key info of pinned certs
+var {{.Name}}Pins = []string{
+{{- range .Pins}}
+	"{{.}}",
+{{- end}}
+}
+
+// {{.Name}}VerifyPins return error if no peer cert public key is pinned, signature match tls.Config.VerifyPeerCertificate
+func {{.Name}}VerifyPins(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		fingerprint := hex.EncodeToString(sum[:])
+		for _, pin := range {{.Name}}Pins {
+			if pin == fingerprint {
+				return nil
+			}
+		}
+	}
+	return errors.New("no pinned public key in peer certificates")
+}
+{{end}}`))
+
+// GoSource return gofmt formatted Go source with bundle pem, pool constructor and optional pins,
+// for teams compiling trust anchors into binaries
+func (b *TrustBundle) GoSource(opts GoBundleOptions) ([]byte, error) {
+	data, err := b.goBundle(opts, false)
+	if err != nil {
+		return nil, err
+	}
+	return renderGoBundle(data)
+}
+
+// GoEmbedTar write tar with bundle.go loading ca.pem (and leaf.pem) with go:embed, ready to unpack to package dir
+func (b *TrustBundle) GoEmbedTar(w io.Writer, opts GoBundleOptions) error {
+	data, err := b.goBundle(opts, true)
+	if err != nil {
+		return err
+	}
+	source, err := renderGoBundle(data)
+	if err != nil {
+		return err
+	}
+	files := []struct {
+		name    string
+		content []byte
+	}{{"bundle.go", source}, {"ca.pem", b.PEM}}
+	if data.LeafPEM != "" {
+		files = append(files, struct {
+			name    string
+			content []byte
+		}{"leaf.pem", []byte(data.LeafPEM)})
+	}
+	tw := tar.NewWriter(w)
+	modTime := time.Now()
+	for _, file := range files {
+		hdr := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content)), ModTime: modTime}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.Wrap(err, "can`t write tar header")
+		}
+		if _, err := tw.Write(file.content); err != nil {
+			return errors.Wrap(err, "can`t write tar")
+		}
+	}
+	return errors.Wrap(tw.Close(), "can`t write tar")
+}
+
+func (b *TrustBundle) goBundle(opts GoBundleOptions, embed bool) (*goBundle, error) {
+	data := &goBundle{Package: opts.Package, Name: opts.Name, Embed: embed, CAPEM: string(b.PEM)}
+	if data.Package == "" {
+		data.Package = "trust"
+	}
+	if data.Name == "" {
+		data.Name = "CA"
+	}
+	if !token.IsIdentifier(data.Package) || !token.IsIdentifier(data.Name) {
+		return nil, errors.Errorf("wrong go identifiers %q, %q", data.Package, data.Name)
+	}
+	if len(b.Certs) == 0 {
+		return nil, errors.New("empty trust bundle")
+	}
+	leaves := make([]*x509.Certificate, 0)
+	leafPem := bytes.NewBuffer(nil)
+	for _, cert := range splitPEMCerts(opts.LeafPEM) {
+		leaf, err := decodeCert([]byte(cert))
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, leaf)
+		leafPem.WriteString(cert + "\n")
+	}
+	data.LeafPEM = leafPem.String()
+	if strings.Contains(data.CAPEM+data.LeafPEM, "`") {
+		return nil, errors.New("pem contains backtick")
+	}
+	if !opts.Pins {
+		return data, nil
+	}
+	for _, entry := range b.Certs {
+		cert, err := decodeCert([]byte(entry.PEM))
+		if err != nil {
+			return nil, err
+		}
+		data.Pins = append(data.Pins, spkiFingerprint(cert))
+	}
+	for _, leaf := range leaves {
+		data.Pins = append(data.Pins, spkiFingerprint(leaf))
+	}
+	data.Pins = sortedUniq(data.Pins)
+	return data, nil
+}
+
+func renderGoBundle(data *goBundle) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := goBundleTemplate.Execute(buf, data); err != nil {
+		return nil, errors.Wrap(err, "can`t render go bundle")
+	}
+	source, err := format.Source(buf.Bytes())
+	return source, errors.Wrap(err, "can`t format go bundle")
+}
+
+// spkiFingerprint return hex sha256 of cert subject public key info
+func spkiFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
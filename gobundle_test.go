@@ -0,0 +1,79 @@
+package easyrsa
+
+import (
+	"archive/tar"
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// typeCheckGo parse and type check generated files as one package
+func typeCheckGo(t *testing.T, files map[string][]byte) *types.Package {
+	fset := token.NewFileSet()
+	parsed := make([]*ast.File, 0, len(files))
+	for name, src := range files {
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		assert.NoError(t, err)
+		parsed = append(parsed, f)
+	}
+	conf := types.Config{Importer: importer.Default()}
+	pkg, err := conf.Check("trust", fset, parsed, nil)
+	assert.NoError(t, err)
+	return pkg
+}
+
+func TestTrustBundle_GoSource(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	server, err := pki.NewCert("server", true, nil)
+	assert.NoError(t, err)
+	bundle, err := pki.ExportTrustBundle()
+	assert.NoError(t, err)
+
+	source, err := bundle.GoSource(GoBundleOptions{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(source), "DO NOT EDIT")
+	assert.Contains(t, string(source), "package trust")
+	pkg := typeCheckGo(t, map[string][]byte{"bundle.go": source})
+	assert.NotNil(t, pkg.Scope().Lookup("CAPool"))
+	assert.Nil(t, pkg.Scope().Lookup("CAPins"))
+
+	source, err = bundle.GoSource(GoBundleOptions{Package: "pins", Name: "Corp", Pins: true, LeafPEM: append(append([]byte{}, server.KeyPemBytes...), server.CertPemBytes...)})
+	assert.NoError(t, err)
+	cert, err := decodeCert(server.CertPemBytes)
+	assert.NoError(t, err)
+	assert.Contains(t, string(source), spkiFingerprint(cert))
+	assert.NotContains(t, string(source), "PRIVATE KEY")
+	pkg = typeCheckGo(t, map[string][]byte{"bundle.go": source})
+	assert.NotNil(t, pkg.Scope().Lookup("CorpVerifyPins"))
+	assert.NotNil(t, pkg.Scope().Lookup("CorpLeafPEM"))
+
+	_, err = bundle.GoSource(GoBundleOptions{Name: "not-ident"})
+	assert.Error(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, bundle.GoEmbedTar(buf, GoBundleOptions{Pins: true}))
+	files := make(map[string][]byte)
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		files[hdr.Name], err = io.ReadAll(tr)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, bundle.PEM, files["ca.pem"])
+	assert.Contains(t, string(files["bundle.go"]), "//go:embed ca.pem")
+	typeCheckGo(t, map[string][]byte{"bundle.go": files["bundle.go"]})
+}
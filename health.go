@@ -0,0 +1,74 @@
+package easyrsa
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Checker can be implemented by SerialProvider, KeyStorage or CRLHolder to report own status
+type Checker interface {
+	Check() error // Check return nil if component is ready
+}
+
+// Health represent PKI status suitable for readiness probes
+type Health struct {
+	CANotAfter     time.Time     // expire time of the last CA
+	CAExpiresIn    time.Duration // time until the last CA expire, negative if already expired
+	CADaysToExpiry int           // CAExpiresIn in whole days rounded down, e.g. 0 for 23h left and -1 just after expiry
+	CRLThisUpdate  time.Time     // this update field of the current CRL, zero if no CRL yet
+	CRLNextUpdate  time.Time     // next update field of the current CRL, zero if no CRL yet
+	CRLFresh       bool          // true if CRL is absent or it`s next update is in the future
+	CA             error         // CA lookup or decode error
+	CRL            error         // CRL holder error
+	Storage        error         // storage reachability error
+	SerialProvider error         // serial provider error
+}
+
+// OK return true if all components are healthy
+func (h *Health) OK() bool {
+	return h.CA == nil && h.CRL == nil && h.Storage == nil && h.SerialProvider == nil &&
+		h.CRLFresh && h.CAExpiresIn > 0
+}
+
+// Health collect status of CA, CRL, storage and serial provider
+func (p *PKI) Health() *Health {
+	res := &Health{}
+	now := p.now()
+
+	if checker, ok := p.Storage.(Checker); ok {
+		res.Storage = checker.Check()
+	}
+	caPair, err := p.GetLastCA()
+	if err != nil {
+		if _, ok := errors.Cause(err).(*NotExist); ok || res.Storage != nil {
+			res.CA = err
+		} else {
+			res.Storage = err
+		}
+	} else {
+		_, caCert, err := caPair.Decode()
+		if err != nil {
+			res.CA = errors.Wrap(err, "can`t decode ca")
+		} else {
+			res.CANotAfter = caCert.NotAfter
+			res.CAExpiresIn = caCert.NotAfter.Sub(now)
+			res.CADaysToExpiry = int(math.Floor(res.CAExpiresIn.Hours() / 24))
+		}
+	}
+
+	list, err := p.GetCRL()
+	if err != nil {
+		res.CRL = err
+	} else {
+		res.CRLThisUpdate = list.TBSCertList.ThisUpdate
+		res.CRLNextUpdate = list.TBSCertList.NextUpdate
+		res.CRLFresh = res.CRLNextUpdate.IsZero() || now.Before(res.CRLNextUpdate)
+	}
+
+	if checker, ok := p.serialProvider.(Checker); ok {
+		res.SerialProvider = checker.Check()
+	}
+	return res
+}
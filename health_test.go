@@ -0,0 +1,65 @@
+package easyrsa
+
+import (
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_Health(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	t.Run("without ca", func(t *testing.T) {
+		health := pki.Health()
+		assert.Error(t, health.CA)
+		assert.NoError(t, health.Storage)
+		assert.NoError(t, health.SerialProvider)
+		assert.NoError(t, health.CRL)
+		assert.True(t, health.CRLFresh)
+		assert.False(t, health.OK())
+	})
+	t.Run("with ca", func(t *testing.T) {
+		_, _ = pki.NewCa()
+		_ = pki.RevokeOne(big.NewInt(42))
+		health := pki.Health()
+		assert.NoError(t, health.CA)
+		assert.True(t, health.CADaysToExpiry > 365)
+		assert.False(t, health.CRLNextUpdate.IsZero())
+		assert.True(t, health.OK())
+
+		ca, err := pki.GetLastCA()
+		assert.NoError(t, err)
+		_, caCert, err := ca.Decode()
+		assert.NoError(t, err)
+		for left, days := range map[time.Duration]int{23 * time.Hour: 0, -time.Hour: -1, -25 * time.Hour: -2} {
+			pki.clock = func() time.Time { return caCert.NotAfter.Add(-left) }
+			health = pki.Health()
+			assert.Equal(t, left, health.CAExpiresIn)
+			assert.Equal(t, days, health.CADaysToExpiry, left)
+		}
+		pki.clock = nil
+	})
+	t.Run("serial file is not created", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "serial")
+		provider := NewFileSerialProvider(path)
+		assert.NoError(t, provider.Check())
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+		assert.Error(t, NewFileSerialProvider(filepath.Join(path, "serial")).Check())
+		assert.Error(t, NewFileSerialProvider(filepath.Dir(path)).Check())
+	})
+	t.Run("broken storage", func(t *testing.T) {
+		storDir := filepath.Join(getTestDir(), "dir_keystorage", "bad_path")
+		broken := NewPKI(NewDirKeyStorage(storDir), NewFileSerialProvider(filepath.Join(storDir, "serial")),
+			NewFileCRLHolder(filepath.Join(getTestDir(), "dir_keystorage", "not_exist_crl.pem")), pkix.Name{})
+		health := broken.Health()
+		assert.Error(t, health.Storage)
+		assert.Error(t, health.SerialProvider)
+		assert.False(t, health.OK())
+	})
+}
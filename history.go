@@ -0,0 +1,83 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CertStatus is a status of one cert generation of CN
+type CertStatus string
+
+const (
+	CertActive     CertStatus = "active"     // the newest valid not revoked generation
+	CertSuperseded CertStatus = "superseded" // valid and not revoked, but newer generation exist
+	CertRevoked    CertStatus = "revoked"    // listed in the CRL
+	CertExpired    CertStatus = "expired"    // NotAfter passed, not revoked
+)
+
+// HistoryEntry is one cert generation of CN
+type HistoryEntry struct {
+	Pair      *X509Pair         // stored pair
+	Cert      *x509.Certificate // decoded cert
+	Status    CertStatus        // status at the time of GetHistoryByCN
+	RevokedAt time.Time         // revocation time for revoked certs
+}
+
+// GetHistoryByCN return all generations of cn ordered by issuance with their status.
+// Pairs with undecodable cert are skipped, NotExist is returned if cn has no pairs
+func (p *PKI) GetHistoryByCN(cn string) ([]*HistoryEntry, error) {
+	list, err := p.GetCRL()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get crl")
+	}
+	revoked := make(map[string]time.Time)
+	for _, cert := range list.TBSCertList.RevokedCertificates {
+		revoked[cert.SerialNumber.Text(16)] = cert.RevocationTime
+	}
+
+	res := make([]*HistoryEntry, 0)
+	err = ForEachByCN(p.Storage, cn, func(pair *X509Pair) error {
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil {
+			return nil
+		}
+		res = append(res, &HistoryEntry{Pair: pair, Cert: cert})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get pairs")
+	}
+	if len(res) == 0 {
+		return nil, errors.WithStack(NewNotExist(fmt.Sprintf("no pairs with cn %s", cn)))
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].Cert.NotBefore.Equal(res[j].Cert.NotBefore) {
+			return res[i].Cert.NotBefore.Before(res[j].Cert.NotBefore)
+		}
+		return res[i].Pair.Serial.Cmp(res[j].Pair.Serial) < 0
+	})
+
+	now := p.now()
+	active := false
+	for i := len(res) - 1; i >= 0; i-- {
+		entry := res[i]
+		if at, ok := revoked[entry.Pair.Serial.Text(16)]; ok {
+			entry.Status, entry.RevokedAt = CertRevoked, at
+			continue
+		}
+		switch {
+		case now.After(entry.Cert.NotAfter):
+			entry.Status = CertExpired
+		case active:
+			entry.Status = CertSuperseded
+		default:
+			entry.Status = CertActive
+			active = true
+		}
+	}
+	return res, nil
+}
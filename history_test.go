@@ -0,0 +1,57 @@
+package easyrsa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_GetHistoryByCN(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithValidity(0, time.Hour))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	past := time.Now().Add(-2 * time.Hour)
+	pki.clock = func() time.Time { return past }
+	expired, err := pki.NewCert("host", false, nil)
+	assert.NoError(t, err)
+	pki.clock = nil
+	revoked, err := pki.NewCert("host", false, nil)
+	assert.NoError(t, err)
+	superseded, err := pki.NewCert("host", false, nil)
+	assert.NoError(t, err)
+	active, err := pki.NewCert("host", false, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pki.RevokeOne(revoked.Serial))
+
+	history, err := pki.GetHistoryByCN("host")
+	assert.NoError(t, err)
+	if assert.Len(t, history, 4) {
+		want := []struct {
+			pair   *X509Pair
+			status CertStatus
+		}{
+			{expired, CertExpired},
+			{revoked, CertRevoked},
+			{superseded, CertSuperseded},
+			{active, CertActive},
+		}
+		for i, w := range want {
+			assert.Equal(t, w.pair.Serial, history[i].Pair.Serial)
+			assert.Equal(t, w.status, history[i].Status)
+		}
+		assert.False(t, history[1].RevokedAt.IsZero())
+	}
+
+	assert.NoError(t, pki.RevokeOne(active.Serial))
+	history, err = pki.GetHistoryByCN("host")
+	assert.NoError(t, err)
+	assert.Equal(t, CertActive, history[2].Status, "the newest not revoked becomes active")
+
+	_, err = pki.GetHistoryByCN("nobody")
+	_, ok := errors.Cause(err).(*NotExist)
+	assert.True(t, ok)
+}
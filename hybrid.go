@@ -0,0 +1,217 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+)
+
+// extensions of alternative public key and signature of ITU-T X.509 (10/2019) 9.8
+var (
+	oidSubjectAltPublicKeyInfo = asn1.ObjectIdentifier{2, 5, 29, 72}
+	oidAltSignatureAlgorithm   = asn1.ObjectIdentifier{2, 5, 29, 73}
+	oidAltSignatureValue       = asn1.ObjectIdentifier{2, 5, 29, 74}
+)
+
+// HybridSigner is an alternative, e.g. post-quantum, signer of hybrid certs. Sign get the message itself
+// with crypto.Hash(0) as opts
+type HybridSigner interface {
+	crypto.Signer
+	AlgorithmIdentifier() pkix.AlgorithmIdentifier // algorithm of public key and signatures
+	PublicKeyBytes() []byte                        // public key as in subjectPublicKey bit string
+}
+
+// HybridVerifyFunc verify signature of message with alternative public key of algorithm
+type HybridVerifyFunc func(algorithm pkix.AlgorithmIdentifier, publicKey, message, signature []byte) error
+
+// WithExperimentalHybrid issue hybrid certs, classical certs with alternative signature of signer in
+// non critical extensions, ignored by verifiers unaware of them. CAs created with the option carry signer
+// public key, certs are issued only by CA carrying it. Can`t be used with WithCTLogs.
+// EXPERIMENTAL, for post-quantum migration tests, format and API may change
+func WithExperimentalHybrid(signer HybridSigner) Option {
+	return func(p *PKI) {
+		p.hybrid = signer
+	}
+}
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// hybridSign add alternative signature extensions to tml issued by parent with signer.
+// Cert is signed once without signature value to get pre-TBS bytes, key of parent sign it again after,
+// crypto/x509 append extra extensions last so TBS bytes are the same but the value extension
+func (p *PKI) hybridSign(tml, parent *x509.Certificate, pub crypto.PublicKey, key crypto.Signer) error {
+	if len(p.ctLogs) > 0 {
+		return errors.New("hybrid certs can`t have embedded scts")
+	}
+	alg := p.hybrid.AlgorithmIdentifier()
+	extensions := make([]pkix.Extension, 0, len(tml.ExtraExtensions)+3)
+	for _, ext := range tml.ExtraExtensions {
+		if !ext.Id.Equal(oidSubjectAltPublicKeyInfo) && !ext.Id.Equal(oidAltSignatureAlgorithm) && !ext.Id.Equal(oidAltSignatureValue) {
+			extensions = append(extensions, ext)
+		}
+	}
+	spki, err := asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: alg,
+		PublicKey: asn1.BitString{Bytes: p.hybrid.PublicKeyBytes(), BitLength: 8 * len(p.hybrid.PublicKeyBytes())},
+	})
+	if err != nil {
+		return errors.Wrap(err, "can`t marshal alternative public key")
+	}
+	if tml == parent {
+		extensions = append(extensions, pkix.Extension{Id: oidSubjectAltPublicKeyInfo, Value: spki})
+	} else if value, ok := findExtension(parent.Extensions, oidSubjectAltPublicKeyInfo); !ok || !bytes.Equal(value, spki) {
+		return errors.New("ca has no alternative public key of hybrid signer")
+	}
+	algDer, err := asn1.Marshal(alg)
+	if err != nil {
+		return errors.Wrap(err, "can`t marshal alternative signature algorithm")
+	}
+	tml.ExtraExtensions = append(extensions, pkix.Extension{Id: oidAltSignatureAlgorithm, Value: algDer})
+
+	der, err := x509.CreateCertificate(p.rand(), tml, parent, pub, key)
+	if err != nil {
+		return errors.Wrap(err, "can`t create pre-tbs certificate")
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return errors.Wrap(err, "can`t parse pre-tbs certificate")
+	}
+	preTBS, err := preTBSCertificate(cert.RawTBSCertificate)
+	if err != nil {
+		return err
+	}
+	sig, err := p.hybrid.Sign(p.rand(), preTBS, crypto.Hash(0))
+	if err != nil {
+		return errors.Wrap(err, "can`t create alternative signature")
+	}
+	sigDer, err := asn1.Marshal(asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)})
+	if err != nil {
+		return errors.Wrap(err, "can`t marshal alternative signature")
+	}
+	tml.ExtraExtensions = append(tml.ExtraExtensions, pkix.Extension{Id: oidAltSignatureValue, Value: sigDer})
+	return nil
+}
+
+// VerifyHybrid verify alternative signature of cert with alternative public key of issuer, it`s issuer
+// itself for self signed CA. Classical signature is not verified
+func VerifyHybrid(cert, issuer *x509.Certificate, verify HybridVerifyFunc) error {
+	spkiDer, ok := findExtension(issuer.Extensions, oidSubjectAltPublicKeyInfo)
+	if !ok {
+		return errors.New("issuer has no alternative public key")
+	}
+	var spki subjectPublicKeyInfo
+	if rest, err := asn1.Unmarshal(spkiDer, &spki); err != nil || len(rest) > 0 {
+		return errors.New("can`t parse alternative public key")
+	}
+	algDer, ok := findExtension(cert.Extensions, oidAltSignatureAlgorithm)
+	if !ok {
+		return errors.New("cert has no alternative signature algorithm")
+	}
+	var alg pkix.AlgorithmIdentifier
+	if rest, err := asn1.Unmarshal(algDer, &alg); err != nil || len(rest) > 0 {
+		return errors.New("can`t parse alternative signature algorithm")
+	}
+	if !alg.Algorithm.Equal(spki.Algorithm.Algorithm) {
+		return errors.Errorf("alternative signature algorithm %s does not match issuer key %s",
+			alg.Algorithm, spki.Algorithm.Algorithm)
+	}
+	sigDer, ok := findExtension(cert.Extensions, oidAltSignatureValue)
+	if !ok {
+		return errors.New("cert has no alternative signature")
+	}
+	var sig asn1.BitString
+	if rest, err := asn1.Unmarshal(sigDer, &sig); err != nil || len(rest) > 0 {
+		return errors.New("can`t parse alternative signature")
+	}
+	preTBS, err := preTBSCertificate(cert.RawTBSCertificate)
+	if err != nil {
+		return err
+	}
+	if err := verify(alg, spki.PublicKey.RightAlign(), preTBS, sig.RightAlign()); err != nil {
+		return errors.Wrap(err, "wrong alternative signature")
+	}
+	return nil
+}
+
+func findExtension(extensions []pkix.Extension, id asn1.ObjectIdentifier) ([]byte, bool) {
+	for _, ext := range extensions {
+		if ext.Id.Equal(id) {
+			return ext.Value, true
+		}
+	}
+	return nil, false
+}
+
+// preTBSCertificate return TBS without signature algorithm field and alternative signature value extension,
+// the message of alternative signature
+func preTBSCertificate(tbs []byte) ([]byte, error) {
+	var seq asn1.RawValue
+	if rest, err := asn1.Unmarshal(tbs, &seq); err != nil || len(rest) > 0 {
+		return nil, errors.New("can`t parse tbs certificate")
+	}
+	res := bytes.NewBuffer(nil)
+	rest := seq.Bytes
+	serialSeen, signatureSkipped := false, false
+	for len(rest) > 0 {
+		var field asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			return nil, errors.Wrap(err, "can`t parse tbs certificate")
+		}
+		switch {
+		case !serialSeen && field.Class == asn1.ClassUniversal && field.Tag == asn1.TagInteger:
+			serialSeen = true
+		case serialSeen && !signatureSkipped:
+			signatureSkipped = true
+			continue
+		case field.Class == asn1.ClassContextSpecific && field.Tag == 3:
+			extensions, err := stripAltSignatureValue(field.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			field = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: extensions}
+			der, err := asn1.Marshal(field)
+			if err != nil {
+				return nil, errors.Wrap(err, "can`t marshal extensions")
+			}
+			field.FullBytes = der
+		}
+		res.Write(field.FullBytes)
+	}
+	if !signatureSkipped {
+		return nil, errors.New("tbs certificate has no signature algorithm")
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: res.Bytes()})
+}
+
+// stripAltSignatureValue return DER sequence of extensions without alternative signature value
+func stripAltSignatureValue(der []byte) ([]byte, error) {
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &seq); err != nil {
+		return nil, errors.Wrap(err, "can`t parse extensions")
+	}
+	res := bytes.NewBuffer(nil)
+	rest := seq.Bytes
+	for len(rest) > 0 {
+		var raw asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &raw); err != nil {
+			return nil, errors.Wrap(err, "can`t parse extension")
+		}
+		var ext pkix.Extension
+		if _, err := asn1.Unmarshal(raw.FullBytes, &ext); err != nil {
+			return nil, errors.Wrap(err, "can`t parse extension")
+		}
+		if !ext.Id.Equal(oidAltSignatureValue) {
+			res.Write(raw.FullBytes)
+		}
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: res.Bytes()})
+}
@@ -0,0 +1,73 @@
+//go:build go1.27
+// +build go1.27
+
+package easyrsa
+
+import (
+	"crypto/mldsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/pkg/errors"
+)
+
+// ML-DSA algorithm identifiers of RFC 9881, parameters are absent
+var (
+	oidMLDSA44 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 17}
+	oidMLDSA65 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 18}
+	oidMLDSA87 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 19}
+)
+
+type mldsaHybridSigner struct {
+	*mldsa.PrivateKey
+	oid asn1.ObjectIdentifier
+}
+
+// NewMLDSAHybridSigner return hybrid signer of ML-DSA key for WithExperimentalHybrid
+func NewMLDSAHybridSigner(key *mldsa.PrivateKey) (HybridSigner, error) {
+	oid, err := mldsaOID(key.PublicKey().Parameters())
+	if err != nil {
+		return nil, err
+	}
+	return &mldsaHybridSigner{PrivateKey: key, oid: oid}, nil
+}
+
+func (s *mldsaHybridSigner) AlgorithmIdentifier() pkix.AlgorithmIdentifier {
+	return pkix.AlgorithmIdentifier{Algorithm: s.oid}
+}
+
+func (s *mldsaHybridSigner) PublicKeyBytes() []byte {
+	return s.PublicKey().Bytes()
+}
+
+// VerifyMLDSA is a HybridVerifyFunc of ML-DSA signatures
+func VerifyMLDSA(algorithm pkix.AlgorithmIdentifier, publicKey, message, signature []byte) error {
+	var params mldsa.Parameters
+	switch {
+	case algorithm.Algorithm.Equal(oidMLDSA44):
+		params = mldsa.MLDSA44()
+	case algorithm.Algorithm.Equal(oidMLDSA65):
+		params = mldsa.MLDSA65()
+	case algorithm.Algorithm.Equal(oidMLDSA87):
+		params = mldsa.MLDSA87()
+	default:
+		return errors.Errorf("unsupported alternative signature algorithm %s", algorithm.Algorithm)
+	}
+	pub, err := mldsa.NewPublicKey(params, publicKey)
+	if err != nil {
+		return errors.Wrap(err, "can`t parse ml-dsa public key")
+	}
+	return mldsa.Verify(pub, message, signature, nil)
+}
+
+func mldsaOID(params mldsa.Parameters) (asn1.ObjectIdentifier, error) {
+	switch params {
+	case mldsa.MLDSA44():
+		return oidMLDSA44, nil
+	case mldsa.MLDSA65():
+		return oidMLDSA65, nil
+	case mldsa.MLDSA87():
+		return oidMLDSA87, nil
+	}
+	return nil, errors.Errorf("unsupported ml-dsa parameters %s", params)
+}
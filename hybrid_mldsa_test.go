@@ -0,0 +1,30 @@
+//go:build go1.27
+// +build go1.27
+
+package easyrsa
+
+import (
+	"crypto/mldsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMLDSAHybridSigner(t *testing.T) {
+	key, err := mldsa.GenerateKey(mldsa.MLDSA65())
+	assert.NoError(t, err)
+	signer, err := NewMLDSAHybridSigner(key)
+	assert.NoError(t, err)
+	assert.Equal(t, oidMLDSA65, signer.AlgorithmIdentifier().Algorithm)
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithExperimentalHybrid(signer))
+	defer cleanup()
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+	pair, err := pki.NewCert("server", true, []string{""})
+	assert.NoError(t, err)
+	caCert, _ := decodeCert(ca.CertPemBytes)
+	cert, _ := decodeCert(pair.CertPemBytes)
+	assert.NoError(t, VerifyHybrid(caCert, caCert, VerifyMLDSA))
+	assert.NoError(t, VerifyHybrid(cert, caCert, VerifyMLDSA))
+	assert.NoError(t, cert.CheckSignatureFrom(caCert))
+}
@@ -0,0 +1,69 @@
+package easyrsa
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// ed25519HybridSigner is a stand in alternative signer, it sign messages directly as ML-DSA do
+type ed25519HybridSigner struct {
+	ed25519.PrivateKey
+}
+
+func (s ed25519HybridSigner) AlgorithmIdentifier() pkix.AlgorithmIdentifier {
+	return pkix.AlgorithmIdentifier{Algorithm: oidEd25519}
+}
+
+func (s ed25519HybridSigner) PublicKeyBytes() []byte {
+	return s.PrivateKey.Public().(ed25519.PublicKey)
+}
+
+func verifyEd25519(algorithm pkix.AlgorithmIdentifier, publicKey, message, signature []byte) error {
+	if !algorithm.Algorithm.Equal(oidEd25519) || !ed25519.Verify(publicKey, message, signature) {
+		return errors.New("wrong signature")
+	}
+	return nil
+}
+
+func TestWithExperimentalHybrid(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithExperimentalHybrid(ed25519HybridSigner{key}))
+	defer cleanup()
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+	caCert, _ := decodeCert(ca.CertPemBytes)
+	assert.NoError(t, caCert.CheckSignatureFrom(caCert))
+	assert.NoError(t, VerifyHybrid(caCert, caCert, verifyEd25519))
+
+	pair, err := pki.NewCert("server", true, []string{""})
+	assert.NoError(t, err)
+	cert, _ := decodeCert(pair.CertPemBytes)
+	assert.NoError(t, cert.CheckSignatureFrom(caCert))
+	assert.NoError(t, VerifyHybrid(cert, caCert, verifyEd25519))
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	assert.NoError(t, err)
+
+	t.Run("mismatch", func(t *testing.T) {
+		classical := *caCert
+		classical.Extensions = []pkix.Extension{}
+		assert.Error(t, VerifyHybrid(cert, &classical, verifyEd25519))
+		assert.Error(t, VerifyHybrid(cert, caCert, func(pkix.AlgorithmIdentifier, []byte, []byte, []byte) error {
+			return errors.New("wrong signature")
+		}))
+		_, other, _ := ed25519.GenerateKey(rand.Reader)
+		pki.hybrid = ed25519HybridSigner{other}
+		_, err := pki.NewCert("other", true, []string{""})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,194 @@
+package easyrsa
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultIdempotencyWindow is a window of idempotency key replays if WithIdempotencyWindow is not set
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// Metadata tags of pairs issued with idempotency key, they can`t be set by callers
+const (
+	MetadataIdempotencyKey     = "idempotency_key"     // idempotency key of the request
+	MetadataIdempotencyRequest = "idempotency_request" // sha256 of request parameters
+)
+
+// WithIdempotencyWindow set how long idempotency key return the pair issued for it
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(p *PKI) {
+		p.idempotencyWindow = window
+	}
+}
+
+// idempotencyCache index idempotency keys within the window. Keys of stored pairs are loaded with one storage scan
+// on first use, e.g. after restart, new keys are added on issuance, so keys missing here were never issued
+type idempotencyCache struct {
+	mu      sync.Mutex
+	load    sync.Mutex // serialize loading of stored keys
+	group   singleflight.Group
+	entries map[string]idempotencyEntry
+	loaded  bool // keys of stored pairs are loaded
+}
+
+type idempotencyEntry struct {
+	serial  *big.Int
+	request string
+	issued  time.Time
+}
+
+// NewCertIdempotent generate new pair as NewCert. Replay of key within the idempotency window return the pair
+// issued for it instead of minting a new one, PolicyViolation is returned if key is replayed with other parameters
+func (p *PKI) NewCertIdempotent(key string, cn string, server bool, groups []string) (*X509Pair, error) {
+	request := idempotencyRequest(cn, server, groups, nil)
+	return p.idempotent(key, request, func(metadata map[string]string) (*X509Pair, error) {
+		if err := p.requireAttestation(); err != nil {
+			return nil, err
+		}
+		return p.issueRequest(CertRequest{CN: cn, Server: server, Groups: groups, Metadata: metadata})
+	})
+}
+
+// SignCSRIdempotent issue cert for CSR as SignCSR with replay of key handled as in NewCertIdempotent
+func (p *PKI) SignCSRIdempotent(key string, csrPem []byte, cn string, server bool, groups []string) (*X509Pair, error) {
+	csr, err := decodeCSR(csrPem)
+	if err != nil {
+		return nil, err
+	}
+	request := idempotencyRequest(cn, server, groups, csr.Raw)
+	return p.idempotent(key, request, func(metadata map[string]string) (*X509Pair, error) {
+		if err := p.requireAttestation(); err != nil {
+			return nil, err
+		}
+		if err := p.checkCSR(csr, cn, ""); err != nil {
+			return nil, err
+		}
+		return p.issueRequest(CertRequest{CN: cn, Server: server, Groups: groups, CSR: csr, Metadata: metadata})
+	})
+}
+
+// idempotencyRequest return fingerprint of request parameters
+func idempotencyRequest(cn string, server bool, groups []string, csr []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %t %q ", cn, server, strings.Join(groups, "\x00"))
+	h.Write(csr)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotent return pair issued for key or call issue, concurrent calls with the same key share the result
+func (p *PKI) idempotent(key, request string, issue func(metadata map[string]string) (*X509Pair, error)) (*X509Pair, error) {
+	if key == "" {
+		return nil, errors.New("empty idempotency key")
+	}
+	c := &p.idempotency
+	res, err, _ := c.group.Do(key, func() (interface{}, error) {
+		pair, err := p.idempotentReplay(key, request)
+		if err != nil || pair != nil {
+			return pair, err
+		}
+		pair, err = issue(map[string]string{MetadataIdempotencyKey: key, MetadataIdempotencyRequest: request})
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.entries[key] = idempotencyEntry{serial: pair.Serial, request: request, issued: p.now()}
+		c.mu.Unlock()
+		return pair, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*X509Pair), nil
+}
+
+// idempotentReplay return pair issued for key within the window, nil if there is none
+func (p *PKI) idempotentReplay(key, request string) (*X509Pair, error) {
+	window := p.idempotencyWindow
+	if window <= 0 {
+		window = DefaultIdempotencyWindow
+	}
+	now := p.now()
+	if err := p.loadIdempotencyKeys(window, now); err != nil {
+		return nil, err
+	}
+	c := &p.idempotency
+	c.mu.Lock()
+	for k, entry := range c.entries {
+		if now.Sub(entry.issued) > window {
+			delete(c.entries, k)
+		}
+	}
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+
+	pair, err := p.Storage.GetBySerial(entry.serial)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get pair of idempotency key")
+	}
+	if pair.Metadata[MetadataIdempotencyRequest] != request {
+		return nil, errors.WithStack(NewPolicyViolation("idempotency key is reused with other request"))
+	}
+	if p.IsRevoked(pair.Serial) {
+		return nil, errors.WithStack(NewPolicyViolation("pair of idempotency key is revoked"))
+	}
+	return p.result(pair), nil
+}
+
+// loadIdempotencyKeys index keys of stored pairs issued within the window, storage is scanned only once
+func (p *PKI) loadIdempotencyKeys(window time.Duration, now time.Time) error {
+	c := &p.idempotency
+	c.load.Lock()
+	defer c.load.Unlock()
+	c.mu.Lock()
+	loaded := c.loaded
+	c.mu.Unlock()
+	if loaded {
+		return nil
+	}
+	entries := make(map[string]idempotencyEntry)
+	err := ForEach(p.Storage, func(pair *X509Pair) error {
+		key, ok := pair.Metadata[MetadataIdempotencyKey]
+		if !ok {
+			return nil
+		}
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil {
+			return nil
+		}
+		issued := cert.NotBefore.Add(NotBeforeBackdate)
+		if now.Sub(issued) > window {
+			return nil
+		}
+		if current, ok := entries[key]; ok && current.serial.Cmp(pair.Serial) > 0 {
+			return nil
+		}
+		entries[key] = idempotencyEntry{serial: pair.Serial, request: pair.Metadata[MetadataIdempotencyRequest], issued: issued}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "can`t load idempotency keys")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]idempotencyEntry)
+	}
+	for key, entry := range entries {
+		if current, ok := c.entries[key]; !ok || current.serial.Cmp(entry.serial) < 0 {
+			c.entries[key] = entry
+		}
+	}
+	c.loaded = true
+	return nil
+}
@@ -0,0 +1,99 @@
+package easyrsa
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_NewCertIdempotent(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithIdempotencyWindow(time.Hour))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	first, err := pki.NewCertIdempotent("req-1", "web", true, nil)
+	assert.NoError(t, err)
+	replay, err := pki.NewCertIdempotent("req-1", "web", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, first.Serial, replay.Serial)
+	assert.Equal(t, first.KeyPemBytes, replay.KeyPemBytes)
+
+	_, err = pki.NewCertIdempotent("req-1", "web", false, nil)
+	assert.True(t, isPolicyViolation(err))
+	_, err = pki.NewCertIdempotent("", "web", true, nil)
+	assert.Error(t, err)
+
+	// keys issued before restart are found in storage, it`s scanned once
+	pki.idempotency.entries, pki.idempotency.loaded = nil, false
+	storage := &scanCountingStorage{KeyStorage: pki.Storage}
+	pki.Storage = storage
+	replay, err = pki.NewCertIdempotent("req-1", "web", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, first.Serial, replay.Serial)
+	_, err = pki.NewCertIdempotent("req-new", "new", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, storage.scans)
+
+	t.Run("concurrent", func(t *testing.T) {
+		serials := make(chan string, 5)
+		wg := sync.WaitGroup{}
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				pair, err := pki.NewCertIdempotent("req-2", "api", true, nil)
+				if assert.NoError(t, err) {
+					serials <- pair.Serial.Text(16)
+				}
+			}()
+		}
+		wg.Wait()
+		close(serials)
+		unique := make(map[string]bool)
+		for serial := range serials {
+			unique[serial] = true
+		}
+		assert.Len(t, unique, 1)
+	})
+
+	t.Run("csr", func(t *testing.T) {
+		csr := newTestCSR(t, "db")
+		pair, err := pki.SignCSRIdempotent("req-3", csr, "db", true, nil)
+		assert.NoError(t, err)
+		replay, err := pki.SignCSRIdempotent("req-3", csr, "db", true, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, pair.Serial, replay.Serial)
+		_, err = pki.SignCSRIdempotent("req-3", newTestCSR(t, "db"), "db", true, nil)
+		assert.True(t, isPolicyViolation(err))
+	})
+
+	t.Run("window", func(t *testing.T) {
+		pki.clock = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		defer func() { pki.clock = nil }()
+		renewed, err := pki.NewCertIdempotent("req-1", "web", true, nil)
+		assert.NoError(t, err)
+		assert.NotEqual(t, first.Serial, renewed.Serial)
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		pair, err := pki.NewCertIdempotent("req-4", "revoked", true, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, pki.Revoke(pair.Serial, "test", ""))
+		_, err = pki.NewCertIdempotent("req-4", "revoked", true, nil)
+		assert.True(t, isPolicyViolation(err))
+	})
+}
+
+// scanCountingStorage count full scans of storage
+type scanCountingStorage struct {
+	KeyStorage
+	scans int
+}
+
+func (s *scanCountingStorage) GetAll() ([]*X509Pair, error) {
+	s.scans++
+	return s.KeyStorage.GetAll()
+}
@@ -0,0 +1,39 @@
+package easyrsa
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ImportCert put externally issued certificate without key to storage.
+// Certificate must be signed by one of stored CAs and it`s serial must not be used yet,
+// serial provider is advanced past it if it implement SerialAdvancer
+func (p *PKI) ImportCert(certPEM []byte) (*X509Pair, error) {
+	cert, err := decodeCert(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	cas, _, err := p.caCerts()
+	if err != nil {
+		return nil, err
+	}
+	if findIssuer(cert, cas) == nil {
+		return nil, errors.New("certificate is not signed by stored ca")
+	}
+	if _, err := p.Storage.GetBySerial(cert.SerialNumber); err == nil {
+		// cert only Put would drop key of stored pair
+		return nil, errors.Errorf("serial %s already exist", cert.SerialNumber.Text(16))
+	} else if _, ok := errors.Cause(err).(*NotExist); !ok {
+		return nil, errors.Wrap(err, "can`t check imported serial")
+	}
+	if advancer, ok := p.serialProvider.(SerialAdvancer); ok {
+		if err := advancer.Advance(cert.SerialNumber); err != nil {
+			return nil, errors.Wrap(err, "can`t advance serial provider past imported serial")
+		}
+	}
+	pair := NewX509Pair(nil, certPEM, cert.Subject.CommonName, cert.SerialNumber)
+	if err := p.Storage.Put(pair); err != nil {
+		return nil, errors.Wrap(err, "can`t put imported cert")
+	}
+	p.pairStored(pair.CN)
+	return pair, nil
+}
@@ -0,0 +1,65 @@
+package easyrsa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_ImportCert(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	_, _ = pki.NewCa()
+	issued, _ := pki.NewCert("external", false, []string{""})
+	_ = pki.Storage.DeleteBySerial(issued.Serial)
+	t.Run("import", func(t *testing.T) {
+		pair, err := pki.ImportCert(issued.CertPemBytes)
+		assert.NoError(t, err)
+		assert.Equal(t, "external", pair.CN)
+		assert.Equal(t, issued.Serial, pair.Serial)
+		stored, err := pki.Storage.GetBySerial(issued.Serial)
+		assert.NoError(t, err)
+		assert.Empty(t, stored.KeyPemBytes)
+		assert.Equal(t, issued.CertPemBytes, stored.CertPemBytes)
+	})
+	t.Run("revoke imported", func(t *testing.T) {
+		assert.NoError(t, pki.RevokeAllByCN("external"))
+		assert.True(t, pki.IsRevoked(issued.Serial))
+	})
+	t.Run("duplicate serial", func(t *testing.T) {
+		_, err := pki.ImportCert(issued.CertPemBytes)
+		assert.Error(t, err)
+	})
+	t.Run("existing pair with key", func(t *testing.T) {
+		pair, err := pki.NewCert("keyed", false, nil)
+		assert.NoError(t, err)
+		_, err = pki.ImportCert(pair.CertPemBytes)
+		assert.Error(t, err)
+		stored, err := pki.Storage.GetBySerial(pair.Serial)
+		assert.NoError(t, err)
+		assert.Equal(t, pair.KeyPemBytes, stored.KeyPemBytes)
+	})
+	t.Run("serial collision", func(t *testing.T) {
+		ahead, err := pki.NewCert("ahead", false, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, pki.Storage.DeleteBySerial(ahead.Serial))
+		// serial file is behind the imported cert, e.g. it was issued by another instance
+		assert.NoError(t, pki.serialProvider.(*FileSerialProvider).Release(ahead.Serial))
+		_, err = pki.ImportCert(ahead.CertPemBytes)
+		assert.NoError(t, err)
+		next, err := pki.NewCert("next", false, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, next.Serial.Cmp(ahead.Serial))
+		stored, err := pki.Storage.GetBySerial(ahead.Serial)
+		assert.NoError(t, err)
+		assert.Equal(t, "ahead", stored.CN)
+	})
+	t.Run("foreign ca", func(t *testing.T) {
+		_, err := pki.ImportCert(getTestPair("foreign", 100).CertPemBytes)
+		assert.Error(t, err)
+	})
+	t.Run("broken", func(t *testing.T) {
+		_, err := pki.ImportCert([]byte("certbytes"))
+		assert.Error(t, err)
+	})
+}
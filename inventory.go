@@ -0,0 +1,280 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Inventory entry statuses
+const (
+	InventoryActive  = "active"  // not revoked and not expired
+	InventoryRevoked = "revoked" // listed in CRL
+	InventoryExpired = "expired" // expired and not revoked
+)
+
+// crlReasonNames are RFC 5280 names of CRL reason codes
+var crlReasonNames = []string{"unspecified", "keyCompromise", "cACompromise", "affiliationChanged", "superseded",
+	"cessationOfOperation", "certificateHold", "", "removeFromCRL", "privilegeWithdrawn", "aACompromise"}
+
+// CRLReportEntry is a revoked cert of CRLReport
+type CRLReportEntry struct {
+	Serial         string    `json:"serial"`          // hex serial
+	CN             string    `json:"cn,omitempty"`    // cn of revoked pair if it`s in storage
+	RevocationTime time.Time `json:"revocation_time"` // revocation time as in CRL
+	ReasonCode     int       `json:"reason_code"`     // RFC 5280 reason code, 0 if CRL entry has none
+	Reason         string    `json:"reason"`          // RFC 5280 reason name, e.g. keyCompromise
+}
+
+// CRLReport is a json representation of current CRL
+type CRLReport struct {
+	Issuer     string            `json:"issuer"`      // CRL issuer
+	ThisUpdate time.Time         `json:"this_update"` // CRL signing time
+	NextUpdate time.Time         `json:"next_update"` // next CRL is due
+	Revoked    []*CRLReportEntry `json:"revoked"`     // entries sorted by revocation time
+}
+
+// InventoryEntry describe one stored cert
+type InventoryEntry struct {
+	Serial    string            `json:"serial"`               // hex serial
+	CN        string            `json:"cn"`                   // cn of the pair
+	Subject   string            `json:"subject"`              // cert subject
+	Issuer    string            `json:"issuer"`               // cert issuer
+	SANs      []string          `json:"sans,omitempty"`       // dns names, ips, emails and uris
+	NotBefore time.Time         `json:"not_before"`           // validity start
+	NotAfter  time.Time         `json:"not_after"`            // expiry
+	Status    string            `json:"status"`               // one of Inventory statuses
+	RevokedAt *time.Time        `json:"revoked_at,omitempty"` // revocation time as in CRL
+	Reason    string            `json:"reason,omitempty"`     // RFC 5280 revocation reason name
+	CA        bool              `json:"ca,omitempty"`         // CA cert
+	HasKey    bool              `json:"has_key"`              // private key is stored
+	SHA256    string            `json:"sha256"`               // hex sha256 fingerprint of DER cert
+	Metadata  map[string]string `json:"metadata,omitempty"`   // pair metadata tags
+}
+
+// CRLReport return current CRL with cn and reason name of every entry, so dashboards need no ASN.1 parsing
+func (p *PKI) CRLReport() (*CRLReport, error) {
+	list, err := p.GetCRL()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get current crl")
+	}
+	tbs := list.TBSCertList
+	res := &CRLReport{
+		Issuer:     tbs.Issuer.String(),
+		ThisUpdate: tbs.ThisUpdate,
+		NextUpdate: tbs.NextUpdate,
+		Revoked:    make([]*CRLReportEntry, 0, len(tbs.RevokedCertificates)),
+	}
+	for _, revoked := range removeDups(tbs.RevokedCertificates) {
+		code := crlReason(revoked)
+		entry := &CRLReportEntry{
+			Serial:         revoked.SerialNumber.Text(16),
+			RevocationTime: revoked.RevocationTime,
+			ReasonCode:     code,
+		}
+		if code >= 0 && code < len(crlReasonNames) {
+			entry.Reason = crlReasonNames[code]
+		}
+		if pair, err := p.Storage.GetBySerial(revoked.SerialNumber); err == nil && pair != nil {
+			entry.CN = pair.CN
+		}
+		res.Revoked = append(res.Revoked, entry)
+	}
+	sort.SliceStable(res.Revoked, func(i, j int) bool {
+		return res.Revoked[i].RevocationTime.Before(res.Revoked[j].RevocationTime)
+	})
+	return res, nil
+}
+
+// Inventory return all stored certs with status, sorted by cn and not before. Undecodable pairs are skipped
+func (p *PKI) Inventory() ([]*InventoryEntry, error) {
+	res := make([]*InventoryEntry, 0)
+	err := p.forEachInventoryEntry(func(entry *InventoryEntry) error {
+		res = append(res, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].CN != res[j].CN {
+			return res[i].CN < res[j].CN
+		}
+		return res[i].NotBefore.Before(res[j].NotBefore)
+	})
+	return res, nil
+}
+
+// forEachInventoryEntry call fn for entry of every stored cert in storage order, undecodable pairs are skipped.
+// Error is returned if CRL is unavailable, revoked certs must not be reported as active
+func (p *PKI) forEachInventoryEntry(fn func(entry *InventoryEntry) error) error {
+	list, err := p.GetCRL()
+	if err != nil {
+		return errors.Wrap(err, "can`t get crl for inventory")
+	}
+	revoked := make(map[string]pkix.RevokedCertificate)
+	for _, cert := range list.TBSCertList.RevokedCertificates {
+		revoked[cert.SerialNumber.Text(16)] = cert
+	}
+	now := p.now()
+	err = ForEach(p.Storage, func(pair *X509Pair) error {
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil {
+			return nil
+		}
+		fingerprint := sha256.Sum256(cert.Raw)
+		entry := &InventoryEntry{
+			Serial:    cert.SerialNumber.Text(16),
+			CN:        pair.CN,
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			SANs:      certSANs(cert),
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+			Status:    InventoryActive,
+			CA:        cert.IsCA,
+			HasKey:    pair.HasKey(),
+			SHA256:    hex.EncodeToString(fingerprint[:]),
+			Metadata:  pair.Metadata,
+		}
+		if revokedCert, ok := revoked[entry.Serial]; ok {
+			revokedAt := revokedCert.RevocationTime
+			entry.Status, entry.RevokedAt = InventoryRevoked, &revokedAt
+			if code := crlReason(revokedCert); code >= 0 && code < len(crlReasonNames) {
+				entry.Reason = crlReasonNames[code]
+			}
+		} else if now.After(cert.NotAfter) {
+			entry.Status = InventoryExpired
+		}
+		return fn(entry)
+	})
+	return errors.Wrap(err, "can`t get pairs for inventory")
+}
+
+// ExportInventoryJSONL write entry of every stored cert as json line, streamed in storage order
+func (p *PKI) ExportInventoryJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	return p.forEachInventoryEntry(func(entry *InventoryEntry) error {
+		return errors.Wrap(enc.Encode(entry), "can`t write entry")
+	})
+}
+
+// ExportInventoryCSV write entry of every stored cert as csv report with header, streamed in storage order.
+// SANs are comma separated, metadata tags are json object. Cells starting with =, +, -, @, tab or carriage
+// return are prefixed with ' so spreadsheets don`t evaluate them as formulas
+func (p *PKI) ExportInventoryCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"serial", "cn", "subject", "issuer", "sans", "not_before", "not_after", "status",
+		"revoked_at", "reason", "ca", "has_key", "sha256", "metadata"})
+	if err != nil {
+		return errors.Wrap(err, "can`t write csv header")
+	}
+	err = p.forEachInventoryEntry(func(entry *InventoryEntry) error {
+		revokedAt, metadata := "", ""
+		if entry.RevokedAt != nil {
+			revokedAt = entry.RevokedAt.UTC().Format(time.RFC3339)
+		}
+		if len(entry.Metadata) > 0 {
+			b, err := json.Marshal(entry.Metadata)
+			if err != nil {
+				return errors.Wrap(err, "can`t encode metadata")
+			}
+			metadata = string(b)
+		}
+		return cw.Write(csvCells(
+			entry.Serial,
+			entry.CN,
+			entry.Subject,
+			entry.Issuer,
+			strings.Join(entry.SANs, ","),
+			entry.NotBefore.UTC().Format(time.RFC3339),
+			entry.NotAfter.UTC().Format(time.RFC3339),
+			entry.Status,
+			revokedAt,
+			entry.Reason,
+			strconv.FormatBool(entry.CA),
+			strconv.FormatBool(entry.HasKey),
+			entry.SHA256,
+			metadata,
+		))
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return errors.Wrap(cw.Error(), "can`t write csv")
+}
+
+// csvCells return cells with formula triggers neutralized
+func csvCells(cells ...string) []string {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return cells
+}
+
+// CRLJSONHandler serve CRLReport as json, e.g. mounted at /crl.json
+func (p *PKI) CRLJSONHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		report, err := p.CRLReport()
+		if err != nil {
+			http.Error(w, "can`t get crl", http.StatusServiceUnavailable)
+			return
+		}
+		serveJSON(w, req, report, report.ThisUpdate)
+	})
+}
+
+// InventoryHandler serve Inventory as json, e.g. mounted at /inventory.json. Query parameters cn and status
+// filter entries, e.g. ?status=active
+func (p *PKI) InventoryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		entries, err := p.Inventory()
+		if err != nil {
+			http.Error(w, "can`t get inventory", http.StatusServiceUnavailable)
+			return
+		}
+		cn, status := req.URL.Query().Get("cn"), req.URL.Query().Get("status")
+		filtered := make([]*InventoryEntry, 0, len(entries))
+		for _, entry := range entries {
+			if (cn == "" || entry.CN == cn) && (status == "" || entry.Status == status) {
+				filtered = append(filtered, entry)
+			}
+		}
+		serveJSON(w, req, map[string]interface{}{"certs": filtered}, time.Time{})
+	})
+}
+
+// serveJSON write v as indented json with ETag, so clients can poll with conditional requests
+func serveJSON(w http.ResponseWriter, req *http.Request, v interface{}, modified time.Time) {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, "can`t encode json", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(content)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	http.ServeContent(w, req, "", modified, bytes.NewReader(content))
+}
@@ -0,0 +1,133 @@
+package easyrsa
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_CRLJSONHandler(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	alice, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	bob, err := pki.NewCert("bob", true, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pki.RevokeWithReasonCode(alice.Serial, CRLReasonKeyCompromise, "admin", "leaked"))
+
+	rec := httptest.NewRecorder()
+	pki.CRLJSONHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/crl.json", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	report := &CRLReport{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), report))
+	assert.Len(t, report.Revoked, 1)
+	assert.Equal(t, alice.Serial.Text(16), report.Revoked[0].Serial)
+	assert.Equal(t, "alice", report.Revoked[0].CN)
+	assert.Equal(t, "keyCompromise", report.Revoked[0].Reason)
+	assert.False(t, report.Revoked[0].RevocationTime.IsZero())
+
+	req := httptest.NewRequest(http.MethodGet, "/crl.json", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	pki.CRLJSONHandler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	rec = httptest.NewRecorder()
+	pki.InventoryHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/inventory.json?status=active", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var res struct {
+		Certs []*InventoryEntry `json:"certs"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	cns := make([]string, 0)
+	for _, entry := range res.Certs {
+		assert.Equal(t, InventoryActive, entry.Status)
+		cns = append(cns, entry.CN)
+	}
+	assert.Equal(t, []string{"bob", "ca"}, cns)
+	assert.Equal(t, bob.Serial.Text(16), res.Certs[0].Serial)
+	assert.True(t, res.Certs[0].HasKey)
+	assert.True(t, res.Certs[1].CA)
+
+	entries, err := pki.Inventory()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, InventoryRevoked, entries[0].Status)
+
+	rec = httptest.NewRecorder()
+	pki.InventoryHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/inventory.json", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestPKI_ExportInventory(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	alice, err := pki.Issue(CertRequest{CN: "alice", DNSNames: []string{"a.example.com", "b.example.com"},
+		Metadata: map[string]string{"team": "infra"}})
+	assert.NoError(t, err)
+	assert.NoError(t, pki.RevokeWithReasonCode(alice.Serial, CRLReasonKeyCompromise, "admin", "leaked"))
+	_, err = pki.Issue(CertRequest{CN: "=HYPERLINK(1)", Metadata: map[string]string{"team": "@ops"}})
+	assert.NoError(t, err)
+
+	jsonl := bytes.NewBuffer(nil)
+	assert.NoError(t, pki.ExportInventoryJSONL(jsonl))
+	entries := make(map[string]*InventoryEntry)
+	for _, line := range bytes.Split(bytes.TrimSpace(jsonl.Bytes()), []byte("\n")) {
+		entry := &InventoryEntry{}
+		assert.NoError(t, json.Unmarshal(line, entry))
+		entries[entry.CN] = entry
+	}
+	assert.Len(t, entries, 3)
+	assert.Equal(t, InventoryRevoked, entries["alice"].Status)
+	assert.Equal(t, "keyCompromise", entries["alice"].Reason)
+	assert.NotNil(t, entries["alice"].RevokedAt)
+	assert.Equal(t, "infra", entries["alice"].Metadata["team"])
+	assert.Nil(t, entries["ca"].RevokedAt)
+
+	report := bytes.NewBuffer(nil)
+	assert.NoError(t, pki.ExportInventoryCSV(report))
+	rows, err := csv.NewReader(report).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 4)
+	assert.Equal(t, "serial", rows[0][0])
+	for _, row := range rows[1:] {
+		if row[1] == "'=HYPERLINK(1)" {
+			assert.Equal(t, "CN==HYPERLINK(1)", row[2])
+			assert.Equal(t, `{"team":"@ops"}`, row[13])
+			continue
+		}
+		if row[1] != "alice" {
+			assert.Equal(t, InventoryActive, row[7])
+			assert.Equal(t, "true", row[10])
+			continue
+		}
+		assert.Equal(t, alice.Serial.Text(16), row[0])
+		assert.Equal(t, "dns:a.example.com,dns:b.example.com", row[4])
+		assert.Equal(t, InventoryRevoked, row[7])
+		assert.Equal(t, entries["alice"].RevokedAt.UTC().Format(time.RFC3339), row[8])
+		assert.Equal(t, "keyCompromise", row[9])
+		assert.Equal(t, "false", row[10])
+		assert.Equal(t, "true", row[11])
+		assert.Equal(t, `{"team":"infra"}`, row[13])
+	}
+
+	assert.Equal(t, []string{"'-1", "'+1", "'@a", "'\tb", "a=b", ""}, csvCells("-1", "+1", "@a", "\tb", "a=b", ""))
+
+	holder := &flakyCRLHolder{CRLHolder: pki.crlHolder, down: true}
+	pki.crlHolder = holder
+	pki.invalidateCache()
+	assert.Error(t, pki.ExportInventoryJSONL(ioutil.Discard))
+	assert.Error(t, pki.ExportInventoryCSV(ioutil.Discard))
+}
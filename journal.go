@@ -0,0 +1,212 @@
+package easyrsa
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+)
+
+// JournalCompactSize is a number of journal entries after which journal is rewritten with the last serial only
+const JournalCompactSize = 1024
+
+// JournalSerialProvider implement SerialProvider interface with append only journal of allocated serials.
+// Serial is synced to the journal before it is returned, so crash never cause serial reuse.
+// Torn last entry is discarded on next allocation, any other broken entry is an error
+type JournalSerialProvider struct {
+	locker *flock.Flock
+	path   string
+}
+
+func NewJournalSerialProvider(path string) *JournalSerialProvider {
+	return &JournalSerialProvider{locker: flock.New(path + ".lock"), path: path}
+}
+
+func (p *JournalSerialProvider) Next() (*big.Int, error) {
+	serials, err := p.Reserve(1)
+	if err != nil {
+		return nil, err
+	}
+	return serials[0], nil
+}
+
+// Reserve allocate n contiguous serials with one journal entry of the last of them
+func (p *JournalSerialProvider) Reserve(n int) ([]*big.Int, error) {
+	if n <= 0 {
+		return nil, errors.Errorf("wrong number of serials %d", n)
+	}
+	var res []*big.Int
+	err := p.withLock(func() error {
+		last, entries, err := p.recover()
+		if err != nil {
+			return err
+		}
+		res = serialRange(last, n)
+		if entries >= JournalCompactSize {
+			return p.compact(res[n-1])
+		}
+		return p.append(res[n-1])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Last return last allocated serial, zero if nothing allocated yet
+func (p *JournalSerialProvider) Last() (*big.Int, error) {
+	var res *big.Int
+	err := p.withLock(func() error {
+		last, _, _, err := p.read()
+		res = last
+		return err
+	})
+	return res, err
+}
+
+// Advance append serial to the journal if it`s ahead of the last one
+func (p *JournalSerialProvider) Advance(serial *big.Int) error {
+	return p.withLock(func() error {
+		last, _, err := p.recover()
+		if err != nil || last.Cmp(serial) >= 0 {
+			return err
+		}
+		return p.append(serial)
+	})
+}
+
+// VerifyAgainstStorage make sure journal is ahead of every serial in storage, as it may be lost or restored from old backup.
+// Journal is advanced to the highest stored serial if needed, true is returned in this case
+func (p *JournalSerialProvider) VerifyAgainstStorage(storage KeyStorage) (bool, error) {
+	max := big.NewInt(0)
+	err := ForEach(storage, func(pair *X509Pair) error {
+		if pair.Serial != nil && pair.Serial.Cmp(max) > 0 {
+			max = pair.Serial
+		}
+		return nil
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "can`t scan storage serials")
+	}
+	advanced := false
+	err = p.withLock(func() error {
+		last, _, err := p.recover()
+		if err != nil || last.Cmp(max) >= 0 {
+			return err
+		}
+		advanced = true
+		return p.append(max)
+	})
+	return advanced, err
+}
+
+// Check make sure journal can be locked and read
+func (p *JournalSerialProvider) Check() error {
+	return p.withLock(func() error {
+		_, _, _, err := p.read()
+		return err
+	})
+}
+
+func (p *JournalSerialProvider) withLock(fn func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), LockTimeout)
+	defer cancel()
+	locked, err := p.locker.TryLockContext(ctx, LockPeriod)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errors.New("can`t lock serial journal")
+	}
+	defer func() {
+		_ = p.locker.Unlock()
+	}()
+	return fn()
+}
+
+// read return last serial, number of entries and size of complete entries
+func (p *JournalSerialProvider) read() (*big.Int, int, int64, error) {
+	content, err := ioutil.ReadFile(p.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, 0, 0, errors.Wrap(err, "can`t read serial journal")
+	}
+	last := big.NewInt(0)
+	entries := 0
+	size := int64(0)
+	for {
+		idx := bytes.IndexByte(content[size:], '\n')
+		if idx < 0 {
+			break
+		}
+		serial, ok := new(big.Int).SetString(string(content[size:size+int64(idx)]), 16)
+		if !ok || serial.Sign() <= 0 {
+			return nil, 0, 0, errors.Errorf("serial journal is corrupted at entry %d", entries+1)
+		}
+		if serial.Cmp(last) <= 0 {
+			return nil, 0, 0, errors.Errorf("serial journal is not monotonic at entry %d", entries+1)
+		}
+		last = serial
+		entries++
+		size += int64(idx) + 1
+	}
+	return last, entries, size, nil
+}
+
+// recover read journal and drop torn last entry
+func (p *JournalSerialProvider) recover() (*big.Int, int, error) {
+	last, entries, size, err := p.read()
+	if err != nil {
+		return nil, 0, err
+	}
+	if stat, err := os.Stat(p.path); err == nil && stat.Size() > size {
+		if err := os.Truncate(p.path, size); err != nil {
+			return nil, 0, errors.Wrap(err, "can`t truncate torn serial journal entry")
+		}
+	}
+	return last, entries, nil
+}
+
+func (p *JournalSerialProvider) append(serial *big.Int) error {
+	file, err := os.OpenFile(p.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return errors.Wrap(err, "can`t open serial journal")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if _, err := fmt.Fprintf(file, "%s\n", serial.Text(16)); err != nil {
+		return errors.Wrap(err, "can`t write serial journal")
+	}
+	return errors.Wrap(file.Sync(), "can`t sync serial journal")
+}
+
+// compact atomically replace journal with the single serial entry
+func (p *JournalSerialProvider) compact(serial *big.Int) error {
+	tmp := p.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return errors.Wrap(err, "can`t open serial journal")
+	}
+	_, err = fmt.Fprintf(file, "%s\n", serial.Text(16))
+	if err == nil {
+		err = file.Sync()
+	}
+	_ = file.Close()
+	if err != nil {
+		return errors.Wrap(err, "can`t write serial journal")
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		return errors.Wrap(err, "can`t replace serial journal")
+	}
+	if dir, err := os.Open(filepath.Dir(p.path)); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+	return nil
+}
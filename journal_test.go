@@ -0,0 +1,98 @@
+package easyrsa
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getTmpJournal() (*JournalSerialProvider, string, func()) {
+	dir := filepath.Join(getTestDir(), "journal")
+	_ = os.MkdirAll(dir, 0777)
+	path := filepath.Join(dir, "serial.journal")
+	return NewJournalSerialProvider(path), path, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestJournalSerialProvider_Next(t *testing.T) {
+	provider, path, cleanup := getTmpJournal()
+	defer cleanup()
+	assert.NoError(t, provider.Check())
+	for i := int64(1); i <= 17; i++ {
+		serial, err := provider.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewInt(i), serial)
+	}
+	last, err := provider.Last()
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(17), last)
+
+	t.Run("torn entry", func(t *testing.T) {
+		file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+		_, _ = file.WriteString("1")
+		_ = file.Close()
+		serial, err := provider.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewInt(18), serial)
+		content, _ := ioutil.ReadFile(path)
+		assert.True(t, strings.HasSuffix(string(content), "\n11\n12\n"))
+	})
+	t.Run("restart", func(t *testing.T) {
+		serial, err := NewJournalSerialProvider(path).Next()
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewInt(19), serial)
+	})
+	t.Run("corrupted", func(t *testing.T) {
+		content, _ := ioutil.ReadFile(path)
+		defer func() { _ = ioutil.WriteFile(path, content, 0666) }()
+		_ = ioutil.WriteFile(path, []byte("1\nzz\n3\n"), 0666)
+		_, err := provider.Next()
+		assert.Error(t, err)
+		assert.Error(t, provider.Check())
+		_ = ioutil.WriteFile(path, []byte("5\n3\n"), 0666)
+		_, err = provider.Next()
+		assert.Error(t, err)
+	})
+}
+
+func TestJournalSerialProvider_compact(t *testing.T) {
+	provider, path, cleanup := getTmpJournal()
+	defer cleanup()
+	for i := 0; i < JournalCompactSize+2; i++ {
+		_, err := provider.Next()
+		assert.NoError(t, err)
+	}
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "401\n402\n", string(content))
+	last, err := provider.Last()
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(JournalCompactSize+2), last)
+}
+
+func TestJournalSerialProvider_VerifyAgainstStorage(t *testing.T) {
+	provider, path, cleanup := getTmpJournal()
+	defer cleanup()
+	pki, cleanupPki := getTmpPki()
+	defer cleanupPki()
+	pki.serialProvider = provider
+	_, _ = pki.NewCa()
+	_, _ = pki.NewCert("client", false, []string{""})
+
+	advanced, err := provider.VerifyAgainstStorage(pki.Storage)
+	assert.NoError(t, err)
+	assert.False(t, advanced)
+
+	_ = os.Remove(path)
+	advanced, err = provider.VerifyAgainstStorage(pki.Storage)
+	assert.NoError(t, err)
+	assert.True(t, advanced)
+	serial, err := provider.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(3), serial)
+}
@@ -0,0 +1,289 @@
+package easyrsa
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Keychain keep secrets in external secure store
+type Keychain interface {
+	Set(account string, secret []byte) error // Set secret for account. Overwrite if already exist.
+	Get(account string) ([]byte, error)      // Get secret of account, NotExist if absent.
+	Delete(account string) error             // Delete secret of account.
+}
+
+// NewOSKeychain return Keychain of the current os for service name.
+// macOS Keychain is used via security(1), Linux secret service (gnome-keyring, kwallet) via secret-tool(1),
+// Windows Credential Manager via advapi32. Other systems are not supported
+func NewOSKeychain(service string) (Keychain, error) {
+	var tool string
+	switch runtime.GOOS {
+	case "darwin":
+		tool = "security"
+	case "linux":
+		tool = "secret-tool"
+	case "windows":
+		return newCredentialManager(service)
+	default:
+		return nil, errors.Errorf("os keychain is not supported on %s", runtime.GOOS)
+	}
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can`t find %s", tool)
+	}
+	if runtime.GOOS == "darwin" {
+		return &macKeychain{service: service, tool: path}, nil
+	}
+	return &secretService{service: service, tool: path}, nil
+}
+
+// macItemNotFound is exit status of security(1) for missing item, errSecItemNotFound
+const macItemNotFound = 44
+
+// macKeychain store secrets as generic passwords, secret is passed via stdin of interactive mode to keep it out of argv
+type macKeychain struct {
+	service string
+	tool    string
+}
+
+func (k *macKeychain) Set(account string, secret []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(secret)
+	cmd := fmt.Sprintf("add-generic-password -U -s %q -a %q -w %s\n", k.service, account, encoded)
+	_, err := runTool(k.tool, []byte(cmd), "-i")
+	return errors.Wrap(err, "can`t set keychain item")
+}
+
+func (k *macKeychain) Get(account string) ([]byte, error) {
+	out, err := runTool(k.tool, nil, "find-generic-password", "-s", k.service, "-a", account, "-w")
+	if tErr, ok := errors.Cause(err).(*toolError); ok && tErr.exitCode == macItemNotFound {
+		return nil, NewNotExist(fmt.Sprintf("keychain item %s not found", account))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get keychain item")
+	}
+	defer zeroBytes(out)
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+}
+
+func (k *macKeychain) Delete(account string) error {
+	_, err := runTool(k.tool, nil, "delete-generic-password", "-s", k.service, "-a", account)
+	return errors.Wrap(err, "can`t delete keychain item")
+}
+
+// secretService store secrets with service and account attributes, secret is passed via stdin
+type secretService struct {
+	service string
+	tool    string
+}
+
+func (k *secretService) Set(account string, secret []byte) error {
+	encoded := []byte(base64.StdEncoding.EncodeToString(secret))
+	defer zeroBytes(encoded)
+	label := fmt.Sprintf("%s %s", k.service, account)
+	_, err := runTool(k.tool, encoded, "store", "--label", label, "service", k.service, "account", account)
+	return errors.Wrap(err, "can`t set secret service item")
+}
+
+func (k *secretService) Get(account string) ([]byte, error) {
+	out, err := runTool(k.tool, nil, "lookup", "service", k.service, "account", account)
+	// secret-tool exit with 1 and no message if nothing matched
+	if tErr, ok := errors.Cause(err).(*toolError); (ok && tErr.exitCode == 1 && tErr.stderr == "") || (err == nil && len(out) == 0) {
+		return nil, NewNotExist(fmt.Sprintf("secret service item %s not found", account))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get secret service item")
+	}
+	defer zeroBytes(out)
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+}
+
+func (k *secretService) Delete(account string) error {
+	_, err := runTool(k.tool, nil, "clear", "service", k.service, "account", account)
+	return errors.Wrap(err, "can`t delete secret service item")
+}
+
+// toolError is a failed run of keychain tool
+type toolError struct {
+	exitCode int    // exit status, -1 if tool was not run or killed
+	stderr   string // trimmed stderr
+	err      error
+}
+
+func (e *toolError) Error() string {
+	return fmt.Sprintf("%s: %s", e.stderr, e.err)
+}
+
+func runTool(tool string, stdin []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(tool, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		res := &toolError{exitCode: -1, stderr: strings.TrimSpace(stderr.String()), err: err}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			res.exitCode = exitErr.ExitCode()
+		}
+		return nil, errors.WithStack(res)
+	}
+	return stdout.Bytes(), nil
+}
+
+// KeychainKeyStorage implement KeyStorage interface, keeping CA private keys in Keychain
+// and everything else, including CA certs, in the wrapped storage
+type KeychainKeyStorage struct {
+	KeyStorage
+	keychain Keychain
+}
+
+// NewKeychainKeyStorage wrap storage to move CA private keys to keychain
+func NewKeychainKeyStorage(storage KeyStorage, keychain Keychain) *KeychainKeyStorage {
+	return &KeychainKeyStorage{KeyStorage: storage, keychain: keychain}
+}
+
+func keychainAccount(serial *big.Int) string {
+	return fmt.Sprintf("ca-%s", serial.Text(16))
+}
+
+func (s *KeychainKeyStorage) Put(pair *X509Pair) error {
+	if pair.CN != "ca" || !pair.HasKey() {
+		return s.KeyStorage.Put(pair)
+	}
+	if err := pair.Validate(); err != nil {
+		return errors.Wrap(err, "can`t put invalid pair")
+	}
+	if err := s.keychain.Set(keychainAccount(pair.Serial), pair.KeyPemBytes); err != nil {
+		return err
+	}
+	certOnly := &X509Pair{CertPemBytes: pair.CertPemBytes, ChainPemBytes: pair.ChainPemBytes, CN: pair.CN, Serial: pair.Serial, Metadata: pair.Metadata}
+	if err := s.KeyStorage.Put(certOnly); err != nil {
+		_ = s.keychain.Delete(keychainAccount(pair.Serial))
+		return err
+	}
+	return nil
+}
+
+// load fill key of CA pair from keychain, pair stay cert only if keychain has no key
+func (s *KeychainKeyStorage) load(pair *X509Pair) (*X509Pair, error) {
+	if pair.CN != "ca" || pair.HasKey() {
+		return pair, nil
+	}
+	key, err := s.keychain.Get(keychainAccount(pair.Serial))
+	if err != nil {
+		if _, ok := errors.Cause(err).(*NotExist); ok {
+			return pair, nil
+		}
+		return nil, errors.Wrap(err, "can`t get ca key from keychain")
+	}
+	pair.KeyPemBytes = key
+	return pair, nil
+}
+
+func (s *KeychainKeyStorage) GetByCN(cn string) ([]*X509Pair, error) {
+	res := make([]*X509Pair, 0)
+	err := s.ForEachByCN(cn, func(pair *X509Pair) error {
+		res = append(res, pair)
+		return nil
+	})
+	if len(res) == 0 {
+		return nil, errors.WithStack(NewNotExist("not found"))
+	}
+	return res, err
+}
+
+func (s *KeychainKeyStorage) GetLastByCn(cn string) (*X509Pair, error) {
+	pair, err := s.KeyStorage.GetLastByCn(cn)
+	if err != nil {
+		return nil, err
+	}
+	return s.load(pair)
+}
+
+func (s *KeychainKeyStorage) GetBySerial(serial *big.Int) (*X509Pair, error) {
+	pair, err := s.KeyStorage.GetBySerial(serial)
+	if err != nil {
+		return nil, err
+	}
+	return s.load(pair)
+}
+
+func (s *KeychainKeyStorage) GetAll() ([]*X509Pair, error) {
+	res := make([]*X509Pair, 0)
+	err := s.ForEach(func(pair *X509Pair) error {
+		res = append(res, pair)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get all pairs")
+	}
+	return res, nil
+}
+
+func (s *KeychainKeyStorage) ForEachByCN(cn string, fn func(pair *X509Pair) error) error {
+	return ForEachByCN(s.KeyStorage, cn, s.loading(fn))
+}
+
+func (s *KeychainKeyStorage) ForEach(fn func(pair *X509Pair) error) error {
+	return ForEach(s.KeyStorage, s.loading(fn))
+}
+
+func (s *KeychainKeyStorage) loading(fn func(pair *X509Pair) error) func(pair *X509Pair) error {
+	return func(pair *X509Pair) error {
+		pair, err := s.load(pair)
+		if err != nil {
+			return err
+		}
+		return fn(pair)
+	}
+}
+
+func (s *KeychainKeyStorage) DeleteByCn(cn string) error {
+	if cn == "ca" {
+		err := ForEachByCN(s.KeyStorage, cn, func(pair *X509Pair) error {
+			return s.deleteKey(pair.Serial)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return s.KeyStorage.DeleteByCn(cn)
+}
+
+func (s *KeychainKeyStorage) DeleteBySerial(serial *big.Int) error {
+	pair, err := s.KeyStorage.GetBySerial(serial)
+	if err != nil {
+		return err
+	}
+	if pair.CN == "ca" {
+		if err := s.deleteKey(serial); err != nil {
+			return err
+		}
+	}
+	return s.KeyStorage.DeleteBySerial(serial)
+}
+
+func (s *KeychainKeyStorage) deleteKey(serial *big.Int) error {
+	account := keychainAccount(serial)
+	if _, err := s.keychain.Get(account); err != nil {
+		if _, ok := errors.Cause(err).(*NotExist); ok {
+			return nil
+		}
+		return err
+	}
+	return errors.Wrap(s.keychain.Delete(account), "can`t delete ca key from keychain")
+}
+
+// Check check wrapped storage if it implement Checker
+func (s *KeychainKeyStorage) Check() error {
+	if checker, ok := s.KeyStorage.(Checker); ok {
+		return checker.Check()
+	}
+	return nil
+}
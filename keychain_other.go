@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package easyrsa
+
+import "github.com/pkg/errors"
+
+func newCredentialManager(service string) (Keychain, error) {
+	return nil, errors.New("windows credential manager is available on windows only")
+}
@@ -0,0 +1,121 @@
+package easyrsa
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type memKeychain map[string][]byte
+
+func (k memKeychain) Set(account string, secret []byte) error {
+	k[account] = append([]byte(nil), secret...)
+	return nil
+}
+
+func (k memKeychain) Get(account string) ([]byte, error) {
+	secret, ok := k[account]
+	if !ok {
+		return nil, NewNotExist("not found")
+	}
+	return append([]byte(nil), secret...), nil
+}
+
+func (k memKeychain) Delete(account string) error {
+	delete(k, account)
+	return nil
+}
+
+func TestKeychainKeyStorage(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	keychain := memKeychain{}
+	pki.Storage = NewKeychainKeyStorage(pki.Storage, keychain)
+
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+	assert.Len(t, keychain, 1)
+	_, err = os.Stat(filepath.Join(testData, "ca", "1.key"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(testData, "ca", "1.crt"))
+	assert.NoError(t, err)
+
+	server, err := pki.NewCert("server", true, []string{""})
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(testData, "server", "2.key"))
+	assert.NoError(t, err)
+	assert.Len(t, keychain, 1)
+
+	t.Run("get", func(t *testing.T) {
+		last, err := pki.Storage.GetLastByCn("ca")
+		assert.NoError(t, err)
+		assert.Equal(t, ca.KeyPemBytes, last.KeyPemBytes)
+		bySerial, err := pki.Storage.GetBySerial(big.NewInt(1))
+		assert.NoError(t, err)
+		assert.Equal(t, ca.KeyPemBytes, bySerial.KeyPemBytes)
+		all, err := pki.Storage.GetAll()
+		assert.NoError(t, err)
+		assert.Len(t, all, 2)
+		for _, pair := range all {
+			assert.True(t, pair.HasKey())
+		}
+		leaf, err := pki.Storage.GetBySerial(server.Serial)
+		assert.NoError(t, err)
+		assert.Equal(t, server.KeyPemBytes, leaf.KeyPemBytes)
+	})
+	t.Run("missing key", func(t *testing.T) {
+		secret := keychain[keychainAccount(big.NewInt(1))]
+		delete(keychain, keychainAccount(big.NewInt(1)))
+		defer func() { keychain[keychainAccount(big.NewInt(1))] = secret }()
+		last, err := pki.Storage.GetLastByCn("ca")
+		assert.NoError(t, err)
+		assert.False(t, last.HasKey())
+		_, err = pki.NewCert("client", false, []string{""})
+		assert.Error(t, err)
+	})
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, pki.Storage.DeleteBySerial(big.NewInt(1)))
+		assert.Len(t, keychain, 0)
+		_, err := pki.Storage.GetByCN("ca")
+		assert.Error(t, err)
+	})
+}
+
+func TestOSKeychain_notFound(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh on windows")
+	}
+	dir := filepath.Join(getTestDir(), "keychain_tools")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	defer os.RemoveAll(dir)
+	// fake tools: account "missing" is absent, "locked" fail with message of locked keychain
+	tool := func(name, notFound string) string {
+		path := filepath.Join(dir, name)
+		script := "#!/bin/sh\ncase \"$*\" in\n*missing*) " + notFound + " ;;\n" +
+			"*locked*) echo 'keychain is locked' >&2; exit 1 ;;\n*) echo c2VjcmV0 ;;\nesac\n"
+		assert.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+		return path
+	}
+	for name, keychain := range map[string]Keychain{
+		"security":    &macKeychain{service: "easyrsa", tool: tool("security", "echo 'item could not be found' >&2; exit 44")},
+		"secret-tool": &secretService{service: "easyrsa", tool: tool("secret-tool", "exit 1")},
+	} {
+		secret, err := keychain.Get("ca-1")
+		assert.NoError(t, err, name)
+		assert.Equal(t, "secret", string(secret), name)
+		_, err = keychain.Get("missing")
+		_, ok := errors.Cause(err).(*NotExist)
+		assert.True(t, ok, name)
+		_, err = keychain.Get("locked")
+		_, ok = errors.Cause(err).(*NotExist)
+		assert.Error(t, err, name)
+		assert.False(t, ok, name)
+		assert.Contains(t, err.Error(), "keychain is locked")
+	}
+}
@@ -0,0 +1,174 @@
+//go:build windows
+// +build windows
+
+package easyrsa
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	credMaxBlobSize         = 5 * 512 // CRED_MAX_CREDENTIAL_BLOB_SIZE
+	errorNotFound           = syscall.Errno(1168)
+)
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+// credential is CREDENTIALW of wincred.h
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// credentialManager store secrets as generic credentials of Windows Credential Manager, protected by DPAPI
+// of the user. Secrets larger than credential blob limit are split to <service>/<account>#<n> credentials
+type credentialManager struct {
+	service string
+}
+
+func newCredentialManager(service string) (Keychain, error) {
+	if err := procCredReadW.Find(); err != nil {
+		return nil, errors.Wrap(err, "can`t find credential manager")
+	}
+	return &credentialManager{service: service}, nil
+}
+
+// target return credential target name of chunk
+func (k *credentialManager) target(account string, chunk int) string {
+	if chunk == 0 {
+		return k.service + "/" + account
+	}
+	return fmt.Sprintf("%s/%s#%d", k.service, account, chunk)
+}
+
+func (k *credentialManager) Set(account string, secret []byte) error {
+	chunk := 0
+	for len(secret) > 0 || chunk == 0 {
+		n := len(secret)
+		if n > credMaxBlobSize {
+			n = credMaxBlobSize
+		}
+		if err := k.write(k.target(account, chunk), account, secret[:n]); err != nil {
+			return errors.Wrap(err, "can`t set credential")
+		}
+		secret = secret[n:]
+		chunk++
+	}
+	// chunks of previous longer secret
+	for ; ; chunk++ {
+		if err := k.delete(k.target(account, chunk)); err == errorNotFound {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "can`t delete stale credential")
+		}
+	}
+}
+
+func (k *credentialManager) Get(account string) ([]byte, error) {
+	var res []byte
+	for chunk := 0; ; chunk++ {
+		blob, err := k.read(k.target(account, chunk))
+		if err == errorNotFound {
+			if chunk == 0 {
+				return nil, NewNotExist(fmt.Sprintf("credential %s not found", account))
+			}
+			return res, nil
+		}
+		if err != nil {
+			zeroBytes(res)
+			return nil, errors.Wrap(err, "can`t get credential")
+		}
+		res = append(res, blob...)
+		zeroBytes(blob)
+	}
+}
+
+func (k *credentialManager) Delete(account string) error {
+	for chunk := 0; ; chunk++ {
+		err := k.delete(k.target(account, chunk))
+		if err == errorNotFound && chunk > 0 {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "can`t delete credential")
+		}
+	}
+}
+
+func (k *credentialManager) write(target, account string, blob []byte) error {
+	targetName, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return err
+	}
+	userName, err := syscall.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         targetName,
+		CredentialBlobSize: uint32(len(blob)),
+		Persist:            credPersistLocalMachine,
+		UserName:           userName,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlob = &blob[0]
+	}
+	if r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); r == 0 {
+		return err
+	}
+	return nil
+}
+
+// read return copy of credential blob, error is syscall.Errno of the call
+func (k *credentialManager) read(target string) ([]byte, error) {
+	targetName, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return nil, err
+	}
+	var cred *credential
+	if r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(targetName)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); r == 0 {
+		return nil, err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred))) //nolint:errcheck
+	if cred.CredentialBlobSize == 0 {
+		return []byte{}, nil
+	}
+	blob := unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)
+	res := append([]byte(nil), blob...)
+	zeroBytes(blob)
+	return res, nil
+}
+
+func (k *credentialManager) delete(target string) error {
+	targetName, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return err
+	}
+	if r, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(targetName)), credTypeGeneric, 0); r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package easyrsa
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// KeyFindingAction select CSRPolicy reaction on suspicious key
+type KeyFindingAction int
+
+const (
+	KeyFindingAllow  KeyFindingAction = iota // finding is ignored
+	KeyFindingWarn                           // CSR is signed, OnKeyFinding get the finding
+	KeyFindingReject                         // CSR is rejected with PolicyViolation
+)
+
+// KeyFinding describe suspicious key of signed CSR
+type KeyFinding struct {
+	CN     string   // cn of the request
+	Reason string   // what is wrong with the key
+	Serial *big.Int // serial of stored cert with the same key, nil for weak keys
+}
+
+func (f *KeyFinding) Error() string {
+	return f.Reason
+}
+
+// keyIndex map public key fingerprints to serials of stored certs. It`s built from storage on first use
+// and updated on issue, so keys of certs stored by other processes are seen after restart only
+type keyIndex struct {
+	mu      sync.Mutex
+	built   bool
+	serials map[string][]keyIndexEntry
+}
+
+type keyIndexEntry struct {
+	cn     string
+	serial *big.Int
+}
+
+// KeyFingerprint return hex sha256 of PKIX encoded public key
+func KeyFingerprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", errors.Wrap(err, "can`t marshal public key")
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// indexKey add key of just issued cert if index is built, it`s built lazily otherwise
+func (p *PKI) indexKey(cn string, serial *big.Int, pub crypto.PublicKey) {
+	idx := &p.keyIndex
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if !idx.built {
+		return
+	}
+	if fp, err := KeyFingerprint(pub); err == nil {
+		idx.serials[fp] = append(idx.serials[fp], keyIndexEntry{cn: cn, serial: serial})
+	}
+}
+
+// keyUsers return stored certs with public key pub, building the index if needed
+func (p *PKI) keyUsers(pub crypto.PublicKey) ([]keyIndexEntry, error) {
+	fp, err := KeyFingerprint(pub)
+	if err != nil {
+		return nil, err
+	}
+	idx := &p.keyIndex
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if !idx.built {
+		serials := make(map[string][]keyIndexEntry)
+		err := ForEach(p.Storage, func(pair *X509Pair) error {
+			cert, err := decodeCert(pair.CertPemBytes)
+			if err != nil {
+				return nil
+			}
+			if fp, err := KeyFingerprint(cert.PublicKey); err == nil {
+				serials[fp] = append(serials[fp], keyIndexEntry{cn: pair.CN, serial: pair.Serial})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t build key index")
+		}
+		idx.serials, idx.built = serials, true
+	}
+	// pairs may be deleted since they were indexed
+	users := idx.serials[fp][:0]
+	for _, entry := range idx.serials[fp] {
+		if _, err := p.Storage.GetBySerial(entry.serial); err != nil {
+			if _, ok := errors.Cause(err).(*NotExist); ok {
+				continue
+			}
+			return nil, errors.Wrap(err, "can`t check key index")
+		}
+		users = append(users, entry)
+	}
+	idx.serials[fp] = users
+	return append([]keyIndexEntry{}, users...), nil
+}
+
+// checkKeyFindings apply reuse and ROCA checks of CSRPolicy to public key of CSR for cn
+func (p *PKI) checkKeyFindings(pub crypto.PublicKey, cn string) error {
+	policy := p.csrPolicy
+	if key, ok := pub.(*rsa.PublicKey); ok && policy.ROCAKeys != KeyFindingAllow && IsROCAKey(key) {
+		finding := &KeyFinding{CN: cn, Reason: "key is generated by ROCA vulnerable generator"}
+		if err := p.keyFinding(policy.ROCAKeys, finding); err != nil {
+			return err
+		}
+	}
+	if !policy.RejectReusedKeys && policy.ReusedKeys == KeyFindingAllow {
+		return nil
+	}
+	users, err := p.keyUsers(pub)
+	if err != nil {
+		return errors.Wrap(err, "can`t check key reuse")
+	}
+	for _, user := range users {
+		finding := &KeyFinding{CN: cn, Serial: user.serial,
+			Reason: fmt.Sprintf("key is already used by %s %s", user.cn, user.serial.Text(16))}
+		if policy.RejectReusedKeys {
+			return errors.WithStack(NewPolicyViolation(finding.Reason))
+		}
+		if user.cn != cn {
+			if err := p.keyFinding(policy.ReusedKeys, finding); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *PKI) keyFinding(action KeyFindingAction, finding *KeyFinding) error {
+	switch action {
+	case KeyFindingReject:
+		return errors.WithStack(NewPolicyViolation(finding.Reason))
+	case KeyFindingWarn:
+		if p.csrPolicy.OnKeyFinding != nil {
+			p.csrPolicy.OnKeyFinding(finding)
+		}
+	}
+	return nil
+}
+
+// rocaPrimes are small primes of ROCA fingerprint, modulus of vulnerable key is in subgroup generated by 65537
+// modulo each of them
+var rocaPrimes = []int64{3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71, 73, 79, 83, 89,
+	97, 101, 103, 107, 109, 113, 127, 131, 137, 139, 149, 151, 157, 163, 167}
+
+var (
+	rocaOnce      sync.Once
+	rocaSubgroups []map[int64]bool
+)
+
+// IsROCAKey return true if RSA modulus has fingerprint of keys generated by Infineon RSALib, CVE-2017-15361.
+// Random modulus has the fingerprint with negligible probability
+func IsROCAKey(key *rsa.PublicKey) bool {
+	rocaOnce.Do(func() {
+		rocaSubgroups = make([]map[int64]bool, len(rocaPrimes))
+		for i, prime := range rocaPrimes {
+			subgroup := map[int64]bool{}
+			for g := int64(1); !subgroup[g]; g = g * 65537 % prime {
+				subgroup[g] = true
+			}
+			rocaSubgroups[i] = subgroup
+		}
+	})
+	mod := new(big.Int)
+	for i, prime := range rocaPrimes {
+		if !rocaSubgroups[i][mod.Mod(key.N, big.NewInt(prime)).Int64()] {
+			return false
+		}
+	}
+	return true
+}
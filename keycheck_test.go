@@ -0,0 +1,68 @@
+package easyrsa
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsROCAKey(t *testing.T) {
+	m := big.NewInt(1)
+	for _, prime := range rocaPrimes {
+		m.Mul(m, big.NewInt(prime))
+	}
+	// modulus with ROCA structure 65537^a mod M + k*M
+	n := new(big.Int).Exp(big.NewInt(65537), big.NewInt(12345), m)
+	n.Add(n, new(big.Int).Mul(m, new(big.Int).Lsh(big.NewInt(1), 1800)))
+	assert.True(t, IsROCAKey(&rsa.PublicKey{N: n, E: 65537}))
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	assert.False(t, IsROCAKey(&key.PublicKey))
+}
+
+func TestPKI_KeyFindings(t *testing.T) {
+	var findings []*KeyFinding
+	policy := &CSRPolicy{MinRSABits: 1024, ReusedKeys: KeyFindingWarn, OnKeyFinding: func(finding *KeyFinding) {
+		findings = append(findings, finding)
+	}}
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithCSRPolicy(policy))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	// issued before the index is built
+	first, err := pki.SignCSR(newRSACSR(t, key, "web"), "web", true, nil)
+	assert.NoError(t, err)
+
+	_, err = pki.SignCSR(newRSACSR(t, key, "web"), "web", true, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, findings, "renewal of the same cn is not a finding")
+
+	_, err = pki.SignCSR(newRSACSR(t, key, "db"), "db", true, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, findings, 2) {
+		assert.Equal(t, "db", findings[0].CN)
+		assert.Equal(t, first.Serial, findings[0].Serial)
+	}
+
+	policy.ReusedKeys = KeyFindingReject
+	_, err = pki.SignCSR(newRSACSR(t, key, "cache"), "cache", true, nil)
+	assert.True(t, isPolicyViolation(err))
+
+	// deleted pairs are dropped from the index
+	for _, cn := range []string{"web", "db"} {
+		pairs, err := pki.Storage.GetByCN(cn)
+		assert.NoError(t, err)
+		for _, pair := range pairs {
+			assert.NoError(t, pki.Storage.DeleteBySerial(pair.Serial))
+		}
+	}
+	_, err = pki.SignCSR(newRSACSR(t, key, "cache"), "cache", true, nil)
+	assert.NoError(t, err)
+}
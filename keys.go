@@ -0,0 +1,248 @@
+package easyrsa
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"hash"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// PEM block headers of supported private key formats
+const (
+	PEMPrivateKeyBlock          = "PRIVATE KEY"           // pem block header for PKCS #8 key
+	PEMEncryptedPrivateKeyBlock = "ENCRYPTED PRIVATE KEY" // pem block header for PKCS #8 PBES2 encrypted key
+	PEMECPrivateKeyBlock        = "EC PRIVATE KEY"        // pem block header for SEC 1 ec key
+)
+
+// KeyAlgorithm is an algorithm of keys generated for issued certs
+type KeyAlgorithm string
+
+const (
+	KeyAlgorithmRSA   KeyAlgorithm = "rsa"   // RSA key of PKI key size
+	KeyAlgorithmECDSA KeyAlgorithm = "ecdsa" // ECDSA P-256 key
+)
+
+// generateRequestKey generate key of algorithm, RSA if it`s empty
+func (p *PKI) generateRequestKey(algorithm KeyAlgorithm) (crypto.Signer, error) {
+	switch algorithm {
+	case "", KeyAlgorithmRSA:
+		return p.generateKey()
+	case KeyAlgorithmECDSA:
+		return p.generateECDSAKey()
+	}
+	return nil, errors.Errorf("unsupported key algorithm %q", algorithm)
+}
+
+// encodeSigner pem encode rsa key as PKCS #1 and ecdsa key as SEC 1, intermediate der bytes are zeroed
+func encodeSigner(signer crypto.Signer) ([]byte, error) {
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		return encodeKey(key), nil
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t marshal ec key")
+		}
+		defer zeroBytes(der)
+		return pem.EncodeToMemory(&pem.Block{Type: PEMECPrivateKeyBlock, Bytes: der}), nil
+	}
+	return nil, errors.Errorf("unsupported key type %T", signer)
+}
+
+// PassphraseFunc return passphrase for encrypted pem key
+type PassphraseFunc func() ([]byte, error)
+
+// DecodeSigner decode pem bytes to crypto.Signer and x509.Certificate.
+// PKCS #1, PKCS #8 and SEC 1 keys are supported, encrypted keys require passphrase.
+// Signer is nil for cert only pair
+func (pair *X509Pair) DecodeSigner(passphrase PassphraseFunc) (crypto.Signer, *x509.Certificate, error) {
+	cert, err := decodeCert(pair.CertPemBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !pair.HasKey() {
+		return nil, cert, nil
+	}
+	signer, err := ParsePrivateKeyPEM(pair.KeyPemBytes, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !publicKeyEqual(signer.Public(), cert.PublicKey) {
+		return nil, nil, errors.New("key does not match cert")
+	}
+	return signer, cert, nil
+}
+
+// ParsePrivateKeyPEM parse first private key pem block as rsa, ecdsa or ed25519 private key.
+// Other blocks are skipped, passphrase is called only for encrypted blocks and may be nil
+func ParsePrivateKeyPEM(keyPemBytes []byte, passphrase PassphraseFunc) (crypto.Signer, error) {
+	block := findBlock(keyPemBytes, isKeyBlockType)
+	if block == nil {
+		return nil, errors.New("can`t parse key")
+	}
+	der := block.Bytes
+	defer zeroBytes(der)
+	if isEncryptedBlock(block) {
+		if passphrase == nil {
+			return nil, errors.New("key is encrypted and no passphrase provided")
+		}
+		pass, err := passphrase()
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t get passphrase")
+		}
+		defer zeroBytes(pass)
+		if block.Type == PEMEncryptedPrivateKeyBlock {
+			der, err = decryptPKCS8(block.Bytes, pass)
+		} else {
+			der, err = x509.DecryptPEMBlock(block, pass) //nolint:staticcheck
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t decrypt key")
+		}
+		defer zeroBytes(der)
+	}
+	return parsePrivateKey(der)
+}
+
+func isEncryptedKey(keyPemBytes []byte) bool {
+	block := findBlock(keyPemBytes, isKeyBlockType)
+	return block != nil && isEncryptedBlock(block)
+}
+
+func isEncryptedBlock(block *pem.Block) bool {
+	//nolint:staticcheck // legacy encrypted pem is still produced by openssl and easy-rsa
+	return x509.IsEncryptedPEMBlock(block) || block.Type == PEMEncryptedPrivateKeyBlock
+}
+
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case *ecdsa.PrivateKey:
+			return key, nil
+		case ed25519.PrivateKey:
+			return key, nil
+		}
+		return nil, errors.New("unsupported pkcs8 key type")
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("can`t parse key as pkcs1, pkcs8 or sec1")
+}
+
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	pbes2CipherSizes  = map[string]int{
+		oidAES128CBC.String(): 16,
+		oidAES192CBC.String(): 24,
+		oidAES256CBC.String(): 32,
+	}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypt PBES2 (PBKDF2 + AES-CBC) encrypted PKCS #8 key as produced by openssl pkcs8 -topk8 -v2
+func decryptPKCS8(der []byte, pass []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, errors.Wrap(err, "can`t parse encrypted key info")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.New("only pbes2 encrypted keys are supported")
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.Wrap(err, "can`t parse pbes2 params")
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.New("only pbkdf2 key derivation is supported")
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, errors.Wrap(err, "can`t parse pbkdf2 params")
+	}
+	var prf func() hash.Hash
+	switch {
+	case kdf.PRF.Algorithm == nil || kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, errors.New("unsupported pbkdf2 prf")
+	}
+	keySize, ok := pbes2CipherSizes[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, errors.New("unsupported pbes2 cipher")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("can`t parse cipher iv")
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.New("wrong encrypted data length")
+	}
+
+	key := pbkdf2.Key(pass, kdf.Salt, kdf.IterationCount, keySize, prf)
+	defer zeroBytes(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(res, info.EncryptedData)
+	padding := int(res[len(res)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		zeroBytes(res)
+		return nil, errors.New("wrong passphrase or corrupted key")
+	}
+	for _, b := range res[len(res)-padding:] {
+		if int(b) != padding {
+			zeroBytes(res)
+			return nil, errors.New("wrong passphrase or corrupted key")
+		}
+	}
+	return res[:len(res)-padding], nil
+}
@@ -0,0 +1,126 @@
+package easyrsa
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func selfSigned(t *testing.T, signer interface{}, pub interface{}) []byte {
+	tml := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "key"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tml, tml, pub, signer)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: PEMCertificateBlock, Bytes: der})
+}
+
+func TestX509Pair_DecodeSigner(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	sec1, _ := x509.MarshalECPrivateKey(ecKey)
+	ed8, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	//nolint:staticcheck
+	legacy, _ := x509.EncryptPEMBlock(rand.Reader, PEMRSAPrivateKeyBlock, x509.MarshalPKCS1PrivateKey(rsaKey),
+		[]byte("secret"), x509.PEMCipherAES256)
+	pbes2Key, _ := ioutil.ReadFile(filepath.Join(getTestDir(), "keys", "pbes2.key"))
+	pbes2Cert, _ := ioutil.ReadFile(filepath.Join(getTestDir(), "keys", "pbes2.crt"))
+	secret := func() ([]byte, error) { return []byte("secret"), nil }
+	wrong := func() ([]byte, error) { return []byte("wrong"), nil }
+	failing := func() ([]byte, error) { return nil, errors.New("no tty") }
+
+	rsaCert := selfSigned(t, rsaKey, &rsaKey.PublicKey)
+	tests := []struct {
+		name       string
+		pair       *X509Pair
+		passphrase PassphraseFunc
+		wantErr    bool
+	}{
+		{
+			name: "pkcs8 rsa",
+			pair: NewX509Pair(pem.EncodeToMemory(&pem.Block{Type: PEMPrivateKeyBlock, Bytes: pkcs8}), rsaCert, "key", big.NewInt(1)),
+		},
+		{
+			name: "sec1 ec",
+			pair: NewX509Pair(pem.EncodeToMemory(&pem.Block{Type: PEMECPrivateKeyBlock, Bytes: sec1}),
+				selfSigned(t, ecKey, &ecKey.PublicKey), "key", big.NewInt(1)),
+		},
+		{
+			name: "pkcs8 ed25519",
+			pair: NewX509Pair(pem.EncodeToMemory(&pem.Block{Type: PEMPrivateKeyBlock, Bytes: ed8}),
+				selfSigned(t, edKey, edPub), "key", big.NewInt(1)),
+		},
+		{
+			name:       "legacy encrypted",
+			pair:       NewX509Pair(pem.EncodeToMemory(legacy), rsaCert, "key", big.NewInt(1)),
+			passphrase: secret,
+		},
+		{
+			name:    "legacy encrypted without passphrase",
+			pair:    NewX509Pair(pem.EncodeToMemory(legacy), rsaCert, "key", big.NewInt(1)),
+			wantErr: true,
+		},
+		{
+			name:       "legacy encrypted failing passphrase",
+			pair:       NewX509Pair(pem.EncodeToMemory(legacy), rsaCert, "key", big.NewInt(1)),
+			passphrase: failing,
+			wantErr:    true,
+		},
+		{
+			name:       "pbes2",
+			pair:       NewX509Pair(pbes2Key, pbes2Cert, "pbes2", big.NewInt(66)),
+			passphrase: secret,
+		},
+		{
+			name:       "pbes2 wrong passphrase",
+			pair:       NewX509Pair(pbes2Key, pbes2Cert, "pbes2", big.NewInt(66)),
+			passphrase: wrong,
+			wantErr:    true,
+		},
+		{
+			name:    "mismatch",
+			pair:    NewX509Pair(pem.EncodeToMemory(&pem.Block{Type: PEMECPrivateKeyBlock, Bytes: sec1}), rsaCert, "key", big.NewInt(1)),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, cert, err := tt.pair.DecodeSigner(tt.passphrase)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("X509Pair.DecodeSigner() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				assert.NotNil(t, signer)
+				assert.NotNil(t, cert)
+			}
+		})
+	}
+	t.Run("decode non rsa", func(t *testing.T) {
+		_, _, err := tests[1].pair.Decode()
+		assert.Error(t, err)
+		_, _, err = tests[0].pair.Decode()
+		assert.NoError(t, err)
+	})
+	t.Run("validate encrypted", func(t *testing.T) {
+		assert.NoError(t, NewX509Pair(pbes2Key, pbes2Cert, "pbes2", big.NewInt(66)).Validate())
+	})
+}
@@ -0,0 +1,142 @@
+package easyrsa
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// KubernetesManagedBy is a value of app.kubernetes.io/managed-by label set on delivered objects
+const KubernetesManagedBy = "go-easyrsa"
+
+const kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubernetesClient deliver pairs to Secrets and CRLs to ConfigMaps with server side apply,
+// objects are created if missing and fields owned by other managers are overwritten
+type KubernetesClient struct {
+	APIServer    string            // API server url
+	Token        string            // bearer token, not sent if empty
+	Client       *http.Client      // http.DefaultClient is used if nil
+	FieldManager string            // server side apply field manager, KubernetesManagedBy if empty
+	Labels       map[string]string // extra labels set on every delivered object
+}
+
+// NewInClusterKubernetesClient create client with service account of the pod
+func NewInClusterKubernetesClient() (*KubernetesClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in kubernetes cluster")
+	}
+	token, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/token")
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t read service account token")
+	}
+	caPem, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t read service account ca")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPem) {
+		return nil, errors.New("can`t parse service account ca")
+	}
+	return &KubernetesClient{
+		APIServer: "https://" + net.JoinHostPort(host, port),
+		Token:     strings.TrimSpace(string(token)),
+		Client:    &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}},
+	}, nil
+}
+
+// DeliverPair apply kubernetes.io/tls Secret with tls.crt as cert followed by intermediates,
+// tls.key and ca.crt as issuing chain. Pair cn and serial are set as annotations
+func (k *KubernetesClient) DeliverPair(ctx context.Context, pair *X509Pair, namespace, name string) error {
+	if !pair.HasKey() {
+		return errors.New("pair has no key for tls secret")
+	}
+	if isEncryptedKey(pair.KeyPemBytes) {
+		return errors.New("encrypted key can`t be used in tls secret")
+	}
+	data := map[string][]byte{
+		"tls.crt": pair.FullChainPEM(),
+		"tls.key": pair.KeyPemBytes,
+		"ca.crt":  pair.CAChainPEM(),
+	}
+	annotations := map[string]string{"easyrsa/cn": pair.CN, "easyrsa/serial": pair.Serial.Text(16)}
+	return k.apply(ctx, namespace, "secrets", map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   k.metadata(namespace, name, annotations),
+		"type":       "kubernetes.io/tls",
+		"data":       data,
+	})
+}
+
+// DeliverCRL apply ConfigMap with pem encoded CRL under key
+func (k *KubernetesClient) DeliverCRL(ctx context.Context, crlPem []byte, namespace, name, key string) error {
+	return k.apply(ctx, namespace, "configmaps", map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   k.metadata(namespace, name, nil),
+		"data":       map[string]string{key: string(crlPem)},
+	})
+}
+
+// CRLTarget return CRLPublisher target applying the CRL to ConfigMap
+func (k *KubernetesClient) CRLTarget(namespace, name, key string) CRLTarget {
+	return CRLTarget{
+		Name: fmt.Sprintf("configmap %s/%s", namespace, name),
+		Publish: func(ctx context.Context, crlPem []byte) error {
+			return k.DeliverCRL(ctx, crlPem, namespace, name, key)
+		},
+	}
+}
+
+func (k *KubernetesClient) metadata(namespace, name string, annotations map[string]string) map[string]interface{} {
+	labels := map[string]string{"app.kubernetes.io/managed-by": KubernetesManagedBy}
+	for key, value := range k.Labels {
+		labels[key] = value
+	}
+	res := map[string]interface{}{"name": name, "namespace": namespace, "labels": labels}
+	if len(annotations) > 0 {
+		res["annotations"] = annotations
+	}
+	return res
+}
+
+func (k *KubernetesClient) apply(ctx context.Context, namespace, resource string, object map[string]interface{}) error {
+	body, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	manager := k.FieldManager
+	if manager == "" {
+		manager = KubernetesManagedBy
+	}
+	name := object["metadata"].(map[string]interface{})["name"].(string)
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/%s/%s?fieldManager=%s&force=true",
+		strings.TrimSuffix(k.APIServer, "/"), url.PathEscape(namespace), resource, url.PathEscape(name), url.QueryEscape(manager))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, u, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "can`t create request")
+	}
+	// json is valid yaml for apply patch
+	req.Header.Set("Content-Type", "application/apply-patch+yaml")
+	if k.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.Token)
+	}
+	client := k.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return errors.Wrapf(doPublishRequest(client, req), "can`t apply %s %s/%s", resource, namespace, name)
+}
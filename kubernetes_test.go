@@ -0,0 +1,70 @@
+package easyrsa
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKubernetesClient(t *testing.T) {
+	objects := make(map[string]map[string]interface{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPatch, r.Method)
+		assert.Equal(t, "application/apply-patch+yaml", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "pki", r.URL.Query().Get("fieldManager"))
+		assert.Equal(t, "true", r.URL.Query().Get("force"))
+		var object map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&object))
+		objects[r.URL.Path] = object
+	}))
+	defer server.Close()
+	k := &KubernetesClient{APIServer: server.URL, Token: "token", FieldManager: "pki", Labels: map[string]string{"team": "infra"}}
+
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	pair, err := pki.NewCert("web", true, nil)
+	assert.NoError(t, err)
+
+	t.Run("secret", func(t *testing.T) {
+		assert.NoError(t, k.DeliverPair(context.Background(), pair, "prod", "web-tls"))
+		secret := objects["/api/v1/namespaces/prod/secrets/web-tls"]
+		if !assert.NotNil(t, secret) {
+			return
+		}
+		assert.Equal(t, "kubernetes.io/tls", secret["type"])
+		metadata := secret["metadata"].(map[string]interface{})
+		assert.Equal(t, map[string]interface{}{"app.kubernetes.io/managed-by": KubernetesManagedBy, "team": "infra"}, metadata["labels"])
+		assert.Equal(t, pair.Serial.Text(16), metadata["annotations"].(map[string]interface{})["easyrsa/serial"])
+		data := secret["data"].(map[string]interface{})
+		for key, want := range map[string][]byte{"tls.crt": pair.FullChainPEM(), "tls.key": pair.KeyPemBytes, "ca.crt": pair.CAChainPEM()} {
+			got, err := base64.StdEncoding.DecodeString(data[key].(string))
+			assert.NoError(t, err)
+			assert.Equal(t, want, got, key)
+		}
+		assert.Error(t, k.DeliverPair(context.Background(), NewX509Pair(nil, pair.CertPemBytes, pair.CN, pair.Serial), "prod", "web-tls"))
+	})
+
+	t.Run("crl", func(t *testing.T) {
+		publisher := &CRLPublisher{Targets: []CRLTarget{k.CRLTarget("vpn", "crl", "crl.pem")}}
+		res := publisher.Publish(context.Background(), []byte("crl"))
+		assert.NoError(t, res[0].Err)
+		configMap := objects["/api/v1/namespaces/vpn/configmaps/crl"]
+		if assert.NotNil(t, configMap) {
+			assert.Equal(t, map[string]interface{}{"crl.pem": "crl"}, configMap["data"])
+		}
+	})
+
+	t.Run("in cluster", func(t *testing.T) {
+		t.Setenv("KUBERNETES_SERVICE_HOST", "")
+		_, err := NewInClusterKubernetesClient()
+		assert.Error(t, err)
+	})
+}
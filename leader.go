@@ -0,0 +1,196 @@
+package easyrsa
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+)
+
+// LeaderLock is a lease shared by PKI instances of one backend, only lease holder is the leader
+type LeaderLock interface {
+	Acquire(id string, ttl time.Duration) (bool, error) // Acquire take free or expired lease or renew own one for ttl.
+	Release(id string) error                            // Release free lease if it`s held by id.
+}
+
+// FileLeaderLock implement LeaderLock with lease file on storage shared by instances
+type FileLeaderLock struct {
+	locker *flock.Flock
+	path   string
+	now    func() time.Time
+}
+
+func NewFileLeaderLock(path string) *FileLeaderLock {
+	return &FileLeaderLock{locker: flock.New(path + ".lock"), path: path, now: time.Now}
+}
+
+type lease struct {
+	ID      string    `json:"id"`
+	Expires time.Time `json:"expires"`
+}
+
+func (l *FileLeaderLock) Acquire(id string, ttl time.Duration) (bool, error) {
+	acquired := false
+	err := l.withLock(func() error {
+		current, err := l.read()
+		if err != nil {
+			return err
+		}
+		now := l.now()
+		if current.ID != "" && current.ID != id && now.Before(current.Expires) {
+			return nil
+		}
+		acquired = true
+		return l.write(&lease{ID: id, Expires: now.Add(ttl)})
+	})
+	return acquired, err
+}
+
+func (l *FileLeaderLock) Release(id string) error {
+	return l.withLock(func() error {
+		current, err := l.read()
+		if err != nil || current.ID != id {
+			return err
+		}
+		return l.write(&lease{})
+	})
+}
+
+func (l *FileLeaderLock) withLock(fn func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), LockTimeout)
+	defer cancel()
+	locked, err := l.locker.TryLockContext(ctx, LockPeriod)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errors.New("can`t lock lease file")
+	}
+	defer func() {
+		_ = l.locker.Unlock()
+	}()
+	return fn()
+}
+
+func (l *FileLeaderLock) read() (*lease, error) {
+	res := &lease{}
+	data, err := ioutil.ReadFile(l.path)
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t read lease file")
+	}
+	if err := json.Unmarshal(data, res); err != nil {
+		return nil, errors.Wrap(err, "can`t parse lease file")
+	}
+	return res, nil
+}
+
+func (l *FileLeaderLock) write(current *lease) error {
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(ioutil.WriteFile(l.path, data, 0666), "can`t write lease file")
+}
+
+// Elector keep leadership of one PKI instance, lease is acquired or renewed on every leader only operation
+// and by Run, so leader which stopped working lose leadership after ttl
+type Elector struct {
+	lock LeaderLock
+	id   string
+	ttl  time.Duration
+	mu   sync.Mutex
+}
+
+// NewElector create elector of instance id, id must be uniq among instances sharing the lock
+func NewElector(lock LeaderLock, id string, ttl time.Duration) *Elector {
+	return &Elector{lock: lock, id: id, ttl: ttl}
+}
+
+// Leader acquire or renew the lease and report leadership
+func (e *Elector) Leader() (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	leader, err := e.lock.Acquire(e.id, e.ttl)
+	if err != nil {
+		return false, errors.Wrap(err, "can`t acquire leader lease")
+	}
+	return leader, nil
+}
+
+// Resign release the lease, so other instance can take over without waiting for ttl
+func (e *Elector) Resign() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lock.Release(e.id)
+}
+
+// Run renew the lease every third of ttl until ctx is done, onChange is called when leadership is gained or lost.
+// The lease is released on return
+func (e *Elector) Run(ctx context.Context, onChange func(leader bool), onError func(error)) error {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	was := false
+	for {
+		leader, err := e.Leader()
+		if err != nil && onError != nil {
+			onError(err)
+		}
+		if leader != was && onChange != nil {
+			onChange(leader)
+		}
+		was = leader
+		select {
+		case <-ctx.Done():
+			_ = e.Resign()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WithLeaderElection make CRL signing, CA and CRL signer rotation and batch renewal fail with NotLeader
+// on instances not holding the lease
+func WithLeaderElection(elector *Elector) Option {
+	return func(p *PKI) {
+		p.elector = elector
+	}
+}
+
+// IsLeader report whether this instance may do leader only operations, always true without election
+func (p *PKI) IsLeader() (bool, error) {
+	if p.elector == nil {
+		return true, nil
+	}
+	return p.elector.Leader()
+}
+
+// requireLeader return NotLeader if other instance hold the lease
+func (p *PKI) requireLeader() error {
+	leader, err := p.IsLeader()
+	if err != nil {
+		return err
+	}
+	if !leader {
+		return errors.WithStack(NewNotLeader("other instance is the leader"))
+	}
+	return nil
+}
+
+// RegenerateCRL sign current revoked list again with fresh this update, e.g. to roll out new CRL signer
+func (p *PKI) RegenerateCRL() ([]byte, error) {
+	p.crlMu.Lock()
+	defer p.crlMu.Unlock()
+	list, err := p.GetCRL()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get current crl")
+	}
+	return p.signCRL(list.TBSCertList.RevokedCertificates)
+}
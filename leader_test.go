@@ -0,0 +1,102 @@
+package easyrsa
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileLeaderLock(t *testing.T) {
+	_, cleanup := getTmpPki()
+	defer cleanup()
+	lock := NewFileLeaderLock(filepath.Join(testData, "leader"))
+	now := time.Now()
+	lock.now = func() time.Time { return now }
+
+	ok, err := lock.Acquire("a", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = lock.Acquire("b", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = lock.Acquire("a", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok, "own lease is renewed")
+
+	now = now.Add(2 * time.Minute)
+	ok, err = lock.Acquire("b", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok, "expired lease is taken")
+
+	assert.NoError(t, lock.Release("a"))
+	ok, _ = lock.Acquire("a", time.Minute)
+	assert.False(t, ok, "release of foreign lease does nothing")
+	assert.NoError(t, lock.Release("b"))
+	ok, _ = lock.Acquire("a", time.Minute)
+	assert.True(t, ok)
+}
+
+func TestPKI_WithLeaderElection(t *testing.T) {
+	leader, cleanup := getTmpPki(WithLeaderElection(NewElector(NewFileLeaderLock(filepath.Join(testData, "leader")), "a", time.Minute)))
+	defer cleanup()
+	follower := NewPKI(leader.Storage, leader.serialProvider, leader.crlHolder, leader.subjTemplate,
+		WithLeaderElection(NewElector(NewFileLeaderLock(filepath.Join(testData, "leader")), "b", time.Minute)))
+
+	_, err := leader.NewCa()
+	assert.NoError(t, err)
+	pair, err := follower.NewCert("client", false, nil)
+	assert.NoError(t, err, "issuance is not leader only")
+
+	_, err = follower.NewCa()
+	_, ok := errors.Cause(err).(*NotLeader)
+	assert.True(t, ok)
+	err = follower.RevokeOne(pair.Serial)
+	_, ok = errors.Cause(err).(*NotLeader)
+	assert.True(t, ok)
+	_, err = follower.RenewBatch(nil, 1)
+	assert.Error(t, err)
+	assert.False(t, follower.IsRevoked(pair.Serial))
+
+	assert.NoError(t, leader.RevokeOne(pair.Serial))
+	assert.True(t, follower.IsRevoked(pair.Serial))
+	_, err = leader.RegenerateCRL()
+	assert.NoError(t, err)
+	assert.True(t, leader.IsRevoked(pair.Serial))
+
+	assert.NoError(t, leader.elector.Resign())
+	isLeader, err := follower.IsLeader()
+	assert.NoError(t, err)
+	assert.True(t, isLeader)
+}
+
+func TestElector_Run(t *testing.T) {
+	_, cleanup := getTmpPki()
+	defer cleanup()
+	lock := NewFileLeaderLock(filepath.Join(testData, "leader"))
+	// lease time is moved by the test only, so slow renewals under load can`t expire it
+	base := time.Now()
+	var offset int64
+	lock.now = func() time.Time { return base.Add(time.Duration(atomic.LoadInt64(&offset))) }
+	elector := NewElector(lock, "a", 30*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan bool, 10)
+	done := make(chan error)
+	go func() { done <- elector.Run(ctx, func(leader bool) { changes <- leader }, nil) }()
+	assert.True(t, <-changes)
+	atomic.StoreInt64(&offset, int64(time.Minute))
+	assert.Eventually(t, func() bool {
+		current, err := lock.read()
+		return err == nil && current.ID == "a" && current.Expires.After(base.Add(time.Minute))
+	}, 10*time.Second, 5*time.Millisecond, "lease is renewed by Run")
+	ok, _ := lock.Acquire("b", time.Minute)
+	assert.False(t, ok, "lease is renewed by Run")
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	ok, _ = lock.Acquire("b", time.Minute)
+	assert.True(t, ok, "lease is released on return")
+}
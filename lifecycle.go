@@ -0,0 +1,177 @@
+package easyrsa
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// background is a component started by PKI.Run
+type background struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// lifecycle hold background components and closers of PKI
+type lifecycle struct {
+	mu         sync.Mutex
+	components []background
+	closers    []io.Closer        // closed by Close in reverse order
+	group      *errgroup.Group    // group of running components, nil if PKI is not running
+	ctx        context.Context    // context of running components
+	cancel     context.CancelFunc // stop running components
+	done       chan struct{}      // closed when Run return
+	closed     bool
+}
+
+// WithBackground add component run by PKI.Run, e.g. SIEMSink.Run or Notifier.Run.
+// Component must return when ctx is done
+func WithBackground(name string, run func(ctx context.Context) error) Option {
+	return func(p *PKI) {
+		p.AddBackground(name, run)
+	}
+}
+
+// WithBackgroundCARenewal run RunCARenewal with interval as background component, use it with WithCARenewal
+func WithBackgroundCARenewal(interval time.Duration, onError func(error)) Option {
+	return func(p *PKI) {
+		p.AddBackground("ca renewal", func(ctx context.Context) error {
+			return p.RunCARenewal(ctx, interval, onError)
+		})
+	}
+}
+
+// WithBackgroundSupersede run RunSupersede with interval as background component, use it with WithSupersedeOnRenew
+func WithBackgroundSupersede(interval time.Duration, onError func(error)) Option {
+	return func(p *PKI) {
+		p.AddBackground("supersede", func(ctx context.Context) error {
+			return p.RunSupersede(ctx, interval, onError)
+		})
+	}
+}
+
+// AddBackground add component run by Run, it`s started at once if PKI is running
+func (p *PKI) AddBackground(name string, run func(ctx context.Context) error) {
+	l := &p.lifecycle
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	component := background{name: name, run: run}
+	l.components = append(l.components, component)
+	if l.group != nil {
+		l.start(component)
+	}
+}
+
+// AddCloser add closer closed by Close after background components are stopped, e.g. Replicator
+func (p *PKI) AddCloser(closer io.Closer) {
+	l := &p.lifecycle
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closers = append(l.closers, closer)
+}
+
+func (l *lifecycle) start(component background) {
+	ctx := l.ctx
+	l.group.Go(func() error {
+		err := component.run(ctx)
+		if err == nil || ctx.Err() != nil {
+			return nil
+		}
+		return errors.Wrapf(err, "%s stopped", component.name)
+	})
+}
+
+// Run start background components and block until ctx is done, Close is called or any component fail.
+// All components are stopped before it return, error of the first failed component is returned
+func (p *PKI) Run(ctx context.Context) error {
+	l := &p.lifecycle
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return errors.New("pki is closed")
+	}
+	if l.group != nil {
+		l.mu.Unlock()
+		return errors.New("pki is already running")
+	}
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.group, l.ctx = errgroup.WithContext(ctx)
+	l.done = make(chan struct{})
+	for _, component := range l.components {
+		l.start(component)
+	}
+	// keep group running until ctx is done, even without components
+	group, groupCtx := l.group, l.ctx
+	group.Go(func() error {
+		<-groupCtx.Done()
+		return nil
+	})
+	l.mu.Unlock()
+
+	err := group.Wait()
+	l.mu.Lock()
+	l.cancel()
+	l.group, l.ctx, l.cancel = nil, nil, nil
+	close(l.done)
+	l.mu.Unlock()
+	return err
+}
+
+// Close stop running background components, wait for them and close closers and storage if it implement io.Closer.
+// PKI can`t be run after Close, repeated calls do nothing
+func (p *PKI) Close() error {
+	l := &p.lifecycle
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	cancel, done := l.cancel, l.done
+	closers := append([]io.Closer{}, l.closers...)
+	l.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	if closer, ok := p.Storage.(io.Closer); ok {
+		closers = append([]io.Closer{closer}, closers...)
+	}
+	var res error
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil && res == nil {
+			res = errors.Wrap(err, "can`t close")
+		}
+	}
+	return res
+}
+
+// HTTPServerBackground return background component serving srv, e.g. with OCSPResponder handler,
+// and shutting it down within timeout when ctx is done
+func HTTPServerBackground(srv *http.Server, timeout time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- srv.ListenAndServe()
+		}()
+		select {
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return errors.Wrap(err, "can`t shutdown http server")
+		}
+		if err := <-errCh; err != http.ErrServerClosed {
+			return err
+		}
+		return ctx.Err()
+	}
+}
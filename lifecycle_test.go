@@ -0,0 +1,80 @@
+package easyrsa
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+func TestPKI_RunClose(t *testing.T) {
+	var stopped int32
+	loop := func(ctx context.Context) error {
+		<-ctx.Done()
+		atomic.AddInt32(&stopped, 1)
+		return ctx.Err()
+	}
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithBackground("first", loop))
+	defer cleanup()
+	closed := make([]string, 0)
+	pki.AddCloser(closerFunc(func() error {
+		closed = append(closed, "first")
+		return nil
+	}))
+	pki.AddCloser(closerFunc(func() error {
+		closed = append(closed, "second")
+		return nil
+	}))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- pki.Run(context.Background())
+	}()
+	assert.Eventually(t, func() bool {
+		pki.lifecycle.mu.Lock()
+		defer pki.lifecycle.mu.Unlock()
+		return pki.lifecycle.group != nil
+	}, time.Second, time.Millisecond)
+	assert.Error(t, pki.Run(context.Background()))
+	pki.AddBackground("second", loop)
+
+	assert.NoError(t, pki.Close())
+	assert.NoError(t, <-done)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&stopped))
+	assert.Equal(t, []string{"second", "first"}, closed)
+	assert.NoError(t, pki.Close())
+	assert.Len(t, closed, 2)
+	assert.Error(t, pki.Run(context.Background()))
+}
+
+func TestPKI_RunFailure(t *testing.T) {
+	var stopped int32
+	pki, cleanup := getTmpPki(WithKeySize(1024),
+		WithBackground("loop", func(ctx context.Context) error {
+			<-ctx.Done()
+			atomic.AddInt32(&stopped, 1)
+			return ctx.Err()
+		}),
+		WithBackground("broken", func(ctx context.Context) error {
+			return errors.New("boom")
+		}))
+	defer cleanup()
+	err := pki.Run(context.Background())
+	assert.EqualError(t, err, "broken stopped: boom")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&stopped))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	pki, cleanup = getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	assert.NoError(t, pki.Run(ctx))
+}
@@ -0,0 +1,66 @@
+package easyrsa
+
+import (
+	"github.com/pkg/errors"
+)
+
+// NewCertWithMetadata generate new pair as NewCert and store metadata tags with it
+func (p *PKI) NewCertWithMetadata(cn string, server bool, groups []string, metadata map[string]string) (*X509Pair, error) {
+	if err := p.requireAttestation(); err != nil {
+		return nil, err
+	}
+	if err := checkMetadata(metadata); err != nil {
+		return nil, err
+	}
+	return p.issueRequest(CertRequest{CN: cn, Server: server, Groups: groups, Metadata: metadata})
+}
+
+// SignCSRWithMetadata issue cert for CSR as SignCSR and store metadata tags with it
+func (p *PKI) SignCSRWithMetadata(csrPem []byte, cn string, server bool, groups []string, metadata map[string]string) (*X509Pair, error) {
+	if err := p.requireAttestation(); err != nil {
+		return nil, err
+	}
+	if err := checkMetadata(metadata); err != nil {
+		return nil, err
+	}
+	csr, err := decodeCSR(csrPem)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkCSR(csr, cn, ""); err != nil {
+		return nil, err
+	}
+	return p.issueRequest(CertRequest{CN: cn, Server: server, Groups: groups, CSR: csr, Metadata: metadata})
+}
+
+// FindByMetadata return stored pairs having all selector tags, empty value match any value of the tag
+func (p *PKI) FindByMetadata(selector map[string]string) ([]*X509Pair, error) {
+	res := make([]*X509Pair, 0)
+	err := ForEach(p.Storage, func(pair *X509Pair) error {
+		for key, value := range selector {
+			got, ok := pair.Metadata[key]
+			if !ok || (value != "" && got != value) {
+				return nil
+			}
+		}
+		res = append(res, pair)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t search pairs")
+	}
+	return res, nil
+}
+
+func checkMetadata(metadata map[string]string) error {
+	for key := range metadata {
+		if key == "" {
+			return errors.New("empty metadata key")
+		}
+		switch key {
+		case MetadataAttestation, MetadataRequester, MetadataIdempotencyKey, MetadataIdempotencyRequest, MetadataDualStackPeer:
+			return errors.Errorf("metadata key %s is reserved", key)
+		}
+	}
+	return nil
+}
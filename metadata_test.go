@@ -0,0 +1,60 @@
+package easyrsa
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_Metadata(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	laptop, err := pki.NewCertWithMetadata("laptop", false, nil, map[string]string{"team": "infra", "ticket": "OPS-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "infra", laptop.Metadata["team"])
+	router, err := pki.SignCSRWithMetadata(newTestCSR(t, "router"), "router", true, nil, map[string]string{"team": "net", "device": "r1"})
+	assert.NoError(t, err)
+	_, err = pki.NewCert("plain", false, nil)
+	assert.NoError(t, err)
+	_, err = pki.NewCertWithMetadata("bad", false, nil, map[string]string{"": "x"})
+	assert.Error(t, err)
+
+	t.Run("persisted", func(t *testing.T) {
+		pair, err := pki.Storage.GetBySerial(router.Serial)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"team": "net", "device": "r1"}, pair.Metadata)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		found, err := pki.FindByMetadata(map[string]string{"team": "infra"})
+		assert.NoError(t, err)
+		if assert.Len(t, found, 1) {
+			assert.Equal(t, laptop.Serial, found[0].Serial)
+		}
+		found, err = pki.FindByMetadata(map[string]string{"team": ""})
+		assert.NoError(t, err)
+		assert.Len(t, found, 2)
+		found, err = pki.FindByMetadata(map[string]string{"team": "net", "ticket": ""})
+		assert.NoError(t, err)
+		assert.Empty(t, found)
+	})
+
+	t.Run("kept on renewal", func(t *testing.T) {
+		renewed, err := pki.RenewBatch([]*big.Int{laptop.Serial}, 1)
+		assert.NoError(t, err)
+		pair, err := pki.Storage.GetBySerial(renewed[0].Serial)
+		assert.NoError(t, err)
+		assert.Equal(t, laptop.Metadata, pair.Metadata)
+	})
+
+	t.Run("removed with pair", func(t *testing.T) {
+		assert.NoError(t, pki.Storage.DeleteBySerial(router.Serial))
+		found, err := pki.FindByMetadata(map[string]string{"device": "r1"})
+		assert.NoError(t, err)
+		assert.Empty(t, found)
+	})
+}
@@ -0,0 +1,176 @@
+package easyrsa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultExpiryThresholds is a default set of Notifier thresholds
+var DefaultExpiryThresholds = []time.Duration{30 * 24 * time.Hour, 7 * 24 * time.Hour, 24 * time.Hour}
+
+// ExpiryNotice describe pair approaching it`s NotAfter
+type ExpiryNotice struct {
+	CN        string        `json:"cn"`
+	Serial    *big.Int      `json:"serial"`
+	CA        bool          `json:"ca"`
+	NotAfter  time.Time     `json:"not_after"`
+	Threshold time.Duration `json:"threshold"` // crossed threshold
+	DaysLeft  int           `json:"days_left"`
+}
+
+// NotifyFunc deliver expiry notice
+type NotifyFunc func(notice *ExpiryNotice) error
+
+// Notifier scan storage and fire notice once per pair and crossed threshold.
+// Sent notices are kept in memory, so restarted notifier fire current thresholds again
+type Notifier struct {
+	pki        *PKI
+	thresholds []time.Duration
+	notify     []NotifyFunc
+	now        func() time.Time
+	mu         sync.Mutex
+	sent       map[string]time.Duration
+}
+
+// NewNotifier create notifier for thresholds before NotAfter, DefaultExpiryThresholds are used if empty
+func NewNotifier(pki *PKI, thresholds []time.Duration, notify ...NotifyFunc) *Notifier {
+	if len(thresholds) == 0 {
+		thresholds = DefaultExpiryThresholds
+	}
+	sorted := append([]time.Duration{}, thresholds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return &Notifier{pki: pki, thresholds: sorted, notify: notify, now: time.Now, sent: make(map[string]time.Duration)}
+}
+
+// Scan fire notices for not revoked and not yet expired pairs which crossed a threshold since last scan.
+// Only the tightest crossed threshold is fired, delivery errors are collected and returned after the scan
+func (n *Notifier) Scan() ([]*ExpiryNotice, error) {
+	revoked := make(map[string]bool)
+	list, err := n.pki.GetCRL()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get crl")
+	}
+	for _, cert := range list.TBSCertList.RevokedCertificates {
+		revoked[cert.SerialNumber.Text(16)] = true
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := n.now()
+	res := make([]*ExpiryNotice, 0)
+	err = ForEach(n.pki.Storage, func(pair *X509Pair) error {
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil || revoked[cert.SerialNumber.Text(16)] {
+			return nil
+		}
+		left := cert.NotAfter.Sub(now)
+		if left <= 0 {
+			return nil
+		}
+		for _, threshold := range n.thresholds {
+			if left > threshold {
+				continue
+			}
+			key := cert.SerialNumber.Text(16)
+			if sent, ok := n.sent[key]; ok && sent <= threshold {
+				break
+			}
+			n.sent[key] = threshold
+			res = append(res, &ExpiryNotice{
+				CN:        pair.CN,
+				Serial:    cert.SerialNumber,
+				CA:        cert.IsCA,
+				NotAfter:  cert.NotAfter,
+				Threshold: threshold,
+				DaysLeft:  int(left / (24 * time.Hour)),
+			})
+			break
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t scan pairs")
+	}
+
+	var failed []string
+	for _, notice := range res {
+		for _, notify := range n.notify {
+			if err := notify(notice); err != nil {
+				failed = append(failed, fmt.Sprintf("%s %s: %v", notice.CN, notice.Serial.Text(16), err))
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return res, errors.Errorf("can`t deliver notices: %s", strings.Join(failed, "; "))
+	}
+	return res, nil
+}
+
+// Run call Scan every interval until ctx is done, scan errors are passed to onError if it`s not nil
+func (n *Notifier) Run(ctx context.Context, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := n.Scan(); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WebhookNotify post notice as json to url, http.DefaultClient is used if client is nil
+func WebhookNotify(url string, client *http.Client) NotifyFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(notice *ExpiryNotice) error {
+		body, err := json.Marshal(notice)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return errors.Wrap(err, "can`t post notice")
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return errors.Errorf("webhook respond with %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// SendMailFunc send mail as smtp.SendMail do
+type SendMailFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+// SMTPNotify mail notice with send, smtp.SendMail is used if send is nil
+func SMTPNotify(send SendMailFunc, addr string, auth smtp.Auth, from string, to ...string) NotifyFunc {
+	if send == nil {
+		send = smtp.SendMail
+	}
+	return func(notice *ExpiryNotice) error {
+		kind := "certificate"
+		if notice.CA {
+			kind = "CA certificate"
+		}
+		subject := fmt.Sprintf("%s %s expires in %d days", kind, notice.CN, notice.DaysLeft)
+		msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s %s with serial %s expires at %s.\r\n",
+			from, strings.Join(to, ", "), subject, kind, notice.CN, notice.Serial.Text(16), notice.NotAfter.Format(time.RFC3339))
+		return errors.Wrap(send(addr, auth, from, to, []byte(msg)), "can`t send mail")
+	}
+}
@@ -0,0 +1,109 @@
+package easyrsa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifier_Scan(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	ca, _ := pki.NewCa()
+	_, _ = pki.NewCert("client", false, []string{""})
+	revoked, _ := pki.NewCert("revoked", false, []string{""})
+	_ = pki.RevokeOne(revoked.Serial)
+	_, caCert, _ := ca.Decode()
+
+	var got []*ExpiryNotice
+	notifier := NewNotifier(pki, nil, func(notice *ExpiryNotice) error {
+		got = append(got, notice)
+		return nil
+	})
+	scan := func(before time.Duration) []*ExpiryNotice {
+		got = nil
+		notifier.now = func() time.Time { return caCert.NotAfter.Add(-before) }
+		res, err := notifier.Scan()
+		assert.NoError(t, err)
+		assert.Equal(t, len(res), len(got))
+		return res
+	}
+
+	assert.Empty(t, scan(60*24*time.Hour))
+	notices := scan(20 * 24 * time.Hour)
+	assert.Len(t, notices, 2)
+	assert.Equal(t, 30*24*time.Hour, notices[0].Threshold)
+	assert.Equal(t, 20, notices[0].DaysLeft)
+	assert.Empty(t, scan(19*24*time.Hour))
+	notices = scan(12 * time.Hour)
+	assert.Len(t, notices, 2)
+	assert.Equal(t, 24*time.Hour, notices[0].Threshold)
+	for _, notice := range notices {
+		assert.NotEqual(t, revoked.Serial, notice.Serial)
+		assert.Equal(t, notice.CN == "ca", notice.CA)
+	}
+	assert.Empty(t, scan(-time.Hour))
+
+	failing := NewNotifier(pki, []time.Duration{time.Hour}, func(notice *ExpiryNotice) error {
+		return errors.New("down")
+	})
+	failing.now = func() time.Time { return caCert.NotAfter.Add(-time.Minute) }
+	notices, err := failing.Scan()
+	assert.Error(t, err)
+	assert.Len(t, notices, 2)
+}
+
+func TestNotifier_Run(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	_, _ = pki.NewCa()
+	scanned := make(chan struct{}, 10)
+	notifier := NewNotifier(pki, []time.Duration{200 * 365 * 24 * time.Hour}, func(notice *ExpiryNotice) error {
+		scanned <- struct{}{}
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-scanned
+		cancel()
+	}()
+	assert.Equal(t, context.Canceled, notifier.Run(ctx, time.Millisecond, nil))
+}
+
+func TestWebhookNotify(t *testing.T) {
+	var got ExpiryNotice
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		if got.CN == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	notify := WebhookNotify(server.URL, nil)
+	notice := &ExpiryNotice{CN: "client", Serial: getTestPair("client", 2).Serial, DaysLeft: 7}
+	assert.NoError(t, notify(notice))
+	assert.Equal(t, "client", got.CN)
+	assert.Equal(t, 7, got.DaysLeft)
+	assert.Error(t, notify(&ExpiryNotice{CN: "fail", Serial: notice.Serial}))
+}
+
+func TestSMTPNotify(t *testing.T) {
+	var msg string
+	var rcpt []string
+	send := func(addr string, a smtp.Auth, from string, to []string, body []byte) error {
+		msg, rcpt = string(body), to
+		return nil
+	}
+	notice := &ExpiryNotice{CN: "ca", CA: true, Serial: getTestPair("ca", 1).Serial, DaysLeft: 1, NotAfter: time.Now()}
+	assert.NoError(t, SMTPNotify(send, "localhost:25", nil, "pki@example.com", "ops@example.com")(notice))
+	assert.Equal(t, []string{"ops@example.com"}, rcpt)
+	assert.True(t, strings.Contains(msg, "Subject: CA certificate ca expires in 1 days\r\n"))
+}
@@ -0,0 +1,105 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSPRequestContentType is a content type of OCSP requests
+const OCSPRequestContentType = "application/ocsp-request"
+
+// OCSPStatus is a verified answer of OCSP responder
+type OCSPStatus struct {
+	Status           int       // ocsp.Good, ocsp.Revoked or ocsp.Unknown
+	Serial           *big.Int  // serial of checked cert
+	ThisUpdate       time.Time // time the status was known to be correct
+	NextUpdate       time.Time // time newer status will be available, zero if always
+	RevokedAt        time.Time // revocation time for revoked cert
+	RevocationReason int       // ocsp revocation reason code for revoked cert
+	Responder        string    // url of queried responder
+}
+
+// Good return true if responder confirmed cert is not revoked
+func (s *OCSPStatus) Good() bool {
+	return s.Status == ocsp.Good
+}
+
+// OCSPClient query OCSP responder for cert status
+type OCSPClient struct {
+	HTTPClient *http.Client // http.DefaultClient if nil
+	URL        string       // responder url, first OCSP server from cert AIA is used if empty
+}
+
+// Check query responder for status of cert issued by issuer.
+// Response signature and freshness are verified, stale or unsigned answers are errors
+func (c *OCSPClient) Check(cert, issuer *x509.Certificate) (*OCSPStatus, error) {
+	url := c.URL
+	if url == "" {
+		if len(cert.OCSPServer) == 0 {
+			return nil, errors.New("no ocsp responder configured or found in cert")
+		}
+		url = cert.OCSPServer[0]
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t create ocsp request")
+	}
+	resp, err := client.Post(url, OCSPRequestContentType, bytes.NewReader(req))
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t query ocsp responder")
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("ocsp responder respond with %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t read ocsp response")
+	}
+	parsed, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t parse ocsp response")
+	}
+	if !parsed.NextUpdate.IsZero() && time.Now().After(parsed.NextUpdate) {
+		return nil, errors.New("ocsp response is stale")
+	}
+	return &OCSPStatus{
+		Status:           parsed.Status,
+		Serial:           parsed.SerialNumber,
+		ThisUpdate:       parsed.ThisUpdate,
+		NextUpdate:       parsed.NextUpdate,
+		RevokedAt:        parsed.RevokedAt,
+		RevocationReason: parsed.RevocationReason,
+		Responder:        url,
+	}, nil
+}
+
+// CheckOCSP query responder for status of pem cert, issuer is resolved among stored CAs
+func (p *PKI) CheckOCSP(certPem []byte, client *OCSPClient) (*OCSPStatus, error) {
+	cert, err := decodeCert(certPem)
+	if err != nil {
+		return nil, err
+	}
+	cas, _, err := p.caCerts()
+	if err != nil {
+		return nil, err
+	}
+	issuer := findIssuer(cert, cas)
+	if issuer == nil {
+		return nil, errors.New("certificate is not signed by stored ca")
+	}
+	return client.Check(cert, issuer)
+}
@@ -0,0 +1,61 @@
+package easyrsa
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestPKI_CheckOCSP(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	ca, _ := pki.NewCa()
+	leaf, _ := pki.NewCert("client", false, []string{""})
+	caKey, caCert, _ := ca.Decode()
+
+	status := ocsp.Good
+	nextUpdate := time.Now().Add(time.Hour)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, OCSPRequestContentType, r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		assert.NoError(t, err)
+		resp, err := ocsp.CreateResponse(caCert, caCert, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   nextUpdate,
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, caKey)
+		assert.NoError(t, err)
+		_, _ = w.Write(resp)
+	}))
+	defer server.Close()
+	client := &OCSPClient{URL: server.URL}
+
+	res, err := pki.CheckOCSP(leaf.CertPemBytes, client)
+	assert.NoError(t, err)
+	assert.True(t, res.Good())
+	assert.Equal(t, leaf.Serial, res.Serial)
+	assert.Equal(t, server.URL, res.Responder)
+
+	status = ocsp.Revoked
+	res, err = pki.CheckOCSP(leaf.CertPemBytes, client)
+	assert.NoError(t, err)
+	assert.False(t, res.Good())
+	assert.Equal(t, ocsp.Revoked, res.Status)
+
+	nextUpdate = time.Now().Add(-time.Second)
+	_, err = pki.CheckOCSP(leaf.CertPemBytes, client)
+	assert.Error(t, err)
+
+	_, err = pki.CheckOCSP(leaf.CertPemBytes, &OCSPClient{})
+	assert.Error(t, err)
+	_, err = pki.CheckOCSP(getTestPair("foreign", 5).CertPemBytes, client)
+	assert.Error(t, err)
+}
@@ -0,0 +1,242 @@
+package easyrsa
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspHashNames are blob key prefixes of pre-signed responses by CertID hash algorithm
+var ocspHashNames = map[crypto.Hash]string{
+	crypto.SHA1:   "sha1",
+	crypto.SHA256: "sha256",
+	crypto.SHA384: "sha384",
+	crypto.SHA512: "sha512",
+}
+
+// PresignedOCSP is an OCSP response signed ahead of time by PreSign
+type PresignedOCSP struct {
+	Key        string    // blob key as hash/issuer key hash/serial, all hex
+	Serial     *big.Int  // cert serial
+	Status     int       // ocsp.Good or ocsp.Revoked
+	NextUpdate time.Time // response is valid until
+	DER        []byte    // DER response
+}
+
+// ocspResponseKey return blob key of response for CertID parts
+func ocspResponseKey(hash crypto.Hash, issuerKeyHash []byte, serial *big.Int) string {
+	return ocspHashNames[hash] + "/" + hex.EncodeToString(issuerKeyHash) + "/" + serial.Text(16)
+}
+
+// PreSign sign responses without nonce for every not expired cert of stored CAs, for each of hashes,
+// crypto.SHA1 if empty as RFC 5019 require. Backdate and Validity of responder apply, batch fail if CRL is unavailable
+func (r *OCSPResponder) PreSign(hashes ...crypto.Hash) ([]*PresignedOCSP, error) {
+	if len(hashes) == 0 {
+		hashes = []crypto.Hash{crypto.SHA1}
+	}
+	for _, hash := range hashes {
+		if _, ok := ocspHashNames[hash]; !ok || !hash.Available() {
+			return nil, errors.Errorf("unsupported ocsp hash %s", hash)
+		}
+	}
+	// batch of good statuses must not be signed from fallback of CRLFailurePolicy
+	list, err := r.pki.GetCRL()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get crl")
+	}
+	cas := make([]*x509.Certificate, 0)
+	caPairs := make(map[*x509.Certificate]*X509Pair)
+	err = ForEachByCN(r.pki.Storage, "ca", func(pair *X509Pair) error {
+		if cert, err := decodeCert(pair.CertPemBytes); err == nil {
+			cas = append(cas, cert)
+			caPairs[cert] = pair
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get ca certs")
+	}
+	keys := make(map[*x509.Certificate]*rsa.PrivateKey)
+	defer func() {
+		for _, key := range keys {
+			ZeroKey(key)
+		}
+	}()
+
+	backdate, validity := r.Backdate, r.Validity
+	if backdate == 0 {
+		backdate = NotBeforeBackdate
+	}
+	if validity == 0 {
+		validity = DefaultOCSPValidity
+	}
+	now := r.pki.now()
+	thisUpdate := now.Add(-backdate).UTC().Truncate(time.Second)
+	nextUpdate := now.Add(validity).UTC().Truncate(time.Second)
+	res := make([]*PresignedOCSP, 0)
+	err = ForEach(r.pki.Storage, func(pair *X509Pair) error {
+		if pair.CN == "ca" || pair.CN == TrustAnchorCN {
+			return nil
+		}
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil || now.After(cert.NotAfter) {
+			return nil
+		}
+		issuer := findIssuer(cert, cas)
+		if issuer == nil {
+			return nil
+		}
+		key, ok := keys[issuer]
+		if !ok {
+			if key, _, err = r.pki.decodeCA(caPairs[issuer]); err != nil || key == nil {
+				return errors.Errorf("key of issuer %s is not available", issuer.Subject)
+			}
+			keys[issuer] = key
+		}
+		template := ocspCertStatus(cert, list)
+		template.ThisUpdate, template.NextUpdate = thisUpdate, nextUpdate
+		for _, hash := range hashes {
+			template.IssuerHash = hash
+			der, err := ocsp.CreateResponse(issuer, issuer, template, key)
+			if err != nil {
+				return errors.Wrapf(err, "can`t create ocsp response for %s", cert.SerialNumber.Text(16))
+			}
+			keyHash, err := ocspIssuerKeyHash(issuer, hash)
+			if err != nil {
+				return err
+			}
+			res = append(res, &PresignedOCSP{
+				Key:        ocspResponseKey(hash, keyHash, cert.SerialNumber),
+				Serial:     cert.SerialNumber,
+				Status:     template.Status,
+				NextUpdate: nextUpdate,
+				DER:        der,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// PublishPreSigned pre-sign responses and put them to store, e.g. object storage bucket behind CDN served by
+// StaticOCSPResponder. Responses put before which are not signed again, e.g. of expired certs, are deleted.
+// Count of put responses is returned
+func (r *OCSPResponder) PublishPreSigned(store BlobStore, hashes ...crypto.Hash) (int, error) {
+	responses, err := r.PreSign(hashes...)
+	if err != nil {
+		return 0, err
+	}
+	current := make(map[string]bool, len(responses))
+	for _, resp := range responses {
+		if err := store.Put(resp.Key, resp.DER); err != nil {
+			return 0, errors.Wrapf(err, "can`t put ocsp response %s", resp.Key)
+		}
+		current[resp.Key] = true
+	}
+	stale := make([]string, 0)
+	for _, name := range ocspHashNames {
+		err := store.List(name+"/", func(key string) error {
+			if !current[key] {
+				stale = append(stale, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return len(responses), errors.Wrap(err, "can`t list ocsp responses")
+		}
+	}
+	for _, key := range stale {
+		if err := store.Delete(key); err != nil {
+			if _, ok := errors.Cause(err).(*NotExist); !ok {
+				return len(responses), errors.Wrapf(err, "can`t delete stale ocsp response %s", key)
+			}
+		}
+	}
+	return len(responses), nil
+}
+
+// RunPreSign call PublishPreSigned every interval until ctx is done, errors are passed to onError if it`s not nil.
+// Interval should be well below responder Validity, so published responses never expire
+func (r *OCSPResponder) RunPreSign(ctx context.Context, store BlobStore, interval time.Duration, onError func(error), hashes ...crypto.Hash) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.PublishPreSigned(store, hashes...); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// StaticOCSPResponder serve OCSP requests with responses pre-signed by OCSPResponder.PublishPreSigned,
+// without access to PKI or CA keys. Request nonce is ignored as RFC 5019 allow, unknown and expired
+// responses are answered with unauthorized and try later errors
+type StaticOCSPResponder struct {
+	store BlobStore
+	now   func() time.Time
+}
+
+// NewStaticOCSPResponder create responder serving responses from store
+func NewStaticOCSPResponder(store BlobStore) *StaticOCSPResponder {
+	return &StaticOCSPResponder{store: store, now: time.Now}
+}
+
+// ServeHTTP implement http.Handler for OCSP requests as OCSPResponder do
+func (r *StaticOCSPResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	der, ok := readOCSPRequest(w, req)
+	if !ok {
+		return
+	}
+	resp, parsed, _ := r.respond(der)
+	w.Header().Set("Content-Type", OCSPResponseContentType)
+	if parsed != nil && req.Method == http.MethodGet {
+		setOCSPCacheHeaders(w, parsed.ThisUpdate, parsed.NextUpdate, r.now())
+	}
+	_, _ = w.Write(resp)
+}
+
+// Respond return DER response to DER request, failures are reported as OCSP error responses
+func (r *StaticOCSPResponder) Respond(der []byte) []byte {
+	resp, _, _ := r.respond(der)
+	return resp
+}
+
+func (r *StaticOCSPResponder) respond(der []byte) ([]byte, *ocsp.Response, error) {
+	req, err := ocsp.ParseRequest(der)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse, nil, errors.Wrap(err, "can`t parse ocsp request")
+	}
+	if _, ok := ocspHashNames[req.HashAlgorithm]; !ok {
+		return ocsp.UnauthorizedErrorResponse, nil, errors.New("unsupported ocsp hash")
+	}
+	resp, err := r.store.Get(ocspResponseKey(req.HashAlgorithm, req.IssuerKeyHash, req.SerialNumber))
+	if _, ok := errors.Cause(err).(*NotExist); ok {
+		return ocsp.UnauthorizedErrorResponse, nil, err
+	}
+	if err != nil {
+		return ocsp.TryLaterErrorResponse, nil, errors.Wrap(err, "can`t get ocsp response")
+	}
+	parsed, err := ocsp.ParseResponse(resp, nil)
+	if err != nil {
+		return ocsp.InternalErrorErrorResponse, nil, errors.Wrap(err, "can`t parse stored ocsp response")
+	}
+	if !parsed.NextUpdate.IsZero() && r.now().After(parsed.NextUpdate) {
+		return ocsp.TryLaterErrorResponse, nil, errors.New("stored ocsp response is expired")
+	}
+	return resp, parsed, nil
+}
@@ -0,0 +1,106 @@
+package easyrsa
+
+import (
+	"crypto"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestOCSPResponder_PublishPreSigned(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+	_, caCert, err := ca.Decode()
+	assert.NoError(t, err)
+	alice, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	_, aliceCert, err := alice.Decode()
+	assert.NoError(t, err)
+	bob, err := pki.NewCert("bob", false, nil)
+	assert.NoError(t, err)
+	_, bobCert, err := bob.Decode()
+	assert.NoError(t, err)
+	assert.NoError(t, pki.Revoke(bob.Serial, "admin", "test"))
+
+	store := NewDirBlobStore(filepath.Join(t.TempDir(), "ocsp"))
+	responder := NewOCSPResponder(pki)
+	_, err = responder.PreSign(crypto.MD5)
+	assert.Error(t, err)
+	n, err := responder.PublishPreSigned(store, crypto.SHA1, crypto.SHA256)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	static := NewStaticOCSPResponder(store)
+	for _, hash := range []crypto.Hash{crypto.SHA1, crypto.SHA256} {
+		req, err := ocsp.CreateRequest(aliceCert, caCert, &ocsp.RequestOptions{Hash: hash})
+		assert.NoError(t, err)
+		resp, err := ocsp.ParseResponseForCert(static.Respond(req), aliceCert, caCert)
+		assert.NoError(t, err)
+		assert.Equal(t, ocsp.Good, resp.Status)
+	}
+	req, err := ocsp.CreateRequest(bobCert, caCert, nil)
+	assert.NoError(t, err)
+	rec := httptest.NewRecorder()
+	static.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+base64.StdEncoding.EncodeToString(req), nil))
+	assert.Equal(t, OCSPResponseContentType, rec.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Cache-Control"), "max-age="))
+	resp, err := ocsp.ParseResponseForCert(rec.Body.Bytes(), bobCert, caCert)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Revoked, resp.Status)
+
+	// unknown serial, expired responses and responses of expired certs
+	carol, err := pki.NewCert("carol", false, nil)
+	assert.NoError(t, err)
+	_, carolCert, err := carol.Decode()
+	assert.NoError(t, err)
+	req, err = ocsp.CreateRequest(carolCert, caCert, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.UnauthorizedErrorResponse, static.Respond(req))
+	static.now = func() time.Time { return time.Now().Add(2 * DefaultOCSPValidity) }
+	req, err = ocsp.CreateRequest(aliceCert, caCert, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.TryLaterErrorResponse, static.Respond(req))
+
+	pki.clock = func() time.Time { return aliceCert.NotAfter.Add(time.Hour) }
+	n, err = responder.PublishPreSigned(store, crypto.SHA1, crypto.SHA256)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	keys := make([]string, 0)
+	assert.NoError(t, store.List("", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	assert.Empty(t, keys)
+}
+
+func TestOCSPResponder_PreSign_CRLUnavailable(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithCRLFailurePolicy(&CRLFailurePolicy{Mode: CRLFailOpen}))
+	defer cleanup()
+	holder := &flakyCRLHolder{CRLHolder: pki.crlHolder}
+	pki.crlHolder = holder
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	bob, err := pki.NewCert("bob", false, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pki.Revoke(bob.Serial, "admin", "test"))
+
+	holder.down = true
+	store := NewDirBlobStore(filepath.Join(t.TempDir(), "ocsp"))
+	_, err = NewOCSPResponder(pki).PublishPreSigned(store)
+	assert.Error(t, err)
+	published := 0
+	_ = store.List("", func(key string) error {
+		published++
+		return nil
+	})
+	assert.Zero(t, published)
+}
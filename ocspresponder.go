@@ -0,0 +1,382 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSPResponseContentType is a content type of OCSP responses
+const OCSPResponseContentType = "application/ocsp-response"
+
+// DefaultOCSPValidity is a nextUpdate - thisUpdate window of OCSPResponder responses if Validity is not set
+const DefaultOCSPValidity = 24 * time.Hour
+
+// defaultOCSPMaxCached is a limit of cached responses if OCSPResponder.MaxCached is not set
+const defaultOCSPMaxCached = 10000
+
+var oidOCSPNonce = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+
+// OCSPResponder serve RFC 6960 OCSP requests sent by POST or GET for certs of stored CAs, responses are signed
+// by the issuing CA. Nonce of request is echoed in the response. Responses to requests without nonce are
+// signed once per serial and reused until Refresh passed or CRL changed, so high volume verifiers don`t
+// trigger a signature per request. Mount it at the OCSP url of issued certs (Profile.OCSPServer) with mount
+// prefix stripped, GET requests carry base64 request as the whole remaining path
+type OCSPResponder struct {
+	Backdate  time.Duration // thisUpdate is set back to tolerate verifier clock skew, NotBeforeBackdate if zero
+	Validity  time.Duration // nextUpdate - thisUpdate, DefaultOCSPValidity if zero
+	Refresh   time.Duration // cached responses are signed again after Refresh, half of Validity if zero
+	MaxCached int           // limit of cached responses, 10000 if zero
+
+	pki   *PKI
+	mu    sync.Mutex
+	cache map[string]*ocspCached
+}
+
+// ocspCached is a pre-signed response
+type ocspCached struct {
+	der        []byte
+	thisUpdate time.Time
+	nextUpdate time.Time
+	refresh    time.Time // response is signed again after refresh
+	crl        string    // signature of CRL the status was taken from
+}
+
+// NewOCSPResponder create responder for certs issued by pki
+func NewOCSPResponder(pki *PKI) *OCSPResponder {
+	return &OCSPResponder{pki: pki, cache: make(map[string]*ocspCached)}
+}
+
+// ServeHTTP implement http.Handler for OCSP requests
+func (r *OCSPResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	der, ok := readOCSPRequest(w, req)
+	if !ok {
+		return
+	}
+	resp, cached, err := r.respond(der)
+	w.Header().Set("Content-Type", OCSPResponseContentType)
+	if err == nil && cached != nil && req.Method == http.MethodGet {
+		setOCSPCacheHeaders(w, cached.thisUpdate, cached.nextUpdate, r.pki.now())
+	}
+	_, _ = w.Write(resp)
+}
+
+// readOCSPRequest return DER request sent by GET or POST, nil if it can`t be read.
+// Not allowed methods are answered and false is returned
+func readOCSPRequest(w http.ResponseWriter, req *http.Request) ([]byte, bool) {
+	var der []byte
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+		var path string
+		if path, err = url.PathUnescape(strings.TrimPrefix(req.URL.EscapedPath(), "/")); err == nil {
+			der, err = base64.StdEncoding.DecodeString(path)
+		}
+	case http.MethodPost:
+		der, err = ioutil.ReadAll(http.MaxBytesReader(w, req.Body, 64*1024))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	if err != nil {
+		return nil, true
+	}
+	return der, true
+}
+
+// setOCSPCacheHeaders set RFC 5019 caching headers of response valid until nextUpdate
+func setOCSPCacheHeaders(w http.ResponseWriter, thisUpdate, nextUpdate, now time.Time) {
+	maxAge := int(nextUpdate.Sub(now) / time.Second)
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public, no-transform, must-revalidate", maxAge))
+	w.Header().Set("Last-Modified", thisUpdate.UTC().Format(http.TimeFormat))
+	w.Header().Set("Expires", nextUpdate.UTC().Format(http.TimeFormat))
+}
+
+// Respond return DER response to DER request. Failures are reported as OCSP error responses, so the
+// result is always a valid response
+func (r *OCSPResponder) Respond(der []byte) []byte {
+	resp, _, _ := r.respond(der)
+	return resp
+}
+
+// Purge drop all cached responses
+func (r *OCSPResponder) Purge() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = make(map[string]*ocspCached)
+}
+
+// respond return response, cache entry if response is cacheable, and error for error responses
+func (r *OCSPResponder) respond(der []byte) ([]byte, *ocspCached, error) {
+	req, err := ocsp.ParseRequest(der)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse, nil, errors.Wrap(err, "can`t parse ocsp request")
+	}
+	nonce, err := ocspRequestNonce(der)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse, nil, err
+	}
+	issuer, err := r.issuer(req)
+	if err != nil {
+		return ocsp.InternalErrorErrorResponse, nil, err
+	}
+	if issuer == nil {
+		return ocsp.UnauthorizedErrorResponse, nil, errors.New("request issuer is not stored ca")
+	}
+	// signed good status must not come from fallback of CRLFailurePolicy
+	list, err := r.pki.GetCRL()
+	if err != nil {
+		return ocsp.TryLaterErrorResponse, nil, errors.Wrap(err, "can`t get crl")
+	}
+	crl := string(list.SignatureValue.Bytes)
+
+	key := fmt.Sprintf("%d:%x:%s", req.HashAlgorithm, req.IssuerKeyHash, req.SerialNumber.Text(16))
+	now := r.pki.now()
+	if nonce == nil {
+		r.mu.Lock()
+		cached, ok := r.cache[key]
+		r.mu.Unlock()
+		if ok && cached.crl == crl && now.Before(cached.refresh) {
+			return cached.der, cached, nil
+		}
+	}
+
+	template := r.status(req.SerialNumber, issuer.cert, list)
+	template.IssuerHash = req.HashAlgorithm
+	backdate, validity := r.Backdate, r.Validity
+	if backdate == 0 {
+		backdate = NotBeforeBackdate
+	}
+	if validity == 0 {
+		validity = DefaultOCSPValidity
+	}
+	template.ThisUpdate = now.Add(-backdate).UTC().Truncate(time.Second)
+	template.NextUpdate = now.Add(validity).UTC().Truncate(time.Second)
+
+	caKey, _, err := r.pki.decodeCA(issuer.pair)
+	if err != nil || caKey == nil {
+		return ocsp.TryLaterErrorResponse, nil, errors.New("issuer key is not available")
+	}
+	defer ZeroKey(caKey)
+	resp, err := ocsp.CreateResponse(issuer.cert, issuer.cert, template, caKey)
+	if err != nil {
+		return ocsp.InternalErrorErrorResponse, nil, errors.Wrap(err, "can`t create ocsp response")
+	}
+	if nonce != nil {
+		if resp, err = r.addNonce(resp, *nonce, caKey); err != nil {
+			return ocsp.InternalErrorErrorResponse, nil, err
+		}
+		return resp, nil, nil
+	}
+	refresh := r.Refresh
+	if refresh == 0 {
+		refresh = validity / 2
+	}
+	cached := &ocspCached{der: resp, thisUpdate: template.ThisUpdate, nextUpdate: template.NextUpdate,
+		refresh: now.Add(refresh), crl: crl}
+	r.store(key, cached, now)
+	return resp, cached, nil
+}
+
+func (r *OCSPResponder) store(key string, cached *ocspCached, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limit := r.MaxCached
+	if limit <= 0 {
+		limit = defaultOCSPMaxCached
+	}
+	if len(r.cache) >= limit {
+		for k, v := range r.cache {
+			if !now.Before(v.refresh) {
+				delete(r.cache, k)
+			}
+		}
+	}
+	if len(r.cache) >= limit {
+		r.cache = make(map[string]*ocspCached)
+	}
+	r.cache[key] = cached
+}
+
+// ocspIssuer is a stored CA matching request issuer hashes
+type ocspIssuer struct {
+	pair *X509Pair
+	cert *x509.Certificate
+}
+
+func (r *OCSPResponder) issuer(req *ocsp.Request) (*ocspIssuer, error) {
+	if !req.HashAlgorithm.Available() {
+		return nil, nil
+	}
+	var res *ocspIssuer
+	err := ForEachByCN(r.pki.Storage, "ca", func(pair *X509Pair) error {
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil {
+			return nil
+		}
+		keyHash, err := ocspIssuerKeyHash(cert, req.HashAlgorithm)
+		if err != nil {
+			return nil
+		}
+		nameHash := req.HashAlgorithm.New()
+		nameHash.Write(cert.RawSubject)
+		if bytes.Equal(keyHash, req.IssuerKeyHash) && bytes.Equal(nameHash.Sum(nil), req.IssuerNameHash) {
+			res = &ocspIssuer{pair: pair, cert: cert}
+			return StopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get ca certs")
+	}
+	return res, nil
+}
+
+// ocspIssuerKeyHash return hash of issuer public key bits as in OCSP CertID
+func ocspIssuerKeyHash(issuer *x509.Certificate, hash crypto.Hash) ([]byte, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, errors.Wrap(err, "can`t parse issuer public key")
+	}
+	h := hash.New()
+	h.Write(spki.PublicKey.RightAlign())
+	return h.Sum(nil), nil
+}
+
+// status return response template for serial, unknown if serial isn`t stored cert of issuer
+func (r *OCSPResponder) status(serial *big.Int, issuer *x509.Certificate, list *pkix.CertificateList) ocsp.Response {
+	res := ocsp.Response{Status: ocsp.Unknown, SerialNumber: serial}
+	pair, err := r.pki.Storage.GetBySerial(serial)
+	if err != nil || pair == nil {
+		return res
+	}
+	cert, err := decodeCert(pair.CertPemBytes)
+	if err != nil || cert.CheckSignatureFrom(issuer) != nil {
+		return res
+	}
+	return ocspCertStatus(cert, list)
+}
+
+// ocspCertStatus return good or revoked response template for cert of issuer
+func ocspCertStatus(cert *x509.Certificate, list *pkix.CertificateList) ocsp.Response {
+	serial := cert.SerialNumber
+	res := ocsp.Response{Status: ocsp.Good, SerialNumber: serial}
+	for _, revoked := range list.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(serial) == 0 {
+			res.Status = ocsp.Revoked
+			res.RevokedAt = revoked.RevocationTime
+			res.RevocationReason = crlReason(revoked)
+			break
+		}
+	}
+	return res
+}
+
+// ocspRequestNonce return nonce extension of DER request, nil if absent
+func ocspRequestNonce(der []byte) (*pkix.Extension, error) {
+	var req struct {
+		TBSRequest struct {
+			Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+			RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+			RequestList   asn1.RawValue
+			Extensions    []pkix.Extension `asn1:"explicit,tag:2,optional"`
+		}
+	}
+	if _, err := asn1.Unmarshal(der, &req); err != nil {
+		return nil, errors.Wrap(err, "can`t parse ocsp request extensions")
+	}
+	for _, ext := range req.TBSRequest.Extensions {
+		if !ext.Id.Equal(oidOCSPNonce) {
+			continue
+		}
+		if len(ext.Value) == 0 || len(ext.Value) > 128 {
+			return nil, errors.New("wrong ocsp nonce length")
+		}
+		return &pkix.Extension{Id: oidOCSPNonce, Value: ext.Value}, nil
+	}
+	return nil, nil
+}
+
+// ocspSignatureHashes map response signature algorithms chosen by ocsp.CreateResponse to their hash
+var ocspSignatureHashes = map[string]crypto.Hash{
+	"1.2.840.113549.1.1.11": crypto.SHA256,
+	"1.2.840.10045.4.3.2":   crypto.SHA256,
+	"1.2.840.10045.4.3.3":   crypto.SHA384,
+	"1.2.840.10045.4.3.4":   crypto.SHA512,
+}
+
+// addNonce add nonce to responseExtensions of signed response and sign it again, ocsp.CreateResponse
+// can put extensions to singleExtensions only
+func (r *OCSPResponder) addNonce(der []byte, nonce pkix.Extension, key crypto.Signer) ([]byte, error) {
+	var resp struct {
+		Status   asn1.Enumerated
+		Response struct {
+			ResponseType asn1.ObjectIdentifier
+			Response     []byte
+		} `asn1:"explicit,tag:0,optional"`
+	}
+	if _, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, errors.Wrap(err, "can`t parse ocsp response")
+	}
+	var basic struct {
+		TBSResponseData    asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          asn1.BitString
+		Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+	}
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return nil, errors.Wrap(err, "can`t parse basic ocsp response")
+	}
+	var tbs struct {
+		Version     int `asn1:"optional,default:0,explicit,tag:0"`
+		ResponderID asn1.RawValue
+		ProducedAt  asn1.RawValue
+		Responses   asn1.RawValue
+		Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+	}
+	if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &tbs); err != nil {
+		return nil, errors.Wrap(err, "can`t parse ocsp response data")
+	}
+	tbs.Extensions = append(tbs.Extensions, nonce)
+	tbsDer, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal ocsp response data")
+	}
+	hash, ok := ocspSignatureHashes[basic.SignatureAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, errors.Errorf("unsupported ocsp signature algorithm %s", basic.SignatureAlgorithm.Algorithm)
+	}
+	h := hash.New()
+	h.Write(tbsDer)
+	sig, err := key.Sign(r.pki.rand(), h.Sum(nil), hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t sign ocsp response")
+	}
+	basic.TBSResponseData = asn1.RawValue{FullBytes: tbsDer}
+	basic.Signature = asn1.BitString{Bytes: sig, BitLength: len(sig) * 8}
+	if resp.Response.Response, err = asn1.Marshal(basic); err != nil {
+		return nil, errors.Wrap(err, "can`t marshal basic ocsp response")
+	}
+	res, err := asn1.Marshal(resp)
+	return res, errors.Wrap(err, "can`t marshal ocsp response")
+}
@@ -0,0 +1,166 @@
+package easyrsa
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+// withOCSPNonce add nonce extension to DER request created by ocsp.CreateRequest
+func withOCSPNonce(t *testing.T, der, nonce []byte) []byte {
+	var req struct {
+		TBSRequest struct {
+			RequestList asn1.RawValue
+		}
+	}
+	_, err := asn1.Unmarshal(der, &req)
+	assert.NoError(t, err)
+	value, err := asn1.Marshal(nonce)
+	assert.NoError(t, err)
+	res, err := asn1.Marshal(struct {
+		TBSRequest struct {
+			RequestList asn1.RawValue
+			Extensions  []pkix.Extension `asn1:"explicit,tag:2"`
+		}
+	}{struct {
+		RequestList asn1.RawValue
+		Extensions  []pkix.Extension `asn1:"explicit,tag:2"`
+	}{req.TBSRequest.RequestList, []pkix.Extension{{Id: oidOCSPNonce, Value: value}}}})
+	assert.NoError(t, err)
+	return res
+}
+
+// ocspResponseNonce return nonce extension value of responseExtensions
+func ocspResponseNonce(t *testing.T, der []byte) []byte {
+	var resp struct {
+		Status   asn1.Enumerated
+		Response struct {
+			ResponseType asn1.ObjectIdentifier
+			Response     []byte
+		} `asn1:"explicit,tag:0,optional"`
+	}
+	_, err := asn1.Unmarshal(der, &resp)
+	assert.NoError(t, err)
+	var basic struct {
+		TBSResponseData struct {
+			Version     int `asn1:"optional,default:0,explicit,tag:0"`
+			ResponderID asn1.RawValue
+			ProducedAt  asn1.RawValue
+			Responses   asn1.RawValue
+			Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+		}
+	}
+	_, err = asn1.Unmarshal(resp.Response.Response, &basic)
+	assert.NoError(t, err)
+	for _, ext := range basic.TBSResponseData.Extensions {
+		if ext.Id.Equal(oidOCSPNonce) {
+			return ext.Value
+		}
+	}
+	return nil
+}
+
+func TestOCSPResponder(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	caPair, err := pki.NewCa()
+	assert.NoError(t, err)
+	ca, err := decodeCert(caPair.CertPemBytes)
+	assert.NoError(t, err)
+	leafPair, err := pki.NewCert("client", false, nil)
+	assert.NoError(t, err)
+	leaf, err := decodeCert(leafPair.CertPemBytes)
+	assert.NoError(t, err)
+
+	responder := NewOCSPResponder(pki)
+	responder.Validity = time.Hour
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	// revocation is visible through the client helper
+	status, err := pki.CheckOCSP(leafPair.CertPemBytes, &OCSPClient{URL: server.URL})
+	assert.NoError(t, err)
+	assert.True(t, status.Good())
+	assert.InDelta(t, float64(time.Hour+NotBeforeBackdate), float64(status.NextUpdate.Sub(status.ThisUpdate)), float64(2*time.Second))
+
+	req, err := ocsp.CreateRequest(leaf, ca, &ocsp.RequestOptions{Hash: crypto.SHA1})
+	assert.NoError(t, err)
+	first := responder.Respond(req)
+	assert.Equal(t, first, responder.Respond(req), "response is served from cache")
+	resp, err := http.Get(server.URL + "/" + url.PathEscape(base64.StdEncoding.EncodeToString(req)))
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, first, body)
+	assert.Equal(t, OCSPResponseContentType, resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("Cache-Control"), "max-age=")
+
+	// nonce is echoed and response is signed for the request
+	nonce := []byte("0123456789abcdef")
+	nonceReq := withOCSPNonce(t, req, nonce)
+	withNonce := responder.Respond(nonceReq)
+	parsed, err := ocsp.ParseResponseForCert(withNonce, leaf, ca)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Good, parsed.Status)
+	value, _ := asn1.Marshal(nonce)
+	assert.Equal(t, value, ocspResponseNonce(t, withNonce))
+
+	assert.NoError(t, pki.RevokeOne(leafPair.Serial))
+	parsed, err = ocsp.ParseResponseForCert(responder.Respond(req), leaf, ca)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Revoked, parsed.Status)
+	parsed, err = ocsp.ParseResponseForCert(responder.Respond(nonceReq), leaf, ca)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Revoked, parsed.Status)
+
+	other, err := pki.NewCert("other", false, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pki.Storage.DeleteBySerial(other.Serial))
+	otherCert, _ := decodeCert(other.CertPemBytes)
+	otherReq, err := ocsp.CreateRequest(otherCert, ca, nil)
+	assert.NoError(t, err)
+	parsed, err = ocsp.ParseResponseForCert(responder.Respond(otherReq), otherCert, ca)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Unknown, parsed.Status)
+
+	assert.Equal(t, ocsp.MalformedRequestErrorResponse, responder.Respond([]byte("garbage")))
+	foreign := getTestPair("foreign", 5)
+	foreignCert, _ := decodeCert(foreign.CertPemBytes)
+	foreignReq, err := ocsp.CreateRequest(foreignCert, foreignCert, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.UnauthorizedErrorResponse, responder.Respond(foreignReq))
+}
+
+func TestOCSPResponder_CRLUnavailable(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithCRLFailurePolicy(&CRLFailurePolicy{Mode: CRLFailOpen}))
+	defer cleanup()
+	holder := &flakyCRLHolder{CRLHolder: pki.crlHolder}
+	pki.crlHolder = holder
+	caPair, err := pki.NewCa()
+	assert.NoError(t, err)
+	ca, _ := decodeCert(caPair.CertPemBytes)
+	leafPair, err := pki.NewCert("client", false, nil)
+	assert.NoError(t, err)
+	leaf, _ := decodeCert(leafPair.CertPemBytes)
+	assert.NoError(t, pki.RevokeOne(leafPair.Serial))
+
+	responder := NewOCSPResponder(pki)
+	req, err := ocsp.CreateRequest(leaf, ca, nil)
+	assert.NoError(t, err)
+	holder.down = true
+	assert.Equal(t, ocsp.TryLaterErrorResponse, responder.Respond(req))
+	holder.down = false
+	parsed, err := ocsp.ParseResponseForCert(responder.Respond(req), leaf, ca)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Revoked, parsed.Status)
+}
@@ -0,0 +1,72 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// TrustAnchorCN is a storage cn of cert only offline root CAs
+const TrustAnchorCN = "root"
+
+// NewIntermediateCSR generate key and CSR for an intermediate CA to be signed by an offline root.
+// Nothing is stored, key must be kept secret until ImportIntermediate
+func (p *PKI) NewIntermediateCSR() (csrPem []byte, keyPem []byte, err error) {
+	key, err := p.generateKey()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can`t generate key")
+	}
+	defer ZeroKey(key)
+
+	subj := p.subject("ca", CertRequest{CA: true})
+	csr, err := x509.CreateCertificateRequest(p.rand(), &x509.CertificateRequest{Subject: subj}, key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can`t create csr")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMCertificateRequestBlock, Bytes: csr}), encodeKey(key), nil
+}
+
+// ImportIntermediate put intermediate CA signed by offline root to storage, so NewCert and RevokeOne sign with it.
+// Root cert is stored without key under TrustAnchorCN and only used to build chains.
+// Serials given by the offline root must not collide with local serial provider ones
+func (p *PKI) ImportIntermediate(certPem, keyPem, rootPem []byte) (*X509Pair, error) {
+	root, err := decodeCert(rootPem)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t parse root cert")
+	}
+	if !root.IsCA || !isSelfSigned(root) {
+		return nil, errors.New("root cert is not a self signed ca")
+	}
+	cert, err := decodeCert(certPem)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t parse intermediate cert")
+	}
+	if !cert.IsCA || cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, errors.New("intermediate cert is not a ca")
+	}
+	if err := cert.CheckSignatureFrom(root); err != nil {
+		return nil, errors.Wrap(err, "intermediate cert is not signed by root")
+	}
+
+	pair := NewX509Pair(keyPem, certPem, "ca", cert.SerialNumber)
+	if err := pair.Validate(); err != nil {
+		return nil, errors.Wrap(err, "can`t import intermediate")
+	}
+	if _, err := p.Storage.GetBySerial(cert.SerialNumber); err == nil {
+		return nil, errors.Errorf("serial %s already exist", cert.SerialNumber.Text(16))
+	}
+	if stored, err := p.Storage.GetBySerial(root.SerialNumber); err != nil {
+		if err := p.Storage.Put(NewX509Pair(nil, rootPem, TrustAnchorCN, root.SerialNumber)); err != nil {
+			return nil, errors.Wrap(err, "can`t put root cert")
+		}
+	} else if stored.CN != TrustAnchorCN {
+		return nil, errors.Errorf("serial %s already exist", root.SerialNumber.Text(16))
+	}
+	if err := p.Storage.Put(pair); err != nil {
+		return nil, errors.Wrap(err, "can`t put intermediate")
+	}
+	p.pairStored(pair.CN)
+	pair.ChainPemBytes = rootPem
+	return p.result(pair), nil
+}
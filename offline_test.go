@@ -0,0 +1,86 @@
+package easyrsa
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_ImportIntermediate(t *testing.T) {
+	rootDir := filepath.Join(getTestDir(), "offline_root")
+	_ = os.MkdirAll(rootDir, 0777)
+	defer os.RemoveAll(rootDir)
+	_ = ioutil.WriteFile(filepath.Join(rootDir, "serial"), []byte("3e8"), 0666)
+	rootPki := NewPKI(NewDirKeyStorage(rootDir), NewFileSerialProvider(filepath.Join(rootDir, "serial")),
+		NewFileCRLHolder(filepath.Join(rootDir, "crl.pem")), pkix.Name{Organization: []string{"offline"}})
+	root, err := rootPki.NewCa()
+	assert.NoError(t, err)
+	rootKey, rootCert, _ := root.Decode()
+
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	csrPem, keyPem, err := pki.NewIntermediateCSR()
+	assert.NoError(t, err)
+	block, _ := pem.Decode(csrPem)
+	assert.Equal(t, PEMCertificateRequestBlock, block.Type)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, "ca", csr.Subject.CommonName)
+
+	sign := func(serial int64, isCA bool) []byte {
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               csr.Subject,
+			NotBefore:             time.Now().Add(-time.Minute),
+			NotAfter:              time.Now().Add(time.Hour),
+			BasicConstraintsValid: true,
+			IsCA:                  isCA,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		}, rootCert, csr.PublicKey, rootKey)
+		assert.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: PEMCertificateBlock, Bytes: der})
+	}
+
+	_, err = pki.ImportIntermediate(sign(100, false), keyPem, root.CertPemBytes)
+	assert.Error(t, err)
+	_, err = pki.ImportIntermediate(sign(100, true), keyPem, sign(101, true))
+	assert.Error(t, err)
+	_, otherKey, _ := pki.NewIntermediateCSR()
+	_, err = pki.ImportIntermediate(sign(100, true), otherKey, root.CertPemBytes)
+	assert.Error(t, err)
+
+	intermediate, err := pki.ImportIntermediate(sign(100, true), keyPem, root.CertPemBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, root.CertPemBytes, intermediate.ChainPemBytes)
+	anchor, err := pki.Storage.GetLastByCn(TrustAnchorCN)
+	assert.NoError(t, err)
+	assert.False(t, anchor.HasKey())
+	_, err = pki.ImportIntermediate(sign(100, true), keyPem, root.CertPemBytes)
+	assert.Error(t, err)
+
+	leaf, err := pki.NewCert("server", true, []string{""})
+	assert.NoError(t, err)
+	assert.Equal(t, append(append([]byte{}, intermediate.CertPemBytes...), root.CertPemBytes...), leaf.ChainPemBytes)
+	_, leafCert, _ := leaf.Decode()
+	_, interCert, _ := intermediate.Decode()
+	roots, inters := x509.NewCertPool(), x509.NewCertPool()
+	roots.AddCert(rootCert)
+	inters.AddCert(interCert)
+	_, err = leafCert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: inters, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	assert.NoError(t, err)
+	assert.False(t, leafCert.NotAfter.After(interCert.NotAfter))
+
+	assert.NoError(t, pki.RevokeOne(leaf.Serial))
+	report, err := pki.Audit()
+	assert.NoError(t, err)
+	assert.True(t, report.OK(), "%v", report.Issues)
+}
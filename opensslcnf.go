@@ -0,0 +1,460 @@
+package easyrsa
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// OpenSSLConfig is a parsed openssl.cnf, values are kept in file order per section
+type OpenSSLConfig struct {
+	Sections map[string][]OpenSSLConfigValue
+}
+
+// OpenSSLConfigValue is a name = value line of openssl.cnf with variables expanded
+type OpenSSLConfigValue struct {
+	Name  string
+	Value string
+}
+
+var opensslVariable = regexp.MustCompile(`\$(\{([A-Za-z0-9_]+)(::([A-Za-z0-9_]+))?\}|([A-Za-z0-9_]+)(::([A-Za-z0-9_]+))?)`)
+
+// ParseOpenSSLConfig parse openssl.cnf sections, values and $var expansion. Directives like .include are ignored
+func ParseOpenSSLConfig(data []byte) (*OpenSSLConfig, error) {
+	cfg := &OpenSSLConfig{Sections: map[string][]OpenSSLConfigValue{"default": nil}}
+	section := "default"
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo, pending := 0, ""
+	for scanner.Scan() {
+		lineNo++
+		line := pending + scanner.Text()
+		pending = ""
+		if strings.HasSuffix(line, "\\") {
+			pending = strings.TrimSuffix(line, "\\")
+			continue
+		}
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "."):
+			continue
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				return nil, errors.Errorf("line %d: wrong section header", lineNo)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := cfg.Sections[section]; !ok {
+				cfg.Sections[section] = nil
+			}
+			continue
+		}
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, errors.Errorf("line %d: missing =", lineNo)
+		}
+		name := strings.TrimSpace(line[:eq])
+		value := strings.Trim(strings.TrimSpace(line[eq+1:]), `"`)
+		value = opensslVariable.ReplaceAllStringFunc(value, func(ref string) string {
+			m := opensslVariable.FindStringSubmatch(ref)
+			sect, key := section, m[2]+m[5]
+			if m[4]+m[7] != "" {
+				sect, key = key, m[4]+m[7]
+			}
+			if v, ok := cfg.Get(sect, key); ok {
+				return v
+			}
+			if v, ok := cfg.Get("default", key); ok {
+				return v
+			}
+			return ref
+		})
+		cfg.Sections[section] = append(cfg.Sections[section], OpenSSLConfigValue{Name: name, Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "can`t read openssl config")
+	}
+	return cfg, nil
+}
+
+// Get return last value of name in section
+func (c *OpenSSLConfig) Get(section, name string) (string, bool) {
+	values := c.Sections[section]
+	for i := len(values) - 1; i >= 0; i-- {
+		if values[i].Name == name {
+			return values[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// ExtensionSections return names of sections referenced by x509_extensions in any section
+func (c *OpenSSLConfig) ExtensionSections() []string {
+	seen := make(map[string]bool)
+	res := make([]string, 0)
+	for _, values := range c.Sections {
+		for _, value := range values {
+			if value.Name == "x509_extensions" && !seen[value.Value] {
+				seen[value.Value] = true
+				res = append(res, value.Value)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// ImportOpenSSLProfiles convert extension sections of openssl.cnf into profiles named after the sections.
+// Sections referenced by x509_extensions are converted if none given. Unsupported extensions are errors, not skipped
+func ImportOpenSSLProfiles(data []byte, sections ...string) ([]*Profile, error) {
+	cfg, err := ParseOpenSSLConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(sections) == 0 {
+		sections = cfg.ExtensionSections()
+	}
+	res := make([]*Profile, 0, len(sections))
+	for _, section := range sections {
+		profile, err := cfg.Profile(section)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, profile)
+	}
+	return res, nil
+}
+
+// Profile convert one extension section into profile
+func (c *OpenSSLConfig) Profile(section string) (*Profile, error) {
+	values, ok := c.Sections[section]
+	if !ok {
+		return nil, NewNotExist(fmt.Sprintf("section %s not found", section))
+	}
+	profile := &Profile{Name: section}
+	for _, value := range values {
+		if err := c.applyExtension(profile, value.Name, value.Value); err != nil {
+			return nil, errors.Wrapf(err, "section %s, %s", section, value.Name)
+		}
+	}
+	return profile, nil
+}
+
+var opensslKeyUsages = map[string]x509.KeyUsage{
+	"digitalSignature": x509.KeyUsageDigitalSignature,
+	"nonRepudiation":   x509.KeyUsageContentCommitment,
+	"keyEncipherment":  x509.KeyUsageKeyEncipherment,
+	"dataEncipherment": x509.KeyUsageDataEncipherment,
+	"keyAgreement":     x509.KeyUsageKeyAgreement,
+	"keyCertSign":      x509.KeyUsageCertSign,
+	"cRLSign":          x509.KeyUsageCRLSign,
+	"encipherOnly":     x509.KeyUsageEncipherOnly,
+	"decipherOnly":     x509.KeyUsageDecipherOnly,
+}
+
+var opensslExtKeyUsages = map[string]x509.ExtKeyUsage{
+	"anyExtendedKeyUsage": x509.ExtKeyUsageAny,
+	"serverAuth":          x509.ExtKeyUsageServerAuth,
+	"clientAuth":          x509.ExtKeyUsageClientAuth,
+	"codeSigning":         x509.ExtKeyUsageCodeSigning,
+	"emailProtection":     x509.ExtKeyUsageEmailProtection,
+	"timeStamping":        x509.ExtKeyUsageTimeStamping,
+	"OCSPSigning":         x509.ExtKeyUsageOCSPSigning,
+}
+
+// KeyUsageByName return key usage by openssl name, e.g. digitalSignature
+func KeyUsageByName(name string) (x509.KeyUsage, bool) {
+	usage, ok := opensslKeyUsages[name]
+	return usage, ok
+}
+
+// ExtKeyUsageByName return extended key usage by openssl name, e.g. serverAuth
+func ExtKeyUsageByName(name string) (x509.ExtKeyUsage, bool) {
+	usage, ok := opensslExtKeyUsages[name]
+	return usage, ok
+}
+
+var opensslNsCertTypes = []string{"client", "server", "email", "objsign", "reserved", "sslCA", "emailCA", "objCA"}
+
+// splitCritical split comma separated value and strip leading critical flag
+func splitCritical(value string) (items []string, critical bool) {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if item == "critical" && len(items) == 0 && !critical {
+			critical = true
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, critical
+}
+
+func (c *OpenSSLConfig) applyExtension(profile *Profile, name, value string) error {
+	items, critical := splitCritical(value)
+	switch name {
+	case "basicConstraints":
+		for _, item := range items {
+			switch {
+			case strings.EqualFold(item, "CA:TRUE"):
+				profile.IsCA = true
+			case strings.EqualFold(item, "CA:FALSE"):
+				profile.IsCA = false
+			case strings.HasPrefix(item, "pathlen:"):
+				n, err := strconv.Atoi(strings.TrimPrefix(item, "pathlen:"))
+				if err != nil {
+					return errors.Wrap(err, "wrong pathlen")
+				}
+				profile.MaxPathLen = n
+				profile.MaxPathLenZero = n == 0
+			default:
+				return errors.Errorf("unsupported value %s", item)
+			}
+		}
+	case "keyUsage":
+		for _, item := range items {
+			usage, ok := opensslKeyUsages[item]
+			if !ok {
+				return errors.Errorf("unknown key usage %s", item)
+			}
+			profile.KeyUsage |= usage
+		}
+	case "extendedKeyUsage":
+		var oids []asn1.ObjectIdentifier
+		for _, item := range items {
+			if usage, ok := opensslExtKeyUsages[item]; ok {
+				profile.ExtKeyUsage = append(profile.ExtKeyUsage, usage)
+				oids = append(oids, extKeyUsageOIDs[usage])
+				continue
+			}
+			oid, err := parseOID(item)
+			if err != nil {
+				return errors.Errorf("unknown extended key usage %s", item)
+			}
+			profile.UnknownExtKeyUsage = append(profile.UnknownExtKeyUsage, oid)
+			oids = append(oids, oid)
+		}
+		if critical {
+			// crypto/x509 always mark EKU as not critical, so critical one is added as raw extension
+			eku, err := asn1.Marshal(oids)
+			if err != nil {
+				return err
+			}
+			profile.ExtKeyUsage, profile.UnknownExtKeyUsage = nil, nil
+			profile.ExtraExtensions = append(profile.ExtraExtensions, pkix.Extension{Id: oidExtKeyUsage, Critical: true, Value: eku})
+		}
+	case "subjectKeyIdentifier":
+		if value != "hash" {
+			return errors.Errorf("only hash is supported, got %s", value)
+		}
+	case "authorityKeyIdentifier":
+		// crypto/x509 always set keyid of the issuer
+	case "subjectAltName":
+		return c.applyAltNames(profile, items)
+	case "crlDistributionPoints":
+		for _, item := range items {
+			if strings.HasPrefix(item, "@") {
+				fullName, ok := c.Get(item[1:], "fullname")
+				if !ok {
+					return errors.Errorf("no fullname in section %s", item[1:])
+				}
+				item = fullName
+			}
+			if !strings.HasPrefix(item, "URI:") {
+				return errors.Errorf("unsupported distribution point %s", item)
+			}
+			profile.CRLDistributionPoints = append(profile.CRLDistributionPoints, strings.TrimPrefix(item, "URI:"))
+		}
+	case "authorityInfoAccess":
+		for _, item := range items {
+			parts := strings.SplitN(item, ";", 2)
+			if len(parts) != 2 || !strings.HasPrefix(parts[1], "URI:") {
+				return errors.Errorf("unsupported access description %s", item)
+			}
+			uri := strings.TrimPrefix(parts[1], "URI:")
+			switch parts[0] {
+			case "OCSP":
+				profile.OCSPServer = append(profile.OCSPServer, uri)
+			case "caIssuers":
+				profile.IssuingCertificateURL = append(profile.IssuingCertificateURL, uri)
+			default:
+				return errors.Errorf("unsupported access method %s", parts[0])
+			}
+		}
+	case "certificatePolicies":
+		for _, item := range items {
+			if item == "ia5org" {
+				continue
+			}
+			if strings.HasPrefix(item, "@") {
+				policy, ok := c.Get(item[1:], "policyIdentifier")
+				if !ok {
+					return errors.Errorf("no policyIdentifier in section %s", item[1:])
+				}
+				item = policy
+			}
+			oid, err := parseOID(item)
+			if err != nil {
+				return err
+			}
+			profile.PolicyIdentifiers = append(profile.PolicyIdentifiers, oid)
+		}
+	case "nsCertType":
+		bits := asn1.BitString{Bytes: []byte{0}}
+		for _, item := range items {
+			idx := indexOf(opensslNsCertTypes, item)
+			if idx < 0 {
+				return errors.Errorf("unknown nsCertType %s", item)
+			}
+			bits.Bytes[0] |= 0x80 >> uint(idx)
+			if idx+1 > bits.BitLength {
+				bits.BitLength = idx + 1
+			}
+		}
+		ext, err := asn1.Marshal(bits)
+		if err != nil {
+			return err
+		}
+		profile.ExtraExtensions = append(profile.ExtraExtensions,
+			pkix.Extension{Id: asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 1, 1}, Critical: critical, Value: ext})
+	case "nsComment":
+		ext, err := asn1.MarshalWithParams(value, "ia5")
+		if err != nil {
+			return err
+		}
+		profile.ExtraExtensions = append(profile.ExtraExtensions,
+			pkix.Extension{Id: asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 1, 13}, Value: ext})
+	default:
+		oid, err := parseOID(name)
+		if err != nil {
+			return errors.New("unsupported extension")
+		}
+		ext, err := parseRawExtensionValue(strings.Join(items, ","))
+		if err != nil {
+			return err
+		}
+		profile.ExtraExtensions = append(profile.ExtraExtensions, pkix.Extension{Id: oid, Critical: critical, Value: ext})
+	}
+	return nil
+}
+
+func (c *OpenSSLConfig) applyAltNames(profile *Profile, items []string) error {
+	for _, item := range items {
+		if strings.HasPrefix(item, "@") {
+			section, ok := c.Sections[item[1:]]
+			if !ok {
+				return errors.Errorf("section %s not found", item[1:])
+			}
+			sectionItems := make([]string, 0, len(section))
+			for _, value := range section {
+				kind := value.Name
+				if idx := strings.Index(kind, "."); idx >= 0 {
+					kind = kind[:idx]
+				}
+				sectionItems = append(sectionItems, kind+":"+value.Value)
+			}
+			if err := c.applyAltNames(profile, sectionItems); err != nil {
+				return err
+			}
+			continue
+		}
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			return errors.Errorf("wrong subject alt name %s", item)
+		}
+		switch parts[0] {
+		case "DNS":
+			profile.DNSNames = append(profile.DNSNames, parts[1])
+		case "IP":
+			ip := net.ParseIP(parts[1])
+			if ip == nil {
+				return errors.Errorf("wrong ip %s", parts[1])
+			}
+			profile.IPAddresses = append(profile.IPAddresses, ip)
+		case "email":
+			if parts[1] == "copy" || parts[1] == "move" {
+				return errors.Errorf("email:%s is not supported", parts[1])
+			}
+			profile.EmailAddresses = append(profile.EmailAddresses, parts[1])
+		case "URI":
+			uri, err := url.Parse(parts[1])
+			if err != nil {
+				return errors.Wrap(err, "wrong uri")
+			}
+			profile.URIs = append(profile.URIs, uri)
+		default:
+			return errors.Errorf("unsupported subject alt name type %s", parts[0])
+		}
+	}
+	return nil
+}
+
+// parseRawExtensionValue support DER:hex and ASN1:UTF8String, ASN1:IA5STRING, ASN1:NULL forms
+func parseRawExtensionValue(value string) ([]byte, error) {
+	if strings.HasPrefix(value, "DER:") {
+		return hex.DecodeString(strings.Replace(strings.TrimPrefix(value, "DER:"), ":", "", -1))
+	}
+	if value == "ASN1:NULL" {
+		return asn1.NullBytes, nil
+	}
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) == 3 && parts[0] == "ASN1" {
+		switch strings.ToUpper(parts[1]) {
+		case "UTF8STRING", "UTF8":
+			return asn1.MarshalWithParams(parts[2], "utf8")
+		case "IA5STRING", "IA5":
+			return asn1.MarshalWithParams(parts[2], "ia5")
+		}
+	}
+	return nil, errors.Errorf("unsupported raw extension value %s", value)
+}
+
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, errors.Errorf("wrong oid %s", s)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("wrong oid %s", s)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
+
+var extKeyUsageOIDs = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+	x509.ExtKeyUsageAny:             {2, 5, 29, 37, 0},
+	x509.ExtKeyUsageServerAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	x509.ExtKeyUsageClientAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	x509.ExtKeyUsageCodeSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	x509.ExtKeyUsageEmailProtection: {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	x509.ExtKeyUsageTimeStamping:    oidExtKeyUsageTimeStamp,
+	x509.ExtKeyUsageOCSPSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 9},
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
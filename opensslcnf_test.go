@@ -0,0 +1,96 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testOpenSSLConfig = `
+HOME = .
+crl_base = http://pki.local   # base url
+
+[ ca ]
+default_ca = CA_default
+
+[ CA_default ]
+dir = $HOME/pki
+x509_extensions = usr_cert
+
+[ req ]
+x509_extensions = v3_ca
+
+[ usr_cert ]
+basicConstraints = CA:FALSE
+keyUsage = critical, digitalSignature, keyEncipherment
+extendedKeyUsage = serverAuth, clientAuth, 1.3.6.1.4.1.311.20.2.2
+subjectKeyIdentifier = hash
+authorityKeyIdentifier = keyid,issuer
+subjectAltName = @alt_names
+crlDistributionPoints = URI:${crl_base}/crl.pem
+authorityInfoAccess = OCSP;URI:http://ocsp.pki.local, caIssuers;URI:http://pki.local/ca.crt
+certificatePolicies = 1.3.6.1.4.1.99999.1
+nsCertType = client, server
+nsComment = "OpenSSL Generated Certificate"
+1.3.6.1.4.1.99999.2 = critical, ASN1:UTF8String:internal
+1.3.6.1.4.1.99999.3 = DER:05:00
+
+[ alt_names ]
+DNS.1 = web.pki.local
+DNS.2 = \
+  api.pki.local
+IP.1 = 10.0.0.1
+
+[ v3_ca ]
+basicConstraints = critical, CA:true, pathlen:0
+keyUsage = cRLSign, keyCertSign
+extendedKeyUsage = critical, OCSPSigning
+
+[ broken ]
+nameConstraints = permitted;DNS:pki.local
+`
+
+func TestParseOpenSSLConfig(t *testing.T) {
+	cfg, err := ParseOpenSSLConfig([]byte(testOpenSSLConfig))
+	assert.NoError(t, err)
+	dir, _ := cfg.Get("CA_default", "dir")
+	assert.Equal(t, "./pki", dir)
+	assert.Equal(t, []string{"usr_cert", "v3_ca"}, cfg.ExtensionSections())
+
+	_, err = ParseOpenSSLConfig([]byte("[ section\n"))
+	assert.Error(t, err)
+	_, err = ParseOpenSSLConfig([]byte("novalue\n"))
+	assert.Error(t, err)
+}
+
+func TestImportOpenSSLProfiles(t *testing.T) {
+	profiles, err := ImportOpenSSLProfiles([]byte(testOpenSSLConfig))
+	assert.NoError(t, err)
+	assert.Len(t, profiles, 2)
+	usr, ca := profiles[0], profiles[1]
+	assert.Equal(t, "usr_cert", usr.Name)
+	assert.Equal(t, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment, usr.KeyUsage)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, usr.ExtKeyUsage)
+	assert.Equal(t, "1.3.6.1.4.1.311.20.2.2", usr.UnknownExtKeyUsage[0].String())
+	assert.Equal(t, []string{"web.pki.local", "api.pki.local"}, usr.DNSNames)
+	assert.Equal(t, "10.0.0.1", usr.IPAddresses[0].String())
+	assert.Equal(t, []string{"http://pki.local/crl.pem"}, usr.CRLDistributionPoints)
+	assert.Equal(t, []string{"http://ocsp.pki.local"}, usr.OCSPServer)
+	assert.Equal(t, []string{"http://pki.local/ca.crt"}, usr.IssuingCertificateURL)
+	assert.Len(t, usr.ExtraExtensions, 4)
+	assert.Equal(t, []byte{0x03, 0x02, 0x06, 0xc0}, usr.ExtraExtensions[0].Value)
+	assert.True(t, usr.ExtraExtensions[2].Critical)
+	assert.Equal(t, []byte{0x0c, 0x08, 'i', 'n', 't', 'e', 'r', 'n', 'a', 'l'}, usr.ExtraExtensions[2].Value)
+
+	assert.True(t, ca.IsCA)
+	assert.True(t, ca.MaxPathLenZero)
+	assert.Equal(t, x509.KeyUsageCertSign|x509.KeyUsageCRLSign, ca.KeyUsage)
+	assert.Nil(t, ca.ExtKeyUsage)
+	assert.True(t, ca.ExtraExtensions[0].Critical)
+
+	_, err = ImportOpenSSLProfiles([]byte(testOpenSSLConfig), "broken")
+	assert.Error(t, err)
+	_, err = ImportOpenSSLProfiles([]byte(testOpenSSLConfig), "missing")
+	assert.Error(t, err)
+}
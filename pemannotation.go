@@ -0,0 +1,108 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PEMAnnotation is a way informational fields are added to pem encoded certs
+type PEMAnnotation int
+
+const (
+	PEMAnnotationNone     PEMAnnotation = iota // plain pem blocks
+	PEMAnnotationComments                      // "key=value" lines above each cert block, as openssl x509 -subject -issuer print
+	PEMAnnotationHeaders                       // "Key: value" headers inside each cert block, read by Go pem.Decode but rejected by openssl
+)
+
+// WithPEMAnnotation annotate certs of issued pairs and their chains, so stored and exported pem files are
+// self describing. Annotations are informational only, certs are never read from them
+func WithPEMAnnotation(annotation PEMAnnotation) Option {
+	return func(p *PKI) {
+		p.pemAnnotation = annotation
+	}
+}
+
+// pemAnnotations return ordered informational fields of cert
+func pemAnnotations(cert *x509.Certificate) [][2]string {
+	return [][2]string{
+		{"subject", cert.Subject.String()},
+		{"issuer", cert.Issuer.String()},
+		{"serial", FormatSerial(cert.SerialNumber)},
+		{"notBefore", cert.NotBefore.UTC().Format(time.RFC3339)},
+		{"notAfter", cert.NotAfter.UTC().Format(time.RFC3339)},
+	}
+}
+
+// pemHeaderNames are pem header keys of pemAnnotations fields
+var pemHeaderNames = map[string]string{
+	"subject":   "Subject",
+	"issuer":    "Issuer",
+	"serial":    "Serial",
+	"notBefore": "Not-Before",
+	"notAfter":  "Not-After",
+}
+
+// AnnotatePEM re-encode every pem block of data adding annotation to cert blocks, other blocks stay as they are.
+// Text outside blocks, including previous comments, is dropped, so annotating again replace the annotation
+func AnnotatePEM(data []byte, annotation PEMAnnotation) ([]byte, error) {
+	res := bytes.NewBuffer(nil)
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != PEMCertificateBlock {
+			if err := pem.Encode(res, block); err != nil {
+				return nil, errors.Wrap(err, "can`t encode pem")
+			}
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t parse cert")
+		}
+		out := &pem.Block{Type: block.Type, Bytes: block.Bytes}
+		switch annotation {
+		case PEMAnnotationComments:
+			for _, field := range pemAnnotations(cert) {
+				fmt.Fprintf(res, "%s=%s\n", field[0], field[1])
+			}
+		case PEMAnnotationHeaders:
+			out.Headers = make(map[string]string)
+			for _, field := range pemAnnotations(cert) {
+				out.Headers[pemHeaderNames[field[0]]] = field[1]
+			}
+		}
+		if err := pem.Encode(res, out); err != nil {
+			return nil, errors.Wrap(err, "can`t encode pem")
+		}
+	}
+	return res.Bytes(), nil
+}
+
+// annotatePair annotate cert and chain of pair with PKI annotation
+func (p *PKI) annotatePair(pair *X509Pair) error {
+	if p.pemAnnotation == PEMAnnotationNone {
+		return nil
+	}
+	cert, err := AnnotatePEM(pair.CertPemBytes, p.pemAnnotation)
+	if err != nil {
+		return err
+	}
+	chain, err := AnnotatePEM(pair.ChainPemBytes, p.pemAnnotation)
+	if err != nil {
+		return err
+	}
+	pair.CertPemBytes = cert
+	if len(pair.ChainPemBytes) > 0 {
+		pair.ChainPemBytes = chain
+	}
+	return nil
+}
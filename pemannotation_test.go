@@ -0,0 +1,68 @@
+package easyrsa
+
+import (
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotatePEM(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	ca, _ := pki.NewCa()
+	pair, err := pki.NewCert("server", true, []string{""})
+	assert.NoError(t, err)
+	cert, _ := decodeCert(pair.CertPemBytes)
+	bundle := append(append(append([]byte{}, pair.CertPemBytes...), ca.CertPemBytes...), pair.KeyPemBytes...)
+
+	t.Run("comments", func(t *testing.T) {
+		res, err := AnnotatePEM(bundle, PEMAnnotationComments)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(res), "subject=CN=server\n"))
+		assert.Contains(t, string(res), "serial="+FormatSerial(cert.SerialNumber)+"\n")
+		assert.Equal(t, 2, strings.Count(string(res), "issuer="))
+		decoded, err := decodeCert(res)
+		assert.NoError(t, err)
+		assert.Equal(t, cert.Raw, decoded.Raw)
+		again, err := AnnotatePEM(res, PEMAnnotationComments)
+		assert.NoError(t, err)
+		assert.Equal(t, res, again)
+		plain, err := AnnotatePEM(res, PEMAnnotationNone)
+		assert.NoError(t, err)
+		assert.Equal(t, bundle, plain)
+	})
+	t.Run("headers", func(t *testing.T) {
+		res, err := AnnotatePEM(bundle, PEMAnnotationHeaders)
+		assert.NoError(t, err)
+		block, rest := pem.Decode(res)
+		assert.Equal(t, "CN=server", block.Headers["Subject"])
+		assert.Equal(t, FormatSerial(cert.SerialNumber), block.Headers["Serial"])
+		assert.Equal(t, cert.Raw, block.Bytes)
+		_, rest = pem.Decode(rest)
+		key, _ := pem.Decode(rest)
+		assert.Empty(t, key.Headers)
+	})
+	t.Run("broken", func(t *testing.T) {
+		_, err := AnnotatePEM(pem.EncodeToMemory(&pem.Block{Type: PEMCertificateBlock, Bytes: []byte("cert")}), PEMAnnotationComments)
+		assert.Error(t, err)
+	})
+}
+
+func TestWithPEMAnnotation(t *testing.T) {
+	pki, cleanup := getTmpPki(WithPEMAnnotation(PEMAnnotationComments))
+	defer cleanup()
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(ca.CertPemBytes), "subject=CN=ca\n"))
+	pair, err := pki.NewCert("client", false, []string{""})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(pair.CertPemBytes), "subject=CN=client\n"))
+	assert.Equal(t, ca.CertPemBytes, pair.CAChainPEM())
+	stored, err := pki.Storage.GetBySerial(pair.Serial)
+	assert.NoError(t, err)
+	assert.Equal(t, pair.CertPemBytes, stored.CertPemBytes)
+	_, err = decodeCert(stored.CertPemBytes)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,122 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// IgnoredBlock describe pem block skipped by ParsePEMBundle
+type IgnoredBlock struct {
+	Index  int    // zero based position of the block in input
+	Type   string // pem block type
+	Reason string
+}
+
+// PEMBundle is a result of lenient parsing of concatenated pem blocks
+type PEMBundle struct {
+	KeyPemBytes   []byte         // first private key block
+	CertPemBytes  []byte         // leaf certificate, the one matching key if key present
+	ChainPemBytes []byte         // other certificates in input order
+	Ignored       []IgnoredBlock // blocks not used in the bundle
+}
+
+// ParsePEMBundle split concatenated key, cert and chain pem blocks and report ignored ones
+func ParsePEMBundle(data []byte) (*PEMBundle, error) {
+	res := &PEMBundle{}
+	var keyBlock *pem.Block
+	certs := make([]*pem.Block, 0)
+	rest := data
+	for index := 0; ; index++ {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch {
+		case block.Type == PEMCertificateBlock:
+			if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+				res.Ignored = append(res.Ignored, IgnoredBlock{Index: index, Type: block.Type, Reason: err.Error()})
+				continue
+			}
+			certs = append(certs, block)
+		case isKeyBlockType(block.Type):
+			if keyBlock != nil {
+				res.Ignored = append(res.Ignored, IgnoredBlock{Index: index, Type: block.Type, Reason: "extra private key"})
+				continue
+			}
+			keyBlock = block
+		default:
+			res.Ignored = append(res.Ignored, IgnoredBlock{Index: index, Type: block.Type, Reason: "unsupported block type"})
+		}
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		res.Ignored = append(res.Ignored, IgnoredBlock{Index: -1, Reason: fmt.Sprintf("%d bytes of trailing non pem data", len(rest))})
+	}
+	if keyBlock == nil && len(certs) == 0 {
+		return nil, errors.New("no key or certificate blocks found")
+	}
+
+	leaf := 0
+	if keyBlock != nil {
+		res.KeyPemBytes = pem.EncodeToMemory(keyBlock)
+		if !isEncryptedKey(res.KeyPemBytes) {
+			if signer, err := ParsePrivateKeyPEM(res.KeyPemBytes, nil); err == nil {
+				for i, block := range certs {
+					cert, _ := x509.ParseCertificate(block.Bytes)
+					if publicKeyEqual(signer.Public(), cert.PublicKey) {
+						leaf = i
+						break
+					}
+				}
+				zeroSigner(signer)
+			}
+		}
+	}
+	chain := bytes.NewBuffer(nil)
+	for i, block := range certs {
+		if i == leaf {
+			res.CertPemBytes = pem.EncodeToMemory(block)
+			continue
+		}
+		_ = pem.Encode(chain, block)
+	}
+	if chain.Len() > 0 {
+		res.ChainPemBytes = chain.Bytes()
+	}
+	return res, nil
+}
+
+// Pair create X509Pair from bundle taking CN and serial from the leaf certificate
+func (b *PEMBundle) Pair() (*X509Pair, error) {
+	cert, err := decodeCert(b.CertPemBytes)
+	if err != nil {
+		return nil, err
+	}
+	pair := NewX509Pair(b.KeyPemBytes, b.CertPemBytes, cert.Subject.CommonName, cert.SerialNumber)
+	pair.ChainPemBytes = b.ChainPemBytes
+	return pair, nil
+}
+
+func isKeyBlockType(blockType string) bool {
+	switch blockType {
+	case PEMRSAPrivateKeyBlock, PEMPrivateKeyBlock, PEMECPrivateKeyBlock, PEMEncryptedPrivateKeyBlock:
+		return true
+	}
+	return false
+}
+
+// findBlock return first pem block accepted by match
+func findBlock(data []byte, match func(blockType string) bool) *pem.Block {
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil || match(block.Type) {
+			return block
+		}
+	}
+}
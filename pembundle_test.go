@@ -0,0 +1,57 @@
+package easyrsa
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePEMBundle(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	ca, _ := pki.NewCa()
+	server, _ := pki.NewCert("server", true, []string{""})
+	crl := []byte("-----BEGIN X509 CRL-----\nAAAA\n-----END X509 CRL-----\n")
+
+	t.Run("chain key cert", func(t *testing.T) {
+		data := bytes.Join([][]byte{ca.CertPemBytes, server.KeyPemBytes, server.CertPemBytes, crl, []byte("junk")}, nil)
+		bundle, err := ParsePEMBundle(data)
+		assert.NoError(t, err)
+		assert.Equal(t, server.KeyPemBytes, bundle.KeyPemBytes)
+		assert.Equal(t, server.CertPemBytes, bundle.CertPemBytes)
+		assert.Equal(t, ca.CertPemBytes, bundle.ChainPemBytes)
+		assert.Len(t, bundle.Ignored, 2)
+		assert.Equal(t, PEMx509CRLBlock, bundle.Ignored[0].Type)
+		assert.Equal(t, 3, bundle.Ignored[0].Index)
+		pair, err := bundle.Pair()
+		assert.NoError(t, err)
+		assert.Equal(t, "server", pair.CN)
+		assert.Equal(t, server.Serial, pair.Serial)
+		assert.NoError(t, pair.Validate())
+	})
+	t.Run("cert only", func(t *testing.T) {
+		bundle, err := ParsePEMBundle(bytes.Join([][]byte{server.CertPemBytes, ca.CertPemBytes}, nil))
+		assert.NoError(t, err)
+		assert.Empty(t, bundle.KeyPemBytes)
+		assert.Equal(t, server.CertPemBytes, bundle.CertPemBytes)
+	})
+	t.Run("extra key", func(t *testing.T) {
+		bundle, err := ParsePEMBundle(bytes.Join([][]byte{server.KeyPemBytes, ca.KeyPemBytes}, nil))
+		assert.NoError(t, err)
+		assert.Len(t, bundle.Ignored, 1)
+		_, err = bundle.Pair()
+		assert.Error(t, err)
+	})
+	t.Run("empty", func(t *testing.T) {
+		_, err := ParsePEMBundle([]byte("junk"))
+		assert.Error(t, err)
+	})
+	t.Run("decode concatenated", func(t *testing.T) {
+		both := bytes.Join([][]byte{server.CertPemBytes, server.KeyPemBytes}, nil)
+		key, cert, err := NewX509Pair(both, both, "server", server.Serial).Decode()
+		assert.NoError(t, err)
+		assert.NotNil(t, key)
+		assert.Equal(t, "server", cert.Subject.CommonName)
+	})
+}
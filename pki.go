@@ -1,49 +1,96 @@
 package easyrsa
 
 import (
-	"crypto/rand"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/pem"
+	"io"
 	"math/big"
 	"net"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // X509Pair represent pair cert and key
 type X509Pair struct {
-	KeyPemBytes  []byte   // pem encoded rsa.PrivateKey bytes
-	CertPemBytes []byte   // pem encoded x509.Certificate bytes
-	CN           string   // common name
-	Serial       *big.Int // serial number
+	KeyPemBytes   []byte            // pem encoded rsa.PrivateKey bytes
+	CertPemBytes  []byte            // pem encoded x509.Certificate bytes
+	ChainPemBytes []byte            // pem encoded issuing chain from direct issuer up to the root, may be empty
+	CN            string            // common name
+	Serial        *big.Int          // serial number
+	Metadata      map[string]string // arbitrary tags as owner team or ticket, persisted by storage
 }
 
-// Decode pem bytes to rsa.PrivateKey and x509.Certificate
+// HasKey return true if pair carry private key, cert only pairs don`t
+func (pair *X509Pair) HasKey() bool {
+	return len(pair.KeyPemBytes) != 0
+}
+
+// Decode pem bytes to rsa.PrivateKey and x509.Certificate. Key is nil for cert only pair.
+// Use DecodeSigner for non rsa or encrypted keys
 func (pair *X509Pair) Decode() (key *rsa.PrivateKey, cert *x509.Certificate, err error) {
-	block, _ := pem.Decode(pair.KeyPemBytes)
-	if block == nil {
-		return nil, nil, errors.New("can`t parse key")
+	signer, cert, err := pair.DecodeSigner(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if signer == nil {
+		return nil, cert, nil
+	}
+	key, ok := signer.(*rsa.PrivateKey)
+	if !ok {
+		zeroSigner(signer)
+		return nil, nil, errors.New("key is not rsa")
 	}
+	return key, cert, nil
+}
 
-	key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+// Validate check pem bytes can be decoded, key match cert and CN and Serial agree with cert.
+// Pair without KeyPemBytes is a valid cert only pair, encrypted key is not matched against cert
+func (pair *X509Pair) Validate() error {
+	var cert *x509.Certificate
+	var err error
+	if isEncryptedKey(pair.KeyPemBytes) {
+		cert, err = decodeCert(pair.CertPemBytes)
+	} else {
+		var key crypto.Signer
+		key, cert, err = pair.DecodeSigner(nil)
+		zeroSigner(key)
+	}
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "can`t parse key")
+		return err
+	}
+	// trust anchors keep subject of the offline root, crl signers subject of their CA, cross certs of external CA
+	if cert.Subject.CommonName != pair.CN && pair.CN != TrustAnchorCN && pair.CN != CRLSignerCN && pair.CN != CrossCertCN {
+		return errors.Errorf("pair cn %q does not match cert cn %q", pair.CN, cert.Subject.CommonName)
 	}
+	if pair.Serial == nil || pair.Serial.Cmp(cert.SerialNumber) != 0 {
+		return errors.Errorf("pair serial %v does not match cert serial %s", pair.Serial, cert.SerialNumber.Text(16))
+	}
+	return nil
+}
 
-	block, _ = pem.Decode(pair.CertPemBytes)
+// decodeCert parse first certificate block skipping any other blocks
+func decodeCert(certPemBytes []byte) (*x509.Certificate, error) {
+	block := findBlock(certPemBytes, func(blockType string) bool {
+		return blockType == PEMCertificateBlock
+	})
 	if block == nil {
-		return nil, nil, errors.New("can`t parse cert")
+		return nil, errors.New("can`t parse cert")
 	}
-	cert, err = x509.ParseCertificate(block.Bytes)
+	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "can`t parse cert")
+		return nil, errors.Wrap(err, "can`t parse cert")
 	}
-	return
+	return cert, nil
 }
 
 // NewX509Pair create new X509Pair object
@@ -53,62 +100,190 @@ func NewX509Pair(keyPemBytes []byte, certPemBytes []byte, CN string, serial *big
 
 // PKI struct holder
 type PKI struct {
-	Storage        KeyStorage
-	serialProvider SerialProvider
-	crlHolder      CRLHolder
-	subjTemplate   pkix.Name
+	Storage             KeyStorage
+	serialProvider      SerialProvider
+	crlHolder           CRLHolder
+	subjTemplate        pkix.Name
+	subjectBuilder      SubjectBuilder
+	dropKeys            bool
+	keySize             int
+	caValidity          time.Duration
+	certValidity        time.Duration
+	fips                bool
+	strictValidity      bool
+	onClamp             func(cn string, requested, notAfter time.Time)
+	revocationLog       RevocationLog
+	limits              IssuanceLimits
+	dnsPolicy           *DNSPolicy
+	profiles            map[string]*Profile
+	crlPartitions       int
+	crlURLTemplate      string
+	ctLogs              []CTLog
+	ctMinSCTs           int
+	clock               func() time.Time
+	random              io.Reader
+	serialMu            sync.Mutex
+	crlMu               sync.Mutex
+	sealMu              sync.RWMutex
+	unsealed            *X509Pair
+	cache               pkiCache
+	commitHooks         []CommitHook
+	signHooks           []SignHook
+	pemAnnotation       PEMAnnotation
+	hybrid              HybridSigner
+	auditSinks          []AuditSink
+	crlPublisher        *CRLPublisher
+	elector             *Elector
+	rotationOverlap     time.Duration
+	caRenewal           *CARenewal
+	revokedKeyRetention *RevokedKeyRetention
+	attestation         *AttestationPolicy
+	csrPolicy           *CSRPolicy
+	challenges          csrChallenges
+	keyIndex            keyIndex
+	caMaxPathLen        *int
+	caNameConstraints   *NameConstraints
+	idempotencyWindow   time.Duration
+	idempotency         idempotencyCache
+	crlFailure          *CRLFailurePolicy
+	trustedTime         *TrustedTimePolicy
+	timeCheck           trustedTimeCheck
+	lastCRL             lastCRL
+	blockList           BlockList
+	rsaPSS              bool
+	enrollmentTokens    EnrollmentTokenStore
+	duplicateCN         DuplicateCNPolicy
+	supersedeOnRenew    bool
+	supersedeGrace      time.Duration
+	tracer              trace.Tracer
+	lifecycle           lifecycle
+}
+
+// Option configure optional PKI behaviour
+type Option func(*PKI)
+
+// WithoutKeyRetention make NewCa and NewCert return pairs without KeyPemBytes.
+// Keys are only written to Storage and should be read from there when needed
+func WithoutKeyRetention() Option {
+	return func(p *PKI) {
+		p.dropKeys = true
+	}
+}
+
+// KeyRetention return false if pairs are returned without keys because of WithoutKeyRetention
+func (p *PKI) KeyRetention() bool {
+	return !p.dropKeys
+}
+
+// WithStrictValidity make issuance fail instead of clamping NotAfter when it outlives the issuing CA
+func WithStrictValidity() Option {
+	return func(p *PKI) {
+		p.strictValidity = true
+	}
+}
+
+// WithClampWarning set callback called when NotAfter of a new cert was clamped to the issuing CA NotAfter
+func WithClampWarning(fn func(cn string, requested, notAfter time.Time)) Option {
+	return func(p *PKI) {
+		p.onClamp = fn
+	}
+}
+
+// WithKeySize set RSA key size of generated keys, DefaultKeySizeBytes if not set
+func WithKeySize(bits int) Option {
+	return func(p *PKI) {
+		p.keySize = bits
+	}
+}
+
+// WithValidity set lifetime of new CAs and leafs, DefaultExpireYears is used for zero values
+func WithValidity(ca, cert time.Duration) Option {
+	return func(p *PKI) {
+		p.caValidity = ca
+		p.certValidity = cert
+	}
 }
 
 // NewPKI PKI struct "constructor"
-func NewPKI(storage KeyStorage, sp SerialProvider, crlHolder CRLHolder, subjTemplate pkix.Name) *PKI {
-	return &PKI{Storage: storage, serialProvider: sp, crlHolder: crlHolder, subjTemplate: subjTemplate}
+func NewPKI(storage KeyStorage, sp SerialProvider, crlHolder CRLHolder, subjTemplate pkix.Name, opts ...Option) *PKI {
+	p := &PKI{Storage: storage, serialProvider: sp, crlHolder: crlHolder, subjTemplate: subjTemplate}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // NewCa creating new version self signed CA pair
 func (p *PKI) NewCa() (*X509Pair, error) {
-	key, err := rsa.GenerateKey(rand.Reader, DefaultKeySizeBytes)
+	if err := p.requireLeader(); err != nil {
+		return nil, err
+	}
+	tx := &transaction{}
+	res, err := p.newCa(tx)
 	if err != nil {
-		return nil, errors.New("can`t generate key")
+		return nil, tx.rollback(err)
+	}
+	if err := p.storePair(tx, res); err != nil {
+		return nil, tx.rollback(err)
 	}
+	return p.result(res), nil
+}
 
-	subj := p.subjTemplate
-	subj.CommonName = "ca"
+// newCa generate self signed CA pair without storing it, serial reservation is registered in tx
+func (p *PKI) newCa(tx *transaction) (*X509Pair, error) {
+	if err := p.checkTrustedTime(); err != nil {
+		return nil, err
+	}
+	key, err := p.generateKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t generate key")
+	}
+	defer ZeroKey(key)
+
+	subj := p.subject("ca", CertRequest{CA: true})
 
-	serial, err := p.serialProvider.Next()
+	serial, err := p.reserveSerial(tx)
 	if err != nil {
 		return nil, err
 	}
 
-	now := time.Now()
+	now := p.now()
 
 	template := x509.Certificate{
 		SerialNumber:          serial,
 		Subject:               subj,
-		NotBefore:             now.Add(-10 * time.Minute).UTC(),
-		NotAfter:              now.Add(time.Duration(24*365*DefaultExpireYears) * time.Hour).UTC(),
+		NotBefore:             now.Add(-NotBeforeBackdate).UTC(),
+		NotAfter:              now.Add(validityOrDefault(p.caValidity)).UTC(),
 		BasicConstraintsValid: true,
 		IsCA:                  true,
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 	}
+	if p.caMaxPathLen != nil {
+		applyPathLen(&template, *p.caMaxPathLen)
+	}
+	p.caNameConstraints.apply(&template)
+	template.SignatureAlgorithm = p.signatureAlgorithm(&key.PublicKey)
+	tx.sign()
+	if p.hybrid != nil {
+		if err := p.hybridSign(&template, &template, &key.PublicKey, key); err != nil {
+			return nil, err
+		}
+	}
 
-	certificate, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	certificate, err := x509.CreateCertificate(p.rand(), &template, &template, &key.PublicKey, key)
 	if err != nil {
 		return nil, errors.New("can`t generate cert")
 	}
 
 	res := NewX509Pair(
-		pem.EncodeToMemory(&pem.Block{
-			Type:  PEMRSAPrivateKeyBlock,
-			Bytes: x509.MarshalPKCS1PrivateKey(key),
-		}),
+		encodeKey(key),
 		pem.EncodeToMemory(&pem.Block{
 			Type:  PEMCertificateBlock,
 			Bytes: certificate,
 		}),
 		"ca",
 		serial)
-	err = p.Storage.Put(res)
-	if err != nil {
+	if err := p.annotatePair(res); err != nil {
 		return nil, err
 	}
 	return res, nil
@@ -116,44 +291,65 @@ func (p *PKI) NewCa() (*X509Pair, error) {
 
 // NewCert generate new pair signed by last CA key
 func (p *PKI) NewCert(cn string, server bool, groups []string) (*X509Pair, error) {
-	caPair, err := p.GetLastCA()
-	if err != nil {
-		return nil, errors.Wrap(err, "can`t get ca pair")
-	}
-	caKey, caCert, err := caPair.Decode()
-	if err != nil {
-		return nil, errors.Wrap(err, "can`t parse ca pair")
+	if err := p.requireAttestation(); err != nil {
+		return nil, err
 	}
+	return p.issueRequest(CertRequest{CN: cn, Server: server, Groups: groups})
+}
 
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+// SignCSR issue cert for pem encoded CSR signed by last CA key. CSR subject and extensions are ignored,
+// the cert is built as NewCert would do. Returned pair has no key
+func (p *PKI) SignCSR(csrPem []byte, cn string, server bool, groups []string) (*X509Pair, error) {
+	if err := p.requireAttestation(); err != nil {
+		return nil, err
+	}
+	csr, err := decodeCSR(csrPem)
 	if err != nil {
-		return nil, errors.Wrap(err, "can`t create private key")
+		return nil, err
 	}
+	if err := p.checkCSR(csr, cn, ""); err != nil {
+		return nil, err
+	}
+	return p.issueRequest(CertRequest{CN: cn, Server: server, Groups: groups, CSR: csr})
+}
 
-	serial, err := p.serialProvider.Next()
+// decodeCSR parse first certificate request block and check it`s signature
+func decodeCSR(csrPem []byte) (*x509.CertificateRequest, error) {
+	block := findBlock(csrPem, func(blockType string) bool {
+		return blockType == PEMCertificateRequestBlock
+	})
+	if block == nil {
+		return nil, errors.New("can`t parse csr")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "can`t parse csr")
 	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, errors.Wrap(err, "wrong csr signature")
+	}
+	return csr, nil
+}
 
+// certTemplate return client or server leaf template
+func (p *PKI) certTemplate(cn string, req CertRequest) (*x509.Certificate, error) {
 	val, err := asn1.Marshal(asn1.BitString{Bytes: []byte{0x80}, BitLength: 2}) // setting nsCertType to Client Type
 	if err != nil {
 		return nil, errors.Wrap(err, "can not marshal nsCertType")
 	}
 
-	now := time.Now()
-	subj := p.subjTemplate
-	subj.CommonName = cn
+	now := p.now()
+	subj := p.subject(cn, req)
 	tml := x509.Certificate{
-		NotBefore:             now.Add(-10 * time.Minute).UTC(),
-		NotAfter:              now.Add(time.Duration(24*365*99) * time.Hour).UTC(),
-		SerialNumber:          serial,
+		NotBefore:             now.Add(-NotBeforeBackdate).UTC(),
+		NotAfter:              now.Add(validityOrDefault(p.certValidity)).UTC(),
 		Subject:               subj,
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
 		BasicConstraintsValid: true,
 		DNSNames:              []string{cn},
 		IPAddresses:           []net.IP{net.IP{127, 0, 0, 1}},
-		ExcludedDNSDomains:    groups,
+		ExcludedDNSDomains:    req.Groups,
 		ExtraExtensions: []pkix.Extension{
 			{
 				Id:    asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 1, 1},
@@ -162,7 +358,7 @@ func (p *PKI) NewCert(cn string, server bool, groups []string) (*X509Pair, error
 		},
 	}
 
-	if server {
+	if req.Server {
 		tml.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement | x509.KeyUsageKeyEncipherment
 		tml.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
 		val, err := asn1.Marshal(asn1.BitString{Bytes: []byte{0x40}, BitLength: 2}) // setting nsCertType to Server Type
@@ -172,67 +368,263 @@ func (p *PKI) NewCert(cn string, server bool, groups []string) (*X509Pair, error
 		tml.ExtraExtensions[0].Id = asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 1, 1}
 		tml.ExtraExtensions[0].Value = val
 	}
+	return &tml, nil
+}
 
-	// Sign with CA's private key
-	cert, err := x509.CreateCertificate(rand.Reader, &tml, caCert, &key.PublicKey, caKey)
+// issue sign template with last CA key and put pair to storage.
+// New key is generated if pub is nil, otherwise cert for pub is issued and pair is cert only
+func (p *PKI) issue(req CertRequest, tml *x509.Certificate, pub crypto.PublicKey) (*X509Pair, error) {
+	name := AuthOpIssue
+	if pub != nil {
+		name = AuthOpSign
+	}
+	span := p.startSpan(name, attribute.String("easyrsa.cn", req.CN))
+	res, err := p.issueCert(req, tml, pub)
+	if err == nil {
+		span.SetAttributes(spanSerial(res.Serial))
+	}
+	endSpan(span, err)
+	return res, err
+}
+
+func (p *PKI) issueCert(req CertRequest, tml *x509.Certificate, pub crypto.PublicKey) (*X509Pair, error) {
+	cn, metadata := req.CN, req.Metadata
+	if err := p.checkBlocked(cn); err != nil {
+		return nil, err
+	}
+	if err := p.checkDuplicateCN(cn, dualStackPeer(metadata)); err != nil {
+		return nil, err
+	}
+	if err := p.checkLimits(cn); err != nil {
+		return nil, err
+	}
+	if err := p.checkTrustedTime(); err != nil {
+		return nil, err
+	}
+	if err := p.checkDNSPolicy(tml.DNSNames); err != nil {
+		return nil, err
+	}
+	caPair, err := p.GetLastCA()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get ca pair")
+	}
+	caKey, caCert, err := p.decodeCA(caPair)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t parse ca pair")
+	}
+	defer ZeroKey(caKey)
+	if caKey == nil {
+		return nil, errors.New("ca pair has no private key")
+	}
+	if err := p.checkFIPS(caCert); err != nil {
+		return nil, err
+	}
+	if len(caPair.ChainPemBytes) == 0 && !isSelfSigned(caCert) {
+		if err := p.ResolveChain(caPair); err != nil {
+			return nil, errors.Wrap(err, "can`t resolve ca chain")
+		}
+	}
+	if err := p.clampValidity(cn, tml, caCert); err != nil {
+		return nil, err
+	}
+	if err := checkCAConstraints(tml, caCert); err != nil {
+		return nil, err
+	}
+
+	var keyPem []byte
+	if pub == nil {
+		key, err := p.generateRequestKey(req.KeyAlgorithm)
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t create private key")
+		}
+		defer zeroSigner(key)
+		if keyPem, err = encodeSigner(key); err != nil {
+			return nil, err
+		}
+		pub = key.Public()
+		// RFC 5480 forbid key encipherment for EC keys
+		if _, ok := pub.(*ecdsa.PublicKey); ok {
+			tml.KeyUsage &^= x509.KeyUsageKeyEncipherment
+		}
+	} else if p.FIPSMode() {
+		if err := checkFIPSPublicKey(pub); err != nil {
+			return nil, err
+		}
+	}
+
+	// CRLs get key id of the signer as authority key id, crypto/x509 set it for CAs only
+	if len(tml.SubjectKeyId) == 0 && tml.KeyUsage&x509.KeyUsageCRLSign != 0 {
+		if tml.SubjectKeyId, err = subjectKeyID(pub); err != nil {
+			return nil, err
+		}
+	}
+
+	tx := &transaction{}
+	serial, err := p.reserveSerial(tx)
 	if err != nil {
-		return nil, errors.Wrap(err, "certificate cannot be created")
+		return nil, err
+	}
+	tml.SerialNumber = serial
+	if tml.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+		tml.SignatureAlgorithm = p.signatureAlgorithm(&caKey.PublicKey)
+	}
+	if p.crlPartitions > 0 {
+		tml.CRLDistributionPoints = []string{p.crlPartitionURL(p.crlPartition(serial))}
+	}
+	if err := p.runSignHooks(tml, req, caCert); err != nil {
+		return nil, tx.rollback(err)
+	}
+	tx.sign()
+	if p.hybrid != nil {
+		if err := p.hybridSign(tml, caCert, pub, caKey); err != nil {
+			return nil, tx.rollback(err)
+		}
+	}
+	if len(p.ctLogs) > 0 {
+		if err := p.embedSCTs(tml, caPair, caCert, pub, caKey); err != nil {
+			return nil, tx.rollback(err)
+		}
 	}
 
-	priKeyPem := pem.EncodeToMemory(&pem.Block{
-		Type:  PEMRSAPrivateKeyBlock,
-		Bytes: x509.MarshalPKCS1PrivateKey(key),
-	})
+	// Sign with CA's private key
+	cert, err := x509.CreateCertificate(p.rand(), tml, caCert, pub, caKey)
+	if err != nil {
+		return nil, tx.rollback(errors.Wrap(err, "certificate cannot be created"))
+	}
 
 	certPem := pem.EncodeToMemory(&pem.Block{
 		Type:  PEMCertificateBlock,
 		Bytes: cert,
 	})
 
-	res := NewX509Pair(priKeyPem, certPem, cn, serial)
+	res := NewX509Pair(keyPem, certPem, cn, serial)
+	res.Metadata = metadata
+	res.ChainPemBytes = append(append([]byte{}, caPair.CertPemBytes...), caPair.ChainPemBytes...)
+	if err := p.annotatePair(res); err != nil {
+		return nil, tx.rollback(err)
+	}
 
-	err = p.Storage.Put(res)
-	if err != nil {
-		return nil, err
+	if err := p.storePair(tx, res); err != nil {
+		return nil, tx.rollback(err)
 	}
-	return res, nil
+	p.indexKey(cn, serial, pub)
+	p.auditIssue(res, keyPem == nil)
+	p.supersede(res)
+	return p.result(res), nil
 }
 
-// GetCRL return current revoke list
+// clampValidity cap NotAfter of template at issuer NotAfter, chain would fail validation after issuer expire
+func (p *PKI) clampValidity(cn string, tml *x509.Certificate, issuer *x509.Certificate) error {
+	if !tml.NotAfter.After(issuer.NotAfter) {
+		return nil
+	}
+	if p.strictValidity {
+		return errors.Errorf("requested not after %s is later than ca not after %s",
+			tml.NotAfter.Format(time.RFC3339), issuer.NotAfter.Format(time.RFC3339))
+	}
+	if p.onClamp != nil {
+		p.onClamp(cn, tml.NotAfter, issuer.NotAfter)
+	}
+	tml.NotAfter = issuer.NotAfter
+	return nil
+}
+
+// result strip key from just stored pair if PKI configured WithoutKeyRetention
+func (p *PKI) result(pair *X509Pair) *X509Pair {
+	if !p.dropKeys {
+		return pair
+	}
+	res := NewX509Pair(nil, pair.CertPemBytes, pair.CN, pair.Serial)
+	res.Metadata = pair.Metadata
+	return res
+}
+
+// encodeKey pem encode rsa key and zero intermediate der bytes
+func encodeKey(key *rsa.PrivateKey) []byte {
+	der := x509.MarshalPKCS1PrivateKey(key)
+	defer zeroBytes(der)
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  PEMRSAPrivateKeyBlock,
+		Bytes: der,
+	})
+}
+
+// GetCRL return current revoke list, signed list must be signed by one of stored CAs
 func (p *PKI) GetCRL() (*pkix.CertificateList, error) {
-	return p.crlHolder.Get()
+	cached, gen := p.cachedCRL()
+	if cached != nil {
+		return cached, nil
+	}
+	list, err := p.crlHolder.Get()
+	if err != nil {
+		return nil, err
+	}
+	if len(list.SignatureValue.Bytes) != 0 {
+		if err := p.verifyCRL(list); err != nil {
+			return nil, err
+		}
+	}
+	p.cacheCRL(list, gen)
+	if p.crlFailure != nil && p.crlFailure.Mode == CRLUseCached {
+		p.rememberCRL(list)
+	}
+	return list, nil
 }
 
 // GetLastCA return last CA pair
 func (p *PKI) GetLastCA() (*X509Pair, error) {
-	return p.Storage.GetLastByCn("ca")
+	cached, gen := p.cachedCA()
+	if cached != nil {
+		return cached, nil
+	}
+	ca, err := p.Storage.GetLastByCn("ca")
+	if err != nil {
+		return nil, err
+	}
+	p.cacheCA(ca, gen)
+	return ca, nil
+}
+
+// validityOrDefault return validity or DefaultExpireYears
+func validityOrDefault(validity time.Duration) time.Duration {
+	if validity <= 0 {
+		return time.Duration(24*365*DefaultExpireYears) * time.Hour
+	}
+	return validity
+}
+
+// nextSerial take serial from provider, file based providers are not safe for concurrent use within process
+func (p *PKI) nextSerial() (*big.Int, error) {
+	p.serialMu.Lock()
+	defer p.serialMu.Unlock()
+	return p.serialProvider.Next()
 }
 
 // RevokeOne revoke one pair with serial
 func (p *PKI) RevokeOne(serial *big.Int) error {
-	list := make([]pkix.RevokedCertificate, 0)
-	if oldList, err := p.GetCRL(); err == nil {
-		list = oldList.TBSCertList.RevokedCertificates
-	}
-	caPairs, err := p.Storage.GetByCN("ca")
-	if err != nil {
-		return errors.Wrap(err, "can`t get ca certs for signing crl")
+	return p.Revoke(serial, "", "")
+}
+
+// signCRL sign list with newest CA key and put it to crl holder, pem encoded CRL is returned
+func (p *PKI) signCRL(list []pkix.RevokedCertificate) ([]byte, error) {
+	span := p.startSpan("crl.sign", attribute.Int("easyrsa.entries", len(list)))
+	res, err := p.signCRLList(list)
+	endSpan(span, err)
+	return res, err
+}
+
+func (p *PKI) signCRLList(list []pkix.RevokedCertificate) ([]byte, error) {
+	if err := p.checkTrustedTime(); err != nil {
+		return nil, err
 	}
-	sort.Slice(caPairs, func(i, j int) bool {
-		return caPairs[i].Serial.Cmp(caPairs[j].Serial) == 1
-	})
-	caKey, caCert, err := caPairs[0].Decode()
+	caKey, caCert, err := p.crlSigner(list)
 	if err != nil {
-		return errors.Wrap(err, "can`t decode ca certs for signing crl")
+		return nil, err
 	}
-	list = append(list, pkix.RevokedCertificate{
-		SerialNumber:   serial,
-		RevocationTime: time.Now(),
-	})
-	crlBytes, err := caCert.CreateCRL(
-		rand.Reader, caKey, removeDups(list), time.Now(), time.Now().Add(99*365*24*time.Hour))
+	defer ZeroKey(caKey)
+	crlBytes, err := p.createCRL(caKey, caCert, removeDups(list))
 	if err != nil {
-		return errors.Wrap(err, "can`t create crl")
+		return nil, errors.Wrap(err, "can`t create crl")
 	}
 	crlPem := pem.EncodeToMemory(&pem.Block{
 		Type:  PEMx509CRLBlock,
@@ -240,9 +632,41 @@ func (p *PKI) RevokeOne(serial *big.Int) error {
 	})
 	err = p.crlHolder.Put(crlPem)
 	if err != nil {
-		return errors.Wrap(err, "can`t put new crl")
+		return nil, errors.Wrap(err, "can`t put new crl")
 	}
-	return nil
+	p.invalidateCache()
+	p.publishCRL(crlPem)
+	return crlPem, nil
+}
+
+// crlSigner return key and cert of delegated CRL signer not listed in revoked or newest CA for signing CRL
+// of revoked, key must be zeroed after use
+func (p *PKI) crlSigner(revoked []pkix.RevokedCertificate) (*rsa.PrivateKey, *x509.Certificate, error) {
+	if err := p.requireLeader(); err != nil {
+		return nil, nil, err
+	}
+	if key, cert, err := p.delegatedCRLSigner(revoked); err != nil || key != nil {
+		return key, cert, err
+	}
+	caPairs, err := p.Storage.GetByCN("ca")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can`t get ca certs for signing crl")
+	}
+	sort.Slice(caPairs, func(i, j int) bool {
+		return caPairs[i].Serial.Cmp(caPairs[j].Serial) == 1
+	})
+	caKey, caCert, err := p.decodeCA(caPairs[0])
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can`t decode ca certs for signing crl")
+	}
+	if caKey == nil {
+		return nil, nil, errors.New("ca pair has no private key")
+	}
+	if err := p.checkFIPS(caCert); err != nil {
+		ZeroKey(caKey)
+		return nil, nil, err
+	}
+	return caKey, caCert, nil
 }
 
 // RevokeAllByCN revoke all pairs with common name
@@ -260,9 +684,13 @@ func (p *PKI) RevokeAllByCN(cn string) error {
 	return nil
 }
 
-// IsRevoked return true if it`s revoked serial
+// IsRevoked return true if it`s revoked serial. Unavailable CRL is handled by CRLFailurePolicy,
+// nothing is revoked without policy
 func (p *PKI) IsRevoked(serial *big.Int) bool {
-	revokedCerts, err := p.GetCRL()
+	revokedCerts, err := p.revocationList()
+	if err != nil && p.crlFailure != nil {
+		return true
+	}
 	if err != nil {
 		revokedCerts = &pkix.CertificateList{}
 	}
@@ -275,12 +703,12 @@ func (p *PKI) IsRevoked(serial *big.Int) bool {
 }
 
 func removeDups(list []pkix.RevokedCertificate) []pkix.RevokedCertificate {
-	encountered := map[int64]bool{}
+	encountered := map[string]bool{}
 	result := make([]pkix.RevokedCertificate, 0)
 	for _, cert := range list {
-		if !encountered[cert.SerialNumber.Int64()] {
+		if !encountered[cert.SerialNumber.Text(16)] {
 			result = append(result, cert)
-			encountered[cert.SerialNumber.Int64()] = true
+			encountered[cert.SerialNumber.Text(16)] = true
 		}
 	}
 	return result
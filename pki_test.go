@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/prometheus/common/log"
 	"github.com/stretchr/testify/assert"
@@ -86,14 +87,14 @@ func TestPKI_newCert(t *testing.T) {
 	})
 }
 
-func getTmpPki() (*PKI, func()) {
+func getTmpPki(opts ...Option) (*PKI, func()) {
 	_ = os.MkdirAll(testData, 0777)
 	storDir, err := filepath.Abs(testData)
 	_ = os.MkdirAll(storDir, 0777)
 	storage := NewDirKeyStorage(storDir)
 	serialProvider := NewFileSerialProvider(filepath.Join(storDir, "serial"))
 	crlHolder := NewFileCRLHolder(filepath.Join(storDir, "crl.pem"))
-	pki := NewPKI(storage, serialProvider, crlHolder, pkix.Name{})
+	pki := NewPKI(storage, serialProvider, crlHolder, pkix.Name{}, opts...)
 	if err != nil {
 		log.Fatalln("can`t create pki")
 	}
@@ -225,3 +226,92 @@ func TestPKI_NewCert1(t *testing.T) {
 		assert.Equal(t, *groups, []string{"group1,group2"})
 	})
 }
+
+func TestPKI_clampValidity(t *testing.T) {
+	t.Run("clamp", func(t *testing.T) {
+		clamped := false
+		pki, cleanup := getTmpPki(WithClampWarning(func(cn string, requested, notAfter time.Time) {
+			clamped = true
+		}))
+		defer cleanup()
+		ca, _ := pki.NewCa()
+		_, caCert, _ := ca.Decode()
+		pair, err := pki.NewCert("client", false, []string{""})
+		assert.NoError(t, err)
+		_, cert, _ := pair.Decode()
+		assert.True(t, clamped)
+		assert.False(t, cert.NotAfter.After(caCert.NotAfter))
+	})
+	t.Run("strict", func(t *testing.T) {
+		pki, cleanup := getTmpPki(WithStrictValidity())
+		defer cleanup()
+		_, _ = pki.NewCa()
+		_, err := pki.NewCert("client", false, []string{""})
+		assert.Error(t, err)
+	})
+}
+
+func TestX509Pair_Validate(t *testing.T) {
+	good := getTestPair("good", 1)
+	other := getTestPair("other", 2)
+	tests := []struct {
+		name    string
+		pair    *X509Pair
+		wantErr bool
+	}{
+		{name: "good", pair: good, wantErr: false},
+		{name: "broken key", pair: NewX509Pair([]byte("keybytes"), good.CertPemBytes, "good", big.NewInt(1)), wantErr: true},
+		{name: "broken cert", pair: NewX509Pair(good.KeyPemBytes, []byte("certbytes"), "good", big.NewInt(1)), wantErr: true},
+		{name: "key mismatch", pair: NewX509Pair(other.KeyPemBytes, good.CertPemBytes, "good", big.NewInt(1)), wantErr: true},
+		{name: "cn mismatch", pair: NewX509Pair(good.KeyPemBytes, good.CertPemBytes, "other", big.NewInt(1)), wantErr: true},
+		{name: "serial mismatch", pair: NewX509Pair(good.KeyPemBytes, good.CertPemBytes, "good", big.NewInt(2)), wantErr: true},
+		{name: "empty serial", pair: NewX509Pair(good.KeyPemBytes, good.CertPemBytes, "good", nil), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.pair.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("X509Pair.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestX509Pair_DecodeCertOnly(t *testing.T) {
+	full := getTestPair("cert_only", 1)
+	pair := NewX509Pair(nil, full.CertPemBytes, "cert_only", big.NewInt(1))
+	key, cert, err := pair.Decode()
+	assert.NoError(t, err)
+	assert.Nil(t, key)
+	assert.Equal(t, "cert_only", cert.Subject.CommonName)
+	assert.NoError(t, pair.Validate())
+}
+
+func TestPKI_NewCertCertOnlyCA(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	ca, _ := pki.NewCa()
+	_ = pki.Storage.Put(NewX509Pair(nil, ca.CertPemBytes, "ca", ca.Serial))
+	_, err := pki.NewCert("client", false, []string{""})
+	assert.Error(t, err)
+	assert.Error(t, pki.RevokeOne(big.NewInt(42)))
+}
+
+func TestPKI_SignCSR(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	_, _ = pki.NewCa()
+	pair, err := pki.SignCSR(newTestCSR(t, "csr subject"), "server", true, nil)
+	assert.NoError(t, err)
+	assert.False(t, pair.HasKey())
+	assert.Equal(t, "server", pair.CN)
+	_, cert, err := pair.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, "server", cert.Subject.CommonName)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, cert.ExtKeyUsage)
+	stored, err := pki.Storage.GetBySerial(pair.Serial)
+	assert.NoError(t, err)
+	assert.False(t, stored.HasKey())
+
+	_, err = pki.SignCSR([]byte("csr"), "broken", false, nil)
+	assert.Error(t, err)
+}
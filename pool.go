@@ -0,0 +1,53 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// CAFilter select CA certs for FilteredCACertPool
+type CAFilter func(ca *x509.Certificate) bool
+
+// CACertPool return pool of all valid stored CA generations, intermediates and trust anchors,
+// so verifiers accept certs of old and new CA during rotation
+func (p *PKI) CACertPool() (*x509.CertPool, error) {
+	return p.FilteredCACertPool(nil)
+}
+
+// FilteredCACertPool return pool of valid stored CA certs accepted by filter, all of them if filter is nil.
+// Error is returned if no CA is selected
+func (p *PKI) FilteredCACertPool(filter CAFilter) (*x509.CertPool, error) {
+	cas, _, err := p.validCACerts(filter)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	for _, ca := range cas {
+		pool.AddCert(ca)
+	}
+	return pool, nil
+}
+
+// validCACerts return stored CA certs valid now and accepted by filter with their pem, NotExist if none
+func (p *PKI) validCACerts(filter CAFilter) ([]*x509.Certificate, map[*x509.Certificate][]byte, error) {
+	cas, caPems, err := p.caCerts()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := p.now()
+	res := make([]*x509.Certificate, 0, len(cas))
+	for _, ca := range cas {
+		if !ca.IsCA || now.Before(ca.NotBefore) || now.After(ca.NotAfter) {
+			continue
+		}
+		if filter != nil && !filter(ca) {
+			continue
+		}
+		res = append(res, ca)
+	}
+	if len(res) == 0 {
+		return nil, nil, errors.WithStack(NewNotExist("no valid ca selected"))
+	}
+	return res, caPems, nil
+}
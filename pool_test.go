@@ -0,0 +1,54 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_CACertPool(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.CACertPool()
+	assert.Error(t, err)
+
+	oldCA, err := pki.NewCa()
+	assert.NoError(t, err)
+	oldLeaf, err := pki.NewCert("old", true, nil)
+	assert.NoError(t, err)
+	newCA, err := pki.NewCa()
+	assert.NoError(t, err)
+	newLeaf, err := pki.NewCert("new", true, nil)
+	assert.NoError(t, err)
+
+	verify := func(pool *x509.CertPool, pair *X509Pair) error {
+		cert, err := decodeCert(pair.CertPemBytes)
+		assert.NoError(t, err)
+		_, err = cert.Verify(x509.VerifyOptions{Roots: pool, CurrentTime: pki.now()})
+		return err
+	}
+
+	pool, err := pki.CACertPool()
+	assert.NoError(t, err)
+	assert.NoError(t, verify(pool, oldLeaf))
+	assert.NoError(t, verify(pool, newLeaf))
+
+	_, newCert, err := newCA.Decode()
+	assert.NoError(t, err)
+	onlyNew, err := pki.FilteredCACertPool(func(ca *x509.Certificate) bool {
+		return bytes.Equal(ca.Raw, newCert.Raw)
+	})
+	assert.NoError(t, err)
+	assert.Error(t, verify(onlyNew, oldLeaf))
+	assert.NoError(t, verify(onlyNew, newLeaf))
+
+	// expired generations are not trusted
+	_, oldCert, err := oldCA.Decode()
+	assert.NoError(t, err)
+	pki.clock = func() time.Time { return oldCert.NotAfter.Add(time.Hour) }
+	_, err = pki.CACertPool()
+	assert.Error(t, err)
+}
@@ -0,0 +1,219 @@
+package easyrsa
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultChallengeTTL is a lifetime of challenges returned by NewCSRChallenge
+const DefaultChallengeTTL = 15 * time.Minute
+
+var oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+
+// CSRPolicy configure key and proof of possession checks of signed CSRs, CSR signature is always checked
+type CSRPolicy struct {
+	MinRSABits       int                       // smaller RSA keys are rejected, 2048 if zero
+	MinECBits        int                       // smaller curves are rejected, 256 if zero
+	WeakKeys         WeakKeys                  // known weak keys, e.g. Debian openssl blocklist
+	RejectReusedKeys bool                      // reject public keys of certs already in storage
+	ReusedKeys       KeyFindingAction          // action on public keys of certs of other CNs, superseded by RejectReusedKeys
+	ROCAKeys         KeyFindingAction          // action on RSA keys of vulnerable Infineon generator, CVE-2017-15361
+	OnKeyFinding     func(finding *KeyFinding) // called for findings with KeyFindingWarn action
+	RequireChallenge bool                      // CSR challengePassword must be a nonce from NewCSRChallenge for the cn, ignored with enrollment tokens
+	ChallengeTTL     time.Duration             // DefaultChallengeTTL if zero
+}
+
+// WithCSRPolicy check CSRs of SignCSR and its variants with policy
+func WithCSRPolicy(policy *CSRPolicy) Option {
+	return func(p *PKI) {
+		p.csrPolicy = policy
+	}
+}
+
+// csrChallenges keep outstanding challenges by nonce
+type csrChallenges struct {
+	mu      sync.Mutex
+	pending map[string]csrChallenge
+}
+
+type csrChallenge struct {
+	cn      string
+	expires time.Time
+}
+
+// NewCSRChallenge return one time nonce the requester should put to challengePassword of CSR for cn.
+// CSR is signed by the requester key, so the nonce prove possession of the key for this request
+func (p *PKI) NewCSRChallenge(cn string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", errors.Wrap(err, "can`t generate challenge")
+	}
+	nonce := hex.EncodeToString(b)
+	ttl := DefaultChallengeTTL
+	if p.csrPolicy != nil && p.csrPolicy.ChallengeTTL > 0 {
+		ttl = p.csrPolicy.ChallengeTTL
+	}
+	now := p.now()
+	c := &p.challenges
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		c.pending = make(map[string]csrChallenge)
+	}
+	for key, pending := range c.pending {
+		if now.After(pending.expires) {
+			delete(c.pending, key)
+		}
+	}
+	c.pending[nonce] = csrChallenge{cn: cn, expires: now.Add(ttl)}
+	return nonce, nil
+}
+
+// checkCSR apply CSRPolicy and enrollment token or challenge check to decoded CSR for cn and profile,
+// PolicyViolation is returned for rejected CSR
+func (p *PKI) checkCSR(csr *x509.CertificateRequest, cn, profile string) error {
+	if err := p.checkCSRKey(csr, cn); err != nil {
+		return err
+	}
+	if p.enrollmentTokens != nil {
+		return p.consumeEnrollmentToken(csr, cn, profile)
+	}
+	if p.csrPolicy != nil && p.csrPolicy.RequireChallenge {
+		nonce, err := challengePassword(csr)
+		if err != nil {
+			return err
+		}
+		if !p.consumeChallenge(nonce, cn) {
+			return errors.WithStack(NewPolicyViolation("csr challenge is missing, expired or issued for other cn"))
+		}
+	}
+	return nil
+}
+
+// checkCSRKey apply key checks of CSRPolicy, it`s the only check of CSRs authenticated by current cert
+func (p *PKI) checkCSRKey(csr *x509.CertificateRequest, cn string) error {
+	policy := p.csrPolicy
+	if policy == nil {
+		return nil
+	}
+	if err := policy.checkKey(csr.PublicKey); err != nil {
+		return errors.WithStack(NewPolicyViolation(err.Error()))
+	}
+	return p.checkKeyFindings(csr.PublicKey, cn)
+}
+
+func (p *PKI) consumeChallenge(nonce, cn string) bool {
+	c := &p.challenges
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pending, ok := c.pending[nonce]
+	if !ok || nonce == "" {
+		return false
+	}
+	delete(c.pending, nonce)
+	return pending.cn == cn && !p.now().After(pending.expires)
+}
+
+func (policy *CSRPolicy) checkKey(pub interface{}) error {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		min := policy.MinRSABits
+		if min == 0 {
+			min = 2048
+		}
+		if key.N.BitLen() < min {
+			return errors.Errorf("rsa key size %d is less than %d", key.N.BitLen(), min)
+		}
+		if key.E < 65537 {
+			return errors.Errorf("rsa public exponent %d is too small", key.E)
+		}
+	case *ecdsa.PublicKey:
+		min := policy.MinECBits
+		if min == 0 {
+			min = 256
+		}
+		if size := key.Curve.Params().BitSize; size < min {
+			return errors.Errorf("ec key size %d is less than %d", size, min)
+		}
+	}
+	if policy.WeakKeys.Contains(pub) {
+		return errors.New("key is known weak key")
+	}
+	return nil
+}
+
+// challengePassword return PKCS #9 challengePassword attribute of CSR
+func challengePassword(csr *x509.CertificateRequest) (string, error) {
+	var tbs struct {
+		Raw           asn1.RawContent
+		Version       int
+		Subject       asn1.RawValue
+		PublicKey     asn1.RawValue
+		RawAttributes []asn1.RawValue `asn1:"tag:0"`
+	}
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		return "", errors.Wrap(err, "can`t parse csr attributes")
+	}
+	for _, raw := range tbs.RawAttributes {
+		var attr struct {
+			Type   asn1.ObjectIdentifier
+			Values []asn1.RawValue `asn1:"set"`
+		}
+		if _, err := asn1.Unmarshal(raw.FullBytes, &attr); err != nil || !attr.Type.Equal(oidChallengePassword) {
+			continue
+		}
+		if len(attr.Values) > 0 {
+			return string(attr.Values[0].Bytes), nil
+		}
+	}
+	return "", errors.WithStack(NewPolicyViolation("csr has no challenge password"))
+}
+
+// WeakKeys is a set of openssl-vulnkey fingerprints, last 20 hex chars of sha1 of "Modulus=<HEX>\n"
+type WeakKeys map[string]struct{}
+
+// LoadWeakKeys read openssl-blacklist file, e.g. /usr/share/openssl-blacklist/blacklist.RSA-2048.
+// Several files can be loaded to the same set
+func LoadWeakKeys(r io.Reader, keys WeakKeys) (WeakKeys, error) {
+	if keys == nil {
+		keys = make(WeakKeys)
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys[strings.ToLower(line)] = struct{}{}
+	}
+	return keys, errors.Wrap(scanner.Err(), "can`t read weak keys")
+}
+
+// Contains return true if pub is RSA key listed in the set
+func (w WeakKeys) Contains(pub interface{}) bool {
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok || len(w) == 0 {
+		return false
+	}
+	_, ok = w[WeakKeyFingerprint(key)]
+	return ok
+}
+
+// WeakKeyFingerprint return openssl-vulnkey fingerprint of RSA key
+func WeakKeyFingerprint(key *rsa.PublicKey) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("Modulus=%X\n", key.N)))
+	return hex.EncodeToString(sum[:])[20:]
+}
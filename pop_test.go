@@ -0,0 +1,120 @@
+package easyrsa
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// newChallengeCSR return ecdsa CSR with challengePassword attribute, crypto/x509 can`t create it
+func newChallengeCSR(t *testing.T, cn, challenge string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	subject, err := asn1.Marshal(pkix.Name{CommonName: cn}.ToRDNSequence())
+	assert.NoError(t, err)
+	spki, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+	attr, err := asn1.Marshal(struct {
+		Type   asn1.ObjectIdentifier
+		Values []asn1.RawValue `asn1:"set"`
+	}{oidChallengePassword, []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(challenge)}}})
+	assert.NoError(t, err)
+	tbs, err := asn1.Marshal(struct {
+		Version       int
+		Subject       asn1.RawValue
+		PublicKey     asn1.RawValue
+		RawAttributes []asn1.RawValue `asn1:"tag:0"`
+	}{0, asn1.RawValue{FullBytes: subject}, asn1.RawValue{FullBytes: spki}, []asn1.RawValue{{FullBytes: attr}}})
+	assert.NoError(t, err)
+	digest := sha256.Sum256(tbs)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	assert.NoError(t, err)
+	der, err := asn1.Marshal(struct {
+		TBS       asn1.RawValue
+		Algorithm pkix.AlgorithmIdentifier
+		Signature asn1.BitString
+	}{asn1.RawValue{FullBytes: tbs}, pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		asn1.BitString{Bytes: sig, BitLength: len(sig) * 8}})
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: PEMCertificateRequestBlock, Bytes: der})
+}
+
+func newRSACSR(t *testing.T, key *rsa.PrivateKey, cn string) []byte {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}}, key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: PEMCertificateRequestBlock, Bytes: der})
+}
+
+func isPolicyViolation(err error) bool {
+	_, ok := errors.Cause(err).(*PolicyViolation)
+	return ok
+}
+
+func TestPKI_CSRPolicy(t *testing.T) {
+	weakKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	weakKeys, err := LoadWeakKeys(strings.NewReader("# blocklist\n"+WeakKeyFingerprint(&weakKey.PublicKey)+"\n"), nil)
+	assert.NoError(t, err)
+
+	policy := &CSRPolicy{WeakKeys: weakKeys, RejectReusedKeys: true}
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithCSRPolicy(policy))
+	defer cleanup()
+	_, err = pki.NewCa()
+	assert.NoError(t, err)
+
+	t.Run("keys", func(t *testing.T) {
+		small, err := rsa.GenerateKey(rand.Reader, 1024)
+		assert.NoError(t, err)
+		_, err = pki.SignCSR(newRSACSR(t, small, "small"), "small", false, nil)
+		assert.True(t, isPolicyViolation(err))
+		_, err = pki.SignCSR(newRSACSR(t, weakKey, "weak"), "weak", false, nil)
+		assert.True(t, isPolicyViolation(err))
+
+		csrPem := newTestCSR(t, "reuse")
+		_, err = pki.SignCSR(csrPem, "reuse", false, nil)
+		assert.NoError(t, err)
+		_, err = pki.SignCSRWithProfile(csrPem, "other", "missing")
+		assert.Error(t, err)
+		_, err = pki.SignCSR(csrPem, "other", false, nil)
+		assert.True(t, isPolicyViolation(err))
+	})
+
+	t.Run("challenge", func(t *testing.T) {
+		policy.RequireChallenge = true
+		defer func() { policy.RequireChallenge = false }()
+		_, err := pki.SignCSR(newTestCSR(t, "dev"), "dev", false, nil)
+		assert.True(t, isPolicyViolation(err))
+
+		nonce, err := pki.NewCSRChallenge("dev")
+		assert.NoError(t, err)
+		_, err = pki.SignCSR(newChallengeCSR(t, "other", nonce), "other", false, nil)
+		assert.True(t, isPolicyViolation(err))
+
+		nonce, err = pki.NewCSRChallenge("dev")
+		assert.NoError(t, err)
+		_, err = pki.SignCSR(newChallengeCSR(t, "dev", nonce), "dev", false, nil)
+		assert.NoError(t, err)
+		// one time
+		_, err = pki.SignCSR(newChallengeCSR(t, "dev", nonce), "dev", false, nil)
+		assert.True(t, isPolicyViolation(err))
+
+		nonce, err = pki.NewCSRChallenge("dev")
+		assert.NoError(t, err)
+		pki.clock = func() time.Time { return time.Now().Add(DefaultChallengeTTL + time.Minute) }
+		defer func() { pki.clock = nil }()
+		_, err = pki.SignCSR(newChallengeCSR(t, "dev", nonce), "dev", false, nil)
+		assert.True(t, isPolicyViolation(err))
+	})
+}
@@ -0,0 +1,119 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Profile describe leaf extensions applied on issuance instead of built-in client and server templates
+type Profile struct {
+	Name                  string                  // profile name used by NewCertWithProfile
+	Validity              time.Duration           // cert lifetime as NewCert if zero, clamped to CA NotAfter
+	IsCA                  bool                    // basicConstraints CA:TRUE
+	MaxPathLen            int                     // basicConstraints pathlen, see x509.Certificate
+	MaxPathLenZero        bool                    // pathlen:0 is set explicitly
+	NameConstraints       *NameConstraints        // nameConstraints of CA profiles
+	KeyUsage              x509.KeyUsage           // keyUsage
+	ExtKeyUsage           []x509.ExtKeyUsage      // extendedKeyUsage
+	UnknownExtKeyUsage    []asn1.ObjectIdentifier // extendedKeyUsage OIDs unknown to crypto/x509
+	DNSNames              []string                // static subjectAltName entries, cn is used as DNS name if no SAN set
+	IPAddresses           []net.IP                // static subjectAltName entries
+	EmailAddresses        []string                // static subjectAltName entries
+	URIs                  []*url.URL              // static subjectAltName entries
+	CRLDistributionPoints []string                // crlDistributionPoints URIs
+	OCSPServer            []string                // authorityInfoAccess OCSP URIs
+	IssuingCertificateURL []string                // authorityInfoAccess caIssuers URIs
+	PolicyIdentifiers     []asn1.ObjectIdentifier // certificatePolicies
+	ExtraExtensions       []pkix.Extension        // other extensions copied as is
+	SignatureAlgorithm    x509.SignatureAlgorithm // e.g. x509.SHA256WithRSAPSS for profiles mandating PSS, chosen by CA key if zero
+}
+
+// WithProfiles register profiles for NewCertWithProfile and SignCSRWithProfile
+func WithProfiles(profiles ...*Profile) Option {
+	return func(p *PKI) {
+		if p.profiles == nil {
+			p.profiles = make(map[string]*Profile)
+		}
+		for _, profile := range profiles {
+			p.profiles[profile.Name] = profile
+		}
+	}
+}
+
+// Profile return registered profile by name
+func (p *PKI) Profile(name string) (*Profile, error) {
+	profile, ok := p.profiles[name]
+	if !ok {
+		return nil, NewNotExist(fmt.Sprintf("profile %s is not registered", name))
+	}
+	return profile, nil
+}
+
+// NewCertWithProfile create new key and cert for cn with extensions of registered profile
+func (p *PKI) NewCertWithProfile(cn, profile string) (*X509Pair, error) {
+	if err := p.requireAttestation(); err != nil {
+		return nil, err
+	}
+	return p.issueRequest(CertRequest{CN: cn, Profile: profile})
+}
+
+// SignCSRWithProfile sign CSR public key for cn with extensions of registered profile, returned pair has no key
+func (p *PKI) SignCSRWithProfile(csrPem []byte, cn, profile string) (*X509Pair, error) {
+	if err := p.requireAttestation(); err != nil {
+		return nil, err
+	}
+	if _, err := p.Profile(profile); err != nil {
+		return nil, err
+	}
+	csr, err := decodeCSR(csrPem)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkCSR(csr, cn, profile); err != nil {
+		return nil, err
+	}
+	return p.issueRequest(CertRequest{CN: cn, Profile: profile, CSR: csr})
+}
+
+// profileTemplate return cert template with profile extensions
+func (p *PKI) profileTemplate(cn string, prof *Profile, req CertRequest) *x509.Certificate {
+	now := p.now()
+	validity := prof.Validity
+	if validity <= 0 {
+		validity = validityOrDefault(p.certValidity)
+	}
+	tml := &x509.Certificate{
+		NotBefore:             now.Add(-NotBeforeBackdate).UTC(),
+		NotAfter:              now.Add(validity).UTC(),
+		Subject:               p.subject(cn, req),
+		BasicConstraintsValid: true,
+		IsCA:                  prof.IsCA,
+		MaxPathLen:            prof.MaxPathLen,
+		MaxPathLenZero:        prof.MaxPathLenZero,
+		KeyUsage:              prof.KeyUsage,
+		ExtKeyUsage:           append([]x509.ExtKeyUsage{}, prof.ExtKeyUsage...),
+		UnknownExtKeyUsage:    append([]asn1.ObjectIdentifier{}, prof.UnknownExtKeyUsage...),
+		DNSNames:              append([]string{}, prof.DNSNames...),
+		IPAddresses:           append([]net.IP{}, prof.IPAddresses...),
+		EmailAddresses:        append([]string{}, prof.EmailAddresses...),
+		URIs:                  append([]*url.URL{}, prof.URIs...),
+		CRLDistributionPoints: append([]string{}, prof.CRLDistributionPoints...),
+		OCSPServer:            append([]string{}, prof.OCSPServer...),
+		IssuingCertificateURL: append([]string{}, prof.IssuingCertificateURL...),
+		PolicyIdentifiers:     append([]asn1.ObjectIdentifier{}, prof.PolicyIdentifiers...),
+		ExtraExtensions:       append([]pkix.Extension{}, prof.ExtraExtensions...),
+		SignatureAlgorithm:    prof.SignatureAlgorithm,
+	}
+	if prof.IsCA {
+		prof.NameConstraints.apply(tml)
+	}
+	if len(tml.DNSNames)+len(tml.IPAddresses)+len(tml.EmailAddresses)+len(tml.URIs) == 0 && !prof.IsCA {
+		tml.DNSNames = []string{cn}
+	}
+	return tml
+}
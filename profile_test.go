@@ -0,0 +1,32 @@
+package easyrsa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_NewCertWithProfile(t *testing.T) {
+	profiles, err := ImportOpenSSLProfiles([]byte(testOpenSSLConfig), "usr_cert")
+	assert.NoError(t, err)
+	pki, cleanup := getTmpPki(WithProfiles(profiles...))
+	defer cleanup()
+	_, _ = pki.NewCa()
+
+	pair, err := pki.NewCertWithProfile("web", "usr_cert")
+	assert.NoError(t, err)
+	_, cert, err := pair.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, "web", cert.Subject.CommonName)
+	assert.Equal(t, []string{"web.pki.local", "api.pki.local"}, cert.DNSNames)
+	assert.Equal(t, []string{"http://ocsp.pki.local"}, cert.OCSPServer)
+	assert.Equal(t, "1.3.6.1.4.1.99999.1", cert.PolicyIdentifiers[0].String())
+	assert.False(t, cert.IsCA)
+
+	signed, err := pki.SignCSRWithProfile(newTestCSR(t, "csr"), "dev", "usr_cert")
+	assert.NoError(t, err)
+	assert.False(t, signed.HasKey())
+
+	_, err = pki.NewCertWithProfile("web", "missing")
+	assert.Error(t, err)
+}
@@ -0,0 +1,59 @@
+package easyrsa
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"time"
+)
+
+// WithRSAPSS sign certs and CRLs with RSASSA-PSS instead of PKCS #1 v1.5. Hash is chosen by CA key size,
+// single profiles can mandate PSS with Profile.SignatureAlgorithm instead
+func WithRSAPSS() Option {
+	return func(p *PKI) {
+		p.rsaPSS = true
+	}
+}
+
+// signatureAlgorithm return algorithm for signing with key of pub, zero to let crypto/x509 choose PKCS #1 v1.5
+func (p *PKI) signatureAlgorithm(pub crypto.PublicKey) x509.SignatureAlgorithm {
+	if !p.rsaPSS {
+		return x509.UnknownSignatureAlgorithm
+	}
+	return rsaPSSAlgorithm(pub)
+}
+
+// rsaPSSAlgorithm return PSS algorithm with hash of comparable strength to RSA key as in NIST SP 800-57,
+// zero for other keys
+func rsaPSSAlgorithm(pub crypto.PublicKey) x509.SignatureAlgorithm {
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return x509.UnknownSignatureAlgorithm
+	}
+	switch bits := key.N.BitLen(); {
+	case bits > 7680:
+		return x509.SHA512WithRSAPSS
+	case bits > 3072:
+		return x509.SHA384WithRSAPSS
+	}
+	return x509.SHA256WithRSAPSS
+}
+
+// createCRL sign list with caKey. PSS CRLs are created with x509.CreateRevocationList, which require
+// CRL number, PKCS #1 v1.5 ones are kept as before
+func (p *PKI) createCRL(caKey *rsa.PrivateKey, caCert *x509.Certificate, list []pkix.RevokedCertificate) ([]byte, error) {
+	now := p.now()
+	alg := p.signatureAlgorithm(&caKey.PublicKey)
+	if alg == x509.UnknownSignatureAlgorithm {
+		return caCert.CreateCRL(p.rand(), caKey, list, now, now.Add(99*365*24*time.Hour))
+	}
+	return x509.CreateRevocationList(p.rand(), &x509.RevocationList{
+		SignatureAlgorithm:  alg,
+		RevokedCertificates: list,
+		Number:              big.NewInt(now.UnixNano()),
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(99 * 365 * 24 * time.Hour),
+	}, caCert, caKey)
+}
@@ -0,0 +1,70 @@
+package easyrsa
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_RSAPSS(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithRSAPSS())
+	defer cleanup()
+	caPair, err := pki.NewCa()
+	assert.NoError(t, err)
+	ca, err := decodeCert(caPair.CertPemBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, x509.SHA256WithRSAPSS, ca.SignatureAlgorithm)
+
+	pair, err := pki.NewCert("client", false, nil)
+	assert.NoError(t, err)
+	cert, err := decodeCert(pair.CertPemBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, x509.SHA256WithRSAPSS, cert.SignatureAlgorithm)
+	assert.NoError(t, cert.CheckSignatureFrom(ca))
+
+	assert.NoError(t, pki.RevokeOne(pair.Serial))
+	assert.True(t, pki.IsRevoked(pair.Serial))
+	list, err := pki.GetRevocationList()
+	assert.NoError(t, err)
+	assert.Equal(t, x509.SHA256WithRSAPSS, list.SignatureAlgorithm)
+	assert.NoError(t, list.CheckSignatureFrom(ca))
+	text, err := pair.DumpText()
+	assert.NoError(t, err)
+	assert.Contains(t, text, "rsassaPss")
+}
+
+func TestProfile_SignatureAlgorithm(t *testing.T) {
+	pss := &Profile{Name: "pss", KeyUsage: x509.KeyUsageDigitalSignature, SignatureAlgorithm: x509.SHA384WithRSAPSS}
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithProfiles(pss))
+	defer cleanup()
+	caPair, err := pki.NewCa()
+	assert.NoError(t, err)
+	ca, err := decodeCert(caPair.CertPemBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, x509.SHA256WithRSA, ca.SignatureAlgorithm)
+
+	pair, err := pki.NewCertWithProfile("web", "pss")
+	assert.NoError(t, err)
+	cert, err := decodeCert(pair.CertPemBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, x509.SHA384WithRSAPSS, cert.SignatureAlgorithm)
+	assert.NoError(t, cert.CheckSignatureFrom(ca))
+
+	pss.SignatureAlgorithm = x509.ECDSAWithSHA256
+	_, err = pki.NewCertWithProfile("web", "pss")
+	assert.Error(t, err)
+}
+
+func TestRSAPSSAlgorithm(t *testing.T) {
+	key := func(bits uint) *rsa.PublicKey {
+		return &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), bits-1), E: 65537}
+	}
+	assert.Equal(t, x509.SHA256WithRSAPSS, rsaPSSAlgorithm(key(2048)))
+	assert.Equal(t, x509.SHA256WithRSAPSS, rsaPSSAlgorithm(key(3072)))
+	assert.Equal(t, x509.SHA384WithRSAPSS, rsaPSSAlgorithm(key(4096)))
+	assert.Equal(t, x509.SHA512WithRSAPSS, rsaPSSAlgorithm(key(8192)))
+	assert.Equal(t, x509.UnknownSignatureAlgorithm, rsaPSSAlgorithm(nil))
+}
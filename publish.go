@@ -0,0 +1,243 @@
+package easyrsa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PublishFunc push pem encoded CRL to distribution target
+type PublishFunc func(ctx context.Context, crlPem []byte) error
+
+// CRLTarget is a named CRL distribution target
+type CRLTarget struct {
+	Name    string      // name used in PublishResult
+	Publish PublishFunc // delivery function
+}
+
+// PublishResult report delivery of CRL to one target
+type PublishResult struct {
+	Target   string // target name
+	Attempts int    // number of made attempts
+	Err      error  // last attempt error, nil if delivered
+}
+
+// DefaultCRLPublishTimeout is a timeout of one publish attempt if CRLPublisher has none
+const DefaultCRLPublishTimeout = 30 * time.Second
+
+// CRLPublisher push every newly signed CRL to configured targets in background, revocation never wait for
+// targets. Only the last pending CRL is pushed if targets are slower than regeneration.
+// Delivery errors never fail revocation, they are reported to OnResult only
+type CRLPublisher struct {
+	Targets  []CRLTarget                    // targets, CRL is pushed to all of them concurrently
+	Retries  int                            // extra attempts after failed one
+	Backoff  time.Duration                  // delay before first retry, doubled for every next one
+	Timeout  time.Duration                  // timeout of one attempt, DefaultCRLPublishTimeout if zero
+	OnResult func(results []*PublishResult) // called after every push with result per target
+
+	mu      sync.Mutex
+	pending []byte        // CRL waiting for push
+	running bool          // background push is in progress
+	done    chan struct{} // closed when background push is finished
+}
+
+// WithCRLPublisher push CRL to publisher targets after every CRL regeneration
+func WithCRLPublisher(publisher *CRLPublisher) Option {
+	return func(p *PKI) {
+		p.crlPublisher = publisher
+	}
+}
+
+// Publish push crlPem to all targets and wait for results
+func (c *CRLPublisher) Publish(ctx context.Context, crlPem []byte) []*PublishResult {
+	results := make([]*PublishResult, len(c.Targets))
+	done := make(chan struct{}, len(c.Targets))
+	for i, target := range c.Targets {
+		go func(i int, target CRLTarget) {
+			results[i] = c.publish(ctx, target, crlPem)
+			done <- struct{}{}
+		}(i, target)
+	}
+	for range c.Targets {
+		<-done
+	}
+	if c.OnResult != nil {
+		c.OnResult(results)
+	}
+	return results
+}
+
+func (c *CRLPublisher) publish(ctx context.Context, target CRLTarget, crlPem []byte) *PublishResult {
+	res := &PublishResult{Target: target.Name}
+	backoff := c.Backoff
+	for {
+		res.Attempts++
+		res.Err = c.attempt(ctx, target, crlPem)
+		if res.Err == nil || res.Attempts > c.Retries {
+			return res
+		}
+		select {
+		case <-ctx.Done():
+			res.Err = ctx.Err()
+			return res
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *CRLPublisher) attempt(ctx context.Context, target CRLTarget, crlPem []byte) error {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCRLPublishTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return target.Publish(ctx, crlPem)
+}
+
+// enqueue schedule background push of crlPem, replacing CRL not pushed yet
+func (c *CRLPublisher) enqueue(crlPem []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = crlPem
+	if c.running {
+		return
+	}
+	c.running = true
+	c.done = make(chan struct{})
+	go c.run(c.done)
+}
+
+// run push pending CRLs until there is none
+func (c *CRLPublisher) run(done chan struct{}) {
+	defer close(done)
+	for {
+		c.mu.Lock()
+		crlPem := c.pending
+		c.pending = nil
+		if crlPem == nil {
+			c.running = false
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+		c.Publish(context.Background(), crlPem)
+	}
+}
+
+// Wait block until background push of signed CRLs is finished, e.g. before shutdown
+func (c *CRLPublisher) Wait() {
+	c.mu.Lock()
+	done := c.done
+	c.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// publishCRL schedule push of just signed CRL if PKI has publisher
+func (p *PKI) publishCRL(crlPem []byte) {
+	if p.crlPublisher == nil {
+		return
+	}
+	p.crlPublisher.enqueue(crlPem)
+}
+
+// HTTPPutPublish PUT CRL to url, e.g. S3 presigned url or CDN origin.
+// http.DefaultClient is used if client is nil, header is added to every request
+func HTTPPutPublish(url string, header http.Header, client *http.Client) PublishFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context, crlPem []byte) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(crlPem))
+		if err != nil {
+			return errors.Wrap(err, "can`t create request")
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/pkix-crl")
+		}
+		return doPublishRequest(client, req)
+	}
+}
+
+// ConfigMapPublish store CRL under key of Kubernetes ConfigMap with merge patch by API server url and bearer token.
+// ConfigMap must exist, http.DefaultClient is used if client is nil
+func ConfigMapPublish(apiServer, namespace, name, key, token string, client *http.Client) PublishFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	url := fmt.Sprintf("%s/api/v1/namespaces/%s/configmaps/%s", strings.TrimSuffix(apiServer, "/"), namespace, name)
+	return func(ctx context.Context, crlPem []byte) error {
+		body, err := json.Marshal(map[string]interface{}{"data": map[string]string{key: string(crlPem)}})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPatch, url, bytes.NewReader(body))
+		if err != nil {
+			return errors.Wrap(err, "can`t create request")
+		}
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return doPublishRequest(client, req)
+	}
+}
+
+func doPublishRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "can`t push crl")
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("target respond with %s", resp.Status)
+	}
+	return nil
+}
+
+// CommandPublish run command with CRL on stdin, e.g. ssh host "cat > /srv/crl.pem"
+func CommandPublish(name string, args ...string) PublishFunc {
+	return func(ctx context.Context, crlPem []byte) error {
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stdin = bytes.NewReader(crlPem)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return errors.Wrapf(err, "%s failed: %s", name, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+}
+
+// SCPPublish copy CRL to scp destination as host:/path/crl.pem, args are passed to scp before the files
+func SCPPublish(dest string, args ...string) PublishFunc {
+	return func(ctx context.Context, crlPem []byte) error {
+		file, err := ioutil.TempFile("", "crl-*.pem")
+		if err != nil {
+			return errors.Wrap(err, "can`t create temp crl")
+		}
+		defer os.Remove(file.Name())
+		_, err = file.Write(crlPem)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return errors.Wrap(err, "can`t write temp crl")
+		}
+		return CommandPublish("scp", append(append([]string{}, args...), file.Name(), dest)...)(ctx, nil)
+	}
+}
@@ -0,0 +1,156 @@
+package easyrsa
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCRLPublisher(t *testing.T) {
+	var mu sync.Mutex
+	var puts [][]byte
+	var failures int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "application/pkix-crl", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		body, _ := ioutil.ReadAll(r.Body)
+		puts = append(puts, body)
+	}))
+	defer server.Close()
+
+	var results []*PublishResult
+	publisher := &CRLPublisher{
+		Targets: []CRLTarget{
+			{Name: "cdn", Publish: HTTPPutPublish(server.URL+"/crl.pem", http.Header{"X-Token": {"secret"}}, nil)},
+			{Name: "broken", Publish: func(ctx context.Context, crlPem []byte) error { return errors.New("unreachable") }},
+		},
+		Retries:  2,
+		Backoff:  time.Millisecond,
+		OnResult: func(res []*PublishResult) { results = res },
+	}
+	pki, cleanup := getTmpPki(WithCRLPublisher(publisher))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	pair, err := pki.NewCert("client", false, nil)
+	assert.NoError(t, err)
+
+	publisher.Wait()
+	failures = 1
+	assert.NoError(t, pki.RevokeOne(pair.Serial))
+	publisher.Wait()
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "cdn", results[0].Target)
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, 2, results[0].Attempts)
+		assert.Equal(t, "broken", results[1].Target)
+		assert.Error(t, results[1].Err)
+		assert.Equal(t, 3, results[1].Attempts)
+	}
+	stored, _ := ioutil.ReadFile(filepath.Join(testData, "crl.pem"))
+	if assert.Len(t, puts, 1) {
+		assert.Equal(t, stored, puts[0])
+	}
+}
+
+func TestCRLPublisher_hungTarget(t *testing.T) {
+	release := make(chan struct{})
+	var pushed [][]byte
+	publisher := &CRLPublisher{Targets: []CRLTarget{{Name: "hung", Publish: func(ctx context.Context, crlPem []byte) error {
+		pushed = append(pushed, crlPem)
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}}}}
+	pki, cleanup := getTmpPki(WithCRLPublisher(publisher))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	first, _ := pki.NewCert("first", false, nil)
+	second, _ := pki.NewCert("second", false, nil)
+	third, _ := pki.NewCert("third", false, nil)
+
+	// revocations don`t wait for target, only the last pending CRL is pushed after the hung one
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, pair := range []*X509Pair{first, second, third} {
+			assert.NoError(t, pki.RevokeOne(pair.Serial))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("revocation is blocked by publish")
+	}
+	close(release)
+	publisher.Wait()
+	stored, _ := ioutil.ReadFile(filepath.Join(testData, "crl.pem"))
+	if assert.NotEmpty(t, pushed) {
+		assert.LessOrEqual(t, len(pushed), 2)
+		assert.Equal(t, stored, pushed[len(pushed)-1])
+	}
+
+	publisher = &CRLPublisher{Targets: []CRLTarget{{Name: "hung", Publish: func(ctx context.Context, crlPem []byte) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}}, Timeout: time.Millisecond}
+	assert.ErrorIs(t, publisher.Publish(context.Background(), []byte("crl"))[0].Err, context.DeadlineExceeded)
+}
+
+func TestConfigMapPublish(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/vpn/configmaps/openvpn-crl" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, http.MethodPatch, r.Method)
+		assert.Equal(t, "application/merge-patch+json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		var patch struct {
+			Data map[string]string `json:"data"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&patch))
+		assert.Equal(t, "crl", patch.Data["crl.pem"])
+	}))
+	defer server.Close()
+	publish := ConfigMapPublish(server.URL+"/", "vpn", "openvpn-crl", "crl.pem", "token", nil)
+	assert.NoError(t, publish(context.Background(), []byte("crl")))
+	assert.Error(t, ConfigMapPublish(server.URL+"/missing", "vpn", "crl", "crl.pem", "", nil)(context.Background(), []byte("crl")))
+}
+
+func TestCommandPublish(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh on windows")
+	}
+	dir := filepath.Join(getTestDir(), "command_publish")
+	_ = os.MkdirAll(dir, 0700)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "crl.pem")
+	assert.NoError(t, CommandPublish("sh", "-c", "cat > "+path)(context.Background(), []byte("crl")))
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "crl", string(content))
+	assert.Error(t, CommandPublish("sh", "-c", "echo denied >&2; exit 1")(context.Background(), []byte("crl")))
+}
@@ -0,0 +1,87 @@
+package easyrsa
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MetadataKeyState is a metadata tag set on revoked pairs whose key was removed by QuarantineRevokedKeys
+const MetadataKeyState = "key_state"
+
+// Key states of revoked pairs
+const (
+	KeyStateQuarantined = "quarantined" // key moved to RevokedKeyRetention.Quarantine
+	KeyStateDeleted     = "deleted"     // key deleted
+)
+
+// RevokedKeyRetention configure what happen with private keys of revoked pairs, certs are always kept for audit
+type RevokedKeyRetention struct {
+	Period     time.Duration // time after revocation key is kept with the cert
+	Quarantine Keychain      // keys are moved here, deleted if nil
+}
+
+// WithRevokedKeyRetention enable QuarantineRevokedKeys
+func WithRevokedKeyRetention(retention *RevokedKeyRetention) Option {
+	return func(p *PKI) {
+		p.revokedKeyRetention = retention
+	}
+}
+
+func quarantineAccount(serial *big.Int) string {
+	return fmt.Sprintf("revoked-%s", serial.Text(16))
+}
+
+// QuarantineRevokedKeys move or delete keys of pairs revoked longer than retention period ago
+// and tag them with MetadataKeyState. It should be scheduled periodically, serials of processed pairs are returned
+func (p *PKI) QuarantineRevokedKeys() ([]*big.Int, error) {
+	retention := p.revokedKeyRetention
+	if retention == nil {
+		return nil, errors.New("revoked key retention is not configured")
+	}
+	list, err := p.GetCRL()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get crl")
+	}
+	now := p.now()
+	res := make([]*big.Int, 0)
+	for _, revoked := range removeDups(list.TBSCertList.RevokedCertificates) {
+		if now.Before(revoked.RevocationTime.Add(retention.Period)) {
+			continue
+		}
+		pair, err := p.Storage.GetBySerial(revoked.SerialNumber)
+		if err != nil || !pair.HasKey() || pair.CN == "ca" {
+			continue
+		}
+		state := KeyStateDeleted
+		if retention.Quarantine != nil {
+			if err := retention.Quarantine.Set(quarantineAccount(pair.Serial), pair.KeyPemBytes); err != nil {
+				return res, errors.Wrapf(err, "can`t quarantine key %s", pair.Serial.Text(16))
+			}
+			state = KeyStateQuarantined
+		}
+		certOnly := NewX509Pair(nil, pair.CertPemBytes, pair.CN, pair.Serial)
+		certOnly.ChainPemBytes = pair.ChainPemBytes
+		certOnly.Metadata = make(map[string]string, len(pair.Metadata)+1)
+		for key, value := range pair.Metadata {
+			certOnly.Metadata[key] = value
+		}
+		certOnly.Metadata[MetadataKeyState] = state
+		pair.Wipe()
+		if err := p.Storage.Put(certOnly); err != nil {
+			return res, errors.Wrapf(err, "can`t remove key %s", certOnly.Serial.Text(16))
+		}
+		res = append(res, certOnly.Serial)
+	}
+	return res, nil
+}
+
+// QuarantinedKey return pem encoded key of revoked pair from quarantine, e.g. for forensics
+func (p *PKI) QuarantinedKey(serial *big.Int) ([]byte, error) {
+	if p.revokedKeyRetention == nil || p.revokedKeyRetention.Quarantine == nil {
+		return nil, errors.New("key quarantine is not configured")
+	}
+	return p.revokedKeyRetention.Quarantine.Get(quarantineAccount(serial))
+}
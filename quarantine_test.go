@@ -0,0 +1,73 @@
+package easyrsa
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_QuarantineRevokedKeys(t *testing.T) {
+	quarantine := memKeychain{}
+	retention := &RevokedKeyRetention{Period: 24 * time.Hour, Quarantine: quarantine}
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithRevokedKeyRetention(retention))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	stolen, err := pki.NewCertWithMetadata("stolen", false, nil, map[string]string{"ticket": "SEC-1"})
+	assert.NoError(t, err)
+	lost, err := pki.NewCert("lost", false, nil)
+	assert.NoError(t, err)
+	kept, err := pki.NewCert("kept", false, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pki.RevokeBatch([]*big.Int{stolen.Serial, lost.Serial}, "", ""))
+
+	t.Run("within period", func(t *testing.T) {
+		res, err := pki.QuarantineRevokedKeys()
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	later := time.Now().Add(48 * time.Hour)
+	pki.clock = func() time.Time { return later }
+
+	t.Run("quarantine", func(t *testing.T) {
+		res, err := pki.QuarantineRevokedKeys()
+		assert.NoError(t, err)
+		assert.Len(t, res, 2)
+		pair, err := pki.Storage.GetBySerial(stolen.Serial)
+		assert.NoError(t, err)
+		assert.False(t, pair.HasKey())
+		assert.Equal(t, stolen.CertPemBytes, pair.CertPemBytes)
+		assert.Equal(t, map[string]string{"ticket": "SEC-1", MetadataKeyState: KeyStateQuarantined}, pair.Metadata)
+		key, err := pki.QuarantinedKey(stolen.Serial)
+		assert.NoError(t, err)
+		assert.Equal(t, stolen.KeyPemBytes, key)
+		pair, err = pki.Storage.GetBySerial(kept.Serial)
+		assert.NoError(t, err)
+		assert.True(t, pair.HasKey())
+
+		res, err = pki.QuarantineRevokedKeys()
+		assert.NoError(t, err)
+		assert.Empty(t, res, "processed pairs have no key")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		retention.Quarantine = nil
+		another, err := pki.NewCert("another", false, nil)
+		assert.NoError(t, err)
+		pki.clock = nil
+		assert.NoError(t, pki.RevokeOne(another.Serial))
+		pki.clock = func() time.Time { return later }
+		res, err := pki.QuarantineRevokedKeys()
+		assert.NoError(t, err)
+		assert.Equal(t, []*big.Int{another.Serial}, res)
+		pair, err := pki.Storage.GetBySerial(another.Serial)
+		assert.NoError(t, err)
+		assert.False(t, pair.HasKey())
+		assert.Equal(t, KeyStateDeleted, pair.Metadata[MetadataKeyState])
+		_, err = pki.QuarantinedKey(another.Serial)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,65 @@
+package easyrsa
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IssuanceLimits restrict leaf issuance per CN, zero value of a field disable the limit
+type IssuanceLimits struct {
+	MaxActivePerCN int           // max not revoked and not expired certs per CN
+	MaxPerWindow   int           // max certs issued per CN within Window
+	Window         time.Duration // rate limit window
+}
+
+// WithIssuanceLimits enforce limits in NewCert, SignCSR and NewTSACert.
+// Counts are taken from storage, so limits hold across restarts, but concurrent issuers may overshoot
+func WithIssuanceLimits(limits IssuanceLimits) Option {
+	return func(p *PKI) {
+		p.limits = limits
+	}
+}
+
+// checkLimits return QuotaExceeded if new cert for cn would exceed issuance limits
+func (p *PKI) checkLimits(cn string) error {
+	if p.limits.MaxActivePerCN <= 0 && (p.limits.MaxPerWindow <= 0 || p.limits.Window <= 0) {
+		return nil
+	}
+	list, err := p.GetCRL()
+	if err != nil {
+		return errors.Wrap(err, "can`t get crl for issuance limits")
+	}
+	revoked := make(map[string]bool)
+	for _, cert := range list.TBSCertList.RevokedCertificates {
+		revoked[cert.SerialNumber.Text(16)] = true
+	}
+	now := p.now()
+	active, recent := 0, 0
+	err = ForEachByCN(p.Storage, cn, func(pair *X509Pair) error {
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil {
+			return nil
+		}
+		if cert.NotBefore.Add(NotBeforeBackdate).After(now.Add(-p.limits.Window)) {
+			recent++
+		}
+		if !revoked[cert.SerialNumber.Text(16)] && now.Before(cert.NotAfter) {
+			active++
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "can`t count pairs for issuance limits")
+	}
+	if p.limits.MaxActivePerCN > 0 && active >= p.limits.MaxActivePerCN {
+		return errors.WithStack(NewQuotaExceeded(
+			fmt.Sprintf("%s already has %d active certs", cn, active)))
+	}
+	if p.limits.MaxPerWindow > 0 && p.limits.Window > 0 && recent >= p.limits.MaxPerWindow {
+		return errors.WithStack(NewQuotaExceeded(
+			fmt.Sprintf("%s has %d certs issued within %s", cn, recent, p.limits.Window)))
+	}
+	return nil
+}
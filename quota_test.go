@@ -0,0 +1,47 @@
+package easyrsa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_checkLimits(t *testing.T) {
+	isQuota := func(err error) bool {
+		_, ok := errors.Cause(err).(*QuotaExceeded)
+		return ok
+	}
+	t.Run("active", func(t *testing.T) {
+		pki, cleanup := getTmpPki(WithIssuanceLimits(IssuanceLimits{MaxActivePerCN: 2}))
+		defer cleanup()
+		_, _ = pki.NewCa()
+		first, err := pki.NewCert("client", false, []string{""})
+		assert.NoError(t, err)
+		_, err = pki.NewCert("client", false, []string{""})
+		assert.NoError(t, err)
+		_, err = pki.NewCert("client", false, []string{""})
+		assert.True(t, isQuota(err))
+		_, err = pki.SignCSR(newTestCSR(t, "client"), "client", false, nil)
+		assert.True(t, isQuota(err))
+		_, err = pki.NewCert("other", false, []string{""})
+		assert.NoError(t, err)
+		assert.NoError(t, pki.RevokeOne(first.Serial))
+		_, err = pki.NewCert("client", false, []string{""})
+		assert.NoError(t, err)
+	})
+	t.Run("window", func(t *testing.T) {
+		pki, cleanup := getTmpPki(WithIssuanceLimits(IssuanceLimits{MaxPerWindow: 1, Window: time.Hour}))
+		defer cleanup()
+		_, _ = pki.NewCa()
+		first, err := pki.NewCert("client", false, []string{""})
+		assert.NoError(t, err)
+		assert.NoError(t, pki.RevokeOne(first.Serial))
+		_, err = pki.NewCert("client", false, []string{""})
+		assert.True(t, isQuota(err))
+		pki.limits.Window = time.Nanosecond
+		_, err = pki.NewCert("client", false, []string{""})
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,178 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MetadataProfile is a metadata tag with profile name of pairs issued by Reconcile
+const MetadataProfile = "profile"
+
+// Drift reasons reported by Reconcile
+const (
+	DriftMissing  = "missing"  // no stored pair for cn
+	DriftRevoked  = "revoked"  // stored pair is revoked
+	DriftExpiring = "expiring" // stored pair expire within renew before or is not valid yet
+	DriftSANs     = "sans"     // subject alt names differ from spec
+	DriftUsage    = "usage"    // key usage, extended key usage or basic constraints differ from spec
+	DriftProfile  = "profile"  // pair was issued with other profile
+	DriftKey      = "key"      // spec CSR has other public key
+)
+
+// ReconcileResult is an outcome of Reconcile for one spec
+type ReconcileResult struct {
+	Pair  *X509Pair // active pair, the reissued one if Drift is not empty
+	Drift []string  // reasons of reissue, empty if active pair match spec
+}
+
+// Reissued return true if new pair was issued
+func (r *ReconcileResult) Reissued() bool {
+	return len(r.Drift) > 0
+}
+
+// Reconcile compare last stored pair of spec.CN with desired spec (SANs, server flag, profile, CSR key)
+// and reissue it with spec only if it drifted, is missing, revoked or expire within renewBefore,
+// DefaultRenewBefore if zero. Calling it repeatedly with the same spec issue nothing new
+func (p *PKI) Reconcile(spec CertRequest, renewBefore time.Duration) (*ReconcileResult, error) {
+	if spec.CN == "" {
+		return nil, errors.New("empty cn")
+	}
+	if spec.CSR == nil && len(spec.CSRPem) > 0 {
+		csr, err := decodeCSR(spec.CSRPem)
+		if err != nil {
+			return nil, err
+		}
+		spec.CSR = csr
+	}
+	if renewBefore == 0 {
+		renewBefore = DefaultRenewBefore
+	}
+	res := &ReconcileResult{}
+	pair, err := p.Storage.GetLastByCn(spec.CN)
+	if _, ok := errors.Cause(err).(*NotExist); ok || (err == nil && pair == nil) {
+		res.Drift = []string{DriftMissing}
+	} else if err != nil {
+		return nil, errors.Wrap(err, "can`t get active pair")
+	} else if res.Drift, err = p.drift(spec, pair, renewBefore); err != nil {
+		return nil, err
+	}
+	if len(res.Drift) == 0 {
+		res.Pair = pair
+		return res, nil
+	}
+	metadata := make(map[string]string, len(spec.Metadata)+1)
+	for key, value := range spec.Metadata {
+		metadata[key] = value
+	}
+	metadata[MetadataProfile] = spec.Profile
+	spec.Metadata = metadata
+	if res.Pair, err = p.Issue(spec); err != nil {
+		return nil, errors.Wrapf(err, "can`t reissue %s (%s)", spec.CN, strings.Join(res.Drift, ", "))
+	}
+	return res, nil
+}
+
+// ReconcileAll reconcile every spec concurrently as Reconcile do. Results are in order of specs,
+// failed items are nil and reported in *BatchError
+func (p *PKI) ReconcileAll(specs []CertRequest, renewBefore time.Duration, parallelism int) ([]*ReconcileResult, error) {
+	res := make([]*ReconcileResult, len(specs))
+	err := batch(len(specs), parallelism, func(i int) error {
+		var err error
+		res[i], err = p.Reconcile(specs[i], renewBefore)
+		return err
+	})
+	return res, err
+}
+
+// drift return reasons why pair doesn`t match spec
+func (p *PKI) drift(spec CertRequest, pair *X509Pair, renewBefore time.Duration) ([]string, error) {
+	cert, err := decodeCert(pair.CertPemBytes)
+	if err != nil {
+		return []string{DriftMissing}, nil
+	}
+	want, err := p.requestTemplate(spec)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0)
+	now := p.now()
+	if p.IsRevoked(pair.Serial) {
+		res = append(res, DriftRevoked)
+	} else if now.Before(cert.NotBefore) || !now.Add(renewBefore).Before(cert.NotAfter) {
+		res = append(res, DriftExpiring)
+	}
+	if !equalSet(certSANs(cert), certSANs(want)) {
+		res = append(res, DriftSANs)
+	}
+	if cert.KeyUsage != want.KeyUsage || cert.IsCA != want.IsCA || !equalSet(extKeyUsages(cert), extKeyUsages(want)) {
+		res = append(res, DriftUsage)
+	}
+	if profile, ok := pair.Metadata[MetadataProfile]; (ok && profile != spec.Profile) || (!ok && spec.Profile != "") {
+		res = append(res, DriftProfile)
+	}
+	if spec.CSR != nil && !publicKeyEqual(spec.CSR.PublicKey, cert.PublicKey) {
+		res = append(res, DriftKey)
+	}
+	return res, nil
+}
+
+// certSANs return all subject alt names of cert as comparable strings
+func certSANs(cert *x509.Certificate) []string {
+	res := make([]string, 0)
+	for _, name := range cert.DNSNames {
+		res = append(res, "dns:"+strings.ToLower(name))
+	}
+	for _, ip := range cert.IPAddresses {
+		res = append(res, "ip:"+ip.String())
+	}
+	for _, email := range cert.EmailAddresses {
+		res = append(res, "email:"+email)
+	}
+	for _, uri := range cert.URIs {
+		res = append(res, "uri:"+uri.String())
+	}
+	return res
+}
+
+func extKeyUsages(cert *x509.Certificate) []string {
+	res := make([]string, 0, len(cert.ExtKeyUsage)+len(cert.UnknownExtKeyUsage))
+	for _, usage := range cert.ExtKeyUsage {
+		res = append(res, strconv.Itoa(int(usage)))
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		res = append(res, oid.String())
+	}
+	return res
+}
+
+// equalSet return true if a and b have the same distinct values
+func equalSet(a, b []string) bool {
+	a, b = sortedUniq(a), sortedUniq(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedUniq(values []string) []string {
+	res := append([]string{}, values...)
+	sort.Strings(res)
+	n := 0
+	for i, v := range res {
+		if i == 0 || v != res[n-1] {
+			res[n] = v
+			n++
+		}
+	}
+	return res[:n]
+}
@@ -0,0 +1,70 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_Reconcile(t *testing.T) {
+	web := &Profile{
+		Name:        "web",
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithProfiles(web))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	spec := CertRequest{CN: "api", Server: true, DNSNames: []string{"api.example.com", "api"}}
+	res, err := pki.Reconcile(spec, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DriftMissing}, res.Drift)
+	first := res.Pair
+
+	// unchanged spec issue nothing, SAN order and case don`t matter
+	spec.DNSNames = []string{"api", "API.example.com"}
+	res, err = pki.Reconcile(spec, 0)
+	assert.NoError(t, err)
+	assert.False(t, res.Reissued())
+	assert.Equal(t, 0, res.Pair.Serial.Cmp(first.Serial))
+
+	spec.DNSNames = append(spec.DNSNames, "api.internal")
+	res, err = pki.Reconcile(spec, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DriftSANs}, res.Drift)
+
+	spec.Profile = "web"
+	res, err = pki.Reconcile(spec, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DriftUsage, DriftProfile}, res.Drift)
+	res, err = pki.Reconcile(spec, 0)
+	assert.NoError(t, err)
+	assert.False(t, res.Reissued())
+
+	assert.NoError(t, pki.RevokeOne(res.Pair.Serial))
+	res, err = pki.Reconcile(spec, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DriftRevoked}, res.Drift)
+
+	res, err = pki.Reconcile(spec, 100*365*24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DriftExpiring}, res.Drift)
+
+	csr := newTestCSR(t, "api")
+	results, err := pki.ReconcileAll([]CertRequest{spec, {CN: "other"}}, 0, 2)
+	assert.NoError(t, err)
+	assert.False(t, results[0].Reissued())
+	assert.True(t, results[1].Reissued())
+	spec.CSRPem = csr
+	res, err = pki.Reconcile(spec, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DriftKey}, res.Drift)
+	assert.False(t, res.Pair.HasKey())
+
+	_, err = pki.Reconcile(CertRequest{CN: "api", Profile: "missing"}, 0)
+	assert.Error(t, err)
+}
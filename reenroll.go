@@ -0,0 +1,114 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// Reenroll issue new cert for the identity of current cert presented in creds, e.g. HTTPCredentials or
+// sds.GRPCCredentials of mTLS request, as EST simplereenroll do. Current cert must be valid leaf stored in the PKI,
+// not expired and not revoked. CSR subject cn must be the same and CSR SANs, if any, identical to current ones.
+// Enrollment token and challenge are not required, CSRPolicy key checks apply.
+// New cert keep SANs, server flag, groups, profile and metadata of current one, current cert is not revoked
+func (p *PKI) Reenroll(creds *Credentials, csrPem []byte) (*X509Pair, error) {
+	if err := p.requireAttestation(); err != nil {
+		return nil, err
+	}
+	cert, pair, err := p.currentCert(creds)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := decodeCSR(csrPem)
+	if err != nil {
+		return nil, err
+	}
+	if csr.Subject.CommonName != cert.Subject.CommonName {
+		return nil, errors.WithStack(NewPolicyViolation("csr cn differ from current cert"))
+	}
+	csrSANs := certSANs(&x509.Certificate{
+		DNSNames:       csr.DNSNames,
+		IPAddresses:    csr.IPAddresses,
+		EmailAddresses: csr.EmailAddresses,
+		URIs:           csr.URIs,
+	})
+	if len(csrSANs) > 0 && !equalSet(csrSANs, certSANs(cert)) {
+		return nil, errors.WithStack(NewPolicyViolation("csr subject alt names differ from current cert"))
+	}
+	if err := p.checkCSRKey(csr, pair.CN); err != nil {
+		return nil, err
+	}
+	uris := make([]string, 0, len(cert.URIs))
+	for _, uri := range cert.URIs {
+		uris = append(uris, uri.String())
+	}
+	var metadata map[string]string
+	if len(pair.Metadata) > 0 {
+		metadata = make(map[string]string, len(pair.Metadata))
+		for key, value := range pair.Metadata {
+			metadata[key] = value
+		}
+	}
+	return p.issueRequest(CertRequest{
+		CN:             pair.CN,
+		Server:         hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth),
+		Groups:         cert.ExcludedDNSDomains,
+		DNSNames:       cert.DNSNames,
+		IPAddresses:    cert.IPAddresses,
+		EmailAddresses: cert.EmailAddresses,
+		URIs:           uris,
+		Profile:        pair.Metadata[MetadataProfile],
+		CSR:            csr,
+		Metadata:       metadata,
+	})
+}
+
+// currentCert return leaf of creds and it`s stored pair, Unauthenticated if leaf is not valid cert of the PKI.
+// Any extended key usage is accepted, TLS layer already checked the cert is usable as client cert
+func (p *PKI) currentCert(creds *Credentials) (*x509.Certificate, *X509Pair, error) {
+	if creds == nil || len(creds.PeerCertificates) == 0 {
+		return nil, nil, errors.WithStack(NewUnauthenticated("current cert is required"))
+	}
+	roots, err := p.CACertPool()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can`t get ca pool")
+	}
+	leaf := creds.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range creds.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   p.now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, nil, errors.WithStack(NewUnauthenticated("invalid current cert: " + err.Error()))
+	}
+	if leaf.IsCA {
+		return nil, nil, errors.WithStack(NewUnauthenticated("ca cert can`t be reenrolled"))
+	}
+	if p.IsRevoked(leaf.SerialNumber) {
+		return nil, nil, errors.WithStack(NewUnauthenticated("current cert is revoked"))
+	}
+	pair, err := p.Storage.GetBySerial(leaf.SerialNumber)
+	if _, ok := errors.Cause(err).(*NotExist); ok || (err == nil && pair == nil) {
+		return nil, nil, errors.WithStack(NewUnauthenticated("current cert is not stored"))
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can`t get current pair")
+	}
+	stored, err := decodeCert(pair.CertPemBytes)
+	if err != nil || !stored.Equal(leaf) {
+		return nil, nil, errors.WithStack(NewUnauthenticated("current cert differ from stored one"))
+	}
+	return leaf, pair, nil
+}
+
+// isReenrollment return true if creds present valid current cert of cn, so CSR of cn needs no enrollment token
+func (p *PKI) isReenrollment(creds *Credentials, cn string) bool {
+	cert, pair, err := p.currentCert(creds)
+	return err == nil && cert.Subject.CommonName == cn && pair.CN == cn
+}
@@ -0,0 +1,86 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_Reenroll(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024),
+		WithEnrollmentTokens(NewFileEnrollmentTokenStore(filepath.Join(t.TempDir(), "tokens.json"))))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	current, err := pki.Issue(CertRequest{CN: "dev", DNSNames: []string{"dev", "dev.pki.local"}, Metadata: map[string]string{"team": "iot"}})
+	assert.NoError(t, err)
+	_, cert, err := current.Decode()
+	assert.NoError(t, err)
+	creds := &Credentials{PeerCertificates: []*x509.Certificate{cert}}
+
+	_, err = pki.Reenroll(&Credentials{}, newTestCSR(t, "dev"))
+	assert.True(t, isUnauthenticated(err))
+	_, err = pki.Reenroll(creds, newTestCSR(t, "other"))
+	assert.True(t, isPolicyViolation(err))
+
+	renewed, err := pki.Reenroll(creds, newTestCSR(t, "dev"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, 0, renewed.Serial.Cmp(current.Serial))
+	assert.False(t, renewed.HasKey())
+	assert.Equal(t, "iot", renewed.Metadata["team"])
+	_, renewedCert, err := renewed.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, "dev", renewedCert.Subject.CommonName)
+	assert.ElementsMatch(t, cert.DNSNames, renewedCert.DNSNames)
+	assert.False(t, pki.IsRevoked(current.Serial))
+
+	assert.NoError(t, pki.RevokeOne(current.Serial))
+	_, err = pki.Reenroll(creds, newTestCSR(t, "dev"))
+	assert.True(t, isUnauthenticated(err))
+
+	dir := t.TempDir()
+	foreign := NewPKI(NewDirKeyStorage(dir), NewFileSerialProvider(filepath.Join(dir, "serial")),
+		NewFileCRLHolder(filepath.Join(dir, "crl.pem")), pkix.Name{}, WithKeySize(1024))
+	_, err = foreign.NewCa()
+	assert.NoError(t, err)
+	other, err := foreign.NewCert("dev", false, nil)
+	assert.NoError(t, err)
+	_, otherCert, _ := other.Decode()
+	_, err = pki.Reenroll(&Credentials{PeerCertificates: []*x509.Certificate{otherCert}}, newTestCSR(t, "dev"))
+	assert.True(t, isUnauthenticated(err))
+}
+
+func TestVaultFacade_Reenroll(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024),
+		WithEnrollmentTokens(NewFileEnrollmentTokenStore(filepath.Join(t.TempDir(), "tokens.json"))))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	current, err := pki.NewCert("dev.pki.local", false, nil)
+	assert.NoError(t, err)
+	_, cert, _ := current.Decode()
+	facade := NewVaultFacade(pki, &VaultRole{Name: "device"})
+	facade.Auth = &APIAuth{Authenticator: NewClientCertAuthenticator(pki), Rules: AuthorizationRules{{Identities: []string{"*"}}}}
+	sign := func(cn string, peer *x509.Certificate) int {
+		body, _ := json.Marshal(map[string]interface{}{"csr": string(newTestCSR(t, cn))})
+		req := httptest.NewRequest(http.MethodPost, "/sign/device", bytes.NewReader(body))
+		if peer != nil {
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{peer}}
+		}
+		rec := httptest.NewRecorder()
+		facade.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.NotEqual(t, http.StatusOK, sign("dev.pki.local", nil))
+	assert.NotEqual(t, http.StatusOK, sign("other.pki.local", cert))
+	assert.Equal(t, http.StatusOK, sign("dev.pki.local", cert))
+}
@@ -0,0 +1,162 @@
+package easyrsa
+
+import (
+	"bytes"
+	"math/big"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ReplicationConflict is a serial stored in both backends with different certs, secondary is never overwritten
+type ReplicationConflict struct {
+	Serial    *big.Int  // conflicting serial
+	Primary   *X509Pair // pair written to primary
+	Secondary *X509Pair // pair found in secondary
+}
+
+// Replicator is a KeyStorage writing to primary synchronously and mirroring writes to secondary asynchronously,
+// e.g. to storage in other region for disaster recovery. Reads are served by primary only
+type Replicator struct {
+	KeyStorage
+	secondary  KeyStorage
+	queue      chan func()
+	onConflict func(conflict *ReplicationConflict)
+	onError    func(err error)
+	wg         sync.WaitGroup
+	closeOnce  sync.Once
+}
+
+// NewReplicator start mirroring to secondary, writes block when queueSize writes are pending.
+// onConflict and onError are optional and called from replication goroutine
+func NewReplicator(primary, secondary KeyStorage, queueSize int,
+	onConflict func(conflict *ReplicationConflict), onError func(err error)) *Replicator {
+	r := &Replicator{
+		KeyStorage: primary,
+		secondary:  secondary,
+		queue:      make(chan func(), queueSize),
+		onConflict: onConflict,
+		onError:    onError,
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for op := range r.queue {
+			op()
+		}
+	}()
+	return r
+}
+
+func (r *Replicator) Put(pair *X509Pair) error {
+	if err := r.KeyStorage.Put(pair); err != nil {
+		return err
+	}
+	// caller may wipe the pair after Put
+	cp := copyPair(pair)
+	if pair.Metadata != nil {
+		cp.Metadata = make(map[string]string, len(pair.Metadata))
+		for key, value := range pair.Metadata {
+			cp.Metadata[key] = value
+		}
+	}
+	r.queue <- func() {
+		conflict, err := r.replicate(cp)
+		r.report(conflict, err)
+		cp.Wipe()
+	}
+	return nil
+}
+
+func (r *Replicator) DeleteByCn(cn string) error {
+	if err := r.KeyStorage.DeleteByCn(cn); err != nil {
+		return err
+	}
+	r.queue <- func() {
+		r.report(nil, errors.Wrapf(r.secondary.DeleteByCn(cn), "can`t replicate delete of %s", cn))
+	}
+	return nil
+}
+
+func (r *Replicator) DeleteBySerial(serial *big.Int) error {
+	if err := r.KeyStorage.DeleteBySerial(serial); err != nil {
+		return err
+	}
+	r.queue <- func() {
+		r.report(nil, errors.Wrapf(r.secondary.DeleteBySerial(serial), "can`t replicate delete of %s", serial.Text(16)))
+	}
+	return nil
+}
+
+func (r *Replicator) ForEachByCN(cn string, fn func(pair *X509Pair) error) error {
+	return ForEachByCN(r.KeyStorage, cn, fn)
+}
+
+func (r *Replicator) ForEach(fn func(pair *X509Pair) error) error {
+	return ForEach(r.KeyStorage, fn)
+}
+
+// Flush wait until all writes queued before the call are replicated
+func (r *Replicator) Flush() {
+	done := make(chan struct{})
+	r.queue <- func() { close(done) }
+	<-done
+}
+
+// Close replicate pending writes and stop replication, writes after Close panic
+func (r *Replicator) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.queue)
+	})
+	r.wg.Wait()
+	return nil
+}
+
+// Sync copy every primary pair missing in secondary, e.g. after secondary outage. Conflicts are returned, not reported
+func (r *Replicator) Sync() ([]*ReplicationConflict, error) {
+	r.Flush()
+	res := make([]*ReplicationConflict, 0)
+	err := ForEach(r.KeyStorage, func(pair *X509Pair) error {
+		conflict, err := r.replicate(pair)
+		if conflict != nil {
+			res = append(res, conflict)
+		}
+		return err
+	})
+	return res, err
+}
+
+// replicate put pair to secondary unless other cert with the same serial is there
+func (r *Replicator) replicate(pair *X509Pair) (*ReplicationConflict, error) {
+	existing, err := r.secondary.GetBySerial(pair.Serial)
+	if err == nil && existing != nil {
+		if !bytes.Equal(existing.CertPemBytes, pair.CertPemBytes) {
+			return &ReplicationConflict{Serial: pair.Serial, Primary: pair, Secondary: existing}, nil
+		}
+		if bytes.Equal(existing.KeyPemBytes, pair.KeyPemBytes) && metadataEqual(existing.Metadata, pair.Metadata) {
+			return nil, nil
+		}
+	}
+	return nil, errors.Wrapf(r.secondary.Put(pair), "can`t replicate %s", pair.Serial.Text(16))
+}
+
+func (r *Replicator) report(conflict *ReplicationConflict, err error) {
+	if conflict != nil && r.onConflict != nil {
+		r.onConflict(conflict)
+	}
+	if err != nil && r.onError != nil {
+		r.onError(err)
+	}
+}
+
+func metadataEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if got, ok := b[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package easyrsa
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicator(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	dir := filepath.Join(getTestDir(), "replica")
+	_ = os.MkdirAll(dir, 0700)
+	defer os.RemoveAll(dir)
+	secondary := NewDirKeyStorage(dir)
+	var conflicts []*ReplicationConflict
+	var errs []error
+	replicator := NewReplicator(pki.Storage, secondary, 10,
+		func(conflict *ReplicationConflict) { conflicts = append(conflicts, conflict) },
+		func(err error) { errs = append(errs, err) })
+	defer replicator.Close()
+	pki.Storage = replicator
+
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+	pair, err := pki.NewCertWithMetadata("client", false, nil, map[string]string{"team": "infra"})
+	assert.NoError(t, err)
+	pair.Wipe()
+
+	t.Run("mirrored", func(t *testing.T) {
+		replicator.Flush()
+		mirrored, err := secondary.GetBySerial(pair.Serial)
+		assert.NoError(t, err)
+		assert.True(t, mirrored.HasKey())
+		assert.Equal(t, "infra", mirrored.Metadata["team"])
+		assert.NoError(t, mirrored.Validate())
+		_, err = secondary.GetBySerial(ca.Serial)
+		assert.NoError(t, err)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, pki.Storage.DeleteBySerial(pair.Serial))
+		replicator.Flush()
+		_, err := secondary.GetBySerial(pair.Serial)
+		assert.Error(t, err)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		foreign := getTestPair("foreign", ca.Serial.Int64()+2)
+		assert.NoError(t, secondary.Put(foreign))
+		pair, err := pki.NewCert("client", false, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, foreign.Serial, pair.Serial)
+		replicator.Flush()
+		if assert.Len(t, conflicts, 1) {
+			assert.Equal(t, pair.Serial, conflicts[0].Serial)
+			assert.Equal(t, "foreign", conflicts[0].Secondary.CN)
+		}
+		kept, err := secondary.GetBySerial(pair.Serial)
+		assert.NoError(t, err)
+		assert.Equal(t, foreign.CertPemBytes, kept.CertPemBytes, "secondary is not overwritten")
+	})
+
+	t.Run("sync", func(t *testing.T) {
+		assert.NoError(t, os.RemoveAll(filepath.Join(dir, "ca")))
+		res, err := replicator.Sync()
+		assert.NoError(t, err)
+		assert.Len(t, res, 1)
+		_, err = secondary.GetBySerial(ca.Serial)
+		assert.NoError(t, err)
+	})
+	assert.Empty(t, errs)
+}
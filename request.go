@@ -0,0 +1,146 @@
+package easyrsa
+
+import (
+	"crypto"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CertRequest describe cert being issued. It is passed to SubjectBuilder and accepted by Issue and IssueBatch,
+// so every issuance path is described by the same object
+type CertRequest struct {
+	CN             string                   `json:"cn"`                        // common name, storage key of the pair
+	CA             bool                     `json:"ca,omitempty"`              // CA or intermediate, set from profile
+	Server         bool                     `json:"server,omitempty"`          // server leaf
+	Groups         []string                 `json:"groups,omitempty"`          // groups as in NewCert
+	DNSNames       []string                 `json:"dns_names,omitempty"`       // SANs replacing template ones if any SAN is set
+	IPAddresses    []net.IP                 `json:"ip_addresses,omitempty"`    // ip SANs
+	EmailAddresses []string                 `json:"email_addresses,omitempty"` // email SANs
+	URIs           []string                 `json:"uris,omitempty"`            // uri SANs
+	Profile        string                   `json:"profile,omitempty"`         // profile name, empty for built-in templates
+	Validity       time.Duration            `json:"validity,omitempty"`        // cert lifetime, profile validity is the upper bound
+	CSRPem         []byte                   `json:"csr,omitempty"`             // pem encoded CSR, CSR is decoded from it if nil
+	CSR            *x509.CertificateRequest `json:"-"`                         // verified CSR for SignCSR, nil if key is generated
+	Metadata       map[string]string        `json:"metadata,omitempty"`        // tags stored with the pair
+	Requester      *Requester               `json:"requester,omitempty"`       // principal the cert is issued for
+	KeyAlgorithm   KeyAlgorithm             `json:"key_algorithm,omitempty"`   // algorithm of generated key, RSA if empty
+}
+
+// Issue issue cert for request, key is generated if request has no CSR. Checks of NewCert and SignCSR apply
+func (p *PKI) Issue(req CertRequest) (*X509Pair, error) {
+	if req.CN == "" {
+		return nil, errors.New("empty cn")
+	}
+	if err := p.requireAttestation(); err != nil {
+		return nil, err
+	}
+	if err := checkMetadata(req.Metadata); err != nil {
+		return nil, err
+	}
+	if req.CSR == nil && len(req.CSRPem) > 0 {
+		csr, err := decodeCSR(req.CSRPem)
+		if err != nil {
+			return nil, err
+		}
+		req.CSR = csr
+	} else if req.CSR != nil {
+		if err := req.CSR.CheckSignature(); err != nil {
+			return nil, errors.Wrap(err, "wrong csr signature")
+		}
+	}
+	if req.CSR != nil {
+		if req.KeyAlgorithm != "" {
+			return nil, errors.New("key algorithm can`t be set for csr")
+		}
+		if err := p.checkCSR(req.CSR, req.CN, req.Profile); err != nil {
+			return nil, err
+		}
+	}
+	return p.issueRequest(req)
+}
+
+// IssueBatch issue cert for every request concurrently as Issue do. Returned pairs are in order of requests,
+// failed items are nil and reported in *BatchError
+func (p *PKI) IssueBatch(reqs []CertRequest, parallelism int) ([]*X509Pair, error) {
+	res := make([]*X509Pair, len(reqs))
+	err := batch(len(reqs), parallelism, func(i int) error {
+		var err error
+		res[i], err = p.Issue(reqs[i])
+		return err
+	})
+	return res, err
+}
+
+// issueRequest build template of checked request and issue it
+func (p *PKI) issueRequest(req CertRequest) (*X509Pair, error) {
+	if len(req.Metadata) > 0 || req.Requester != nil {
+		metadata := make(map[string]string, len(req.Metadata)+1)
+		for key, value := range req.Metadata {
+			metadata[key] = value
+		}
+		if req.Requester != nil {
+			metadata[MetadataRequester] = req.Requester.String()
+		}
+		req.Metadata = metadata
+	}
+	tml, err := p.requestTemplate(req)
+	if err != nil {
+		return nil, err
+	}
+	var pub crypto.PublicKey
+	if req.CSR != nil {
+		pub = req.CSR.PublicKey
+	}
+	return p.issue(req, tml, pub)
+}
+
+// requestTemplate return cert template of request with profile, validity and SANs applied
+func (p *PKI) requestTemplate(req CertRequest) (*x509.Certificate, error) {
+	var tml *x509.Certificate
+	validity := req.Validity
+	if req.Profile != "" {
+		prof, err := p.Profile(req.Profile)
+		if err != nil {
+			return nil, err
+		}
+		req.CA = prof.IsCA
+		if prof.Validity > 0 && (validity <= 0 || validity > prof.Validity) {
+			validity = prof.Validity
+		}
+		tml = p.profileTemplate(req.CN, prof, req)
+	} else {
+		if req.CA {
+			return nil, errors.New("ca can be issued with ca profile only")
+		}
+		var err error
+		if tml, err = p.certTemplate(req.CN, req); err != nil {
+			return nil, err
+		}
+	}
+	if validity > 0 {
+		tml.NotAfter = p.now().Add(validity).UTC()
+	}
+	if len(req.DNSNames)+len(req.IPAddresses)+len(req.EmailAddresses)+len(req.URIs) > 0 {
+		tml.DNSNames = append([]string{}, req.DNSNames...)
+		tml.IPAddresses = append([]net.IP{}, req.IPAddresses...)
+		tml.EmailAddresses = append([]string{}, req.EmailAddresses...)
+		tml.URIs = make([]*url.URL, 0, len(req.URIs))
+		for _, s := range req.URIs {
+			uri, err := url.Parse(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid uri %s", s)
+			}
+			tml.URIs = append(tml.URIs, uri)
+		}
+	}
+	return tml, nil
+}
+
+// CertRequest return issuance request of signing request
+func (r SigningRequest) CertRequest() CertRequest {
+	return CertRequest{CN: r.CN, Server: r.Server, Groups: r.Groups, CSRPem: r.CSR}
+}
@@ -0,0 +1,99 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_Issue(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithProfiles(&Profile{
+		Name:        "short",
+		Validity:    24 * time.Hour,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	t.Run("sans and validity", func(t *testing.T) {
+		pair, err := pki.Issue(CertRequest{
+			CN:             "web",
+			Server:         true,
+			DNSNames:       []string{"web.example.com"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+			EmailAddresses: []string{"web@example.com"},
+			URIs:           []string{"spiffe://example.com/web"},
+			Validity:       48 * time.Hour,
+			Metadata:       map[string]string{"team": "edge"},
+			Requester:      &Requester{Name: "alice"},
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		cert, err := decodeCert(pair.CertPemBytes)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"web.example.com"}, cert.DNSNames)
+		assert.Equal(t, "10.0.0.1", cert.IPAddresses[0].String())
+		assert.Equal(t, []string{"web@example.com"}, cert.EmailAddresses)
+		assert.Equal(t, "spiffe://example.com/web", cert.URIs[0].String())
+		assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, cert.ExtKeyUsage)
+		assert.WithinDuration(t, pki.now().Add(48*time.Hour), cert.NotAfter, time.Minute)
+		assert.Equal(t, map[string]string{"team": "edge", MetadataRequester: "alice"}, pair.Metadata)
+	})
+
+	t.Run("profile validity is upper bound", func(t *testing.T) {
+		pair, err := pki.Issue(CertRequest{CN: "short", Profile: "short", Validity: 72 * time.Hour})
+		assert.NoError(t, err)
+		cert, err := decodeCert(pair.CertPemBytes)
+		assert.NoError(t, err)
+		assert.WithinDuration(t, pki.now().Add(24*time.Hour), cert.NotAfter, time.Minute)
+		assert.Equal(t, []string{"short"}, cert.DNSNames)
+	})
+
+	t.Run("csr", func(t *testing.T) {
+		pair, err := pki.Issue(CertRequest{CN: "api", CSRPem: newTestCSR(t, "api")})
+		assert.NoError(t, err)
+		assert.False(t, pair.HasKey())
+		_, err = pki.Issue(CertRequest{CN: "api", CSRPem: []byte("garbage")})
+		assert.Error(t, err)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := pki.Issue(CertRequest{})
+		assert.Error(t, err)
+		_, err = pki.Issue(CertRequest{CN: "sub", CA: true})
+		assert.Error(t, err)
+		_, err = pki.Issue(CertRequest{CN: "forged", Metadata: map[string]string{MetadataRequester: "root"}})
+		assert.Error(t, err)
+		_, err = pki.Issue(CertRequest{CN: "web", Profile: "missing"})
+		assert.Error(t, err)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		pairs, err := pki.IssueBatch([]CertRequest{{CN: "one"}, {}, {CN: "three", CSRPem: newTestCSR(t, "three")}}, 2)
+		batchErr, ok := errors.Cause(err).(*BatchError)
+		if assert.True(t, ok) {
+			assert.Len(t, batchErr.Errors, 1)
+			assert.Error(t, batchErr.Errors[1])
+		}
+		assert.NotNil(t, pairs[0])
+		assert.Nil(t, pairs[1])
+		assert.NotNil(t, pairs[2])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		req := CertRequest{CN: "web", Server: true, DNSNames: []string{"web.example.com"}, Validity: time.Hour, Requester: &Requester{Name: "alice", Method: AuthMethodAPIKey}}
+		data, err := json.Marshal(req)
+		assert.NoError(t, err)
+		decoded := CertRequest{}
+		assert.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, req, decoded)
+	})
+}
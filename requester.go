@@ -0,0 +1,136 @@
+package easyrsa
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MetadataRequester is a metadata tag with principal the pair was issued for, it can`t be set by callers
+const MetadataRequester = "requester"
+
+// Requester is a principal on whose behalf operation is performed
+type Requester struct {
+	Name   string `json:"name"`             // principal, e.g. user, service account or api client
+	Method string `json:"method,omitempty"` // how principal was authenticated, e.g. one of AuthMethod values, empty for local callers
+}
+
+// RequesterFromIdentity return requester of authenticated identity, nil for nil identity
+func RequesterFromIdentity(id *Identity) *Requester {
+	if id == nil {
+		return nil
+	}
+	return &Requester{Name: id.Name, Method: id.Method}
+}
+
+// String return "method:name", or name if method is empty. Empty for nil requester
+func (r *Requester) String() string {
+	if r == nil {
+		return ""
+	}
+	if r.Method == "" {
+		return r.Name
+	}
+	return r.Method + ":" + r.Name
+}
+
+// AuditEvent describe one issuance or revocation
+type AuditEvent struct {
+	Operation string    `json:"operation"`           // AuthOpIssue, AuthOpSign or AuthOpRevoke
+	CN        string    `json:"cn,omitempty"`        // cn of the pair
+	Serial    *big.Int  `json:"serial"`              // serial of the pair
+	Time      time.Time `json:"time"`                // time of operation
+	Requester string    `json:"requester,omitempty"` // Requester.String(), empty if operation is not attributed
+	Reason    string    `json:"reason,omitempty"`    // revocation reason
+	Error     string    `json:"error,omitempty"`     // error of failed operation, e.g. revocation of superseded cert
+}
+
+// AuditSink receive events of completed operations and of failed revocations of superseded certs, e.g. to write audit log, post webhook or count metrics.
+// Sinks are called synchronously and should be fast
+type AuditSink func(event *AuditEvent)
+
+// WithAuditSink add sink of issuance and revocation events
+func WithAuditSink(sink AuditSink) Option {
+	return func(p *PKI) {
+		p.auditSinks = append(p.auditSinks, sink)
+	}
+}
+
+// WebhookAuditSink post events as json to url, http.DefaultClient is used if client is nil.
+// Delivery errors are passed to onError if it`s set
+func WebhookAuditSink(url string, client *http.Client, onError func(err error)) AuditSink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(event *AuditEvent) {
+		err := func() error {
+			body, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				return errors.Wrap(err, "can`t post audit event")
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				return errors.Errorf("webhook respond with %s", resp.Status)
+			}
+			return nil
+		}()
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// NewCertWithRequester generate new pair as NewCert attributed to requester
+func (p *PKI) NewCertWithRequester(requester *Requester, cn string, server bool, groups []string) (*X509Pair, error) {
+	if err := p.requireAttestation(); err != nil {
+		return nil, err
+	}
+	return p.issueRequest(CertRequest{CN: cn, Server: server, Groups: groups, Requester: requester})
+}
+
+// SignCSRWithRequester issue cert for CSR as SignCSR attributed to requester
+func (p *PKI) SignCSRWithRequester(requester *Requester, csrPem []byte, cn string, server bool, groups []string) (*X509Pair, error) {
+	if err := p.requireAttestation(); err != nil {
+		return nil, err
+	}
+	csr, err := decodeCSR(csrPem)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkCSR(csr, cn, ""); err != nil {
+		return nil, err
+	}
+	return p.issueRequest(CertRequest{CN: cn, Server: server, Groups: groups, CSR: csr, Requester: requester})
+}
+
+// RevokeWithRequester revoke pair as Revoke with requester recorded as actor
+func (p *PKI) RevokeWithRequester(requester *Requester, serial *big.Int, reason string) error {
+	return p.Revoke(serial, requester.String(), reason)
+}
+
+// auditIssue send event of stored pair to sinks
+func (p *PKI) auditIssue(pair *X509Pair, csrSigned bool) {
+	if len(p.auditSinks) == 0 {
+		return
+	}
+	event := &AuditEvent{Operation: AuthOpIssue, CN: pair.CN, Serial: pair.Serial, Time: p.now()}
+	if csrSigned {
+		event.Operation = AuthOpSign
+	}
+	event.Requester = pair.Metadata[MetadataRequester]
+	p.emitAudit(event)
+}
+
+func (p *PKI) emitAudit(event *AuditEvent) {
+	for _, sink := range p.auditSinks {
+		sink(event)
+	}
+}
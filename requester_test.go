@@ -0,0 +1,72 @@
+package easyrsa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_Requester(t *testing.T) {
+	events := make([]*AuditEvent, 0)
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithAuditSink(func(event *AuditEvent) {
+		events = append(events, event)
+	}))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	alice := &Requester{Name: "alice", Method: AuthMethodClientCert}
+	pair, err := pki.NewCertWithRequester(alice, "web", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "mtls:alice", pair.Metadata[MetadataRequester])
+	stored, err := pki.Storage.GetBySerial(pair.Serial)
+	assert.NoError(t, err)
+	assert.Equal(t, "mtls:alice", stored.Metadata[MetadataRequester])
+
+	_, err = pki.SignCSRWithRequester(&Requester{Name: "bob"}, newTestCSR(t, "api"), "api", false, nil)
+	assert.NoError(t, err)
+	_, err = pki.NewCert("anonymous", true, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pki.RevokeWithRequester(alice, pair.Serial, "rotated"))
+
+	if assert.Len(t, events, 4) {
+		assert.Equal(t, &AuditEvent{Operation: AuthOpIssue, CN: "web", Serial: pair.Serial, Time: events[0].Time, Requester: "mtls:alice"}, events[0])
+		assert.Equal(t, AuthOpSign, events[1].Operation)
+		assert.Equal(t, "bob", events[1].Requester)
+		assert.Empty(t, events[2].Requester)
+		assert.Equal(t, &AuditEvent{Operation: AuthOpRevoke, CN: "web", Serial: pair.Serial, Time: events[3].Time, Requester: "mtls:alice", Reason: "rotated"}, events[3])
+	}
+
+	stats, err := pki.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"mtls:alice": 1, "bob": 1}, stats.IssuedPerRequester)
+
+	_, err = pki.NewCertWithMetadata("forged", true, nil, map[string]string{MetadataRequester: "root"})
+	assert.Error(t, err)
+}
+
+func TestWebhookAuditSink(t *testing.T) {
+	received := make(chan *AuditEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := &AuditEvent{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(event))
+		received <- event
+		if event.CN == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	var deliveryErr error
+	sink := WebhookAuditSink(server.URL, nil, func(err error) { deliveryErr = err })
+	sink(&AuditEvent{Operation: AuthOpIssue, CN: "web", Requester: "alice"})
+	event := <-received
+	assert.Equal(t, "alice", event.Requester)
+	assert.NoError(t, deliveryErr)
+	sink(&AuditEvent{Operation: AuthOpIssue, CN: "fail"})
+	<-received
+	assert.Error(t, deliveryErr)
+}
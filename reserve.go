@@ -0,0 +1,137 @@
+package easyrsa
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// SerialReserver can be implemented by SerialProvider to allocate several serials at once,
+// e.g. with one round-trip to remote serial backend. Serials are contiguous or random as Next would return
+type SerialReserver interface {
+	Reserve(n int) ([]*big.Int, error) // Reserve return n unique serials
+}
+
+// SerialAdvancer can be implemented by SerialProvider to skip serial used outside of it, e.g. of imported cert.
+// Contiguous providers continue after serial if it`s ahead, random ones don`t need it
+type SerialAdvancer interface {
+	Advance(serial *big.Int) error // Advance make sure Next never return serial
+}
+
+// ReserveSerials return n serials of sp, using SerialReserver if sp implement it
+func ReserveSerials(sp SerialProvider, n int) ([]*big.Int, error) {
+	if n <= 0 {
+		return nil, errors.Errorf("wrong number of serials %d", n)
+	}
+	if reserver, ok := sp.(SerialReserver); ok {
+		return reserver.Reserve(n)
+	}
+	res := make([]*big.Int, 0, n)
+	for len(res) < n {
+		serial, err := sp.Next()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, serial)
+	}
+	return res, nil
+}
+
+// serialRange return n serials following last
+func serialRange(last *big.Int, n int) []*big.Int {
+	res := make([]*big.Int, n)
+	for i := range res {
+		res[i] = new(big.Int).Add(last, big.NewInt(int64(i+1)))
+	}
+	return res
+}
+
+// ReservingSerialProvider implement SerialProvider interface, serving Next from batches reserved from the
+// wrapped provider, e.g. for bulk issuance backed by remote serial backend. Serials left in batch on exit
+// are burned, so contiguous providers get gaps
+type ReservingSerialProvider struct {
+	provider SerialProvider
+	size     int        // serials per reservation
+	mu       sync.Mutex // guard pool and last
+	pool     []*big.Int // reserved serials not returned yet
+	last     *big.Int   // serial returned by last Next, for Release
+}
+
+// NewReservingSerialProvider wrap provider to reserve size serials per round-trip
+func NewReservingSerialProvider(provider SerialProvider, size int) *ReservingSerialProvider {
+	if size <= 0 {
+		size = 1
+	}
+	return &ReservingSerialProvider{provider: provider, size: size}
+}
+
+func (p *ReservingSerialProvider) Next() (*big.Int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.pool) == 0 {
+		pool, err := ReserveSerials(p.provider, p.size)
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t reserve serials")
+		}
+		p.pool = pool
+	}
+	p.last, p.pool = p.pool[0], p.pool[1:]
+	return p.last, nil
+}
+
+// Reserve return n serials, taken from the current batch first
+func (p *ReservingSerialProvider) Reserve(n int) ([]*big.Int, error) {
+	if n <= 0 {
+		return nil, errors.Errorf("wrong number of serials %d", n)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.pool) < n {
+		more, err := ReserveSerials(p.provider, n-len(p.pool))
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t reserve serials")
+		}
+		p.pool = append(p.pool, more...)
+	}
+	res := p.pool[:n:n]
+	p.pool = p.pool[n:]
+	p.last = nil
+	return res, nil
+}
+
+// Release put serial of failed issuance back to the batch if it`s returned by last Next
+func (p *ReservingSerialProvider) Release(serial *big.Int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last == nil || p.last.Cmp(serial) != 0 {
+		return nil
+	}
+	p.pool = append([]*big.Int{p.last}, p.pool...)
+	p.last = nil
+	return nil
+}
+
+// Advance drop serial from the current batch and advance the wrapped provider past it
+func (p *ReservingSerialProvider) Advance(serial *big.Int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pool := p.pool[:0]
+	for _, s := range p.pool {
+		if s.Cmp(serial) != 0 {
+			pool = append(pool, s)
+		}
+	}
+	p.pool = pool
+	if advancer, ok := p.provider.(SerialAdvancer); ok {
+		return advancer.Advance(serial)
+	}
+	return nil
+}
+
+// Remaining return number of reserved serials not returned yet
+func (p *ReservingSerialProvider) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pool)
+}
@@ -0,0 +1,120 @@
+package easyrsa
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingSerialProvider struct {
+	SerialProvider
+	calls int
+}
+
+func (p *countingSerialProvider) Next() (*big.Int, error) {
+	p.calls++
+	return p.SerialProvider.Next()
+}
+
+func (p *countingSerialProvider) Reserve(n int) ([]*big.Int, error) {
+	p.calls++
+	return ReserveSerials(p.SerialProvider, n)
+}
+
+func TestSerialReserver(t *testing.T) {
+	dir := t.TempDir()
+	providers := map[string]SerialProvider{
+		"file":    NewFileSerialProvider(filepath.Join(dir, "serial")),
+		"journal": NewJournalSerialProvider(filepath.Join(dir, "journal")),
+	}
+	for name, sp := range providers {
+		t.Run(name, func(t *testing.T) {
+			serial, err := sp.Next()
+			assert.NoError(t, err)
+			serials, err := ReserveSerials(sp, 3)
+			assert.NoError(t, err)
+			assert.Equal(t, []*big.Int{big.NewInt(2), big.NewInt(3), big.NewInt(4)}, serials)
+			serial, err = sp.Next()
+			assert.NoError(t, err)
+			assert.Equal(t, big.NewInt(5), serial)
+			_, err = ReserveSerials(sp, 0)
+			assert.Error(t, err)
+		})
+	}
+
+	serials, err := ReserveSerials(NewTimeOrderedSerialProvider(), 4)
+	assert.NoError(t, err)
+	for i := 1; i < len(serials); i++ {
+		assert.Equal(t, 1, serials[i].Cmp(serials[i-1]))
+	}
+}
+
+func TestReservingSerialProvider(t *testing.T) {
+	backend := &countingSerialProvider{SerialProvider: NewFileSerialProvider(filepath.Join(t.TempDir(), "serial"))}
+	sp := NewReservingSerialProvider(backend, 10)
+	for i := 1; i <= 12; i++ {
+		serial, err := sp.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewInt(int64(i)), serial)
+	}
+	assert.Equal(t, 2, backend.calls)
+	assert.Equal(t, 8, sp.Remaining())
+
+	// released serial of failed issuance is reused
+	serial, err := sp.Next()
+	assert.NoError(t, err)
+	assert.NoError(t, sp.Release(serial))
+	again, err := sp.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, serial, again)
+	assert.NoError(t, sp.Release(big.NewInt(1)))
+	assert.Equal(t, 7, sp.Remaining())
+
+	serials, err := sp.Reserve(9)
+	assert.NoError(t, err)
+	assert.Len(t, serials, 9)
+	assert.Equal(t, big.NewInt(14), serials[0])
+	assert.Equal(t, big.NewInt(22), serials[8])
+	assert.Equal(t, 3, backend.calls)
+}
+
+func TestPKI_ReservingSerialProvider(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	pki.serialProvider = NewReservingSerialProvider(pki.serialProvider, 16)
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	pairs, err := pki.NewCertBatch([]SigningRequest{{CN: "a"}, {CN: "b"}, {CN: "c"}}, 2)
+	assert.NoError(t, err)
+	seen := map[string]bool{}
+	for _, pair := range pairs {
+		assert.False(t, seen[pair.Serial.String()])
+		seen[pair.Serial.String()] = true
+	}
+}
+
+func TestSerialAdvancer(t *testing.T) {
+	dir := t.TempDir()
+	providers := map[string]SerialProvider{
+		"file":      NewFileSerialProvider(filepath.Join(dir, "serial")),
+		"journal":   NewJournalSerialProvider(filepath.Join(dir, "journal")),
+		"reserving": NewReservingSerialProvider(NewFileSerialProvider(filepath.Join(dir, "reserving")), 10),
+	}
+	for name, sp := range providers {
+		t.Run(name, func(t *testing.T) {
+			advancer := sp.(SerialAdvancer)
+			assert.NoError(t, advancer.Advance(big.NewInt(5)))
+			serial, err := sp.Next()
+			assert.NoError(t, err)
+			assert.Equal(t, big.NewInt(6), serial)
+			// serials behind are not reused
+			assert.NoError(t, advancer.Advance(big.NewInt(7)))
+			assert.NoError(t, advancer.Advance(big.NewInt(2)))
+			serial, err = sp.Next()
+			assert.NoError(t, err)
+			assert.Equal(t, big.NewInt(8), serial)
+		})
+	}
+}
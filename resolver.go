@@ -0,0 +1,180 @@
+package easyrsa
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultRenewBefore is a time before expiration when CertResolver reissue cert
+const DefaultRenewBefore = 7 * 24 * time.Hour
+
+// HostPolicy return error if cert must not be issued on demand for server name
+type HostPolicy func(ctx context.Context, name string) error
+
+// CertResolver resolve TLS certs by SNI server name from storage, issuing missing, expiring or revoked
+// ones on demand if HostPolicy allow it. Resolved certs are cached in memory.
+// GetCertificate can be set as tls.Config.GetCertificate, e.g. for net/http or Traefik,
+// Manager return adapter for Caddy certmagic.Manager interface
+type CertResolver struct {
+	PKI         *PKI           // PKI used to read and issue certs
+	HostPolicy  HostPolicy     // on demand issuance is disabled if nil
+	RenewBefore time.Duration  // DefaultRenewBefore if zero
+	Passphrase  PassphraseFunc // used for encrypted stored keys
+
+	mu    sync.Mutex
+	cache map[string]*tls.Certificate
+	group singleflight.Group
+}
+
+// NewCertResolver create resolver issuing server certs on demand for names allowed by hostPolicy
+func NewCertResolver(pki *PKI, hostPolicy HostPolicy) *CertResolver {
+	return &CertResolver{PKI: pki, HostPolicy: hostPolicy}
+}
+
+// GetCertificate return cert for hello server name, signature match tls.Config.GetCertificate
+func (r *CertResolver) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	ctx := context.Background()
+	if hello.Context() != nil {
+		ctx = hello.Context()
+	}
+	return r.Resolve(ctx, hello.ServerName)
+}
+
+// TLSConfig return server config resolving certs with r
+func (r *CertResolver) TLSConfig() *tls.Config {
+	return &tls.Config{GetCertificate: r.GetCertificate, MinVersion: tls.VersionTLS12}
+}
+
+// Resolve return cached or stored cert for name, issuing new one if needed and allowed
+func (r *CertResolver) Resolve(ctx context.Context, name string) (*tls.Certificate, error) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" {
+		return nil, errors.New("missing server name")
+	}
+	r.mu.Lock()
+	cert, ok := r.cache[name]
+	r.mu.Unlock()
+	if ok && r.fresh(cert.Leaf) {
+		return cert, nil
+	}
+
+	res, err, _ := r.group.Do(name, func() (interface{}, error) {
+		cert, err := r.load(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		if r.cache == nil {
+			r.cache = make(map[string]*tls.Certificate)
+		}
+		r.cache[name] = cert
+		r.mu.Unlock()
+		return cert, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*tls.Certificate), nil
+}
+
+// Forget drop cached cert of name, e.g. after it was revoked
+func (r *CertResolver) Forget(name string) {
+	r.mu.Lock()
+	delete(r.cache, strings.ToLower(strings.TrimSuffix(name, ".")))
+	r.mu.Unlock()
+}
+
+// load return last stored usable pair of name or issue new one
+func (r *CertResolver) load(ctx context.Context, name string) (*tls.Certificate, error) {
+	pair, err := r.PKI.Storage.GetLastByCn(name)
+	if err != nil {
+		if _, ok := errors.Cause(err).(*NotExist); !ok {
+			return nil, errors.Wrapf(err, "can`t get cert for %s", name)
+		}
+		pair = nil
+	}
+	if pair != nil {
+		cert, err := r.certificate(pair)
+		if err == nil && r.fresh(cert.Leaf) && cert.Leaf.VerifyHostname(name) == nil && !r.PKI.IsRevoked(pair.Serial) {
+			return cert, nil
+		}
+	}
+
+	if r.HostPolicy == nil {
+		return nil, errors.WithStack(NewNotExist("no usable cert for " + name))
+	}
+	if err := r.HostPolicy(ctx, name); err != nil {
+		return nil, errors.Wrapf(err, "on demand issuance for %s is not allowed", name)
+	}
+	pair, err = r.PKI.NewCert(name, true, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can`t issue cert for %s", name)
+	}
+	return r.certificate(pair)
+}
+
+// certificate convert pair to tls.Certificate with intermediates
+func (r *CertResolver) certificate(pair *X509Pair) (*tls.Certificate, error) {
+	return tlsCertificate(pair, r.Passphrase)
+}
+
+// tlsCertificate convert pair to tls.Certificate with intermediates
+func tlsCertificate(pair *X509Pair, passphrase PassphraseFunc) (*tls.Certificate, error) {
+	signer, leaf, err := pair.DecodeSigner(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if signer == nil {
+		return nil, errors.New("pair has no key")
+	}
+	res := &tls.Certificate{PrivateKey: signer, Leaf: leaf}
+	rest := pair.FullChainPEM()
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == PEMCertificateBlock {
+			res.Certificate = append(res.Certificate, block.Bytes)
+		}
+	}
+	return res, nil
+}
+
+// fresh return true if cert is valid longer than RenewBefore
+func (r *CertResolver) fresh(leaf *x509.Certificate) bool {
+	before := r.RenewBefore
+	if before == 0 {
+		before = DefaultRenewBefore
+	}
+	now := r.PKI.now()
+	return !now.Before(leaf.NotBefore) && now.Add(before).Before(leaf.NotAfter)
+}
+
+// Manager return adapter implementing Caddy certmagic.Manager
+func (r *CertResolver) Manager() CertManager {
+	return CertManager{resolver: r}
+}
+
+// CertManager adapt CertResolver to Caddy certmagic.Manager interface
+type CertManager struct {
+	resolver *CertResolver
+}
+
+// GetCertificate return cert for hello server name
+func (m CertManager) GetCertificate(ctx context.Context, hello *tls.ClientHelloInfo) (tls.Certificate, error) {
+	cert, err := m.resolver.Resolve(ctx, hello.ServerName)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return *cert, nil
+}
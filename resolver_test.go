@@ -0,0 +1,78 @@
+package easyrsa
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertResolver(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	issued := 0
+	policy := func(ctx context.Context, name string) error {
+		if !strings.HasSuffix(name, ".pki.local") {
+			return errors.New("unknown host")
+		}
+		issued++
+		return nil
+	}
+	r := NewCertResolver(pki, policy)
+
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{ServerName: "Web.pki.local."})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, issued)
+	assert.Equal(t, []string{"web.pki.local"}, cert.Leaf.DNSNames)
+	cached, err := r.GetCertificate(&tls.ClientHelloInfo{ServerName: "web.pki.local"})
+	assert.NoError(t, err)
+	assert.True(t, cert == cached)
+	assert.Equal(t, 1, issued)
+
+	_, err = r.GetCertificate(&tls.ClientHelloInfo{ServerName: "evil.com"})
+	assert.Error(t, err)
+	_, err = r.GetCertificate(&tls.ClientHelloInfo{})
+	assert.Error(t, err)
+
+	t.Run("storage", func(t *testing.T) {
+		stored := NewCertResolver(pki, nil)
+		got, err := stored.Manager().GetCertificate(context.Background(), &tls.ClientHelloInfo{ServerName: "web.pki.local"})
+		assert.NoError(t, err)
+		assert.Equal(t, cert.Leaf.SerialNumber, got.Leaf.SerialNumber)
+		_, err = stored.Resolve(context.Background(), "api.pki.local")
+		_, ok := errors.Cause(err).(*NotExist)
+		assert.True(t, ok)
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		assert.NoError(t, pki.RevokeOne(cert.Leaf.SerialNumber))
+		r.Forget("web.pki.local")
+		got, err := r.Resolve(context.Background(), "web.pki.local")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, issued)
+		assert.NotEqual(t, cert.Leaf.SerialNumber, got.Leaf.SerialNumber)
+	})
+
+	t.Run("handshake", func(t *testing.T) {
+		_, caCert, err := ca.Decode()
+		assert.NoError(t, err)
+		roots := x509.NewCertPool()
+		roots.AddCert(caCert)
+		server, client := net.Pipe()
+		defer client.Close()
+		go func() {
+			defer server.Close()
+			_ = tls.Server(server, r.TLSConfig()).Handshake()
+		}()
+		conn := tls.Client(client, &tls.Config{ServerName: "web.pki.local", RootCAs: roots})
+		assert.NoError(t, conn.Handshake())
+	})
+}
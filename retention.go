@@ -0,0 +1,117 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetentionPolicy describe which superseded CA generations are collected by CollectSuperseded.
+// Generation is a CA pair with all pairs signed by it, it`s collected only after all of them expired
+type RetentionPolicy struct {
+	KeepGenerations int           // newest CA generations never collected, the last CA is always kept
+	Grace           time.Duration // time after the last NotAfter of generation before it`s collected
+	Archive         KeyStorage    // pairs are put here before deletion, pruned without archive if nil
+	DryRun          bool          // only report generations, nothing is archived or deleted
+}
+
+// CollectedGeneration is a CA generation archived or pruned by CollectSuperseded
+type CollectedGeneration struct {
+	CA       *big.Int   // CA serial
+	Leafs    []*big.Int // serials of pairs signed by the CA
+	NotAfter time.Time  // the last NotAfter of CA and leafs
+}
+
+type generation struct {
+	ca       *X509Pair
+	cert     *x509.Certificate
+	leafs    []*X509Pair
+	notAfter time.Time
+}
+
+// CollectSuperseded archive or prune CA generations superseded by newer CAs whose certs all expired.
+// Undecodable pairs and pairs with unknown issuer are never touched
+func (p *PKI) CollectSuperseded(policy RetentionPolicy) ([]*CollectedGeneration, error) {
+	caPairs, err := p.Storage.GetByCN("ca")
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get ca pairs")
+	}
+	sort.Slice(caPairs, func(i, j int) bool {
+		return caPairs[i].Serial.Cmp(caPairs[j].Serial) == 1
+	})
+	cas := make([]*x509.Certificate, 0, len(caPairs))
+	generations := make(map[*x509.Certificate]*generation)
+	for _, pair := range caPairs {
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil {
+			continue
+		}
+		cas = append(cas, cert)
+		generations[cert] = &generation{ca: pair, cert: cert, notAfter: cert.NotAfter}
+	}
+
+	err = ForEach(p.Storage, func(pair *X509Pair) error {
+		if pair.CN == "ca" || pair.CN == TrustAnchorCN {
+			return nil
+		}
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil {
+			return nil
+		}
+		issuer := findIssuer(cert, cas)
+		if issuer == nil {
+			return nil
+		}
+		gen := generations[issuer]
+		gen.leafs = append(gen.leafs, pair)
+		if cert.NotAfter.After(gen.notAfter) {
+			gen.notAfter = cert.NotAfter
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get pairs for retention")
+	}
+
+	keep := policy.KeepGenerations
+	if keep < 1 {
+		keep = 1
+	}
+	now := p.now()
+	res := make([]*CollectedGeneration, 0)
+	for i, cert := range cas {
+		gen := generations[cert]
+		if i < keep || now.Before(gen.notAfter.Add(policy.Grace)) {
+			continue
+		}
+		collected := &CollectedGeneration{CA: gen.ca.Serial, NotAfter: gen.notAfter}
+		for _, leaf := range gen.leafs {
+			collected.Leafs = append(collected.Leafs, leaf.Serial)
+		}
+		if !policy.DryRun {
+			if err := p.collect(gen, policy.Archive); err != nil {
+				return res, err
+			}
+		}
+		res = append(res, collected)
+	}
+	return res, nil
+}
+
+// collect archive and delete leafs first, so interrupted collection never leave leafs without their CA
+func (p *PKI) collect(gen *generation, archive KeyStorage) error {
+	for _, pair := range append(gen.leafs, gen.ca) {
+		if archive != nil {
+			if err := archive.Put(pair); err != nil {
+				return errors.Wrapf(err, "can`t archive pair %s", pair.Serial.Text(16))
+			}
+		}
+		if err := p.Storage.DeleteBySerial(pair.Serial); err != nil {
+			return errors.Wrapf(err, "can`t delete pair %s", pair.Serial.Text(16))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package easyrsa
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_CollectSuperseded(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithValidity(24*time.Hour, time.Hour))
+	defer cleanup()
+	archiveDir := filepath.Join(getTestDir(), "retention_archive")
+	_ = os.MkdirAll(archiveDir, 0700)
+	defer os.RemoveAll(archiveDir)
+	archive := NewDirKeyStorage(archiveDir)
+
+	oldCa, err := pki.NewCa()
+	assert.NoError(t, err)
+	oldLeaf, err := pki.NewCert("old", false, nil)
+	assert.NoError(t, err)
+	newCa, err := pki.NewCa()
+	assert.NoError(t, err)
+	newLeaf, err := pki.NewCert("new", false, nil)
+	assert.NoError(t, err)
+
+	t.Run("not expired", func(t *testing.T) {
+		res, err := pki.CollectSuperseded(RetentionPolicy{})
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	later := time.Now().Add(48 * time.Hour)
+	pki.clock = func() time.Time { return later }
+
+	t.Run("grace", func(t *testing.T) {
+		res, err := pki.CollectSuperseded(RetentionPolicy{Grace: 30 * 24 * time.Hour})
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("keep generations", func(t *testing.T) {
+		res, err := pki.CollectSuperseded(RetentionPolicy{KeepGenerations: 2})
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		res, err := pki.CollectSuperseded(RetentionPolicy{DryRun: true})
+		assert.NoError(t, err)
+		if assert.Len(t, res, 1) {
+			assert.Equal(t, oldCa.Serial, res[0].CA)
+			assert.Equal(t, oldLeaf.Serial, res[0].Leafs[0])
+		}
+		_, err = pki.Storage.GetBySerial(oldLeaf.Serial)
+		assert.NoError(t, err)
+	})
+
+	t.Run("archive", func(t *testing.T) {
+		res, err := pki.CollectSuperseded(RetentionPolicy{Archive: archive})
+		assert.NoError(t, err)
+		assert.Len(t, res, 1)
+		for _, pair := range []*X509Pair{oldCa, oldLeaf} {
+			_, err = pki.Storage.GetBySerial(pair.Serial)
+			assert.Error(t, err)
+			_, err = archive.GetBySerial(pair.Serial)
+			assert.NoError(t, err)
+		}
+		for _, pair := range []*X509Pair{newCa, newLeaf} {
+			_, err = pki.Storage.GetBySerial(pair.Serial)
+			assert.NoError(t, err)
+		}
+		res, err = pki.CollectSuperseded(RetentionPolicy{})
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+	})
+}
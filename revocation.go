@@ -0,0 +1,231 @@
+package easyrsa
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"crypto/x509/pkix"
+
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RevocationEvent is a changelog record of one revocation
+type RevocationEvent struct {
+	Serial *big.Int  `json:"serial"`           // revoked serial
+	CN     string    `json:"cn,omitempty"`     // cn of revoked pair if it`s in storage
+	Time   time.Time `json:"time"`             // revocation time as in CRL
+	Actor  string    `json:"actor,omitempty"`  // who revoked
+	Reason string    `json:"reason,omitempty"` // why revoked
+}
+
+// RevocationLog keep revocation events separately from the CRL
+type RevocationLog interface {
+	Append(event *RevocationEvent) error           // Append event to the log.
+	Since(t time.Time) ([]*RevocationEvent, error) // Since return events revoked after t in append order.
+}
+
+// WithRevocationLog record every revocation to log
+func WithRevocationLog(log RevocationLog) Option {
+	return func(p *PKI) {
+		p.revocationLog = log
+	}
+}
+
+// Revoke revoke one pair with serial, actor and reason are recorded to revocation log
+func (p *PKI) Revoke(serial *big.Int, actor, reason string) error {
+	return p.RevokeWithReasonCode(serial, CRLReasonUnspecified, actor, reason)
+}
+
+// RevokeWithReasonCode revoke one pair with serial as Revoke do, CRL entry get reason code extension unless code is
+// CRLReasonUnspecified, so scoped CRLs and OCSP responses can tell e.g. key compromise from superseded certs
+func (p *PKI) RevokeWithReasonCode(serial *big.Int, code int, actor, reason string) (err error) {
+	span := p.startSpan(AuthOpRevoke, spanSerial(serial), attribute.Int("easyrsa.reason_code", code))
+	defer func() {
+		endSpan(span, err)
+	}()
+	entry := pkix.RevokedCertificate{SerialNumber: serial}
+	if code != CRLReasonUnspecified {
+		ext, err := crlReasonExtension(code)
+		if err != nil {
+			return err
+		}
+		entry.Extensions = []pkix.Extension{ext}
+	}
+	p.crlMu.Lock()
+	defer p.crlMu.Unlock()
+	oldList, err := p.GetCRL()
+	if err != nil {
+		return errors.Wrap(err, "can`t get current crl")
+	}
+	now := p.now()
+	entry.RevocationTime = now
+	list := append(oldList.TBSCertList.RevokedCertificates, entry)
+	if _, err := p.signCRL(list); err != nil {
+		return err
+	}
+	return p.logRevocations([]*big.Int{serial}, now, actor, reason)
+}
+
+// RevokeCert revoke certificate given as pem by it`s serial. Certificate must be signed by one of stored CAs
+// with subject key id matching certificate authority key id, so certs of other PKIs with colliding serials are rejected
+func (p *PKI) RevokeCert(certPem []byte) error {
+	cert, err := decodeCert(certPem)
+	if err != nil {
+		return err
+	}
+	cas := make([]*x509.Certificate, 0)
+	err = ForEachByCN(p.Storage, "ca", func(pair *X509Pair) error {
+		if ca, err := decodeCert(pair.CertPemBytes); err == nil {
+			cas = append(cas, ca)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "can`t get ca certs")
+	}
+	issuer := resolveIssuer(cert.AuthorityKeyId, cas, func(ca *x509.Certificate) bool {
+		if len(cert.AuthorityKeyId) > 0 && len(ca.SubjectKeyId) > 0 && !bytes.Equal(cert.AuthorityKeyId, ca.SubjectKeyId) {
+			return false
+		}
+		return cert.CheckSignatureFrom(ca) == nil
+	})
+	if issuer == nil {
+		return errors.WithStack(NewPolicyViolation("certificate is not issued by this pki"))
+	}
+	return p.RevokeOne(cert.SerialNumber)
+}
+
+// RevokeByFingerprint revoke stored certificate with sha256 fingerprint given as hex, colons are allowed
+// as printed by "openssl x509 -fingerprint -sha256". NotExist is returned if no stored certificate match
+func (p *PKI) RevokeByFingerprint(fingerprint string) error {
+	want, err := hex.DecodeString(strings.Replace(strings.TrimSpace(fingerprint), ":", "", -1))
+	if err != nil || len(want) != sha256.Size {
+		return errors.Errorf("wrong sha256 fingerprint %q", fingerprint)
+	}
+	var found *X509Pair
+	err = ForEach(p.Storage, func(pair *X509Pair) error {
+		block := findBlock(pair.CertPemBytes, func(t string) bool { return t == PEMCertificateBlock })
+		if block == nil {
+			return nil
+		}
+		if sum := sha256.Sum256(block.Bytes); bytes.Equal(sum[:], want) {
+			found = pair
+			return StopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "can`t search certificate")
+	}
+	if found == nil {
+		return errors.WithStack(NewNotExist("no certificate with fingerprint " + fingerprint))
+	}
+	return p.RevokeCert(found.CertPemBytes)
+}
+
+// RevocationsSince return revocation events after t, so consumers can sync incrementally instead of parsing full CRL
+func (p *PKI) RevocationsSince(t time.Time) ([]*RevocationEvent, error) {
+	if p.revocationLog == nil {
+		return nil, errors.New("revocation log is not configured")
+	}
+	return p.revocationLog.Since(t)
+}
+
+func (p *PKI) logRevocations(serials []*big.Int, now time.Time, actor, reason string) error {
+	if p.revocationLog == nil && len(p.auditSinks) == 0 {
+		return nil
+	}
+	for _, serial := range serials {
+		event := &RevocationEvent{Serial: serial, Time: now, Actor: actor, Reason: reason}
+		if pair, err := p.Storage.GetBySerial(serial); err == nil {
+			event.CN = pair.CN
+		}
+		p.emitAudit(&AuditEvent{Operation: AuthOpRevoke, CN: event.CN, Serial: serial, Time: now, Requester: actor, Reason: reason})
+		if p.revocationLog == nil {
+			continue
+		}
+		if err := p.revocationLog.Append(event); err != nil {
+			return errors.Wrap(err, "crl is updated but can`t log revocation")
+		}
+	}
+	return nil
+}
+
+// FileRevocationLog implement RevocationLog interface with json lines file
+type FileRevocationLog struct {
+	locker *flock.Flock
+	path   string
+}
+
+func NewFileRevocationLog(path string) *FileRevocationLog {
+	return &FileRevocationLog{locker: flock.New(path + ".lock"), path: path}
+}
+
+func (l *FileRevocationLog) Append(event *RevocationEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "can`t encode revocation event")
+	}
+	if err := l.locker.Lock(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = l.locker.Unlock()
+	}()
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return errors.Wrap(err, "can`t open revocation log")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "can`t write revocation log")
+	}
+	return errors.Wrap(file.Sync(), "can`t sync revocation log")
+}
+
+func (l *FileRevocationLog) Since(t time.Time) ([]*RevocationEvent, error) {
+	if err := l.locker.RLock(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = l.locker.Unlock()
+	}()
+	res := make([]*RevocationEvent, 0)
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t open revocation log")
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		event := &RevocationEvent{}
+		if err := json.Unmarshal(line, event); err != nil {
+			return nil, errors.Wrap(err, "can`t parse revocation log")
+		}
+		if event.Time.After(t) {
+			res = append(res, event)
+		}
+	}
+	return res, errors.Wrap(scanner.Err(), "can`t read revocation log")
+}
@@ -0,0 +1,84 @@
+package easyrsa
+
+import (
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_RevocationsSince(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	_, _ = pki.NewCa()
+	_, err := pki.RevocationsSince(time.Time{})
+	assert.Error(t, err)
+
+	pki.revocationLog = NewFileRevocationLog(filepath.Join(testData, "revocations.jsonl"))
+	events, err := pki.RevocationsSince(time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	client, _ := pki.NewCert("client", false, []string{""})
+	assert.NoError(t, pki.Revoke(client.Serial, "alice", "key compromise"))
+	mark := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, pki.RevokeOne(big.NewInt(42)))
+
+	events, err = pki.RevocationsSince(time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, client.Serial, events[0].Serial)
+	assert.Equal(t, "client", events[0].CN)
+	assert.Equal(t, "alice", events[0].Actor)
+	assert.Equal(t, "key compromise", events[0].Reason)
+	assert.Equal(t, "", events[1].CN)
+
+	events, err = pki.RevocationsSince(mark)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, big.NewInt(42), events[0].Serial)
+	assert.True(t, pki.IsRevoked(client.Serial))
+}
+
+func TestPKI_RevokeCert(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	client, err := pki.NewCert("client", false, nil)
+	assert.NoError(t, err)
+	server, err := pki.NewCert("server", true, nil)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	other := NewPKI(NewDirKeyStorage(dir), NewFileSerialProvider(filepath.Join(dir, "serial")),
+		NewFileCRLHolder(filepath.Join(dir, "crl.pem")), pkix.Name{}, WithKeySize(1024))
+	_, err = other.NewCa()
+	assert.NoError(t, err)
+	foreign, err := other.NewCert("client", false, nil)
+	assert.NoError(t, err)
+	assert.True(t, isPolicyViolation(pki.RevokeCert(foreign.CertPemBytes)))
+	assert.Error(t, pki.RevokeCert([]byte("garbage")))
+
+	assert.NoError(t, pki.RevokeCert(client.CertPemBytes))
+	assert.True(t, pki.IsRevoked(client.Serial))
+	assert.False(t, pki.IsRevoked(server.Serial))
+
+	cert, err := decodeCert(server.CertPemBytes)
+	assert.NoError(t, err)
+	sum := sha256.Sum256(cert.Raw)
+	err = pki.RevokeByFingerprint(strings.Repeat("00:", 31) + "00")
+	_, ok := errors.Cause(err).(*NotExist)
+	assert.True(t, ok)
+	assert.Error(t, pki.RevokeByFingerprint("abc"))
+	assert.NoError(t, pki.RevokeByFingerprint(strings.ToUpper(hex.EncodeToString(sum[:]))))
+	assert.True(t, pki.IsRevoked(server.Serial))
+}
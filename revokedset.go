@@ -0,0 +1,165 @@
+package easyrsa
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RevokedSet is a verification side hash set of revoked serials loaded from CRL holder, for gateways
+// checking revocation on every connection. Lookups are lock free and never touch the holder,
+// Refresh or RunRefresh reload the set and swap it atomically, a failed refresh keep the previous set
+type RevokedSet struct {
+	lookups  uint64 // IsRevoked calls, first for atomic alignment
+	revoked  uint64 // IsRevoked calls returned true
+	holder   CRLHolder
+	Issuers  []*x509.Certificate // CRL must be signed by one of them, the CRL is trusted as is if empty
+	MaxAge   time.Duration       // set older than MaxAge or past CRL next update is stale, only next update matter if zero
+	FailOpen bool                // treat serials as not revoked while set is not loaded or is stale, they are revoked otherwise
+	now      func() time.Time
+	set      atomic.Value // *revokedSnapshot
+}
+
+type revokedSnapshot struct {
+	serials    map[string]struct{}
+	loaded     time.Time
+	thisUpdate time.Time
+	nextUpdate time.Time
+}
+
+// NewRevokedSet return empty set of holder, call Refresh or RunRefresh to load it
+func NewRevokedSet(holder CRLHolder) *RevokedSet {
+	return &RevokedSet{holder: holder, now: time.Now}
+}
+
+// Refresh load CRL from holder and replace the set
+func (s *RevokedSet) Refresh() error {
+	list, err := s.holder.Get()
+	if err != nil {
+		return errors.Wrap(err, "can`t get crl")
+	}
+	if err := s.verify(list); err != nil {
+		return err
+	}
+	snapshot := &revokedSnapshot{
+		serials:    make(map[string]struct{}, len(list.TBSCertList.RevokedCertificates)),
+		loaded:     s.now(),
+		thisUpdate: list.TBSCertList.ThisUpdate,
+		nextUpdate: list.TBSCertList.NextUpdate,
+	}
+	for _, entry := range list.TBSCertList.RevokedCertificates {
+		snapshot.serials[string(entry.SerialNumber.Bytes())] = struct{}{}
+	}
+	s.set.Store(snapshot)
+	return nil
+}
+
+func (s *RevokedSet) verify(list *pkix.CertificateList) error {
+	if len(s.Issuers) == 0 {
+		return nil
+	}
+	var err error
+	for _, issuer := range s.Issuers {
+		if err = VerifyCRL(list, issuer); err == nil {
+			return nil
+		}
+	}
+	return errors.Wrap(err, "crl is not signed by issuers")
+}
+
+// RunRefresh call Refresh every interval until ctx is done, errors are passed to onError if it`s not nil
+func (s *RevokedSet) RunRefresh(ctx context.Context, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Refresh(); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *RevokedSet) snapshot() *revokedSnapshot {
+	snapshot, _ := s.set.Load().(*revokedSnapshot)
+	return snapshot
+}
+
+func (s *RevokedSet) fresh(snapshot *revokedSnapshot) bool {
+	if snapshot == nil {
+		return false
+	}
+	now := s.now()
+	if !snapshot.nextUpdate.IsZero() && now.After(snapshot.nextUpdate) {
+		return false
+	}
+	return s.MaxAge <= 0 || now.Sub(snapshot.loaded) <= s.MaxAge
+}
+
+// Stale return true if set is not loaded, is older than MaxAge or CRL is past next update
+func (s *RevokedSet) Stale() bool {
+	return !s.fresh(s.snapshot())
+}
+
+// IsRevoked return true if serial is in the set. Stale set fail closed, every serial is revoked, unless FailOpen
+func (s *RevokedSet) IsRevoked(serial *big.Int) bool {
+	atomic.AddUint64(&s.lookups, 1)
+	snapshot := s.snapshot()
+	if !s.fresh(snapshot) {
+		if !s.FailOpen {
+			atomic.AddUint64(&s.revoked, 1)
+			return true
+		}
+		if snapshot == nil {
+			return false
+		}
+	}
+	_, ok := snapshot.serials[string(serial.Bytes())]
+	if ok {
+		atomic.AddUint64(&s.revoked, 1)
+	}
+	return ok
+}
+
+// VerifyPeerCertificate return error if any of peer certs is revoked,
+// signature match tls.Config.VerifyPeerCertificate
+func (s *RevokedSet) VerifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return errors.Wrap(err, "can`t parse peer certificate")
+		}
+		if s.IsRevoked(cert.SerialNumber) {
+			return errors.Errorf("certificate %s is revoked", cert.SerialNumber.Text(16))
+		}
+	}
+	return nil
+}
+
+// RevokedSetStats is a state and counters of RevokedSet
+type RevokedSetStats struct {
+	Entries    int       // revoked serials in set
+	Loaded     time.Time // last successful refresh, zero if set is not loaded
+	ThisUpdate time.Time // loaded CRL this update
+	NextUpdate time.Time // loaded CRL next update
+	Lookups    uint64    // IsRevoked calls
+	Revoked    uint64    // IsRevoked calls returned true, fail closed ones included
+}
+
+// Stats return state and counters of set
+func (s *RevokedSet) Stats() RevokedSetStats {
+	res := RevokedSetStats{Lookups: atomic.LoadUint64(&s.lookups), Revoked: atomic.LoadUint64(&s.revoked)}
+	if snapshot := s.snapshot(); snapshot != nil {
+		res.Entries = len(snapshot.serials)
+		res.Loaded, res.ThisUpdate, res.NextUpdate = snapshot.loaded, snapshot.thisUpdate, snapshot.nextUpdate
+	}
+	return res
+}
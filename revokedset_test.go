@@ -0,0 +1,70 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevokedSet(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+	_, caCert, err := ca.Decode()
+	assert.NoError(t, err)
+	alice, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	bob, err := pki.NewCert("bob", false, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pki.Revoke(alice.Serial, "admin", "test"))
+
+	set := NewRevokedSet(pki.crlHolder)
+	set.Issuers = []*x509.Certificate{caCert}
+	assert.True(t, set.Stale())
+	assert.True(t, set.IsRevoked(bob.Serial))
+	set.FailOpen = true
+	assert.False(t, set.IsRevoked(bob.Serial))
+	set.FailOpen = false
+
+	assert.NoError(t, set.Refresh())
+	assert.False(t, set.Stale())
+	assert.True(t, set.IsRevoked(alice.Serial))
+	assert.False(t, set.IsRevoked(bob.Serial))
+	assert.False(t, set.IsRevoked(big.NewInt(424242)))
+	stats := set.Stats()
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, uint64(5), stats.Lookups)
+	assert.Equal(t, uint64(2), stats.Revoked)
+
+	_, aliceCert, err := alice.Decode()
+	assert.NoError(t, err)
+	_, bobCert, err := bob.Decode()
+	assert.NoError(t, err)
+	assert.Error(t, set.VerifyPeerCertificate([][]byte{aliceCert.Raw, caCert.Raw}, nil))
+	assert.NoError(t, set.VerifyPeerCertificate([][]byte{bobCert.Raw, caCert.Raw}, nil))
+
+	set.MaxAge = time.Minute
+	set.now = func() time.Time { return time.Now().Add(time.Hour) }
+	assert.True(t, set.Stale())
+	assert.True(t, set.IsRevoked(bob.Serial))
+	set.now = time.Now
+
+	// failed refresh keep the previous set
+	dir := t.TempDir()
+	foreign := NewPKI(NewDirKeyStorage(dir), NewFileSerialProvider(filepath.Join(dir, "serial")),
+		NewFileCRLHolder(filepath.Join(dir, "crl.pem")), pkix.Name{}, WithKeySize(1024))
+	foreignCA, err := foreign.NewCa()
+	assert.NoError(t, err)
+	_, foreignCert, err := foreignCA.Decode()
+	assert.NoError(t, err)
+	set.Issuers = []*x509.Certificate{foreignCert}
+	assert.Error(t, set.Refresh())
+	assert.True(t, set.IsRevoked(alice.Serial))
+	assert.False(t, set.IsRevoked(bob.Serial))
+}
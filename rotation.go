@@ -0,0 +1,137 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithRotationOverlap set time after CA rotation when leafs of the superseded CA are still trusted
+// and should be reissued under the new CA with ReissuePinned
+func WithRotationOverlap(overlap time.Duration) Option {
+	return func(p *PKI) {
+		p.rotationOverlap = overlap
+	}
+}
+
+// RotationStatus describe progress of moving leafs from superseded CAs to the last CA
+type RotationStatus struct {
+	CA        *big.Int        // serial of the last CA
+	WindowEnd time.Time       // end of overlap window, zero if no overlap configured
+	Overdue   bool            // window is over and some CNs are still pinned
+	Pinned    map[string]bool // CNs whose newest valid pair is issued by a superseded CA
+	Reissued  []*X509Pair     // pairs reissued by ReissuePinned
+}
+
+// RotateCA create new CA generation, leafs of the old one are reported by RotationStatus until reissued
+func (p *PKI) RotateCA() (*X509Pair, *RotationStatus, error) {
+	ca, err := p.NewCa()
+	if err != nil {
+		return nil, nil, err
+	}
+	status, err := p.RotationStatus()
+	return ca, status, err
+}
+
+// RotationStatus report CNs still pinned to superseded CAs. CA, trust anchor and CRL signer pairs are not reported,
+// CRL signer must be issued for the new CA with NewCRLSigner
+func (p *PKI) RotationStatus() (*RotationStatus, error) {
+	status, _, err := p.rotationStatus()
+	return status, err
+}
+
+// ReissuePinned reissue newest pair of every pinned CN under the last CA as RenewBatch do.
+// It should be scheduled periodically during the overlap window, old pairs are not revoked
+func (p *PKI) ReissuePinned(parallelism int) (*RotationStatus, error) {
+	status, pinned, err := p.rotationStatus()
+	if err != nil {
+		return nil, err
+	}
+	cns := make([]string, 0, len(pinned))
+	for cn := range pinned {
+		cns = append(cns, cn)
+	}
+	sort.Strings(cns)
+	serials := make([]*big.Int, 0, len(cns))
+	for _, cn := range cns {
+		serials = append(serials, pinned[cn])
+	}
+	reissued, err := p.RenewBatch(serials, parallelism)
+	for i, pair := range reissued {
+		if pair != nil {
+			delete(status.Pinned, cns[i])
+			status.Reissued = append(status.Reissued, pair)
+		}
+	}
+	status.Overdue = status.Overdue && len(status.Pinned) > 0
+	return status, err
+}
+
+// rotationStatus return status and serials of newest pinned pairs by CN
+func (p *PKI) rotationStatus() (*RotationStatus, map[string]*big.Int, error) {
+	caPair, err := p.GetLastCA()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can`t get ca pair")
+	}
+	lastCA, err := decodeCert(caPair.CertPemBytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can`t parse ca cert")
+	}
+	cas, _, err := p.caCerts()
+	if err != nil {
+		return nil, nil, err
+	}
+	revoked := make(map[string]bool)
+	list, err := p.GetCRL()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can`t get crl")
+	}
+	for _, cert := range list.TBSCertList.RevokedCertificates {
+		revoked[cert.SerialNumber.Text(16)] = true
+	}
+
+	now := p.now()
+	newest := make(map[string]*big.Int)
+	pinned := make(map[string]bool)
+	err = ForEach(p.Storage, func(pair *X509Pair) error {
+		if pair.CN == "ca" || pair.CN == TrustAnchorCN || pair.CN == CRLSignerCN {
+			return nil
+		}
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil || cert.IsCA || revoked[pair.Serial.Text(16)] || now.After(cert.NotAfter) {
+			return nil
+		}
+		if last, ok := newest[pair.CN]; ok && last.Cmp(pair.Serial) > 0 {
+			return nil
+		}
+		newest[pair.CN] = pair.Serial
+		issuer := findIssuer(cert, cas)
+		pinned[pair.CN] = issuer != nil && !issuer.Equal(lastCA) && !sameKey(issuer, lastCA)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can`t get pairs for rotation")
+	}
+
+	status := &RotationStatus{CA: caPair.Serial, Pinned: make(map[string]bool)}
+	serials := make(map[string]*big.Int)
+	for cn, isPinned := range pinned {
+		if isPinned {
+			status.Pinned[cn] = true
+			serials[cn] = newest[cn]
+		}
+	}
+	if p.rotationOverlap > 0 {
+		status.WindowEnd = lastCA.NotBefore.Add(NotBeforeBackdate).Add(p.rotationOverlap)
+		status.Overdue = now.After(status.WindowEnd) && len(status.Pinned) > 0
+	}
+	return status, serials, nil
+}
+
+// sameKey check that both certs carry the same key, e.g. cross signed copies of the last CA
+func sameKey(a, b *x509.Certificate) bool {
+	return string(a.RawSubjectPublicKeyInfo) == string(b.RawSubjectPublicKeyInfo)
+}
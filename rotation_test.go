@@ -0,0 +1,63 @@
+package easyrsa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_RotateCA(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithRotationOverlap(7*24*time.Hour))
+	defer cleanup()
+	oldCa, err := pki.NewCa()
+	assert.NoError(t, err)
+	server, err := pki.NewCert("server", true, nil)
+	assert.NoError(t, err)
+	client, err := pki.NewCert("client", false, []string{"admins"})
+	assert.NoError(t, err)
+	revoked, err := pki.NewCert("revoked", false, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pki.RevokeOne(revoked.Serial))
+
+	status, err := pki.RotationStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, oldCa.Serial, status.CA)
+	assert.Empty(t, status.Pinned)
+
+	newCa, status, err := pki.RotateCA()
+	assert.NoError(t, err)
+	assert.Equal(t, newCa.Serial, status.CA)
+	assert.Equal(t, map[string]bool{"server": true, "client": true}, status.Pinned)
+	assert.False(t, status.Overdue)
+	assert.WithinDuration(t, time.Now().Add(7*24*time.Hour), status.WindowEnd, time.Minute)
+
+	later := time.Now().Add(8 * 24 * time.Hour)
+	pki.clock = func() time.Time { return later }
+	status, err = pki.RotationStatus()
+	assert.NoError(t, err)
+	assert.True(t, status.Overdue)
+
+	status, err = pki.ReissuePinned(2)
+	assert.NoError(t, err)
+	assert.Empty(t, status.Pinned)
+	assert.False(t, status.Overdue)
+	assert.Len(t, status.Reissued, 2)
+	_, newCaCert, _ := newCa.Decode()
+	for _, pair := range status.Reissued {
+		cert, err := decodeCert(pair.CertPemBytes)
+		assert.NoError(t, err)
+		assert.NoError(t, cert.CheckSignatureFrom(newCaCert))
+		if pair.CN == "client" {
+			assert.Equal(t, []string{"admins"}, cert.ExcludedDNSDomains)
+		}
+	}
+	_, err = pki.Storage.GetBySerial(server.Serial)
+	assert.NoError(t, err, "old pairs are kept")
+	_, err = pki.Storage.GetBySerial(client.Serial)
+	assert.NoError(t, err)
+
+	status, err = pki.RotationStatus()
+	assert.NoError(t, err)
+	assert.Empty(t, status.Pinned)
+}
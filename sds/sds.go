@@ -0,0 +1,383 @@
+// Package sds serve easyrsa workload certs and CA bundle over Envoy Secret Discovery Service.
+// It`s a separate package, so grpc and go-control-plane are linked only into programs using it
+package sds
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	secretv3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	"github.com/pkg/errors"
+	"github.com/productsupcom/go-easyrsa"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// SecretType is a type url of SDS resources
+const SecretType = "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.Secret"
+
+// DefaultRootResource is a resource name of CA bundle as used by Istio
+const DefaultRootResource = "ROOTCA"
+
+// IdentityFunc map requested resource name to cn of the workload cert, error reject the request
+type IdentityFunc func(ctx context.Context, node *corev3.Node, name string) (string, error)
+
+// Server implement Envoy Secret Discovery Service. Every requested resource except the root one
+// is a workload cert issued on demand, the root resource is a bundle of valid CA certs.
+// Subscribed streams get new secrets pushed after Refresh reissue expiring or revoked certs or CA changes
+type Server struct {
+	secretv3.UnimplementedSecretDiscoveryServiceServer
+
+	RootResource    string           // resource name of CA bundle, DefaultRootResource if empty
+	Identity        IdentityFunc     // authenticated identity name is used as cn of every workload resource if nil
+	Profile         string           // registered profile of workload certs, server certs as NewCert if empty
+	RenewBefore     time.Duration    // certs expiring sooner are reissued, easyrsa.DefaultRenewBefore if zero
+	RefreshInterval time.Duration    // Run refresh interval, minute if zero
+	Auth            *easyrsa.APIAuth // authentication of callers and authorization of workload cns, calls are refused if nil
+
+	pki     *easyrsa.PKI
+	mu      sync.Mutex
+	pairs   map[string]*easyrsa.X509Pair // current workload cert by cn
+	streams map[chan struct{}]struct{}
+	nonce   uint64
+}
+
+// NewServer create SDS server issuing workload certs with pki
+func NewServer(pki *easyrsa.PKI) *Server {
+	return &Server{
+		pki:     pki,
+		pairs:   make(map[string]*easyrsa.X509Pair),
+		streams: make(map[chan struct{}]struct{}),
+	}
+}
+
+// Register register SDS service on grpc server
+func (s *Server) Register(server *grpc.Server) {
+	secretv3.RegisterSecretDiscoveryServiceServer(server, s)
+}
+
+// StreamSecrets serve SotW stream, full set of requested secrets is sent on every change
+func (s *Server) StreamSecrets(stream secretv3.SecretDiscoveryService_StreamSecretsServer) error {
+	ctx := stream.Context()
+	id, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	push := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.streams[push] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, push)
+		s.mu.Unlock()
+	}()
+
+	requests := make(chan *discoveryv3.DiscoveryRequest)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var node *corev3.Node
+	var names []string
+	sent := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-recvErr:
+			if status.Code(err) == codes.Canceled {
+				return nil
+			}
+			return err
+		case req := <-requests:
+			if req.Node != nil {
+				node = req.Node
+			}
+			if req.ResponseNonce != "" && equalNames(req.ResourceNames, names) {
+				// ACK or NACK of sent response
+				continue
+			}
+			names = req.ResourceNames
+			sent = ""
+		case <-push:
+		}
+		if len(names) == 0 {
+			continue
+		}
+		res, err := s.response(ctx, id, node, names)
+		if err != nil {
+			return err
+		}
+		if res.VersionInfo == sent {
+			continue
+		}
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+		sent = res.VersionInfo
+	}
+}
+
+// FetchSecrets return requested secrets once
+func (s *Server) FetchSecrets(ctx context.Context, req *discoveryv3.DiscoveryRequest) (*discoveryv3.DiscoveryResponse, error) {
+	id, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.response(ctx, id, req.Node, req.ResourceNames)
+}
+
+// authenticate return identity of grpc caller, Unauthenticated if Auth is not set
+func (s *Server) authenticate(ctx context.Context) (*easyrsa.Identity, error) {
+	if s.Auth == nil {
+		return nil, status.Error(codes.Unauthenticated, "no authentication is configured")
+	}
+	id, err := s.Auth.Authenticate(ctx, GRPCCredentials(ctx))
+	if _, ok := errors.Cause(err).(*easyrsa.Unauthenticated); ok {
+		return nil, status.Errorf(codes.Unauthenticated, "%s", err)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "can`t authenticate: %s", err)
+	}
+	return id, nil
+}
+
+// GRPCCredentials return credentials of grpc call, tokens are read from authorization and x-api-key metadata
+func GRPCCredentials(ctx context.Context) *easyrsa.Credentials {
+	creds := &easyrsa.Credentials{}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			creds.PeerCertificates = info.State.PeerCertificates
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, auth := range md.Get("authorization") {
+			if strings.HasPrefix(auth, "Bearer ") {
+				creds.BearerToken = strings.TrimPrefix(auth, "Bearer ")
+			}
+		}
+		if keys := md.Get("x-api-key"); len(keys) > 0 {
+			creds.APIKey = keys[0]
+		}
+	}
+	return creds
+}
+
+// Refresh reissue subscribed certs which expire soon or was revoked and push changes to streams.
+// Failed cns don`t stop the others, their errors are returned together
+func (s *Server) Refresh() error {
+	s.mu.Lock()
+	cns := make([]string, 0, len(s.pairs))
+	for cn := range s.pairs {
+		cns = append(cns, cn)
+	}
+	s.mu.Unlock()
+	sort.Strings(cns)
+	var failed []string
+	for _, cn := range cns {
+		if _, err := s.workloadPair(cn); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", cn, err))
+		}
+	}
+	s.mu.Lock()
+	for push := range s.streams {
+		select {
+		case push <- struct{}{}:
+		default:
+		}
+	}
+	s.mu.Unlock()
+	if len(failed) > 0 {
+		return errors.Errorf("can`t refresh workload certs: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Run call Refresh every RefreshInterval until ctx is done, errors are passed to onError
+func (s *Server) Run(ctx context.Context, onError func(error)) error {
+	interval := s.RefreshInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := s.Refresh(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (s *Server) response(ctx context.Context, id *easyrsa.Identity, node *corev3.Node, names []string) (*discoveryv3.DiscoveryResponse, error) {
+	root := s.RootResource
+	if root == "" {
+		root = DefaultRootResource
+	}
+	hash := sha256.New()
+	res := &discoveryv3.DiscoveryResponse{TypeUrl: SecretType}
+	for _, name := range names {
+		secret := &tlsv3.Secret{Name: name}
+		if name == root {
+			bundle, err := s.caBundle()
+			if err != nil {
+				return nil, status.Errorf(codes.Unavailable, "can`t get ca bundle: %s", err)
+			}
+			secret.Type = &tlsv3.Secret_ValidationContext{ValidationContext: &tlsv3.CertificateValidationContext{
+				TrustedCa: inlineBytes(bundle),
+			}}
+			hash.Write(bundle)
+		} else {
+			cn := id.Name
+			if s.Identity != nil {
+				var err error
+				if cn, err = s.Identity(ctx, node, name); err != nil {
+					return nil, status.Errorf(codes.PermissionDenied, "%s", err)
+				}
+			}
+			if err := easyrsa.CheckCN(cn); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+			}
+			if cn == "ca" || cn == easyrsa.TrustAnchorCN || cn == easyrsa.CRLSignerCN {
+				return nil, status.Errorf(codes.PermissionDenied, "%s is reserved", cn)
+			}
+			if err := s.Auth.Authorize(id, &easyrsa.AuthorizationRequest{Operation: easyrsa.AuthOpIssue, CN: cn, Profile: s.Profile}); err != nil {
+				return nil, status.Errorf(codes.PermissionDenied, "%s", err)
+			}
+			pair, err := s.workloadPair(cn)
+			if err != nil {
+				return nil, status.Errorf(codes.Unavailable, "can`t get cert for %s: %s", name, err)
+			}
+			chain := pair.FullChainPEM()
+			secret.Type = &tlsv3.Secret_TlsCertificate{TlsCertificate: &tlsv3.TlsCertificate{
+				CertificateChain: inlineBytes(chain),
+				PrivateKey:       inlineBytes(pair.KeyPemBytes),
+			}}
+			hash.Write(chain)
+		}
+		resource, err := anypb.New(secret)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "can`t marshal secret: %s", err)
+		}
+		res.Resources = append(res.Resources, resource)
+	}
+	res.VersionInfo = hex.EncodeToString(hash.Sum(nil))[:16]
+	res.Nonce = strconv.FormatUint(atomic.AddUint64(&s.nonce, 1), 10)
+	return res, nil
+}
+
+// workloadPair return current cert of cn, the last stored one is reused while it`s fresh
+func (s *Server) workloadPair(cn string) (*easyrsa.X509Pair, error) {
+	s.mu.Lock()
+	pair := s.pairs[cn]
+	s.mu.Unlock()
+	if pair == nil {
+		if stored, err := s.pki.Storage.GetLastByCn(cn); err == nil && stored != nil {
+			pair = stored
+		}
+	}
+	if pair != nil && s.usable(pair) {
+		s.mu.Lock()
+		s.pairs[cn] = pair
+		s.mu.Unlock()
+		return pair, nil
+	}
+
+	var err error
+	if s.Profile != "" {
+		pair, err = s.pki.NewCertWithProfile(cn, s.Profile)
+	} else {
+		pair, err = s.pki.NewCert(cn, true, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !pair.HasKey() {
+		return nil, errors.New("issued pair has no key")
+	}
+	s.mu.Lock()
+	s.pairs[cn] = pair
+	s.mu.Unlock()
+	return pair, nil
+}
+
+// usable return true if pair has key, is not revoked and valid longer than RenewBefore
+func (s *Server) usable(pair *easyrsa.X509Pair) bool {
+	if !pair.HasKey() {
+		return false
+	}
+	block, _ := pem.Decode(pair.CertPemBytes)
+	if block == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+	before := s.RenewBefore
+	if before == 0 {
+		before = easyrsa.DefaultRenewBefore
+	}
+	now := s.pki.Now()
+	return !now.Before(cert.NotBefore) && now.Add(before).Before(cert.NotAfter) && !s.pki.IsRevoked(pair.Serial)
+}
+
+// caBundle return pem of valid CA and trust anchor certs, so certs of previous CA generation stay trusted
+func (s *Server) caBundle() ([]byte, error) {
+	bundle, err := s.pki.ExportTrustBundle()
+	if err != nil {
+		return nil, err
+	}
+	return bundle.PEM, nil
+}
+
+func inlineBytes(b []byte) *corev3.DataSource {
+	return &corev3.DataSource{Specifier: &corev3.DataSource_InlineBytes{InlineBytes: b}}
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,201 @@
+package sds
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tlsv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	secretv3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	"github.com/pkg/errors"
+	"github.com/productsupcom/go-easyrsa"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testClock is a PKI clock which can be moved by tests
+type testClock struct {
+	offset int64
+}
+
+func (c *testClock) now() time.Time {
+	return time.Now().Add(time.Duration(atomic.LoadInt64(&c.offset)))
+}
+
+func (c *testClock) set(t time.Time) {
+	atomic.StoreInt64(&c.offset, int64(time.Until(t)))
+}
+
+func newTestPKI(t *testing.T, opts ...easyrsa.Option) *easyrsa.PKI {
+	dir := t.TempDir()
+	opts = append([]easyrsa.Option{easyrsa.WithKeySize(1024)}, opts...)
+	pki := easyrsa.NewPKI(easyrsa.NewDirKeyStorage(dir), easyrsa.NewFileSerialProvider(filepath.Join(dir, "serial")),
+		easyrsa.NewFileCRLHolder(filepath.Join(dir, "crl.pem")), pkix.Name{}, opts...)
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	return pki
+}
+
+func decodeCert(certPem []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPem)
+	if block == nil {
+		return nil, errors.New("no pem block")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func TestServer(t *testing.T) {
+	clock := &testClock{}
+	pki := newTestPKI(t, easyrsa.WithClock(clock.now))
+
+	sds := NewServer(pki)
+	sds.RenewBefore = time.Hour
+	sds.Auth = &easyrsa.APIAuth{
+		Authenticator: easyrsa.NewAPIKeyAuthenticator(map[string]string{"k-web": "web"}),
+		Rules:         easyrsa.AuthorizationRules{{Identities: []string{"web"}}},
+	}
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	sds.Register(server)
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	client := secretv3.NewSecretDiscoveryServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", "k-web")
+
+	secrets := func(res *discoveryv3.DiscoveryResponse) map[string]*tlsv3.Secret {
+		out := make(map[string]*tlsv3.Secret)
+		for _, resource := range res.Resources {
+			secret := &tlsv3.Secret{}
+			assert.NoError(t, resource.UnmarshalTo(secret))
+			out[secret.Name] = secret
+		}
+		return out
+	}
+
+	stream, err := client.StreamSecrets(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, stream.Send(&discoveryv3.DiscoveryRequest{ResourceNames: []string{"web", DefaultRootResource}, TypeUrl: SecretType}))
+	res, err := stream.Recv()
+	if !assert.NoError(t, err) {
+		return
+	}
+	got := secrets(res)
+	chain := got["web"].GetTlsCertificate().GetCertificateChain().GetInlineBytes()
+	cert, err := decodeCert(chain)
+	assert.NoError(t, err)
+	assert.Equal(t, "web", cert.Subject.CommonName)
+	assert.NotEmpty(t, got["web"].GetTlsCertificate().GetPrivateKey().GetInlineBytes())
+	ca, err := pki.GetLastCA()
+	assert.NoError(t, err)
+	assert.Equal(t, ca.CertPemBytes, got[DefaultRootResource].GetValidationContext().GetTrustedCa().GetInlineBytes())
+	assert.NoError(t, stream.Send(&discoveryv3.DiscoveryRequest{
+		ResourceNames: []string{"web", DefaultRootResource}, TypeUrl: SecretType,
+		VersionInfo: res.VersionInfo, ResponseNonce: res.Nonce,
+	}))
+
+	t.Run("fetch reuse", func(t *testing.T) {
+		fetched, err := client.FetchSecrets(ctx, &discoveryv3.DiscoveryRequest{ResourceNames: []string{"web"}})
+		assert.NoError(t, err)
+		fetchedCert, err := decodeCert(secrets(fetched)["web"].GetTlsCertificate().GetCertificateChain().GetInlineBytes())
+		assert.NoError(t, err)
+		assert.Equal(t, cert.SerialNumber, fetchedCert.SerialNumber)
+	})
+
+	t.Run("push", func(t *testing.T) {
+		renewAt := cert.NotAfter.Add(-30 * time.Minute)
+		clock.set(renewAt)
+		defer clock.set(time.Now())
+		sds.mu.Lock()
+		sds.pairs["x/../ca"] = nil
+		sds.mu.Unlock()
+		// failed cn don`t stop refresh of others
+		assert.Error(t, sds.Refresh())
+		pushed, err := stream.Recv()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NotEqual(t, res.VersionInfo, pushed.VersionInfo)
+		renewed, err := decodeCert(secrets(pushed)["web"].GetTlsCertificate().GetCertificateChain().GetInlineBytes())
+		assert.NoError(t, err)
+		assert.NotEqual(t, cert.SerialNumber, renewed.SerialNumber)
+	})
+}
+
+func TestServer_Auth(t *testing.T) {
+	pki := newTestPKI(t)
+	sds := NewServer(pki)
+	md := metadata.Pairs("x-api-key", "k-web")
+	fetch := func(md metadata.MD, name string) (string, error) {
+		res, err := sds.FetchSecrets(metadata.NewIncomingContext(context.Background(), md),
+			&discoveryv3.DiscoveryRequest{ResourceNames: []string{name}})
+		if err != nil {
+			return "", err
+		}
+		secret := &tlsv3.Secret{}
+		assert.NoError(t, res.Resources[0].UnmarshalTo(secret))
+		cert, err := decodeCert(secret.GetTlsCertificate().GetCertificateChain().GetInlineBytes())
+		assert.NoError(t, err)
+		return cert.Subject.CommonName, nil
+	}
+	_, err := fetch(md, "web.pki.local")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	sds.Auth = &easyrsa.APIAuth{
+		Authenticator: easyrsa.NewAPIKeyAuthenticator(map[string]string{"k-web": "web.pki.local", "k-ops": "ops"}),
+		Rules: easyrsa.AuthorizationRules{
+			{Identities: []string{"web.pki.local"}},
+			{Identities: []string{"ops"}, CNs: []string{"*"}},
+		},
+	}
+	for _, name := range []string{"web.pki.local", "db.pki.local", "ca"} {
+		// resource is bound to the caller without Identity
+		cn, err := fetch(md, name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, "web.pki.local", cn, name)
+	}
+	_, err = fetch(metadata.MD{}, "web.pki.local")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	sds.Identity = func(ctx context.Context, node *corev3.Node, name string) (string, error) {
+		return name, nil
+	}
+	_, err = fetch(md, "db.pki.local")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	cn, err := fetch(metadata.Pairs("x-api-key", "k-ops"), "db.pki.local")
+	assert.NoError(t, err)
+	assert.Equal(t, "db.pki.local", cn)
+	for _, name := range []string{"ca", "ca/", "x/../ca", "..", easyrsa.CRLSignerCN} {
+		_, err = fetch(metadata.Pairs("x-api-key", "k-ops"), name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestGRPCCredentials(t *testing.T) {
+	md := metadata.Pairs("authorization", "Bearer t-1", "x-api-key", "k-1")
+	assert.Equal(t, &easyrsa.Credentials{BearerToken: "t-1", APIKey: "k-1"},
+		GRPCCredentials(metadata.NewIncomingContext(context.Background(), md)))
+}
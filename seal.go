@@ -0,0 +1,89 @@
+package easyrsa
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// NewSealedCa creating new version self signed CA pair and split it`s key into parts shares,
+// any threshold of them unseal the CA. Only the cert is stored, returned pair has no key.
+// Shares are the only copy of the key and must be handed out to custodians
+func (p *PKI) NewSealedCa(parts, threshold int) (*X509Pair, [][]byte, error) {
+	if err := p.requireLeader(); err != nil {
+		return nil, nil, err
+	}
+	tx := &transaction{}
+	res, err := p.newCa(tx)
+	if err != nil {
+		return nil, nil, tx.rollback(err)
+	}
+	defer res.Wipe()
+	shares, err := SplitSecret(res.KeyPemBytes, parts, threshold)
+	if err != nil {
+		return nil, nil, tx.rollback(err)
+	}
+	certOnly := NewX509Pair(nil, res.CertPemBytes, res.CN, res.Serial)
+	if err := p.storePair(tx, certOnly); err != nil {
+		return nil, nil, tx.rollback(err)
+	}
+	return certOnly, shares, nil
+}
+
+// Unseal recover key of the last CA from shares and keep it in memory until Seal,
+// so NewCert and RevokeOne can sign with cert only CA pair
+func (p *PKI) Unseal(shares [][]byte) error {
+	caPair, err := p.GetLastCA()
+	if err != nil {
+		return errors.Wrap(err, "can`t get ca pair")
+	}
+	keyPem, err := CombineShares(shares)
+	if err != nil {
+		return errors.Wrap(err, "can`t combine shares")
+	}
+	unsealed := NewX509Pair(keyPem, caPair.CertPemBytes, caPair.CN, caPair.Serial)
+	key, _, err := unsealed.Decode()
+	if err != nil {
+		unsealed.Wipe()
+		return errors.Wrap(err, "wrong or not enough shares")
+	}
+	ZeroKey(key)
+
+	p.sealMu.Lock()
+	defer p.sealMu.Unlock()
+	if p.unsealed != nil {
+		p.unsealed.Wipe()
+	}
+	p.unsealed = unsealed
+	return nil
+}
+
+// Seal wipe unsealed CA key from memory
+func (p *PKI) Seal() {
+	p.sealMu.Lock()
+	defer p.sealMu.Unlock()
+	if p.unsealed != nil {
+		p.unsealed.Wipe()
+		p.unsealed = nil
+	}
+}
+
+// Sealed return true if no CA key is unsealed
+func (p *PKI) Sealed() bool {
+	p.sealMu.RLock()
+	defer p.sealMu.RUnlock()
+	return p.unsealed == nil
+}
+
+// decodeCA decode CA pair, cert only pair get unsealed key if serials match
+func (p *PKI) decodeCA(pair *X509Pair) (*rsa.PrivateKey, *x509.Certificate, error) {
+	if !pair.HasKey() {
+		p.sealMu.RLock()
+		defer p.sealMu.RUnlock()
+		if p.unsealed != nil && p.unsealed.Serial.Cmp(pair.Serial) == 0 {
+			pair = NewX509Pair(p.unsealed.KeyPemBytes, pair.CertPemBytes, pair.CN, pair.Serial)
+		}
+	}
+	return pair.Decode()
+}
@@ -0,0 +1,40 @@
+package easyrsa
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_NewSealedCa(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	ca, shares, err := pki.NewSealedCa(3, 2)
+	assert.NoError(t, err)
+	assert.False(t, ca.HasKey())
+	assert.Len(t, shares, 3)
+	stored, err := pki.GetLastCA()
+	assert.NoError(t, err)
+	assert.False(t, stored.HasKey())
+	assert.True(t, pki.Sealed())
+
+	_, err = pki.NewCert("sealed", false, []string{""})
+	assert.Error(t, err)
+
+	assert.Error(t, pki.Unseal(shares[:1]))
+	assert.True(t, pki.Sealed())
+	assert.NoError(t, pki.Unseal([][]byte{shares[2], shares[0]}))
+	assert.False(t, pki.Sealed())
+
+	cert, err := pki.NewCert("unsealed", false, []string{""})
+	assert.NoError(t, err)
+	assert.NoError(t, pki.RevokeOne(cert.Serial))
+	assert.True(t, pki.IsRevoked(cert.Serial))
+
+	pki.Seal()
+	assert.True(t, pki.Sealed())
+	_, err = pki.NewCert("sealed again", false, []string{""})
+	assert.Error(t, err)
+	assert.Error(t, pki.RevokeOne(big.NewInt(42)))
+}
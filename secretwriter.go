@@ -0,0 +1,150 @@
+package easyrsa
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// File names written by SecretWriter for every service
+const (
+	SecretCertFile = "cert.pem" // cert followed by intermediates
+	SecretKeyFile  = "key.pem"  // private key
+	SecretCAFile   = "ca.pem"   // issuing chain including the root
+)
+
+// SecretWriter materialize pairs as files for Docker secrets and compose, one dir per service:
+// <dir>/<service>/cert.pem, key.pem and ca.pem. <dir>/<service> is a symlink to versioned dir
+// replaced atomically, so readers never see cert and key of different pairs
+type SecretWriter struct {
+	pki      *PKI
+	dir      string
+	uid      int         // owner of written files, -1 keep current
+	gid      int         // group of written files, -1 keep current
+	certMode os.FileMode // mode of cert.pem and ca.pem
+	keyMode  os.FileMode // mode of key.pem
+}
+
+// SecretWriterOption configure SecretWriter
+type SecretWriterOption func(*SecretWriter)
+
+// WithSecretOwner chown written files, e.g. to uid of the container user reading them
+func WithSecretOwner(uid, gid int) SecretWriterOption {
+	return func(w *SecretWriter) {
+		w.uid, w.gid = uid, gid
+	}
+}
+
+// WithSecretModes set modes of written certs and keys, 0644 and 0600 by default
+func WithSecretModes(certMode, keyMode os.FileMode) SecretWriterOption {
+	return func(w *SecretWriter) {
+		w.certMode, w.keyMode = certMode, keyMode
+	}
+}
+
+// NewSecretWriter create writer to dir, chains missing in pairs are resolved with pki
+func NewSecretWriter(pki *PKI, dir string, opts ...SecretWriterOption) *SecretWriter {
+	w := &SecretWriter{pki: pki, dir: dir, uid: -1, gid: -1, certMode: 0644, keyMode: 0600}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Path return dir with files of service
+func (w *SecretWriter) Path(service string) string {
+	return filepath.Join(w.dir, service)
+}
+
+// Write replace files of service with pair
+func (w *SecretWriter) Write(service string, pair *X509Pair) error {
+	if service == "" || strings.HasPrefix(service, ".") || strings.ContainsAny(service, `/\`) {
+		return errors.Errorf("invalid service name %q", service)
+	}
+	if !pair.HasKey() {
+		return errors.New("pair has no key")
+	}
+	if len(pair.ChainPemBytes) == 0 {
+		if err := w.pki.ResolveChain(pair); err != nil {
+			return errors.Wrap(err, "can`t resolve ca chain")
+		}
+	}
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return errors.Wrap(err, "can`t create secrets dir")
+	}
+
+	version := fmt.Sprintf(".%s.%d", service, time.Now().UnixNano())
+	versionDir := filepath.Join(w.dir, version)
+	if err := os.Mkdir(versionDir, 0755); err != nil {
+		return errors.Wrap(err, "can`t create secret dir")
+	}
+	files := []struct {
+		name string
+		data []byte
+		mode os.FileMode
+	}{
+		{SecretCertFile, pair.FullChainPEM(), w.certMode},
+		{SecretKeyFile, pair.KeyPemBytes, w.keyMode},
+		{SecretCAFile, pair.CAChainPEM(), w.certMode},
+	}
+	for _, file := range files {
+		if err := w.writeFile(filepath.Join(versionDir, file.name), file.data, file.mode); err != nil {
+			_ = os.RemoveAll(versionDir)
+			return errors.Wrapf(err, "can`t write %s", file.name)
+		}
+	}
+	if w.uid >= 0 || w.gid >= 0 {
+		if err := os.Chown(versionDir, w.uid, w.gid); err != nil {
+			_ = os.RemoveAll(versionDir)
+			return errors.Wrap(err, "can`t chown secret dir")
+		}
+	}
+
+	link := w.Path(service)
+	previous, _ := os.Readlink(link)
+	tmpLink := link + ".tmp"
+	_ = os.Remove(tmpLink)
+	if err := os.Symlink(version, tmpLink); err != nil {
+		_ = os.RemoveAll(versionDir)
+		return errors.Wrap(err, "can`t link secret dir")
+	}
+	if err := os.Rename(tmpLink, link); err != nil {
+		_ = os.Remove(tmpLink)
+		_ = os.RemoveAll(versionDir)
+		return errors.Wrapf(err, "can`t replace %s", link)
+	}
+	if dir, err := os.Open(w.dir); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+	if previous != "" && previous != version && !strings.ContainsAny(previous, `/\`) {
+		_ = os.RemoveAll(filepath.Join(w.dir, previous))
+	}
+	return nil
+}
+
+func (w *SecretWriter) writeFile(path string, data []byte, mode os.FileMode) error {
+	if err := ioutil.WriteFile(path, data, mode); err != nil {
+		return err
+	}
+	// WriteFile mode is masked by umask
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	if w.uid >= 0 || w.gid >= 0 {
+		if err := os.Chown(path, w.uid, w.gid); err != nil {
+			return err
+		}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
@@ -0,0 +1,52 @@
+package easyrsa
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretWriter(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	dir := filepath.Join(getTestDir(), "secrets")
+	defer os.RemoveAll(dir)
+
+	w := NewSecretWriter(pki, dir, WithSecretModes(0640, 0400))
+	first, err := pki.NewCert("web", true, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write("web", first))
+
+	read := func(name string) []byte {
+		data, err := ioutil.ReadFile(filepath.Join(w.Path("web"), name))
+		assert.NoError(t, err)
+		return data
+	}
+	assert.Equal(t, first.FullChainPEM(), read(SecretCertFile))
+	assert.Equal(t, first.KeyPemBytes, read(SecretKeyFile))
+	assert.Equal(t, first.CAChainPEM(), read(SecretCAFile))
+	stat, err := os.Stat(filepath.Join(w.Path("web"), SecretKeyFile))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0400), stat.Mode().Perm())
+
+	// stored pair without chain is resolved, previous version is removed
+	second, err := pki.NewCert("web", true, nil)
+	assert.NoError(t, err)
+	stored, err := pki.Storage.GetBySerial(second.Serial)
+	assert.NoError(t, err)
+	stored.ChainPemBytes = nil
+	assert.NoError(t, w.Write("web", stored))
+	assert.Equal(t, second.KeyPemBytes, read(SecretKeyFile))
+	assert.Equal(t, second.CAChainPEM(), read(SecretCAFile))
+	versions, err := filepath.Glob(filepath.Join(dir, ".web.*"))
+	assert.NoError(t, err)
+	assert.Len(t, versions, 1)
+
+	assert.Error(t, w.Write("../web", second))
+	assert.Error(t, w.Write("web", NewX509Pair(nil, second.CertPemBytes, "web", second.Serial)))
+}
@@ -0,0 +1,102 @@
+package easyrsa
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UUIDSerialProvider implement SerialProvider interface with random 128 bit UUID serials.
+// No state is stored, so it`s safe to use from several hosts sharing one storage
+type UUIDSerialProvider struct {
+	timeOrdered bool
+	rand        io.Reader
+	now         func() time.Time
+	mu          sync.Mutex
+	last        *big.Int
+}
+
+// NewUUIDSerialProvider return provider of random UUID v4 serials
+func NewUUIDSerialProvider() *UUIDSerialProvider {
+	return &UUIDSerialProvider{rand: rand.Reader, now: time.Now}
+}
+
+// NewTimeOrderedSerialProvider return provider of UUID v7 serials, unix ms timestamp followed by random bits.
+// Serials are sorted by issuance time and strictly increase within process
+func NewTimeOrderedSerialProvider() *UUIDSerialProvider {
+	return &UUIDSerialProvider{timeOrdered: true, rand: rand.Reader, now: time.Now}
+}
+
+func (p *UUIDSerialProvider) Next() (*big.Int, error) {
+	uuid := make([]byte, 16)
+	if _, err := io.ReadFull(p.rand, uuid); err != nil {
+		return nil, errors.Wrap(err, "can`t read random serial")
+	}
+	version := byte(0x40)
+	if p.timeOrdered {
+		version = 0x70
+		ms := uint64(p.now().UnixNano() / int64(time.Millisecond))
+		for i := 0; i < 6; i++ {
+			uuid[i] = byte(ms >> uint(40-8*i))
+		}
+	}
+	uuid[6] = uuid[6]&0x0f | version
+	uuid[8] = uuid[8]&0x3f | 0x80 // RFC 4122 variant
+	res := new(big.Int).SetBytes(uuid)
+	if !p.timeOrdered {
+		return res, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last != nil && res.Cmp(p.last) <= 0 {
+		res = new(big.Int).Add(p.last, big.NewInt(1))
+	}
+	p.last = res
+	return res, nil
+}
+
+// Reserve return n random serials, ordered for time ordered provider
+func (p *UUIDSerialProvider) Reserve(n int) ([]*big.Int, error) {
+	if n <= 0 {
+		return nil, errors.Errorf("wrong number of serials %d", n)
+	}
+	res := make([]*big.Int, 0, n)
+	for len(res) < n {
+		serial, err := p.Next()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, serial)
+	}
+	return res, nil
+}
+
+// FormatSerial render serial as lowercase hex octets separated by colons as "openssl x509 -text" do for long serials
+func FormatSerial(serial *big.Int) string {
+	b := serial.Bytes()
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	octets := make([]string, len(b))
+	for i, o := range b {
+		octets[i] = fmt.Sprintf("%02x", o)
+	}
+	return strings.Join(octets, ":")
+}
+
+// ParseSerial parse hex serial with optional colons and 0x prefix, as printed by openssl or FormatSerial
+func ParseSerial(s string) (*big.Int, error) {
+	hex := strings.Replace(strings.TrimSpace(s), ":", "", -1)
+	hex = strings.TrimPrefix(strings.TrimPrefix(hex, "0x"), "0X")
+	serial, ok := new(big.Int).SetString(hex, 16)
+	if !ok || hex == "" || strings.HasPrefix(hex, "-") || strings.HasPrefix(hex, "+") {
+		return nil, errors.Errorf("wrong serial %q", s)
+	}
+	return serial, nil
+}
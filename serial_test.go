@@ -0,0 +1,78 @@
+package easyrsa
+
+import (
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUUIDSerialProvider_Next(t *testing.T) {
+	sp := NewUUIDSerialProvider()
+	a, err := sp.Next()
+	assert.NoError(t, err)
+	b, _ := sp.Next()
+	assert.NotEqual(t, a, b)
+	uuid := make([]byte, 16)
+	a.FillBytes(uuid)
+	assert.Equal(t, byte(0x40), uuid[6]&0xf0)
+	assert.Equal(t, byte(0x80), uuid[8]&0xc0)
+
+	now := time.Unix(1600000000, 0)
+	sp = NewTimeOrderedSerialProvider()
+	sp.now = func() time.Time { return now }
+	prev, _ := sp.Next()
+	prev.FillBytes(uuid)
+	assert.Equal(t, byte(0x70), uuid[6]&0xf0)
+	assert.Equal(t, big.NewInt(1600000000000), new(big.Int).SetBytes(uuid[:6]))
+	for i := 0; i < 100; i++ {
+		next, err := sp.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, next.Cmp(prev))
+		prev = next
+	}
+	now = now.Add(-time.Hour)
+	next, _ := sp.Next()
+	assert.Equal(t, 1, next.Cmp(prev))
+}
+
+func TestPKI_UUIDSerials(t *testing.T) {
+	dir := filepath.Join(getTestDir(), "uuid")
+	pki := NewPKI(NewDirKeyStorage(dir), NewUUIDSerialProvider(), NewFileCRLHolder(filepath.Join(dir, "crl.pem")), pkix.Name{})
+	defer os.RemoveAll(dir)
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	pair, err := pki.NewCert("uuid", false, []string{""})
+	assert.NoError(t, err)
+	stored, err := pki.Storage.GetBySerial(pair.Serial)
+	assert.NoError(t, err)
+	assert.Equal(t, pair.Serial, stored.Serial)
+	assert.NoError(t, pki.RevokeOne(pair.Serial))
+	assert.NoError(t, pki.RevokeOne(pair.Serial))
+	list, err := pki.GetCRL()
+	assert.NoError(t, err)
+	assert.Len(t, list.TBSCertList.RevokedCertificates, 1)
+}
+
+func TestFormatSerial(t *testing.T) {
+	serial, _ := new(big.Int).SetString("3af10001c2", 16)
+	assert.Equal(t, "3a:f1:00:01:c2", FormatSerial(serial))
+	assert.Equal(t, "00", FormatSerial(big.NewInt(0)))
+	assert.Equal(t, "0a", FormatSerial(big.NewInt(10)))
+}
+
+func TestParseSerial(t *testing.T) {
+	for _, s := range []string{"3a:f1:00:01:c2", "3AF10001C2", "0x3af10001c2", " 3a:f1:00:01:c2\n"} {
+		serial, err := ParseSerial(s)
+		assert.NoError(t, err)
+		assert.Equal(t, "3af10001c2", serial.Text(16))
+	}
+	for _, s := range []string{"", "xyz", "-1", "0x"} {
+		_, err := ParseSerial(s)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,105 @@
+package easyrsa
+
+import (
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+)
+
+// SplitSecret split secret into parts shares, any threshold of them recover it with CombineShares.
+// Shamir's scheme over GF(256) is used, every share is len(secret)+1 bytes, last byte is the share x coordinate
+func SplitSecret(secret []byte, parts, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret is empty")
+	}
+	if threshold < 2 || parts < threshold || parts > 255 {
+		return nil, errors.Errorf("wrong threshold %d of %d parts, need 2 <= threshold <= parts <= 255", threshold, parts)
+	}
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+	coeffs := make([]byte, threshold)
+	defer zeroBytes(coeffs)
+	for idx, b := range secret {
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, errors.Wrap(err, "can`t read random")
+		}
+		coeffs[0] = b
+		for _, share := range shares {
+			share[idx] = gfEval(coeffs, share[len(secret)])
+		}
+	}
+	return shares, nil
+}
+
+// CombineShares recover secret from threshold or more shares produced by SplitSecret.
+// Less shares than threshold give garbage instead of error, callers should verify the result
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least 2 shares required")
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, errors.New("share is too short")
+	}
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool)
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, errors.New("shares have different length")
+		}
+		xs[i] = share[size-1]
+		if xs[i] == 0 || seen[xs[i]] {
+			return nil, errors.New("duplicate or zero share")
+		}
+		seen[xs[i]] = true
+	}
+	// lagrange basis polynomials at x = 0
+	basis := make([]byte, len(shares))
+	for i := range shares {
+		basis[i] = 1
+		for j := range shares {
+			if i != j {
+				basis[i] = gfMul(basis[i], gfDiv(xs[j], xs[j]^xs[i]))
+			}
+		}
+	}
+	res := make([]byte, size-1)
+	for idx := range res {
+		for i, share := range shares {
+			res[idx] ^= gfMul(share[idx], basis[i])
+		}
+	}
+	return res, nil
+}
+
+// gfEval evaluate polynomial with coeffs in x by horner`s method
+func gfEval(coeffs []byte, x byte) byte {
+	var res byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		res = gfMul(res, x) ^ coeffs[i]
+	}
+	return res
+}
+
+// gfMul multiply in GF(256) with AES polynomial, without data dependent branches
+func gfMul(a, b byte) byte {
+	var res byte
+	for i := 0; i < 8; i++ {
+		res ^= -(b & 1) & a
+		a = a<<1 ^ 0x1b&-(a>>7)
+		b >>= 1
+	}
+	return res
+}
+
+// gfDiv divide a by non zero b, inverse is b^254
+func gfDiv(a, b byte) byte {
+	inv := b
+	for i := 0; i < 6; i++ {
+		inv = gfMul(gfMul(inv, inv), b)
+	}
+	return gfMul(a, gfMul(inv, inv))
+}
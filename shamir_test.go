@@ -0,0 +1,57 @@
+package easyrsa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitSecret(t *testing.T) {
+	secret := []byte("very secret ca key")
+	shares, err := SplitSecret(secret, 5, 3)
+	assert.NoError(t, err)
+	assert.Len(t, shares, 5)
+	for _, share := range shares {
+		assert.Len(t, share, len(secret)+1)
+	}
+
+	cases := []struct {
+		name   string
+		shares [][]byte
+		equal  bool
+		err    bool
+	}{
+		{name: "threshold", shares: [][]byte{shares[0], shares[2], shares[4]}, equal: true},
+		{name: "all", shares: shares, equal: true},
+		{name: "other order", shares: [][]byte{shares[3], shares[1], shares[0]}, equal: true},
+		{name: "not enough", shares: [][]byte{shares[0], shares[1]}, equal: false},
+		{name: "one", shares: [][]byte{shares[0]}, err: true},
+		{name: "duplicate", shares: [][]byte{shares[0], shares[0], shares[1]}, err: true},
+		{name: "length", shares: [][]byte{shares[0], shares[1][1:], shares[2]}, err: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := CombineShares(tt.shares)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.equal, string(secret) == string(res))
+		})
+	}
+
+	for _, args := range [][2]int{{1, 1}, {3, 1}, {2, 3}, {256, 2}} {
+		_, err := SplitSecret(secret, args[0], args[1])
+		assert.Error(t, err)
+	}
+	_, err = SplitSecret(nil, 3, 2)
+	assert.Error(t, err)
+}
+
+func TestGfDiv(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		assert.Equal(t, byte(1), gfDiv(byte(a), byte(a)))
+		assert.Equal(t, byte(a), gfMul(gfDiv(byte(a), 7), 7))
+	}
+}
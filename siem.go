@@ -0,0 +1,235 @@
+package easyrsa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SIEM event formats
+const (
+	SIEMFormatJSON = "json" // AuditEvent as json
+	SIEMFormatCEF  = "cef"  // ArcSight Common Event Format
+)
+
+// DefaultSIEMBuffer is a queue size of NewSIEMSink if buffer is not positive
+const DefaultSIEMBuffer = 1024
+
+// SIEMSink deliver audit events to syslog or TCP endpoint of SIEM, one event per line. Events are queued by Audit
+// and written by Run, which reconnect after failures keeping undelivered event. When queue is full Audit wait
+// up to Block for free slot, then event is dropped, counted by Dropped and reported to OnError
+type SIEMSink struct {
+	Format        string        // SIEMFormatJSON if empty or SIEMFormatCEF
+	Syslog        bool          // prefix events with RFC 5424 header, e.g. for rsyslog tcp input or unixgram /dev/log
+	Facility      int           // syslog facility, authpriv (10) if zero
+	AppName       string        // syslog app name, "easyrsa" if empty
+	Hostname      string        // syslog hostname, os.Hostname if empty
+	Block         time.Duration // max wait of Audit for free queue slot, event is dropped at once if zero
+	RetryInterval time.Duration // delay between reconnects, 1s if zero
+	OnError       func(error)   // called on delivery errors and dropped events, optional
+
+	network string
+	addr    string
+	queue   chan *AuditEvent
+	dropped uint64
+}
+
+// NewSIEMSink create sink writing to addr with network of net.Dial, e.g. "tcp", "udp" or "unixgram",
+// with queue of buffer events, DefaultSIEMBuffer if not positive. Pass Audit to WithAuditSink and start Run
+func NewSIEMSink(network, addr string, buffer int) *SIEMSink {
+	if buffer <= 0 {
+		buffer = DefaultSIEMBuffer
+	}
+	return &SIEMSink{network: network, addr: addr, queue: make(chan *AuditEvent, buffer)}
+}
+
+// Audit queue event, it implement AuditSink
+func (s *SIEMSink) Audit(event *AuditEvent) {
+	select {
+	case s.queue <- event:
+		return
+	default:
+	}
+	if s.Block > 0 {
+		timer := time.NewTimer(s.Block)
+		defer timer.Stop()
+		select {
+		case s.queue <- event:
+			return
+		case <-timer.C:
+		}
+	}
+	atomic.AddUint64(&s.dropped, 1)
+	s.onError(errors.Errorf("audit queue is full, event %s %s is dropped", event.Operation, event.CN))
+}
+
+// Dropped return count of events dropped because queue was full
+func (s *SIEMSink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Run write queued events until ctx is done, then events already queued are written once without retries
+func (s *SIEMSink) Run(ctx context.Context) error {
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}()
+	retry := s.RetryInterval
+	if retry <= 0 {
+		retry = time.Second
+	}
+	for {
+		var event *AuditEvent
+		select {
+		case event = <-s.queue:
+		case <-ctx.Done():
+			s.flush(conn)
+			return ctx.Err()
+		}
+		line, err := s.Message(event)
+		if err != nil {
+			s.onError(err)
+			continue
+		}
+		for {
+			if conn == nil {
+				conn, err = net.DialTimeout(s.network, s.addr, 10*time.Second)
+			}
+			if err == nil {
+				if _, err = conn.Write(line); err == nil {
+					break
+				}
+				_ = conn.Close()
+				conn = nil
+			}
+			s.onError(errors.Wrap(err, "can`t deliver audit event"))
+			select {
+			case <-time.After(retry):
+			case <-ctx.Done():
+				s.flush(conn)
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// flush write queued events to conn, if it`s connected
+func (s *SIEMSink) flush(conn net.Conn) {
+	for {
+		select {
+		case event := <-s.queue:
+			line, err := s.Message(event)
+			if err != nil || conn == nil {
+				continue
+			}
+			if _, err := conn.Write(line); err != nil {
+				s.onError(errors.Wrap(err, "can`t deliver audit event"))
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Message return newline terminated event in sink format, with syslog header if Syslog is set
+func (s *SIEMSink) Message(event *AuditEvent) ([]byte, error) {
+	var msg string
+	switch s.Format {
+	case "", SIEMFormatJSON:
+		b, err := json.Marshal(event)
+		if err != nil {
+			return nil, errors.Wrap(err, "can`t encode audit event")
+		}
+		msg = string(b)
+	case SIEMFormatCEF:
+		msg = cefEvent(event)
+	default:
+		return nil, errors.Errorf("unknown siem format %q", s.Format)
+	}
+	if s.Syslog {
+		msg = s.syslogHeader(event) + msg
+	}
+	return []byte(msg + "\n"), nil
+}
+
+// syslogHeader return RFC 5424 header without structured data
+func (s *SIEMSink) syslogHeader(event *AuditEvent) string {
+	facility := s.Facility
+	if facility == 0 {
+		facility = 10
+	}
+	severity := 6 // informational
+	if event.Error != "" {
+		severity = 4 // warning
+	} else if event.Operation == AuthOpRevoke {
+		severity = 5 // notice
+	}
+	app := s.AppName
+	if app == "" {
+		app = "easyrsa"
+	}
+	host := s.Hostname
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	if host == "" {
+		host = "-"
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - ", facility*8+severity,
+		event.Time.UTC().Format("2006-01-02T15:04:05.000Z07:00"), host, app, os.Getpid(), event.Operation)
+}
+
+func (s *SIEMSink) onError(err error) {
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// cefEvent return CEF:0 record of event
+func cefEvent(event *AuditEvent) string {
+	name, severity := "Certificate issued", 3
+	switch event.Operation {
+	case AuthOpSign:
+		name = "Certificate signed"
+	case AuthOpRevoke:
+		name, severity = "Certificate revoked", 6
+		if event.Error != "" {
+			name, severity = "Certificate revocation failed", 8
+		}
+	}
+	ext := []string{"rt=" + fmt.Sprint(event.Time.UnixNano()/int64(time.Millisecond))}
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefExtensionEscaper.Replace(value))
+		}
+	}
+	add("suser", event.Requester)
+	add("cs1Label", "cn")
+	add("cs1", event.CN)
+	if event.Serial != nil {
+		add("cs2Label", "serial")
+		add("cs2", event.Serial.Text(16))
+	}
+	add("reason", event.Reason)
+	if event.Error != "" {
+		add("outcome", "failure")
+		add("msg", event.Error)
+	}
+	return fmt.Sprintf("CEF:0|productsupcom|go-easyrsa|1|%s|%s|%d|%s", cefHeaderEscaper.Replace(event.Operation),
+		cefHeaderEscaper.Replace(name), severity, strings.Join(ext, " "))
+}
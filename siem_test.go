@@ -0,0 +1,103 @@
+package easyrsa
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSIEMSink(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event delivered")
+			return ""
+		}
+	}
+
+	sink := NewSIEMSink("tcp", ln.Addr().String(), 0)
+	sink.Syslog = true
+	sink.Hostname = "pki01"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = sink.Run(ctx) }()
+
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithAuditSink(sink.Audit))
+	defer cleanup()
+	_, err = pki.NewCa()
+	assert.NoError(t, err)
+	pair, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	line := next()
+	assert.True(t, strings.HasPrefix(line, "<86>1 "), line)
+	assert.Contains(t, line, " pki01 easyrsa ")
+	event := &AuditEvent{}
+	assert.NoError(t, json.Unmarshal([]byte(line[strings.Index(line, "{"):]), event))
+	assert.Equal(t, AuthOpIssue, event.Operation)
+	assert.Equal(t, "alice", event.CN)
+	assert.Equal(t, 0, event.Serial.Cmp(pair.Serial))
+
+	assert.NoError(t, pki.Revoke(pair.Serial, "admin", "key=leaked"))
+	line = next()
+	assert.True(t, strings.HasPrefix(line, "<85>1 "), line)
+	assert.NoError(t, json.Unmarshal([]byte(line[strings.Index(line, "{"):]), event))
+	assert.Equal(t, AuthOpRevoke, event.Operation)
+	assert.Equal(t, "admin", event.Requester)
+
+	cef := NewSIEMSink("tcp", ln.Addr().String(), 0)
+	cef.Format = SIEMFormatCEF
+	msg, err := cef.Message(event)
+	assert.NoError(t, err)
+	line = string(msg)
+	assert.True(t, strings.HasPrefix(line, "CEF:0|productsupcom|go-easyrsa|1|revoke|Certificate revoked|6|"), line)
+	assert.Contains(t, line, "suser=admin")
+	assert.Contains(t, line, "cs1=alice")
+	assert.Contains(t, line, "cs2="+pair.Serial.Text(16))
+	assert.Contains(t, line, `reason=key\=leaked`)
+
+	event.Error = "other instance is the leader"
+	msg, err = cef.Message(event)
+	assert.NoError(t, err)
+	line = string(msg)
+	assert.True(t, strings.HasPrefix(line, "CEF:0|productsupcom|go-easyrsa|1|revoke|Certificate revocation failed|8|"), line)
+	assert.Contains(t, line, "outcome=failure msg=other instance is the leader")
+}
+
+func TestSIEMSink_Backpressure(t *testing.T) {
+	var errs []error
+	sink := NewSIEMSink("tcp", "127.0.0.1:1", 1)
+	sink.Block = 10 * time.Millisecond
+	sink.OnError = func(err error) { errs = append(errs, err) }
+	for i := 0; i < 3; i++ {
+		sink.Audit(&AuditEvent{Operation: AuthOpIssue, CN: "alice", Time: time.Now()})
+	}
+	assert.Equal(t, uint64(2), sink.Dropped())
+	assert.Len(t, errs, 2)
+
+	sink.Format = "xml"
+	_, err := sink.Message(&AuditEvent{})
+	assert.Error(t, err)
+}
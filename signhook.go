@@ -0,0 +1,43 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// SignHook is called with final template and request just before cert is signed, after serial,
+// validity and CRL distribution points are set. Hooks may mutate template, e.g. add org specific extensions,
+// or reject issuance with error, serial is reserved but released if it fails. CA constraints and DNS policy
+// are checked again after hooks. Request of built-in certs (CRL signer, cross cert, TSA) carry CN only
+type SignHook func(tml *x509.Certificate, req CertRequest) error
+
+// WithSignHook add hook to the end of sign hooks chain, hooks are called in order they were added
+func WithSignHook(hook SignHook) Option {
+	return func(p *PKI) {
+		p.signHooks = append(p.signHooks, hook)
+	}
+}
+
+// runSignHooks call sign hooks and check that template still match CA and policies
+func (p *PKI) runSignHooks(tml *x509.Certificate, req CertRequest, caCert *x509.Certificate) error {
+	if len(p.signHooks) == 0 {
+		return nil
+	}
+	serial := tml.SerialNumber
+	for _, hook := range p.signHooks {
+		if err := hook(tml, req); err != nil {
+			return err
+		}
+	}
+	if tml.SerialNumber == nil || tml.SerialNumber.Cmp(serial) != 0 {
+		return errors.New("sign hook changed serial")
+	}
+	if err := p.clampValidity(req.CN, tml, caCert); err != nil {
+		return err
+	}
+	if err := checkCAConstraints(tml, caCert); err != nil {
+		return err
+	}
+	return p.checkDNSPolicy(tml.DNSNames)
+}
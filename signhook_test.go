@@ -0,0 +1,60 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_SignHook(t *testing.T) {
+	oid := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	requests := make([]CertRequest, 0)
+	pki, cleanup := getTmpPki(WithKeySize(1024),
+		WithSignHook(func(tml *x509.Certificate, req CertRequest) error {
+			requests = append(requests, req)
+			tml.ExtraExtensions = append(tml.ExtraExtensions, pkix.Extension{Id: oid, Value: []byte{0x05, 0x00}})
+			return nil
+		}),
+		WithSignHook(func(tml *x509.Certificate, req CertRequest) error {
+			switch req.CN {
+			case "evil":
+				return errors.WithStack(NewPolicyViolation("evil is not allowed"))
+			case "serial":
+				tml.SerialNumber = big.NewInt(1)
+			}
+			return nil
+		}))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	assert.Empty(t, requests)
+
+	pair, err := pki.NewCertWithMetadata("alice", true, nil, map[string]string{"team": "iot"})
+	assert.NoError(t, err)
+	_, cert, err := pair.Decode()
+	assert.NoError(t, err)
+	found := false
+	for _, ext := range cert.Extensions {
+		found = found || ext.Id.Equal(oid)
+	}
+	assert.True(t, found)
+	assert.Equal(t, "alice", requests[0].CN)
+	assert.True(t, requests[0].Server)
+	assert.Equal(t, "iot", requests[0].Metadata["team"])
+
+	_, err = pki.SignCSR(newTestCSR(t, "bob"), "bob", false, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, requests[1].CSR)
+
+	_, err = pki.NewCert("evil", false, nil)
+	assert.True(t, isPolicyViolation(err))
+	_, err = pki.Storage.GetLastByCn("evil")
+	assert.Error(t, err)
+	_, err = pki.NewCert("serial", false, nil)
+	assert.EqualError(t, errors.Cause(err), "sign hook changed serial")
+}
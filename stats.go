@@ -0,0 +1,71 @@
+package easyrsa
+
+import "github.com/pkg/errors"
+
+// StatsMonthLayout is a time layout of Stats.IssuedPerMonth keys
+const StatsMonthLayout = "2006-01"
+
+// Stats represent aggregated storage counters
+type Stats struct {
+	Total              int            // all stored pairs
+	CA                 int            // CA pairs
+	Active             int            // not revoked and not expired leaf pairs
+	Revoked            int            // revoked leaf pairs
+	Expired            int            // expired and not revoked leaf pairs
+	Undecodable        int            // pairs with broken certificate
+	CertOnly           int            // pairs stored without private key
+	IssuedPerCN        map[string]int // all pairs by common name
+	IssuedPerMonth     map[string]int // all pairs by issue month in StatsMonthLayout
+	IssuedPerRequester map[string]int // attributed pairs by requester
+}
+
+// Stats compute counters over all stored pairs
+func (p *PKI) Stats() (*Stats, error) {
+	list, err := p.GetCRL()
+	if err != nil {
+		// revoked pairs would be counted as active
+		return nil, errors.Wrap(err, "can`t get crl for stats")
+	}
+	revoked := make(map[string]bool)
+	for _, cert := range list.TBSCertList.RevokedCertificates {
+		revoked[cert.SerialNumber.Text(16)] = true
+	}
+
+	res := &Stats{
+		IssuedPerCN:        make(map[string]int),
+		IssuedPerMonth:     make(map[string]int),
+		IssuedPerRequester: make(map[string]int),
+	}
+	now := p.now()
+	err = ForEach(p.Storage, func(pair *X509Pair) error {
+		res.Total++
+		res.IssuedPerCN[pair.CN]++
+		if requester := pair.Metadata[MetadataRequester]; requester != "" {
+			res.IssuedPerRequester[requester]++
+		}
+		if !pair.HasKey() {
+			res.CertOnly++
+		}
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil {
+			res.Undecodable++
+			return nil
+		}
+		res.IssuedPerMonth[cert.NotBefore.UTC().Format(StatsMonthLayout)]++
+		switch {
+		case cert.IsCA:
+			res.CA++
+		case revoked[cert.SerialNumber.Text(16)]:
+			res.Revoked++
+		case now.After(cert.NotAfter):
+			res.Expired++
+		default:
+			res.Active++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get pairs for stats")
+	}
+	return res, nil
+}
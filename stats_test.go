@@ -0,0 +1,43 @@
+package easyrsa
+
+import (
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_Stats(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	_, _ = pki.NewCa()
+	_, _ = pki.NewCert("server", true, []string{""})
+	_, _ = pki.NewCert("server", true, []string{""})
+	_, _ = pki.NewCert("client", false, []string{""})
+	_ = pki.RevokeOne(big.NewInt(2))
+	putRawPair(testData, NewX509Pair([]byte("keybytes"), []byte("certbytes"), "broken", big.NewInt(42)))
+	client, _ := pki.Storage.GetBySerial(big.NewInt(4))
+	_ = pki.Storage.Put(NewX509Pair(nil, client.CertPemBytes, client.CN, client.Serial))
+
+	stats, err := pki.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, 5, stats.Total)
+	assert.Equal(t, 1, stats.CA)
+	assert.Equal(t, 2, stats.Active)
+	assert.Equal(t, 1, stats.Revoked)
+	assert.Equal(t, 0, stats.Expired)
+	assert.Equal(t, 1, stats.Undecodable)
+	assert.Equal(t, 1, stats.CertOnly)
+	assert.Equal(t, 2, stats.IssuedPerCN["server"])
+	assert.Equal(t, 4, stats.IssuedPerMonth[time.Now().Add(-10*time.Minute).UTC().Format(StatsMonthLayout)])
+
+	crlPath := filepath.Join(testData, "broken_crl.pem")
+	assert.NoError(t, ioutil.WriteFile(crlPath, []byte("garbage"), 0666))
+	broken := NewPKI(pki.Storage, pki.serialProvider, NewFileCRLHolder(crlPath), pkix.Name{})
+	_, err = broken.Stats()
+	assert.Error(t, err)
+}
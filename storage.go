@@ -4,14 +4,16 @@ import (
 	"context"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/json"
 	"fmt"
 	"github.com/gofrs/flock"
 	"io/ioutil"
 	"math/big"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -32,6 +34,55 @@ type KeyStorage interface {
 	GetAll() ([]*X509Pair, error)                   // Get all keypair
 }
 
+// KeyIterator can be implemented by KeyStorage to scan pairs with bounded memory.
+// Iteration stops on first error returned by fn, StopIteration stops it without error
+type KeyIterator interface {
+	ForEachByCN(cn string, fn func(pair *X509Pair) error) error // Call fn for every pair with CN.
+	ForEach(fn func(pair *X509Pair) error) error                // Call fn for every pair.
+}
+
+// StopIteration can be returned by KeyIterator callback to stop iteration
+var StopIteration = errors.New("stop iteration")
+
+// ForEachByCN call fn for every pair with cn, using KeyIterator if storage implement it
+func ForEachByCN(storage KeyStorage, cn string, fn func(pair *X509Pair) error) error {
+	if it, ok := storage.(KeyIterator); ok {
+		return it.ForEachByCN(cn, fn)
+	}
+	pairs, err := storage.GetByCN(cn)
+	if err != nil {
+		if _, ok := errors.Cause(err).(*NotExist); ok {
+			return nil
+		}
+		return err
+	}
+	return iterate(pairs, fn)
+}
+
+// ForEach call fn for every stored pair, using KeyIterator if storage implement it
+func ForEach(storage KeyStorage, fn func(pair *X509Pair) error) error {
+	if it, ok := storage.(KeyIterator); ok {
+		return it.ForEach(fn)
+	}
+	pairs, err := storage.GetAll()
+	if err != nil {
+		return err
+	}
+	return iterate(pairs, fn)
+}
+
+func iterate(pairs []*X509Pair, fn func(pair *X509Pair) error) error {
+	for _, pair := range pairs {
+		if err := fn(pair); err != nil {
+			if err == StopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
 type SerialProvider interface {
 	Next() (*big.Int, error) // Next return next uniq serial
 }
@@ -100,6 +151,18 @@ type FileSerialProvider struct {
 }
 
 func (p *FileSerialProvider) Next() (*big.Int, error) {
+	serials, err := p.Reserve(1)
+	if err != nil {
+		return nil, err
+	}
+	return serials[0], nil
+}
+
+// Reserve allocate n contiguous serials with one write of serial file
+func (p *FileSerialProvider) Reserve(n int) ([]*big.Int, error) {
+	if n <= 0 {
+		return nil, errors.Errorf("wrong number of serials %d", n)
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), LockTimeout)
 	defer cancel()
 	locked, err := p.locker.TryLockContext(ctx, LockPeriod)
@@ -112,7 +175,7 @@ func (p *FileSerialProvider) Next() (*big.Int, error) {
 	defer func() {
 		_ = p.locker.Unlock()
 	}()
-	res := big.NewInt(0)
+	last := big.NewInt(0)
 	file, err := os.OpenFile(p.path, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return nil, errors.Wrap(err, "can`t open serial file")
@@ -125,21 +188,104 @@ func (p *FileSerialProvider) Next() (*big.Int, error) {
 		return nil, errors.Wrap(err, "can`t read serial file")
 	}
 	if len(bytes) != 0 {
-		res.SetString(string(bytes), 16)
+		last.SetString(string(bytes), 16)
 	}
-	res.Add(big.NewInt(1), res)
+	res := serialRange(last, n)
 	_ = file.Truncate(0)
 	_, err = file.Seek(0, 0)
 	if err != nil {
 		return nil, errors.Wrap(err, "can`t write serial file")
 	}
-	_, err = file.Write([]byte(res.Text(16)))
+	_, err = file.Write([]byte(res[n-1].Text(16)))
 	if err != nil {
 		return nil, errors.Wrap(err, "can`t write serial file")
 	}
 	return res, nil
 }
 
+// Release step serial file back if serial is still the last one written
+func (p *FileSerialProvider) Release(serial *big.Int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), LockTimeout)
+	defer cancel()
+	locked, err := p.locker.TryLockContext(ctx, LockPeriod)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errors.New("can`t lock serial file")
+	}
+	defer func() {
+		_ = p.locker.Unlock()
+	}()
+	bytes, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return errors.Wrap(err, "can`t read serial file")
+	}
+	last, ok := new(big.Int).SetString(string(bytes), 16)
+	if !ok || last.Cmp(serial) != 0 {
+		return nil
+	}
+	err = ioutil.WriteFile(p.path, []byte(new(big.Int).Sub(last, big.NewInt(1)).Text(16)), 0666)
+	if err != nil {
+		return errors.Wrap(err, "can`t write serial file")
+	}
+	return nil
+}
+
+// Advance write serial to serial file if it`s ahead of the last one
+func (p *FileSerialProvider) Advance(serial *big.Int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), LockTimeout)
+	defer cancel()
+	locked, err := p.locker.TryLockContext(ctx, LockPeriod)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errors.New("can`t lock serial file")
+	}
+	defer func() {
+		_ = p.locker.Unlock()
+	}()
+	bytes, err := ioutil.ReadFile(p.path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "can`t read serial file")
+	}
+	last := big.NewInt(0)
+	if len(bytes) != 0 {
+		last.SetString(string(bytes), 16)
+	}
+	if last.Cmp(serial) >= 0 {
+		return nil
+	}
+	if err := ioutil.WriteFile(p.path, []byte(serial.Text(16)), 0666); err != nil {
+		return errors.Wrap(err, "can`t write serial file")
+	}
+	return nil
+}
+
+// Check make sure serial file is a regular file, or its dir exist if it`s not created yet.
+// Nothing is locked or created, lock would create the file
+func (p *FileSerialProvider) Check() error {
+	stat, err := os.Stat(p.path)
+	if os.IsNotExist(err) {
+		stat, err = os.Stat(filepath.Dir(p.path))
+		if err != nil {
+			return errors.Wrap(err, "can`t stat serial file dir")
+		}
+		if !stat.IsDir() {
+			return errors.Errorf("%s is not a directory", filepath.Dir(p.path))
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "can`t stat serial file")
+	}
+	if !stat.Mode().IsRegular() {
+		return errors.Errorf("%s is not a regular file", p.path)
+	}
+	return nil
+}
+
 func NewFileSerialProvider(path string) *FileSerialProvider {
 	return &FileSerialProvider{
 		locker: flock.New(path),
@@ -147,34 +293,187 @@ func NewFileSerialProvider(path string) *FileSerialProvider {
 	}
 }
 
-// DirKeyStorage is a implementation KeyStorage interface with storing pairs on fs
+// DirKeyStorage is a implementation KeyStorage interface with storing pairs on fs.
+// Keys are written with 0600 and key dir and pair dirs with 0700, keys accessible by others are refused:
+// ForEach skip their pairs, ForEachByCN and GetBySerial of them fail
 type DirKeyStorage struct {
-	keydir string
+	keydir        string
+	umask         os.FileMode // bits cleared from modes of written files and dirs
+	allowInsecure bool        // read keys accessible by others and keep existing modes
+}
+
+// DirKeyStorageOption configure optional DirKeyStorage behaviour
+type DirKeyStorageOption func(*DirKeyStorage)
+
+// WithUmask clear mask bits from modes of written files and dirs, e.g. 0077 make certs 0600
+func WithUmask(mask os.FileMode) DirKeyStorageOption {
+	return func(s *DirKeyStorage) {
+		s.umask = mask
+	}
+}
+
+// WithInsecurePermissions allow reading keys accessible by group or others, for migration only
+func WithInsecurePermissions() DirKeyStorageOption {
+	return func(s *DirKeyStorage) {
+		s.allowInsecure = true
+	}
 }
 
-func NewDirKeyStorage(keydir string) *DirKeyStorage {
-	return &DirKeyStorage{keydir: keydir}
+func NewDirKeyStorage(keydir string, opts ...DirKeyStorageOption) *DirKeyStorage {
+	s := &DirKeyStorage{keydir: keydir}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// Put keypair in dir as /keydir/cn/serial.[crt,key]
-func (s *DirKeyStorage) Put(pair *X509Pair) error {
+// Check make sure key dir exist and it`s a directory
+func (s *DirKeyStorage) Check() error {
+	stat, err := os.Stat(s.keydir)
+	if err != nil {
+		return errors.Wrap(err, "can`t stat key dir")
+	}
+	if !stat.IsDir() {
+		return errors.Errorf("%s is not a directory", s.keydir)
+	}
+	return nil
+}
+
+// Put keypair in dir as /keydir/cn/serial.[crt,key].
+// New files and dir are removed if writing of the pair fails, so no half written pair is left
+func (s *DirKeyStorage) Put(pair *X509Pair) (err error) {
+	if err := pair.Validate(); err != nil {
+		return errors.Wrap(err, "can`t put invalid pair")
+	}
+	var created []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(created) - 1; i >= 0; i-- {
+			_ = os.Remove(created[i])
+		}
+	}()
+	if pair.CN != "" {
+		if _, statErr := os.Stat(filepath.Join(s.keydir, pair.CN)); os.IsNotExist(statErr) {
+			created = append(created, filepath.Join(s.keydir, pair.CN))
+		}
+	}
 	certPath, keyPath, err := s.makePath(pair)
 	if err != nil {
 		return errors.Wrap(err, "can`t make path")
 	}
-	err = ioutil.WriteFile(certPath, pair.CertPemBytes, 0644)
+	if _, statErr := os.Stat(certPath); os.IsNotExist(statErr) {
+		created = append(created, certPath)
+	}
+	err = s.writeFile(certPath, pair.CertPemBytes, 0644)
 	if err != nil {
 		return errors.Wrap(err, "can`t write cert")
 	}
-	err = ioutil.WriteFile(keyPath, pair.KeyPemBytes, 0600)
+	if err := s.putMetadata(pair, certPath, &created); err != nil {
+		return err
+	}
+	if len(pair.KeyPemBytes) == 0 {
+		if err := os.Remove(keyPath); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "can`t remove stale key")
+		}
+		return nil
+	}
+	if _, statErr := os.Stat(keyPath); os.IsNotExist(statErr) {
+		created = append(created, keyPath)
+	}
+	err = s.writeFile(keyPath, pair.KeyPemBytes, 0600)
 	if err != nil {
 		return errors.Wrap(err, "can`t write key")
 	}
 	return nil
 }
 
+// putMetadata write metadata next to cert as serial.meta or remove stale one
+func (s *DirKeyStorage) putMetadata(pair *X509Pair, certPath string, created *[]string) error {
+	metaPath := metadataPath(certPath)
+	if len(pair.Metadata) == 0 {
+		if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "can`t remove stale metadata")
+		}
+		return nil
+	}
+	data, err := json.Marshal(pair.Metadata)
+	if err != nil {
+		return errors.Wrap(err, "can`t encode metadata")
+	}
+	if _, statErr := os.Stat(metaPath); os.IsNotExist(statErr) {
+		*created = append(*created, metaPath)
+	}
+	return errors.Wrap(s.writeFile(metaPath, data, 0644), "can`t write metadata")
+}
+
+func metadataPath(certPath string) string {
+	return strings.TrimSuffix(certPath, filepath.Ext(certPath)) + MetadataFileExtension
+}
+
+// writeFile write file via temp file in the same dir renamed over path. Mode is set before data is written,
+// so content is never readable with wider mode, existing file keep its mode only with insecure permissions
+func (s *DirKeyStorage) writeFile(path string, data []byte, mode os.FileMode) (err error) {
+	mode &^= s.umask
+	if s.allowInsecure {
+		if stat, statErr := os.Stat(path); statErr == nil {
+			mode = stat.Mode().Perm()
+		}
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+	}()
+	if err = file.Chmod(mode); err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// checkKey refuse key of cert path if it`s accessible by group or others
+func (s *DirKeyStorage) checkKey(certPath string) error {
+	if s.allowInsecure || runtime.GOOS == "windows" {
+		return nil
+	}
+	keyPath := strings.TrimSuffix(certPath, filepath.Ext(certPath)) + ".key"
+	stat, err := os.Stat(keyPath)
+	if err != nil {
+		return nil
+	}
+	if stat.Mode().Perm()&0077 != 0 {
+		return errors.Errorf("key %s is accessible by others with mode %04o, fix permissions or use WithInsecurePermissions",
+			keyPath, stat.Mode().Perm())
+	}
+	return nil
+}
+
+// CheckCN return error if cn can`t be a storage key: empty, with path separators or starting with a dot,
+// so names as "ca/" or "x/../ca" can`t resolve to dir of another cn
+func CheckCN(cn string) error {
+	if cn == "" || strings.ContainsAny(cn, "/\\\x00") || strings.HasPrefix(cn, ".") {
+		return errors.Errorf("wrong cn %q", cn)
+	}
+	return nil
+}
+
 // DeleteByCn delete all pair with cn
 func (s *DirKeyStorage) DeleteByCn(cn string) error {
+	if err := CheckCN(cn); err != nil {
+		return err
+	}
 	err := os.Remove(filepath.Join(s.keydir, cn))
 	if err != nil {
 		return errors.Wrap(err, "can`t delete by cn")
@@ -195,35 +494,21 @@ func (s *DirKeyStorage) DeleteBySerial(serial *big.Int) error {
 		return errors.Wrap(err, "can`t delete cert")
 	}
 	err = os.Remove(keyPath)
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		return errors.Wrap(err, "can`t delete key")
 	}
+	err = os.Remove(metadataPath(certPath))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "can`t delete metadata")
+	}
 	return nil
 }
 
 // GetByCN return all pairs with cn
 func (s *DirKeyStorage) GetByCN(cn string) ([]*X509Pair, error) {
 	res := make([]*X509Pair, 0)
-	err := filepath.Walk(filepath.Join(s.keydir, cn), func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if filepath.Ext(path) == CertFileExtension {
-			fileName := filepath.Base(path)
-			serial, err := strconv.ParseInt(fileName[0:len(fileName)-len(filepath.Ext(fileName))], 16, 64)
-			if err != nil {
-				return nil
-			}
-			certBytes, err := ioutil.ReadFile(path)
-			if err != nil {
-				return nil
-			}
-			keyBytes, err := ioutil.ReadFile(fmt.Sprintf("%s.key", path[0:len(path)-len(filepath.Ext(path))]))
-			if err != nil {
-				return nil
-			}
-			res = append(res, NewX509Pair(keyBytes, certBytes, cn, big.NewInt(serial)))
-		}
+	err := s.ForEachByCN(cn, func(pair *X509Pair) error {
+		res = append(res, pair)
 		return nil
 	})
 	if len(res) == 0 {
@@ -244,82 +529,134 @@ func (s *DirKeyStorage) GetLastByCn(cn string) (*X509Pair, error) {
 	return pairs[0], nil
 }
 
-// GetBySerial return only one pair with serial
+// GetBySerial return only one pair with serial, it`s looked up by file name in every cn dir
 func (s *DirKeyStorage) GetBySerial(serial *big.Int) (*X509Pair, error) {
-	var res *X509Pair
-	err := filepath.Walk(s.keydir, func(path string, info os.FileInfo, err error) error {
+	dirs, err := ioutil.ReadDir(s.keydir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "can`t read key dir")
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		certPath := filepath.Join(s.keydir, dir.Name(), serial.Text(16)+CertFileExtension)
+		pair, err := readPair(certPath)
 		if err != nil {
-			return nil
+			continue
 		}
-		if filepath.Ext(path) == CertFileExtension {
-			fileName := filepath.Base(path)
-			ser, err := strconv.ParseInt(fileName[0:len(fileName)-len(filepath.Ext(fileName))], 16, 64)
-			if err != nil {
-				return nil
-			}
-			cn := filepath.Base(filepath.Dir(path))
-			if serial.Text(16) == big.NewInt(ser).Text(16) {
-				certBytes, err := ioutil.ReadFile(path)
-				if err != nil {
-					return nil
-				}
-				keyBytes, err := ioutil.ReadFile(fmt.Sprintf("%s.key", path[0:len(path)-len(filepath.Ext(path))]))
-				if err != nil {
-					return nil
-				}
-				res = NewX509Pair(keyBytes, certBytes, cn, big.NewInt(ser))
-				return nil
-			}
+		if err := s.checkKey(certPath); err != nil {
+			return nil, err
 		}
-		return nil
-	})
-	if res == nil {
-		return nil, errors.WithStack(NewNotExist("not found"))
+		return pair, nil
 	}
-	return res, err
+	return nil, errors.WithStack(NewNotExist("not found"))
 }
 
 // GetAll return all pairs
 func (s *DirKeyStorage) GetAll() ([]*X509Pair, error) {
 	res := make([]*X509Pair, 0)
-	err := filepath.Walk(s.keydir, func(path string, info os.FileInfo, err error) error {
+	err := s.ForEach(func(pair *X509Pair) error {
+		res = append(res, pair)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t get all pairs")
+	}
+	return res, nil
+}
+
+// ForEachByCN call fn for every pair with cn, pairs are read one by one
+func (s *DirKeyStorage) ForEachByCN(cn string, fn func(pair *X509Pair) error) error {
+	if err := CheckCN(cn); err != nil {
+		return err
+	}
+	return s.walk(filepath.Join(s.keydir, cn), false, fn)
+}
+
+// ForEach call fn for every pair in storage, pairs are read one by one.
+// Pairs with keys accessible by others are skipped, so they don`t break listing of other cns
+func (s *DirKeyStorage) ForEach(fn func(pair *X509Pair) error) error {
+	return s.walk(s.keydir, true, fn)
+}
+
+// walk read pairs under root skipping unreadable ones, pairs with insecure keys are skipped too
+// if skipInsecure is set, walk fail on them otherwise
+func (s *DirKeyStorage) walk(root string, skipInsecure bool, fn func(pair *X509Pair) error) error {
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil
 		}
-		if filepath.Ext(path) == CertFileExtension {
-			fileName := filepath.Base(path)
-			ser, err := strconv.ParseInt(fileName[0:len(fileName)-len(filepath.Ext(fileName))], 16, 64)
-			if err != nil {
-				return nil
-			}
-			cn := filepath.Base(filepath.Dir(path))
-			certBytes, err := ioutil.ReadFile(path)
-			if err != nil {
-				return nil
-			}
-			keyBytes, err := ioutil.ReadFile(fmt.Sprintf("%s.key", path[0:len(path)-len(filepath.Ext(path))]))
-			if err != nil {
+		if filepath.Ext(path) != CertFileExtension {
+			return nil
+		}
+		pair, err := readPair(path)
+		if err != nil {
+			return nil
+		}
+		if err := s.checkKey(path); err != nil {
+			if skipInsecure {
 				return nil
 			}
-			res = append(res, NewX509Pair(keyBytes, certBytes, cn, big.NewInt(ser)))
+			return err
 		}
-		return nil
+		return fn(pair)
 	})
+	if err == StopIteration {
+		return nil
+	}
+	return err
+}
+
+// readPair read pair by cert path as /keydir/cn/serial.crt
+func readPair(certPath string) (*X509Pair, error) {
+	fileName := filepath.Base(certPath)
+	serial, ok := new(big.Int).SetString(fileName[0:len(fileName)-len(filepath.Ext(fileName))], 16)
+	if !ok {
+		return nil, errors.Errorf("wrong serial in file name %s", fileName)
+	}
+	cn := filepath.Base(filepath.Dir(certPath))
+	certBytes, err := ioutil.ReadFile(certPath)
 	if err != nil {
-		return nil, errors.Wrap(err, "can`t get all pairs")
+		return nil, err
 	}
-	return res, nil
+	keyBytes, err := ioutil.ReadFile(fmt.Sprintf("%s.key", certPath[0:len(certPath)-len(filepath.Ext(certPath))]))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	pair := NewX509Pair(keyBytes, certBytes, cn, serial)
+	metaBytes, err := ioutil.ReadFile(metadataPath(certPath))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(metaBytes) > 0 {
+		if err := json.Unmarshal(metaBytes, &pair.Metadata); err != nil {
+			return nil, errors.Wrap(err, "can`t parse metadata")
+		}
+	}
+	return pair, nil
 }
 
 func (s *DirKeyStorage) makePath(pair *X509Pair) (certPath, keyPath string, err error) {
-	if pair.CN == "" || pair.Serial == nil {
-		return "", "", errors.New("empty cn or serial")
+	if pair.Serial == nil {
+		return "", "", errors.New("empty serial")
+	}
+	if err := CheckCN(pair.CN); err != nil {
+		return "", "", err
 	}
 	basePath := filepath.Join(s.keydir, pair.CN)
-	err = os.MkdirAll(basePath, 0755)
+	mode := 0700 &^ s.umask
+	err = os.MkdirAll(basePath, mode)
 	if err != nil {
 		return "", "", errors.Wrap(err, "can`t create dir for key pair")
 	}
+	if !s.allowInsecure {
+		if err := os.Chmod(s.keydir, mode); err != nil {
+			return "", "", errors.Wrap(err, "can`t set mode of key dir")
+		}
+		if err := os.Chmod(basePath, mode); err != nil {
+			return "", "", errors.Wrap(err, "can`t set mode of pair dir")
+		}
+	}
 	return filepath.Join(basePath, fmt.Sprintf("%s.crt", pair.Serial.Text(16))),
 		filepath.Join(basePath, fmt.Sprintf("%s.key", pair.Serial.Text(16))), nil
 }
@@ -2,13 +2,19 @@ package easyrsa
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -18,6 +24,34 @@ func getTestDir() string {
 	return res
 }
 
+var testPairs = make(map[string]*X509Pair)
+
+// getTestPair return self signed pair with cn and serial, bytes are the same for the same arguments
+func getTestPair(cn string, serial int64) *X509Pair {
+	id := fmt.Sprintf("%s/%d", cn, serial)
+	if pair, ok := testPairs[id]; ok {
+		return NewX509Pair(pair.KeyPemBytes, pair.CertPemBytes, cn, big.NewInt(serial))
+	}
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+	tml := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, tml, tml, &key.PublicKey, key)
+	testPairs[id] = NewX509Pair(encodeKey(key),
+		pem.EncodeToMemory(&pem.Block{Type: PEMCertificateBlock, Bytes: der}), cn, big.NewInt(serial))
+	return getTestPair(cn, serial)
+}
+
+// putRawPair write pair files to dir bypassing storage validation
+func putRawPair(dir string, pair *X509Pair) {
+	_ = os.MkdirAll(filepath.Join(dir, pair.CN), 0755)
+	_ = ioutil.WriteFile(filepath.Join(dir, pair.CN, pair.Serial.Text(16)+".crt"), pair.CertPemBytes, 0644)
+	_ = ioutil.WriteFile(filepath.Join(dir, pair.CN, pair.Serial.Text(16)+".key"), pair.KeyPemBytes, 0600)
+}
+
 func TestDirKeyStorage_makePath(t *testing.T) {
 	type fields struct {
 		keydir string
@@ -156,12 +190,7 @@ func TestDirKeyStorage_Put(t *testing.T) {
 				keydir: filepath.Join(getTestDir(), "dir_keystorage"),
 			},
 			args: args{
-				pair: &X509Pair{
-					KeyPemBytes:  []byte("keybytes"),
-					CertPemBytes: []byte("certbytes"),
-					CN:           "good_cert",
-					Serial:       big.NewInt(66),
-				},
+				pair: getTestPair("good_cert", 66),
 			},
 			wantErr: false,
 		},
@@ -207,11 +236,11 @@ func TestDirKeyStorage_Put(t *testing.T) {
 		})
 	}
 	certBytes, _ := ioutil.ReadFile(filepath.Join(getTestDir(), "dir_keystorage", "good_cert/42.crt"))
-	if !bytes.Equal(certBytes, []byte("certbytes")) {
+	if !bytes.Equal(certBytes, getTestPair("good_cert", 66).CertPemBytes) {
 		t.Errorf("DirKeyStorage.Put() wrong cert bytes in result file")
 	}
 	keyBytes, _ := ioutil.ReadFile(filepath.Join(getTestDir(), "dir_keystorage", "good_cert/42.key"))
-	if !bytes.Equal(keyBytes, []byte("keybytes")) {
+	if !bytes.Equal(keyBytes, getTestPair("good_cert", 66).KeyPemBytes) {
 		t.Errorf("DirKeyStorage.Put() wrong key bytes in result file")
 	}
 }
@@ -308,7 +337,7 @@ func TestDirKeyStorage_GetByCN(t *testing.T) {
 			args: args{
 				cn: "good_cert",
 			},
-			want:    []*X509Pair{NewX509Pair([]byte("keybytes"), []byte("certbytes"), "good_cert", big.NewInt(66))},
+			want:    []*X509Pair{getTestPair("good_cert", 66)},
 			wantErr: false,
 		},
 	}
@@ -351,7 +380,7 @@ func TestDirKeyStorage_GetBySerial(t *testing.T) {
 			args: args{
 				serial: big.NewInt(66),
 			},
-			want:    NewX509Pair([]byte("keybytes"), []byte("certbytes"), "good_cert", big.NewInt(66)),
+			want:    getTestPair("good_cert", 66),
 			wantErr: false,
 		},
 	}
@@ -598,9 +627,9 @@ func TestDirKeyStorage_GetAll(t *testing.T) {
 		assert.Empty(t, all)
 	})
 	t.Run("good stor", func(t *testing.T) {
-		_ = stor.Put(NewX509Pair([]byte("keybytes"), []byte("certbytes"), "good_cert", big.NewInt(66)))
-		_ = stor.Put(NewX509Pair([]byte("keybytes"), []byte("certbytes"), "good_cert", big.NewInt(65)))
-		_ = stor.Put(NewX509Pair([]byte("keybytes"), []byte("certbytes"), "another_cert", big.NewInt(64)))
+		_ = stor.Put(getTestPair("good_cert", 66))
+		_ = stor.Put(getTestPair("good_cert", 65))
+		_ = stor.Put(getTestPair("another_cert", 64))
 		all, err := stor.GetAll()
 		assert.NoError(t, err)
 		assert.NotNil(t, all)
@@ -620,3 +649,145 @@ func TestDirKeyStorage_GetLastByCn(t *testing.T) {
 		assert.Nil(t, all)
 	})
 }
+
+func TestDirKeyStorage_ForEachByCN(t *testing.T) {
+	storPath := filepath.Join(getTestDir(), "empty_stor")
+	stor := NewDirKeyStorage(storPath)
+	_ = os.MkdirAll(storPath, 0755)
+	defer os.RemoveAll(storPath)
+	_ = stor.Put(getTestPair("good_cert", 66))
+	_ = stor.Put(getTestPair("good_cert", 65))
+	_ = stor.Put(getTestPair("another_cert", 64))
+	t.Run("by cn", func(t *testing.T) {
+		count := 0
+		err := stor.ForEachByCN("good_cert", func(pair *X509Pair) error {
+			assert.Equal(t, "good_cert", pair.CN)
+			count++
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+	t.Run("stop", func(t *testing.T) {
+		count := 0
+		err := stor.ForEach(func(pair *X509Pair) error {
+			count++
+			return StopIteration
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+	t.Run("error", func(t *testing.T) {
+		err := stor.ForEach(func(pair *X509Pair) error {
+			return os.ErrClosed
+		})
+		assert.Equal(t, os.ErrClosed, err)
+	})
+	t.Run("wrong cn", func(t *testing.T) {
+		for _, cn := range []string{"", "good_cert/", "x/../good_cert", "../empty_stor/good_cert", `x\y`, ".", "..", ".hidden"} {
+			assert.Error(t, CheckCN(cn), cn)
+			_, err := stor.GetLastByCn(cn)
+			assert.Error(t, err, cn)
+			assert.Error(t, stor.Put(getTestPair(cn, 1)), cn)
+		}
+		assert.NoError(t, CheckCN("web.example.com"))
+	})
+	t.Run("fallback", func(t *testing.T) {
+		count := 0
+		err := ForEachByCN(struct{ KeyStorage }{stor}, "good_cert", func(pair *X509Pair) error {
+			count++
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+		err = ForEachByCN(struct{ KeyStorage }{stor}, "not_exist", func(pair *X509Pair) error {
+			return os.ErrClosed
+		})
+		assert.NoError(t, err)
+	})
+}
+
+func TestDirKeyStorage_CertOnly(t *testing.T) {
+	storPath := filepath.Join(getTestDir(), "empty_stor")
+	stor := NewDirKeyStorage(storPath)
+	_ = os.MkdirAll(storPath, 0755)
+	defer os.RemoveAll(storPath)
+	full := getTestPair("cert_only", 66)
+	t.Run("put", func(t *testing.T) {
+		assert.NoError(t, stor.Put(full))
+		assert.NoError(t, stor.Put(NewX509Pair(nil, full.CertPemBytes, "cert_only", big.NewInt(66))))
+		_, err := os.Stat(filepath.Join(storPath, "cert_only", "42.key"))
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run("get", func(t *testing.T) {
+		pair, err := stor.GetBySerial(big.NewInt(66))
+		assert.NoError(t, err)
+		assert.False(t, pair.HasKey())
+		assert.Equal(t, full.CertPemBytes, pair.CertPemBytes)
+	})
+	t.Run("delete", func(t *testing.T) {
+		assert.NoError(t, stor.DeleteBySerial(big.NewInt(66)))
+		_, err := stor.GetBySerial(big.NewInt(66))
+		assert.Error(t, err)
+	})
+}
+
+func TestDirKeyStorage_Permissions(t *testing.T) {
+	dir := filepath.Join(getTestDir(), "perms")
+	defer os.RemoveAll(dir)
+	pair := getTestPair("perms", 77)
+
+	s := NewDirKeyStorage(dir)
+	_ = os.MkdirAll(filepath.Join(dir, "perms"), 0755)
+	_ = os.Chmod(dir, 0755)
+	_ = ioutil.WriteFile(filepath.Join(dir, "perms", "4d.key"), pair.KeyPemBytes, 0644)
+	assert.NoError(t, s.Put(pair))
+	stat, _ := os.Stat(dir)
+	assert.Equal(t, os.FileMode(0700), stat.Mode().Perm())
+	stat, _ = os.Stat(filepath.Join(dir, "perms"))
+	assert.Equal(t, os.FileMode(0700), stat.Mode().Perm())
+	files, _ := ioutil.ReadDir(filepath.Join(dir, "perms"))
+	assert.Len(t, files, 2)
+	stat, _ = os.Stat(filepath.Join(dir, "perms", "4d.key"))
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+	stat, _ = os.Stat(filepath.Join(dir, "perms", "4d.crt"))
+	assert.Equal(t, os.FileMode(0644), stat.Mode().Perm())
+	_, err := s.GetBySerial(big.NewInt(77))
+	assert.NoError(t, err)
+
+	other := getTestPair("other", 78)
+	assert.NoError(t, s.Put(other))
+	_ = os.Chmod(filepath.Join(dir, "perms", "4d.key"), 0644)
+	_, err = s.GetBySerial(big.NewInt(77))
+	assert.Error(t, err)
+	_, err = s.GetByCN("perms")
+	assert.Error(t, err)
+	// insecure key of one cn don`t break others
+	_, err = s.GetBySerial(big.NewInt(78))
+	assert.NoError(t, err)
+	all, err := s.GetAll()
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+	_, err = NewDirKeyStorage(dir, WithInsecurePermissions()).GetBySerial(big.NewInt(77))
+	assert.NoError(t, err)
+
+	assert.NoError(t, NewDirKeyStorage(dir, WithUmask(0077)).Put(pair))
+	stat, _ = os.Stat(filepath.Join(dir, "perms", "4d.crt"))
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+	stat, _ = os.Stat(filepath.Join(dir, "perms", "4d.key"))
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+}
+
+func TestDirKeyStorage_PutRollback(t *testing.T) {
+	dir := filepath.Join(getTestDir(), "put_rollback")
+	defer os.RemoveAll(dir)
+	pair := getTestPair("rollback", 88)
+	s := NewDirKeyStorage(dir)
+	// key path is a dir, so key write fails after cert is written
+	_ = os.MkdirAll(filepath.Join(dir, "rollback", "58.key"), 0700)
+	assert.Error(t, s.Put(pair))
+	_, err := os.Stat(filepath.Join(dir, "rollback", "58.crt"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "rollback", "58.key"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,25 @@
+package easyrsa
+
+import (
+	"crypto/x509/pkix"
+)
+
+// SubjectBuilder derive subject of new cert, CommonName is always overwritten with cn
+type SubjectBuilder func(cn string, req CertRequest) pkix.Name
+
+// WithSubjectBuilder build subjects with builder instead of copying subjTemplate of NewPKI
+func WithSubjectBuilder(builder SubjectBuilder) Option {
+	return func(p *PKI) {
+		p.subjectBuilder = builder
+	}
+}
+
+// subject return subject for cn, storage lookups rely on CommonName, so builder can`t change it
+func (p *PKI) subject(cn string, req CertRequest) pkix.Name {
+	subj := p.subjTemplate
+	if p.subjectBuilder != nil {
+		subj = p.subjectBuilder(cn, req)
+	}
+	subj.CommonName = cn
+	return subj
+}
@@ -0,0 +1,53 @@
+package easyrsa
+
+import (
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithSubjectBuilder(t *testing.T) {
+	var csrCN string
+	pki, cleanup := getTmpPki(WithSubjectBuilder(func(cn string, req CertRequest) pkix.Name {
+		name := pkix.Name{Organization: []string{"Example"}, CommonName: "ignored"}
+		switch {
+		case req.CA:
+			name.OrganizationalUnit = []string{"PKI"}
+		case req.Server:
+			name.OrganizationalUnit = []string{"Servers"}
+		default:
+			name.OrganizationalUnit = []string{"Devices"}
+			name.SerialNumber = cn + "-0001"
+		}
+		if req.CSR != nil {
+			csrCN = req.CSR.Subject.CommonName
+		}
+		return name
+	}))
+	defer cleanup()
+
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+	_, caCert, _ := ca.Decode()
+	assert.Equal(t, "ca", caCert.Subject.CommonName)
+	assert.Equal(t, []string{"PKI"}, caCert.Subject.OrganizationalUnit)
+
+	server, err := pki.NewCert("web", true, []string{""})
+	assert.NoError(t, err)
+	_, cert, _ := server.Decode()
+	assert.Equal(t, "web", cert.Subject.CommonName)
+	assert.Equal(t, []string{"Example"}, cert.Subject.Organization)
+	assert.Equal(t, []string{"Servers"}, cert.Subject.OrganizationalUnit)
+
+	client, err := pki.NewCert("dev", false, []string{""})
+	assert.NoError(t, err)
+	_, cert, _ = client.Decode()
+	assert.Equal(t, "dev-0001", cert.Subject.SerialNumber)
+
+	signed, err := pki.SignCSR(newTestCSR(t, "from-csr"), "dev2", false, []string{""})
+	assert.NoError(t, err)
+	assert.Equal(t, "from-csr", csrCN)
+	cert, _ = decodeCert(signed.CertPemBytes)
+	assert.Equal(t, "dev2", cert.Subject.CommonName)
+}
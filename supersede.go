@@ -0,0 +1,122 @@
+package easyrsa
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithSupersedeOnRenew revoke previous certs of CN with reason superseded once cert issued after them
+// is older than grace, so CRL tell which cert is current while clients roll over. Due certs of CN are revoked
+// whenever it`s reissued, others by RevokeSuperseded or RunSupersede. Exemptions of WithDuplicateCNPolicy apply
+func WithSupersedeOnRenew(grace time.Duration) Option {
+	return func(p *PKI) {
+		p.supersedeOnRenew = true
+		p.supersedeGrace = grace
+	}
+}
+
+// RevokeSuperseded revoke all certs superseded for longer than grace of WithSupersedeOnRenew, revoked serials are returned
+func (p *PKI) RevokeSuperseded() ([]*big.Int, error) {
+	if !p.supersedeOnRenew {
+		return nil, errors.New("supersede on renew is not configured")
+	}
+	cns := make(map[string]bool)
+	err := ForEach(p.Storage, func(pair *X509Pair) error {
+		cns[pair.CN] = true
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t list pairs")
+	}
+	names := make([]string, 0, len(cns))
+	for cn := range cns {
+		names = append(names, cn)
+	}
+	sort.Strings(names)
+	revoked := make([]*big.Int, 0)
+	for _, cn := range names {
+		serials, err := p.revokeSuperseded(cn)
+		revoked = append(revoked, serials...)
+		if err != nil {
+			return revoked, err
+		}
+	}
+	return revoked, nil
+}
+
+// RunSupersede call RevokeSuperseded every interval until ctx is done, errors are passed to onError if it`s not nil.
+// Instances which are not the leader skip revocation silently
+func (p *PKI) RunSupersede(ctx context.Context, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := p.RevokeSuperseded(); err != nil && onError != nil {
+			if _, ok := errors.Cause(err).(*NotLeader); !ok {
+				onError(err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// revokeSuperseded revoke active certs of cn whose successor was issued longer than grace ago
+func (p *PKI) revokeSuperseded(cn string) ([]*big.Int, error) {
+	revoked := make([]*big.Int, 0)
+	if duplicateCNExempt(cn) {
+		return revoked, nil
+	}
+	type issued struct {
+		serial *big.Int
+		peer   *big.Int // dual stack peer, it`s not a successor
+		time   time.Time
+	}
+	now := p.now()
+	active := make([]issued, 0)
+	err := ForEachByCN(p.Storage, cn, func(pair *X509Pair) error {
+		cert, err := decodeCert(pair.CertPemBytes)
+		if err != nil || !now.Before(cert.NotAfter) || p.IsRevoked(pair.Serial) {
+			return nil
+		}
+		active = append(active, issued{serial: pair.Serial, peer: dualStackPeer(pair.Metadata), time: cert.NotBefore.Add(NotBeforeBackdate)})
+		return nil
+	})
+	if err != nil {
+		return revoked, errors.Wrap(err, "can`t get active certs")
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if !active[i].time.Equal(active[j].time) {
+			return active[i].time.Before(active[j].time)
+		}
+		return active[i].serial.Cmp(active[j].serial) < 0
+	})
+	peers := func(a, b issued) bool {
+		return (a.peer != nil && a.peer.Cmp(b.serial) == 0) || (b.peer != nil && b.peer.Cmp(a.serial) == 0)
+	}
+	for i := 0; i+1 < len(active); i++ {
+		j := i + 1
+		for j < len(active) && peers(active[i], active[j]) {
+			j++
+		}
+		if j == len(active) {
+			continue
+		}
+		successor := active[j]
+		if now.Before(successor.time.Add(p.supersedeGrace)) {
+			continue
+		}
+		reason := "superseded by " + FormatSerial(successor.serial)
+		if err := p.RevokeWithReasonCode(active[i].serial, CRLReasonSuperseded, "", reason); err != nil {
+			return revoked, errors.Wrapf(err, "can`t revoke superseded cert %s", FormatSerial(active[i].serial))
+		}
+		revoked = append(revoked, active[i].serial)
+	}
+	return revoked, nil
+}
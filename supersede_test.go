@@ -0,0 +1,54 @@
+package easyrsa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_RevokeSuperseded(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithSupersedeOnRenew(time.Hour))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	start := time.Now()
+	pki.clock = func() time.Time { return start }
+	first, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	second, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	bob, err := pki.NewCert("bob", false, nil)
+	assert.NoError(t, err)
+	revoked, err := pki.RevokeSuperseded()
+	assert.NoError(t, err)
+	assert.Empty(t, revoked)
+	assert.False(t, pki.IsRevoked(first.Serial))
+
+	pki.clock = func() time.Time { return start.Add(2 * time.Hour) }
+	revoked, err = pki.RevokeSuperseded()
+	assert.NoError(t, err)
+	assert.Len(t, revoked, 1)
+	assert.Equal(t, 0, revoked[0].Cmp(first.Serial))
+	assert.False(t, pki.IsRevoked(second.Serial))
+	assert.False(t, pki.IsRevoked(bob.Serial))
+	list, err := pki.GetCRL()
+	assert.NoError(t, err)
+	assert.Equal(t, CRLReasonSuperseded, crlReason(list.TBSCertList.RevokedCertificates[0]))
+
+	// due certs are revoked on reissue, the new successor is within grace
+	third, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	assert.False(t, pki.IsRevoked(second.Serial))
+	pki.clock = func() time.Time { return start.Add(4 * time.Hour) }
+	_, err = pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	assert.True(t, pki.IsRevoked(second.Serial))
+	assert.False(t, pki.IsRevoked(third.Serial))
+
+	pki.supersedeGrace = 0
+	last, err := pki.NewCert("bob", false, nil)
+	assert.NoError(t, err)
+	assert.True(t, pki.IsRevoked(bob.Serial))
+	assert.False(t, pki.IsRevoked(last.Serial))
+}
@@ -0,0 +1,147 @@
+package easyrsa
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Credential name suffixes written by CredentialExporter, e.g. web.cert for prefix web
+const (
+	CredentialCertSuffix = ".cert" // cert followed by intermediates
+	CredentialKeySuffix  = ".key"  // private key
+	CredentialCASuffix   = ".ca"   // issuing chain including the root
+)
+
+// systemd-creds --with-key values
+const (
+	CredsKeyAuto     = "auto"      // host+tpm2 if TPM2 is available, host otherwise
+	CredsKeyHost     = "host"      // host key /var/lib/systemd/credential.secret
+	CredsKeyTPM2     = "tpm2"      // sealed with TPM2 only
+	CredsKeyHostTPM2 = "host+tpm2" // host key and TPM2 both required
+)
+
+// CredentialEncrypter encrypt credential content, name is embedded and checked by systemd on decryption
+type CredentialEncrypter func(ctx context.Context, name string, plaintext []byte) ([]byte, error)
+
+// SystemdCredsEncrypt encrypt credentials with systemd-creds encrypt, withKey is one of CredsKey values,
+// args are passed before input and output, e.g. --tpm2-pcrs=7
+func SystemdCredsEncrypt(withKey string, args ...string) CredentialEncrypter {
+	return func(ctx context.Context, name string, plaintext []byte) ([]byte, error) {
+		cmdArgs := append([]string{"encrypt", "--name=" + name, "--with-key=" + withKey}, args...)
+		cmd := exec.CommandContext(ctx, "systemd-creds", append(cmdArgs, "-", "-")...)
+		cmd.Stdin = bytes.NewReader(plaintext)
+		stderr := bytes.NewBuffer(nil)
+		cmd.Stderr = stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, errors.Wrapf(err, "systemd-creds failed: %s", strings.TrimSpace(stderr.String()))
+		}
+		return out, nil
+	}
+}
+
+// CredentialExporter write pairs as systemd credentials to credstore dir for LoadCredential and ImportCredential,
+// e.g. /etc/credstore, or /etc/credstore.encrypted with encrypter for LoadCredentialEncrypted
+type CredentialExporter struct {
+	pki     *PKI
+	dir     string
+	encrypt CredentialEncrypter
+}
+
+// NewCredentialExporter create exporter to dir, plain credentials are written if encrypt is nil
+func NewCredentialExporter(pki *PKI, dir string, encrypt CredentialEncrypter) *CredentialExporter {
+	return &CredentialExporter{pki: pki, dir: dir, encrypt: encrypt}
+}
+
+// Export write cert, key and ca credentials of pair named by prefix, paths of written credentials are returned
+func (e *CredentialExporter) Export(ctx context.Context, prefix string, pair *X509Pair) ([]string, error) {
+	if prefix == "" || strings.HasPrefix(prefix, ".") || strings.ContainsAny(prefix, `/\`) {
+		return nil, errors.Errorf("invalid credential prefix %q", prefix)
+	}
+	if !pair.HasKey() {
+		return nil, errors.New("pair has no key")
+	}
+	if len(pair.ChainPemBytes) == 0 {
+		if err := e.pki.ResolveChain(pair); err != nil {
+			return nil, errors.Wrap(err, "can`t resolve ca chain")
+		}
+	}
+	if err := os.MkdirAll(e.dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "can`t create credstore")
+	}
+	creds := []struct {
+		suffix string
+		data   []byte
+	}{
+		{CredentialCertSuffix, pair.FullChainPEM()},
+		{CredentialKeySuffix, pair.KeyPemBytes},
+		{CredentialCASuffix, pair.CAChainPEM()},
+	}
+	res := make([]string, 0, len(creds))
+	for _, cred := range creds {
+		name := prefix + cred.suffix
+		data := cred.data
+		if e.encrypt != nil {
+			var err error
+			if data, err = e.encrypt(ctx, name, cred.data); err != nil {
+				return res, errors.Wrapf(err, "can`t encrypt %s", name)
+			}
+		}
+		path := filepath.Join(e.dir, name)
+		if err := writeCredential(path, data); err != nil {
+			return res, errors.Wrapf(err, "can`t write %s", name)
+		}
+		res = append(res, path)
+	}
+	return res, nil
+}
+
+// UnitDirectives return unit [Service] directives loading credentials of prefix
+func (e *CredentialExporter) UnitDirectives(prefix string) []string {
+	directive := "LoadCredential"
+	if e.encrypt != nil {
+		directive = "LoadCredentialEncrypted"
+	}
+	res := make([]string, 0, 3)
+	for _, suffix := range []string{CredentialCertSuffix, CredentialKeySuffix, CredentialCASuffix} {
+		name := prefix + suffix
+		res = append(res, fmt.Sprintf("%s=%s:%s", directive, name, filepath.Join(e.dir, name)))
+	}
+	return res
+}
+
+// writeCredential atomically replace path with root only readable file
+func writeCredential(path string, data []byte) error {
+	return writeFileAtomic(path, data, 0600)
+}
+
+// writeFileAtomic replace path with file of mode by rename of synced temp file
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,57 @@
+package easyrsa
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialExporter(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	pair, err := pki.NewCert("web", true, nil)
+	assert.NoError(t, err)
+	dir := filepath.Join(getTestDir(), "credstore")
+	defer os.RemoveAll(dir)
+
+	t.Run("plain", func(t *testing.T) {
+		e := NewCredentialExporter(pki, dir, nil)
+		paths, err := e.Export(context.Background(), "web", pair)
+		assert.NoError(t, err)
+		assert.Len(t, paths, 3)
+		key, err := ioutil.ReadFile(filepath.Join(dir, "web"+CredentialKeySuffix))
+		assert.NoError(t, err)
+		assert.Equal(t, pair.KeyPemBytes, key)
+		stat, err := os.Stat(filepath.Join(dir, "web"+CredentialCASuffix))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+		assert.Equal(t, "LoadCredential=web.cert:"+filepath.Join(dir, "web.cert"), e.UnitDirectives("web")[0])
+		_, err = e.Export(context.Background(), "../web", pair)
+		assert.Error(t, err)
+	})
+
+	t.Run("systemd-creds", func(t *testing.T) {
+		bin := filepath.Join(getTestDir(), "bin")
+		assert.NoError(t, os.MkdirAll(bin, 0755))
+		defer os.RemoveAll(bin)
+		// fake systemd-creds prefixing stdin with it`s arguments
+		script := "#!/bin/sh\necho \"$@\"\ncat\n"
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(bin, "systemd-creds"), []byte(script), 0755))
+		t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+		encDir := filepath.Join(dir, "encrypted")
+		e := NewCredentialExporter(pki, encDir, SystemdCredsEncrypt(CredsKeyTPM2, "--tpm2-pcrs=7"))
+		_, err := e.Export(context.Background(), "web", pair)
+		assert.NoError(t, err)
+		cert, err := ioutil.ReadFile(filepath.Join(encDir, "web"+CredentialCertSuffix))
+		assert.NoError(t, err)
+		assert.Equal(t, "encrypt --name=web.cert --with-key=tpm2 --tpm2-pcrs=7 - -\n"+string(pair.FullChainPEM()), string(cert))
+		assert.Contains(t, e.UnitDirectives("web")[1], "LoadCredentialEncrypted=web.key:")
+	})
+}
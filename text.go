@@ -0,0 +1,420 @@
+package easyrsa
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// textTimeLayout is a time layout of openssl text output
+const textTimeLayout = "Jan _2 15:04:05 2006 GMT"
+
+var textSignatureAlgorithms = map[string]string{
+	"1.2.840.113549.1.1.4":  "md5WithRSAEncryption",
+	"1.2.840.113549.1.1.5":  "sha1WithRSAEncryption",
+	"1.2.840.113549.1.1.11": "sha256WithRSAEncryption",
+	"1.2.840.113549.1.1.12": "sha384WithRSAEncryption",
+	"1.2.840.113549.1.1.13": "sha512WithRSAEncryption",
+	"1.2.840.113549.1.1.10": "rsassaPss",
+	"1.2.840.10045.4.1":     "ecdsa-with-SHA1",
+	"1.2.840.10045.4.3.2":   "ecdsa-with-SHA256",
+	"1.2.840.10045.4.3.3":   "ecdsa-with-SHA384",
+	"1.2.840.10045.4.3.4":   "ecdsa-with-SHA512",
+	"1.3.101.112":           "ED25519",
+}
+
+var textAttributeNames = map[string]string{
+	"2.5.4.3":                    "CN",
+	"2.5.4.5":                    "serialNumber",
+	"2.5.4.6":                    "C",
+	"2.5.4.7":                    "L",
+	"2.5.4.8":                    "ST",
+	"2.5.4.9":                    "street",
+	"2.5.4.10":                   "O",
+	"2.5.4.11":                   "OU",
+	"2.5.4.17":                   "postalCode",
+	"1.2.840.113549.1.9.1":       "emailAddress",
+	"0.9.2342.19200300.100.1.25": "DC",
+}
+
+var textCRLReasons = []string{"Unspecified", "Key Compromise", "CA Compromise", "Affiliation Changed",
+	"Superseded", "Cessation Of Operation", "Certificate Hold", "", "Remove From CRL", "Privilege Withdrawn", "AA Compromise"}
+
+// textWriter collect indented lines
+type textWriter struct {
+	strings.Builder
+}
+
+func (w *textWriter) line(indent int, format string, args ...interface{}) {
+	w.WriteString(strings.Repeat(" ", indent))
+	fmt.Fprintf(w, format, args...)
+	w.WriteByte('\n')
+}
+
+// hexBlock write bytes as colon separated hex octets, perLine octets on a line
+func (w *textWriter) hexBlock(indent, perLine int, b []byte) {
+	for i := 0; i < len(b); i += perLine {
+		end := i + perLine
+		if end > len(b) {
+			end = len(b)
+		}
+		chunk := hexColon(b[i:end], false)
+		if end < len(b) {
+			chunk += ":"
+		}
+		w.line(indent, "%s", chunk)
+	}
+}
+
+func hexColon(b []byte, upper bool) string {
+	octets := make([]string, len(b))
+	for i, o := range b {
+		octets[i] = fmt.Sprintf("%02x", o)
+		if upper {
+			octets[i] = strings.ToUpper(octets[i])
+		}
+	}
+	return strings.Join(octets, ":")
+}
+
+// textName render name in DER order as openssl "CN = ca, O = Example"
+func textName(raw []byte) string {
+	var rdns pkix.RDNSequence
+	if _, err := asn1.Unmarshal(raw, &rdns); err != nil {
+		return "<unparsable name>"
+	}
+	return textRDNs(rdns)
+}
+
+func textRDNs(rdns pkix.RDNSequence) string {
+	parts := make([]string, 0, len(rdns))
+	for _, rdn := range rdns {
+		for _, attr := range rdn {
+			name, ok := textAttributeNames[attr.Type.String()]
+			if !ok {
+				name = attr.Type.String()
+			}
+			parts = append(parts, fmt.Sprintf("%s = %v", name, attr.Value))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func textSerial(serial *big.Int) string {
+	if serial.IsInt64() && serial.Sign() >= 0 {
+		return fmt.Sprintf("%d (0x%s)", serial.Int64(), serial.Text(16))
+	}
+	return FormatSerial(serial)
+}
+
+func textSignatureAlgorithm(alg pkix.AlgorithmIdentifier) string {
+	if name, ok := textSignatureAlgorithms[alg.Algorithm.String()]; ok {
+		return name
+	}
+	return alg.Algorithm.String()
+}
+
+// DumpCertText return human readable cert description similar to "openssl x509 -text"
+func DumpCertText(cert *x509.Certificate) string {
+	var outer struct {
+		TBS       asn1.RawValue
+		Algorithm pkix.AlgorithmIdentifier
+		Signature asn1.BitString
+	}
+	_, _ = asn1.Unmarshal(cert.Raw, &outer)
+	alg := textSignatureAlgorithm(outer.Algorithm)
+
+	w := &textWriter{}
+	w.line(0, "Certificate:")
+	w.line(4, "Data:")
+	w.line(8, "Version: %d (0x%x)", cert.Version, cert.Version-1)
+	if cert.SerialNumber.IsInt64() {
+		w.line(8, "Serial Number: %s", textSerial(cert.SerialNumber))
+	} else {
+		w.line(8, "Serial Number:")
+		w.line(12, "%s", textSerial(cert.SerialNumber))
+	}
+	w.line(8, "Signature Algorithm: %s", alg)
+	w.line(8, "Issuer: %s", textName(cert.RawIssuer))
+	w.line(8, "Validity")
+	w.line(12, "Not Before: %s", cert.NotBefore.UTC().Format(textTimeLayout))
+	w.line(12, "Not After : %s", cert.NotAfter.UTC().Format(textTimeLayout))
+	w.line(8, "Subject: %s", textName(cert.RawSubject))
+	w.line(8, "Subject Public Key Info:")
+	textPublicKey(w, cert.PublicKey)
+	if len(cert.Extensions) > 0 {
+		w.line(8, "X509v3 extensions:")
+		for _, ext := range cert.Extensions {
+			textCertExtension(w, cert, ext)
+		}
+	}
+	w.line(4, "Signature Algorithm: %s", alg)
+	w.line(4, "Signature Value:")
+	w.hexBlock(8, 18, outer.Signature.Bytes)
+	return w.String()
+}
+
+func textPublicKey(w *textWriter, pub interface{}) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		w.line(12, "Public Key Algorithm: rsaEncryption")
+		w.line(16, "Public-Key: (%d bit)", key.N.BitLen())
+		w.line(16, "Modulus:")
+		w.hexBlock(20, 15, append([]byte{0}, key.N.Bytes()...))
+		w.line(16, "Exponent: %d (0x%x)", key.E, key.E)
+	case *ecdsa.PublicKey:
+		w.line(12, "Public Key Algorithm: id-ecPublicKey")
+		w.line(16, "Public-Key: (%d bit)", key.Curve.Params().BitSize)
+		w.line(16, "pub:")
+		size := (key.Curve.Params().BitSize + 7) / 8
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		key.X.FillBytes(point[1 : 1+size])
+		key.Y.FillBytes(point[1+size:])
+		w.hexBlock(20, 15, point)
+		w.line(16, "NIST CURVE: %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		w.line(12, "Public Key Algorithm: ED25519")
+		w.line(16, "ED25519 Public-Key:")
+		w.line(16, "pub:")
+		w.hexBlock(20, 15, key)
+	default:
+		w.line(12, "Public Key Algorithm: %T", pub)
+	}
+}
+
+func textCertExtension(w *textWriter, cert *x509.Certificate, ext pkix.Extension) {
+	title := func(name string) {
+		if ext.Critical {
+			w.line(12, "%s: critical", name)
+		} else {
+			w.line(12, "%s:", name)
+		}
+	}
+	switch ext.Id.String() {
+	case "2.5.29.15":
+		title("X509v3 Key Usage")
+		w.line(16, "%s", strings.Join(textKeyUsage(cert.KeyUsage), ", "))
+	case "2.5.29.37":
+		title("X509v3 Extended Key Usage")
+		w.line(16, "%s", strings.Join(textExtKeyUsage(cert), ", "))
+	case "2.5.29.19":
+		title("X509v3 Basic Constraints")
+		switch {
+		case !cert.IsCA:
+			w.line(16, "CA:FALSE")
+		case cert.MaxPathLen > 0 || cert.MaxPathLenZero:
+			w.line(16, "CA:TRUE, pathlen:%d", cert.MaxPathLen)
+		default:
+			w.line(16, "CA:TRUE")
+		}
+	case "2.5.29.14":
+		title("X509v3 Subject Key Identifier")
+		w.line(16, "%s", hexColon(cert.SubjectKeyId, true))
+	case oidAuthorityKeyIdentifier.String():
+		title("X509v3 Authority Key Identifier")
+		w.line(16, "%s", hexColon(cert.AuthorityKeyId, true))
+	case "2.5.29.17":
+		title("X509v3 Subject Alternative Name")
+		names := make([]string, 0)
+		for _, name := range cert.DNSNames {
+			names = append(names, "DNS:"+name)
+		}
+		for _, email := range cert.EmailAddresses {
+			names = append(names, "email:"+email)
+		}
+		for _, ip := range cert.IPAddresses {
+			names = append(names, "IP Address:"+ip.String())
+		}
+		for _, uri := range cert.URIs {
+			names = append(names, "URI:"+uri.String())
+		}
+		w.line(16, "%s", strings.Join(names, ", "))
+	case "2.5.29.30":
+		title("X509v3 Name Constraints")
+		if len(cert.PermittedDNSDomains) > 0 {
+			w.line(16, "Permitted:")
+			for _, domain := range cert.PermittedDNSDomains {
+				w.line(18, "DNS:%s", domain)
+			}
+		}
+		if len(cert.ExcludedDNSDomains) > 0 {
+			w.line(16, "Excluded:")
+			for _, domain := range cert.ExcludedDNSDomains {
+				w.line(18, "DNS:%s", domain)
+			}
+		}
+	case "2.5.29.31":
+		title("X509v3 CRL Distribution Points")
+		for _, url := range cert.CRLDistributionPoints {
+			w.line(16, "Full Name:")
+			w.line(18, "URI:%s", url)
+		}
+	case "1.3.6.1.5.5.7.1.1":
+		title("Authority Information Access")
+		for _, url := range cert.OCSPServer {
+			w.line(16, "OCSP - URI:%s", url)
+		}
+		for _, url := range cert.IssuingCertificateURL {
+			w.line(16, "CA Issuers - URI:%s", url)
+		}
+	case "2.16.840.1.113730.1.1":
+		title("Netscape Cert Type")
+		var bits asn1.BitString
+		_, _ = asn1.Unmarshal(ext.Value, &bits)
+		types := make([]string, 0)
+		for i, name := range []string{"SSL Client", "SSL Server", "S/MIME", "Object Signing"} {
+			if bits.At(i) == 1 {
+				types = append(types, name)
+			}
+		}
+		w.line(16, "%s", strings.Join(types, ", "))
+	case oidCTPoison.String():
+		title("CT Precertificate Poison")
+		w.line(16, "NULL")
+	case oidCTSCTList.String():
+		title("CT Precertificate SCTs")
+		w.hexBlock(16, 18, ext.Value)
+	default:
+		title(ext.Id.String())
+		w.hexBlock(16, 18, ext.Value)
+	}
+}
+
+func textKeyUsage(usage x509.KeyUsage) []string {
+	names := []string{"Digital Signature", "Non Repudiation", "Key Encipherment", "Data Encipherment",
+		"Key Agreement", "Certificate Sign", "CRL Sign", "Encipher Only", "Decipher Only"}
+	res := make([]string, 0)
+	for i, name := range names {
+		if usage&(1<<uint(i)) != 0 {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+func textExtKeyUsage(cert *x509.Certificate) []string {
+	names := map[x509.ExtKeyUsage]string{
+		x509.ExtKeyUsageAny:             "Any Extended Key Usage",
+		x509.ExtKeyUsageServerAuth:      "TLS Web Server Authentication",
+		x509.ExtKeyUsageClientAuth:      "TLS Web Client Authentication",
+		x509.ExtKeyUsageCodeSigning:     "Code Signing",
+		x509.ExtKeyUsageEmailProtection: "E-mail Protection",
+		x509.ExtKeyUsageTimeStamping:    "Time Stamping",
+		x509.ExtKeyUsageOCSPSigning:     "OCSP Signing",
+	}
+	res := make([]string, 0)
+	for _, usage := range cert.ExtKeyUsage {
+		if name, ok := names[usage]; ok {
+			res = append(res, name)
+		} else {
+			res = append(res, fmt.Sprintf("%d", usage))
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		res = append(res, oid.String())
+	}
+	return res
+}
+
+// DumpCRLText return human readable CRL description similar to "openssl crl -text"
+func DumpCRLText(crl *pkix.CertificateList) string {
+	tbs := crl.TBSCertList
+	alg := textSignatureAlgorithm(crl.SignatureAlgorithm)
+	w := &textWriter{}
+	w.line(0, "Certificate Revocation List (CRL):")
+	w.line(8, "Version %d (0x%x)", tbs.Version+1, tbs.Version)
+	w.line(8, "Signature Algorithm: %s", alg)
+	w.line(8, "Issuer: %s", textRDNs(tbs.Issuer))
+	w.line(8, "Last Update: %s", tbs.ThisUpdate.UTC().Format(textTimeLayout))
+	if tbs.NextUpdate.IsZero() {
+		w.line(8, "Next Update: NONE")
+	} else {
+		w.line(8, "Next Update: %s", tbs.NextUpdate.UTC().Format(textTimeLayout))
+	}
+	if len(tbs.Extensions) > 0 {
+		w.line(8, "CRL extensions:")
+		for _, ext := range tbs.Extensions {
+			textCRLExtension(w, crl, ext)
+		}
+	}
+	if len(tbs.RevokedCertificates) == 0 {
+		w.line(0, "No Revoked Certificates.")
+	} else {
+		w.line(0, "Revoked Certificates:")
+		for _, revoked := range tbs.RevokedCertificates {
+			w.line(4, "Serial Number: %s", strings.ToUpper(hexColon(revoked.SerialNumber.Bytes(), false)))
+			w.line(8, "Revocation Date: %s", revoked.RevocationTime.UTC().Format(textTimeLayout))
+			for _, ext := range revoked.Extensions {
+				if !ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 21}) {
+					continue
+				}
+				var reason asn1.Enumerated
+				if _, err := asn1.Unmarshal(ext.Value, &reason); err == nil && int(reason) < len(textCRLReasons) {
+					w.line(8, "CRL entry extensions:")
+					w.line(12, "X509v3 CRL Reason Code:")
+					w.line(16, "%s", textCRLReasons[reason])
+				}
+			}
+		}
+	}
+	w.line(4, "Signature Algorithm: %s", alg)
+	w.line(4, "Signature Value:")
+	w.hexBlock(8, 18, crl.SignatureValue.Bytes)
+	return w.String()
+}
+
+func textCRLExtension(w *textWriter, crl *pkix.CertificateList, ext pkix.Extension) {
+	critical := ""
+	if ext.Critical {
+		critical = " critical"
+	}
+	switch ext.Id.String() {
+	case "2.5.29.20":
+		w.line(12, "X509v3 CRL Number:%s", critical)
+		number := new(big.Int)
+		_, _ = asn1.Unmarshal(ext.Value, &number)
+		w.line(16, "%s", number.String())
+	case oidAuthorityKeyIdentifier.String():
+		w.line(12, "X509v3 Authority Key Identifier:%s", critical)
+		w.line(16, "%s", hexColon(crlAuthorityKeyID(crl), true))
+	case oidIssuingDistributionPoint.String():
+		w.line(12, "X509v3 Issuing Distribution Point:%s", critical)
+		w.hexBlock(16, 18, ext.Value)
+	default:
+		w.line(12, "%s:%s", ext.Id.String(), critical)
+		w.hexBlock(16, 18, ext.Value)
+	}
+}
+
+// DumpText return text of pair cert followed by text of every chain cert
+func (pair *X509Pair) DumpText() (string, error) {
+	cert, err := decodeCert(pair.CertPemBytes)
+	if err != nil {
+		return "", err
+	}
+	res := DumpCertText(cert)
+	rest := pair.ChainPemBytes
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		chainCert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return "", errors.Wrap(err, "can`t parse chain cert")
+		}
+		res += DumpCertText(chainCert)
+	}
+	return res, nil
+}
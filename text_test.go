@@ -0,0 +1,65 @@
+package easyrsa
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpCertText(t *testing.T) {
+	pki, cleanup := getTmpPki(WithDeterministicMode("text", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+	defer cleanup()
+	_, _ = pki.NewCa()
+	pair, err := pki.NewCert("web", true, []string{""})
+	assert.NoError(t, err)
+	cert, _ := decodeCert(pair.CertPemBytes)
+	text := DumpCertText(cert)
+	for _, expected := range []string{
+		"        Version: 3 (0x2)\n",
+		"        Serial Number: 2 (0x2)\n",
+		"        Signature Algorithm: sha256WithRSAEncryption\n",
+		"        Issuer: CN = ca\n",
+		"            Not Before: Jan  2 02:54:05 2020 GMT\n",
+		"        Subject: CN = web\n",
+		"                Public-Key: (2048 bit)\n",
+		"                Exponent: 65537 (0x10001)\n",
+		"            X509v3 Key Usage: critical\n                Digital Signature, Key Encipherment, Key Agreement\n",
+		"            X509v3 Extended Key Usage:\n                TLS Web Server Authentication\n",
+		"            X509v3 Basic Constraints: critical\n                CA:FALSE\n",
+		"            X509v3 Subject Alternative Name:\n                DNS:web, IP Address:127.0.0.1\n",
+		"            Netscape Cert Type:\n                SSL Server\n",
+		"    Signature Value:\n",
+	} {
+		assert.Contains(t, text, expected)
+	}
+
+	text, err = pair.DumpText()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(text, "Certificate:\n"))
+	assert.Contains(t, text, "                CA:TRUE\n")
+
+	_, err = (&X509Pair{CertPemBytes: []byte("bad")}).DumpText()
+	assert.Error(t, err)
+}
+
+func TestDumpCRLText(t *testing.T) {
+	pki, cleanup := getTmpPki(WithDeterministicMode("text", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+	defer cleanup()
+	_, _ = pki.NewCa()
+	pair, _ := pki.NewCert("web", true, []string{""})
+	assert.NoError(t, pki.RevokeOne(pair.Serial))
+	list, err := pki.GetCRL()
+	assert.NoError(t, err)
+	text := DumpCRLText(list)
+	for _, expected := range []string{
+		"Certificate Revocation List (CRL):\n",
+		"        Issuer: CN = ca\n",
+		"        Last Update: Jan  2 03:04:05 2020 GMT\n",
+		"Revoked Certificates:\n    Serial Number: 02\n        Revocation Date: Jan  2 03:04:05 2020 GMT\n",
+		"    Signature Algorithm: sha256WithRSAEncryption\n",
+	} {
+		assert.Contains(t, text, expected)
+	}
+}
@@ -0,0 +1,140 @@
+package easyrsa
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is an instrumentation name of spans created by the PKI and TracingKeyStorage
+const TracerName = "github.com/productsupcom/go-easyrsa"
+
+// WithTracerProvider record OpenTelemetry spans of issue, sign, revoke and crl.sign operations with tp.
+// PKI methods take no context, so spans are roots, wrap storage with NewTracingKeyStorage for storage latency
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(p *PKI) {
+		p.tracer = tp.Tracer(TracerName)
+	}
+}
+
+// startSpan start span of PKI operation, no op span is returned if tracing is not configured
+func (p *PKI) startSpan(name string, attrs ...attribute.KeyValue) trace.Span {
+	return startSpan(p.tracer, name, attrs...)
+}
+
+func startSpan(tracer trace.Tracer, name string, attrs ...attribute.KeyValue) trace.Span {
+	if tracer == nil {
+		return trace.SpanFromContext(context.Background())
+	}
+	_, span := tracer.Start(context.Background(), name, trace.WithAttributes(attrs...))
+	return span
+}
+
+// endSpan record err and end span, NotExist is not an error of lookups
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		if _, ok := errors.Cause(err).(*NotExist); !ok {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+func spanSerial(serial *big.Int) attribute.KeyValue {
+	if serial == nil {
+		return attribute.String("easyrsa.serial", "")
+	}
+	return attribute.String("easyrsa.serial", serial.Text(16))
+}
+
+// TracingKeyStorage implement KeyStorage interface, recording span of every call to the wrapped storage,
+// so latency of remote backends is visible. Span names are "storage.<method>"
+type TracingKeyStorage struct {
+	KeyStorage
+	tracer trace.Tracer
+}
+
+// NewTracingKeyStorage wrap storage with spans of tp
+func NewTracingKeyStorage(storage KeyStorage, tp trace.TracerProvider) *TracingKeyStorage {
+	return &TracingKeyStorage{KeyStorage: storage, tracer: tp.Tracer(TracerName)}
+}
+
+func (s *TracingKeyStorage) Put(pair *X509Pair) error {
+	span := startSpan(s.tracer, "storage.Put", attribute.String("easyrsa.cn", pair.CN), spanSerial(pair.Serial))
+	err := s.KeyStorage.Put(pair)
+	endSpan(span, err)
+	return err
+}
+
+func (s *TracingKeyStorage) GetByCN(cn string) ([]*X509Pair, error) {
+	span := startSpan(s.tracer, "storage.GetByCN", attribute.String("easyrsa.cn", cn))
+	res, err := s.KeyStorage.GetByCN(cn)
+	span.SetAttributes(attribute.Int("easyrsa.pairs", len(res)))
+	endSpan(span, err)
+	return res, err
+}
+
+func (s *TracingKeyStorage) GetLastByCn(cn string) (*X509Pair, error) {
+	span := startSpan(s.tracer, "storage.GetLastByCn", attribute.String("easyrsa.cn", cn))
+	res, err := s.KeyStorage.GetLastByCn(cn)
+	endSpan(span, err)
+	return res, err
+}
+
+func (s *TracingKeyStorage) GetBySerial(serial *big.Int) (*X509Pair, error) {
+	span := startSpan(s.tracer, "storage.GetBySerial", spanSerial(serial))
+	res, err := s.KeyStorage.GetBySerial(serial)
+	endSpan(span, err)
+	return res, err
+}
+
+func (s *TracingKeyStorage) DeleteByCn(cn string) error {
+	span := startSpan(s.tracer, "storage.DeleteByCn", attribute.String("easyrsa.cn", cn))
+	err := s.KeyStorage.DeleteByCn(cn)
+	endSpan(span, err)
+	return err
+}
+
+func (s *TracingKeyStorage) DeleteBySerial(serial *big.Int) error {
+	span := startSpan(s.tracer, "storage.DeleteBySerial", spanSerial(serial))
+	err := s.KeyStorage.DeleteBySerial(serial)
+	endSpan(span, err)
+	return err
+}
+
+func (s *TracingKeyStorage) GetAll() ([]*X509Pair, error) {
+	span := startSpan(s.tracer, "storage.GetAll")
+	res, err := s.KeyStorage.GetAll()
+	span.SetAttributes(attribute.Int("easyrsa.pairs", len(res)))
+	endSpan(span, err)
+	return res, err
+}
+
+// ForEachByCN implement KeyIterator with wrapped storage iterator, if it has one
+func (s *TracingKeyStorage) ForEachByCN(cn string, fn func(pair *X509Pair) error) error {
+	span := startSpan(s.tracer, "storage.ForEachByCN", attribute.String("easyrsa.cn", cn))
+	err := ForEachByCN(s.KeyStorage, cn, fn)
+	endSpan(span, err)
+	return err
+}
+
+// ForEach implement KeyIterator with wrapped storage iterator, if it has one
+func (s *TracingKeyStorage) ForEach(fn func(pair *X509Pair) error) error {
+	span := startSpan(s.tracer, "storage.ForEach")
+	err := ForEach(s.KeyStorage, fn)
+	endSpan(span, err)
+	return err
+}
+
+// Check check wrapped storage if it implement Checker
+func (s *TracingKeyStorage) Check() error {
+	if checker, ok := s.KeyStorage.(Checker); ok {
+		return checker.Check()
+	}
+	return nil
+}
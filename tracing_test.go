@@ -0,0 +1,65 @@
+package easyrsa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanNames(rec *tracetest.SpanRecorder) []string {
+	res := make([]string, 0)
+	for _, span := range rec.Ended() {
+		res = append(res, span.Name())
+	}
+	return res
+}
+
+func TestPKI_Tracing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithTracerProvider(tp))
+	defer cleanup()
+	pki.Storage = NewTracingKeyStorage(pki.Storage, tp)
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	pair, err := pki.NewCert("alice", false, nil)
+	assert.NoError(t, err)
+	_, err = pki.SignCSR(newTestCSR(t, "bob"), "bob", false, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pki.Revoke(pair.Serial, "admin", "test"))
+	names := spanNames(rec)
+	assert.Contains(t, names, "issue")
+	assert.Contains(t, names, "sign")
+	assert.Contains(t, names, "revoke")
+	assert.Contains(t, names, "crl.sign")
+	assert.Contains(t, names, "storage.Put")
+	assert.Contains(t, names, "storage.GetLastByCn")
+
+	for _, span := range rec.Ended() {
+		if span.Name() == "sign" {
+			assert.Equal(t, codes.Unset, span.Status().Code)
+			attrs := make(map[string]string)
+			for _, attr := range span.Attributes() {
+				attrs[string(attr.Key)] = attr.Value.Emit()
+			}
+			assert.Equal(t, "bob", attrs["easyrsa.cn"])
+			assert.NotEmpty(t, attrs["easyrsa.serial"])
+		}
+	}
+
+	assert.Error(t, pki.RevokeWithReasonCode(pair.Serial, 100, "admin", "wrong code"))
+	last := rec.Ended()[len(rec.Ended())-1]
+	assert.Equal(t, "revoke", last.Name())
+	assert.Equal(t, codes.Error, last.Status().Code)
+}
+
+func TestPKI_TracingDisabled(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	span := pki.startSpan("issue")
+	assert.False(t, span.IsRecording())
+	endSpan(span, nil)
+}
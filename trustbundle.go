@@ -0,0 +1,102 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TrustBundleEntry describe one CA cert of trust bundle
+type TrustBundleEntry struct {
+	Subject      string    `json:"subject"`        // CA subject
+	Serial       string    `json:"serial"`         // hex serial
+	SHA256       string    `json:"sha256"`         // hex sha256 fingerprint of DER cert
+	SubjectKeyID string    `json:"subject_key_id"` // hex subject key id
+	NotBefore    time.Time `json:"not_before"`     // validity start
+	NotAfter     time.Time `json:"not_after"`      // expiry
+	Root         bool      `json:"root"`           // self signed root, intermediate otherwise
+	PEM          string    `json:"pem"`            // pem encoded cert
+}
+
+// TrustBundle is a set of all valid CA generations, intermediates and trust anchors for truststores
+type TrustBundle struct {
+	Certs []*TrustBundleEntry // entries ordered by NotBefore
+	PEM   []byte              // concatenated pem certs in the same order
+}
+
+// ExportTrustBundle return bundle of CA certs accepted by CACertPool
+func (p *PKI) ExportTrustBundle() (*TrustBundle, error) {
+	cas, caPems, err := p.validCACerts(nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(cas, func(i, j int) bool {
+		if !cas[i].NotBefore.Equal(cas[j].NotBefore) {
+			return cas[i].NotBefore.Before(cas[j].NotBefore)
+		}
+		return cas[i].SerialNumber.Cmp(cas[j].SerialNumber) < 0
+	})
+	res := &TrustBundle{Certs: make([]*TrustBundleEntry, 0, len(cas))}
+	buf := bytes.NewBuffer(nil)
+	for _, ca := range cas {
+		fingerprint := sha256.Sum256(ca.Raw)
+		certPem := caPems[ca]
+		res.Certs = append(res.Certs, &TrustBundleEntry{
+			Subject:      ca.Subject.String(),
+			Serial:       ca.SerialNumber.Text(16),
+			SHA256:       hex.EncodeToString(fingerprint[:]),
+			SubjectKeyID: hex.EncodeToString(ca.SubjectKeyId),
+			NotBefore:    ca.NotBefore,
+			NotAfter:     ca.NotAfter,
+			Root:         isSelfSigned(ca),
+			PEM:          string(certPem),
+		})
+		buf.Write(certPem)
+	}
+	res.PEM = buf.Bytes()
+	return res, nil
+}
+
+// JSON encode bundle entries
+func (b *TrustBundle) JSON() ([]byte, error) {
+	return json.MarshalIndent(map[string]interface{}{"certs": b.Certs}, "", "  ")
+}
+
+// TrustBundleHandler serve trust bundle as pem, or as json if request path ends with .json,
+// e.g. mounted at /trust-bundle.pem and /trust-bundle.json. ETag and Last-Modified allow conditional requests
+func (p *PKI) TrustBundleHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bundle, err := p.ExportTrustBundle()
+		if err != nil {
+			http.Error(w, "can`t export trust bundle", http.StatusServiceUnavailable)
+			return
+		}
+		content := bundle.PEM
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		if strings.HasSuffix(req.URL.Path, ".json") {
+			if content, err = bundle.JSON(); err != nil {
+				http.Error(w, "can`t encode trust bundle", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+		}
+		var modified time.Time
+		for _, entry := range bundle.Certs {
+			if entry.NotBefore.After(modified) {
+				modified = entry.NotBefore
+			}
+		}
+		sum := sha256.Sum256(content)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+		http.ServeContent(w, req, "", modified, bytes.NewReader(content))
+	})
+}
@@ -0,0 +1,72 @@
+package easyrsa
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_ExportTrustBundle(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.ExportTrustBundle()
+	assert.Error(t, err)
+
+	_, err = pki.NewCa()
+	assert.NoError(t, err)
+	_, err = pki.NewCa()
+	assert.NoError(t, err)
+
+	bundle, err := pki.ExportTrustBundle()
+	assert.NoError(t, err)
+	assert.Len(t, bundle.Certs, 2)
+	rest, blocks := bundle.PEM, 0
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		blocks++
+	}
+	assert.Equal(t, 2, blocks)
+	for _, entry := range bundle.Certs {
+		assert.True(t, entry.Root)
+		assert.Len(t, entry.SHA256, 64)
+		assert.NotEmpty(t, entry.SubjectKeyID)
+	}
+	assert.False(t, bundle.Certs[1].NotBefore.Before(bundle.Certs[0].NotBefore))
+
+	handler := pki.TrustBundleHandler()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/trust-bundle.pem", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/pem-certificate-chain", rec.Header().Get("Content-Type"))
+	assert.Equal(t, bundle.PEM, rec.Body.Bytes())
+	etag := rec.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	req := httptest.NewRequest(http.MethodGet, "/trust-bundle.pem", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/trust-bundle.json", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var decoded struct {
+		Certs []*TrustBundleEntry `json:"certs"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &decoded))
+	assert.Len(t, decoded.Certs, 2)
+	assert.Equal(t, bundle.Certs[0].SHA256, decoded.Certs[0].SHA256)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/trust-bundle.pem", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,392 @@
+package easyrsa
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultMaxClockSkew       = time.Minute      // MaxSkew of TrustedTimePolicy if zero
+	DefaultTimeCheckInterval  = 10 * time.Minute // Interval of TrustedTimePolicy if zero
+	DefaultTimeSourceTimeout  = 5 * time.Second  // Timeout of TrustedTimePolicy if zero
+	ntpEpochOffset            = 2208988800       // seconds between 1900 and 1970
+	roughtimeRequestSize      = 1024
+	roughtimeDelegationPrefix = "RoughTime v1 delegation signature--\x00"
+	roughtimeResponsePrefix   = "RoughTime v1 response signature\x00"
+)
+
+// TimeSource measure offset of local clock against trusted time
+type TimeSource interface {
+	Offset(ctx context.Context) (offset, radius time.Duration, err error) // source time minus local time and its uncertainty
+}
+
+// TrustedTimePolicy configure check of local clock before signing, so certs and CRLs aren`t issued with wrong
+// validity when host clock drift, e.g. on appliances without RTC battery
+type TrustedTimePolicy struct {
+	Sources  []TimeSource  // NTP or roughtime sources
+	Quorum   int           // sources that must respond and agree with local clock, 1 if zero
+	MaxSkew  time.Duration // allowed offset beyond source uncertainty, DefaultMaxClockSkew if zero
+	Interval time.Duration // successful check is trusted for interval, DefaultTimeCheckInterval if zero
+	Timeout  time.Duration // query timeout of one source, DefaultTimeSourceTimeout if zero
+}
+
+// WithTrustedTime refuse issuance and CRL signing with UntrustedTime error if local clock
+// can`t be confirmed by policy sources
+func WithTrustedTime(policy *TrustedTimePolicy) Option {
+	return func(p *PKI) {
+		p.trustedTime = policy
+	}
+}
+
+// trustedTimeCheck keep time of last successful check
+type trustedTimeCheck struct {
+	mu      sync.Mutex
+	checked time.Time
+}
+
+// CheckTime query sources of TrustedTimePolicy now, nil is returned if no policy is set
+func (p *PKI) CheckTime(ctx context.Context) error {
+	policy := p.trustedTime
+	if policy == nil {
+		return nil
+	}
+	quorum, maxSkew, timeout := policy.Quorum, policy.MaxSkew, policy.Timeout
+	if quorum <= 0 {
+		quorum = 1
+	}
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxClockSkew
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeSourceTimeout
+	}
+	if len(policy.Sources) < quorum {
+		return errors.WithStack(NewUntrustedTime(fmt.Sprintf("%d time sources are configured, quorum is %d", len(policy.Sources), quorum)))
+	}
+
+	problems := make([]string, len(policy.Sources))
+	var wg sync.WaitGroup
+	for i, source := range policy.Sources {
+		wg.Add(1)
+		go func(i int, source TimeSource) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			offset, radius, err := source.Offset(ctx)
+			switch {
+			case err != nil:
+				problems[i] = err.Error()
+			case offset-radius > maxSkew || -offset-radius > maxSkew:
+				problems[i] = fmt.Sprintf("local clock is off by %s±%s", offset, radius)
+			}
+		}(i, source)
+	}
+	wg.Wait()
+	agreed := 0
+	var failed []string
+	for i, problem := range problems {
+		if problem == "" {
+			agreed++
+		} else {
+			failed = append(failed, fmt.Sprintf("source %d: %s", i, problem))
+		}
+	}
+	if agreed < quorum {
+		return errors.WithStack(NewUntrustedTime(fmt.Sprintf("%d time sources confirm local clock, quorum is %d: %s",
+			agreed, quorum, strings.Join(failed, "; "))))
+	}
+	p.timeCheck.mu.Lock()
+	p.timeCheck.checked = time.Now()
+	p.timeCheck.mu.Unlock()
+	return nil
+}
+
+// checkTrustedTime run CheckTime unless last successful check is within policy interval
+func (p *PKI) checkTrustedTime() error {
+	policy := p.trustedTime
+	if policy == nil {
+		return nil
+	}
+	interval := policy.Interval
+	if interval <= 0 {
+		interval = DefaultTimeCheckInterval
+	}
+	p.timeCheck.mu.Lock()
+	checked := p.timeCheck.checked
+	p.timeCheck.mu.Unlock()
+	if !checked.IsZero() && time.Since(checked) < interval {
+		return nil
+	}
+	return p.CheckTime(context.Background())
+}
+
+// exchange send request to udp addr and return response with local send and receive times
+func exchange(ctx context.Context, addr string, request []byte) ([]byte, time.Time, time.Time, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, errors.Wrapf(err, "can`t dial %s", addr)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	sent := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return nil, time.Time{}, time.Time{}, errors.Wrapf(err, "can`t query %s", addr)
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	received := time.Now()
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, errors.Wrapf(err, "can`t read response of %s", addr)
+	}
+	return buf[:n], sent, received, nil
+}
+
+// NTPTimeSource implement TimeSource interface with SNTP query, RFC 4330. Responses are not authenticated,
+// use several sources with quorum or roughtime where spoofing matter
+type NTPTimeSource struct {
+	addr string
+}
+
+// NewNTPTimeSource return source querying NTP server addr, port 123 is used if addr has no port
+func NewNTPTimeSource(addr string) *NTPTimeSource {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "123")
+	}
+	return &NTPTimeSource{addr: addr}
+}
+
+func ntpTime(b []byte) time.Time {
+	sec := binary.BigEndian.Uint32(b[0:4])
+	frac := binary.BigEndian.Uint32(b[4:8])
+	nsec := (int64(frac) * int64(time.Second)) >> 32
+	return time.Unix(int64(sec)-ntpEpochOffset, nsec)
+}
+
+func (s *NTPTimeSource) Offset(ctx context.Context) (time.Duration, time.Duration, error) {
+	request := make([]byte, 48)
+	request[0] = 0x23 // leap 0, version 4, client mode
+	// random transmit timestamp is echoed as origin and bind response to request
+	if _, err := io.ReadFull(rand.Reader, request[40:48]); err != nil {
+		return 0, 0, errors.Wrap(err, "can`t generate ntp nonce")
+	}
+	response, sent, received, err := exchange(ctx, s.addr, request)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch {
+	case len(response) < 48:
+		return 0, 0, errors.Errorf("short ntp response of %s", s.addr)
+	case response[0]&0x07 != 4:
+		return 0, 0, errors.Errorf("ntp response of %s is not in server mode", s.addr)
+	case response[0]>>6 == 3 || response[1] == 0 || response[1] > 15:
+		return 0, 0, errors.Errorf("ntp server %s is not synchronized", s.addr)
+	case !bytes.Equal(response[24:32], request[40:48]):
+		return 0, 0, errors.Errorf("ntp response of %s is not for this request", s.addr)
+	}
+	t2, t3 := ntpTime(response[32:40]), ntpTime(response[40:48])
+	offset := (t2.Sub(sent) + t3.Sub(received)) / 2
+	delay := received.Sub(sent) - t3.Sub(t2)
+	if delay < 0 {
+		delay = 0
+	}
+	return offset, delay / 2, nil
+}
+
+// RoughtimeSource implement TimeSource interface with Google roughtime protocol, responses are
+// authenticated by server long term ed25519 key, so time can`t be spoofed on the network
+type RoughtimeSource struct {
+	addr      string
+	publicKey ed25519.PublicKey
+}
+
+// NewRoughtimeSource return source querying roughtime server addr with long term key publicKey
+func NewRoughtimeSource(addr string, publicKey ed25519.PublicKey) *RoughtimeSource {
+	return &RoughtimeSource{addr: addr, publicKey: publicKey}
+}
+
+func roughtimeTag(name string) uint32 {
+	b := []byte(name + "\x00\x00\x00\x00")
+	return binary.LittleEndian.Uint32(b[:4])
+}
+
+var (
+	tagNONC = roughtimeTag("NONC")
+	tagPAD  = roughtimeTag("PAD\xff")
+	tagSIG  = roughtimeTag("SIG")
+	tagSREP = roughtimeTag("SREP")
+	tagCERT = roughtimeTag("CERT")
+	tagINDX = roughtimeTag("INDX")
+	tagPATH = roughtimeTag("PATH")
+	tagROOT = roughtimeTag("ROOT")
+	tagMIDP = roughtimeTag("MIDP")
+	tagRADI = roughtimeTag("RADI")
+	tagDELE = roughtimeTag("DELE")
+	tagPUBK = roughtimeTag("PUBK")
+	tagMINT = roughtimeTag("MINT")
+	tagMAXT = roughtimeTag("MAXT")
+)
+
+// encodeRoughtime encode message of tag values, values must be 4 bytes aligned
+func encodeRoughtime(msg map[uint32][]byte) []byte {
+	tags := make([]uint32, 0, len(msg))
+	for tag := range msg {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(tags)))
+	offset := uint32(0)
+	for _, tag := range tags[:len(tags)-1] {
+		offset += uint32(len(msg[tag]))
+		_ = binary.Write(&buf, binary.LittleEndian, offset)
+	}
+	for _, tag := range tags {
+		_ = binary.Write(&buf, binary.LittleEndian, tag)
+	}
+	for _, tag := range tags {
+		buf.Write(msg[tag])
+	}
+	return buf.Bytes()
+}
+
+// decodeRoughtime decode message to tag values
+func decodeRoughtime(b []byte) (map[uint32][]byte, error) {
+	if len(b) < 4 || len(b)%4 != 0 {
+		return nil, errors.New("wrong roughtime message size")
+	}
+	n := int(binary.LittleEndian.Uint32(b))
+	if n == 0 || n > len(b)/8 {
+		return nil, errors.New("wrong roughtime tag count")
+	}
+	header := 4 + 4*(n-1) + 4*n
+	values := b[header:]
+	msg := make(map[uint32][]byte, n)
+	start := uint32(0)
+	for i := 0; i < n; i++ {
+		end := uint32(len(values))
+		if i < n-1 {
+			end = binary.LittleEndian.Uint32(b[4+4*i:])
+		}
+		tag := binary.LittleEndian.Uint32(b[4+4*(n-1)+4*i:])
+		if end < start || end > uint32(len(values)) || end%4 != 0 {
+			return nil, errors.New("wrong roughtime value offset")
+		}
+		if i > 0 && tag <= binary.LittleEndian.Uint32(b[4+4*(n-1)+4*(i-1):]) {
+			return nil, errors.New("roughtime tags are not sorted")
+		}
+		msg[tag] = values[start:end]
+		start = end
+	}
+	return msg, nil
+}
+
+func roughtimeFields(b []byte, tags ...uint32) (map[uint32][]byte, error) {
+	msg, err := decodeRoughtime(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if _, ok := msg[tag]; !ok {
+			return nil, errors.Errorf("roughtime message has no %q", string(binary.LittleEndian.AppendUint32(nil, tag)))
+		}
+	}
+	return msg, nil
+}
+
+func roughtimeLeaf(nonce []byte) []byte {
+	sum := sha512.Sum512(append([]byte{0}, nonce...))
+	return sum[:32]
+}
+
+func roughtimeNode(left, right []byte) []byte {
+	sum := sha512.Sum512(append(append([]byte{1}, left...), right...))
+	return sum[:32]
+}
+
+func (s *RoughtimeSource) Offset(ctx context.Context) (time.Duration, time.Duration, error) {
+	nonce := make([]byte, 64)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return 0, 0, errors.Wrap(err, "can`t generate roughtime nonce")
+	}
+	request := encodeRoughtime(map[uint32][]byte{tagNONC: nonce, tagPAD: nil})
+	request = encodeRoughtime(map[uint32][]byte{tagNONC: nonce, tagPAD: make([]byte, roughtimeRequestSize-len(request))})
+	response, sent, received, err := exchange(ctx, s.addr, request)
+	if err != nil {
+		return 0, 0, err
+	}
+	midp, radi, err := s.verify(response, nonce)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "wrong roughtime response of %s", s.addr)
+	}
+	rtt := received.Sub(sent)
+	return midp.Sub(sent.Add(rtt / 2)), radi + rtt/2, nil
+}
+
+// verify check signatures and merkle path of response to nonce, midpoint and radius are returned
+func (s *RoughtimeSource) verify(response, nonce []byte) (time.Time, time.Duration, error) {
+	msg, err := roughtimeFields(response, tagSIG, tagSREP, tagCERT, tagINDX, tagPATH)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	cert, err := roughtimeFields(msg[tagCERT], tagDELE, tagSIG)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	if !ed25519.Verify(s.publicKey, append([]byte(roughtimeDelegationPrefix), cert[tagDELE]...), cert[tagSIG]) {
+		return time.Time{}, 0, errors.New("delegation is not signed by server key")
+	}
+	dele, err := roughtimeFields(cert[tagDELE], tagPUBK, tagMINT, tagMAXT)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	if len(dele[tagPUBK]) != ed25519.PublicKeySize || len(dele[tagMINT]) != 8 || len(dele[tagMAXT]) != 8 {
+		return time.Time{}, 0, errors.New("wrong delegation")
+	}
+	if !ed25519.Verify(dele[tagPUBK], append([]byte(roughtimeResponsePrefix), msg[tagSREP]...), msg[tagSIG]) {
+		return time.Time{}, 0, errors.New("response is not signed by delegated key")
+	}
+	srep, err := roughtimeFields(msg[tagSREP], tagROOT, tagMIDP, tagRADI)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	if len(srep[tagROOT]) != 32 || len(srep[tagMIDP]) != 8 || len(srep[tagRADI]) != 4 || len(msg[tagINDX]) != 4 ||
+		len(msg[tagPATH])%32 != 0 {
+		return time.Time{}, 0, errors.New("wrong signed response")
+	}
+	hash, index := roughtimeLeaf(nonce), binary.LittleEndian.Uint32(msg[tagINDX])
+	for path := msg[tagPATH]; len(path) > 0; path = path[32:] {
+		if index&1 == 0 {
+			hash = roughtimeNode(hash, path[:32])
+		} else {
+			hash = roughtimeNode(path[:32], hash)
+		}
+		index >>= 1
+	}
+	if !bytes.Equal(hash, srep[tagROOT]) {
+		return time.Time{}, 0, errors.New("response is not for this request")
+	}
+	midp := binary.LittleEndian.Uint64(srep[tagMIDP])
+	if midp < binary.LittleEndian.Uint64(dele[tagMINT]) || midp > binary.LittleEndian.Uint64(dele[tagMAXT]) {
+		return time.Time{}, 0, errors.New("midpoint is out of delegation validity")
+	}
+	radi := time.Duration(binary.LittleEndian.Uint32(srep[tagRADI])) * time.Microsecond
+	return time.UnixMicro(int64(midp)), radi, nil
+}
@@ -0,0 +1,132 @@
+package easyrsa
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func isUntrustedTime(err error) bool {
+	_, ok := errors.Cause(err).(*UntrustedTime)
+	return ok
+}
+
+// serveUDP answer every request with respond until test end, address is returned
+func serveUDP(t *testing.T, respond func(request []byte) []byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response := respond(buf[:n]); response != nil {
+				_, _ = conn.WriteTo(response, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func ntpServer(t *testing.T, offset time.Duration) string {
+	return serveUDP(t, func(request []byte) []byte {
+		now := time.Now().Add(offset)
+		ts := make([]byte, 8)
+		binary.BigEndian.PutUint32(ts, uint32(now.Unix()+ntpEpochOffset))
+		binary.BigEndian.PutUint32(ts[4:], uint32((uint64(now.Nanosecond())<<32)/uint64(time.Second)))
+		response := make([]byte, 48)
+		response[0], response[1] = 0x24, 2
+		copy(response[24:32], request[40:48])
+		copy(response[32:40], ts)
+		copy(response[40:48], ts)
+		return response
+	})
+}
+
+func roughtimeServer(t *testing.T, rootKey ed25519.PrivateKey, offset time.Duration) string {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	u64 := func(v uint64) []byte { return binary.LittleEndian.AppendUint64(nil, v) }
+	dele := encodeRoughtime(map[uint32][]byte{tagPUBK: pub, tagMINT: u64(0), tagMAXT: u64(^uint64(0))})
+	cert := encodeRoughtime(map[uint32][]byte{
+		tagDELE: dele,
+		tagSIG:  ed25519.Sign(rootKey, append([]byte(roughtimeDelegationPrefix), dele...)),
+	})
+	return serveUDP(t, func(request []byte) []byte {
+		msg, err := decodeRoughtime(request)
+		if err != nil || len(request) < roughtimeRequestSize {
+			return nil
+		}
+		srep := encodeRoughtime(map[uint32][]byte{
+			tagROOT: roughtimeLeaf(msg[tagNONC]),
+			tagMIDP: u64(uint64(time.Now().Add(offset).UnixMicro())),
+			tagRADI: binary.LittleEndian.AppendUint32(nil, 1000),
+		})
+		return encodeRoughtime(map[uint32][]byte{
+			tagSIG:  ed25519.Sign(key, append([]byte(roughtimeResponsePrefix), srep...)),
+			tagSREP: srep,
+			tagCERT: cert,
+			tagINDX: make([]byte, 4),
+			tagPATH: nil,
+		})
+	})
+}
+
+func TestTimeSources(t *testing.T) {
+	ctx := context.Background()
+	offset, radius, err := NewNTPTimeSource(ntpServer(t, time.Hour)).Offset(ctx)
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(time.Hour), float64(offset), float64(time.Second))
+	assert.True(t, radius < time.Second)
+
+	rootPub, rootKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	addr := roughtimeServer(t, rootKey, -time.Hour)
+	offset, _, err = NewRoughtimeSource(addr, rootPub).Offset(ctx)
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(-time.Hour), float64(offset), float64(time.Second))
+
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	_, _, err = NewRoughtimeSource(addr, otherPub).Offset(ctx)
+	assert.Error(t, err)
+}
+
+func TestPKI_TrustedTime(t *testing.T) {
+	rootPub, rootKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	policy := &TrustedTimePolicy{
+		Sources: []TimeSource{
+			NewNTPTimeSource(ntpServer(t, 0)),
+			NewRoughtimeSource(roughtimeServer(t, rootKey, 0), rootPub),
+			NewNTPTimeSource(ntpServer(t, 2*time.Hour)),
+		},
+		Quorum:  2,
+		Timeout: time.Second,
+	}
+	pki, cleanup := getTmpPki(WithKeySize(1024), WithTrustedTime(policy))
+	defer cleanup()
+	_, err = pki.NewCa()
+	assert.NoError(t, err)
+
+	policy.Quorum = 3
+	// successful check is reused within interval
+	pair, err := pki.NewCert("client", false, nil)
+	assert.NoError(t, err)
+	assert.True(t, isUntrustedTime(pki.CheckTime(context.Background())))
+
+	policy.Interval = time.Nanosecond
+	_, err = pki.NewCert("client", false, nil)
+	assert.True(t, isUntrustedTime(err))
+	assert.True(t, isUntrustedTime(pki.Revoke(pair.Serial, "test", "")))
+}
@@ -0,0 +1,421 @@
+package easyrsa
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// Truststore entries are named <prefix>-<first 16 hex of sha256 fingerprint>, entries of prefix
+// absent in the bundle are removed on sync, entries of other prefixes are kept
+const trustStoreFingerprintLen = 16
+
+const (
+	jksMagic        = 0xFEEDFEED
+	jksVersion      = 2
+	jksPrivateKey   = 1
+	jksTrustedCert  = 2
+	jksDigestSecret = "Mighty Aphrodite"
+)
+
+// trustStoreName return entry name of bundle cert
+func trustStoreName(prefix string, entry *TrustBundleEntry) string {
+	return prefix + "-" + entry.SHA256[:trustStoreFingerprintLen]
+}
+
+func checkTrustStorePrefix(prefix string) error {
+	if prefix == "" || strings.HasPrefix(prefix, ".") || strings.ContainsAny(prefix, "/\\ \t\n") {
+		return errors.Errorf("invalid truststore prefix %q", prefix)
+	}
+	return nil
+}
+
+// SyncCADir install bundle certs as <prefix>-<fingerprint>.crt files to ca-certificates dir, e.g.
+// /usr/local/share/ca-certificates or /etc/pki/ca-trust/source/anchors, and remove stale files of prefix.
+// changed is true if dir was modified and UpdateCATrust should be run
+func SyncCADir(dir, prefix string, bundle *TrustBundle) (changed bool, err error) {
+	if err := checkTrustStorePrefix(prefix); err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, errors.Wrap(err, "can`t create ca dir")
+	}
+	want := make(map[string]bool, len(bundle.Certs))
+	for _, entry := range bundle.Certs {
+		name := trustStoreName(prefix, entry) + ".crt"
+		want[name] = true
+		path := filepath.Join(dir, name)
+		if current, err := ioutil.ReadFile(path); err == nil && bytes.Equal(current, []byte(entry.PEM)) {
+			continue
+		}
+		if err := writeFileAtomic(path, []byte(entry.PEM), 0644); err != nil {
+			return changed, errors.Wrapf(err, "can`t write %s", name)
+		}
+		changed = true
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return changed, errors.Wrap(err, "can`t read ca dir")
+	}
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, prefix+"-") || !strings.HasSuffix(name, ".crt") || want[name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return changed, errors.Wrapf(err, "can`t remove %s", name)
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// UpdateCATrust rebuild system truststore from ca dirs with update-ca-certificates (Debian, Alpine)
+// or update-ca-trust (RHEL, Fedora), whichever is installed
+func UpdateCATrust(ctx context.Context) error {
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("update-ca-certificates"); err == nil {
+		cmd = exec.CommandContext(ctx, "update-ca-certificates")
+	} else if _, err := exec.LookPath("update-ca-trust"); err == nil {
+		cmd = exec.CommandContext(ctx, "update-ca-trust", "extract")
+	} else {
+		return errors.New("neither update-ca-certificates nor update-ca-trust is installed")
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "%s failed: %s", filepath.Base(cmd.Path), strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// jksEntry is an entry of Java keystore, private key entries are kept as is
+type jksEntry struct {
+	tag       uint32
+	alias     string
+	timestamp int64
+	raw       []byte // entry content after timestamp
+}
+
+// SyncJKS install bundle certs as trusted cert entries <prefix>-<fingerprint> to JKS keystore at path
+// as keytool -importcert would. Keystore is created with mode 0644 if missing, mode of existing one is kept,
+// stale entries of prefix are removed and other entries are kept. changed is true if keystore was modified.
+// PKCS #12 keystores, e.g. cacerts of JDK 9 and later, are synced with SyncKeytool
+func SyncJKS(path, prefix, password string, bundle *TrustBundle) (changed bool, err error) {
+	if err := checkTrustStorePrefix(prefix); err != nil {
+		return false, err
+	}
+	var entries []*jksEntry
+	mode := os.FileMode(0644)
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if len(data) > 0 && data[0] == 0x30 {
+			return false, errors.New("keystore is pkcs12, sync it with SyncKeytool")
+		}
+		if entries, err = readJKS(data, password); err != nil {
+			return false, err
+		}
+		if stat, err := os.Stat(path); err == nil {
+			mode = stat.Mode().Perm()
+		}
+	} else if !os.IsNotExist(err) {
+		return false, errors.Wrap(err, "can`t read keystore")
+	}
+	prefix = strings.ToLower(prefix)
+	want := make(map[string]*TrustBundleEntry, len(bundle.Certs))
+	for _, entry := range bundle.Certs {
+		want[strings.ToLower(trustStoreName(prefix, entry))] = entry
+	}
+	res := make([]*jksEntry, 0, len(entries)+len(want))
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.alias, prefix+"-") {
+			res = append(res, entry)
+			continue
+		}
+		if _, ok := want[entry.alias]; ok && entry.tag == jksTrustedCert {
+			delete(want, entry.alias)
+			res = append(res, entry)
+			continue
+		}
+		changed = true
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	for _, entry := range bundle.Certs {
+		alias := strings.ToLower(trustStoreName(prefix, entry))
+		if _, ok := want[alias]; !ok {
+			continue
+		}
+		block, _ := pem.Decode([]byte(entry.PEM))
+		if block == nil {
+			return false, errors.Errorf("can`t decode %s", alias)
+		}
+		raw := bytes.NewBuffer(nil)
+		writeJKSString(raw, "X.509")
+		_ = binary.Write(raw, binary.BigEndian, uint32(len(block.Bytes)))
+		raw.Write(block.Bytes)
+		res = append(res, &jksEntry{tag: jksTrustedCert, alias: alias, timestamp: now, raw: raw.Bytes()})
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+	if err := writeFileAtomic(path, writeJKS(res, password), mode); err != nil {
+		return false, errors.Wrap(err, "can`t write keystore")
+	}
+	return true, nil
+}
+
+// jksDigest return keystore integrity digest of data
+func jksDigest(data []byte, password string) []byte {
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte(jksDigestSecret))
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func writeJKSString(w *bytes.Buffer, s string) {
+	_ = binary.Write(w, binary.BigEndian, uint16(len(s)))
+	w.WriteString(s)
+}
+
+func writeJKS(entries []*jksEntry, password string) []byte {
+	buf := bytes.NewBuffer(nil)
+	_ = binary.Write(buf, binary.BigEndian, []uint32{jksMagic, jksVersion, uint32(len(entries))})
+	for _, entry := range entries {
+		_ = binary.Write(buf, binary.BigEndian, entry.tag)
+		writeJKSString(buf, entry.alias)
+		_ = binary.Write(buf, binary.BigEndian, entry.timestamp)
+		buf.Write(entry.raw)
+	}
+	buf.Write(jksDigest(buf.Bytes(), password))
+	return buf.Bytes()
+}
+
+// readJKS parse version 2 Java keystore and check it`s digest with password
+func readJKS(data []byte, password string) ([]*jksEntry, error) {
+	if len(data) < 12+sha1.Size {
+		return nil, errors.New("keystore is too short")
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if !bytes.Equal(jksDigest(body, password), digest) {
+		return nil, errors.New("keystore password is incorrect or keystore is corrupted")
+	}
+	r := bytes.NewReader(body)
+	var header [3]uint32
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil || header[0] != jksMagic {
+		return nil, errors.New("not a jks keystore")
+	}
+	if header[1] != jksVersion {
+		return nil, errors.Errorf("unsupported jks version %d", header[1])
+	}
+	readUint32 := func() (uint32, error) {
+		var v uint32
+		return v, binary.Read(r, binary.BigEndian, &v)
+	}
+	readString := func() (string, error) {
+		var l uint16
+		if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+			return "", err
+		}
+		b := make([]byte, l)
+		_, err := io.ReadFull(r, b)
+		return string(b), err
+	}
+	skip := func(n uint32) error {
+		if int64(n) > int64(r.Len()) {
+			return io.ErrUnexpectedEOF
+		}
+		_, err := r.Seek(int64(n), io.SeekCurrent)
+		return err
+	}
+	// skipCert skip type and DER of a cert
+	skipCert := func() error {
+		if _, err := readString(); err != nil {
+			return err
+		}
+		l, err := readUint32()
+		if err != nil {
+			return err
+		}
+		return skip(l)
+	}
+	entries := make([]*jksEntry, 0, header[2])
+	for i := uint32(0); i < header[2]; i++ {
+		entry := &jksEntry{}
+		var err error
+		if entry.tag, err = readUint32(); err != nil {
+			return nil, errors.Wrap(err, "can`t read keystore entry")
+		}
+		if entry.alias, err = readString(); err != nil {
+			return nil, errors.Wrap(err, "can`t read keystore entry")
+		}
+		if err = binary.Read(r, binary.BigEndian, &entry.timestamp); err != nil {
+			return nil, errors.Wrap(err, "can`t read keystore entry")
+		}
+		start := len(body) - r.Len()
+		switch entry.tag {
+		case jksTrustedCert:
+			err = skipCert()
+		case jksPrivateKey:
+			var l, chain uint32
+			if l, err = readUint32(); err == nil {
+				err = skip(l)
+			}
+			if err == nil {
+				chain, err = readUint32()
+			}
+			for j := uint32(0); err == nil && j < chain; j++ {
+				err = skipCert()
+			}
+		default:
+			err = errors.Errorf("unknown entry tag %d", entry.tag)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "can`t read keystore entry %s", entry.alias)
+		}
+		entry.raw = body[start : len(body)-r.Len()]
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// SyncKeytool install bundle certs as trusted cert entries <prefix>-<fingerprint> to Java keystore at path of
+// any type supported by keytool, e.g. PKCS #12 $JAVA_HOME/lib/security/cacerts, and remove stale entries of prefix.
+// storeType is passed as -storetype if not empty, keystore is changed in place by keytool so it`s mode is kept.
+// changed is true if keystore was modified
+func SyncKeytool(ctx context.Context, path, storeType, prefix, password string, bundle *TrustBundle) (changed bool, err error) {
+	if err := checkTrustStorePrefix(prefix); err != nil {
+		return false, err
+	}
+	keytool := func(stdin []byte, args ...string) ([]byte, error) {
+		args = append(args, "-keystore", path, "-storepass:env", "EASYRSA_STOREPASS")
+		if storeType != "" {
+			args = append(args, "-storetype", storeType)
+		}
+		cmd := exec.CommandContext(ctx, "keytool", args...)
+		cmd.Env = append(os.Environ(), "EASYRSA_STOREPASS="+password)
+		cmd.Stdin = bytes.NewReader(stdin)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return nil, errors.Wrapf(err, "keytool failed: %s", strings.TrimSpace(string(out)))
+		}
+		return out, nil
+	}
+	prefix = strings.ToLower(prefix)
+	installed := make(map[string]bool)
+	if _, err := os.Stat(path); err == nil {
+		out, err := keytool(nil, "-list", "-v")
+		if err != nil {
+			return false, err
+		}
+		alias := ""
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "Alias name:") {
+				alias = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(line, "Alias name:")))
+			} else if strings.HasPrefix(line, "Entry type:") && strings.HasPrefix(alias, prefix+"-") {
+				// entry of prefix which is not a trusted cert is replaced
+				installed[alias] = strings.TrimSpace(strings.TrimPrefix(line, "Entry type:")) == "trustedCertEntry"
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return false, errors.Wrap(err, "can`t stat keystore")
+	}
+	want := make(map[string]bool, len(bundle.Certs))
+	for _, entry := range bundle.Certs {
+		alias := strings.ToLower(trustStoreName(prefix, entry))
+		want[alias] = true
+		trusted, ok := installed[alias]
+		if trusted {
+			continue
+		}
+		if ok {
+			if _, err := keytool(nil, "-delete", "-alias", alias); err != nil {
+				return changed, errors.Wrapf(err, "can`t delete %s", alias)
+			}
+		}
+		if _, err := keytool([]byte(entry.PEM), "-importcert", "-noprompt", "-trustcacerts", "-alias", alias); err != nil {
+			return changed, errors.Wrapf(err, "can`t add %s", alias)
+		}
+		changed = true
+	}
+	for alias := range installed {
+		if want[alias] {
+			continue
+		}
+		if _, err := keytool(nil, "-delete", "-alias", alias); err != nil {
+			return changed, errors.Wrapf(err, "can`t delete %s", alias)
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// SyncNSS install bundle certs as trusted CA <prefix>-<fingerprint> to NSS sql db dir, e.g. ~/.pki/nssdb
+// or firefox profile, with certutil and remove stale certs of prefix. changed is true if db was modified
+func SyncNSS(ctx context.Context, dbDir, prefix string, bundle *TrustBundle) (changed bool, err error) {
+	if err := checkTrustStorePrefix(prefix); err != nil {
+		return false, err
+	}
+	db := "sql:" + dbDir
+	certutil := func(stdin []byte, args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, "certutil", append([]string{"-d", db}, args...)...)
+		cmd.Stdin = bytes.NewReader(stdin)
+		stderr := bytes.NewBuffer(nil)
+		cmd.Stderr = stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, errors.Wrapf(err, "certutil failed: %s", strings.TrimSpace(stderr.String()))
+		}
+		return out, nil
+	}
+	out, err := certutil(nil, "-L")
+	if err != nil {
+		return false, err
+	}
+	installed := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// nickname is followed by trust attributes column
+		if i := strings.LastIndexAny(line, " \t"); i > 0 && strings.HasPrefix(line, prefix+"-") {
+			installed[strings.TrimSpace(line[:i])] = true
+		}
+	}
+	want := make(map[string]bool, len(bundle.Certs))
+	for _, entry := range bundle.Certs {
+		nick := trustStoreName(prefix, entry)
+		want[nick] = true
+		if installed[nick] {
+			continue
+		}
+		if _, err := certutil([]byte(entry.PEM), "-A", "-a", "-t", "C,,", "-n", nick); err != nil {
+			return changed, errors.Wrapf(err, "can`t add %s", nick)
+		}
+		changed = true
+	}
+	for nick := range installed {
+		if want[nick] {
+			continue
+		}
+		if _, err := certutil(nil, "-D", "-n", nick); err != nil {
+			return changed, errors.Wrapf(err, "can`t delete %s", nick)
+		}
+		changed = true
+	}
+	return changed, nil
+}
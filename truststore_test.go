@@ -0,0 +1,155 @@
+package easyrsa
+
+import (
+	"context"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestTrustStoreSync(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+	oldBundle, err := pki.ExportTrustBundle()
+	assert.NoError(t, err)
+	_, err = pki.NewCa()
+	assert.NoError(t, err)
+	bundle, err := pki.ExportTrustBundle()
+	assert.NoError(t, err)
+	dir := filepath.Join(getTestDir(), "truststore")
+	defer os.RemoveAll(dir)
+
+	t.Run("ca dir", func(t *testing.T) {
+		caDir := filepath.Join(dir, "ca-certificates")
+		assert.NoError(t, os.MkdirAll(caDir, 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(caDir, "other.crt"), []byte("other"), 0644))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(caDir, "easyrsa-stale.crt"), []byte("stale"), 0644))
+
+		changed, err := SyncCADir(caDir, "easyrsa", bundle)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		files, err := filepath.Glob(filepath.Join(caDir, "*.crt"))
+		assert.NoError(t, err)
+		assert.Len(t, files, 3)
+		cert, err := ioutil.ReadFile(filepath.Join(caDir, trustStoreName("easyrsa", bundle.Certs[0])+".crt"))
+		assert.NoError(t, err)
+		assert.Equal(t, bundle.Certs[0].PEM, string(cert))
+
+		changed, err = SyncCADir(caDir, "easyrsa", bundle)
+		assert.NoError(t, err)
+		assert.False(t, changed)
+		_, err = SyncCADir(caDir, "../easyrsa", bundle)
+		assert.Error(t, err)
+	})
+
+	t.Run("jks", func(t *testing.T) {
+		path := filepath.Join(dir, "cacerts")
+		// foreign entry is kept
+		changed, err := SyncJKS(path, "other", "changeit", oldBundle)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		changed, err = SyncJKS(path, "easyrsa", "changeit", oldBundle)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		changed, err = SyncJKS(path, "easyrsa", "changeit", bundle)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		changed, err = SyncJKS(path, "easyrsa", "changeit", bundle)
+		assert.NoError(t, err)
+		assert.False(t, changed)
+
+		data, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		entries, err := readJKS(data, "changeit")
+		assert.NoError(t, err)
+		aliases := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			assert.Equal(t, uint32(jksTrustedCert), entry.tag)
+			aliases = append(aliases, entry.alias)
+		}
+		assert.ElementsMatch(t, []string{
+			trustStoreName("other", oldBundle.Certs[0]),
+			trustStoreName("easyrsa", bundle.Certs[0]),
+			trustStoreName("easyrsa", bundle.Certs[1]),
+		}, aliases)
+
+		_, err = SyncJKS(path, "easyrsa", "wrong", bundle)
+		assert.Error(t, err)
+
+		// mode of existing keystore is kept
+		assert.NoError(t, os.Chmod(path, 0600))
+		changed, err = SyncJKS(path, "easyrsa", "changeit", oldBundle)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		stat, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+		ca, err := decodeCert([]byte(bundle.Certs[0].PEM))
+		assert.NoError(t, err)
+		p12, err := pkcs12.Modern.EncodeTrustStore([]*x509.Certificate{ca}, "changeit")
+		assert.NoError(t, err)
+		p12Path := filepath.Join(dir, "cacerts.p12")
+		assert.NoError(t, ioutil.WriteFile(p12Path, p12, 0644))
+		_, err = SyncJKS(p12Path, "easyrsa", "changeit", bundle)
+		assert.Error(t, err)
+	})
+
+	t.Run("keytool", func(t *testing.T) {
+		bin := filepath.Join(dir, "keytool-bin")
+		assert.NoError(t, os.MkdirAll(bin, 0755))
+		log := filepath.Join(dir, "keytool.log")
+		path := filepath.Join(dir, "cacerts.p12")
+		assert.NoError(t, ioutil.WriteFile(path, []byte("p12"), 0644))
+		stale := "easyrsa-0000000000000000"
+		// fake keytool listing installed entries and logging modifications with password
+		script := "#!/bin/sh\ncase \"$*\" in\n*-list*) printf 'Keystore type: PKCS12\\n\\nAlias name: " +
+			trustStoreName("easyrsa", bundle.Certs[0]) + "\\nEntry type: trustedCertEntry\\n\\nAlias name: " + stale +
+			"\\nEntry type: trustedCertEntry\\n\\nAlias name: other\\nEntry type: trustedCertEntry\\n' ;;\n" +
+			"*) echo \"$EASYRSA_STOREPASS $@\" >> " + log + " ;;\nesac\n"
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(bin, "keytool"), []byte(script), 0755))
+		t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+		changed, err := SyncKeytool(context.Background(), path, "PKCS12", "easyrsa", "changeit", bundle)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		out, err := ioutil.ReadFile(log)
+		assert.NoError(t, err)
+		store := " -keystore " + path + " -storepass:env EASYRSA_STOREPASS -storetype PKCS12"
+		assert.Equal(t, []string{
+			"changeit -importcert -noprompt -trustcacerts -alias " + trustStoreName("easyrsa", bundle.Certs[1]) + store,
+			"changeit -delete -alias " + stale + store,
+		}, strings.Split(strings.TrimSpace(string(out)), "\n"))
+	})
+
+	t.Run("nss", func(t *testing.T) {
+		bin := filepath.Join(dir, "bin")
+		assert.NoError(t, os.MkdirAll(bin, 0755))
+		log := filepath.Join(dir, "certutil.log")
+		stale := "easyrsa-0000000000000000"
+		// fake certutil listing installed certs and logging modifications
+		script := "#!/bin/sh\ncase \"$*\" in\n*-L*) printf 'Certificate Nickname    Trust Attributes\\n\\n" +
+			trustStoreName("easyrsa", bundle.Certs[0]) + "    C,,\\n" + stale + "    C,,\\nother    C,,\\n' ;;\n" +
+			"*) echo \"$@\" >> " + log + " ;;\nesac\n"
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(bin, "certutil"), []byte(script), 0755))
+		t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+		changed, err := SyncNSS(context.Background(), "/nssdb", "easyrsa", bundle)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		out, err := ioutil.ReadFile(log)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"-d sql:/nssdb -A -a -t C,, -n " + trustStoreName("easyrsa", bundle.Certs[1]),
+			"-d sql:/nssdb -D -n " + stale,
+		}, strings.Split(strings.TrimSpace(string(out)), "\n"))
+	})
+}
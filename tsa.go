@@ -0,0 +1,340 @@
+package easyrsa
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TSA related content types from RFC 3161 and RFC 5652
+const (
+	TimestampQueryContentType = "application/timestamp-query" // http content type of RFC 3161 request
+	TimestampReplyContentType = "application/timestamp-reply" // http content type of RFC 3161 response
+)
+
+var (
+	oidExtKeyUsage          = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtKeyUsageTimeStamp = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttrContentType      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningCertV2    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidRSAEncryption        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA1                 = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	// DefaultTSAPolicy is a policy id used by TSAResponder if no other set (anyPolicy)
+	DefaultTSAPolicy = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+)
+
+// NewTSACert generate new time stamping pair signed by last CA key
+func (p *PKI) NewTSACert(cn string) (*X509Pair, error) {
+	eku, err := asn1.Marshal([]asn1.ObjectIdentifier{oidExtKeyUsageTimeStamp})
+	if err != nil {
+		return nil, errors.Wrap(err, "can not marshal extKeyUsage")
+	}
+	now := p.now()
+	subj := p.subject(cn, CertRequest{})
+	tml := x509.Certificate{
+		NotBefore:             now.Add(-NotBeforeBackdate).UTC(),
+		NotAfter:              now.Add(validityOrDefault(p.certValidity)).UTC(),
+		Subject:               subj,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+		ExtraExtensions: []pkix.Extension{
+			{
+				Id:       oidExtKeyUsage,
+				Critical: true, // RFC 3161 2.3 require critical EKU with only id-kp-timeStamping
+				Value:    eku,
+			},
+		},
+	}
+	return p.issue(CertRequest{CN: cn}, &tml, nil)
+}
+
+type tsaMessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tsaRequest struct {
+	Version        int
+	MessageImprint tsaMessageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     []pkix.Extension      `asn1:"tag:0,optional"`
+}
+
+type tsaStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type tsaResponse struct {
+	Status         tsaStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type tsaInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint tsaMessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type cmsEncapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,tag:0"`
+}
+
+type cmsIssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                cmsIssuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        []cmsAttribute `asn1:"tag:0,set"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsEncapContentInfo
+	Certificates     []asn1.RawValue `asn1:"tag:0,optional,set"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// PKIStatus values and failure info bits from RFC 3161
+const (
+	tsaStatusGranted     = 0
+	tsaStatusRejection   = 2
+	tsaFailBadAlg        = 0
+	tsaFailBadRequest    = 2
+	tsaFailBadDataFormat = 5
+)
+
+var tsaHashSizes = map[string]int{
+	oidSHA1.String():   20,
+	oidSHA256.String(): 32,
+	oidSHA384.String(): 48,
+	oidSHA512.String(): 64,
+}
+
+// TSAResponder is a minimal RFC 3161 time stamping responder
+type TSAResponder struct {
+	key    *rsa.PrivateKey
+	cert   *x509.Certificate
+	policy asn1.ObjectIdentifier
+}
+
+// NewTSAResponder create new TSAResponder from pair issued by NewTSACert. DefaultTSAPolicy used if policy is nil
+func NewTSAResponder(pair *X509Pair, policy asn1.ObjectIdentifier) (*TSAResponder, error) {
+	key, cert, err := pair.Decode()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t decode tsa pair")
+	}
+	if key == nil {
+		return nil, errors.New("tsa pair has no private key")
+	}
+	if !hasExtKeyUsage(cert, x509.ExtKeyUsageTimeStamping) {
+		return nil, errors.New("pair is not a time stamping certificate")
+	}
+	if policy == nil {
+		policy = DefaultTSAPolicy
+	}
+	return &TSAResponder{key: key, cert: cert, policy: policy}, nil
+}
+
+// Respond parse DER encoded TimeStampReq and return DER encoded TimeStampResp
+func (r *TSAResponder) Respond(reqBytes []byte) ([]byte, error) {
+	var req tsaRequest
+	rest, err := asn1.Unmarshal(reqBytes, &req)
+	if err != nil || len(rest) > 0 {
+		return r.reject(tsaFailBadDataFormat, "can`t parse request")
+	}
+	if req.Version != 1 {
+		return r.reject(tsaFailBadRequest, "unsupported request version")
+	}
+	size, ok := tsaHashSizes[req.MessageImprint.HashAlgorithm.Algorithm.String()]
+	if !ok {
+		return r.reject(tsaFailBadAlg, "unsupported hash algorithm")
+	}
+	if len(req.MessageImprint.HashedMessage) != size {
+		return r.reject(tsaFailBadDataFormat, "wrong hashed message length")
+	}
+	if req.ReqPolicy != nil && !req.ReqPolicy.Equal(r.policy) {
+		return r.reject(tsaFailBadRequest, "unsupported policy")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t generate serial")
+	}
+	info, err := asn1.Marshal(tsaInfo{
+		Version:        1,
+		Policy:         r.policy,
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   serial,
+		GenTime:        time.Now().UTC().Truncate(time.Second),
+		Nonce:          req.Nonce,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal tst info")
+	}
+	token, err := r.sign(info, req.CertReq)
+	if err != nil {
+		return nil, err
+	}
+	res, err := asn1.Marshal(tsaResponse{
+		Status:         tsaStatusInfo{Status: tsaStatusGranted},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal response")
+	}
+	return res, nil
+}
+
+// ServeHTTP implement http.Handler for RFC 3161 requests over http
+func (r *TSAResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, 64*1024))
+	if err != nil {
+		http.Error(w, "can`t read request", http.StatusBadRequest)
+		return
+	}
+	res, err := r.Respond(body)
+	if err != nil {
+		http.Error(w, "can`t create response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", TimestampReplyContentType)
+	_, _ = w.Write(res)
+}
+
+func (r *TSAResponder) reject(failInfo int, msg string) ([]byte, error) {
+	bits := asn1.BitString{Bytes: make([]byte, 1+failInfo/8), BitLength: failInfo + 1}
+	bits.Bytes[failInfo/8] |= 0x80 >> uint(failInfo%8)
+	res, err := asn1.Marshal(tsaResponse{
+		Status: tsaStatusInfo{
+			Status:       tsaStatusRejection,
+			StatusString: []asn1.RawValue{{Tag: asn1.TagUTF8String, Bytes: []byte(msg)}},
+			FailInfo:     bits,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal response")
+	}
+	return res, nil
+}
+
+// sign wrap content to CMS SignedData with TSA cert as signer
+func (r *TSAResponder) sign(content []byte, withCert bool) ([]byte, error) {
+	contentDigest := sha256.Sum256(content)
+	certDigest := sha256.Sum256(r.cert.Raw)
+
+	contentType, _ := asn1.Marshal(oidTSTInfo)
+	messageDigest, _ := asn1.Marshal(contentDigest[:])
+	signingCert, err := asn1.Marshal(signingCertificateV2{Certs: []essCertIDv2{{CertHash: certDigest[:]}}})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal signing certificate")
+	}
+	attrs := []cmsAttribute{
+		{Type: oidAttrContentType, Values: []asn1.RawValue{{FullBytes: contentType}}},
+		{Type: oidAttrMessageDigest, Values: []asn1.RawValue{{FullBytes: messageDigest}}},
+		{Type: oidAttrSigningCertV2, Values: []asn1.RawValue{{FullBytes: signingCert}}},
+	}
+	// signature is calculated over DER of attributes with universal SET tag (RFC 5652 5.4)
+	attrsBytes, err := asn1.MarshalWithParams(attrs, "set")
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal signed attributes")
+	}
+	attrsDigest := sha256.Sum256(attrsBytes)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, r.key, crypto.SHA256, attrsDigest[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t sign tst info")
+	}
+
+	sha256Alg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	signedData := cmsSignedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Alg},
+		EncapContentInfo: cmsEncapContentInfo{EContentType: oidTSTInfo, EContent: content},
+		SignerInfos: []cmsSignerInfo{{
+			Version:            1,
+			SID:                cmsIssuerAndSerial{Issuer: asn1.RawValue{FullBytes: r.cert.RawIssuer}, Serial: r.cert.SerialNumber},
+			DigestAlgorithm:    sha256Alg,
+			SignedAttrs:        attrs,
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+			Signature:          signature,
+		}},
+	}
+	if withCert {
+		signedData.Certificates = []asn1.RawValue{{FullBytes: r.cert.Raw}}
+	}
+	signedBytes, err := asn1.Marshal(signedData)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal signed data")
+	}
+	res, err := asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedBytes},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal content info")
+	}
+	return res, nil
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package easyrsa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_NewTSACert(t *testing.T) {
+	pki, cleanup := getTmpPki(WithValidity(0, 48*time.Hour))
+	defer cleanup()
+	_, _ = pki.NewCa()
+	pair, err := pki.NewTSACert("tsa")
+	assert.NoError(t, err)
+	_, cert, err := pair.Decode()
+	assert.NoError(t, err)
+	assert.True(t, hasExtKeyUsage(cert, x509.ExtKeyUsageTimeStamping))
+	assert.WithinDuration(t, time.Now().Add(48*time.Hour), cert.NotAfter, time.Minute)
+	critical := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidExtKeyUsage) {
+			critical = ext.Critical
+		}
+	}
+	assert.True(t, critical)
+}
+
+func TestTSAResponder_Respond(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	_, _ = pki.NewCa()
+	client, _ := pki.NewCert("client", false, []string{""})
+	tsa, _ := pki.NewTSACert("tsa")
+	t.Run("not tsa pair", func(t *testing.T) {
+		_, err := NewTSAResponder(client, nil)
+		assert.Error(t, err)
+	})
+	responder, err := NewTSAResponder(tsa, nil)
+	assert.NoError(t, err)
+	digest := sha256.Sum256([]byte("data"))
+	t.Run("granted", func(t *testing.T) {
+		req, _ := asn1.Marshal(tsaRequest{
+			Version: 1,
+			MessageImprint: tsaMessageImprint{
+				HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+				HashedMessage: digest[:],
+			},
+			Nonce:   big.NewInt(42),
+			CertReq: true,
+		})
+		resBytes, err := responder.Respond(req)
+		assert.NoError(t, err)
+		var res tsaResponse
+		_, err = asn1.Unmarshal(resBytes, &res)
+		assert.NoError(t, err)
+		assert.Equal(t, tsaStatusGranted, res.Status.Status)
+		var info cmsContentInfo
+		_, err = asn1.Unmarshal(res.TimeStampToken.FullBytes, &info)
+		assert.NoError(t, err)
+		assert.True(t, info.ContentType.Equal(oidSignedData))
+	})
+	t.Run("bad alg", func(t *testing.T) {
+		req, _ := asn1.Marshal(tsaRequest{
+			Version: 1,
+			MessageImprint: tsaMessageImprint{
+				HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 3}},
+				HashedMessage: digest[:],
+			},
+		})
+		resBytes, err := responder.Respond(req)
+		assert.NoError(t, err)
+		var res tsaResponse
+		_, err = asn1.Unmarshal(resBytes, &res)
+		assert.NoError(t, err)
+		assert.Equal(t, tsaStatusRejection, res.Status.Status)
+		assert.Equal(t, 1, res.Status.FailInfo.At(tsaFailBadAlg))
+	})
+	t.Run("http", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		responder.ServeHTTP(rec, httptest.NewRequest("POST", "/", bytes.NewReader([]byte("garbage"))))
+		assert.Equal(t, 200, rec.Code)
+		assert.Equal(t, TimestampReplyContentType, rec.Header().Get("Content-Type"))
+		rec = httptest.NewRecorder()
+		responder.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, 405, rec.Code)
+	})
+}
@@ -0,0 +1,122 @@
+package easyrsa
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SerialReleaser can be implemented by SerialProvider to take back reserved serial of issuance failed before signing.
+// Release must do nothing if other serial was reserved after it, such serial stays burned
+type SerialReleaser interface {
+	Release(serial *big.Int) error // Release serial returned by last Next
+}
+
+// CommitHook is called after issued pair is written to storage, pair is deleted if it fails.
+// Serial of signed cert is never released, it stays burned
+type CommitHook func(pair *X509Pair) error
+
+// WithCommitHook add hook to the last issuance phase, e.g. to record pair in external inventory
+func WithCommitHook(hook CommitHook) Option {
+	return func(p *PKI) {
+		p.commitHooks = append(p.commitHooks, hook)
+	}
+}
+
+// RollbackError is returned when issuance failed and undoing of done steps failed too.
+// errors.Cause return the issuance error
+type RollbackError struct {
+	Err      error   // issuance error
+	Rollback []error // errors of rollback hooks
+}
+
+func (e *RollbackError) Error() string {
+	msgs := make([]string, 0, len(e.Rollback))
+	for _, err := range e.Rollback {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%s, rollback failed: %s", e.Err, strings.Join(msgs, "; "))
+}
+
+func (e *RollbackError) Cause() error {
+	return e.Err
+}
+
+// transaction collect undo hooks of issuance steps: reserve serial, write pair, commit
+type transaction struct {
+	undo      []func() error
+	committed bool
+	signed    bool // reserved serial is signed, it must not be released
+}
+
+// onRollback register undo of just done step
+func (t *transaction) onRollback(fn func() error) {
+	t.undo = append(t.undo, fn)
+}
+
+// sign mark reserved serial as used by signed cert or precert, it stays burned on rollback,
+// so serial of cert possibly logged in CT or leaked can`t be issued again
+func (t *transaction) sign() {
+	t.signed = true
+}
+
+func (t *transaction) commit() {
+	t.committed = true
+}
+
+// rollback undo done steps in reverse order if transaction is not committed, err is returned as is if all undo succeed
+func (t *transaction) rollback(err error) error {
+	if t.committed {
+		return err
+	}
+	t.committed = true
+	var failed []error
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		if undoErr := t.undo[i](); undoErr != nil {
+			failed = append(failed, undoErr)
+		}
+	}
+	if len(failed) == 0 {
+		return err
+	}
+	return &RollbackError{Err: err, Rollback: failed}
+}
+
+// reserveSerial take next serial and register it`s release in tx, serial is not released after tx.sign
+func (p *PKI) reserveSerial(tx *transaction) (*big.Int, error) {
+	serial, err := p.nextSerial()
+	if err != nil {
+		return nil, err
+	}
+	tx.onRollback(func() error {
+		releaser, ok := p.serialProvider.(SerialReleaser)
+		if !ok || tx.signed {
+			return nil
+		}
+		p.serialMu.Lock()
+		defer p.serialMu.Unlock()
+		return releaser.Release(serial)
+	})
+	return serial, nil
+}
+
+// storePair write pair and run commit hooks, written pair is deleted on rollback
+func (p *PKI) storePair(tx *transaction, pair *X509Pair) error {
+	if err := p.Storage.Put(pair); err != nil {
+		return err
+	}
+	tx.onRollback(func() error {
+		defer p.pairStored(pair.CN)
+		return errors.Wrap(p.Storage.DeleteBySerial(pair.Serial), "can`t delete written pair")
+	})
+	for _, hook := range p.commitHooks {
+		if err := hook(pair); err != nil {
+			return errors.Wrap(err, "commit hook failed")
+		}
+	}
+	tx.commit()
+	p.pairStored(pair.CN)
+	return nil
+}
@@ -0,0 +1,98 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"math/big"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStorage fail Put or DeleteBySerial of wrapped storage
+type failingStorage struct {
+	KeyStorage
+	putErr    error
+	deleteErr error
+}
+
+func (s *failingStorage) Put(pair *X509Pair) error {
+	if s.putErr != nil && pair.CN != "ca" {
+		return s.putErr
+	}
+	return s.KeyStorage.Put(pair)
+}
+
+func (s *failingStorage) DeleteBySerial(serial *big.Int) error {
+	if s.deleteErr != nil {
+		return s.deleteErr
+	}
+	return s.KeyStorage.DeleteBySerial(serial)
+}
+
+func TestPKI_IssueRollback(t *testing.T) {
+	hookErr := errors.New("inventory is down")
+	var failHook, failSignHook bool
+	pki, cleanup := getTmpPki(WithCommitHook(func(pair *X509Pair) error {
+		if failHook {
+			return hookErr
+		}
+		return nil
+	}), WithSignHook(func(tml *x509.Certificate, req CertRequest) error {
+		if failSignHook {
+			return hookErr
+		}
+		return nil
+	}))
+	defer cleanup()
+	storage := &failingStorage{KeyStorage: pki.Storage}
+	pki.Storage = storage
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	t.Run("put failed", func(t *testing.T) {
+		putErr := errors.New("disk is full")
+		storage.putErr = putErr
+		_, err := pki.NewCert("client", false, nil)
+		storage.putErr = nil
+		assert.Equal(t, putErr, errors.Cause(err))
+		// serial of signed cert is burned
+		pair, err := pki.NewCert("client", false, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, new(big.Int).Add(ca.Serial, big.NewInt(2)), pair.Serial)
+	})
+
+	t.Run("commit hook failed", func(t *testing.T) {
+		failHook = true
+		_, err := pki.NewCert("hooked", false, nil)
+		failHook = false
+		assert.Equal(t, hookErr, errors.Cause(err))
+		_, err = pki.Storage.GetByCN("hooked")
+		assert.Error(t, err)
+		pair, err := pki.NewCert("hooked", false, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, new(big.Int).Add(ca.Serial, big.NewInt(4)), pair.Serial)
+	})
+
+	t.Run("sign hook failed", func(t *testing.T) {
+		failSignHook = true
+		_, err := pki.NewCert("rejected", false, nil)
+		failSignHook = false
+		assert.Equal(t, hookErr, errors.Cause(err))
+		// nothing is signed, serial is released
+		pair, err := pki.NewCert("rejected", false, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, new(big.Int).Add(ca.Serial, big.NewInt(5)), pair.Serial)
+	})
+
+	t.Run("rollback failed", func(t *testing.T) {
+		failHook = true
+		storage.deleteErr = errors.New("read only fs")
+		defer func() { failHook, storage.deleteErr = false, nil }()
+		_, err := pki.NewCert("stuck", false, nil)
+		rbErr, ok := err.(*RollbackError)
+		assert.True(t, ok)
+		assert.Len(t, rbErr.Rollback, 1)
+		assert.Equal(t, hookErr, errors.Cause(err))
+	})
+}
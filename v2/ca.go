@@ -0,0 +1,35 @@
+package easyrsa
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"reflect"
+)
+
+// CA is an issuing CA, the key is any crypto.Signer, e.g. in memory key, HSM or cloud KMS
+type CA struct {
+	Cert   *x509.Certificate
+	Signer crypto.Signer
+}
+
+// NewCA return CA of cert and signer, PolicyViolation is returned if cert is not a CA or signer key does not match it
+func NewCA(cert *x509.Certificate, signer crypto.Signer) (*CA, error) {
+	if cert == nil || signer == nil {
+		return nil, NewPolicyViolation("ca cert and signer are required")
+	}
+	if !cert.IsCA || cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, NewPolicyViolation(fmt.Sprintf("%s is not a ca cert", cert.Subject.CommonName))
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if ok && !pub.Equal(cert.PublicKey) || !ok && !reflect.DeepEqual(signer.Public(), cert.PublicKey) {
+		return nil, NewPolicyViolation("signer key does not match ca cert")
+	}
+	return &CA{Cert: cert, Signer: signer}, nil
+}
+
+// CertPEM return pem encoded CA cert
+func (ca *CA) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw})
+}
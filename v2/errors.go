@@ -0,0 +1,41 @@
+package easyrsa
+
+import "errors"
+
+// NotExist is returned when requested pair or CRL is absent
+type NotExist struct {
+	err string
+}
+
+func (e *NotExist) Error() string {
+	return e.err
+}
+
+func NewNotExist(err string) *NotExist {
+	return &NotExist{err: err}
+}
+
+// IsNotExist return true if err or any error it wraps is NotExist
+func IsNotExist(err error) bool {
+	var target *NotExist
+	return errors.As(err, &target)
+}
+
+// PolicyViolation is returned when operation is refused, e.g. CA key does not match CA cert
+type PolicyViolation struct {
+	err string
+}
+
+func (e *PolicyViolation) Error() string {
+	return e.err
+}
+
+func NewPolicyViolation(err string) *PolicyViolation {
+	return &PolicyViolation{err: err}
+}
+
+// IsPolicyViolation return true if err or any error it wraps is PolicyViolation
+func IsPolicyViolation(err error) bool {
+	var target *PolicyViolation
+	return errors.As(err, &target)
+}
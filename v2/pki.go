@@ -0,0 +1,145 @@
+// Package easyrsa v2 is context aware API of go-easyrsa. CA is any crypto.Signer, storage, serial and CRL
+// interfaces take contexts and return typed errors. v1 implementations are adapted by v1compat module
+package easyrsa
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// DefaultCRLValidity is NextUpdate offset of CRLs issued by Revoke if WithCRLValidity is not set
+const DefaultCRLValidity = 7 * 24 * time.Hour
+
+// PKI issue and revoke certs of one CA
+type PKI struct {
+	CA          *CA
+	Storage     KeyStorage
+	Serials     SerialProvider
+	CRL         CRLHolder
+	crlValidity time.Duration    // NextUpdate offset of issued CRLs
+	now         func() time.Time // clock, time.Now if nil
+}
+
+// Option configure PKI
+type Option func(p *PKI)
+
+// WithCRLValidity set NextUpdate offset of CRLs issued by Revoke
+func WithCRLValidity(validity time.Duration) Option {
+	return func(p *PKI) {
+		p.crlValidity = validity
+	}
+}
+
+// WithClock set clock used for validity of certs and CRLs
+func WithClock(now func() time.Time) Option {
+	return func(p *PKI) {
+		p.now = now
+	}
+}
+
+// New return PKI of ca keeping state in storage, serials and crl
+func New(ca *CA, storage KeyStorage, serials SerialProvider, crl CRLHolder, opts ...Option) *PKI {
+	p := &PKI{CA: ca, Storage: storage, Serials: serials, CRL: crl, crlValidity: DefaultCRLValidity, now: time.Now}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Issue sign tml for pub with CA and store it as cert only pair of cn. Serial, issuer and AuthorityKeyId
+// of tml are set here, caller keep the private key
+func (p *PKI) Issue(ctx context.Context, cn string, tml *x509.Certificate, pub crypto.PublicKey) (*Pair, error) {
+	if cn == "" {
+		return nil, NewPolicyViolation("empty cn")
+	}
+	if p.CA == nil {
+		return nil, NewPolicyViolation("pki has no ca")
+	}
+	serial, err := p.Serials.Next(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can`t get next serial: %w", err)
+	}
+	cert := *tml
+	cert.SerialNumber = serial
+	cert.Subject.CommonName = cn
+	der, err := x509.CreateCertificate(rand.Reader, &cert, p.CA.Cert, pub, p.CA.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("can`t create cert: %w", err)
+	}
+	pair := &Pair{
+		CN:       cn,
+		Serial:   serial,
+		CertPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		ChainPEM: p.CA.CertPEM(),
+	}
+	if err := p.Storage.Put(ctx, pair); err != nil {
+		return nil, fmt.Errorf("can`t put pair: %w", err)
+	}
+	return pair, nil
+}
+
+// Revoke add serial to CRL and issue new CRL. Revoking already revoked serial is no-op
+func (p *PKI) Revoke(ctx context.Context, serial *big.Int) error {
+	if p.CA == nil {
+		return NewPolicyViolation("pki has no ca")
+	}
+	if _, err := p.Storage.GetBySerial(ctx, serial); err != nil {
+		return fmt.Errorf("can`t revoke %s: %w", serial, err)
+	}
+	var entries []x509.RevocationListEntry
+	number := big.NewInt(1)
+	list, err := p.CRL.Get(ctx)
+	switch {
+	case err == nil:
+		for _, entry := range list.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(serial) == 0 {
+				return nil
+			}
+		}
+		entries = list.RevokedCertificateEntries
+		if list.Number != nil {
+			number.Add(list.Number, number)
+		}
+	case !IsNotExist(err):
+		return fmt.Errorf("can`t get crl: %w", err)
+	}
+	now := p.now()
+	entries = append(entries, x509.RevocationListEntry{SerialNumber: serial, RevocationTime: now.UTC()})
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    number,
+		ThisUpdate:                now.UTC(),
+		NextUpdate:                now.Add(p.crlValidity).UTC(),
+	}, p.CA.Cert, p.CA.Signer)
+	if err != nil {
+		return fmt.Errorf("can`t create crl: %w", err)
+	}
+	if err := p.CRL.Put(ctx, der); err != nil {
+		return fmt.Errorf("can`t put crl: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked return true if serial is in current CRL, false if no CRL is issued yet.
+// Unlike v1 errors of CRL holder are returned to the caller
+func (p *PKI) IsRevoked(ctx context.Context, serial *big.Int) (bool, error) {
+	list, err := p.CRL.Get(ctx)
+	if IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("can`t get crl: %w", err)
+	}
+	for _, entry := range list.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(serial) == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,220 @@
+package easyrsa
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memStorage is in memory KeyStorage of tests
+type memStorage struct {
+	mu    sync.Mutex
+	pairs []*Pair
+}
+
+func (s *memStorage) Put(ctx context.Context, pair *Pair) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pairs = append(s.pairs, pair)
+	return ctx.Err()
+}
+
+func (s *memStorage) GetByCN(ctx context.Context, cn string) ([]*Pair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []*Pair
+	for _, pair := range s.pairs {
+		if pair.CN == cn {
+			res = append(res, pair)
+		}
+	}
+	if len(res) == 0 {
+		return nil, NewNotExist("not found")
+	}
+	return res, nil
+}
+
+func (s *memStorage) GetLastByCN(ctx context.Context, cn string) (*Pair, error) {
+	pairs, err := s.GetByCN(ctx, cn)
+	if err != nil {
+		return nil, err
+	}
+	return pairs[len(pairs)-1], nil
+}
+
+func (s *memStorage) GetBySerial(ctx context.Context, serial *big.Int) (*Pair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pair := range s.pairs {
+		if pair.Serial.Cmp(serial) == 0 {
+			return pair, nil
+		}
+	}
+	return nil, NewNotExist("not found")
+}
+
+func (s *memStorage) DeleteByCN(ctx context.Context, cn string) error {
+	return errors.New("not implemented")
+}
+
+func (s *memStorage) DeleteBySerial(ctx context.Context, serial *big.Int) error {
+	return errors.New("not implemented")
+}
+
+func (s *memStorage) GetAll(ctx context.Context) ([]*Pair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Pair(nil), s.pairs...), nil
+}
+
+type memSerials struct {
+	last int64
+}
+
+func (s *memSerials) Next(ctx context.Context) (*big.Int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return big.NewInt(atomic.AddInt64(&s.last, 1)), nil
+}
+
+type memCRL struct {
+	der []byte
+}
+
+func (h *memCRL) Put(ctx context.Context, der []byte) error {
+	h.der = der
+	return nil
+}
+
+func (h *memCRL) Get(ctx context.Context) (*x509.RevocationList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if h.der == nil {
+		return nil, NewNotExist("crl is not issued yet")
+	}
+	return x509.ParseRevocationList(h.der)
+}
+
+// newTestCA return self signed CA with ecdsa key
+func newTestCA(t *testing.T) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	now := time.Now()
+	tml := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tml, tml, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func getTmpPki(t *testing.T) *PKI {
+	cert, key := newTestCA(t)
+	ca, err := NewCA(cert, key)
+	require.NoError(t, err)
+	return New(ca, &memStorage{}, &memSerials{last: 1}, &memCRL{})
+}
+
+func leafTemplate() *x509.Certificate {
+	now := time.Now()
+	return &x509.Certificate{
+		NotBefore:   now.Add(-time.Minute),
+		NotAfter:    now.Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+}
+
+func TestPKI_IssueRevoke(t *testing.T) {
+	p := getTmpPki(t)
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	pair, err := p.Issue(ctx, "client", leafTemplate(), key.Public())
+	require.NoError(t, err)
+	assert.False(t, pair.HasKey())
+	got, err := p.Storage.GetLastByCN(ctx, "client")
+	require.NoError(t, err)
+	assert.Equal(t, pair.Serial, got.Serial)
+
+	cert, err := x509.ParseCertificate(mustDecodePEM(t, pair.CertPEM))
+	require.NoError(t, err)
+	assert.NoError(t, cert.CheckSignatureFrom(p.CA.Cert))
+
+	revoked, err := p.IsRevoked(ctx, pair.Serial)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+	assert.NoError(t, p.Revoke(ctx, pair.Serial))
+	assert.NoError(t, p.Revoke(ctx, pair.Serial))
+	revoked, err = p.IsRevoked(ctx, pair.Serial)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	list, err := p.CRL.Get(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list.RevokedCertificateEntries, 1)
+	assert.NoError(t, list.CheckSignatureFrom(p.CA.Cert))
+
+	assert.True(t, IsNotExist(p.Revoke(ctx, big.NewInt(1<<40))))
+	_, err = p.Storage.GetLastByCN(ctx, "absent")
+	assert.True(t, IsNotExist(err))
+}
+
+func TestPKI_Context(t *testing.T) {
+	p := getTmpPki(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = p.Issue(ctx, "client", leafTemplate(), key.Public())
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = p.IsRevoked(ctx, big.NewInt(1))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNewCA(t *testing.T) {
+	cert, signer := newTestCA(t)
+	_, err := NewCA(cert, signer)
+	assert.NoError(t, err)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = NewCA(cert, other)
+	assert.True(t, IsPolicyViolation(err))
+
+	leaf := *cert
+	leaf.IsCA = false
+	_, err = NewCA(&leaf, signer)
+	assert.True(t, IsPolicyViolation(err))
+}
+
+func mustDecodePEM(t *testing.T, data []byte) []byte {
+	block, _ := pem.Decode(data)
+	require.NotNil(t, block)
+	return block.Bytes
+}
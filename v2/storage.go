@@ -0,0 +1,44 @@
+package easyrsa
+
+import (
+	"context"
+	"crypto/x509"
+	"math/big"
+)
+
+// Pair is a stored cert with optional private key
+type Pair struct {
+	CN       string            // common name, storage key
+	Serial   *big.Int          // cert serial
+	CertPEM  []byte            // pem encoded cert
+	KeyPEM   []byte            // pem encoded private key, empty for cert only pairs
+	ChainPEM []byte            // pem encoded issuing chain, issuer first
+	Metadata map[string]string // tags stored with the pair
+}
+
+// HasKey return true if pair has private key
+func (p *Pair) HasKey() bool {
+	return len(p.KeyPEM) != 0
+}
+
+// KeyStorage keep pairs. Methods return NotExist for absent pairs and ctx.Err() if ctx is done
+type KeyStorage interface {
+	Put(ctx context.Context, pair *Pair) error                       // Put new pair, overwrite if already exist.
+	GetByCN(ctx context.Context, cn string) ([]*Pair, error)         // GetByCN return all pairs of cn.
+	GetLastByCN(ctx context.Context, cn string) (*Pair, error)       // GetLastByCN return pair of cn with greatest serial.
+	GetBySerial(ctx context.Context, serial *big.Int) (*Pair, error) // GetBySerial return one pair.
+	DeleteByCN(ctx context.Context, cn string) error                 // DeleteByCN delete all pairs of cn.
+	DeleteBySerial(ctx context.Context, serial *big.Int) error       // DeleteBySerial delete one pair.
+	GetAll(ctx context.Context) ([]*Pair, error)                     // GetAll return all pairs.
+}
+
+// SerialProvider allocate serials
+type SerialProvider interface {
+	Next(ctx context.Context) (*big.Int, error) // Next return next unique serial.
+}
+
+// CRLHolder keep current CRL
+type CRLHolder interface {
+	Put(ctx context.Context, der []byte) error             // Put replace CRL with der encoded one.
+	Get(ctx context.Context) (*x509.RevocationList, error) // Get return current CRL, NotExist if none is issued yet.
+}
@@ -0,0 +1,206 @@
+// Package v1compat adapt v1 storage, serial provider and CRL holder implementations to v2 interfaces, so
+// existing v1 PKI state stays usable from v2. It`s a separate module, so v2 itself does not depend on v1
+package v1compat
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	pkgerrors "github.com/pkg/errors"
+	v1 "github.com/productsupcom/go-easyrsa"
+	v2 "github.com/productsupcom/go-easyrsa/v2"
+)
+
+// v1Error map NotExist of v1 to v2 one, other errors are returned as is
+func v1Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := pkgerrors.Cause(err).(*v1.NotExist); ok {
+		return fmt.Errorf("%v: %w", err, v2.NewNotExist(e.Error()))
+	}
+	return err
+}
+
+func pairFromV1(pair *v1.X509Pair) *v2.Pair {
+	if pair == nil {
+		return nil
+	}
+	return &v2.Pair{
+		CN:       pair.CN,
+		Serial:   pair.Serial,
+		CertPEM:  pair.CertPemBytes,
+		KeyPEM:   pair.KeyPemBytes,
+		ChainPEM: pair.ChainPemBytes,
+		Metadata: pair.Metadata,
+	}
+}
+
+func pairsFromV1(pairs []*v1.X509Pair) []*v2.Pair {
+	res := make([]*v2.Pair, 0, len(pairs))
+	for _, pair := range pairs {
+		res = append(res, pairFromV1(pair))
+	}
+	return res
+}
+
+// V1Pair return v1 pair of pair, e.g. to pass it to v1 PKI or storage
+func V1Pair(pair *v2.Pair) *v1.X509Pair {
+	return &v1.X509Pair{
+		KeyPemBytes:   pair.KeyPEM,
+		CertPemBytes:  pair.CertPEM,
+		ChainPemBytes: pair.ChainPEM,
+		CN:            pair.CN,
+		Serial:        pair.Serial,
+		Metadata:      pair.Metadata,
+	}
+}
+
+// v1KeyStorage adapt v1 KeyStorage. ctx is checked before the call, v1 calls can`t be cancelled
+type v1KeyStorage struct {
+	storage v1.KeyStorage
+}
+
+// FromV1KeyStorage return KeyStorage backed by v1 storage, e.g. DirKeyStorage, so existing pairs stay readable
+func FromV1KeyStorage(storage v1.KeyStorage) v2.KeyStorage {
+	return &v1KeyStorage{storage: storage}
+}
+
+func (s *v1KeyStorage) Put(ctx context.Context, pair *v2.Pair) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v1Error(s.storage.Put(V1Pair(pair)))
+}
+
+func (s *v1KeyStorage) GetByCN(ctx context.Context, cn string) ([]*v2.Pair, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pairs, err := s.storage.GetByCN(cn)
+	if err != nil {
+		return nil, v1Error(err)
+	}
+	return pairsFromV1(pairs), nil
+}
+
+func (s *v1KeyStorage) GetLastByCN(ctx context.Context, cn string) (*v2.Pair, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pair, err := s.storage.GetLastByCn(cn)
+	if err != nil {
+		return nil, v1Error(err)
+	}
+	return pairFromV1(pair), nil
+}
+
+func (s *v1KeyStorage) GetBySerial(ctx context.Context, serial *big.Int) (*v2.Pair, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pair, err := s.storage.GetBySerial(serial)
+	if err != nil {
+		return nil, v1Error(err)
+	}
+	return pairFromV1(pair), nil
+}
+
+func (s *v1KeyStorage) DeleteByCN(ctx context.Context, cn string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v1Error(s.storage.DeleteByCn(cn))
+}
+
+func (s *v1KeyStorage) DeleteBySerial(ctx context.Context, serial *big.Int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v1Error(s.storage.DeleteBySerial(serial))
+}
+
+func (s *v1KeyStorage) GetAll(ctx context.Context) ([]*v2.Pair, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pairs, err := s.storage.GetAll()
+	if err != nil {
+		return nil, v1Error(err)
+	}
+	return pairsFromV1(pairs), nil
+}
+
+// v1SerialProvider adapt v1 SerialProvider
+type v1SerialProvider struct {
+	sp v1.SerialProvider
+}
+
+// FromV1SerialProvider return SerialProvider backed by v1 provider, e.g. FileSerialProvider
+func FromV1SerialProvider(sp v1.SerialProvider) v2.SerialProvider {
+	return &v1SerialProvider{sp: sp}
+}
+
+func (s *v1SerialProvider) Next(ctx context.Context) (*big.Int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	serial, err := s.sp.Next()
+	return serial, v1Error(err)
+}
+
+// v1CRLHolder adapt v1 CRLHolder, CRL is kept pem encoded as v1 PKI do
+type v1CRLHolder struct {
+	holder v1.CRLHolder
+}
+
+// FromV1CRLHolder return CRLHolder backed by v1 holder, e.g. FileCRLHolder
+func FromV1CRLHolder(holder v1.CRLHolder) v2.CRLHolder {
+	return &v1CRLHolder{holder: holder}
+}
+
+func (h *v1CRLHolder) Put(ctx context.Context, der []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v1Error(h.holder.Put(pem.EncodeToMemory(&pem.Block{Type: v1.PEMx509CRLBlock, Bytes: der})))
+}
+
+func (h *v1CRLHolder) Get(ctx context.Context) (*x509.RevocationList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	list, err := h.holder.Get()
+	if err != nil {
+		return nil, v1Error(err)
+	}
+	// v1 holders return empty list if no CRL is issued yet
+	if list == nil || len(list.TBSCertList.Raw) == 0 {
+		return nil, v2.NewNotExist("crl is not issued yet")
+	}
+	der, err := asn1.Marshal(*list)
+	if err != nil {
+		return nil, fmt.Errorf("can`t encode crl: %w", err)
+	}
+	res, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, fmt.Errorf("can`t parse crl: %w", err)
+	}
+	return res, nil
+}
+
+// CAFromV1Pair return CA of v1 CA pair, e.g. result of v1 PKI.GetLastCA
+func CAFromV1Pair(pair *v1.X509Pair, passphrase v1.PassphraseFunc) (*v2.CA, error) {
+	signer, cert, err := pair.DecodeSigner(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("can`t decode ca pair: %w", err)
+	}
+	if signer == nil {
+		return nil, v2.NewPolicyViolation("ca pair has no key")
+	}
+	return v2.NewCA(cert, signer)
+}
@@ -0,0 +1,71 @@
+package v1compat
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "github.com/productsupcom/go-easyrsa"
+	v2 "github.com/productsupcom/go-easyrsa/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getTmpPki(t *testing.T) (*v2.PKI, *v1.PKI) {
+	dir := t.TempDir()
+	storage := v1.NewDirKeyStorage(dir)
+	serials := v1.NewFileSerialProvider(filepath.Join(dir, "serial"))
+	crl := v1.NewFileCRLHolder(filepath.Join(dir, "crl.pem"))
+	old := v1.NewPKI(storage, serials, crl, pkix.Name{}, v1.WithKeySize(1024))
+	caPair, err := old.NewCa()
+	require.NoError(t, err)
+	ca, err := CAFromV1Pair(caPair, nil)
+	require.NoError(t, err)
+	return v2.New(ca, FromV1KeyStorage(storage), FromV1SerialProvider(serials), FromV1CRLHolder(crl)), old
+}
+
+func TestPKI_v1State(t *testing.T) {
+	p, old := getTmpPki(t)
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	now := time.Now()
+	pair, err := p.Issue(ctx, "client", &x509.Certificate{
+		NotBefore:   now.Add(-time.Minute),
+		NotAfter:    now.Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, key.Public())
+	require.NoError(t, err)
+	got, err := p.Storage.GetLastByCN(ctx, "client")
+	require.NoError(t, err)
+	assert.Equal(t, pair.Serial, got.Serial)
+
+	// v1 PKI see the cert and verify it against the same CA
+	_, err = old.Verify(pair.CertPEM)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Revoke(ctx, pair.Serial))
+	assert.True(t, old.IsRevoked(pair.Serial))
+	list, err := p.CRL.Get(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list.RevokedCertificateEntries, 1)
+
+	assert.True(t, v2.IsNotExist(p.Revoke(ctx, big.NewInt(1<<40))))
+	_, err = p.Storage.GetLastByCN(ctx, "absent")
+	assert.True(t, v2.IsNotExist(err))
+}
+
+func TestCAFromV1Pair(t *testing.T) {
+	_, old := getTmpPki(t)
+	leaf, err := old.NewCert("leaf", false, nil)
+	require.NoError(t, err)
+	_, err = CAFromV1Pair(leaf, nil)
+	assert.True(t, v2.IsPolicyViolation(err))
+}
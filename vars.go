@@ -0,0 +1,150 @@
+package easyrsa
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+// Vars is PKI defaults read from easy-rsa vars file
+type Vars struct {
+	Values       map[string]string // all assignments with variables expanded
+	KeySize      int               // KEY_SIZE or EASYRSA_KEY_SIZE, 0 if not set
+	CAValidity   time.Duration     // CA_EXPIRE or EASYRSA_CA_EXPIRE days, 0 if not set
+	CertValidity time.Duration     // KEY_EXPIRE or EASYRSA_CERT_EXPIRE days, 0 if not set
+	Subject      pkix.Name         // subject template from KEY_* or EASYRSA_REQ_* fields
+}
+
+var (
+	varsExport   = regexp.MustCompile(`^(?:export\s+)?([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+	varsSetVar   = regexp.MustCompile(`^set_var\s+([A-Za-z_][A-Za-z0-9_]*)\s*(.*)$`)
+	varsVariable = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)\}?`)
+)
+
+// ParseVars read easy-rsa 2 "export KEY_SIZE=2048" and easy-rsa 3 "set_var EASYRSA_KEY_SIZE 2048" vars files.
+// Other shell statements are ignored, easy-rsa 3 org fields are used only with EASYRSA_DN "org" as easy-rsa do
+func ParseVars(data []byte) (*Vars, error) {
+	vars := &Vars{Values: make(map[string]string)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := varsSetVar.FindStringSubmatch(line)
+		if m == nil {
+			m = varsExport.FindStringSubmatch(line)
+		}
+		if m == nil {
+			continue
+		}
+		vars.Values[m[1]] = vars.expand(unquoteVarsValue(m[2]))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "can`t read vars")
+	}
+
+	var err error
+	if vars.KeySize, err = vars.int("EASYRSA_KEY_SIZE", "KEY_SIZE"); err != nil {
+		return nil, err
+	}
+	caDays, err := vars.int("EASYRSA_CA_EXPIRE", "CA_EXPIRE")
+	if err != nil {
+		return nil, err
+	}
+	certDays, err := vars.int("EASYRSA_CERT_EXPIRE", "KEY_EXPIRE")
+	if err != nil {
+		return nil, err
+	}
+	vars.CAValidity = time.Duration(caDays) * 24 * time.Hour
+	vars.CertValidity = time.Duration(certDays) * 24 * time.Hour
+
+	if dn, ok := vars.Values["EASYRSA_DN"]; ok && dn != "org" {
+		return vars, nil
+	}
+	field := func(names ...string) []string {
+		if value := vars.get(names...); value != "" {
+			return []string{value}
+		}
+		return nil
+	}
+	vars.Subject = pkix.Name{
+		Country:            field("EASYRSA_REQ_COUNTRY", "KEY_COUNTRY"),
+		Province:           field("EASYRSA_REQ_PROVINCE", "KEY_PROVINCE"),
+		Locality:           field("EASYRSA_REQ_CITY", "KEY_CITY"),
+		Organization:       field("EASYRSA_REQ_ORG", "KEY_ORG"),
+		OrganizationalUnit: field("EASYRSA_REQ_OU", "KEY_OU"),
+	}
+	if email := vars.get("EASYRSA_REQ_EMAIL", "KEY_EMAIL"); email != "" {
+		vars.Subject.ExtraNames = []pkix.AttributeTypeAndValue{{Type: oidEmailAddress, Value: email}}
+	}
+	return vars, nil
+}
+
+// Options return PKI options for key size and validity set in vars
+func (v *Vars) Options() []Option {
+	opts := make([]Option, 0, 2)
+	if v.KeySize > 0 {
+		opts = append(opts, WithKeySize(v.KeySize))
+	}
+	if v.CAValidity > 0 || v.CertValidity > 0 {
+		opts = append(opts, WithValidity(v.CAValidity, v.CertValidity))
+	}
+	return opts
+}
+
+// get return first set value of names
+func (v *Vars) get(names ...string) string {
+	for _, name := range names {
+		if value, ok := v.Values[name]; ok {
+			return value
+		}
+	}
+	return ""
+}
+
+func (v *Vars) int(names ...string) (int, error) {
+	value := v.get(names...)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("wrong %s value %q", names[0], value)
+	}
+	return n, nil
+}
+
+func (v *Vars) expand(value string) string {
+	return varsVariable.ReplaceAllStringFunc(value, func(ref string) string {
+		name := varsVariable.FindStringSubmatch(ref)[1]
+		if value, ok := v.Values[name]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// unquoteVarsValue strip quotes and trailing comment of shell value
+func unquoteVarsValue(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return value[1 : end+1]
+		}
+		return value[1:]
+	}
+	if idx := strings.Index(value, " #"); idx >= 0 {
+		value = value[:idx]
+	}
+	return strings.TrimSpace(value)
+}
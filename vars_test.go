@@ -0,0 +1,76 @@
+package easyrsa
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVars(t *testing.T) {
+	vars, err := ParseVars([]byte(`
+# easy-rsa 2
+export EASY_RSA="` + "`pwd`" + `"
+export KEY_SIZE=1024
+export CA_EXPIRE=3650
+export KEY_EXPIRE=365
+export KEY_COUNTRY="US"
+export KEY_PROVINCE="CA"
+export KEY_CITY=SanFrancisco # city
+export KEY_ORG='Fort-Funston'
+export KEY_EMAIL="me@myhost.mydomain"
+export KEY_OU=$KEY_ORG-ops
+if [ -z "$X" ]; then echo; fi
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1024, vars.KeySize)
+	assert.Equal(t, 3650*24*time.Hour, vars.CAValidity)
+	assert.Equal(t, 365*24*time.Hour, vars.CertValidity)
+	assert.Equal(t, []string{"US"}, vars.Subject.Country)
+	assert.Equal(t, []string{"SanFrancisco"}, vars.Subject.Locality)
+	assert.Equal(t, []string{"Fort-Funston"}, vars.Subject.Organization)
+	assert.Equal(t, []string{"Fort-Funston-ops"}, vars.Subject.OrganizationalUnit)
+	assert.Equal(t, "me@myhost.mydomain", vars.Subject.ExtraNames[0].Value)
+
+	vars, err = ParseVars([]byte(`
+set_var EASYRSA_DN "org"
+set_var EASYRSA_REQ_COUNTRY "DE"
+set_var EASYRSA_REQ_ORG "Copyleft Certificate Co"
+set_var EASYRSA_KEY_SIZE 3072
+set_var EASYRSA_CERT_EXPIRE 825
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 3072, vars.KeySize)
+	assert.Equal(t, 825*24*time.Hour, vars.CertValidity)
+	assert.Equal(t, time.Duration(0), vars.CAValidity)
+	assert.Equal(t, []string{"Copyleft Certificate Co"}, vars.Subject.Organization)
+
+	vars, err = ParseVars([]byte("set_var EASYRSA_DN cn_only\nset_var EASYRSA_REQ_ORG Org\n"))
+	assert.NoError(t, err)
+	assert.Nil(t, vars.Subject.Organization)
+
+	_, err = ParseVars([]byte("set_var EASYRSA_KEY_SIZE big\n"))
+	assert.Error(t, err)
+}
+
+func TestVars_Options(t *testing.T) {
+	vars, err := ParseVars([]byte("export KEY_SIZE=1024\nexport CA_EXPIRE=30\nexport KEY_EXPIRE=10\nexport KEY_ORG=Org\n"))
+	assert.NoError(t, err)
+	dir := filepath.Join(getTestDir(), "vars")
+	_ = os.MkdirAll(dir, 0755)
+	pki := NewPKI(NewDirKeyStorage(dir), NewFileSerialProvider(filepath.Join(dir, "serial")),
+		NewFileCRLHolder(filepath.Join(dir, "crl.pem")), vars.Subject, vars.Options()...)
+	defer os.RemoveAll(dir)
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+	key, caCert, _ := ca.Decode()
+	assert.Equal(t, 1024, key.N.BitLen())
+	assert.Equal(t, []string{"Org"}, caCert.Subject.Organization)
+	assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), caCert.NotAfter, time.Minute)
+	pair, err := pki.NewCert("client", false, []string{""})
+	assert.NoError(t, err)
+	_, cert, _ := pair.Decode()
+	assert.WithinDuration(t, time.Now().Add(10*24*time.Hour), cert.NotAfter, time.Minute)
+}
@@ -0,0 +1,472 @@
+package easyrsa
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VaultRole is a subset of Vault PKI role options applied to issue/<role> and sign/<role> requests
+type VaultRole struct {
+	Name            string        // role name in request path
+	Server          bool          // issue server certs, client certs otherwise. Ignored if Profile set
+	Profile         string        // registered profile used for issuance, built-in templates if empty
+	AllowedDomains  []string      // common_name and alt_names must match one of domains, any name if empty
+	AllowSubdomains bool          // subdomains of AllowedDomains are allowed too
+	MaxTTL          time.Duration // requested ttl is capped at MaxTTL if set, it`s used if ttl is not requested
+}
+
+// VaultAuthorizer return error if token must not perform operation (issue, sign or revoke) with role
+type VaultAuthorizer func(token, operation, role string) error
+
+// VaultFacade serve subset of Vault PKI secrets engine http API: issue/<role>, sign/<role>, revoke,
+// ca, ca/pem, ca_chain, cert/ca, crl, crl/pem and cert/crl. Mount it with mount prefix stripped, e.g.
+// http.StripPrefix("/v1/pki", facade)
+type VaultFacade struct {
+	Authorize VaultAuthorizer // additional X-Vault-Token check for write operations, skipped if nil
+	Auth      *APIAuth        // authentication and authorization of write operations with requested names, they are refused if nil
+
+	pki   *PKI
+	roles map[string]*VaultRole
+}
+
+// NewVaultFacade create facade issuing certs with pki for roles
+func NewVaultFacade(pki *PKI, roles ...*VaultRole) *VaultFacade {
+	f := &VaultFacade{pki: pki, roles: make(map[string]*VaultRole)}
+	for _, role := range roles {
+		f.roles[role.Name] = role
+	}
+	return f
+}
+
+// vaultRequest is a body of issue, sign and revoke requests
+type vaultRequest struct {
+	CommonName   string          `json:"common_name"`
+	AltNames     string          `json:"alt_names"`
+	IPSans       string          `json:"ip_sans"`
+	TTL          json.RawMessage `json:"ttl"`
+	CSR          string          `json:"csr"`
+	SerialNumber string          `json:"serial_number"`
+}
+
+// vaultError is http error reported as Vault does
+type vaultError struct {
+	status int
+	msg    string
+}
+
+func (e *vaultError) Error() string {
+	return e.msg
+}
+
+func vaultErrorf(status int, format string, args ...interface{}) error {
+	return &vaultError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// ServeHTTP implement http.Handler for Vault PKI requests
+func (f *VaultFacade) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.Trim(req.URL.Path, "/")
+	op, role := path, ""
+	if i := strings.Index(path, "/"); i > 0 && (path[:i] == "issue" || path[:i] == "sign") {
+		op, role = path[:i], path[i+1:]
+	}
+
+	switch op {
+	case "ca", "ca/pem", "ca_chain", "cert/ca", "crl", "crl/pem", "cert/crl":
+		if req.Method != http.MethodGet {
+			f.writeError(w, vaultErrorf(http.StatusMethodNotAllowed, "unsupported operation"))
+			return
+		}
+		f.serveRead(w, op)
+	case "issue", "sign", "revoke":
+		if req.Method != http.MethodPost && req.Method != http.MethodPut {
+			f.writeError(w, vaultErrorf(http.StatusMethodNotAllowed, "unsupported operation"))
+			return
+		}
+		data, err := f.write(req, op, role)
+		if err != nil {
+			f.writeError(w, err)
+			return
+		}
+		f.writeJSON(w, http.StatusOK, map[string]interface{}{"data": data, "lease_duration": 0, "renewable": false})
+	default:
+		f.writeError(w, vaultErrorf(http.StatusNotFound, "unsupported path"))
+	}
+}
+
+func (f *VaultFacade) write(req *http.Request, op, roleName string) (map[string]interface{}, error) {
+	token := req.Header.Get("X-Vault-Token")
+	if token == "" {
+		token = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	}
+	if f.Authorize != nil {
+		if err := f.Authorize(token, op, roleName); err != nil {
+			return nil, vaultErrorf(http.StatusForbidden, "permission denied")
+		}
+	}
+	id, err := f.authenticate(req)
+	if err != nil {
+		if _, ok := errors.Cause(err).(*Unauthenticated); ok {
+			return nil, vaultErrorf(http.StatusForbidden, "permission denied")
+		}
+		return nil, err
+	}
+	var body vaultRequest
+	if err := json.NewDecoder(io.LimitReader(req.Body, 1024*1024)).Decode(&body); err != nil {
+		return nil, vaultErrorf(http.StatusBadRequest, "can`t parse request: %s", err)
+	}
+	if op == "revoke" {
+		return f.revoke(id, body)
+	}
+	role, ok := f.roles[roleName]
+	if !ok {
+		return nil, vaultErrorf(http.StatusBadRequest, "unknown role: %s", roleName)
+	}
+	return f.issue(id, HTTPCredentials(req), op, role, body)
+}
+
+// authenticate return identity of request, Unauthenticated if Auth is not set
+func (f *VaultFacade) authenticate(req *http.Request) (*Identity, error) {
+	if f.Auth == nil {
+		return nil, errors.WithStack(NewUnauthenticated("no authentication is configured"))
+	}
+	return f.Auth.Authenticate(req.Context(), HTTPCredentials(req))
+}
+
+// authorize check request of authenticated identity
+func (f *VaultFacade) authorize(id *Identity, req *AuthorizationRequest) error {
+	if err := f.Auth.Authorize(id, req); err != nil {
+		return vaultErrorf(http.StatusForbidden, "permission denied")
+	}
+	return nil
+}
+
+func (f *VaultFacade) issue(id *Identity, creds *Credentials, op string, role *VaultRole, body vaultRequest) (map[string]interface{}, error) {
+	if err := f.pki.requireAttestation(); err != nil {
+		return nil, err
+	}
+	var csr *x509.CertificateRequest
+	if op == "sign" {
+		var err error
+		if csr, err = decodeCSR([]byte(body.CSR)); err != nil {
+			return nil, vaultErrorf(http.StatusBadRequest, "%s", err)
+		}
+		if body.CommonName == "" {
+			body.CommonName = csr.Subject.CommonName
+		}
+	}
+	cn := body.CommonName
+	if cn == "" {
+		return nil, vaultErrorf(http.StatusBadRequest, "the common_name field is required")
+	}
+	if err := CheckCN(cn); err != nil {
+		return nil, vaultErrorf(http.StatusBadRequest, "%s", err)
+	}
+	if vaultReservedCN(cn) {
+		return nil, vaultErrorf(http.StatusBadRequest, "common_name %s is reserved", cn)
+	}
+	if csr != nil {
+		var err error
+		if f.pki.isReenrollment(creds, cn) {
+			// client renew with it`s current cert over mTLS, enrollment token is not needed
+			err = f.pki.checkCSRKey(csr, cn)
+		} else {
+			err = f.pki.checkCSR(csr, cn, role.Profile)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	names := []string{cn}
+	for _, name := range strings.Split(body.AltNames, ",") {
+		if name = strings.TrimSpace(name); name != "" && name != cn {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if !role.allowed(name) {
+			return nil, vaultErrorf(http.StatusBadRequest, "name %s not allowed by this role", name)
+		}
+	}
+	ips := make([]net.IP, 0)
+	for _, s := range strings.Split(body.IPSans, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, vaultErrorf(http.StatusBadRequest, "invalid ip address %s", s)
+		}
+		ips = append(ips, ip)
+	}
+	sans := append([]string{}, names[1:]...)
+	for _, ip := range ips {
+		sans = append(sans, ip.String())
+	}
+	if err := f.authorize(id, &AuthorizationRequest{Operation: op, CN: cn, SANs: sans, Profile: role.Profile}); err != nil {
+		return nil, err
+	}
+	ttl, err := parseVaultTTL(body.TTL)
+	if err != nil {
+		return nil, err
+	}
+	if role.MaxTTL > 0 && (ttl <= 0 || ttl > role.MaxTTL) {
+		ttl = role.MaxTTL
+	}
+
+	pair, err := f.pki.issueRequest(CertRequest{
+		CN:          cn,
+		Server:      role.Server,
+		DNSNames:    names,
+		IPAddresses: ips,
+		Profile:     role.Profile,
+		Validity:    ttl,
+		CSR:         csr,
+		Metadata:    map[string]string{"vault_role": role.Name},
+		Requester:   RequesterFromIdentity(id),
+	})
+	if err != nil {
+		return nil, err
+	}
+	cert, err := decodeCert(pair.CertPemBytes)
+	if err != nil {
+		return nil, err
+	}
+	chain := splitPEMCerts(pair.ChainPemBytes)
+	data := map[string]interface{}{
+		"certificate":   strings.TrimSpace(string(pair.CertPemBytes)),
+		"issuing_ca":    "",
+		"ca_chain":      chain,
+		"serial_number": vaultSerial(cert.SerialNumber),
+		"expiration":    cert.NotAfter.Unix(),
+	}
+	if len(chain) > 0 {
+		data["issuing_ca"] = chain[0]
+	}
+	if pair.HasKey() {
+		data["private_key"] = strings.TrimSpace(string(pair.KeyPemBytes))
+		data["private_key_type"] = vaultKeyType(cert.PublicKey)
+	}
+	return data, nil
+}
+
+func (f *VaultFacade) revoke(id *Identity, body vaultRequest) (map[string]interface{}, error) {
+	serial, ok := new(big.Int).SetString(strings.NewReplacer(":", "", "-", "").Replace(body.SerialNumber), 16)
+	if !ok {
+		return nil, vaultErrorf(http.StatusBadRequest, "invalid serial number")
+	}
+	pair, err := f.pki.Storage.GetBySerial(serial)
+	if err != nil {
+		return nil, vaultErrorf(http.StatusBadRequest, "certificate with serial %s not found", body.SerialNumber)
+	}
+	if vaultReservedCN(pair.CN) {
+		return nil, vaultErrorf(http.StatusBadRequest, "certificate with serial %s of %s can`t be revoked", body.SerialNumber, pair.CN)
+	}
+	if err := f.authorize(id, &AuthorizationRequest{Operation: AuthOpRevoke, CN: pair.CN}); err != nil {
+		return nil, err
+	}
+	if !f.pki.IsRevoked(serial) {
+		requester := RequesterFromIdentity(id)
+		if requester == nil {
+			requester = &Requester{Name: "vault-api"}
+		}
+		if err := f.pki.RevokeWithRequester(requester, serial, ""); err != nil {
+			return nil, err
+		}
+	}
+	list, err := f.pki.GetCRL()
+	if err != nil {
+		return nil, err
+	}
+	var at time.Time
+	for _, revoked := range list.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(serial) == 0 {
+			at = revoked.RevocationTime
+			break
+		}
+	}
+	return map[string]interface{}{
+		"revocation_time":         at.Unix(),
+		"revocation_time_rfc3339": at.UTC().Format(time.RFC3339Nano),
+	}, nil
+}
+
+func (f *VaultFacade) serveRead(w http.ResponseWriter, op string) {
+	var pemBytes []byte
+	var err error
+	if strings.Contains(op, "crl") {
+		pemBytes, err = f.crlPEM()
+	} else {
+		pemBytes, err = f.caPEM(op == "ca_chain")
+	}
+	if err != nil {
+		f.writeError(w, err)
+		return
+	}
+	switch op {
+	case "cert/ca", "cert/crl":
+		f.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{"certificate": strings.TrimSpace(string(pemBytes))},
+		})
+	case "ca", "crl":
+		block, _ := pem.Decode(pemBytes)
+		if strings.Contains(op, "crl") {
+			w.Header().Set("Content-Type", "application/pkix-crl")
+		} else {
+			w.Header().Set("Content-Type", "application/pkix-cert")
+		}
+		_, _ = w.Write(block.Bytes)
+	default:
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(pemBytes)
+	}
+}
+
+// caPEM return pem of last CA, followed by it`s chain if withChain
+func (f *VaultFacade) caPEM(withChain bool) ([]byte, error) {
+	ca, err := f.pki.GetLastCA()
+	if err != nil {
+		return nil, vaultErrorf(http.StatusNotFound, "no ca")
+	}
+	if !withChain {
+		return ca.CertPemBytes, nil
+	}
+	if len(ca.ChainPemBytes) == 0 {
+		if err := f.pki.ResolveChain(ca); err != nil {
+			return nil, err
+		}
+	}
+	return append(append([]byte{}, ca.CertPemBytes...), ca.ChainPemBytes...), nil
+}
+
+// crlPEM return pem of current CRL
+func (f *VaultFacade) crlPEM() ([]byte, error) {
+	list, err := f.pki.GetCRL()
+	if err != nil {
+		return nil, err
+	}
+	if len(list.SignatureValue.Bytes) == 0 {
+		return nil, vaultErrorf(http.StatusNotFound, "no crl")
+	}
+	der, err := asn1.Marshal(*list)
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t marshal crl")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMx509CRLBlock, Bytes: der}), nil
+}
+
+func (f *VaultFacade) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (f *VaultFacade) writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch e := errors.Cause(err).(type) {
+	case *vaultError:
+		status = e.status
+	case *PolicyViolation, *QuotaExceeded, *NotFIPSApproved, *InvalidRequest:
+		status = http.StatusBadRequest
+	case *NotLeader:
+		status = http.StatusServiceUnavailable
+	}
+	f.writeJSON(w, status, map[string]interface{}{"errors": []string{err.Error()}})
+}
+
+// allowed return true if name match role domains
+func (r *VaultRole) allowed(name string) bool {
+	if len(r.AllowedDomains) == 0 {
+		return true
+	}
+	name = strings.ToLower(name)
+	for _, domain := range r.AllowedDomains {
+		domain = strings.ToLower(domain)
+		if name == domain || (r.AllowSubdomains && strings.HasSuffix(name, "."+domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+// vaultReservedCN return true for CNs of CA, trust anchor, CRL signer and cross certs, they are not issued
+// or revoked through the facade
+func vaultReservedCN(cn string) bool {
+	return duplicateCNExempt(cn) || cn == TrustAnchorCN
+}
+
+// parseVaultTTL parse ttl given as seconds number or duration string, negative ttl is InvalidRequest
+func parseVaultTTL(raw json.RawMessage) (time.Duration, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		s = string(raw)
+	}
+	if s == "" {
+		return 0, nil
+	}
+	var ttl time.Duration
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		ttl = time.Duration(seconds) * time.Second
+	} else if ttl, err = time.ParseDuration(s); err != nil {
+		return 0, errors.WithStack(NewInvalidRequest(fmt.Sprintf("invalid ttl %s", s)))
+	}
+	if ttl < 0 {
+		return 0, errors.WithStack(NewInvalidRequest(fmt.Sprintf("negative ttl %s", s)))
+	}
+	return ttl, nil
+}
+
+// vaultKeyType return Vault key type name of public key, empty for unknown ones
+func vaultKeyType(pub interface{}) string {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return "rsa"
+	case *ecdsa.PublicKey:
+		return "ec"
+	case ed25519.PublicKey:
+		return "ed25519"
+	}
+	return ""
+}
+
+// vaultSerial format serial as colon separated hex bytes
+func vaultSerial(serial *big.Int) string {
+	b := serial.Bytes()
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = fmt.Sprintf("%02x", v)
+	}
+	return strings.Join(parts, ":")
+}
+
+// splitPEMCerts return every certificate block as separate pem string
+func splitPEMCerts(pemBytes []byte) []string {
+	res := make([]string, 0)
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			return res
+		}
+		if block.Type == PEMCertificateBlock {
+			res = append(res, strings.TrimSpace(string(pem.EncodeToMemory(block))))
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package easyrsa
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVaultFacade(t *testing.T) {
+	pki, cleanup := getTmpPki(WithKeySize(1024))
+	defer cleanup()
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	facade := NewVaultFacade(pki, &VaultRole{
+		Name:            "web",
+		Server:          true,
+		AllowedDomains:  []string{"pki.local"},
+		AllowSubdomains: true,
+		MaxTTL:          24 * time.Hour,
+	})
+	facade.Authorize = func(token, operation, role string) error {
+		if token != "s.token" {
+			return errors.New("bad token")
+		}
+		return nil
+	}
+	facade.Auth = &APIAuth{
+		Authenticator: NewBearerAuthenticator(func(ctx context.Context, token string) (string, []string, error) {
+			return "ci", nil, nil
+		}),
+		Rules: AuthorizationRules{{Identities: []string{"ci"}, CNs: []string{"*"}}},
+	}
+	server := httptest.NewServer(http.StripPrefix("/v1/pki", facade))
+	defer server.Close()
+
+	call := func(method, path string, body interface{}) (int, map[string]interface{}) {
+		var reader *bytes.Reader
+		if body != nil {
+			b, _ := json.Marshal(body)
+			reader = bytes.NewReader(b)
+		} else {
+			reader = bytes.NewReader(nil)
+		}
+		req, _ := http.NewRequest(method, server.URL+"/v1/pki/"+path, reader)
+		req.Header.Set("X-Vault-Token", "s.token")
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			return 0, nil
+		}
+		defer resp.Body.Close()
+		res := make(map[string]interface{})
+		_ = json.NewDecoder(resp.Body).Decode(&res)
+		return resp.StatusCode, res
+	}
+
+	var serial string
+	t.Run("issue", func(t *testing.T) {
+		status, res := call(http.MethodPost, "issue/web", map[string]interface{}{
+			"common_name": "www.pki.local", "alt_names": "api.pki.local", "ip_sans": "10.0.0.1", "ttl": "720h",
+		})
+		if !assert.Equal(t, http.StatusOK, status, res) {
+			return
+		}
+		data := res["data"].(map[string]interface{})
+		assert.Equal(t, "rsa", data["private_key_type"])
+		assert.NotEmpty(t, data["issuing_ca"])
+		cert, err := decodeCert([]byte(data["certificate"].(string)))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"www.pki.local", "api.pki.local"}, cert.DNSNames)
+		assert.Equal(t, "10.0.0.1", cert.IPAddresses[0].String())
+		assert.WithinDuration(t, pki.now().Add(24*time.Hour), cert.NotAfter, time.Minute)
+		assert.Equal(t, vaultSerial(cert.SerialNumber), data["serial_number"])
+		serial = data["serial_number"].(string)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		status, res := call(http.MethodPost, "issue/web", map[string]interface{}{"common_name": "evil.com"})
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.NotEmpty(t, res["errors"])
+		status, _ = call(http.MethodPost, "issue/unknown", map[string]interface{}{"common_name": "www.pki.local"})
+		assert.Equal(t, http.StatusBadRequest, status)
+		status, _ = call(http.MethodGet, "unknown", nil)
+		assert.Equal(t, http.StatusNotFound, status)
+
+		open := NewVaultFacade(pki, &VaultRole{Name: "any"})
+		open.Auth = facade.Auth
+		write := func(facade *VaultFacade, path string, body map[string]interface{}) int {
+			rec := httptest.NewRecorder()
+			b, _ := json.Marshal(body)
+			req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+			req.Header.Set("X-Vault-Token", "s.token")
+			facade.ServeHTTP(rec, req)
+			return rec.Code
+		}
+		for _, cn := range []string{"ca", "ca/", "../escaped", "x/../ca", CRLSignerCN} {
+			assert.Equal(t, http.StatusBadRequest, write(open, "/issue/any", map[string]interface{}{"common_name": cn}), cn)
+		}
+		_, err := pki.Storage.GetLastByCn("escaped")
+		assert.Error(t, err)
+
+		ca, err := pki.GetLastCA()
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, write(open, "/revoke", map[string]interface{}{"serial_number": vaultSerial(ca.Serial)}))
+		assert.False(t, pki.IsRevoked(ca.Serial))
+
+		// nothing is written without Auth
+		anonymous := NewVaultFacade(pki, &VaultRole{Name: "any"})
+		assert.Equal(t, http.StatusForbidden, write(anonymous, "/issue/any", map[string]interface{}{"common_name": "www.pki.local"}))
+		assert.Equal(t, http.StatusForbidden, write(anonymous, "/revoke", map[string]interface{}{"serial_number": vaultSerial(ca.Serial)}))
+		assert.False(t, pki.IsRevoked(ca.Serial))
+
+		pki.attestation = &AttestationPolicy{Required: true}
+		status, _ = call(http.MethodPost, "issue/web", map[string]interface{}{"common_name": "www.pki.local"})
+		assert.Equal(t, http.StatusBadRequest, status)
+		status, _ = call(http.MethodPost, "sign/web", map[string]interface{}{"csr": string(newTestCSR(t, "db.pki.local"))})
+		assert.Equal(t, http.StatusBadRequest, status)
+		pki.attestation = nil
+
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/pki/issue/web", bytes.NewReader([]byte(`{"common_name":"www.pki.local"}`)))
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("sign", func(t *testing.T) {
+		status, res := call(http.MethodPost, "sign/web", map[string]interface{}{"csr": string(newTestCSR(t, "db.pki.local")), "ttl": 3600})
+		if !assert.Equal(t, http.StatusOK, status, res) {
+			return
+		}
+		data := res["data"].(map[string]interface{})
+		assert.Nil(t, data["private_key"])
+		cert, err := decodeCert([]byte(data["certificate"].(string)))
+		assert.NoError(t, err)
+		assert.Equal(t, "db.pki.local", cert.Subject.CommonName)
+		assert.WithinDuration(t, pki.now().Add(time.Hour), cert.NotAfter, time.Minute)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		for _, ttl := range []interface{}{"-1s", -3600, "-8760h"} {
+			status, res := call(http.MethodPost, "issue/web", map[string]interface{}{"common_name": "www.pki.local", "ttl": ttl})
+			assert.Equal(t, http.StatusBadRequest, status, ttl)
+			assert.Contains(t, res["errors"], "negative ttl "+strings.Trim(fmt.Sprint(ttl), `"`))
+		}
+		status, res := call(http.MethodPost, "issue/web", map[string]interface{}{"common_name": "www.pki.local", "ttl": "0s"})
+		if assert.Equal(t, http.StatusOK, status, res) {
+			cert, err := decodeCert([]byte(res["data"].(map[string]interface{})["certificate"].(string)))
+			assert.NoError(t, err)
+			assert.WithinDuration(t, pki.now().Add(24*time.Hour), cert.NotAfter, time.Minute)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		status, res := call(http.MethodPost, "revoke", map[string]interface{}{"serial_number": serial})
+		if !assert.Equal(t, http.StatusOK, status, res) {
+			return
+		}
+		assert.NotZero(t, res["data"].(map[string]interface{})["revocation_time"])
+		status, _ = call(http.MethodPost, "revoke", map[string]interface{}{"serial_number": "ff:ff:ff"})
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("read", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/v1/pki/crl")
+		assert.NoError(t, err)
+		der, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		list, err := x509.ParseRevocationList(der)
+		if assert.NoError(t, err) {
+			assert.Len(t, list.RevokedCertificates, 1) //nolint:staticcheck // RevokedCertificateEntries need go 1.21
+		}
+
+		resp, err = http.Get(server.URL + "/v1/pki/ca/pem")
+		assert.NoError(t, err)
+		caPem, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		ca, err := pki.GetLastCA()
+		assert.NoError(t, err)
+		assert.Equal(t, ca.CertPemBytes, caPem)
+
+		status, res := call(http.MethodGet, "cert/ca", nil)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, res["data"].(map[string]interface{})["certificate"], "BEGIN CERTIFICATE")
+		status, _ = call(http.MethodPost, "ca/pem", nil)
+		assert.Equal(t, http.StatusMethodNotAllowed, status)
+	})
+}
+
+func TestVaultKeyType(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	assert.Equal(t, "ec", vaultKeyType(&ecKey.PublicKey))
+	assert.Equal(t, "ed25519", vaultKeyType(edPub))
+	assert.Equal(t, "", vaultKeyType(nil))
+}
@@ -0,0 +1,41 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Verify check that cert is signed by stored CA resolved by authority key id, cert and CA are valid now
+// and cert is not revoked. Unavailable CRL is an error unless CRLFailurePolicy allow it. Issuing CA cert is returned
+func (p *PKI) Verify(certPem []byte) (*x509.Certificate, error) {
+	cert, err := decodeCert(certPem)
+	if err != nil {
+		return nil, err
+	}
+	cas, _, err := p.caCerts()
+	if err != nil {
+		return nil, err
+	}
+	issuer := findIssuer(cert, cas)
+	if issuer == nil {
+		return nil, errors.New("certificate is not signed by stored ca")
+	}
+	now := p.now()
+	for _, c := range []*x509.Certificate{cert, issuer} {
+		if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+			return nil, errors.Errorf("certificate %s is not valid at %s", c.Subject.CommonName, now.Format(time.RFC3339))
+		}
+	}
+	list, err := p.revocationList()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t check revocation")
+	}
+	for _, revoked := range list.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return nil, errors.Errorf("certificate %s is revoked", cert.SerialNumber.Text(16))
+		}
+	}
+	return issuer, nil
+}
@@ -0,0 +1,55 @@
+package easyrsa
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_Verify(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	oldCa, _ := pki.NewCa()
+	oldLeaf, _ := pki.NewCert("old", false, []string{""})
+	newCa, _ := pki.NewCa()
+	newLeaf, _ := pki.NewCert("new", false, []string{""})
+	_, oldCaCert, _ := oldCa.Decode()
+	_, newCaCert, _ := newCa.Decode()
+
+	issuer, err := pki.Verify(oldLeaf.CertPemBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, oldCaCert.SubjectKeyId, issuer.SubjectKeyId)
+	issuer, err = pki.Verify(newLeaf.CertPemBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, newCaCert.SubjectKeyId, issuer.SubjectKeyId)
+
+	assert.NoError(t, pki.RevokeOne(oldLeaf.Serial))
+	_, err = pki.Verify(oldLeaf.CertPemBytes)
+	assert.Error(t, err)
+	_, err = pki.Verify(newLeaf.CertPemBytes)
+	assert.NoError(t, err)
+	list, err := pki.GetCRL()
+	assert.NoError(t, err)
+	assert.Equal(t, newCaCert.SubjectKeyId, crlAuthorityKeyID(list))
+
+	_, err = pki.Verify(getTestPair("foreign", 99).CertPemBytes)
+	assert.Error(t, err)
+	_, err = pki.Verify([]byte("garbage"))
+	assert.Error(t, err)
+}
+
+func TestFindIssuer(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	first, _ := pki.NewCa()
+	leaf, _ := pki.NewCert("leaf", false, []string{""})
+	second, _ := pki.NewCa()
+	_, firstCert, _ := first.Decode()
+	_, secondCert, _ := second.Decode()
+	_, leafCert, _ := leaf.Decode()
+	assert.Equal(t, firstCert, findIssuer(leafCert, []*x509.Certificate{secondCert, firstCert}))
+	assert.Nil(t, findIssuer(leafCert, []*x509.Certificate{secondCert}))
+	leafCert.AuthorityKeyId = nil
+	assert.Equal(t, firstCert, findIssuer(leafCert, []*x509.Certificate{secondCert, firstCert}))
+}
@@ -0,0 +1,242 @@
+package easyrsa
+
+import (
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// WatchEvent describe change made in watched key dir or CRL file
+type WatchEvent struct {
+	Path string // changed file
+	CRL  bool   // CRL file is changed, otherwise pair file in key dir
+}
+
+// Watcher watch DirKeyStorage key dir and FileCRLHolder file for changes made by other writers.
+// While watcher is running PKI caches last CA and verified CRL, caches are dropped on every change
+type Watcher struct {
+	pki      *PKI
+	fs       *fsnotify.Watcher
+	keydir   string
+	crlPath  string
+	onChange func(event WatchEvent)
+	onError  func(err error)
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Watch start watching storage and CRL holder of PKI, only DirKeyStorage and FileCRLHolder are supported.
+// onChange and onError are optional and called from watcher goroutine. Watcher is closed by PKI.Close too
+func (p *PKI) Watch(onChange func(event WatchEvent), onError func(err error)) (*Watcher, error) {
+	w := &Watcher{pki: p, onChange: onChange, onError: onError, done: make(chan struct{})}
+	if s, ok := p.Storage.(*DirKeyStorage); ok {
+		w.keydir = filepath.Clean(s.keydir)
+	}
+	if h, ok := p.crlHolder.(*FileCRLHolder); ok {
+		w.crlPath = filepath.Clean(h.path)
+	}
+	if w.keydir == "" && w.crlPath == "" {
+		return nil, errors.New("nothing to watch, storage and crl holder are not file based")
+	}
+	fs, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "can`t create fs watcher")
+	}
+	w.fs = fs
+	if w.keydir != "" {
+		if err := w.addDir(w.keydir); err != nil {
+			_ = fs.Close()
+			return nil, err
+		}
+		entries, err := os.ReadDir(w.keydir)
+		if err != nil {
+			_ = fs.Close()
+			return nil, errors.Wrap(err, "can`t read key dir")
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				if err := w.addDir(filepath.Join(w.keydir, entry.Name())); err != nil {
+					_ = fs.Close()
+					return nil, err
+				}
+			}
+		}
+	}
+	// crl file is replaced by some writers, so it`s dir is watched
+	if w.crlPath != "" && filepath.Dir(w.crlPath) != w.keydir {
+		if err := w.addDir(filepath.Dir(w.crlPath)); err != nil {
+			_ = fs.Close()
+			return nil, err
+		}
+	}
+	p.enableCache(true)
+	w.wg.Add(1)
+	go w.loop()
+	p.AddCloser(w)
+	return w, nil
+}
+
+// Close stop watching and disable PKI caches
+func (w *Watcher) Close() error {
+	select {
+	case <-w.done:
+		return nil
+	default:
+	}
+	close(w.done)
+	err := w.fs.Close()
+	w.wg.Wait()
+	w.pki.enableCache(false)
+	return err
+}
+
+func (w *Watcher) addDir(dir string) error {
+	if err := w.fs.Add(dir); err != nil {
+		return errors.Wrapf(err, "can`t watch %s", dir)
+	}
+	return nil
+}
+
+func (w *Watcher) loop() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+			if w.onError != nil {
+				w.onError(errors.Wrap(err, "fs watcher failed"))
+			}
+		}
+	}
+}
+
+func (w *Watcher) handle(event fsnotify.Event) {
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+	path := filepath.Clean(event.Name)
+	if path == w.crlPath {
+		if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename|fsnotify.Remove) == 0 {
+			return
+		}
+		w.pki.invalidateCache()
+		w.fire(WatchEvent{Path: path, CRL: true})
+		return
+	}
+	if w.keydir == "" {
+		return
+	}
+	// new cn dir, pairs written into it before it was added are reported by walking it
+	if filepath.Dir(path) == w.keydir && event.Op&fsnotify.Create != 0 {
+		if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+			if err := w.addDir(path); err != nil && w.onError != nil {
+				w.onError(err)
+			}
+			w.pki.invalidateCache()
+			entries, _ := os.ReadDir(path)
+			for _, entry := range entries {
+				if filepath.Ext(entry.Name()) == CertFileExtension {
+					w.fire(WatchEvent{Path: filepath.Join(path, entry.Name())})
+				}
+			}
+			return
+		}
+	}
+	if filepath.Dir(filepath.Dir(path)) != w.keydir || filepath.Ext(path) != CertFileExtension {
+		return
+	}
+	w.pki.invalidateCache()
+	w.fire(WatchEvent{Path: path})
+}
+
+func (w *Watcher) fire(event WatchEvent) {
+	if w.onChange != nil {
+		w.onChange(event)
+	}
+}
+
+// pkiCache hold values read from storage while Watcher is running
+type pkiCache struct {
+	mu      sync.Mutex
+	enabled bool
+	gen     uint64 // bumped on invalidation, values read under older generation are not cached
+	ca      *X509Pair
+	crl     *pkix.CertificateList
+}
+
+func (p *PKI) enableCache(enabled bool) {
+	p.cache.mu.Lock()
+	defer p.cache.mu.Unlock()
+	p.cache.enabled = enabled
+	p.cache.gen++
+	p.cache.ca = nil
+	p.cache.crl = nil
+}
+
+// invalidateCache drop cached values, must be called after every own write to storage or crl holder
+func (p *PKI) invalidateCache() {
+	p.cache.mu.Lock()
+	defer p.cache.mu.Unlock()
+	p.cache.gen++
+	p.cache.ca = nil
+	p.cache.crl = nil
+}
+
+// pairStored drop cache when stored pair may be the new last CA
+func (p *PKI) pairStored(cn string) {
+	if cn == "ca" {
+		p.invalidateCache()
+	}
+}
+
+// cachedCA return copy of cached CA, so wiping it does not touch the cache, and current generation
+func (p *PKI) cachedCA() (*X509Pair, uint64) {
+	p.cache.mu.Lock()
+	defer p.cache.mu.Unlock()
+	if p.cache.ca == nil {
+		return nil, p.cache.gen
+	}
+	return copyPair(p.cache.ca), p.cache.gen
+}
+
+func (p *PKI) cacheCA(ca *X509Pair, gen uint64) {
+	p.cache.mu.Lock()
+	defer p.cache.mu.Unlock()
+	if p.cache.enabled && p.cache.gen == gen {
+		p.cache.ca = copyPair(ca)
+	}
+}
+
+func (p *PKI) cachedCRL() (*pkix.CertificateList, uint64) {
+	p.cache.mu.Lock()
+	defer p.cache.mu.Unlock()
+	return p.cache.crl, p.cache.gen
+}
+
+func (p *PKI) cacheCRL(list *pkix.CertificateList, gen uint64) {
+	p.cache.mu.Lock()
+	defer p.cache.mu.Unlock()
+	if p.cache.enabled && p.cache.gen == gen {
+		p.cache.crl = list
+	}
+}
+
+func copyPair(pair *X509Pair) *X509Pair {
+	cp := *pair
+	cp.KeyPemBytes = append([]byte(nil), pair.KeyPemBytes...)
+	cp.CertPemBytes = append([]byte(nil), pair.CertPemBytes...)
+	return &cp
+}
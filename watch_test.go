@@ -0,0 +1,79 @@
+package easyrsa
+
+import (
+	"crypto/x509/pkix"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKI_Watch(t *testing.T) {
+	pki, cleanup := getTmpPki()
+	defer cleanup()
+	storDir, _ := filepath.Abs(testData)
+	other := NewPKI(NewDirKeyStorage(storDir), NewFileSerialProvider(filepath.Join(storDir, "serial")),
+		NewFileCRLHolder(filepath.Join(storDir, "crl.pem")), pkix.Name{})
+
+	_, err := pki.NewCa()
+	assert.NoError(t, err)
+
+	events := make(chan WatchEvent, 100)
+	watcher, err := pki.Watch(func(event WatchEvent) { events <- event }, nil)
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	wait := func(crl bool) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case event := <-events:
+				if event.CRL == crl {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no watch event with crl %v", crl)
+			}
+		}
+	}
+
+	t.Run("ca added by other writer", func(t *testing.T) {
+		first, err := pki.GetLastCA()
+		assert.NoError(t, err)
+		second, err := other.NewCa()
+		assert.NoError(t, err)
+		wait(false)
+		last, err := pki.GetLastCA()
+		assert.NoError(t, err)
+		assert.NotEqual(t, first.Serial, last.Serial)
+		assert.Equal(t, second.Serial, last.Serial)
+	})
+
+	t.Run("crl updated by other writer", func(t *testing.T) {
+		pair, err := pki.NewCert("client", false, nil)
+		assert.NoError(t, err)
+		list, err := pki.GetCRL()
+		assert.NoError(t, err)
+		assert.Empty(t, list.TBSCertList.RevokedCertificates)
+		assert.NoError(t, other.RevokeOne(pair.Serial))
+		wait(true)
+		assert.True(t, pki.IsRevoked(pair.Serial))
+	})
+
+	t.Run("wiping returned ca keep cache", func(t *testing.T) {
+		ca, err := pki.GetLastCA()
+		assert.NoError(t, err)
+		ca.Wipe()
+		ca, err = pki.GetLastCA()
+		assert.NoError(t, err)
+		assert.True(t, ca.HasKey())
+		_, err = pki.NewCert("client2", false, nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("nothing to watch", func(t *testing.T) {
+		_, err := NewPKI(nil, nil, nil, pkix.Name{}).Watch(nil, nil)
+		assert.Error(t, err)
+	})
+}
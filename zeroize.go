@@ -0,0 +1,63 @@
+package easyrsa
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"math/big"
+)
+
+// Wipe zero KeyPemBytes of the pair and drop the reference
+func (pair *X509Pair) Wipe() {
+	zeroBytes(pair.KeyPemBytes)
+	pair.KeyPemBytes = nil
+}
+
+// ZeroKey best-effort zero private parts of the rsa key. Key must not be used after
+func ZeroKey(key *rsa.PrivateKey) {
+	if key == nil {
+		return
+	}
+	zeroInt(key.D)
+	for _, prime := range key.Primes {
+		zeroInt(prime)
+	}
+	zeroInt(key.Precomputed.Dp)
+	zeroInt(key.Precomputed.Dq)
+	zeroInt(key.Precomputed.Qinv)
+	for _, crt := range key.Precomputed.CRTValues {
+		zeroInt(crt.Exp)
+		zeroInt(crt.Coeff)
+		zeroInt(crt.R)
+	}
+}
+
+// zeroSigner best-effort zero private parts of rsa, ecdsa or ed25519 key
+func zeroSigner(signer crypto.Signer) {
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		ZeroKey(key)
+	case *ecdsa.PrivateKey:
+		zeroInt(key.D)
+	case ed25519.PrivateKey:
+		zeroBytes(key)
+	}
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func zeroInt(i *big.Int) {
+	if i == nil {
+		return
+	}
+	words := i.Bits()
+	for j := range words {
+		words[j] = 0
+	}
+	i.SetInt64(0)
+}
@@ -0,0 +1,43 @@
+package easyrsa
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZeroKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	ZeroKey(key)
+	assert.Equal(t, 0, key.D.Sign())
+	for _, prime := range key.Primes {
+		assert.Equal(t, 0, prime.Sign())
+	}
+	ZeroKey(nil)
+}
+
+func TestX509Pair_Wipe(t *testing.T) {
+	keyBytes := []byte("keybytes")
+	pair := NewX509Pair(keyBytes, []byte("certbytes"), "cn", nil)
+	pair.Wipe()
+	assert.Nil(t, pair.KeyPemBytes)
+	assert.Equal(t, make([]byte, len(keyBytes)), keyBytes)
+}
+
+func TestWithoutKeyRetention(t *testing.T) {
+	pki, cleanup := getTmpPki(WithoutKeyRetention())
+	defer cleanup()
+	ca, err := pki.NewCa()
+	assert.NoError(t, err)
+	assert.Nil(t, ca.KeyPemBytes)
+	pair, err := pki.NewCert("client", false, []string{""})
+	assert.NoError(t, err)
+	assert.Nil(t, pair.KeyPemBytes)
+	assert.NotEmpty(t, pair.CertPemBytes)
+	stored, err := pki.Storage.GetBySerial(pair.Serial)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, stored.KeyPemBytes)
+}